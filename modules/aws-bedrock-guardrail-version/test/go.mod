@@ -3,6 +3,9 @@ module aws-bedrock-guardrail-version
 go 1.21
 
 require (
+	github.com/JQUINONES82/terraform_modules/testkit v0.0.0
 	github.com/gruntwork-io/terratest v0.47.0
 	github.com/stretchr/testify v1.8.4
 )
+
+replace github.com/JQUINONES82/terraform_modules/testkit => ../../../testkit
@@ -5,6 +5,9 @@ import (
 
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/guardrail"
 )
 
 func TestBedrockGuardrailVersionBasic(t *testing.T) {
@@ -76,3 +79,55 @@ func TestBedrockGuardrailVersionAdvanced(t *testing.T) {
 	assert.NotEqual(t, stagingVersion, prodVersion)
 	assert.NotEqual(t, devVersion, prodVersion)
 }
+
+func TestBedrockGuardrailVersionPromotion(t *testing.T) {
+	terraformOptions := &terraform.Options{
+		TerraformDir: "../examples/advanced",
+		Vars: map[string]interface{}{
+			"guardrail_name":              "test-promotion-guardrail",
+			"dev_version_description":     "Test dev version",
+			"staging_version_description": "Test staging version",
+			"prod_version_description":    "Test prod version",
+			"aws_region":                  "us-east-1",
+		},
+	}
+
+	// Replay the example against the local Bedrock stand-in: dev, staging
+	// and prod versions are all cut from the planned draft
+	plan := terraform.InitAndPlanAndShowWithStructNoLogTempPlanFile(t, terraformOptions)
+	guardrails := guardrail.FromPlan(&plan.RawPlan)
+	require.Len(t, guardrails, 1)
+	draft := guardrails[0].Config
+
+	bedrock := guardrail.NewLocalBedrock()
+	bedrock.PutGuardrail("advanced", draft)
+	ledger := &guardrail.Ledger{}
+	versions := map[string]string{}
+	for _, env := range []string{"dev", "staging", "prod"} {
+		version, err := bedrock.CreateGuardrailVersion("advanced")
+		require.NoError(t, err)
+		versions[env] = version
+	}
+	ledger.Record("advanced", "dev", versions["dev"])
+	ledger.Record("advanced", "staging", versions["staging"])
+
+	// prod's version is a different number but an identical snapshot
+	policy := guardrail.DefaultPromotionPolicy()
+	assert.Error(t, policy.Check(ledger, bedrock, "advanced", "prod", versions["prod"]))
+	policy.Equivalent = true
+	assert.NoError(t, policy.Check(ledger, bedrock, "advanced", "prod", versions["prod"]))
+
+	// A draft edited after staging was cut must not reach prod
+	edited := draft
+	edited.SensitiveInformation = nil
+	bedrock.PutGuardrail("advanced", edited)
+	hotfix, err := bedrock.CreateGuardrailVersion("advanced")
+	require.NoError(t, err)
+
+	err = policy.Check(ledger, bedrock, "advanced", "prod", hotfix)
+	require.Error(t, err)
+	t.Log(err)
+	var perr *guardrail.PromotionError
+	require.ErrorAs(t, err, &perr)
+	assert.NotEmpty(t, perr.Changes.Weakening())
+}
@@ -3,6 +3,10 @@ module aws-bedrock-guardrail
 go 1.21
 
 require (
+	github.com/JQUINONES82/terraform_modules/testkit v0.0.0
+	github.com/aws/aws-sdk-go v1.44.122
 	github.com/gruntwork-io/terratest v0.47.0
 	github.com/stretchr/testify v1.8.4
 )
+
+replace github.com/JQUINONES82/terraform_modules/testkit => ../../../testkit
@@ -1,10 +1,25 @@
 package test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/gruntwork-io/terratest/modules/aws"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/guardrail"
 )
 
 func TestBedrockGuardrailBasic(t *testing.T) {
@@ -62,3 +77,176 @@ func TestBedrockGuardrailComprehensive(t *testing.T) {
 	assert.Equal(t, "test-comprehensive-guardrail", guardrailName)
 	assert.NotEmpty(t, guardrailStatus)
 }
+
+func TestBedrockGuardrailInputsValid(t *testing.T) {
+	for _, example := range []string{"basic", "comprehensive"} {
+		example := example
+		t.Run(example, func(t *testing.T) {
+			t.Parallel()
+
+			terraformOptions := &terraform.Options{
+				TerraformDir: "../examples/" + example,
+				Vars: map[string]interface{}{
+					"guardrail_name": "test-" + example + "-guardrail",
+					"aws_region":     "us-east-1",
+				},
+			}
+
+			// Validate the planned guardrail against the catalog; nothing is applied
+			plan := terraform.InitAndPlanAndShowWithStructNoLogTempPlanFile(t, terraformOptions)
+			findings := guardrail.ValidatePlan(&plan.RawPlan, guardrail.DefaultCatalog())
+			for _, f := range findings {
+				t.Log(f)
+			}
+
+			assert.Empty(t, findings.AtLeast(finding.High), findings.String())
+		})
+	}
+}
+
+// TestBedrockGuardrailBehaviour runs the prompt corpus for the comprehensive
+// example through the local evaluator, using the planned configuration. Set
+// GUARDRAIL_CORPUS_LIVE=1 to also apply the example and run the corpus,
+// including live_only cases, against the real ApplyGuardrail API.
+func TestBedrockGuardrailBehaviour(t *testing.T) {
+	awsRegion := "us-east-1"
+	terraformOptions := &terraform.Options{
+		TerraformDir: "../examples/comprehensive",
+		Vars: map[string]interface{}{
+			"guardrail_name": "test-behaviour-guardrail",
+			"aws_region":     awsRegion,
+		},
+	}
+
+	corpus, err := guardrail.LoadCorpus("testdata/comprehensive.yaml")
+	require.NoError(t, err)
+
+	plan := terraform.InitAndPlanAndShowWithStructNoLogTempPlanFile(t, terraformOptions)
+	guardrails := guardrail.FromPlan(&plan.RawPlan)
+	require.Len(t, guardrails, 1)
+
+	local, err := guardrail.NewLocalEvaluator(guardrails[0].Config, corpus.TopicKeywords)
+	require.NoError(t, err)
+	for _, u := range local.Unsupported() {
+		t.Logf("not evaluated locally: %s", u)
+	}
+	results := []guardrail.Result{corpus.Run(context.Background(), local, "local/DRAFT", false)}
+
+	if os.Getenv("GUARDRAIL_CORPUS_LIVE") != "" {
+		defer terraform.Destroy(t, terraformOptions)
+		terraform.Apply(t, terraformOptions)
+
+		sess, err := aws.NewAuthenticatedSession(awsRegion)
+		require.NoError(t, err)
+		live := &liveApplier{
+			guardrailID: terraform.Output(t, terraformOptions, "guardrail_id"),
+			region:      awsRegion,
+			session:     sess,
+		}
+		version := terraform.Output(t, terraformOptions, "guardrail_version")
+		results = append(results, corpus.Run(context.Background(), live, version, true))
+	}
+
+	t.Log("\n" + guardrail.Matrix(results...))
+	t.Log("\n" + guardrail.Summary(results...))
+	for _, r := range results {
+		assert.Empty(t, r.Failed(), "%s: failing cases", r.Version)
+	}
+}
+
+// liveApplier calls the bedrock-runtime ApplyGuardrail API. The SDK version
+// terratest pulls in predates the operation, so the request is signed by
+// hand.
+type liveApplier struct {
+	guardrailID string
+	region      string
+	session     *session.Session
+}
+
+type applyGuardrailOutput struct {
+	Action  string `json:"action"`
+	Outputs []struct {
+		Text string `json:"text"`
+	} `json:"outputs"`
+	Assessments []struct {
+		TopicPolicy struct {
+			Topics []struct{ Name, Action string } `json:"topics"`
+		} `json:"topicPolicy"`
+		ContentPolicy struct {
+			Filters []struct{ Type, Action string } `json:"filters"`
+		} `json:"contentPolicy"`
+		WordPolicy struct {
+			CustomWords      []struct{ Match, Action string }       `json:"customWords"`
+			ManagedWordLists []struct{ Match, Type, Action string } `json:"managedWordLists"`
+		} `json:"wordPolicy"`
+		SensitiveInformationPolicy struct {
+			PIIEntities []struct{ Match, Type, Action string } `json:"piiEntities"`
+			Regexes     []struct{ Name, Match, Action string } `json:"regexes"`
+		} `json:"sensitiveInformationPolicy"`
+	} `json:"assessments"`
+}
+
+func (a *liveApplier) ApplyGuardrail(ctx context.Context, version string, req guardrail.Request) (guardrail.Response, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"source":  req.Source,
+		"content": []interface{}{map[string]interface{}{"text": map[string]string{"text": req.Text}}},
+	})
+	if err != nil {
+		return guardrail.Response{}, err
+	}
+
+	url := fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com/guardrail/%s/version/%s/apply", a.region, a.guardrailID, version)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return guardrail.Response{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if _, err := v4.NewSigner(a.session.Config.Credentials).Sign(httpReq, bytes.NewReader(body), "bedrock", a.region, time.Now()); err != nil {
+		return guardrail.Response{}, err
+	}
+
+	httpResp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return guardrail.Response{}, err
+	}
+	defer httpResp.Body.Close()
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return guardrail.Response{}, err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return guardrail.Response{}, fmt.Errorf("ApplyGuardrail: %s: %s", httpResp.Status, data)
+	}
+
+	var out applyGuardrailOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return guardrail.Response{}, err
+	}
+
+	resp := guardrail.Response{Action: out.Action}
+	for _, o := range out.Outputs {
+		resp.Output += o.Text
+	}
+	for _, as := range out.Assessments {
+		for _, m := range as.TopicPolicy.Topics {
+			resp.Assessment.Topics = append(resp.Assessment.Topics, guardrail.PolicyMatch{Name: m.Name, Action: m.Action})
+		}
+		for _, m := range as.ContentPolicy.Filters {
+			resp.Assessment.ContentFilters = append(resp.Assessment.ContentFilters, guardrail.PolicyMatch{Name: m.Type, Action: m.Action})
+		}
+		for _, m := range as.WordPolicy.CustomWords {
+			resp.Assessment.Words = append(resp.Assessment.Words, guardrail.PolicyMatch{Name: m.Match, Match: m.Match, Action: m.Action})
+		}
+		for _, m := range as.WordPolicy.ManagedWordLists {
+			resp.Assessment.ManagedWords = append(resp.Assessment.ManagedWords, guardrail.PolicyMatch{Name: m.Type, Match: m.Match, Action: m.Action})
+		}
+		for _, m := range as.SensitiveInformationPolicy.PIIEntities {
+			resp.Assessment.PIIEntities = append(resp.Assessment.PIIEntities, guardrail.PolicyMatch{Name: m.Type, Match: m.Match, Action: m.Action})
+		}
+		for _, m := range as.SensitiveInformationPolicy.Regexes {
+			resp.Assessment.Regexes = append(resp.Assessment.Regexes, guardrail.PolicyMatch{Name: m.Name, Match: m.Match, Action: m.Action})
+		}
+	}
+
+	return resp, nil
+}
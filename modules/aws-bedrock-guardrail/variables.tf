@@ -120,7 +120,7 @@ variable "sensitive_information_policy_config" {
     
     pii_entities_config:
     - action: Action to take when PII is detected (BLOCK, ANONYMIZE)
-    - type: Type of PII entity (NAME, EMAIL, PHONE, SSN, etc.)
+    - type: Type of PII entity (NAME, EMAIL, PHONE, US_SOCIAL_SECURITY_NUMBER, etc.)
     
     regexes_config:
     - action: Action to take when regex matches (BLOCK, ANONYMIZE)
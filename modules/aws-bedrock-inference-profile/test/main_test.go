@@ -5,6 +5,9 @@ import (
 
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/inferenceprofile"
 )
 
 func TestBedrockInferenceProfileBasic(t *testing.T) {
@@ -96,3 +99,25 @@ func TestBedrockInferenceProfileAdvanced(t *testing.T) {
 	assert.Contains(t, stagingProfileArn, "inference-profile")
 	assert.Contains(t, prodProfileArn, "inference-profile")
 }
+
+func TestBedrockInferenceProfileModelSources(t *testing.T) {
+	terraformOptions := &terraform.Options{
+		TerraformDir: "../examples/advanced",
+		Vars: map[string]interface{}{
+			"project_name":                 "test-advanced-project",
+			"aws_region":                   "us-west-2",
+			"enable_cross_account_profile": false,
+		},
+	}
+
+	// Check every planned copy_from ARN against the model catalog and the
+	// solution module's default allowed_model_regions; nothing is applied
+	plan := terraform.InitAndPlanAndShowWithStructNoLogTempPlanFile(t, terraformOptions)
+	findings := inferenceprofile.ValidatePlan(&plan.RawPlan, inferenceprofile.DefaultCatalog(), inferenceprofile.Options{
+		AllowedRegions: []string{"us-east-1", "us-east-2", "us-west-2"},
+	})
+	for _, f := range findings {
+		t.Log(f)
+	}
+	assert.Empty(t, findings.AtLeast(finding.Medium), findings.String())
+}
@@ -13,6 +13,9 @@ provider "aws" {
   region = var.aws_region
 }
 
+data "aws_caller_identity" "current" {}
+data "aws_partition" "current" {}
+
 # Create CloudWatch log group for Bedrock logging
 resource "aws_cloudwatch_log_group" "bedrock_logs" {
   name              = var.log_group_name
@@ -34,6 +37,14 @@ resource "aws_iam_role" "bedrock_cloudwatch" {
         Principal = {
           Service = "bedrock.amazonaws.com"
         }
+        Condition = {
+          StringEquals = {
+            "aws:SourceAccount" = data.aws_caller_identity.current.account_id
+          }
+          ArnLike = {
+            "aws:SourceArn" = "arn:${data.aws_partition.current.partition}:bedrock:${var.aws_region}:${data.aws_caller_identity.current.account_id}:*"
+          }
+        }
       }
     ]
   })
@@ -1,10 +1,18 @@
 package test
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/invocationlog"
+	"github.com/JQUINONES82/terraform_modules/testkit/loggingcheck"
 )
 
 func TestBedrockModelInvocationLoggingS3(t *testing.T) {
@@ -126,3 +134,153 @@ func TestBedrockModelInvocationLoggingHybrid(t *testing.T) {
 	// Assert buckets are different
 	assert.NotEqual(t, s3LogsBucket, s3LargeDataBucket)
 }
+
+func TestBedrockModelInvocationLoggingDelivery(t *testing.T) {
+	examples := map[string]map[string]interface{}{
+		"s3-logging": {
+			"bucket_name_prefix": "test-bedrock-logs",
+			"s3_key_prefix":      "test-logs",
+			"aws_region":         "us-east-1",
+			"enable_video_data":  false,
+		},
+		"cloudwatch-logging": {
+			"resource_prefix":    "test-bedrock-cw",
+			"log_group_name":     "/aws/bedrock/test-model-invocations",
+			"log_retention_days": 7,
+			"aws_region":         "us-east-1",
+			"enable_video_data":  false,
+		},
+		"hybrid-logging": {
+			"resource_prefix":       "test-hybrid",
+			"bucket_name_prefix":    "test-hybrid-bedrock",
+			"log_group_name":        "/aws/bedrock/test-hybrid-invocations",
+			"s3_key_prefix":         "standard-logs",
+			"large_data_key_prefix": "large-data-logs",
+			"aws_region":            "us-east-1",
+			"log_retention_days":    14,
+			"enable_video_data":     false,
+		},
+	}
+
+	for example, vars := range examples {
+		example, vars := example, vars
+		t.Run(example, func(t *testing.T) {
+			t.Parallel()
+
+			terraformOptions := &terraform.Options{
+				TerraformDir: "../examples/" + example,
+				Vars:         vars,
+			}
+
+			// Deliver one synthetic record per modality, plus one large enough
+			// to go through the large-data bucket, following the planned
+			// configuration; nothing is applied
+			plan := terraform.InitAndPlanAndShowWithStructNoLogTempPlanFile(t, terraformOptions)
+			configs := invocationlog.FromPlan(&plan.RawPlan)
+			require.Len(t, configs, 1)
+			cfg := configs[0]
+
+			now := time.Now()
+			var records []invocationlog.Record
+			for i, m := range invocationlog.Modalities {
+				records = append(records, invocationlog.Synthetic(m, "111122223333", "us-east-1", now, i))
+			}
+			large := invocationlog.Synthetic(invocationlog.Text, "111122223333", "us-east-1", now, len(records))
+			large.Input.BodyJSON = json.RawMessage(`{"inputText":"` + strings.Repeat("x", invocationlog.DefaultLargeDataThreshold) + `"}`)
+			records = append(records, large)
+
+			// Where records should land, built from the example's inputs
+			// rather than the planned configuration. Bucket names end in a
+			// random suffix and are only known after apply.
+			region := vars["aws_region"].(string)
+			logs := map[string]string{
+				"s3-logging":     vars["bucket_name_prefix"].(string) + "-",
+				"hybrid-logging": vars["bucket_name_prefix"].(string) + "-logs-",
+			}[example]
+			prefix, _ := vars["s3_key_prefix"].(string)
+			largeData, _ := vars["large_data_key_prefix"].(string)
+			logGroup, _ := vars["log_group_name"].(string)
+
+			if logs == "" {
+				assert.Nil(t, cfg.S3)
+			} else if assert.NotNil(t, cfg.S3) {
+				assert.Equal(t, prefix, cfg.S3.Prefix)
+				if cfg.S3.Bucket != "" {
+					assert.True(t, strings.HasPrefix(cfg.S3.Bucket, logs), cfg.S3.Bucket)
+				}
+			}
+			if logGroup == "" {
+				assert.Nil(t, cfg.CloudWatch)
+			} else if assert.NotNil(t, cfg.CloudWatch) {
+				assert.Equal(t, logGroup, cfg.CloudWatch.LogGroup)
+				if largeData == "" {
+					assert.Nil(t, cfg.CloudWatch.LargeData)
+				} else if assert.NotNil(t, cfg.CloudWatch.LargeData) {
+					assert.Equal(t, largeData, cfg.CloudWatch.LargeData.Prefix)
+				}
+			}
+
+			sink := &invocationlog.Sink{}
+			require.NoError(t, invocationlog.NewWriter(cfg, sink).Write(records...))
+
+			findings := cfg.Check(sink)
+			for _, f := range findings {
+				t.Log(f)
+			}
+			assert.Empty(t, findings.AtLeast(finding.High), findings.String())
+
+			// Video delivery is disabled, so no video record may appear
+			var logObjects, largeObjects int
+			for _, o := range sink.Objects {
+				if strings.HasSuffix(o.Key, "_input.json") {
+					largeObjects++
+					assert.True(t, strings.HasPrefix(o.Key, largeData+"/AWSLogs/111122223333/BedrockModelInvocationLogs/"+region+"/"), o.Key)
+					continue
+				}
+				logObjects++
+				assert.True(t, strings.HasPrefix(o.Key, prefix+"/AWSLogs/111122223333/BedrockModelInvocationLogs/"+region+"/"), o.Key)
+				delivered, err := invocationlog.ParseObject(o.Body)
+				require.NoError(t, err)
+				for _, r := range delivered {
+					assert.NotEqual(t, invocationlog.Video, invocationlog.DetectModality(r))
+				}
+			}
+			assert.Equal(t, logs != "", logObjects > 0, "objects under %q", prefix)
+			assert.Equal(t, largeData != "", largeObjects == 1, "large data under %q", largeData)
+
+			if logGroup == "" {
+				assert.Empty(t, sink.Events)
+				return
+			}
+			require.Len(t, sink.Events, 1)
+			delivered, err := invocationlog.ParseEvents(sink.Events[logGroup])
+			require.NoError(t, err)
+			assert.Len(t, delivered, len(records)-1)
+		})
+	}
+}
+
+func TestBedrockModelInvocationLoggingPermissions(t *testing.T) {
+	terraformOptions := &terraform.Options{
+		TerraformDir: "../examples/hybrid-logging",
+		Vars: map[string]interface{}{
+			"resource_prefix":       "test-hybrid",
+			"bucket_name_prefix":    "test-hybrid-bedrock",
+			"log_group_name":        "/aws/bedrock/test-hybrid-invocations",
+			"s3_key_prefix":         "standard-logs",
+			"large_data_key_prefix": "large-data-logs",
+			"aws_region":            "us-east-1",
+		},
+	}
+
+	// Follow the links from the logging configuration to the role, log
+	// group and buckets it writes through; nothing is applied, so links
+	// built from values known after apply are reported as LOW
+	plan := terraform.InitAndPlanAndShowWithStructNoLogTempPlanFile(t, terraformOptions)
+	findings := loggingcheck.Check(&plan.RawPlan)
+	for _, f := range findings {
+		t.Log(f)
+	}
+	assert.Empty(t, findings.AtLeast(finding.High), findings.String())
+	assert.Empty(t, findings.ByRule(loggingcheck.RuleTrustConditions), findings.String())
+}
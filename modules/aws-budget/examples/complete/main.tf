@@ -132,7 +132,7 @@ module "ai_services_budget" {
   # Enable anomaly detection for AI services
   enable_anomaly_detection = true
   anomaly_threshold_value  = 100
-  anomaly_subscription_frequency = "IMMEDIATE"
+  anomaly_subscription_frequency = "DAILY"
   anomaly_subscriber_email_addresses = [var.ai_team_email]
 
   tags = merge(var.tags, {
@@ -325,7 +325,7 @@ module "prod_environment_budget" {
   # Enable anomaly detection for production
   enable_anomaly_detection = true
   anomaly_threshold_value  = 200
-  anomaly_subscription_frequency = "IMMEDIATE"
+  anomaly_subscription_frequency = "DAILY"
   anomaly_subscriber_email_addresses = [var.ops_team_email]
 
   tags = merge(var.tags, {
@@ -18,10 +18,69 @@ locals {
   # Calculate time period start if not provided (first day of current month)
   time_period_start = var.time_period_start != null ? var.time_period_start : formatdate("YYYY-MM-01_00:00", timestamp())
   
-  # Build cost filters dynamically
-  cost_filters = {
-    for key, value in var.cost_filters : upper(replace(key, "_", "")) => value if value != null && length(value) > 0
+  # Cost filter names as the Budgets API spells them
+  cost_filter_names = {
+    service              = "Service"
+    linked_account       = "LinkedAccount"
+    availability_zone    = "AZ"
+    instance_type        = "InstanceType"
+    region               = "Region"
+    usage_type           = "UsageType"
+    usage_type_group     = "UsageTypeGroup"
+    record_type          = "RecordType"
+    operating_system     = "OperatingSystem"
+    tenancy              = "Tenancy"
+    scope                = "Scope"
+    platform             = "Platform"
+    subscription_id      = "SubscriptionId"
+    legal_entity_name    = "LegalEntityName"
+    deployment_option    = "DeploymentOption"
+    database_engine      = "DatabaseEngine"
+    cache_engine         = "CacheEngine"
+    instance_type_family = "InstanceTypeFamily"
+    billing_entity       = "BillingEntity"
+    reservation_id       = "ReservationId"
+    resource_id          = "ResourceId"
+    rightsizing_type     = "RightsizingType"
+    savings_plans_type   = "SavingsPlansType"
+    service_code         = "ServiceCode"
+    usage_account_id     = "UsageAccountId"
+    purchase_type        = "PurchaseType"
   }
+
+  # Build cost filters dynamically; tags become TagKeyValue filters of
+  # user:<key>$<value>
+  cost_filters = merge(
+    {
+      for key, value in var.cost_filters : local.cost_filter_names[key] => value
+      if key != "tag" && value != null && length(value) > 0
+    },
+    length(coalesce(var.cost_filters.tag, {})) > 0 ? {
+      TagKeyValue = flatten([
+        for key, values in var.cost_filters.tag : [for value in values : format("user:%s$%s", key, value)]
+      ])
+    } : {}
+  )
+
+  # Cost Explorer expressions the custom anomaly monitor watches
+  anomaly_monitor_expressions = concat(
+    var.anomaly_monitor_specification.dimension_key != null ? [{
+      Dimensions = {
+        Key          = var.anomaly_monitor_specification.dimension_key
+        Values       = [var.anomaly_monitor_specification.dimension_value]
+        MatchOptions = coalesce(var.anomaly_monitor_specification.match_options, ["EQUALS"])
+      }
+    }] : [],
+    [
+      for key, values in coalesce(var.anomaly_monitor_specification.tags, {}) : {
+        Tags = {
+          Key          = key
+          Values       = values
+          MatchOptions = ["EQUALS"]
+        }
+      }
+    ]
+  )
   
   # Common tags
   common_tags = merge(var.tags, {
@@ -88,35 +147,35 @@ resource "aws_budgets_budget" "this" {
   tags = local.common_tags
 }
 
-# Cost Anomaly Detector
-resource "aws_ce_anomaly_detector" "this" {
+# Cost Anomaly Monitor. Without a specification it watches every service
+# (a DIMENSIONAL SERVICE monitor); otherwise it is a CUSTOM monitor of the
+# given dimension and tags.
+resource "aws_ce_anomaly_monitor" "this" {
   count = var.enable_anomaly_detection ? 1 : 0
 
-  name         = var.anomaly_detection_name != null ? var.anomaly_detection_name : "${var.budget_name}-anomaly-detector"
-  detector_type = "CUSTOM"
-
-  specification = jsonencode({
-    Dimension = var.anomaly_monitor_specification.dimension_key != null ? {
-      Key           = var.anomaly_monitor_specification.dimension_key
-      Values        = [var.anomaly_monitor_specification.dimension_value]
-      MatchOptions  = var.anomaly_monitor_specification.match_options != null ? var.anomaly_monitor_specification.match_options : ["EQUALS"]
-    } : null
-    
-    Tags = var.anomaly_monitor_specification.tags != null ? var.anomaly_monitor_specification.tags : {}
-  })
+  name              = var.anomaly_detection_name != null ? var.anomaly_detection_name : "${var.budget_name}-anomaly-detector"
+  monitor_type      = length(local.anomaly_monitor_expressions) == 0 ? "DIMENSIONAL" : "CUSTOM"
+  monitor_dimension = length(local.anomaly_monitor_expressions) == 0 ? "SERVICE" : null
+
+  monitor_specification = length(local.anomaly_monitor_expressions) == 0 ? null : (
+    length(local.anomaly_monitor_expressions) == 1
+    ? jsonencode(local.anomaly_monitor_expressions[0])
+    : jsonencode({ And = local.anomaly_monitor_expressions })
+  )
 
   tags = local.common_tags
 }
 
-# Cost Anomaly Subscription
+# Cost Anomaly Subscription for email subscribers, which receive DAILY or
+# WEEKLY summaries
 resource "aws_ce_anomaly_subscription" "this" {
-  count = var.enable_anomaly_detection ? 1 : 0
+  count = var.enable_anomaly_detection && length(var.anomaly_subscriber_email_addresses) > 0 ? 1 : 0
 
   name      = "${var.budget_name}-anomaly-subscription"
   frequency = var.anomaly_subscription_frequency
-  
-  monitor_arn_list = [aws_ce_anomaly_detector.this[0].arn]
-  
+
+  monitor_arn_list = [aws_ce_anomaly_monitor.this[0].arn]
+
   dynamic "subscriber" {
     for_each = var.anomaly_subscriber_email_addresses
     content {
@@ -124,7 +183,28 @@ resource "aws_ce_anomaly_subscription" "this" {
       address = subscriber.value
     }
   }
-  
+
+  threshold_expression {
+    dimension {
+      key           = "ANOMALY_TOTAL_IMPACT_ABSOLUTE"
+      values        = [tostring(var.anomaly_threshold_value)]
+      match_options = [var.anomaly_threshold_expression]
+    }
+  }
+
+  tags = local.common_tags
+}
+
+# Cost Anomaly Subscription for SNS subscribers, which are alerted on each
+# anomaly as it is detected
+resource "aws_ce_anomaly_subscription" "sns" {
+  count = var.enable_anomaly_detection && length(var.anomaly_subscriber_sns_topic_arns) > 0 ? 1 : 0
+
+  name      = "${var.budget_name}-anomaly-sns-subscription"
+  frequency = "IMMEDIATE"
+
+  monitor_arn_list = [aws_ce_anomaly_monitor.this[0].arn]
+
   dynamic "subscriber" {
     for_each = var.anomaly_subscriber_sns_topic_arns
     content {
@@ -134,12 +214,10 @@ resource "aws_ce_anomaly_subscription" "this" {
   }
 
   threshold_expression {
-    and {
-      dimension {
-        key           = "ANOMALY_TOTAL_IMPACT_ABSOLUTE"
-        values        = [tostring(var.anomaly_threshold_value)]
-        match_options = [var.anomaly_threshold_expression]
-      }
+    dimension {
+      key           = "ANOMALY_TOTAL_IMPACT_ABSOLUTE"
+      values        = [tostring(var.anomaly_threshold_value)]
+      match_options = [var.anomaly_threshold_expression]
     }
   }
 
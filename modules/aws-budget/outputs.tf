@@ -51,22 +51,27 @@ output "budget_time_period_end" {
 # Anomaly Detection Outputs
 output "anomaly_detector_arn" {
   description = "The ARN of the cost anomaly detector"
-  value       = var.enable_anomaly_detection ? aws_ce_anomaly_detector.this[0].arn : null
+  value       = var.enable_anomaly_detection ? aws_ce_anomaly_monitor.this[0].arn : null
 }
 
 output "anomaly_detector_name" {
   description = "The name of the cost anomaly detector"
-  value       = var.enable_anomaly_detection ? aws_ce_anomaly_detector.this[0].name : null
+  value       = var.enable_anomaly_detection ? aws_ce_anomaly_monitor.this[0].name : null
 }
 
 output "anomaly_subscription_arn" {
-  description = "The ARN of the cost anomaly subscription"
-  value       = var.enable_anomaly_detection ? aws_ce_anomaly_subscription.this[0].arn : null
+  description = "The ARN of the cost anomaly subscription for email subscribers"
+  value       = try(aws_ce_anomaly_subscription.this[0].arn, null)
 }
 
 output "anomaly_subscription_name" {
-  description = "The name of the cost anomaly subscription"
-  value       = var.enable_anomaly_detection ? aws_ce_anomaly_subscription.this[0].name : null
+  description = "The name of the cost anomaly subscription for email subscribers"
+  value       = try(aws_ce_anomaly_subscription.this[0].name, null)
+}
+
+output "anomaly_sns_subscription_arn" {
+  description = "The ARN of the cost anomaly subscription for SNS subscribers"
+  value       = try(aws_ce_anomaly_subscription.sns[0].arn, null)
 }
 
 # CloudWatch Alarm Outputs
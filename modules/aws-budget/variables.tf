@@ -308,7 +308,7 @@ variable "anomaly_detection_name" {
 }
 
 variable "anomaly_monitor_specification" {
-  description = "Configuration for anomaly detection monitoring"
+  description = "What a custom anomaly monitor watches: a dimension (such as LINKED_ACCOUNT) and/or cost allocation tags. Leave empty to monitor every AWS service."
   type = object({
     dimension_key   = optional(string)
     dimension_value = optional(string)
@@ -319,26 +319,24 @@ variable "anomaly_monitor_specification" {
 }
 
 variable "anomaly_subscription_frequency" {
-  description = "Frequency of anomaly detection notifications (DAILY, IMMEDIATE, WEEKLY)"
+  description = "Frequency of anomaly summaries sent to email subscribers (DAILY or WEEKLY). SNS subscribers always receive IMMEDIATE alerts."
   type        = string
   default     = "DAILY"
   
   validation {
-    condition     = contains(["DAILY", "IMMEDIATE", "WEEKLY"], var.anomaly_subscription_frequency)
-    error_message = "Anomaly subscription frequency must be one of: DAILY, IMMEDIATE, WEEKLY."
+    condition     = contains(["DAILY", "WEEKLY"], var.anomaly_subscription_frequency)
+    error_message = "Anomaly subscription frequency must be one of: DAILY, WEEKLY. SNS subscribers always receive IMMEDIATE alerts."
   }
 }
 
 variable "anomaly_threshold_expression" {
-  description = "Expression to determine when to trigger anomaly alerts"
+  description = "Match option comparing an anomaly's total impact with anomaly_threshold_value. Cost Explorer only supports GREATER_THAN_OR_EQUAL."
   type        = string
   default     = "GREATER_THAN_OR_EQUAL"
   
   validation {
-    condition = contains([
-      "GREATER_THAN_OR_EQUAL", "LESS_THAN_OR_EQUAL"
-    ], var.anomaly_threshold_expression)
-    error_message = "Anomaly threshold expression must be GREATER_THAN_OR_EQUAL or LESS_THAN_OR_EQUAL."
+    condition     = var.anomaly_threshold_expression == "GREATER_THAN_OR_EQUAL"
+    error_message = "Anomaly threshold expression must be GREATER_THAN_OR_EQUAL."
   }
 }
 
@@ -127,8 +127,9 @@ resource "aws_cloudwatch_metric_alarm" "anomaly" {
   threshold_metric_id       = "ad1"
 
   metric_query {
-    id = "m1"
-    
+    id          = "m1"
+    return_data = true
+
     metric {
       metric_name = var.metric_name
       namespace   = var.namespace
@@ -139,8 +140,10 @@ resource "aws_cloudwatch_metric_alarm" "anomaly" {
   }
 
   metric_query {
-    id = "ad1"
-    expression = "ANOMALY_DETECTION_FUNCTION(m1, ${var.anomaly_threshold})"
+    id          = "ad1"
+    expression  = "ANOMALY_DETECTION_BAND(m1, ${var.anomaly_threshold})"
+    label       = "${var.metric_name} (expected)"
+    return_data = true
   }
 
   tags = var.tags
@@ -140,7 +140,7 @@ variable "threshold" {
 }
 
 variable "threshold_metric_id" {
-  description = "If this is an alarm based on an anomaly detection model, make this value match the ID of the ANOMALY_DETECTION_FUNCTION"
+  description = "If this is an alarm based on an anomaly detection model, make this value match the ID of the ANOMALY_DETECTION_BAND expression"
   type        = string
   default     = null
 }
@@ -116,9 +116,14 @@ variable "max_size" {
 variable "cloudwatch_config" {
   type        = string
   description = <<-EOT
-    Cloudwatch config file contents.
+    CloudWatch agent configuration JSON. Replaces the default
+    configuration in cloudwatch-config.tftpl, including its collectors.
   EOT
   default     = null
+  validation {
+    condition     = var.cloudwatch_config == null || can(jsondecode(var.cloudwatch_config))
+    error_message = "CloudWatch agent configuration must be valid JSON."
+  }
 }
 
 variable "root_volume_size" {
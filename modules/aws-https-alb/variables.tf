@@ -76,18 +76,30 @@ variable "log_bucket" {
 
 variable "waf_managed_rules" {
   type = map(object({
+    version               = optional(string)
     rule_action_overrides = optional(map(string), {})
   }))
   description = <<-EOT
-    List of WAF managed rules.
+    AWS managed rule groups to evaluate, in name order, keyed by rule group
+    name. version pins the rule group version (the default version when
+    null) and rule_action_overrides maps rule names in the group to the
+    action to use instead: allow, block, count, captcha or challenge.
   EOT
+  validation {
+    condition = alltrue(flatten([
+      for group in values(var.waf_managed_rules) : [
+        for action in values(group.rule_action_overrides) : contains(["allow", "block", "count", "captcha", "challenge"], action)
+      ]
+    ]))
+    error_message = "rule_action_overrides actions must be allow, block, count, captcha or challenge."
+  }
   default = {
     AWSManagedRulesPHPRuleSet             = {}
     AWSManagedRulesAmazonIpReputationList = {}
     AWSManagedRulesAnonymousIpList        = {}
     AWSManagedRulesCommonRuleSet = {
       rule_action_overrides = {
-        SizeRestrictions_BODY = "allow"
+        SizeRestrictions_BODY = "count"
       }
     }
     AWSManagedRulesKnownBadInputsRuleSet = {}
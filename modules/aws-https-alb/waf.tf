@@ -21,13 +21,31 @@ resource "aws_wafv2_web_acl" "this" {
         managed_rule_group_statement {
           name        = rule.key
           vendor_name = "AWS"
+          version     = rule.value.version
           dynamic "rule_action_override" {
-            for_each = lookup(rule.value, "rule_action_overrides", {})
+            for_each = rule.value.rule_action_overrides
             content {
               name = rule_action_override.key
               action_to_use {
-                allow {
-
+                dynamic "allow" {
+                  for_each = rule_action_override.value == "allow" ? [1] : []
+                  content {}
+                }
+                dynamic "block" {
+                  for_each = rule_action_override.value == "block" ? [1] : []
+                  content {}
+                }
+                dynamic "count" {
+                  for_each = rule_action_override.value == "count" ? [1] : []
+                  content {}
+                }
+                dynamic "captcha" {
+                  for_each = rule_action_override.value == "captcha" ? [1] : []
+                  content {}
+                }
+                dynamic "challenge" {
+                  for_each = rule_action_override.value == "challenge" ? [1] : []
+                  content {}
                 }
               }
             }
@@ -22,9 +22,12 @@ resource "aws_vpc_ipam" "this" {
 }
 
 resource "aws_vpc_ipam_pool" "this" {
-  address_family = "ipv4"
-  ipam_scope_id  = aws_vpc_ipam.this.private_default_scope_id
-  locale         = data.aws_region.current.name
+  address_family                    = "ipv4"
+  ipam_scope_id                     = aws_vpc_ipam.this.private_default_scope_id
+  locale                            = data.aws_region.current.name
+  allocation_default_netmask_length = var.allocation_default_netmask_length
+  allocation_min_netmask_length     = var.allocation_min_netmask_length
+  allocation_max_netmask_length     = var.allocation_max_netmask_length
 }
 
 resource "aws_vpc_ipam_pool_cidr" "this" {
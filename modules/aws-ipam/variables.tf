@@ -9,13 +9,43 @@ variable "root_cidr" {
   description = <<-EOT
     Top level CIDR.
   EOT
+  validation {
+    condition     = can(cidrnetmask(var.root_cidr))
+    error_message = "The root CIDR must be an IPv4 CIDR block, such as 10.0.0.0/8."
+  }
 }
 
 variable "ipam_regions" {
   type        = list(string)
   description = <<-EOT
     List of regions to enable the IPAM in.  The region of the provider is
-    automatically included.
+    automatically included.  The pool's locale is the region of the
+    provider, so only VPCs in that region can allocate from it.
   EOT
   default     = []
 }
+
+variable "allocation_default_netmask_length" {
+  type        = number
+  description = <<-EOT
+    Netmask length of allocations that do not specify one.
+  EOT
+  default     = null
+}
+
+variable "allocation_min_netmask_length" {
+  type        = number
+  description = <<-EOT
+    Smallest netmask length, so the largest CIDR, an allocation may request.
+  EOT
+  default     = null
+}
+
+variable "allocation_max_netmask_length" {
+  type        = number
+  description = <<-EOT
+    Largest netmask length, so the smallest CIDR, an allocation may request.
+    Small allocations fragment the pool.
+  EOT
+  default     = null
+}
@@ -113,7 +113,7 @@ module "comprehensive_kms_key" {
     }
     "monitoring-access" = {
       grantee_principal = aws_iam_role.application_role.arn
-      operations        = ["DescribeKey", "GetKeyPolicy"]
+      operations        = ["DescribeKey"]
     }
   }
 
@@ -0,0 +1,43 @@
+terraform {
+  required_version = ">= 1.0"
+  required_providers {
+    aws = {
+      source  = "hashicorp/aws"
+      version = ">= 5.0"
+    }
+  }
+}
+
+provider "aws" {
+  region = var.aws_region
+}
+
+# External KMS key with imported key material. The AWS provider fetches the
+# import parameters and wraps the material itself, so only the plaintext
+# base64 material is passed in.
+module "external_kms_key" {
+  source = "../../"
+
+  description         = "External KMS key with imported key material"
+  create_key          = false
+  create_external_key = true
+  key_material_base64 = var.key_material_base64
+  valid_to            = var.valid_to
+
+  tags = {
+    Name        = "external-kms-key"
+    Environment = "example"
+    ManagedBy   = "terraform"
+  }
+}
+
+# Outputs
+output "external_key_id" {
+  description = "The external KMS key ID"
+  value       = module.external_kms_key.external_key_id
+}
+
+output "external_key_arn" {
+  description = "The external KMS key ARN"
+  value       = module.external_kms_key.external_key_arn
+}
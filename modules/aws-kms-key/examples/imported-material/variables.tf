@@ -0,0 +1,17 @@
+variable "aws_region" {
+  description = "AWS region for resources"
+  type        = string
+  default     = "us-east-1"
+}
+
+variable "key_material_base64" {
+  description = "Base64 encoded 256-bit key material to import. Pass it as TF_VAR_key_material_base64 so it never appears on a command line."
+  type        = string
+  sensitive   = true
+}
+
+variable "valid_to" {
+  description = "RFC 3339 time at which the imported key material expires. Null means it never expires."
+  type        = string
+  default     = null
+}
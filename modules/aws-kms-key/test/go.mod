@@ -3,6 +3,8 @@ module github.com/aws-kms-key/test
 go 1.21
 
 require (
+	github.com/JQUINONES82/terraform_modules/testkit v0.0.0
+	github.com/aws/aws-sdk-go v1.44.317
 	github.com/gruntwork-io/terratest v0.46.7
 	github.com/stretchr/testify v1.8.4
 )
@@ -15,7 +17,6 @@ require (
 	cloud.google.com/go/storage v1.33.0 // indirect
 	github.com/agext/levenshtein v1.2.3 // indirect
 	github.com/apparentlymart/go-textseg/v15 v15.0.0 // indirect
-	github.com/aws/aws-sdk-go v1.44.317 // indirect
 	github.com/cpuguy83/go-md2man/v2 v2.0.2 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
@@ -61,3 +62,5 @@ require (
 	google.golang.org/protobuf v1.31.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/JQUINONES82/terraform_modules/testkit => ../../../testkit
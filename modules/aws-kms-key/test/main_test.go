@@ -1,14 +1,25 @@
 package test
 
 import (
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	awssdk "github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kms"
 	"github.com/gruntwork-io/terratest/modules/aws"
+	"github.com/gruntwork-io/terratest/modules/logger"
 	"github.com/gruntwork-io/terratest/modules/random"
 	"github.com/gruntwork-io/terratest/modules/terraform"
+	terratesting "github.com/gruntwork-io/terratest/modules/testing"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/kmsimport"
+	"github.com/JQUINONES82/terraform_modules/testkit/kmslint"
 )
 
 func TestKMSKeyBasic(t *testing.T) {
@@ -196,3 +207,102 @@ func TestKMSKeyValidation(t *testing.T) {
 	_, err := terraform.InitAndPlanE(t, terraformOptions)
 	assert.NoError(t, err, "Basic configuration should be valid")
 }
+
+func TestKMSKeyPolicyLint(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := aws.GetRandomStableRegion(t, nil, nil)
+
+	for _, example := range []string{"basic", "with-aliases", "with-grants", "comprehensive"} {
+		example := example
+		t.Run(example, func(t *testing.T) {
+			t.Parallel()
+
+			terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+				TerraformDir: "../examples/" + example,
+				Vars: map[string]interface{}{
+					"aws_region": awsRegion,
+				},
+				EnvVars: map[string]string{
+					"AWS_DEFAULT_REGION": awsRegion,
+				},
+			})
+
+			// Lint the planned key policies and grants; nothing is applied
+			plan := terraform.InitAndPlanAndShowWithStructNoLogTempPlanFile(t, terraformOptions)
+			findings := kmslint.Lint(&plan.RawPlan, kmslint.Options{})
+			for _, f := range findings {
+				t.Log(f)
+			}
+
+			// High severity findings are lockouts, kms:* leaks and grants AWS will reject
+			assert.Empty(t, findings.AtLeast(finding.High), findings.String())
+		})
+	}
+}
+
+// capturingLogger records everything Terratest logs, while still printing
+// it, so a test can prove that a secret never reached the logs.
+type capturingLogger struct {
+	mu  sync.Mutex
+	out strings.Builder
+}
+
+func (l *capturingLogger) Logf(t terratesting.TestingT, format string, args ...interface{}) {
+	l.mu.Lock()
+	fmt.Fprintf(&l.out, format+"\n", args...)
+	l.mu.Unlock()
+
+	logger.Terratest.Logf(t, format, args...)
+}
+
+func (l *capturingLogger) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.out.String()
+}
+
+func TestKMSKeyExternalKeyMaterial(t *testing.T) {
+	t.Parallel()
+
+	awsRegion := aws.GetRandomStableRegion(t, nil, nil)
+
+	// Generate fresh 256-bit material; it prints as [REDACTED ...] if logged
+	material, err := kmsimport.GenerateMaterial(nil)
+	require.NoError(t, err)
+	validTo := time.Now().UTC().Add(48 * time.Hour).Truncate(time.Second)
+
+	captured := &capturingLogger{}
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: "../examples/imported-material",
+		Vars: map[string]interface{}{
+			"aws_region": awsRegion,
+			"valid_to":   validTo.Format(time.RFC3339),
+		},
+		// The material goes through the environment, never the command line
+		EnvVars: map[string]string{
+			"AWS_DEFAULT_REGION":         awsRegion,
+			"TF_VAR_key_material_base64": material.Base64(),
+		},
+		Logger: logger.New(captured),
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+
+	terraform.InitAndApply(t, terraformOptions)
+
+	keyId := terraform.Output(t, terraformOptions, "external_key_id")
+	require.NotEmpty(t, keyId)
+
+	// Verify the material was imported and expires when requested
+	result, err := aws.NewKmsClient(t, awsRegion).DescribeKey(&kms.DescribeKeyInput{KeyId: awssdk.String(keyId)})
+	require.NoError(t, err)
+	metadata := result.KeyMetadata
+	assert.Equal(t, kms.OriginTypeExternal, awssdk.StringValue(metadata.Origin))
+	assert.Equal(t, kms.KeyStateEnabled, awssdk.StringValue(metadata.KeyState))
+	assert.Equal(t, kms.ExpirationModelTypeKeyMaterialExpires, awssdk.StringValue(metadata.ExpirationModel))
+	assert.True(t, validTo.Equal(awssdk.TimeValue(metadata.ValidTo)), "valid_to %s, got %s", validTo, awssdk.TimeValue(metadata.ValidTo))
+
+	// The material must not appear anywhere in the Terraform logs
+	assert.NotContains(t, captured.String(), material.Base64(), "key material %s leaked into the logs", material.Fingerprint())
+}
@@ -125,6 +125,7 @@ variable "grants" {
 variable "key_material_base64" {
   type        = string
   default     = null
+  sensitive   = true
   description = "Base64 encoded 256-bit symmetric encryption key material to import."
 }
 
@@ -25,7 +25,7 @@ resource "aws_ecs_task_definition" "this" {
     for_each = var.placement_constraints
     content {
       type       = placement_constraints.value.type
-      expression = lookup(placement_constraints.value.expression, null)
+      expression = placement_constraints.value.expression
     }
   }
 
@@ -34,12 +34,15 @@ resource "aws_ecs_task_definition" "this" {
     for_each = var.volumes
     content {
       name = volume.key
-      docker_volume_configuration {
-        scope         = lookup(volume.value.docker_volume_configuration, "scope", null)
-        autoprovision = lookup(volume.value.docker_volume_configuration, "autoprovision", null)
-        driver        = lookup(volume.value.docker_volume_configuration, "driver", null)
-        driver_opts   = lookup(volume.value.docker_volume_configuration, "driver_opts", null)
-        labels        = lookup(volume.value.docker_volume_configuration, "labels", null)
+      dynamic "docker_volume_configuration" {
+        for_each = volume.value.docker_volume_configuration == null ? [] : [volume.value.docker_volume_configuration]
+        content {
+          scope         = docker_volume_configuration.value.scope
+          autoprovision = docker_volume_configuration.value.autoprovision
+          driver        = docker_volume_configuration.value.driver
+          driver_opts   = docker_volume_configuration.value.driver_opts
+          labels        = docker_volume_configuration.value.labels
+        }
       }
     }
   }
@@ -65,7 +68,7 @@ resource "aws_ecs_service" "this" {
     for_each = var.load_balancer_targets
     content {
       target_group_arn = aws_lb_target_group.this[load_balancer.key].arn
-      container_port   = lookup(load_balancer.value, "port", 80)
+      container_port   = load_balancer.value.port
       container_name   = load_balancer.key
     }
   }
@@ -78,8 +81,8 @@ data "aws_subnet" "this" {
 resource "aws_lb_target_group" "this" {
   # checkov:skip=CKV_AWS_261
   for_each    = var.load_balancer_targets
-  port        = lookup(each.value, "port", 80)
-  protocol    = lookup(each.value, "protocol", "HTTP")
+  port        = each.value.port
+  protocol    = each.value.protocol
   target_type = "ip"
   vpc_id      = local.vpc_id
 }
@@ -175,8 +178,8 @@ resource "aws_lb_listener_rule" "rewrite" {
     type = "redirect"
     redirect {
       host        = lookup(each.value, "host", var.fqdn)
-      path        = lookup(each.value, "path", "")
-      query       = lookup(each.value, "query", "")
+      path        = lookup(each.value, "path", "/#{path}")
+      query       = lookup(each.value, "query", "#{query}")
       status_code = "HTTP_301"
     }
   }
@@ -197,8 +200,8 @@ resource "aws_security_group" "service" {
     for_each = var.load_balancer_targets
     content {
       description     = "Allow service traffic"
-      from_port       = lookup(ingress.value, "port", 80)
-      to_port         = lookup(ingress.value, "port", 80)
+      from_port       = ingress.value.port
+      to_port         = ingress.value.port
       protocol        = "tcp"
       security_groups = data.aws_lb.this.security_groups
     }
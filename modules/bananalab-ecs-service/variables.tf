@@ -70,9 +70,19 @@ variable "memory" {
 }
 
 variable "volumes" {
-  type        = map(any)
-  description = <<-EOT
-    List of volume configurations.
+  type = map(object({
+    docker_volume_configuration = optional(object({
+      scope         = optional(string)
+      autoprovision = optional(bool)
+      driver        = optional(string)
+      driver_opts   = optional(map(string))
+      labels        = optional(map(string))
+    }))
+  }))
+  description = <<-EOT
+    Task volumes keyed by the name container mountPoints use as
+    sourceVolume. A volume without docker_volume_configuration is a bind
+    mount, the only kind Fargate supports.
   EOT
   default     = {}
 }
@@ -95,7 +105,10 @@ variable "task_tags" {
 }
 
 variable "placement_constraints" {
-  type        = map(any)
+  type = map(object({
+    type       = string
+    expression = optional(string)
+  }))
   description = <<-EOT
     Configuration block for rules that are taken into consideration during task
     placement. Maximum number of `placement_constraints` is 10.
@@ -118,11 +131,16 @@ variable "load_balancer_arn" {
 }
 
 variable "load_balancer_targets" {
-  type        = map(any)
+  type = map(object({
+    port     = optional(number, 80)
+    protocol = optional(string, "HTTP")
+  }))
   description = <<-EOT
-    Load balancer target configs.
+    Load balancer target configs keyed by container name. port is the
+    container port to register, which must be in the container's
+    portMappings.
   EOT
-  default     = null
+  default     = {}
 }
 
 variable "fqdn" {
@@ -133,12 +151,19 @@ variable "fqdn" {
 }
 
 variable "url_rewrites" {
-  type        = map(any)
+  type        = map(map(string))
   description = <<-EOT
-    A mapping of fqdns and rewrite rules.
+    A mapping of fqdns to redirect rules. Requests for each fqdn are
+    redirected (HTTP 301) to the given host, path and query, which default
+    to fqdn, "/#{path}" and "#{query}" and may reuse the #{host}, #{path}
+    and #{query} of the original request.
     e.x.:
       {
-        foo.dev-empire.com = "https://www.empi.re/listen/index.php?id=$1"
+        "foo.dev-empire.com" = {
+          host  = "www.empi.re"
+          path  = "/listen/index.php"
+          query = "id=#{path}"
+        }
       }
   EOT
   default     = {}
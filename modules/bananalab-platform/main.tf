@@ -12,17 +12,28 @@ locals {
   %{endfor~}
   EOT
 
+  # The boot script is written out and run as a file so its shebang picks
+  # the interpreter; a runcmd string would run under /bin/sh as is.
+  boot_script_path = "/usr/local/sbin/boot_script.sh"
+
   user_data_yaml = yamlencode(
     {
-      write_files = [
-        {
-          path    = "/etc/ecs/ecs.config"
-          content = local.ecs_agent_config
-        }
-      ],
-      runcmd = [
-        var.boot_script
-      ]
+      write_files = concat(
+        [
+          {
+            path    = "/etc/ecs/ecs.config"
+            content = local.ecs_agent_config
+          }
+        ],
+        var.boot_script == null ? [] : [
+          {
+            path        = local.boot_script_path
+            permissions = "0755"
+            content     = var.boot_script
+          }
+        ]
+      ),
+      runcmd = var.boot_script == null ? [] : [local.boot_script_path]
     }
   )
   user_data = "#cloud-config\n${local.user_data_yaml}"
@@ -48,8 +48,9 @@ variable "ecs_agent_config" {
 variable "boot_script" {
   type        = string
   description = <<-EOT
-    Content of shell script to execute at EC2 boot.
-    Do not include plain text secrets.
+    Content of shell script to execute at first EC2 boot. It is written to
+    /usr/local/sbin/boot_script.sh and run from there, so start it with a
+    shebang. Do not include plain text secrets.
   EOT
   default     = null
 }
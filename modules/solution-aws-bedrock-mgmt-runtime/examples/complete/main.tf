@@ -1,5 +1,5 @@
 terraform {
-  required_version = ">= 1.0"
+  required_version = ">= 1.6"
   required_providers {
     aws = {
       source  = "hashicorp/aws"
@@ -60,7 +60,7 @@ module "bedrock_solution" {
     }
     prompt_attack = {
       input_strength  = "HIGH"
-      output_strength = "HIGH"
+      output_strength = "NONE"
     }
   }
 
@@ -22,7 +22,7 @@
  */
 
 terraform {
-  required_version = ">= 1.0"
+  required_version = ">= 1.6"
   required_providers {
     aws = {
       source  = "hashicorp/aws"
@@ -124,6 +124,22 @@ data "aws_iam_policy_document" "bedrock_kms_policy" {
     ]
     resources = ["*"]
   }
+
+  # CloudWatch alarms publish to the alert topics, which are encrypted with
+  # this key when enable_sns_encryption is set
+  statement {
+    sid    = "Allow CloudWatch Alarms"
+    effect = "Allow"
+    principals {
+      type        = "Service"
+      identifiers = ["cloudwatch.amazonaws.com"]
+    }
+    actions = [
+      "kms:Decrypt",
+      "kms:GenerateDataKey*"
+    ]
+    resources = ["*"]
+  }
 }
 
 # S3 Bucket for Bedrock logs with comprehensive security
@@ -527,9 +543,9 @@ module "bedrock_guardrail" {
   # Sensitive information filters (Trend Micro recommendation)
   sensitive_information_policy_config = {
     pii_entities_config = [
-      {
+      for entity_type in var.pii_entity_types : {
         action = var.pii_entities_action
-        type   = "ALL"
+        type   = entity_type
       }
     ]
   }
@@ -574,7 +590,7 @@ module "bedrock_model_invocation_logging" {
   }
 }
 
-# Additional security: S3 bucket policy for secure transport
+# S3 bucket policy: secure transport, encryption and Bedrock log delivery
 resource "aws_s3_bucket_policy" "bedrock_logs_security" {
   bucket = module.bedrock_logs_bucket.id
 
@@ -597,13 +613,31 @@ resource "aws_s3_bucket_policy" "bedrock_logs_security" {
         }
       },
       {
+        Sid       = "AllowBedrockLogDelivery"
+        Effect    = "Allow"
+        Principal = { Service = "bedrock.amazonaws.com" }
+        Action    = "s3:PutObject"
+        Resource  = "${module.bedrock_logs_bucket.arn}/${var.s3_log_prefix}*"
+        Condition = {
+          StringEquals = {
+            "aws:SourceAccount" = local.account_id
+          }
+          ArnLike = {
+            "aws:SourceArn" = "arn:${local.partition}:bedrock:${local.region}:${local.account_id}:*"
+          }
+        }
+      },
+      {
+        # Bedrock relies on the bucket's default encryption and sends no
+        # encryption header, so only uploads that ask for a different
+        # algorithm are denied.
         Sid       = "DenyUnEncryptedObjectUploads"
         Effect    = "Deny"
         Principal = "*"
         Action    = "s3:PutObject"
         Resource  = "${module.bedrock_logs_bucket.arn}/*"
         Condition = {
-          StringNotEquals = {
+          StringNotEqualsIfExists = {
             "s3:x-amz-server-side-encryption" = "aws:kms"
           }
         }
@@ -726,6 +760,7 @@ module "bedrock_server_errors_alarm" {
   threshold           = var.server_error_threshold
 
   alarm_actions = [module.bedrock_critical_alerts[0].arn]
+  ok_actions    = var.enable_ok_actions ? [module.bedrock_critical_alerts[0].arn] : []
 
   tags = merge(local.common_tags, {
     Name       = "alarm-bedrock-server-errors-${local.resource_prefix}"
@@ -750,6 +785,7 @@ module "bedrock_throttle_alarm" {
   threshold           = var.throttle_threshold
 
   alarm_actions = [module.bedrock_performance_alerts[0].arn]
+  ok_actions    = var.enable_ok_actions ? [module.bedrock_performance_alerts[0].arn] : []
 
   tags = merge(local.common_tags, {
     Name       = "alarm-bedrock-throttles-${local.resource_prefix}"
@@ -777,6 +813,7 @@ module "bedrock_latency_alarm" {
   treat_missing_data  = "notBreaching"
 
   alarm_actions = [module.bedrock_performance_alerts[0].arn]
+  ok_actions    = var.enable_ok_actions ? [module.bedrock_performance_alerts[0].arn] : []
 
   tags = merge(local.common_tags, {
     Name       = "alarm-bedrock-latency-${local.resource_prefix}"
@@ -802,6 +839,7 @@ module "bedrock_invocation_anomaly_alarm" {
   anomaly_threshold  = var.anomaly_threshold
 
   alarm_actions = [module.bedrock_performance_alerts[0].arn]
+  ok_actions    = var.enable_ok_actions ? [module.bedrock_performance_alerts[0].arn] : []
 
   tags = merge(local.common_tags, {
     Name       = "alarm-bedrock-anomaly-${local.resource_prefix}"
@@ -826,6 +864,7 @@ module "bedrock_cloudwatch_delivery_failure_alarm" {
   threshold           = var.logging_failure_threshold
 
   alarm_actions = [module.bedrock_critical_alerts[0].arn]
+  ok_actions    = var.enable_ok_actions ? [module.bedrock_critical_alerts[0].arn] : []
 
   tags = merge(local.common_tags, {
     Name       = "alarm-bedrock-cw-delivery-${local.resource_prefix}"
@@ -849,6 +888,7 @@ module "bedrock_s3_delivery_failure_alarm" {
   threshold           = var.logging_failure_threshold
 
   alarm_actions = [module.bedrock_critical_alerts[0].arn]
+  ok_actions    = var.enable_ok_actions ? [module.bedrock_critical_alerts[0].arn] : []
 
   tags = merge(local.common_tags, {
     Name       = "alarm-bedrock-s3-delivery-${local.resource_prefix}"
@@ -873,6 +913,7 @@ module "bedrock_input_token_anomaly_alarm" {
   anomaly_threshold  = var.token_anomaly_threshold
 
   alarm_actions = [module.bedrock_cost_alerts[0].arn]
+  ok_actions    = var.enable_ok_actions ? [module.bedrock_cost_alerts[0].arn] : []
 
   tags = merge(local.common_tags, {
     Name       = "alarm-bedrock-input-tokens-${local.resource_prefix}"
@@ -896,6 +937,7 @@ module "bedrock_output_token_anomaly_alarm" {
   anomaly_threshold  = var.token_anomaly_threshold
 
   alarm_actions = [module.bedrock_cost_alerts[0].arn]
+  ok_actions    = var.enable_ok_actions ? [module.bedrock_cost_alerts[0].arn] : []
 
   tags = merge(local.common_tags, {
     Name       = "alarm-bedrock-output-tokens-${local.resource_prefix}"
@@ -921,6 +963,7 @@ module "bedrock_health_composite_alarm" {
   ]))
 
   alarm_actions = [module.bedrock_critical_alerts[0].arn]
+  ok_actions    = var.enable_ok_actions ? [module.bedrock_critical_alerts[0].arn] : []
 
   # Suppress actions during maintenance windows if configured
   actions_suppressor = var.maintenance_window_alarm_arn != null ? {
@@ -983,6 +1026,7 @@ module "bedrock_agents_server_errors_alarm" {
   threshold           = var.agents_error_threshold
 
   alarm_actions = [module.bedrock_critical_alerts[0].arn]
+  ok_actions    = var.enable_ok_actions ? [module.bedrock_critical_alerts[0].arn] : []
 
   tags = merge(local.common_tags, {
     Name       = "alarm-bedrock-agents-server-errors-${local.resource_prefix}"
@@ -1011,6 +1055,7 @@ module "bedrock_agents_latency_alarm" {
   treat_missing_data  = "notBreaching"
 
   alarm_actions = [module.bedrock_performance_alerts[0].arn]
+  ok_actions    = var.enable_ok_actions ? [module.bedrock_performance_alerts[0].arn] : []
 
   tags = merge(local.common_tags, {
     Name       = "alarm-bedrock-agents-latency-${local.resource_prefix}"
@@ -1037,6 +1082,7 @@ module "bedrock_agents_throttle_alarm" {
   threshold           = var.agents_throttle_threshold
 
   alarm_actions = [module.bedrock_performance_alerts[0].arn]
+  ok_actions    = var.enable_ok_actions ? [module.bedrock_performance_alerts[0].arn] : []
 
   tags = merge(local.common_tags, {
     Name       = "alarm-bedrock-agents-throttles-${local.resource_prefix}"
@@ -1063,6 +1109,7 @@ module "bedrock_kb_client_errors_alarm" {
   treat_missing_data  = "notBreaching"
 
   alarm_actions = [module.bedrock_critical_alerts[0].arn]
+  ok_actions    = var.enable_ok_actions ? [module.bedrock_critical_alerts[0].arn] : []
 
   tags = merge(local.common_tags, {
     Name       = "alarm-bedrock-kb-errors-${local.resource_prefix}"
@@ -1087,6 +1134,7 @@ module "bedrock_kb_server_errors_alarm" {
   threshold           = var.kb_error_threshold
 
   alarm_actions = [module.bedrock_critical_alerts[0].arn]
+  ok_actions    = var.enable_ok_actions ? [module.bedrock_critical_alerts[0].arn] : []
 
   tags = merge(local.common_tags, {
     Name       = "alarm-bedrock-kb-server-errors-${local.resource_prefix}"
@@ -1115,6 +1163,7 @@ module "bedrock_kb_latency_alarm" {
   treat_missing_data  = "notBreaching"
 
   alarm_actions = [module.bedrock_performance_alerts[0].arn]
+  ok_actions    = var.enable_ok_actions ? [module.bedrock_performance_alerts[0].arn] : []
 
   tags = merge(local.common_tags, {
     Name       = "alarm-bedrock-kb-latency-${local.resource_prefix}"
@@ -1141,6 +1190,7 @@ module "bedrock_kb_throttle_alarm" {
   threshold           = var.kb_throttle_threshold
 
   alarm_actions = [module.bedrock_performance_alerts[0].arn]
+  ok_actions    = var.enable_ok_actions ? [module.bedrock_performance_alerts[0].arn] : []
 
   tags = merge(local.common_tags, {
     Name       = "alarm-bedrock-kb-throttles-${local.resource_prefix}"
@@ -1167,6 +1217,7 @@ module "bedrock_guardrails_blocked_input_alarm" {
   treat_missing_data  = "notBreaching"
 
   alarm_actions = [module.bedrock_performance_alerts[0].arn]
+  ok_actions    = var.enable_ok_actions ? [module.bedrock_performance_alerts[0].arn] : []
 
   tags = merge(local.common_tags, {
     Name       = "alarm-bedrock-guardrails-blocked-${local.resource_prefix}"
@@ -1192,6 +1243,7 @@ module "bedrock_guardrails_blocked_output_alarm" {
   treat_missing_data  = "notBreaching"
 
   alarm_actions = [module.bedrock_performance_alerts[0].arn]
+  ok_actions    = var.enable_ok_actions ? [module.bedrock_performance_alerts[0].arn] : []
 
   tags = merge(local.common_tags, {
     Name       = "alarm-bedrock-guardrails-blocked-output-${local.resource_prefix}"
@@ -1217,6 +1269,7 @@ module "bedrock_api_call_anomaly_alarm" {
   anomaly_threshold  = var.anomaly_threshold
 
   alarm_actions = [module.bedrock_performance_alerts[0].arn]
+  ok_actions    = var.enable_ok_actions ? [module.bedrock_performance_alerts[0].arn] : []
 
   tags = merge(local.common_tags, {
     Name       = "alarm-bedrock-api-anomaly-${local.resource_prefix}"
@@ -1242,6 +1295,7 @@ module "bedrock_training_job_failures_alarm" {
   treat_missing_data  = "notBreaching"
 
   alarm_actions = [module.bedrock_critical_alerts[0].arn]
+  ok_actions    = var.enable_ok_actions ? [module.bedrock_critical_alerts[0].arn] : []
 
   tags = merge(local.common_tags, {
     Name       = "alarm-bedrock-training-failures-${local.resource_prefix}"
@@ -1278,6 +1332,7 @@ module "bedrock_comprehensive_health_composite_alarm" {
   ]))
 
   alarm_actions = [module.bedrock_critical_alerts[0].arn]
+  ok_actions    = var.enable_ok_actions ? [module.bedrock_critical_alerts[0].arn] : []
 
   # Suppress actions during maintenance windows if configured
   actions_suppressor = var.maintenance_window_alarm_arn != null ? {
@@ -146,6 +146,22 @@ variable "pii_entities_action" {
   }
 }
 
+variable "pii_entity_types" {
+  description = "PII entity types the guardrail applies pii_entities_action to"
+  type        = list(string)
+  default = [
+    "ADDRESS",
+    "AWS_ACCESS_KEY",
+    "AWS_SECRET_KEY",
+    "CREDIT_DEBIT_CARD_NUMBER",
+    "EMAIL",
+    "NAME",
+    "PASSWORD",
+    "PHONE",
+    "US_SOCIAL_SECURITY_NUMBER"
+  ]
+}
+
 variable "content_filters" {
   description = "Content filter configurations for guardrails"
   type = map(object({
@@ -173,9 +189,10 @@ variable "content_filters" {
       input_strength  = "HIGH"
       output_strength = "HIGH"
     }
+    # Prompt attack filters only inspect prompts; Bedrock requires NONE here
     prompt_attack = {
       input_strength  = "HIGH"
-      output_strength = "HIGH"
+      output_strength = "NONE"
     }
   }
 }
@@ -879,13 +896,13 @@ variable "budget_anomaly_threshold" {
 }
 
 variable "budget_anomaly_frequency" {
-  description = "Frequency for budget anomaly notifications (DAILY, IMMEDIATE, WEEKLY)"
+  description = "Frequency for budget anomaly emails (DAILY or WEEKLY); the cost alert topic is always alerted immediately"
   type        = string
   default     = "DAILY"
   
   validation {
-    condition     = contains(["DAILY", "IMMEDIATE", "WEEKLY"], var.budget_anomaly_frequency)
-    error_message = "Budget anomaly frequency must be DAILY, IMMEDIATE, or WEEKLY."
+    condition     = contains(["DAILY", "WEEKLY"], var.budget_anomaly_frequency)
+    error_message = "Budget anomaly frequency must be DAILY or WEEKLY."
   }
 }
 
@@ -0,0 +1,308 @@
+// Package affected maps the files a branch changes to the modules CI must
+// test. A changed module is tested together with every module that
+// composes it through a relative source, so a change to aws-vpc also
+// tests aws-tgw and bananalab-platform. Changes to the kit select the
+// modules whose tests import the changed package, and changes to the
+// module template select the modules that still carry the changed file
+// as tfmod new renders it.
+package affected
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/modgraph"
+	"github.com/JQUINONES82/terraform_modules/testkit/scaffold"
+	"github.com/JQUINONES82/terraform_modules/testkit/testrun"
+)
+
+// Layout of the repository.
+const (
+	ModulesDir = "modules"
+	TestkitDir = "testkit"
+	// TemplateDir is the module template tfmod new renders.
+	TemplateDir = TestkitDir + "/scaffold/" + scaffold.TemplateDir
+	// TestkitModule is the import path of the kit.
+	TestkitModule = "github.com/JQUINONES82/terraform_modules/testkit"
+)
+
+// Global lists files whose change affects every module, such as the
+// workflow that runs the tests.
+var Global = []string{".github/workflows/terratest.yaml"}
+
+// Target is a directory for CI to test: a module, or the kit itself.
+type Target struct {
+	Module string `json:"module"`
+	// Path is the directory of the module, relative to the repository.
+	Path string `json:"path"`
+	// Test is the module's test suite, as testrun.Discover finds it, or
+	// empty when it has none.
+	Test string `json:"test"`
+	// Reasons say why the target is affected, as "changed",
+	// "depends on aws-vpc", "testkit package guardrail" or "template
+	// Makefile".
+	Reasons []string `json:"reasons"`
+}
+
+// Result is the outcome of Affected.
+type Result struct {
+	Targets []Target
+	// Ignored are the changed files that affect no target.
+	Ignored []string
+}
+
+// Modules returns the names of the affected modules.
+func (r *Result) Modules() []string {
+	var out []string
+	for _, t := range r.Targets {
+		out = append(out, t.Module)
+	}
+
+	return out
+}
+
+// Matrix renders the targets as a GitHub Actions matrix, whose include
+// entries a job fans out over.
+func (r *Result) Matrix() ([]byte, error) {
+	include := r.Targets
+	if include == nil {
+		include = []Target{}
+	}
+
+	return json.Marshal(struct {
+		Include []Target `json:"include"`
+	}{include})
+}
+
+// Repo is what Affected needs to know about a checkout.
+type Repo struct {
+	Root  string
+	Graph *modgraph.Graph
+	// imports maps the kit's packages, as paths relative to the
+	// repository, and the modules' test directories to the kit packages
+	// they import.
+	imports map[string][]string
+	// suites are the modules' test suites by module, so that every
+	// target's Test is a suite tfmod test runs.
+	suites map[string]testrun.Suite
+}
+
+// Load reads the module graph and the kit imports of the checkout at root.
+func Load(root string) (*Repo, error) {
+	g, err := modgraph.Load(filepath.Join(root, ModulesDir))
+	if err != nil {
+		return nil, err
+	}
+	r := &Repo{Root: root, Graph: g, imports: map[string][]string{}, suites: map[string]testrun.Suite{}}
+	suites, err := testrun.Discover(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range suites {
+		r.suites[s.Module] = s
+	}
+	dirs, err := goDirs(filepath.Join(root, TestkitDir))
+	if err != nil {
+		return nil, err
+	}
+	tests := map[string]bool{}
+	for _, name := range g.Names() {
+		dir := filepath.Join(root, ModulesDir, name, "test")
+		dirs = append(dirs, dir)
+		tests[dir] = true
+	}
+	for _, dir := range dirs {
+		// A kit package's tests do not make it depend on what they import.
+		imports, err := kitImports(dir, tests[dir])
+		if err != nil {
+			return nil, err
+		}
+		rel, _ := filepath.Rel(root, dir)
+		r.imports[filepath.ToSlash(rel)] = imports
+	}
+
+	return r, nil
+}
+
+// ChangedFiles returns the files changed between the merge base of base
+// and HEAD and HEAD in the git checkout at root, as git diff --name-only
+// base...HEAD lists them.
+func ChangedFiles(root, base string) ([]string, error) {
+	cmd := exec.Command("git", "diff", "--name-only", "--no-renames", base+"...HEAD")
+	cmd.Dir = root
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff %s...HEAD: %v: %s", base, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.Fields(string(out)), nil
+}
+
+// Affected returns the targets the changed files select, sorted by
+// module, with the kit last.
+func (r *Repo) Affected(files []string) *Result {
+	reasons := map[string][]string{}
+	because := func(module, reason string) {
+		for _, have := range reasons[module] {
+			if have == reason {
+				return
+			}
+		}
+		reasons[module] = append(reasons[module], reason)
+	}
+	res := &Result{}
+	for _, file := range files {
+		file = filepath.ToSlash(file)
+		matched := false
+		switch first, rest, _ := strings.Cut(file, "/"); {
+		case isGlobal(file):
+			for _, name := range r.Graph.Names() {
+				because(name, "workflow "+file)
+			}
+			matched = true
+		case first == ModulesDir:
+			name, _, nested := strings.Cut(rest, "/")
+			if _, ok := r.Graph.Modules[name]; ok && nested {
+				because(name, "changed")
+				matched = true
+			}
+		case strings.HasPrefix(file, TemplateDir+"/"):
+			// The template is part of the kit, whose tests render it.
+			r.templateChange(strings.TrimPrefix(file, TemplateDir+"/"), because)
+			because(TestkitDir, "changed")
+			matched = true
+		case first == TestkitDir:
+			if r.kitChange(rest, because) {
+				because(TestkitDir, "changed")
+				matched = true
+			}
+		}
+		if !matched {
+			res.Ignored = append(res.Ignored, file)
+		}
+	}
+
+	// Modules that compose an affected module are affected too.
+	changed := make([]string, 0, len(reasons))
+	for name := range reasons {
+		changed = append(changed, name)
+	}
+	sort.Strings(changed)
+	for _, name := range changed {
+		if name == TestkitDir {
+			continue
+		}
+		for _, dependent := range r.Graph.AllDependents(name) {
+			because(dependent, "depends on "+name)
+		}
+	}
+
+	names := make([]string, 0, len(reasons))
+	for name := range reasons {
+		if name != TestkitDir {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := Target{Module: name, Path: path.Join(ModulesDir, name), Reasons: reasons[name]}
+		if s, ok := r.suites[name]; ok {
+			t.Test = s.Path
+		}
+		res.Targets = append(res.Targets, t)
+	}
+	if kit, ok := reasons[TestkitDir]; ok {
+		res.Targets = append(res.Targets, Target{Module: TestkitDir, Path: TestkitDir, Test: TestkitDir, Reasons: kit})
+	}
+
+	return res
+}
+
+func isGlobal(file string) bool {
+	for _, g := range Global {
+		if g == file {
+			return true
+		}
+	}
+
+	return false
+}
+
+// kitChange selects the modules a change to file, relative to the kit,
+// affects, and reports whether the kit itself changed. go.mod and go.sum
+// affect every module that imports the kit. A package's non-test Go files
+// affect the modules whose tests import it, directly or through other kit
+// packages; its tests and testdata affect only the kit.
+func (r *Repo) kitChange(file string, because func(module, reason string)) bool {
+	dir, base := path.Split(file)
+	dir = strings.TrimSuffix(dir, "/")
+	switch {
+	case dir == "" && (base == "go.mod" || base == "go.sum"):
+		for _, name := range r.Graph.Names() {
+			if len(r.imports[path.Join(ModulesDir, name, "test")]) > 0 {
+				because(name, "testkit "+base)
+			}
+		}
+		return true
+	case strings.HasSuffix(base, ".go"):
+		if !strings.HasSuffix(base, "_test.go") {
+			pkg := path.Join(TestkitDir, dir)
+			for _, name := range r.Graph.Names() {
+				if r.importsPackage(path.Join(ModulesDir, name, "test"), pkg, map[string]bool{}) {
+					because(name, "testkit package "+dir)
+				}
+			}
+		}
+		return true
+	}
+
+	// Test data belongs to a package's own tests.
+	return strings.Contains("/"+dir+"/", "/testdata/")
+}
+
+// importsPackage reports whether the Go files in dir import pkg, directly
+// or through other kit packages.
+func (r *Repo) importsPackage(dir, pkg string, seen map[string]bool) bool {
+	if seen[dir] {
+		return false
+	}
+	seen[dir] = true
+	for _, imported := range r.imports[dir] {
+		if imported == pkg || r.importsPackage(imported, pkg, seen) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// templateChange selects the modules that still carry a file rendered
+// from the template file, relative to the template, as tfmod new renders
+// it with the default options: they share the harness the template
+// defines.
+func (r *Repo) templateChange(file string, because func(module, reason string)) {
+	for _, name := range r.Graph.Names() {
+		files, err := scaffold.Render(scaffold.Defaults(name))
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			if f.Template != file {
+				continue
+			}
+			have, err := os.ReadFile(filepath.Join(r.Root, ModulesDir, name, filepath.FromSlash(f.Path)))
+			if err == nil && bytes.Equal(have, f.Data) {
+				because(name, "template "+f.Path)
+			}
+		}
+	}
+}
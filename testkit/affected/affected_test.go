@@ -0,0 +1,215 @@
+package affected
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/scaffold"
+)
+
+// repoRoot is the checkout the tests map changes against.
+const repoRoot = "../.."
+
+func load(t *testing.T) *Repo {
+	t.Helper()
+	r, err := Load(repoRoot)
+	require.NoError(t, err)
+
+	return r
+}
+
+func TestAffected(t *testing.T) {
+	r := load(t)
+	tests := []struct {
+		name    string
+		files   []string
+		want    map[string][]string
+		ignored []string
+	}{
+		{
+			name:  "module and its consumers",
+			files: []string{"modules/aws-vpc/main.tf"},
+			want: map[string][]string{
+				"aws-vpc":            {"changed"},
+				"aws-tgw":            {"depends on aws-vpc"},
+				"bananalab-platform": {"depends on aws-vpc"},
+			},
+		},
+		{
+			name:  "module nobody composes",
+			files: []string{"modules/bananalab-platform/variables.tf", "modules/bananalab-platform/README.md"},
+			want:  map[string][]string{"bananalab-platform": {"changed"}},
+		},
+		{
+			name:  "kit package",
+			files: []string{"testkit/loggingcheck/check.go"},
+			want: map[string][]string{
+				"aws-bedrock-model-invocation-logging": {"testkit package loggingcheck"},
+				"solution-aws-bedrock-mgmt-runtime":    {"depends on aws-bedrock-model-invocation-logging"},
+				"testkit":                              {"changed"},
+			},
+		},
+		{
+			name:  "kit package imported through another package",
+			files: []string{"testkit/iampolicy/policy.go"},
+			want: map[string][]string{
+				"aws-bedrock-inference-profile":        {"testkit package iampolicy"},
+				"aws-bedrock-model-invocation-logging": {"testkit package iampolicy"},
+				"aws-kms-key":                          {"testkit package iampolicy"},
+				"solution-aws-bedrock-mgmt-runtime":    {"depends on aws-bedrock-model-invocation-logging", "depends on aws-kms-key"},
+				"testkit":                              {"changed"},
+			},
+		},
+		{
+			name:    "kit tests and docs",
+			files:   []string{"testkit/cwagent/cwagent_test.go", "testkit/cwagent/testdata/plan.json", "testkit/README.md"},
+			want:    map[string][]string{"testkit": {"changed"}},
+			ignored: []string{"testkit/README.md"},
+		},
+		{
+			// No module carries the harness the template renders today.
+			name:  "template harness",
+			files: []string{"testkit/scaffold/template/test/integration_test.go.tmpl"},
+			want:  map[string][]string{"testkit": {"changed"}},
+		},
+		{
+			// The gomplate template is gone.
+			name:    "files outside any module",
+			files:   []string{"modules/ALERTING_MODULES_SUMMARY.md", "README.md", ".template/main.tf"},
+			ignored: []string{"modules/ALERTING_MODULES_SUMMARY.md", "README.md", ".template/main.tf"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := r.Affected(tt.files)
+			got := map[string][]string{}
+			for _, target := range res.Targets {
+				got[target.Module] = target.Reasons
+			}
+			if tt.want == nil {
+				tt.want = map[string][]string{}
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.ignored, res.Ignored)
+		})
+	}
+}
+
+func TestTemplateAffectsGeneratedModules(t *testing.T) {
+	root := t.TempDir()
+	modules := filepath.Join(root, ModulesDir)
+	require.NoError(t, os.MkdirAll(filepath.Join(root, TestkitDir), 0o755))
+	for _, name := range []string{"aws-gadget", "aws-widget"} {
+		_, _, err := scaffold.Generate(modules, scaffold.Defaults(name))
+		require.NoError(t, err)
+	}
+	// aws-gadget has since changed its live test.
+	require.NoError(t, os.WriteFile(filepath.Join(modules, "aws-gadget", "test", "integration_test.go"), []byte("package test\n"), 0o644))
+	r, err := Load(root)
+	require.NoError(t, err)
+
+	got := map[string][]string{}
+	for _, target := range r.Affected([]string{TemplateDir + "/test/integration_test.go.tmpl", TemplateDir + "/examples/example/main.tf.tmpl"}).Targets {
+		got[target.Module] = target.Reasons
+	}
+	assert.Equal(t, map[string][]string{
+		"aws-gadget": {"template examples/simple/main.tf"},
+		"aws-widget": {"template test/integration_test.go", "template examples/simple/main.tf"},
+		"testkit":    {"changed"},
+	}, got)
+}
+
+// A target's test is a suite tfmod test can select: a test directory
+// without test files is not one.
+func TestTargetTestIsSuite(t *testing.T) {
+	root := t.TempDir()
+	modules := filepath.Join(root, ModulesDir)
+	require.NoError(t, os.MkdirAll(filepath.Join(root, TestkitDir), 0o755))
+	for _, name := range []string{"aws-gadget", "aws-widget"} {
+		_, _, err := scaffold.Generate(modules, scaffold.Defaults(name))
+		require.NoError(t, err)
+	}
+	tests, err := filepath.Glob(filepath.Join(modules, "aws-widget", "test", "*_test.go"))
+	require.NoError(t, err)
+	for _, f := range tests {
+		require.NoError(t, os.Remove(f))
+	}
+	r, err := Load(root)
+	require.NoError(t, err)
+
+	got := map[string]string{}
+	for _, target := range r.Affected([]string{"modules/aws-gadget/main.tf", "modules/aws-widget/main.tf"}).Targets {
+		got[target.Module] = target.Test
+	}
+	assert.Equal(t, map[string]string{"aws-gadget": "modules/aws-gadget/test", "aws-widget": ""}, got)
+}
+
+func TestWorkflowAffectsEverything(t *testing.T) {
+	r := load(t)
+	res := r.Affected([]string{".github/workflows/terratest.yaml"})
+	assert.Equal(t, r.Graph.Names(), res.Modules())
+}
+
+func TestMatrix(t *testing.T) {
+	res := load(t).Affected([]string{"modules/aws-tgw/main.tf", "modules/aws-sns-topic/main.tf", "testkit/plan/plan_test.go"})
+	matrix, err := res.Matrix()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"include": [
+		{"module": "aws-sns-topic", "path": "modules/aws-sns-topic", "test": "", "reasons": ["changed"]},
+		{"module": "aws-tgw", "path": "modules/aws-tgw", "test": "modules/aws-tgw/test", "reasons": ["changed"]},
+		{"module": "solution-aws-bedrock-mgmt-runtime", "path": "modules/solution-aws-bedrock-mgmt-runtime", "test": "", "reasons": ["depends on aws-sns-topic"]},
+		{"module": "testkit", "path": "testkit", "test": "testkit", "reasons": ["changed"]}
+	]}`, string(matrix))
+
+	matrix, err = (&Result{}).Matrix()
+	require.NoError(t, err)
+	assert.Equal(t, `{"include":[]}`, string(matrix))
+}
+
+func TestChangedFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	write := func(name string) {
+		t.Helper()
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(name), 0o644))
+	}
+
+	git("init", "-q", "-b", "main")
+	write("modules/aws-vpc/main.tf")
+	git("add", "-A")
+	git("commit", "-q", "-m", "base")
+	git("checkout", "-q", "-b", "feature")
+	write("modules/aws-vpc/variables.tf")
+	write("testkit/plan/plan.go")
+	git("add", "-A")
+	git("commit", "-q", "-m", "change")
+	// A later commit on main is not part of the branch's change.
+	git("checkout", "-q", "main")
+	write("modules/aws-tgw/main.tf")
+	git("add", "-A")
+	git("commit", "-q", "-m", "main moves on")
+	git("checkout", "-q", "feature")
+
+	files, err := ChangedFiles(dir, "main")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"modules/aws-vpc/variables.tf", "testkit/plan/plan.go"}, files)
+
+	_, err = ChangedFiles(dir, "nope")
+	assert.ErrorContains(t, err, "git diff nope...HEAD")
+}
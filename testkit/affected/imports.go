@@ -0,0 +1,75 @@
+package affected
+
+import (
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// goDirs returns the directories under root that hold Go files, leaving
+// out testdata.
+func goDirs(root string) ([]string, error) {
+	var out []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == "testdata" || p != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(p, ".go") && (len(out) == 0 || out[len(out)-1] != filepath.Dir(p)) {
+			out = append(out, filepath.Dir(p))
+		}
+		return nil
+	})
+
+	return out, err
+}
+
+// kitImports returns the kit packages the Go files in dir import, as
+// paths relative to the repository such as testkit/guardrail. Test files
+// count only when tests is set. A missing dir imports nothing.
+func kitImports(dir string, tests bool) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var out []string
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if !tests && strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, parser.ImportsOnly)
+		if err != nil {
+			return nil, err
+		}
+		for _, spec := range f.Imports {
+			imported, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			rest, ok := strings.CutPrefix(imported, TestkitModule)
+			if !ok || rest != "" && !strings.HasPrefix(rest, "/") {
+				continue
+			}
+			pkg := path.Join(TestkitDir, rest)
+			if !seen[pkg] {
+				seen[pkg] = true
+				out = append(out, pkg)
+			}
+		}
+	}
+	sort.Strings(out)
+
+	return out, nil
+}
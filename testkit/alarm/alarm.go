@@ -0,0 +1,189 @@
+// Package alarm reimplements how CloudWatch evaluates a metric alarm, so the
+// thresholds a module plans can be exercised against synthetic metric
+// series without waiting for real traffic. Simulate turns an Alarm read
+// from a plan and a Series into the state transitions CloudWatch would
+// make.
+package alarm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+// ResourceType is the Terraform resource type of metric alarms.
+const ResourceType = "aws_cloudwatch_metric_alarm"
+
+// Comparison operators for static thresholds.
+const (
+	GreaterThanOrEqualToThreshold = "GreaterThanOrEqualToThreshold"
+	GreaterThanThreshold          = "GreaterThanThreshold"
+	LessThanThreshold             = "LessThanThreshold"
+	LessThanOrEqualToThreshold    = "LessThanOrEqualToThreshold"
+)
+
+// Values of treat_missing_data.
+const (
+	MissingMissing      = "missing"
+	MissingIgnore       = "ignore"
+	MissingBreaching    = "breaching"
+	MissingNotBreaching = "notBreaching"
+)
+
+// Alarm holds the attributes of a metric alarm that drive its evaluation.
+type Alarm struct {
+	Address            string
+	Name               string
+	Namespace          string
+	MetricName         string
+	Period             int
+	EvaluationPeriods  int
+	DatapointsToAlarm  int
+	Statistic          string
+	ExtendedStatistic  string
+	Threshold          float64
+	ComparisonOperator string
+	TreatMissingData   string
+	// EvaluateLowSampleCountPercentiles is "evaluate" or "ignore"; it only
+	// applies to percentile statistics.
+	EvaluateLowSampleCountPercentiles string
+	// MetricQueries is set for alarms on metric math, which Simulate does
+	// not evaluate.
+	MetricQueries bool
+	AlarmActions  []string
+	OKActions     []string
+}
+
+// FromPlan returns every metric alarm planned in p.
+func FromPlan(p *tfjson.Plan) []Alarm {
+	var out []Alarm
+	for _, r := range plan.ResourcesOfType(p, ResourceType) {
+		a := FromValues(r.Values)
+		a.Address = r.Address
+		out = append(out, a)
+	}
+
+	return out
+}
+
+// FromValues decodes the attribute values of a metric alarm. Defaults
+// match CloudWatch: datapoints_to_alarm defaults to evaluation_periods and
+// treat_missing_data to missing.
+func FromValues(v map[string]interface{}) Alarm {
+	r := plan.Resource{Values: v}
+	a := Alarm{
+		Name:                              r.String("alarm_name"),
+		Namespace:                         r.String("namespace"),
+		MetricName:                        r.String("metric_name"),
+		Period:                            int(r.Number("period")),
+		EvaluationPeriods:                 int(r.Number("evaluation_periods")),
+		DatapointsToAlarm:                 int(r.Number("datapoints_to_alarm")),
+		Statistic:                         r.String("statistic"),
+		ExtendedStatistic:                 r.String("extended_statistic"),
+		Threshold:                         r.Number("threshold"),
+		ComparisonOperator:                r.String("comparison_operator"),
+		TreatMissingData:                  r.String("treat_missing_data"),
+		EvaluateLowSampleCountPercentiles: r.String("evaluate_low_sample_count_percentiles"),
+		MetricQueries:                     len(r.Blocks("metric_query")) > 0,
+		AlarmActions:                      r.Strings("alarm_actions"),
+		OKActions:                         r.Strings("ok_actions"),
+	}
+	if a.DatapointsToAlarm == 0 {
+		a.DatapointsToAlarm = a.EvaluationPeriods
+	}
+	if a.TreatMissingData == "" {
+		a.TreatMissingData = MissingMissing
+	}
+
+	return a
+}
+
+// Find returns the alarm whose name or address is name.
+func Find(alarms []Alarm, name string) (Alarm, error) {
+	for _, a := range alarms {
+		if a.Name == name || a.Address == name {
+			return a, nil
+		}
+	}
+
+	return Alarm{}, fmt.Errorf("no metric alarm %q in plan", name)
+}
+
+// Validate reports why the alarm cannot be simulated.
+func (a Alarm) Validate() error {
+	switch {
+	case a.MetricQueries:
+		return fmt.Errorf("alarm %s uses metric_query, which is not simulated", a.Name)
+	case a.Period <= 0:
+		return fmt.Errorf("alarm %s has no period", a.Name)
+	case a.EvaluationPeriods < 1:
+		return fmt.Errorf("alarm %s: evaluation_periods must be at least 1", a.Name)
+	case a.DatapointsToAlarm < 1 || a.DatapointsToAlarm > a.EvaluationPeriods:
+		return fmt.Errorf("alarm %s: datapoints_to_alarm %d must be between 1 and evaluation_periods %d", a.Name, a.DatapointsToAlarm, a.EvaluationPeriods)
+	}
+	switch a.ComparisonOperator {
+	case GreaterThanOrEqualToThreshold, GreaterThanThreshold, LessThanThreshold, LessThanOrEqualToThreshold:
+	default:
+		return fmt.Errorf("alarm %s: comparison operator %q is not simulated", a.Name, a.ComparisonOperator)
+	}
+	switch a.TreatMissingData {
+	case MissingMissing, MissingIgnore, MissingBreaching, MissingNotBreaching:
+	default:
+		return fmt.Errorf("alarm %s: treat_missing_data %q is not valid", a.Name, a.TreatMissingData)
+	}
+	if _, err := a.statistic(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Breaches reports whether value breaches the threshold.
+func (a Alarm) Breaches(value float64) bool {
+	switch a.ComparisonOperator {
+	case GreaterThanOrEqualToThreshold:
+		return value >= a.Threshold
+	case GreaterThanThreshold:
+		return value > a.Threshold
+	case LessThanThreshold:
+		return value < a.Threshold
+	default:
+		return value <= a.Threshold
+	}
+}
+
+// statistic returns the statistic the alarm aggregates samples with. A
+// percentile is returned as "p" followed by its value.
+func (a Alarm) statistic() (string, error) {
+	if a.ExtendedStatistic != "" {
+		if _, err := percentile(a.ExtendedStatistic); err != nil {
+			return "", fmt.Errorf("alarm %s: %w", a.Name, err)
+		}
+		return a.ExtendedStatistic, nil
+	}
+	switch a.Statistic {
+	case "SampleCount", "Average", "Sum", "Minimum", "Maximum":
+		return a.Statistic, nil
+	case "":
+		return "", fmt.Errorf("alarm %s has neither statistic nor extended_statistic", a.Name)
+	}
+
+	return "", fmt.Errorf("alarm %s: statistic %q is not valid", a.Name, a.Statistic)
+}
+
+// percentile parses an extended statistic such as p99 or p99.9.
+func percentile(stat string) (float64, error) {
+	if !strings.HasPrefix(stat, "p") {
+		return 0, fmt.Errorf("extended statistic %q is not a percentile", stat)
+	}
+	p, err := strconv.ParseFloat(stat[1:], 64)
+	if err != nil || p < 0 || p > 100 {
+		return 0, fmt.Errorf("extended statistic %q is not a percentile", stat)
+	}
+
+	return p, nil
+}
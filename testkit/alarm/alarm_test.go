@@ -0,0 +1,157 @@
+package alarm
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+var t0 = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func solutionAlarms(t *testing.T) []Alarm {
+	t.Helper()
+	p, err := plan.Load("testdata/plan.json")
+	require.NoError(t, err)
+
+	return FromPlan(p)
+}
+
+func TestFromPlan(t *testing.T) {
+	alarms := solutionAlarms(t)
+	require.Len(t, alarms, 2)
+
+	throttles, err := Find(alarms, "bedrock-throttles-test")
+	require.NoError(t, err)
+	assert.Equal(t, "module.bedrock_throttle_alarm[0].aws_cloudwatch_metric_alarm.this[0]", throttles.Address)
+	assert.Equal(t, 2, throttles.DatapointsToAlarm, "datapoints_to_alarm defaults to evaluation_periods")
+	assert.Equal(t, MissingMissing, throttles.TreatMissingData)
+	assert.NoError(t, throttles.Validate())
+
+	_, err = Find(alarms, "nope")
+	assert.Error(t, err)
+}
+
+// The solution's throttle alarm sums throttles over two 5-minute periods
+// and needs both above throttle_threshold.
+func TestThrottleSpikes(t *testing.T) {
+	throttles, err := Find(solutionAlarms(t), "bedrock-throttles-test")
+	require.NoError(t, err)
+
+	one := Every(t0, 5*time.Minute, 0, 0, 45, 0, 0)
+	res, err := Simulate(throttles, one, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.False(t, res.Reached(StateAlarm), res.String())
+	assert.Equal(t, StateOK, res.Final())
+
+	three := Every(t0, 5*time.Minute, 0, 0, 45, 45, 45, 0, 0)
+	res, err = Simulate(throttles, three, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.True(t, res.Reached(StateAlarm), res.String())
+	require.Len(t, res.Transitions, 3, res.String())
+	assert.Equal(t, t0.Add(20*time.Minute), res.Transitions[1].Time, "fires when the second spike period closes")
+	assert.Equal(t, StateOK, res.Final())
+}
+
+func TestSimulateCSVFixture(t *testing.T) {
+	throttles, err := Find(solutionAlarms(t), "bedrock-throttles-test")
+	require.NoError(t, err)
+	s, err := LoadSeries("testdata/throttles.csv")
+	require.NoError(t, err)
+
+	res, err := Simulate(throttles, s, time.Time{}, t0.Add(59*time.Minute))
+	require.NoError(t, err)
+
+	var got []string
+	for _, tr := range res.Transitions {
+		got = append(got, tr.Time.Format("15:04")+" "+string(tr.To))
+	}
+	assert.Equal(t, []string{"12:05 OK", "12:25 ALARM", "12:35 OK", "13:00 INSUFFICIENT_DATA"}, got, res.String())
+}
+
+func TestTreatMissingData(t *testing.T) {
+	nan := math.NaN()
+	a := Alarm{Name: "a", Period: 60, EvaluationPeriods: 3, DatapointsToAlarm: 2, Statistic: "Maximum",
+		Threshold: 10, ComparisonOperator: GreaterThanThreshold}
+
+	tests := []struct {
+		treat  string
+		values []float64
+		want   State
+	}{
+		{MissingMissing, []float64{20, 20, nan}, StateAlarm},
+		{MissingMissing, []float64{20, nan, nan}, StateInsufficientData},
+		{MissingMissing, []float64{20, 20, nan, nan, nan}, StateInsufficientData},
+		{MissingIgnore, []float64{20, 20, nan, nan, nan}, StateAlarm},
+		{MissingBreaching, []float64{0, 20, nan}, StateAlarm},
+		{MissingNotBreaching, []float64{20, 20, nan, nan}, StateOK},
+		{MissingMissing, []float64{0, 0, 0, 20, nan}, StateOK},
+	}
+	for _, tt := range tests {
+		a.TreatMissingData = tt.treat
+		end := t0.Add(time.Duration(len(tt.values)-1) * time.Minute)
+		res, err := Simulate(a, Every(t0, time.Minute, tt.values...), t0, end)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, res.Final(), "%s %v\n%s", tt.treat, tt.values, res)
+	}
+}
+
+func TestLowSampleCountPercentiles(t *testing.T) {
+	latency, err := Find(solutionAlarms(t), "bedrock-high-latency-test")
+	require.NoError(t, err)
+
+	// A handful of slow requests per period is far below the 1000 samples
+	// a p99 needs.
+	var s Series
+	for i := 0; i < 4; i++ {
+		start := t0.Add(time.Duration(i) * 5 * time.Minute)
+		s = append(s, Every(start, time.Second, 15000, 16000, 17000)...)
+	}
+
+	res, err := Simulate(latency, s, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, StateAlarm, res.Final(), "low sample counts are evaluated by default")
+
+	latency.EvaluateLowSampleCountPercentiles = "ignore"
+	res, err = Simulate(latency, s, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Empty(t, res.Transitions, res.String())
+	assert.True(t, strings.Contains(res.String(), "low sample count ignored"))
+}
+
+func TestAggregate(t *testing.T) {
+	values := []float64{1, 2, 3, 4, 100}
+	assert.Equal(t, 110.0, apply("Sum", values))
+	assert.Equal(t, 22.0, apply("Average", values))
+	assert.Equal(t, 1.0, apply("Minimum", values))
+	assert.Equal(t, 100.0, apply("Maximum", values))
+	assert.Equal(t, 5.0, apply("SampleCount", values))
+	assert.Equal(t, 3.0, apply("p50", values))
+	assert.Equal(t, 100.0, apply("p99", values))
+}
+
+func TestParseJSON(t *testing.T) {
+	s, err := ParseJSON(strings.NewReader(`[{"timestamp":"2024-05-01T12:05:00Z","value":2},{"timestamp":"2024-05-01T12:00:00Z","value":1}]`))
+	require.NoError(t, err)
+	require.Len(t, s, 2)
+	assert.Equal(t, t0, s[0].Time)
+}
+
+func TestValidate(t *testing.T) {
+	a := Alarm{Name: "a", Period: 60, EvaluationPeriods: 2, DatapointsToAlarm: 3, Statistic: "Sum",
+		ComparisonOperator: GreaterThanThreshold, TreatMissingData: MissingMissing}
+	assert.Error(t, a.Validate())
+
+	a.DatapointsToAlarm = 2
+	a.ComparisonOperator = "LessThanLowerOrGreaterThanUpperThreshold"
+	assert.Error(t, a.Validate())
+
+	a.ComparisonOperator = GreaterThanThreshold
+	a.MetricQueries = true
+	assert.Error(t, a.Validate())
+}
@@ -0,0 +1,217 @@
+package alarm
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sample is one raw metric value, as published with PutMetricData.
+type Sample struct {
+	Time  time.Time `json:"timestamp"`
+	Value float64   `json:"value"`
+}
+
+// Series is a metric's raw samples. Simulate aggregates them per period
+// with the alarm's statistic; a period without samples is missing data.
+type Series []Sample
+
+// Every returns one sample per step starting at start. NaN values leave the
+// step without a sample, so
+//
+//	Every(t0, 5*time.Minute, 0, 40, math.NaN(), 0)
+//
+// is a spike in the second period and missing data in the third.
+func Every(start time.Time, step time.Duration, values ...float64) Series {
+	var s Series
+	for i, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		s = append(s, Sample{Time: start.Add(time.Duration(i) * step), Value: v})
+	}
+
+	return s
+}
+
+// LoadSeries reads a series fixture. Files ending in .json hold a list of
+// {"timestamp", "value"} objects; anything else is read as CSV.
+func LoadSeries(path string) (Series, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return ParseJSON(f)
+	}
+
+	return ParseCSV(f)
+}
+
+// ParseJSON parses a JSON series fixture. Timestamps are RFC 3339.
+func ParseJSON(r io.Reader) (Series, error) {
+	var s Series
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, fmt.Errorf("parsing series: %w", err)
+	}
+	sort.SliceStable(s, func(i, j int) bool { return s[i].Time.Before(s[j].Time) })
+
+	return s, nil
+}
+
+// ParseCSV parses a CSV series fixture with timestamp and value columns:
+//
+//	timestamp,value
+//	2024-05-01T12:00:00Z,3
+//	2024-05-01T12:05:00Z,
+//
+// An optional header row is skipped. Timestamps are RFC 3339 or Unix
+// seconds; an empty value records no sample.
+func ParseCSV(r io.Reader) (Series, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+	cr.Comment = '#'
+	cr.TrimLeadingSpace = true
+
+	var s Series
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing series: %w", err)
+		}
+		if line == 1 && strings.EqualFold(rec[0], "timestamp") {
+			continue
+		}
+		ts, err := parseTime(rec[0])
+		if err != nil {
+			return nil, fmt.Errorf("parsing series line %d: %w", line, err)
+		}
+		if rec[1] == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(rec[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing series line %d: %w", line, err)
+		}
+		s = append(s, Sample{Time: ts, Value: v})
+	}
+	sort.SliceStable(s, func(i, j int) bool { return s[i].Time.Before(s[j].Time) })
+
+	return s, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC(), nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
+
+// datapoint is a series aggregated over one period.
+type datapoint struct {
+	value   float64
+	samples int
+}
+
+// aggregate groups the samples into periods aligned to the Unix epoch, as
+// CloudWatch does, and applies stat to each.
+func aggregate(s Series, period time.Duration, stat string) map[int64]datapoint {
+	groups := map[int64][]float64{}
+	for _, sm := range s {
+		start := sm.Time.Truncate(period).Unix()
+		groups[start] = append(groups[start], sm.Value)
+	}
+
+	out := make(map[int64]datapoint, len(groups))
+	for start, values := range groups {
+		out[start] = datapoint{value: apply(stat, values), samples: len(values)}
+	}
+
+	return out
+}
+
+// Datapoints aggregates s with stat over n periods, the first being the
+// one that holds from. Periods without samples are NaN. stat is one of
+// SampleCount, Average, Sum, Minimum, Maximum or a percentile such as p99.
+func Datapoints(s Series, from time.Time, period time.Duration, n int, stat string) ([]float64, error) {
+	switch stat {
+	case "SampleCount", "Average", "Sum", "Minimum", "Maximum":
+	default:
+		if _, err := percentile(stat); err != nil {
+			return nil, err
+		}
+	}
+
+	points := aggregate(s, period, stat)
+	out := make([]float64, n)
+	start := from.Truncate(period)
+	for i := range out {
+		out[i] = math.NaN()
+		if dp, ok := points[start.Add(time.Duration(i)*period).Unix()]; ok {
+			out[i] = dp.value
+		}
+	}
+
+	return out, nil
+}
+
+func apply(stat string, values []float64) float64 {
+	switch stat {
+	case "SampleCount":
+		return float64(len(values))
+	case "Sum", "Average":
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		if stat == "Average" {
+			return sum / float64(len(values))
+		}
+		return sum
+	case "Minimum", "Maximum":
+		m := values[0]
+		for _, v := range values[1:] {
+			if stat == "Minimum" && v < m || stat == "Maximum" && v > m {
+				m = v
+			}
+		}
+		return m
+	}
+
+	// Percentiles use the nearest-rank method.
+	p, _ := percentile(stat)
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
+
+// lowSampleCount reports whether a percentile was computed from too few
+// samples to be statistically significant. CloudWatch does not document
+// its cut-off; this uses 10/(1-p), so p99 needs 1000 samples and p90 100.
+func lowSampleCount(stat string, samples int) bool {
+	p, err := percentile(stat)
+	if err != nil || p >= 100 {
+		return false
+	}
+
+	return float64(samples) < 10/(1-p/100)
+}
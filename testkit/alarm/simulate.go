@@ -0,0 +1,188 @@
+package alarm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// State is an alarm state.
+type State string
+
+const (
+	StateOK               State = "OK"
+	StateAlarm            State = "ALARM"
+	StateInsufficientData State = "INSUFFICIENT_DATA"
+)
+
+// Step is one evaluation, made at the end of each period.
+type Step struct {
+	// Period is the start of the period just completed.
+	Period         time.Time
+	Value          float64
+	Missing        bool
+	LowSampleCount bool
+	Breaching      bool
+	State          State
+	Reason         string
+}
+
+// Transition is a change of state.
+type Transition struct {
+	Time   time.Time
+	From   State
+	To     State
+	Reason string
+}
+
+func (t Transition) String() string {
+	return fmt.Sprintf("%s %s -> %s: %s", t.Time.UTC().Format(time.RFC3339), t.From, t.To, t.Reason)
+}
+
+// Result is the outcome of a simulation.
+type Result struct {
+	Alarm       Alarm
+	Steps       []Step
+	Transitions []Transition
+}
+
+// Final returns the state after the last evaluation.
+func (r *Result) Final() State {
+	if len(r.Steps) == 0 {
+		return StateInsufficientData
+	}
+
+	return r.Steps[len(r.Steps)-1].State
+}
+
+// Reached reports whether the alarm entered state s at any point.
+func (r *Result) Reached(s State) bool {
+	for _, t := range r.Transitions {
+		if t.To == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// String formats the steps as a table.
+func (r *Result) String() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PERIOD\tVALUE\tBREACHING\tSTATE\tREASON")
+	for _, s := range r.Steps {
+		value := strconv.FormatFloat(s.Value, 'g', -1, 64)
+		if s.Missing {
+			value = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%s\n", s.Period.UTC().Format(time.RFC3339), value, s.Breaching, s.State, s.Reason)
+	}
+	w.Flush()
+
+	return b.String()
+}
+
+// Simulate evaluates a against s once per period, from the period holding
+// from to the one holding to. Zero times default to the first and last
+// samples. The alarm starts in INSUFFICIENT_DATA, as a new alarm does.
+//
+// Each evaluation looks at the last evaluation_periods datapoints and goes
+// to ALARM when datapoints_to_alarm of them breach. Missing datapoints
+// follow treat_missing_data: breaching and notBreaching substitute a
+// datapoint; missing and ignore leave it out, and when the remaining
+// datapoints cannot decide either way the state is kept. With no
+// datapoints at all, missing goes to INSUFFICIENT_DATA and ignore keeps
+// the state. A percentile computed from too few samples keeps the state
+// when evaluate_low_sample_count_percentiles is ignore.
+func Simulate(a Alarm, s Series, from, to time.Time) (*Result, error) {
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+	if len(s) == 0 && (from.IsZero() || to.IsZero()) {
+		return nil, fmt.Errorf("alarm %s: empty series needs an explicit time range", a.Name)
+	}
+	if from.IsZero() {
+		from = s[0].Time
+	}
+	if to.IsZero() {
+		to = s[len(s)-1].Time
+	}
+
+	period := time.Duration(a.Period) * time.Second
+	stat, _ := a.statistic()
+	points := aggregate(s, period, stat)
+	ignoreLow := a.ExtendedStatistic != "" && a.EvaluateLowSampleCountPercentiles == "ignore"
+
+	res := &Result{Alarm: a}
+	state := StateInsufficientData
+	var window []Step
+	for start := from.Truncate(period); !start.After(to); start = start.Add(period) {
+		step := Step{Period: start}
+		if dp, ok := points[start.Unix()]; ok {
+			step.Value = dp.value
+			step.Breaching = a.Breaches(dp.value)
+			step.LowSampleCount = a.ExtendedStatistic != "" && lowSampleCount(stat, dp.samples)
+		} else {
+			step.Missing = true
+		}
+		window = append(window, step)
+		if len(window) > a.EvaluationPeriods {
+			window = window[1:]
+		}
+
+		next, reason := a.evaluate(state, window, ignoreLow)
+		step.State, step.Reason = next, reason
+		res.Steps = append(res.Steps, step)
+		if next != state {
+			res.Transitions = append(res.Transitions, Transition{Time: start.Add(period), From: state, To: next, Reason: reason})
+			state = next
+		}
+	}
+
+	return res, nil
+}
+
+// evaluate returns the state after an evaluation of window, whose last
+// entry is the newest datapoint.
+func (a Alarm) evaluate(state State, window []Step, ignoreLow bool) (State, string) {
+	if latest := window[len(window)-1]; ignoreLow && latest.LowSampleCount && !latest.Missing {
+		return state, "low sample count ignored"
+	}
+
+	n, m := a.EvaluationPeriods, a.DatapointsToAlarm
+	// Periods before the simulation started count as missing.
+	missing := n - len(window)
+	var breaching, ok int
+	for _, s := range window {
+		switch {
+		case s.Missing:
+			missing++
+		case s.Breaching:
+			breaching++
+		default:
+			ok++
+		}
+	}
+	switch a.TreatMissingData {
+	case MissingBreaching:
+		breaching += missing
+		missing = 0
+	case MissingNotBreaching:
+		ok += missing
+		missing = 0
+	}
+
+	switch {
+	case breaching >= m:
+		return StateAlarm, fmt.Sprintf("%d of %d datapoints breaching", breaching, n)
+	case ok > n-m:
+		return StateOK, fmt.Sprintf("%d of %d datapoints breaching", breaching, n)
+	case breaching+ok == 0 && a.TreatMissingData == MissingMissing:
+		return StateInsufficientData, fmt.Sprintf("no datapoints in %d periods", n)
+	}
+
+	return state, fmt.Sprintf("%d breaching, %d not breaching and %d missing cannot decide %d of %d", breaching, ok, missing, m, n)
+}
@@ -0,0 +1,417 @@
+// Package alarmroute audits where CloudWatch alarm notifications go. Audit
+// follows the actions of every metric and composite alarm in a plan to the
+// SNS topics they publish to, and on to the subscriptions of those topics,
+// and reports the routes that lead nowhere: alarms without actions, topics
+// without subscriptions, ok_actions that disagree with the enable_ok_actions
+// variable and topics encrypted with a key CloudWatch may not use.
+//
+// Topic ARNs are usually known only after apply, so actions are resolved
+// through the configuration when their planned value is unknown.
+package alarmroute
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/alarm"
+	"github.com/JQUINONES82/terraform_modules/testkit/alarmrule"
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/iampolicy"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+// Rule identifiers reported by Audit.
+const (
+	RuleNoActions       = "alarm-route-no-actions"
+	RuleNoSubscriptions = "alarm-route-no-subscriptions"
+	RuleOKActions       = "alarm-route-ok-actions"
+	RuleKeyPolicy       = "alarm-route-kms-key-policy"
+	RuleUnresolved      = "alarm-route-unresolved"
+)
+
+// CloudWatchService is the service principal that publishes alarm
+// notifications.
+const CloudWatchService = "cloudwatch.amazonaws.com"
+
+// keyActions are what CloudWatch needs on the key of an encrypted topic.
+var keyActions = []string{"kms:Decrypt", "kms:GenerateDataKey"}
+
+// Actions of an alarm, in the order routes are listed.
+const (
+	ActionAlarm            = "alarm"
+	ActionOK               = "ok"
+	ActionInsufficientData = "insufficient_data"
+)
+
+var actionAttrs = []struct{ action, attr string }{
+	{ActionAlarm, "alarm_actions"},
+	{ActionOK, "ok_actions"},
+	{ActionInsufficientData, "insufficient_data_actions"},
+}
+
+// Endpoint is a topic subscription.
+type Endpoint struct {
+	Protocol string
+	Endpoint string
+}
+
+func (e Endpoint) String() string { return e.Protocol + ":" + e.Endpoint }
+
+// Topic is an SNS topic and its subscriptions.
+type Topic struct {
+	Address   string
+	Name      string
+	Endpoints []Endpoint
+}
+
+// Route is one action of an alarm. Topic is nil when the action is not an
+// SNS topic in the plan; Target then holds the action as planned, or "" if
+// it is known only after apply.
+type Route struct {
+	Alarm   string
+	Address string
+	Action  string
+	Target  string
+	Topic   *Topic
+}
+
+// Report is the result of Audit.
+type Report struct {
+	Routes   []Route
+	Topics   []*Topic
+	Findings finding.List
+}
+
+// Endpoints returns the endpoints the given action of the named alarm
+// reaches, sorted.
+func (r *Report) Endpoints(alarmName, action string) []string {
+	var out []string
+	for _, rt := range r.Routes {
+		if rt.Alarm != alarmName || rt.Action != action || rt.Topic == nil {
+			continue
+		}
+		for _, e := range rt.Topic.Endpoints {
+			out = append(out, e.String())
+		}
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// Table renders the routes as alarm, action, topic and endpoints columns.
+func (r *Report) Table() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ALARM\tACTION\tTOPIC\tENDPOINTS")
+	for _, rt := range r.Routes {
+		topic, endpoints := rt.Target, "?"
+		if topic == "" {
+			topic = "(known after apply)"
+		}
+		if rt.Topic != nil {
+			topic, endpoints = rt.Topic.Name, "-"
+			if len(rt.Topic.Endpoints) > 0 {
+				var s []string
+				for _, e := range rt.Topic.Endpoints {
+					s = append(s, e.String())
+				}
+				endpoints = strings.Join(s, ", ")
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", rt.Alarm, rt.Action, topic, endpoints)
+	}
+	w.Flush()
+
+	return b.String()
+}
+
+type auditor struct {
+	p         *tfjson.Plan
+	resources []plan.Resource
+	topics    map[string]*Topic
+	report    *Report
+}
+
+// Audit builds the routing table of every alarm in p and reports the
+// routes that cannot notify anyone.
+func Audit(p *tfjson.Plan) *Report {
+	a := &auditor{p: p, resources: plan.Resources(p), topics: map[string]*Topic{}, report: &Report{}}
+	a.collectTopics()
+
+	okWanted, okSet := plan.Variable(p, "enable_ok_actions")
+	// published maps each topic to the alarms that publish to it.
+	published := map[*Topic][]string{}
+	for _, r := range a.ofType(alarm.ResourceType, alarmrule.ResourceType) {
+		name := r.String("alarm_name")
+		notifies := false
+		for _, aa := range actionAttrs {
+			targets, known := a.actions(r, aa.attr)
+			if aa.action == ActionAlarm {
+				if notifies = !known || len(targets) > 0; !notifies {
+					a.add(finding.High, RuleNoActions, r.Address, aa.attr, "alarm %s notifies no one when it goes to ALARM", name)
+				}
+			}
+			if aa.action == ActionOK && okSet && notifies {
+				switch want, _ := okWanted.(bool); {
+				case want && known && len(targets) == 0:
+					a.add(finding.Medium, RuleOKActions, r.Address, aa.attr, "enable_ok_actions is true but alarm %s has no ok_actions", name)
+				case !want && (!known || len(targets) > 0):
+					a.add(finding.Medium, RuleOKActions, r.Address, aa.attr, "enable_ok_actions is false but alarm %s sets ok_actions", name)
+				}
+			}
+			for _, t := range targets {
+				rt := Route{Alarm: name, Address: r.Address, Action: aa.action, Target: t.target, Topic: t.topic}
+				a.report.Routes = append(a.report.Routes, rt)
+				if t.topic != nil && !containsString(published[t.topic], name) {
+					published[t.topic] = append(published[t.topic], name)
+				}
+			}
+		}
+	}
+
+	for _, t := range a.report.Topics {
+		if alarms := published[t]; len(alarms) > 0 && len(t.Endpoints) == 0 {
+			a.add(finding.High, RuleNoSubscriptions, t.Address, "", "topic %s has no subscriptions, so notifications from %s reach no one", t.Name, strings.Join(alarms, ", "))
+		}
+	}
+	a.report.Findings.Sort()
+
+	return a.report
+}
+
+func (a *auditor) add(s finding.Severity, rule, address, path, format string, args ...interface{}) {
+	a.report.Findings = append(a.report.Findings, finding.Finding{Severity: s, Rule: rule, Address: address, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (a *auditor) ofType(types ...string) []plan.Resource {
+	var out []plan.Resource
+	for _, r := range a.resources {
+		for _, t := range types {
+			if r.Type == t {
+				out = append(out, r)
+			}
+		}
+	}
+
+	return out
+}
+
+// collectTopics reads every topic with its subscriptions and checks the
+// key it is encrypted with.
+func (a *auditor) collectTopics() {
+	keys := map[string]plan.Resource{}
+	encrypts := map[string][]string{}
+	for _, r := range a.ofType("aws_sns_topic") {
+		t := &Topic{Address: r.Address, Name: r.String("name")}
+		if t.Name == "" {
+			t.Name = r.Address
+		}
+		a.topics[r.Address] = t
+		a.report.Topics = append(a.report.Topics, t)
+		if key, ok := a.topicKey(r); ok {
+			keys[key.Address] = key
+			encrypts[key.Address] = append(encrypts[key.Address], t.Name)
+		}
+	}
+	for _, address := range sortedKeys(encrypts) {
+		a.checkKey(keys[address], encrypts[address])
+	}
+
+	for _, s := range a.ofType("aws_sns_topic_subscription") {
+		var t *Topic
+		if arn := s.String("topic_arn"); arn != "" {
+			t = a.topicByARN(arn)
+		} else {
+			t = a.topicByReference(plan.References(a.p, s, "topic_arn"))
+		}
+		if t == nil {
+			continue
+		}
+		t.Endpoints = append(t.Endpoints, Endpoint{Protocol: s.String("protocol"), Endpoint: s.String("endpoint")})
+	}
+	for _, t := range a.topics {
+		sort.Slice(t.Endpoints, func(i, j int) bool { return t.Endpoints[i].String() < t.Endpoints[j].String() })
+	}
+}
+
+func (a *auditor) topicByARN(arn string) *Topic {
+	for _, r := range a.ofType("aws_sns_topic") {
+		if r.String("arn") == arn {
+			return a.topics[r.Address]
+		}
+	}
+
+	return nil
+}
+
+// topicByReference returns the topic a configuration reference points at:
+// the topic resource itself or the module that holds it.
+func (a *auditor) topicByReference(refs []string) *Topic {
+	for _, ref := range refs {
+		for _, r := range a.ofType("aws_sns_topic") {
+			if ref == r.Address || ref == r.ModuleAddress {
+				return a.topics[r.Address]
+			}
+		}
+	}
+
+	return nil
+}
+
+type target struct {
+	target string
+	topic  *Topic
+}
+
+// actions resolves an action list. known is false when the list itself is
+// only known after apply.
+func (a *auditor) actions(r plan.Resource, attr string) (targets []target, known bool) {
+	if !unknownList(r, attr) {
+		for _, arn := range r.Strings(attr) {
+			t := target{target: arn}
+			if strings.HasPrefix(arn, "arn:aws:sns:") || strings.HasPrefix(arn, "arn:aws-") && strings.Contains(arn, ":sns:") {
+				if t.topic = a.topicByARN(arn); t.topic == nil {
+					a.add(finding.Low, RuleUnresolved, r.Address, attr, "topic %s is not managed in this plan; its subscriptions were not checked", arn)
+				}
+			}
+			targets = append(targets, t)
+		}
+		return targets, true
+	}
+
+	t := target{topic: a.topicByReference(plan.References(a.p, r, attr))}
+	if t.topic == nil {
+		a.add(finding.Low, RuleUnresolved, r.Address, attr, "actions are known after apply and do not refer to a topic in this plan")
+	}
+
+	return []target{t}, false
+}
+
+// unknownList reports whether the list attribute, or any of its elements,
+// is known only after apply.
+func unknownList(r plan.Resource, attr string) bool {
+	switch u := r.Unknown[attr].(type) {
+	case bool:
+		return u
+	case []interface{}:
+		for _, e := range u {
+			if b, _ := e.(bool); b {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// topicKey returns the key a topic is encrypted with. The AWS managed key
+// alias/aws/sns cannot be granted to CloudWatch at all.
+func (a *auditor) topicKey(topic plan.Resource) (plan.Resource, bool) {
+	ref := topic.String("kms_master_key_id")
+	switch {
+	case ref == "alias/aws/sns" || strings.HasSuffix(ref, ":alias/aws/sns"):
+		a.add(finding.High, RuleKeyPolicy, topic.Address, "kms_master_key_id", "the AWS managed key alias/aws/sns does not let %s publish; use a customer managed key", CloudWatchService)
+		return plan.Resource{}, false
+	case ref != "":
+		if key, ok := a.findKey(ref); ok {
+			return key, true
+		}
+	case topic.IsUnknown("kms_master_key_id"):
+		refs := plan.References(a.p, topic, "kms_master_key_id")
+		for _, k := range a.ofType("aws_kms_key") {
+			if containsString(refs, k.Address) || containsString(refs, k.ModuleAddress) {
+				return k, true
+			}
+		}
+		ref = "(known after apply)"
+	default:
+		return plan.Resource{}, false
+	}
+	a.add(finding.Low, RuleUnresolved, topic.Address, "kms_master_key_id", "KMS key %s is not managed in this plan; its key policy was not checked", ref)
+
+	return plan.Resource{}, false
+}
+
+// checkKey checks that CloudWatch may use key to publish to topics.
+func (a *auditor) checkKey(key plan.Resource, topics []string) {
+	raw := key.String("policy")
+	if raw == "" {
+		a.add(finding.Low, RuleUnresolved, key.Address, "policy", "key policy is known after apply and was not checked")
+		return
+	}
+	doc, err := iampolicy.Parse(raw)
+	if err != nil {
+		a.add(finding.Medium, RuleUnresolved, key.Address, "policy", "key policy does not parse: %v", err)
+		return
+	}
+	keyARN := key.String("arn")
+	if keyARN == "" {
+		keyARN = "*"
+	}
+	for _, action := range keyActions {
+		if !allows(doc, action, keyARN) {
+			a.add(finding.High, RuleKeyPolicy, key.Address, "policy", "key policy does not let %s perform %s, which it needs to publish alarms to %s",
+				CloudWatchService, action, strings.Join(topics, ", "))
+		}
+	}
+}
+
+func (a *auditor) findKey(ref string) (plan.Resource, bool) {
+	for _, k := range a.ofType("aws_kms_key") {
+		if k.String("arn") == ref || k.String("key_id") == ref {
+			return k, true
+		}
+	}
+	for _, alias := range a.ofType("aws_kms_alias") {
+		if alias.String("arn") == ref || alias.String("name") == ref {
+			return a.findKey(alias.String("target_key_id"))
+		}
+	}
+
+	return plan.Resource{}, false
+}
+
+// allows reports whether doc grants CloudWatch action on the key without
+// an unconditional deny.
+func allows(doc *iampolicy.Document, action, keyARN string) bool {
+	allowed := false
+	for _, st := range doc.Statements {
+		if !st.HasPrincipal("Service", CloudWatchService) || !st.MatchesAction(action) || !st.MatchesResource(keyARN) {
+			continue
+		}
+		if !st.Allows() {
+			if len(st.Conditions) == 0 {
+				return false
+			}
+			continue
+		}
+		allowed = true
+	}
+
+	return allowed
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,140 @@
+package alarmroute
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan/plantest"
+)
+
+const (
+	criticalTopic    = "module.bedrock_critical_alerts[0].aws_sns_topic.this[0]"
+	performanceTopic = "module.bedrock_performance_alerts[0].aws_sns_topic.this[0]"
+	errorsAlarm      = "module.bedrock_invocation_errors_alarm[0].aws_cloudwatch_metric_alarm.this[0]"
+	kmsKey           = "module.bedrock_kms_key.aws_kms_key.this"
+	opsSubscription  = `module.bedrock_critical_alerts[0].aws_sns_topic_subscription.this["ops-team-email"]`
+)
+
+func TestAuditRoutes(t *testing.T) {
+	report := Audit(plantest.Load(t, "testdata/plan.json").Plan(t))
+	assert.Empty(t, report.Findings, report.Findings.String())
+	t.Log("\n" + report.Table())
+
+	assert.Equal(t, []string{"email:ops-team@company.com"}, report.Endpoints("bedrock-invocation-errors-dev", ActionAlarm))
+	assert.Equal(t, []string{"email:ops-team@company.com"}, report.Endpoints("bedrock-overall-health-dev", ActionAlarm))
+	assert.Equal(t, []string{"email:performance-team@company.com"}, report.Endpoints("bedrock-throttles-dev", ActionAlarm))
+	assert.Equal(t, []string{"email:finops-team@company.com"}, report.Endpoints("bedrock-input-token-anomaly-dev", ActionAlarm))
+	assert.Empty(t, report.Endpoints("bedrock-invocation-errors-dev", ActionOK), "enable_ok_actions is false")
+
+	assert.Contains(t, report.Table(), "bedrock-throttles-dev")
+	assert.Regexp(t, `bedrock-invocation-errors-dev\s+alarm\s+bedrock-critical-alerts-dev\s+email:ops-team@company.com`, report.Table())
+}
+
+func TestAuditKnownARNs(t *testing.T) {
+	f := plantest.Load(t, "testdata/plan.json")
+	const arn = "arn:aws:sns:us-east-1:111122223333:bedrock-critical-alerts-dev"
+	values, unknown := f.Values(t, criticalTopic), f.Unknown(t, criticalTopic)
+	values["arn"] = arn
+	delete(unknown, "arn")
+	values, unknown = f.Values(t, opsSubscription), f.Unknown(t, opsSubscription)
+	values["topic_arn"] = arn
+	delete(unknown, "topic_arn")
+	values, unknown = f.Values(t, errorsAlarm), f.Unknown(t, errorsAlarm)
+	values["alarm_actions"] = []interface{}{arn, "arn:aws:sns:us-east-1:444455556666:central-oncall"}
+	delete(unknown, "alarm_actions")
+
+	report := Audit(f.Plan(t))
+	assert.Equal(t, []string{"email:ops-team@company.com"}, report.Endpoints("bedrock-invocation-errors-dev", ActionAlarm))
+	require.Len(t, report.Findings, 1, report.Findings.String())
+	assert.Equal(t, RuleUnresolved, report.Findings[0].Rule)
+	assert.Contains(t, report.Findings[0].Message, "central-oncall")
+	assert.Contains(t, report.Table(), "arn:aws:sns:us-east-1:444455556666:central-oncall")
+}
+
+func TestAuditFindings(t *testing.T) {
+	tests := []struct {
+		name   string
+		breaks func(t *testing.T, f plantest.Fixture)
+		want   []plantest.Expected
+	}{
+		{
+			name: "no alarm actions",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				values, unknown := f.Values(t, errorsAlarm), f.Unknown(t, errorsAlarm)
+				values["alarm_actions"] = []interface{}{}
+				delete(unknown, "alarm_actions")
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleNoActions, errorsAlarm)},
+		},
+		{
+			name: "topic without subscriptions",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Remove(`module.bedrock_performance_alerts[0].aws_sns_topic_subscription.this["performance-team-email"]`)
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleNoSubscriptions, performanceTopic)},
+		},
+		{
+			name: "ok actions disabled on some alarms only",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f["variables"].(map[string]interface{})["enable_ok_actions"] = map[string]interface{}{"value": true}
+				values, unknown := f.Values(t, errorsAlarm), f.Unknown(t, errorsAlarm)
+				delete(values, "ok_actions")
+				unknown["ok_actions"] = []interface{}{true}
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.Medium, RuleOKActions, "module.bedrock_health_composite_alarm[0].aws_cloudwatch_composite_alarm.this[0]"),
+				plantest.Want(finding.Medium, RuleOKActions, "module.bedrock_input_token_anomaly_alarm[0].aws_cloudwatch_metric_alarm.anomaly[0]"),
+				plantest.Want(finding.Medium, RuleOKActions, "module.bedrock_throttle_alarm[0].aws_cloudwatch_metric_alarm.this[0]"),
+			},
+		},
+		{
+			name: "ok actions set while disabled",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				values, unknown := f.Values(t, errorsAlarm), f.Unknown(t, errorsAlarm)
+				delete(values, "ok_actions")
+				unknown["ok_actions"] = []interface{}{true}
+			},
+			want: []plantest.Expected{plantest.Want(finding.Medium, RuleOKActions, errorsAlarm)},
+		},
+		{
+			name: "key policy without cloudwatch",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				values := f.Values(t, kmsKey)
+				policy := values["policy"].(string)
+				values["policy"] = strings.Replace(policy, `"cloudwatch.amazonaws.com"`, `"events.amazonaws.com"`, 1)
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleKeyPolicy, kmsKey), plantest.Want(finding.High, RuleKeyPolicy, kmsKey)},
+		},
+		{
+			name: "aws managed key",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				values, unknown := f.Values(t, criticalTopic), f.Unknown(t, criticalTopic)
+				values["kms_master_key_id"] = "alias/aws/sns"
+				delete(unknown, "kms_master_key_id")
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleKeyPolicy, criticalTopic)},
+		},
+		{
+			name: "alarm actions do not resolve",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Remove(criticalTopic)
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.Low, RuleUnresolved, errorsAlarm),
+				plantest.Want(finding.Low, RuleUnresolved, "module.bedrock_health_composite_alarm[0].aws_cloudwatch_composite_alarm.this[0]"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := plantest.Load(t, "testdata/plan.json")
+			tt.breaks(t, f)
+			report := Audit(f.Plan(t))
+			plantest.AssertFindings(t, tt.want, report.Findings)
+		})
+	}
+}
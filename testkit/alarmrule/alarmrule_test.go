@@ -0,0 +1,172 @@
+package alarmrule
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/alarm"
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan/plantest"
+)
+
+const (
+	errorsAlarm = "bedrock-invocation-errors-test"
+	serverAlarm = "bedrock-server-errors-test"
+	maintenance = "maintenance-window"
+)
+
+var t0 = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{"TRUE", "TRUE"},
+		{`ALARM("a b") OR OK(c)`, `(ALARM("a b") OR OK("c"))`},
+		{"ALARM(a) OR ALARM(b) AND NOT ALARM(c)", `(ALARM("a") OR (ALARM("b") AND NOT ALARM("c")))`},
+		{"(ALARM(a) OR ALARM(b)) AND INSUFFICIENT_DATA(arn:aws:cloudwatch:us-east-1:111122223333:alarm:c)",
+			`((ALARM("a") OR ALARM("b")) AND INSUFFICIENT_DATA("arn:aws:cloudwatch:us-east-1:111122223333:alarm:c"))`},
+		{"NOT NOT FALSE", "NOT NOT FALSE"},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.rule)
+		require.NoError(t, err, tt.rule)
+		assert.Equal(t, tt.want, r.Root.String(), tt.rule)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		rule string
+		pos  int
+	}{
+		{"", 0},
+		{"ALARM(a) AND", 12},
+		{"ALARM(a", 7},
+		{"ALARM()", 6},
+		{"ALERT(a)", 0},
+		{"ALARM(a) ALARM(b)", 9},
+		{`ALARM("a)`, 6},
+		{"(TRUE", 5},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.rule)
+		var serr *SyntaxError
+		require.True(t, errors.As(err, &serr), "%q: %v", tt.rule, err)
+		assert.Equal(t, tt.pos, serr.Pos, "%q: %v", tt.rule, err)
+	}
+}
+
+func TestEval(t *testing.T) {
+	r, err := Parse("ALARM(a) AND NOT OK(arn:aws:cloudwatch:us-east-1:111122223333:alarm:b)")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "arn:aws:cloudwatch:us-east-1:111122223333:alarm:b"}, r.Refs())
+
+	assert.True(t, r.Eval(map[string]alarm.State{"a": alarm.StateAlarm}), "b defaults to INSUFFICIENT_DATA")
+	assert.False(t, r.Eval(map[string]alarm.State{"a": alarm.StateAlarm, "b": alarm.StateOK}))
+	assert.Equal(t, alarm.StateOK, r.State(nil))
+}
+
+func TestCheckPlan(t *testing.T) {
+	p, err := plan.Load("testdata/plan.json")
+	require.NoError(t, err)
+
+	findings := CheckPlan(p)
+	plantest.AssertFindings(t, []plantest.Expected{
+		plantest.Want(finding.Medium, RuleDangling, "module.bedrock_health_composite_alarm[0].aws_cloudwatch_composite_alarm.this[0]"),
+		plantest.Want(finding.High, RuleDangling, "module.bedrock_comprehensive_health_composite_alarm[0].aws_cloudwatch_composite_alarm.this[0]"),
+		plantest.Want(finding.High, RuleSyntax, "module.broken_composite_alarm[0].aws_cloudwatch_composite_alarm.this[0]"),
+		plantest.Want(finding.High, RuleCycle, "module.ping_composite_alarm[0].aws_cloudwatch_composite_alarm.this[0]"),
+	}, findings)
+	assert.Contains(t, findings.ByRule(RuleCycle)[0].Message, "ping-test -> pong-test -> ping-test")
+}
+
+func healthComposite(t *testing.T) Composite {
+	t.Helper()
+	p, err := plan.Load("testdata/plan.json")
+	require.NoError(t, err)
+	for _, c := range FromPlan(p) {
+		if c.Name == "bedrock-overall-health-test" {
+			return c
+		}
+	}
+	t.Fatal("no health composite in plan")
+
+	return Composite{}
+}
+
+func TestSimulateSuppression(t *testing.T) {
+	c := healthComposite(t)
+	require.NotNil(t, c.Suppressor)
+	assert.Equal(t, 2*time.Minute, c.Suppressor.WaitPeriod)
+	assert.Equal(t, 5*time.Minute, c.Suppressor.ExtensionPeriod)
+
+	healthy := map[string]alarm.State{errorsAlarm: alarm.StateOK, serverAlarm: alarm.StateOK, maintenance: alarm.StateOK}
+	at := func(min int) time.Time { return t0.Add(time.Duration(min) * time.Minute) }
+
+	tests := []struct {
+		name       string
+		events     []Event
+		suppressed []bool
+	}{
+		{
+			name: "no maintenance",
+			events: []Event{
+				{at(0), errorsAlarm, alarm.StateOK},
+				{at(10), serverAlarm, alarm.StateAlarm},
+			},
+			suppressed: []bool{false, false},
+		},
+		{
+			name: "during maintenance",
+			events: []Event{
+				{at(0), errorsAlarm, alarm.StateOK},
+				{at(5), maintenance, alarm.StateAlarm},
+				{at(10), serverAlarm, alarm.StateAlarm},
+			},
+			suppressed: []bool{false, true},
+		},
+		{
+			name: "maintenance starts within the wait period",
+			events: []Event{
+				{at(0), errorsAlarm, alarm.StateOK},
+				{at(10), serverAlarm, alarm.StateAlarm},
+				{at(11), maintenance, alarm.StateAlarm},
+			},
+			suppressed: []bool{false, true},
+		},
+		{
+			name: "within the extension period",
+			events: []Event{
+				{at(0), maintenance, alarm.StateAlarm},
+				{at(0), errorsAlarm, alarm.StateOK},
+				{at(8), maintenance, alarm.StateOK},
+				{at(10), serverAlarm, alarm.StateAlarm},
+				{at(20), serverAlarm, alarm.StateOK},
+			},
+			suppressed: []bool{true, true, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outcomes := c.Simulate(healthy, tt.events)
+			var got []bool
+			for _, o := range outcomes {
+				got = append(got, o.Suppressed)
+				t.Log(o)
+			}
+			assert.Equal(t, tt.suppressed, got)
+		})
+	}
+
+	outcomes := c.Simulate(healthy, []Event{{at(10), serverAlarm, alarm.StateAlarm}})
+	require.Len(t, outcomes, 1)
+	assert.Equal(t, alarm.StateAlarm, outcomes[0].To)
+	assert.Equal(t, at(12), outcomes[0].ActionsAt, "actions wait for the suppressor")
+}
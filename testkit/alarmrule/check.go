@@ -0,0 +1,127 @@
+package alarmrule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/alarm"
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/internal/graph"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+// ResourceType is the Terraform resource type of composite alarms.
+const ResourceType = "aws_cloudwatch_composite_alarm"
+
+// Rule identifiers reported by CheckPlan.
+const (
+	RuleSyntax   = "alarm-rule-syntax"
+	RuleDangling = "alarm-rule-dangling-reference"
+	RuleCycle    = "alarm-rule-cycle"
+	RuleUnknown  = "alarm-rule-unknown"
+)
+
+// Suppressor is an actions_suppressor block.
+type Suppressor struct {
+	Alarm           string
+	WaitPeriod      time.Duration
+	ExtensionPeriod time.Duration
+}
+
+// Composite is a composite alarm read from a plan.
+type Composite struct {
+	Address    string
+	Name       string
+	Rule       *Rule
+	Suppressor *Suppressor
+}
+
+// FromPlan returns the composite alarms in p whose rules parse. Use
+// CheckPlan to report the others.
+func FromPlan(p *tfjson.Plan) []Composite {
+	var out []Composite
+	for _, r := range plan.ResourcesOfType(p, ResourceType) {
+		rule, err := Parse(r.String("alarm_rule"))
+		if err != nil {
+			continue
+		}
+		c := Composite{Address: r.Address, Name: r.String("alarm_name"), Rule: rule}
+		if s := r.Blocks("actions_suppressor"); len(s) > 0 {
+			sr := plan.Resource{Values: s[0]}
+			c.Suppressor = &Suppressor{
+				Alarm:           sr.String("alarm"),
+				WaitPeriod:      time.Duration(sr.Number("wait_period")) * time.Second,
+				ExtensionPeriod: time.Duration(sr.Number("extension_period")) * time.Second,
+			}
+		}
+		out = append(out, c)
+	}
+
+	return out
+}
+
+// CheckPlan parses the alarm_rule of every composite alarm in p and
+// resolves its references, and its actions suppressor, against the metric
+// and composite alarms in the same plan. A reference by name that matches
+// nothing is HIGH; a reference by ARN may point at an alarm managed
+// elsewhere and is MEDIUM.
+func CheckPlan(p *tfjson.Plan) finding.List {
+	var out finding.List
+
+	known := map[string]bool{}
+	for _, r := range plan.ResourcesOfType(p, alarm.ResourceType, ResourceType) {
+		if name := r.String("alarm_name"); name != "" {
+			known[name] = true
+		}
+	}
+
+	// edges records which composites reference which, to find cycles.
+	edges := map[string][]string{}
+	addresses := map[string]string{}
+	for _, r := range plan.ResourcesOfType(p, ResourceType) {
+		name := r.String("alarm_name")
+		addresses[name] = r.Address
+		add := func(s finding.Severity, rule, path, format string, args ...interface{}) {
+			out = append(out, finding.Finding{Severity: s, Rule: rule, Address: r.Address, Path: path, Message: fmt.Sprintf(format, args...)})
+		}
+		resolve := func(path, ref string) {
+			switch n := Name(ref); {
+			case n == name:
+				add(finding.High, RuleCycle, path, "composite alarm references itself")
+			case known[n]:
+			case strings.HasPrefix(ref, "arn:"):
+				add(finding.Medium, RuleDangling, path, "%s is not managed in this plan", ref)
+			default:
+				add(finding.High, RuleDangling, path, "no alarm named %q in this plan", ref)
+			}
+		}
+
+		if r.IsUnknown("alarm_rule") {
+			add(finding.Low, RuleUnknown, "alarm_rule", "rule is known after apply; its references were not checked")
+		} else if rule, err := Parse(r.String("alarm_rule")); err != nil {
+			add(finding.High, RuleSyntax, "alarm_rule", "%v", err)
+		} else {
+			for _, ref := range rule.Refs() {
+				resolve("alarm_rule", ref)
+				edges[name] = append(edges[name], Name(ref))
+			}
+		}
+
+		if s := r.Blocks("actions_suppressor"); len(s) > 0 {
+			if ref, _ := s[0]["alarm"].(string); ref != "" {
+				resolve("actions_suppressor.alarm", ref)
+			}
+		}
+	}
+
+	for _, cycle := range graph.Cycles(edges) {
+		out = append(out, finding.Finding{Severity: finding.High, Rule: RuleCycle, Address: addresses[cycle[0]], Path: "alarm_rule",
+			Message: "composite alarms reference each other: " + strings.Join(append(cycle, cycle[0]), " -> ")})
+	}
+	out.Sort()
+
+	return out
+}
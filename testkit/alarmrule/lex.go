@@ -0,0 +1,84 @@
+package alarmrule
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokLParen
+	tokRParen
+	tokWord
+	tokString
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) isKeyword(k string) bool {
+	return t.kind == tokWord && t.text == k
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of rule"
+	case tokLParen:
+		return "("
+	case tokRParen:
+		return ")"
+	case tokString:
+		return fmt.Sprintf("%q", t.text)
+	}
+
+	return t.text
+}
+
+// lex splits a rule into parentheses, double-quoted strings and words. A
+// word runs until whitespace, a parenthesis or a quote, so unquoted alarm
+// names may contain any other character.
+func lex(src string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			toks = append(toks, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			toks = append(toks, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		case c == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(src) && src[j] != '"'; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+				}
+				b.WriteByte(src[j])
+			}
+			if j == len(src) {
+				return nil, &SyntaxError{Pos: i, Msg: "unterminated string"}
+			}
+			toks = append(toks, token{kind: tokString, text: b.String(), pos: i})
+			i = j + 1
+		default:
+			j := i
+			for j < len(src) && !strings.ContainsRune(" \t\n\r()\"", rune(src[j])) {
+				j++
+			}
+			toks = append(toks, token{kind: tokWord, text: src[i:j], pos: i})
+			i = j
+		}
+	}
+
+	return append(toks, token{kind: tokEOF, pos: len(src)}), nil
+}
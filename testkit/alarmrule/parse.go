@@ -0,0 +1,276 @@
+// Package alarmrule parses and evaluates the CloudWatch composite alarm rule
+// language used by alarm_rule:
+//
+//	ALARM("bedrock-errors") AND NOT (OK(latency) OR TRUE)
+//
+// Rules combine ALARM(), OK() and INSUFFICIENT_DATA() tests on other alarms,
+// referenced by name or ARN, with AND, OR, NOT, TRUE, FALSE and
+// parentheses. NOT binds tighter than AND, which binds tighter than OR.
+// CheckPlan resolves the references of every composite alarm in a plan, and
+// Composite.Simulate replays child state changes through a rule and its
+// actions suppressor.
+package alarmrule
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/alarm"
+)
+
+// MaxLength is the longest rule CloudWatch accepts.
+const MaxLength = 10240
+
+// SyntaxError reports where a rule fails to parse.
+type SyntaxError struct {
+	// Pos is the byte offset of the offending token.
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("alarm rule: %s at offset %d", e.Msg, e.Pos)
+}
+
+// Node is a node of a parsed rule.
+type Node interface {
+	// Eval evaluates the node given the state of each referenced alarm.
+	Eval(state func(ref string) alarm.State) bool
+	String() string
+}
+
+// Const is TRUE or FALSE.
+type Const bool
+
+// StateTest is ALARM(ref), OK(ref) or INSUFFICIENT_DATA(ref).
+type StateTest struct {
+	State alarm.State
+	Ref   string
+}
+
+// Not negates X.
+type Not struct {
+	X Node
+}
+
+// Binary is X AND Y or X OR Y.
+type Binary struct {
+	Op   string
+	X, Y Node
+}
+
+func (c Const) Eval(func(string) alarm.State) bool { return bool(c) }
+
+func (c Const) String() string {
+	if c {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+func (t StateTest) Eval(state func(string) alarm.State) bool { return state(t.Ref) == t.State }
+
+func (t StateTest) String() string { return fmt.Sprintf("%s(%q)", t.State, t.Ref) }
+
+func (n Not) Eval(state func(string) alarm.State) bool { return !n.X.Eval(state) }
+
+func (n Not) String() string { return "NOT " + n.X.String() }
+
+func (b Binary) Eval(state func(string) alarm.State) bool {
+	if b.Op == "AND" {
+		return b.X.Eval(state) && b.Y.Eval(state)
+	}
+	return b.X.Eval(state) || b.Y.Eval(state)
+}
+
+func (b Binary) String() string { return "(" + b.X.String() + " " + b.Op + " " + b.Y.String() + ")" }
+
+// Rule is a parsed alarm rule.
+type Rule struct {
+	Source string
+	Root   Node
+}
+
+// Parse parses a rule. Errors are *SyntaxError.
+func Parse(src string) (*Rule, error) {
+	if len(src) > MaxLength {
+		return nil, &SyntaxError{Pos: MaxLength, Msg: fmt.Sprintf("rule is longer than %d characters", MaxLength)}
+	}
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s", t)}
+	}
+
+	return &Rule{Source: src, Root: root}, nil
+}
+
+// Refs returns the alarms the rule references, in order of first use.
+func (r *Rule) Refs() []string {
+	var out []string
+	seen := map[string]bool{}
+	var walk func(Node)
+	walk = func(n Node) {
+		switch n := n.(type) {
+		case StateTest:
+			if !seen[n.Ref] {
+				seen[n.Ref] = true
+				out = append(out, n.Ref)
+			}
+		case Not:
+			walk(n.X)
+		case Binary:
+			walk(n.X)
+			walk(n.Y)
+		}
+	}
+	walk(r.Root)
+
+	return out
+}
+
+// Eval evaluates the rule. states is keyed by alarm name; references by ARN
+// are looked up by the name at the end of the ARN, and alarms missing from
+// states are INSUFFICIENT_DATA.
+func (r *Rule) Eval(states map[string]alarm.State) bool {
+	return r.Root.Eval(func(ref string) alarm.State {
+		if s, ok := states[Name(ref)]; ok {
+			return s
+		}
+		return alarm.StateInsufficientData
+	})
+}
+
+// State returns the composite state the rule produces: ALARM when it is
+// true and OK otherwise.
+func (r *Rule) State(states map[string]alarm.State) alarm.State {
+	if r.Eval(states) {
+		return alarm.StateAlarm
+	}
+
+	return alarm.StateOK
+}
+
+// Name returns the alarm name of a reference, which is either a name or an
+// ARN of the form arn:aws:cloudwatch:REGION:ACCOUNT:alarm:NAME.
+func Name(ref string) string {
+	if strings.HasPrefix(ref, "arn:") {
+		if parts := strings.SplitN(ref, ":", 7); len(parts) == 7 && parts[5] == "alarm" {
+			return parts[6]
+		}
+	}
+
+	return ref
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) or() (Node, error) {
+	x, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().isKeyword("OR") {
+		p.next()
+		y, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		x = Binary{Op: "OR", X: x, Y: y}
+	}
+
+	return x, nil
+}
+
+func (p *parser) and() (Node, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().isKeyword("AND") {
+		p.next()
+		y, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		x = Binary{Op: "AND", X: x, Y: y}
+	}
+
+	return x, nil
+}
+
+func (p *parser) unary() (Node, error) {
+	if p.peek().isKeyword("NOT") {
+		p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{X: x}, nil
+	}
+
+	return p.primary()
+}
+
+var stateFuncs = map[string]alarm.State{
+	"ALARM":             alarm.StateAlarm,
+	"OK":                alarm.StateOK,
+	"INSUFFICIENT_DATA": alarm.StateInsufficientData,
+}
+
+func (p *parser) primary() (Node, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokLParen:
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != tokRParen {
+			return nil, &SyntaxError{Pos: c.pos, Msg: fmt.Sprintf("expected ) but found %s", c)}
+		}
+		return x, nil
+	case t.isKeyword("TRUE"):
+		return Const(true), nil
+	case t.isKeyword("FALSE"):
+		return Const(false), nil
+	case t.kind == tokWord:
+		state, ok := stateFuncs[t.text]
+		if !ok {
+			return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unknown function %q; expected ALARM, OK or INSUFFICIENT_DATA", t.text)}
+		}
+		if o := p.next(); o.kind != tokLParen {
+			return nil, &SyntaxError{Pos: o.pos, Msg: fmt.Sprintf("expected ( after %s", t.text)}
+		}
+		ref := p.next()
+		if ref.kind != tokWord && ref.kind != tokString || ref.text == "" {
+			return nil, &SyntaxError{Pos: ref.pos, Msg: fmt.Sprintf("expected an alarm name or ARN but found %s", ref)}
+		}
+		if c := p.next(); c.kind != tokRParen {
+			return nil, &SyntaxError{Pos: c.pos, Msg: fmt.Sprintf("expected ) but found %s", c)}
+		}
+		return StateTest{State: state, Ref: ref.text}, nil
+	}
+
+	return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s", t)}
+}
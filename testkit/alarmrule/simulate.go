@@ -0,0 +1,110 @@
+package alarmrule
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/alarm"
+)
+
+// Event is a child alarm changing state.
+type Event struct {
+	Time  time.Time
+	Alarm string
+	State alarm.State
+}
+
+// Outcome is a composite state change and what happened to its actions.
+type Outcome struct {
+	Time time.Time
+	From alarm.State
+	To   alarm.State
+	// Suppressed is set when the actions suppressor stopped the actions;
+	// Reason says why.
+	Suppressed bool
+	Reason     string
+	// ActionsAt is when the actions run: the change itself, or the end of
+	// the suppressor's wait period. It is zero when Suppressed is set.
+	ActionsAt time.Time
+}
+
+func (o Outcome) String() string {
+	s := fmt.Sprintf("%s %s -> %s", o.Time.UTC().Format(time.RFC3339), o.From, o.To)
+	if o.Suppressed {
+		return s + ": actions suppressed, " + o.Reason
+	}
+
+	return s + ": actions at " + o.ActionsAt.UTC().Format(time.RFC3339)
+}
+
+// Simulate replays events through the composite, starting from initial
+// child states; children missing from initial are INSUFFICIENT_DATA. The
+// composite starts in INSUFFICIENT_DATA and changes state whenever its rule
+// changes value.
+//
+// When the composite changes state, its actions are suppressed if the
+// suppressor alarm is in ALARM, left ALARM less than extension_period
+// earlier, or enters ALARM within wait_period. Otherwise they run once
+// wait_period has passed.
+func (c Composite) Simulate(initial map[string]alarm.State, events []Event) []Outcome {
+	states := map[string]alarm.State{}
+	for k, v := range initial {
+		states[Name(k)] = v
+	}
+	events = append([]Event(nil), events...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+
+	var (
+		suppressor string
+		// leftAlarmAt is when the suppressor last left ALARM.
+		leftAlarmAt time.Time
+		out         []Outcome
+	)
+	if c.Suppressor != nil {
+		suppressor = Name(c.Suppressor.Alarm)
+	}
+	state := alarm.StateInsufficientData
+	for i, e := range events {
+		name := Name(e.Alarm)
+		if name == suppressor && states[name] == alarm.StateAlarm && e.State != alarm.StateAlarm {
+			leftAlarmAt = e.Time
+		}
+		states[name] = e.State
+		// Events at the same instant are applied together.
+		if i+1 < len(events) && events[i+1].Time.Equal(e.Time) {
+			continue
+		}
+
+		next := c.Rule.State(states)
+		if next == state {
+			continue
+		}
+		o := Outcome{Time: e.Time, From: state, To: next}
+		state = next
+		switch {
+		case c.Suppressor == nil:
+			o.ActionsAt = e.Time
+		case states[suppressor] == alarm.StateAlarm:
+			o.Suppressed, o.Reason = true, fmt.Sprintf("suppressor %s is in ALARM", suppressor)
+		case !leftAlarmAt.IsZero() && e.Time.Before(leftAlarmAt.Add(c.Suppressor.ExtensionPeriod)):
+			o.Suppressed, o.Reason = true, fmt.Sprintf("within the %s extension period after %s left ALARM", c.Suppressor.ExtensionPeriod, suppressor)
+		default:
+			deadline := e.Time.Add(c.Suppressor.WaitPeriod)
+			o.ActionsAt = deadline
+			for _, later := range events[i+1:] {
+				if later.Time.After(deadline) {
+					break
+				}
+				if Name(later.Alarm) == suppressor && later.State == alarm.StateAlarm {
+					o.Suppressed, o.Reason = true, fmt.Sprintf("%s entered ALARM within the %s wait period", suppressor, c.Suppressor.WaitPeriod)
+					o.ActionsAt = time.Time{}
+					break
+				}
+			}
+		}
+		out = append(out, o)
+	}
+
+	return out
+}
@@ -0,0 +1,265 @@
+package albroute
+
+import (
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan/plantest"
+)
+
+const (
+	apiRule     = `module.api.aws_lb_listener_rule.this["api"]`
+	apiRewrite  = `module.api.aws_lb_listener_rule.rewrite["api-v1.bananalab.dev"]`
+	wwwRule     = `module.www.aws_lb_listener_rule.this["nginx"]`
+	apexRewrite = `module.www.aws_lb_listener_rule.rewrite["bananalab.dev"]`
+	docsRewrite = `module.www.aws_lb_listener_rule.rewrite["docs.bananalab.dev"]`
+	httpsKey    = "module.platform.module.alb.aws_lb.this:443"
+	httpKey     = "module.platform.module.alb.aws_lb.this:80"
+)
+
+func listeners(t *testing.T, p *tfjson.Plan) (https, http *Listener) {
+	t.Helper()
+	ls := FromPlan(p)
+	require.Len(t, ls, 2)
+	require.Equal(t, httpsKey, ls[0].Key)
+	require.Equal(t, httpKey, ls[1].Key)
+
+	return ls[0], ls[1]
+}
+
+func TestFromPlan(t *testing.T) {
+	https, http := listeners(t, plantest.Load(t, "testdata/plan.json").Plan(t))
+	assert.Equal(t, "module.platform.module.alb.aws_lb_listener.https", https.Address)
+	assert.Equal(t, 443, https.Port)
+	assert.Equal(t, "fixed-response 404", https.Default.String())
+	var rules []string
+	for _, r := range https.Rules {
+		assert.False(t, r.Assigned(), r.Address)
+		rules = append(rules, r.Address)
+	}
+	assert.Equal(t, []string{apiRewrite, apiRule, apexRewrite, docsRewrite, wwwRule}, rules)
+	assert.Equal(t, []string{`module.api.aws_lb_target_group.this["api"]`}, https.Rules[1].Action.TargetGroups)
+	assert.Equal(t, []string{`module.www.aws_lb_target_group.this["nginx"]`}, https.Rules[4].Action.TargetGroups)
+	assert.Empty(t, http.Rules)
+}
+
+func TestRoute(t *testing.T) {
+	https, http := listeners(t, plantest.Load(t, "testdata/plan.json").Plan(t))
+	tests := []struct {
+		listener *Listener
+		url      string
+		rule     string
+		want     string
+	}{
+		{https, "https://api.bananalab.dev/v2/users?id=1", apiRule, `forward to module.api.aws_lb_target_group.this["api"]`},
+		{https, "https://API.Bananalab.dev:443/", apiRule, `forward to module.api.aws_lb_target_group.this["api"]`},
+		{https, "https://api-v1.bananalab.dev/users?id=7", apiRewrite, "https://api.bananalab.dev/v1/users?id=7"},
+		{https, "https://bananalab.dev/about", apexRewrite, "https://www.bananalab.dev/about"},
+		{https, "https://docs.bananalab.dev/intro?lang=en", docsRewrite, "https://www.bananalab.dev/docs/intro?from=docs.bananalab.dev&lang=en"},
+		{https, "https://www.bananalab.dev/", wwwRule, `forward to module.www.aws_lb_target_group.this["nginx"]`},
+		{https, "https://shop.bananalab.dev/", "", "fixed-response 404"},
+		{http, "http://api.bananalab.dev/x?y=1", "", "https://api.bananalab.dev/x?y=1"},
+		{http, "http://api.bananalab.dev:8080/", "", "https://api.bananalab.dev/"},
+	}
+	for _, tt := range tests {
+		req, err := ParseRequest(tt.url)
+		require.NoError(t, err)
+		res := tt.listener.Route(req)
+		if tt.rule == "" {
+			assert.Nil(t, res.Rule, tt.url)
+		} else if assert.NotNil(t, res.Rule, tt.url) {
+			assert.Equal(t, tt.rule, res.Rule.Address, tt.url)
+		}
+		if res.Action.Type == Redirect {
+			assert.Equal(t, tt.want, res.Location, tt.url)
+		} else {
+			assert.Equal(t, tt.want, res.Action.String(), tt.url)
+		}
+	}
+
+	req, err := ParseRequest("https://bananalab.dev/about")
+	require.NoError(t, err)
+	assert.Equal(t, apexRewrite+": redirect HTTP_301 to https://www.bananalab.dev/about", https.Route(req).String())
+	assert.Equal(t, "default: fixed-response 404", https.Route(Request{Host: "shop.bananalab.dev"}).String())
+
+	_, err = ParseRequest("/no/host")
+	assert.ErrorContains(t, err, "has no host")
+}
+
+func TestConditions(t *testing.T) {
+	req := Request{
+		Host:     "eu.shop.example.com",
+		Method:   "POST",
+		Path:     "/api/v1/Orders",
+		Query:    "version=2&debug=Yes",
+		Headers:  map[string][]string{"X-Canary": {"on"}},
+		SourceIP: "10.1.2.3",
+	}
+	tests := []struct {
+		c    Condition
+		want bool
+	}{
+		{Condition{Type: HostHeader, Values: []string{"*.example.com"}}, true},
+		{Condition{Type: HostHeader, Values: []string{"??.shop.example.com"}}, true},
+		{Condition{Type: HostHeader, Values: []string{"shop.example.com"}}, false},
+		{Condition{Type: PathPattern, Values: []string{"/api/*"}}, true},
+		{Condition{Type: PathPattern, Values: []string{"/api/v1/orders"}}, false},
+		{Condition{Type: HTTPRequestMethod, Values: []string{"GET", "POST"}}, true},
+		{Condition{Type: HTTPRequestMethod, Values: []string{"post"}}, false},
+		{Condition{Type: HTTPHeader, Header: "x-canary", Values: []string{"ON"}}, true},
+		{Condition{Type: HTTPHeader, Header: "X-Beta", Values: []string{"*"}}, false},
+		{Condition{Type: QueryString, Values: []string{"debug=yes"}}, true},
+		{Condition{Type: QueryString, Values: []string{"=2"}}, true},
+		{Condition{Type: QueryString, Values: []string{"version=3", "trace=*"}}, false},
+		{Condition{Type: SourceIP, Values: []string{"192.168.0.0/16", "10.0.0.0/8"}}, true},
+		{Condition{Type: SourceIP, Values: []string{"10.2.0.0/16"}}, false},
+		{Condition{Type: HostHeader, Unknown: true}, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.c.Matches(req), tt.c.String())
+	}
+	assert.False(t, (&Rule{}).Matches(req), "a rule without conditions matches nothing")
+}
+
+func TestCheckShadowing(t *testing.T) {
+	host := func(v ...string) Condition { return Condition{Type: HostHeader, Values: v} }
+	path := func(v ...string) Condition { return Condition{Type: PathPattern, Values: v} }
+	forward := &Action{Type: Forward, TargetGroups: []string{"tg"}}
+	tests := []struct {
+		earlier, later []Condition
+		shadowed       bool
+	}{
+		{[]Condition{host("*.example.com")}, []Condition{host("api.example.com"), path("/v1/*")}, true},
+		{[]Condition{host("API.example.com")}, []Condition{host("api.example.com")}, true},
+		{[]Condition{host("api.example.com"), path("/v1/*")}, []Condition{host("api.example.com")}, false},
+		{[]Condition{path("/api*")}, []Condition{path("/api/v?/*")}, true},
+		{[]Condition{path("/a?")}, []Condition{path("/a*")}, false},
+		{[]Condition{path("/API/*")}, []Condition{path("/api/x")}, false},
+		{[]Condition{{Type: SourceIP, Values: []string{"10.0.0.0/8"}}}, []Condition{{Type: SourceIP, Values: []string{"10.1.0.0/16"}}}, true},
+		{[]Condition{{Type: SourceIP, Values: []string{"10.1.0.0/16"}}}, []Condition{{Type: SourceIP, Values: []string{"10.0.0.0/8"}}}, false},
+		{[]Condition{{Type: QueryString, Values: []string{"=yes"}}}, []Condition{{Type: QueryString, Values: []string{"debug=YES"}}}, true},
+		{[]Condition{{Type: QueryString, Values: []string{"debug=yes"}}}, []Condition{{Type: QueryString, Values: []string{"=yes"}}}, false},
+	}
+	for _, tt := range tests {
+		l := &Listener{Key: "lb:443", Rules: []*Rule{
+			{Address: "first", Priority: 1, Conditions: tt.earlier, Action: forward},
+			{Address: "second", Priority: 2, Conditions: tt.later, Action: forward},
+		}}
+		findings := Check(l)
+		if tt.shadowed {
+			require.Len(t, findings, 1, "%v before %v", tt.earlier, tt.later)
+			assert.Equal(t, RuleShadowed, findings[0].Rule)
+			assert.Equal(t, "second", findings[0].Address)
+		} else {
+			assert.Empty(t, findings, "%v before %v", tt.earlier, tt.later)
+		}
+	}
+}
+
+// redirect returns the redirect block of a rule.
+func redirect(t *testing.T, f plantest.Fixture, address string) map[string]interface{} {
+	t.Helper()
+	action := f.Values(t, address)["action"].([]interface{})[0].(map[string]interface{})
+
+	return action["redirect"].([]interface{})[0].(map[string]interface{})
+}
+
+// setHost replaces the host_header values of a rule.
+func setHost(t *testing.T, f plantest.Fixture, address string, hosts ...interface{}) {
+	t.Helper()
+	c := f.Values(t, address)["condition"].([]interface{})[0].(map[string]interface{})
+	c["host_header"].([]interface{})[0].(map[string]interface{})["values"] = hosts
+}
+
+func TestCheckPlan(t *testing.T) {
+	findings := CheckPlan(plantest.Load(t, "testdata/plan.json").Plan(t))
+	assert.Empty(t, findings, findings.String())
+
+	tests := []struct {
+		name   string
+		breaks func(t *testing.T, f plantest.Fixture)
+		want   []plantest.Expected
+	}{
+		{
+			name: "empty redirect path",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				// What url_rewrites used to default to.
+				r := redirect(t, f, apexRewrite)
+				r["path"], r["query"] = "", ""
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleRedirect, apexRewrite)},
+		},
+		{
+			name: "redirect loop",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				redirect(t, f, apexRewrite)["host"] = "#{host}"
+				r := redirect(t, f, docsRewrite)
+				r["path"], r["query"] = "/#{path}", "#{query}"
+				r["host"] = "DOCS.bananalab.dev"
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleRedirect, apexRewrite), plantest.Want(finding.High, RuleRedirect, docsRewrite)},
+		},
+		{
+			name: "bad status code and query",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				r := redirect(t, f, docsRewrite)
+				r["status_code"], r["query"] = "HTTP_308", "?from=docs"
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleRedirect, docsRewrite), plantest.Want(finding.High, RuleRedirect, docsRewrite)},
+		},
+		{
+			name: "two services claim a host",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				setHost(t, f, wwwRule, "api.bananalab.dev")
+			},
+			want: []plantest.Expected{plantest.Want(finding.Medium, RuleOrder, wwwRule)},
+		},
+		{
+			name: "priority collision",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, apiRule)["priority"] = 10
+				f.Values(t, wwwRule)["priority"] = 10
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RulePriority, wwwRule)},
+		},
+		{
+			name: "priority out of range",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, apiRule)["priority"] = 50001
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RulePriority, apiRule)},
+		},
+		{
+			name: "wildcard rule shadows later rules",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				setHost(t, f, apiRule, "*.bananalab.dev")
+				f.Values(t, apiRule)["priority"] = 1
+				f.Values(t, wwwRule)["priority"] = 2
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.Medium, RuleShadowed, wwwRule),
+				plantest.Want(finding.Medium, RuleShadowed, apiRewrite),
+				plantest.Want(finding.Medium, RuleShadowed, docsRewrite),
+			},
+		},
+		{
+			name: "no conditions",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, wwwRule)["condition"] = []interface{}{}
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleCondition, wwwRule)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := plantest.Load(t, "testdata/plan.json")
+			tt.breaks(t, f)
+			findings := CheckPlan(f.Plan(t))
+			plantest.AssertFindings(t, tt.want, findings)
+		})
+	}
+}
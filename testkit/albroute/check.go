@@ -0,0 +1,243 @@
+package albroute
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+)
+
+// Rule identifiers reported by Check.
+const (
+	RulePriority  = "alb-rule-priority"
+	RuleShadowed  = "alb-rule-shadowed"
+	RuleOrder     = "alb-rule-order"
+	RuleRedirect  = "alb-rule-redirect"
+	RuleCondition = "alb-rule-condition"
+)
+
+// MaxPriority is the highest listener rule priority.
+const MaxPriority = 50000
+
+// CheckPlan checks the listener rules of every listener in p.
+func CheckPlan(p *tfjson.Plan) finding.List {
+	var findings finding.List
+	for _, l := range FromPlan(p) {
+		findings = append(findings, Check(l)...)
+	}
+	findings.Sort()
+
+	return findings
+}
+
+// Check reports priority collisions, rules that can never match because
+// an earlier rule matches every request they would, rules whose relative
+// order is left to creation order, and invalid redirects.
+func Check(l *Listener) finding.List {
+	var findings finding.List
+	add := func(s finding.Severity, rule, address, path, format string, args ...interface{}) {
+		findings = append(findings, finding.Finding{Severity: s, Rule: rule, Address: address, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	priorities := map[int]*Rule{}
+	for i, r := range l.Rules {
+		switch {
+		case !r.Assigned():
+		case r.Priority < 1 || r.Priority > MaxPriority:
+			add(finding.High, RulePriority, r.Address, "priority", "priority %d is outside 1-%d", r.Priority, MaxPriority)
+		case priorities[r.Priority] != nil:
+			add(finding.High, RulePriority, r.Address, "priority", "priority %d is already used by %s on listener %s", r.Priority, priorities[r.Priority].Address, l.Key)
+		default:
+			priorities[r.Priority] = r
+		}
+
+		if len(r.Conditions) == 0 {
+			add(finding.High, RuleCondition, r.Address, "condition", "rule has no conditions")
+		}
+		for j, c := range r.Conditions {
+			if c.Unknown {
+				add(finding.Low, RuleCondition, r.Address, fmt.Sprintf("condition[%d]", j), "%s values are known after apply and were not simulated", c.Type)
+			}
+		}
+		if r.Action != nil && r.Action.Type == Redirect {
+			checkRedirect(r, l, add)
+		}
+
+		for _, earlier := range l.Rules[:i] {
+			if !earlier.Assigned() && !r.Assigned() {
+				if overlap(earlier, r) {
+					add(finding.Medium, RuleOrder, r.Address, "priority", "rule may match the same requests as %s and neither sets a priority, so which is evaluated first depends on creation order", earlier.Address)
+				}
+				continue
+			}
+			if covers(earlier, r) {
+				add(finding.Medium, RuleShadowed, r.Address, "condition", "rule never matches: %s is evaluated first and matches every request it would", earlier.Address)
+				break
+			}
+		}
+	}
+
+	return findings
+}
+
+func checkRedirect(r *Rule, l *Listener, add func(finding.Severity, string, string, string, string, ...interface{})) {
+	rd := r.Action.Redirect
+	if !strings.HasPrefix(rd.Path, "/") {
+		add(finding.High, RuleRedirect, r.Address, "action.redirect.path", "redirect path %q must start with /; use \"/#{path}\" to keep the request path", rd.Path)
+	}
+	if strings.HasPrefix(rd.Query, "?") {
+		add(finding.High, RuleRedirect, r.Address, "action.redirect.query", "redirect query %q must not start with ?", rd.Query)
+	}
+	if rd.StatusCode != "HTTP_301" && rd.StatusCode != "HTTP_302" {
+		add(finding.High, RuleRedirect, r.Address, "action.redirect.status_code", "redirect status_code must be HTTP_301 or HTTP_302, not %q", rd.StatusCode)
+	}
+
+	// A redirect that keeps the URL, or sends a host it matches back to the
+	// same host, path and query, loops.
+	if rd.Path != "/#{path}" || rd.Query != "#{query}" || !keeps(rd.Protocol, "#{protocol}", l.Protocol) || !keeps(rd.Port, "#{port}", fmt.Sprint(l.Port)) {
+		return
+	}
+	if rd.Host == "#{host}" {
+		add(finding.High, RuleRedirect, r.Address, "action.redirect", "redirect keeps the whole URL and loops")
+		return
+	}
+	for _, c := range r.Conditions {
+		if c.Type == HostHeader && anyMatch(c.Values, rd.Host, true) {
+			add(finding.High, RuleRedirect, r.Address, "action.redirect.host", "redirect to %s matches the rule's own host_header and loops", rd.Host)
+		}
+	}
+}
+
+func keeps(value, placeholder, current string) bool {
+	return value == placeholder || strings.EqualFold(value, current)
+}
+
+// covers reports whether every request matching b also matches a: each
+// condition of a is at least as broad as a condition of b of the same
+// type. It errs towards false.
+func covers(a, b *Rule) bool {
+	if len(a.Conditions) == 0 {
+		return false
+	}
+	for _, ca := range a.Conditions {
+		found := false
+		for _, cb := range b.Conditions {
+			if conditionCovers(ca, cb) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func conditionCovers(a, b Condition) bool {
+	if a.Type != b.Type || a.Unknown || b.Unknown || (a.Type == HTTPHeader && !strings.EqualFold(a.Header, b.Header)) {
+		return false
+	}
+	fold := a.Type != PathPattern && a.Type != HTTPRequestMethod
+	for _, vb := range b.Values {
+		found := false
+		for _, va := range a.Values {
+			if valueCovers(a.Type, va, vb, fold) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// valueCovers reports whether pattern a matches everything pattern b does.
+func valueCovers(typ, a, b string, fold bool) bool {
+	switch typ {
+	case SourceIP:
+		_, na, errA := net.ParseCIDR(a)
+		_, nb, errB := net.ParseCIDR(b)
+		if errA != nil || errB != nil {
+			return false
+		}
+		sa, _ := na.Mask.Size()
+		sb, _ := nb.Mask.Size()
+		return na.Contains(nb.IP) && sa <= sb
+	case QueryString:
+		ka, va, _ := strings.Cut(a, "=")
+		kb, vb, _ := strings.Cut(b, "=")
+		// An empty key matches any key.
+		return (ka == "" || kb != "" && patternCovers(ka, kb, true)) && patternCovers(va, vb, true)
+	}
+
+	return patternCovers(a, b, fold)
+}
+
+func patternCovers(a, b string, fold bool) bool {
+	if fold {
+		a, b = strings.ToLower(a), strings.ToLower(b)
+	}
+	switch {
+	case a == b || a == "*":
+		return true
+	case !hasWildcard(b):
+		return wildcard(a, b, false)
+	case strings.HasSuffix(a, "*") && !hasWildcard(a[:len(a)-1]):
+		return strings.HasPrefix(b, a[:len(a)-1])
+	case strings.HasPrefix(a, "*") && !hasWildcard(a[1:]):
+		return strings.HasSuffix(b, a[1:])
+	}
+
+	return false
+}
+
+// overlap reports whether some request may match both a and b. Two rules
+// are disjoint only when a condition type they share has no values in
+// common. A rule without conditions matches nothing.
+func overlap(a, b *Rule) bool {
+	if len(a.Conditions) == 0 || len(b.Conditions) == 0 {
+		return false
+	}
+	for _, ca := range a.Conditions {
+		for _, cb := range b.Conditions {
+			if ca.Type == cb.Type && ca.Type != HTTPHeader && ca.Type != QueryString && disjoint(ca, cb) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func disjoint(a, b Condition) bool {
+	if a.Unknown || b.Unknown {
+		return false
+	}
+	fold := a.Type == HostHeader
+	for _, va := range a.Values {
+		for _, vb := range b.Values {
+			switch {
+			case a.Type == SourceIP:
+				_, na, errA := net.ParseCIDR(va)
+				_, nb, errB := net.ParseCIDR(vb)
+				if errA != nil || errB != nil || na.Contains(nb.IP) || nb.Contains(na.IP) {
+					return false
+				}
+			case hasWildcard(va) && hasWildcard(vb):
+				return false
+			case wildcard(va, vb, fold) || wildcard(vb, va, fold):
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,385 @@
+// Package albroute simulates how an Application Load Balancer routes
+// requests through the listener rules in a plan. Rules from every module
+// that attaches to the same listener, such as several bananalab-ecs-service
+// instances sharing the HTTPS listener of aws-https-alb, are evaluated
+// together in priority order, and Check reports priority collisions,
+// shadowed rules and invalid redirects.
+package albroute
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+// Resource types read from a plan. aws_alb* are the provider's aliases.
+var (
+	loadBalancerTypes = []string{"aws_lb", "aws_alb"}
+	listenerTypes     = []string{"aws_lb_listener", "aws_alb_listener"}
+	ruleTypes         = []string{"aws_lb_listener_rule", "aws_alb_listener_rule"}
+	targetGroupTypes  = []string{"aws_lb_target_group", "aws_alb_target_group"}
+)
+
+// Action types.
+const (
+	Forward       = "forward"
+	Redirect      = "redirect"
+	FixedResponse = "fixed-response"
+)
+
+// Listener is a load balancer listener and the rules attached to it.
+type Listener struct {
+	// Key identifies the listener as <load balancer>:<port>, where the
+	// load balancer is its address in the plan when it can be resolved.
+	Key          string
+	LoadBalancer string
+	Port         int
+	// Address and Protocol are set when the listener itself is in the
+	// plan; rules may attach to a listener found by a data lookup.
+	Address  string
+	Protocol string
+	// Default is the default action, nil when the listener is not in the
+	// plan.
+	Default *Action
+	// Rules are in evaluation order: explicit priorities first, then rules
+	// whose priority is assigned on create, by address.
+	Rules []*Rule
+}
+
+// Rule is a listener rule.
+type Rule struct {
+	Address string
+	// Priority is 0 when the rule does not set one and the load balancer
+	// assigns the next free priority on create.
+	Priority   int
+	Conditions []Condition
+	// Action is the final action; authenticate actions before it are not
+	// simulated.
+	Action *Action
+}
+
+// Assigned reports whether the rule's priority is set in configuration.
+func (r *Rule) Assigned() bool { return r.Priority != 0 }
+
+// Action is what a rule or listener does with a request.
+type Action struct {
+	Type string
+	// TargetGroups are target group addresses, or ARNs when the target
+	// group is not in the plan, of a forward action.
+	TargetGroups []string
+	Redirect     *RedirectConfig
+	Fixed        *FixedResponseConfig
+}
+
+// RedirectConfig is a redirect action. Fields the configuration leaves
+// unset hold the provider's defaults, such as "/#{path}", which keep that
+// part of the request URL.
+type RedirectConfig struct {
+	Protocol   string
+	Port       string
+	Host       string
+	Path       string
+	Query      string
+	StatusCode string
+}
+
+// FixedResponseConfig is a fixed-response action.
+type FixedResponseConfig struct {
+	ContentType string
+	MessageBody string
+	StatusCode  string
+}
+
+func (a *Action) String() string {
+	if a == nil {
+		return "default action (not in plan)"
+	}
+	switch a.Type {
+	case Forward:
+		return "forward to " + strings.Join(a.TargetGroups, ", ")
+	case Redirect:
+		r := a.Redirect
+		return fmt.Sprintf("redirect %s to %s://%s:%s%s?%s", r.StatusCode, strings.ToLower(r.Protocol), r.Host, r.Port, r.Path, r.Query)
+	case FixedResponse:
+		return "fixed-response " + a.Fixed.StatusCode
+	}
+
+	return a.Type
+}
+
+// FromPlan returns the listeners that have rules or are created in p,
+// ordered by key.
+func FromPlan(p *tfjson.Plan) []*Listener {
+	b := &builder{p: p, listeners: map[string]*Listener{}, arns: map[string]*Listener{}}
+	b.lbs = plan.ResourcesOfType(p, loadBalancerTypes...)
+	b.tgs = plan.ResourcesOfType(p, targetGroupTypes...)
+	for _, r := range plan.ResourcesOfType(p, listenerTypes...) {
+		lb := b.loadBalancer(r, "load_balancer_arn")
+		port := int(r.Number("port"))
+		l := b.listener(lb, port)
+		l.Address, l.Protocol = r.Address, r.String("protocol")
+		if blocks := r.Blocks("default_action"); len(blocks) > 0 {
+			l.Default = b.action(r, blocks, "default_action")
+		}
+		b.created = append(b.created, l)
+		if arn := r.String("arn"); arn != "" {
+			b.arns[arn] = l
+		}
+	}
+	for _, r := range plan.ResourcesOfType(p, ruleTypes...) {
+		l := b.ruleListener(r)
+		l.Rules = append(l.Rules, &Rule{
+			Address:    r.Address,
+			Priority:   int(r.Number("priority")),
+			Conditions: conditions(r),
+			Action:     b.action(r, r.Blocks("action"), "action"),
+		})
+	}
+
+	out := make([]*Listener, 0, len(b.listeners))
+	for _, l := range b.listeners {
+		sort.SliceStable(l.Rules, func(i, j int) bool {
+			a, c := l.Rules[i], l.Rules[j]
+			if a.Assigned() != c.Assigned() {
+				return a.Assigned()
+			}
+			if a.Priority != c.Priority {
+				return a.Priority < c.Priority
+			}
+			return a.Address < c.Address
+		})
+		out = append(out, l)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+
+	return out
+}
+
+type builder struct {
+	p         *tfjson.Plan
+	lbs, tgs  []plan.Resource
+	listeners map[string]*Listener
+	// created are the listeners created in the plan and arns those of
+	// them whose ARN is known.
+	created []*Listener
+	arns    map[string]*Listener
+}
+
+func (b *builder) listener(lb string, port int) *Listener {
+	key := fmt.Sprintf("%s:%d", lb, port)
+	l, ok := b.listeners[key]
+	if !ok {
+		l = &Listener{Key: key, LoadBalancer: lb, Port: port}
+		b.listeners[key] = l
+	}
+
+	return l
+}
+
+// loadBalancer resolves the load balancer attribute attr of r refers to.
+func (b *builder) loadBalancer(r plan.Resource, attr string) string {
+	if arn := r.String(attr); arn != "" {
+		for _, lb := range b.lbs {
+			if lb.String("arn") == arn {
+				return lb.Address
+			}
+		}
+		return arn
+	}
+
+	return b.resolve(plan.References(b.p, r, attr), b.lbs)
+}
+
+// resolve returns the address of the resource among candidates that refs
+// point at. A reference to a module output stands for the only candidate
+// inside that module. Unresolved references yield the first reference.
+func (b *builder) resolve(refs []string, candidates []plan.Resource) string {
+	for _, ref := range refs {
+		for _, c := range candidates {
+			if refersTo(ref, c.Address) {
+				return c.Address
+			}
+		}
+	}
+	for _, ref := range refs {
+		var inside []string
+		for _, c := range candidates {
+			if strings.HasPrefix(c.Address, ref+".") {
+				inside = append(inside, c.Address)
+			}
+		}
+		if len(inside) == 1 {
+			return inside[0]
+		}
+	}
+	if len(refs) > 0 {
+		return refs[0]
+	}
+
+	return "(unknown)"
+}
+
+// refersTo reports whether reference ref, such as aws_lb.this.arn, points
+// at the resource instance address, such as aws_lb.this[0].
+func refersTo(ref, address string) bool {
+	base := address
+	if i := strings.LastIndex(address, "["); i > strings.LastIndex(address, ".") {
+		base = address[:i]
+	}
+	for _, a := range []string{address, base} {
+		if ref == a || strings.HasPrefix(ref, a+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ruleListener returns the listener rule r attaches to.
+func (b *builder) ruleListener(r plan.Resource) *Listener {
+	if arn := r.String("listener_arn"); arn != "" {
+		if l, ok := b.arns[arn]; ok {
+			return l
+		}
+		return b.listener(arn, 0)
+	}
+
+	refs := plan.References(b.p, r, "listener_arn")
+	for _, ref := range refs {
+		for _, l := range b.created {
+			if refersTo(ref, l.Address) {
+				return l
+			}
+		}
+	}
+	for _, ref := range refs {
+		if data, ok := dataListener(ref); ok {
+			port := 0
+			if v, ok := plan.Constant(b.p, data, "port"); ok {
+				if f, ok := v.(float64); ok {
+					port = int(f)
+				}
+			}
+			return b.listener(b.resolve(plan.References(b.p, data, "load_balancer_arn"), b.lbs), port)
+		}
+	}
+
+	return b.listener(b.resolve(refs, nil), 0)
+}
+
+// dataListener parses a reference to a data "aws_lb_listener" lookup.
+func dataListener(ref string) (plan.Resource, bool) {
+	for _, typ := range listenerTypes {
+		marker := "data." + typ + "."
+		module, rest, ok := strings.Cut(ref, marker)
+		if !ok {
+			continue
+		}
+		if module != "" && !strings.HasSuffix(module, ".") {
+			continue
+		}
+		name := rest
+		if i := strings.IndexAny(rest, ".["); i >= 0 {
+			name = rest[:i]
+		}
+		return plan.Resource{ModuleAddress: strings.TrimSuffix(module, "."), Mode: "data", Type: typ, Name: name}, true
+	}
+
+	return plan.Resource{}, false
+}
+
+// action returns the final action of the action blocks of r.
+func (b *builder) action(r plan.Resource, blocks []map[string]interface{}, attr string) *Action {
+	var last map[string]interface{}
+	for _, block := range blocks {
+		switch (plan.Resource{Values: block}).String("type") {
+		case Forward, Redirect, FixedResponse:
+			last = block
+		}
+	}
+	if last == nil {
+		return nil
+	}
+	ar := plan.Resource{Values: last}
+	a := &Action{Type: ar.String("type")}
+	switch a.Type {
+	case Forward:
+		if arn := ar.String("target_group_arn"); arn != "" {
+			a.TargetGroups = append(a.TargetGroups, b.targetGroup(arn))
+		}
+		for _, f := range ar.Blocks("forward") {
+			for _, tg := range (plan.Resource{Values: f}).Blocks("target_group") {
+				if arn := (plan.Resource{Values: tg}).String("arn"); arn != "" {
+					a.TargetGroups = append(a.TargetGroups, b.targetGroup(arn))
+				}
+			}
+		}
+		if len(a.TargetGroups) == 0 {
+			a.TargetGroups = []string{b.targetGroupRef(r, attr)}
+		}
+	case Redirect:
+		var block map[string]interface{}
+		if blocks := ar.Blocks("redirect"); len(blocks) > 0 {
+			block = blocks[0]
+		}
+		a.Redirect = &RedirectConfig{
+			Protocol:   value(block, "protocol", "#{protocol}"),
+			Port:       value(block, "port", "#{port}"),
+			Host:       value(block, "host", "#{host}"),
+			Path:       value(block, "path", "/#{path}"),
+			Query:      value(block, "query", "#{query}"),
+			StatusCode: value(block, "status_code", ""),
+		}
+	case FixedResponse:
+		a.Fixed = &FixedResponseConfig{}
+		if blocks := ar.Blocks("fixed_response"); len(blocks) > 0 {
+			fr := plan.Resource{Values: blocks[0]}
+			a.Fixed = &FixedResponseConfig{ContentType: fr.String("content_type"), MessageBody: fr.String("message_body"), StatusCode: fr.String("status_code")}
+		}
+	}
+
+	return a
+}
+
+func (b *builder) targetGroup(arn string) string {
+	for _, tg := range b.tgs {
+		if tg.String("arn") == arn {
+			return tg.Address
+		}
+	}
+
+	return arn
+}
+
+// targetGroupRef resolves an unknown target_group_arn through the
+// configuration. A rule created per target group with for_each picks the
+// target group of the same key.
+func (b *builder) targetGroupRef(r plan.Resource, attr string) string {
+	refs := plan.References(b.p, r, attr+".target_group_arn")
+	address := b.resolve(refs, b.tgs)
+	if key, ok := r.Index.(string); ok {
+		for _, ref := range refs {
+			for _, tg := range b.tgs {
+				if tg.Address == fmt.Sprintf("%s[%q]", ref, key) {
+					return tg.Address
+				}
+			}
+		}
+	}
+
+	return address
+}
+
+// value returns the string attribute key of block, or def when the block
+// does not set it. Unlike a missing attribute, "" is kept.
+func value(block map[string]interface{}, key, def string) string {
+	if v, ok := block[key].(string); ok {
+		return v
+	}
+
+	return def
+}
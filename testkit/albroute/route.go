@@ -0,0 +1,333 @@
+package albroute
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+// Condition types, as the condition blocks of aws_lb_listener_rule name
+// them.
+const (
+	HostHeader        = "host_header"
+	PathPattern       = "path_pattern"
+	HTTPHeader        = "http_header"
+	HTTPRequestMethod = "http_request_method"
+	QueryString       = "query_string"
+	SourceIP          = "source_ip"
+)
+
+// Condition is one condition of a rule. A rule matches when all its
+// conditions do, and a condition matches when any of its values does.
+type Condition struct {
+	Type string
+	// Header is the header name of an http_header condition.
+	Header string
+	// Values are the patterns of the condition. For query_string they
+	// are key=value pairs, where an empty key matches any key.
+	Values []string
+	// Unknown is set when the values are known only after apply.
+	Unknown bool
+}
+
+func (c Condition) String() string {
+	if c.Unknown {
+		return c.Type + " (known after apply)"
+	}
+	name := strings.ReplaceAll(c.Type, "_", " ")
+	if c.Type == HTTPHeader {
+		name = "header " + c.Header
+	}
+
+	return name + " " + strings.Join(c.Values, " or ")
+}
+
+func conditions(r plan.Resource) []Condition {
+	var out []Condition
+	for i, block := range r.Blocks("condition") {
+		br := plan.Resource{Values: block}
+		for _, typ := range []string{HostHeader, PathPattern, HTTPHeader, HTTPRequestMethod, QueryString, SourceIP} {
+			sub := br.Blocks(typ)
+			if len(sub) == 0 {
+				continue
+			}
+			sr := plan.Resource{Values: sub[0]}
+			c := Condition{Type: typ}
+			switch typ {
+			case HTTPHeader:
+				c.Header, c.Values = sr.String("http_header_name"), sr.Strings("values")
+			case QueryString:
+				for _, kv := range sub {
+					kr := plan.Resource{Values: kv}
+					c.Values = append(c.Values, kr.String("key")+"="+kr.String("value"))
+				}
+			default:
+				c.Values = sr.Strings("values")
+			}
+			if len(c.Values) == 0 {
+				c.Unknown = unknownCondition(r, i)
+			}
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
+
+// unknownCondition reports whether condition block i of r is known only
+// after apply.
+func unknownCondition(r plan.Resource, i int) bool {
+	if r.IsUnknown("condition") {
+		return true
+	}
+	blocks, _ := r.Unknown["condition"].([]interface{})
+
+	return i < len(blocks) && blocks[i] != nil && blocks[i] != false
+}
+
+// Request is an HTTP request arriving at a listener.
+type Request struct {
+	// Protocol is "https" or "http"; it defaults to the listener's.
+	Protocol string
+	// Host may include a port, which is ignored when matching.
+	Host string
+	// Port defaults to the listener port.
+	Port     int
+	Method   string
+	Path     string
+	Query    string
+	Headers  map[string][]string
+	SourceIP string
+}
+
+// ParseRequest returns a GET request for rawURL.
+func ParseRequest(rawURL string) (Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Request{}, err
+	}
+	if u.Host == "" {
+		return Request{}, fmt.Errorf("request URL %q has no host", rawURL)
+	}
+	req := Request{Protocol: u.Scheme, Host: u.Hostname(), Method: "GET", Path: u.EscapedPath(), Query: u.RawQuery}
+	if req.Path == "" {
+		req.Path = "/"
+	}
+	if port := u.Port(); port != "" {
+		req.Port, _ = strconv.Atoi(port)
+	}
+
+	return req, nil
+}
+
+// Result is where a listener sends a request.
+type Result struct {
+	// Rule is the matching rule, nil when the default action applies.
+	Rule   *Rule
+	Action *Action
+	// Location is the expanded Location header of a redirect.
+	Location string
+}
+
+func (r Result) String() string {
+	rule := "default"
+	if r.Rule != nil {
+		rule = r.Rule.Address
+	}
+	if r.Action != nil && r.Action.Type == Redirect {
+		return fmt.Sprintf("%s: redirect %s to %s", rule, r.Action.Redirect.StatusCode, r.Location)
+	}
+
+	return fmt.Sprintf("%s: %s", rule, r.Action)
+}
+
+// Route evaluates the rules of l in order and returns the first that
+// matches req, or the default action.
+func (l *Listener) Route(req Request) Result {
+	req = l.normalize(req)
+	for _, rule := range l.Rules {
+		if rule.Matches(req) {
+			return l.result(rule, rule.Action, req)
+		}
+	}
+
+	return l.result(nil, l.Default, req)
+}
+
+func (l *Listener) normalize(req Request) Request {
+	if req.Protocol == "" {
+		req.Protocol = strings.ToLower(l.Protocol)
+		if req.Protocol == "" {
+			req.Protocol = "https"
+		}
+	}
+	if req.Port == 0 {
+		req.Port = l.Port
+	}
+	if req.Method == "" {
+		req.Method = "GET"
+	}
+	if req.Path == "" {
+		req.Path = "/"
+	}
+	if h, _, err := net.SplitHostPort(req.Host); err == nil {
+		req.Host = h
+	}
+
+	return req
+}
+
+func (l *Listener) result(rule *Rule, a *Action, req Request) Result {
+	res := Result{Rule: rule, Action: a}
+	if a != nil && a.Type == Redirect {
+		res.Location = a.Redirect.Location(req)
+	}
+
+	return res
+}
+
+// Matches reports whether every condition of r matches req. Conditions
+// known only after apply never match.
+func (r *Rule) Matches(req Request) bool {
+	for _, c := range r.Conditions {
+		if !c.Matches(req) {
+			return false
+		}
+	}
+
+	return len(r.Conditions) > 0
+}
+
+// Matches reports whether req satisfies the condition.
+func (c Condition) Matches(req Request) bool {
+	if c.Unknown {
+		return false
+	}
+	switch c.Type {
+	case HostHeader:
+		return anyMatch(c.Values, req.Host, true)
+	case PathPattern:
+		return anyMatch(c.Values, req.Path, false)
+	case HTTPRequestMethod:
+		for _, m := range c.Values {
+			if m == req.Method {
+				return true
+			}
+		}
+	case HTTPHeader:
+		for name, values := range req.Headers {
+			if !strings.EqualFold(name, c.Header) {
+				continue
+			}
+			for _, v := range values {
+				if anyMatch(c.Values, v, true) {
+					return true
+				}
+			}
+		}
+	case QueryString:
+		query, _ := url.ParseQuery(req.Query)
+		for _, kv := range c.Values {
+			key, value, _ := strings.Cut(kv, "=")
+			for k, vs := range query {
+				if key != "" && !wildcard(key, k, true) {
+					continue
+				}
+				for _, v := range vs {
+					if wildcard(value, v, true) {
+						return true
+					}
+				}
+			}
+		}
+	case SourceIP:
+		ip := net.ParseIP(req.SourceIP)
+		for _, cidr := range c.Values {
+			if _, n, err := net.ParseCIDR(cidr); err == nil && ip != nil && n.Contains(ip) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func anyMatch(patterns []string, s string, fold bool) bool {
+	for _, p := range patterns {
+		if wildcard(p, s, fold) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// wildcard matches s against pattern, where * matches any run of
+// characters and ? exactly one.
+func wildcard(pattern, s string, fold bool) bool {
+	if fold {
+		pattern, s = strings.ToLower(pattern), strings.ToLower(s)
+	}
+	p, t := []rune(pattern), []rune(s)
+	star, mark := -1, 0
+	i, j := 0, 0
+	for j < len(t) {
+		switch {
+		case i < len(p) && (p[i] == '?' || p[i] == t[j]):
+			i++
+			j++
+		case i < len(p) && p[i] == '*':
+			star, mark = i, j
+			i++
+		case star >= 0:
+			i = star + 1
+			mark++
+			j = mark
+		default:
+			return false
+		}
+	}
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+
+	return i == len(p)
+}
+
+func hasWildcard(s string) bool { return strings.ContainsAny(s, "*?") }
+
+// Location expands the redirect for req into a Location header. The port
+// is left out when it is the default for the protocol.
+func (r *RedirectConfig) Location(req Request) string {
+	path := strings.TrimPrefix(req.Path, "/")
+	expand := func(s string) string {
+		return strings.NewReplacer(
+			"#{protocol}", req.Protocol,
+			"#{host}", req.Host,
+			"#{port}", strconv.Itoa(req.Port),
+			"#{path}", path,
+			"#{query}", req.Query,
+		).Replace(s)
+	}
+
+	protocol := strings.ToLower(expand(r.Protocol))
+	host := expand(r.Host)
+	port := expand(r.Port)
+	if (protocol == "https" && port == "443") || (protocol == "http" && port == "80") {
+		port = ""
+	}
+	loc := protocol + "://" + host
+	if port != "" {
+		loc += ":" + port
+	}
+	loc += expand(r.Path)
+	if q := expand(r.Query); q != "" {
+		loc += "?" + q
+	}
+
+	return loc
+}
@@ -0,0 +1,249 @@
+// Package budgetsim simulates the notifications of an AWS budget. Simulate
+// replays a daily spend series against the notifications of a planned
+// aws_budgets_budget and reports which fire on which day and who they
+// reach; CheckPlan flags notifications that are duplicated, have no
+// subscribers or can never fire, and the solution's warning and critical
+// thresholds when they are out of order.
+package budgetsim
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+// Rule identifiers reported by CheckPlan.
+const (
+	RuleLimit         = "budget-limit"
+	RuleDuplicate     = "budget-notification-duplicate"
+	RuleNoSubscribers = "budget-notification-no-subscribers"
+	RuleUnreachable   = "budget-threshold-unreachable"
+	RuleOrder         = "budget-threshold-order"
+)
+
+// ResourceType is the Terraform type of a budget.
+const ResourceType = "aws_budgets_budget"
+
+// Notification types, threshold types and comparison operators.
+const (
+	Actual     = "ACTUAL"
+	Forecasted = "FORECASTED"
+
+	Percentage    = "PERCENTAGE"
+	AbsoluteValue = "ABSOLUTE_VALUE"
+
+	GreaterThan = "GREATER_THAN"
+	LessThan    = "LESS_THAN"
+	EqualTo     = "EQUAL_TO"
+)
+
+// unknownTopic stands for an SNS subscriber known only after apply.
+const unknownTopic = "(known after apply)"
+
+// Notification is a notification block of a budget.
+type Notification struct {
+	ComparisonOperator string
+	Threshold          float64
+	ThresholdType      string
+	NotificationType   string
+	Emails             []string
+	// Topics holds the SNS topic ARNs, or "(known after apply)".
+	Topics []string
+}
+
+// Subscribers returns the subscribers as email:address and sns:arn.
+func (n Notification) Subscribers() []string {
+	var out []string
+	for _, e := range n.Emails {
+		out = append(out, "email:"+e)
+	}
+	for _, t := range n.Topics {
+		out = append(out, "sns:"+t)
+	}
+
+	return out
+}
+
+// Amount returns the spend the notification compares against for a
+// budget limit.
+func (n Notification) Amount(limit float64) float64 {
+	if n.ThresholdType == Percentage {
+		return limit * n.Threshold / 100
+	}
+
+	return n.Threshold
+}
+
+func (n Notification) String() string {
+	unit := ""
+	if n.ThresholdType == Percentage {
+		unit = "%"
+	}
+
+	return fmt.Sprintf("%s %s %g%s", n.NotificationType, n.ComparisonOperator, n.Threshold, unit)
+}
+
+// Budget is a planned aws_budgets_budget.
+type Budget struct {
+	Address    string
+	Name       string
+	BudgetType string
+	// Limit is limit_amount; NaN when it is not a number or not known.
+	Limit     float64
+	LimitUnit string
+	TimeUnit  string
+
+	Notifications []Notification
+}
+
+// FromPlan returns every budget in p.
+func FromPlan(p *tfjson.Plan) []Budget {
+	var out []Budget
+	for _, r := range plan.ResourcesOfType(p, ResourceType) {
+		b := Budget{
+			Address:    r.Address,
+			Name:       r.String("name"),
+			BudgetType: r.String("budget_type"),
+			Limit:      math.NaN(),
+			LimitUnit:  r.String("limit_unit"),
+			TimeUnit:   r.String("time_unit"),
+		}
+		if f, err := strconv.ParseFloat(r.String("limit_amount"), 64); err == nil {
+			b.Limit = f
+		}
+		for i, n := range r.Blocks("notification") {
+			nr := plan.Resource{Values: n}
+			b.Notifications = append(b.Notifications, Notification{
+				ComparisonOperator: nr.String("comparison_operator"),
+				Threshold:          nr.Number("threshold"),
+				ThresholdType:      nr.String("threshold_type"),
+				NotificationType:   nr.String("notification_type"),
+				Emails:             nr.Strings("subscriber_email_addresses"),
+				Topics:             topics(r, nr, i),
+			})
+		}
+		out = append(out, b)
+	}
+
+	return out
+}
+
+// topics returns the SNS subscribers of notification i of r.
+func topics(r plan.Resource, n plan.Resource, i int) []string {
+	arns := n.Strings("subscriber_sns_topic_arns")
+	blocks, _ := r.Unknown["notification"].([]interface{})
+	if i >= len(blocks) {
+		return arns
+	}
+	u, _ := blocks[i].(map[string]interface{})
+	switch v := u["subscriber_sns_topic_arns"].(type) {
+	case bool:
+		if v {
+			return []string{unknownTopic}
+		}
+	case []interface{}:
+		for _, e := range v {
+			if b, _ := e.(bool); b {
+				arns = append(arns, unknownTopic)
+			}
+		}
+	}
+
+	return arns
+}
+
+// boundedTypes are the budget types that measure a percentage, which
+// cannot go above 100.
+var boundedTypes = map[string]bool{
+	"RI_UTILIZATION":            true,
+	"RI_COVERAGE":               true,
+	"SAVINGS_PLANS_UTILIZATION": true,
+	"SAVINGS_PLANS_COVERAGE":    true,
+}
+
+// Check validates the notifications of a budget.
+func Check(b Budget) finding.List {
+	var findings finding.List
+	add := func(s finding.Severity, rule, path, format string, args ...interface{}) {
+		findings = append(findings, finding.Finding{Severity: s, Rule: rule, Address: b.Address, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !math.IsNaN(b.Limit) && b.Limit <= 0 {
+		add(finding.High, RuleLimit, "limit_amount", "limit_amount must be positive, not %g", b.Limit)
+	}
+
+	seen := map[string]int{}
+	for i, n := range b.Notifications {
+		path := fmt.Sprintf("notification[%d]", i)
+		key := n.NotificationType + "/" + n.ComparisonOperator + "/" + n.ThresholdType + "/" + strconv.FormatFloat(n.Threshold, 'g', -1, 64)
+		if j, ok := seen[key]; ok {
+			add(finding.High, RuleDuplicate, path, "notification %s repeats notification[%d]; AWS rejects duplicate notifications", n, j)
+		}
+		seen[key] = i
+		if len(n.Emails)+len(n.Topics) == 0 {
+			add(finding.High, RuleNoSubscribers, path, "notification %s has no subscribers", n)
+		}
+		if n.Threshold < 0 {
+			add(finding.High, RuleUnreachable, path+".threshold", "notification %s has a negative threshold", n)
+			continue
+		}
+
+		// What the budget measures: spend for COST and USAGE budgets, a
+		// percentage between 0 and 100 for the others.
+		amount, max := math.NaN(), math.Inf(1)
+		if boundedTypes[b.BudgetType] {
+			amount, max = n.Threshold, 100
+		} else {
+			amount = n.Amount(b.Limit)
+		}
+		if math.IsNaN(amount) {
+			continue
+		}
+		switch {
+		case n.ComparisonOperator == GreaterThan && amount >= max:
+			add(finding.High, RuleUnreachable, path+".threshold", "%s budgets never exceed 100%%, so notification %s can never fire", b.BudgetType, n)
+		case n.ComparisonOperator == LessThan && amount <= 0:
+			add(finding.High, RuleUnreachable, path+".threshold", "spend is never below zero, so notification %s can never fire", n)
+		case n.ComparisonOperator == EqualTo:
+			add(finding.Medium, RuleUnreachable, path+".comparison_operator", "notification %s fires only if spend lands exactly on %g; use GREATER_THAN", n, amount)
+		case n.ComparisonOperator == GreaterThan && n.NotificationType == Actual && max == math.Inf(1) && amount > b.Limit:
+			add(finding.Medium, RuleUnreachable, path+".threshold", "notification %s is above limit_amount %g and is never reached while spend stays within the budget", n, b.Limit)
+		}
+	}
+
+	return findings
+}
+
+// thresholdOrder lists solution variables that must increase from left to
+// right.
+var thresholdOrder = [][2]string{
+	{"budget_warning_threshold", "budget_critical_threshold"},
+}
+
+// CheckPlan checks every budget in p, and that the solution's warning
+// threshold is below its critical threshold.
+func CheckPlan(p *tfjson.Plan) finding.List {
+	var findings finding.List
+	for _, b := range FromPlan(p) {
+		findings = append(findings, Check(b)...)
+	}
+
+	for _, pair := range thresholdOrder {
+		lo, okLo := plan.Variable(p, pair[0])
+		hi, okHi := plan.Variable(p, pair[1])
+		l, isNumLo := lo.(float64)
+		h, isNumHi := hi.(float64)
+		if okLo && okHi && isNumLo && isNumHi && l >= h {
+			findings = append(findings, finding.Finding{Severity: finding.High, Rule: RuleOrder, Path: "var." + pair[0],
+				Message: fmt.Sprintf("%s (%g) must be below %s (%g), or the critical alert fires first", pair[0], l, pair[1], h)})
+		}
+	}
+	findings.Sort()
+
+	return findings
+}
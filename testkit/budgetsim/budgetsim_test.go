@@ -0,0 +1,194 @@
+package budgetsim
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/alarm"
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan/plantest"
+)
+
+var may = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+// spend returns $30 a day for the first ten days of May and $60 a day
+// after that, $1,560 over the month.
+func spend(days int) alarm.Series {
+	var values []float64
+	for d := 0; d < days; d++ {
+		v := 30.0
+		if d >= 10 {
+			v = 60
+		}
+		values = append(values, v)
+	}
+
+	return alarm.Every(may.Add(9*time.Hour), 24*time.Hour, values...)
+}
+
+func loadBudgets(t *testing.T) (cost, tokens Budget) {
+	t.Helper()
+	p, err := plan.Load("testdata/plan.json")
+	require.NoError(t, err)
+	require.Empty(t, CheckPlan(p), CheckPlan(p).String())
+	for _, b := range FromPlan(p) {
+		switch b.BudgetType {
+		case "COST":
+			cost = b
+		case "USAGE":
+			tokens = b
+		}
+	}
+	require.Len(t, cost.Notifications, 3)
+	require.Len(t, tokens.Notifications, 1)
+
+	return cost, tokens
+}
+
+func TestFromPlan(t *testing.T) {
+	cost, tokens := loadBudgets(t)
+	assert.Equal(t, "bedrock-ai-services-budget-dev", cost.Name)
+	assert.Equal(t, 1000.0, cost.Limit)
+	assert.Equal(t, 1e6, tokens.Limit)
+	assert.Equal(t, []string{"email:finops-lead@company.com", "email:cto@company.com", "sns:(known after apply)"}, cost.Notifications[1].Subscribers())
+	assert.Equal(t, "FORECASTED GREATER_THAN 100%", cost.Notifications[2].String())
+}
+
+func TestSimulate(t *testing.T) {
+	cost, _ := loadBudgets(t)
+	res, err := Simulate(cost, spend(31), may)
+	require.NoError(t, err)
+	require.Len(t, res.Days, 31)
+	assert.InDelta(t, 1560, res.Days[30].Actual, 1e-9)
+	assert.True(t, math.IsNaN(res.Days[1].Forecast), "no forecast on day 2")
+	assert.InDelta(t, 930, res.Days[2].Forecast, 1e-9)
+	t.Log("\n" + res.Table())
+
+	// The run rate crosses $1,000 on day 11, before actual spend passes
+	// the $500 warning (day 14) and the $800 critical threshold (day 19).
+	tests := []struct {
+		notification int
+		day          int
+		value        float64
+	}{
+		{2, 11, 360.0 / 11 * 31},
+		{0, 14, 540},
+		{1, 19, 840},
+	}
+	require.Len(t, res.Events, len(tests))
+	for i, tt := range tests {
+		e := res.Events[i]
+		assert.Equal(t, tt.notification, e.Notification)
+		assert.Equal(t, tt.day, e.Day, "notification %d", tt.notification)
+		assert.Equal(t, may.AddDate(0, 0, tt.day-1), e.Date)
+		assert.InDelta(t, tt.value, e.Value, 1e-9, "notification %d", tt.notification)
+	}
+
+	assert.Equal(t, []string{"email:finops-team@company.com", "sns:(known after apply)"}, res.Recipients(14))
+	assert.Empty(t, res.Recipients(15))
+	assert.Regexp(t, `19\s+2024-05-19\s+ACTUAL GREATER_THAN 80%\s+800.00\s+840.00\s+email:finops-lead@company.com, email:cto@company.com`, res.Table())
+}
+
+func TestSimulatePartialMonth(t *testing.T) {
+	cost, _ := loadBudgets(t)
+	res, err := Simulate(cost, spend(12), may)
+	require.NoError(t, err)
+	assert.Len(t, res.Days, 12)
+	_, ok := res.Fired(0)
+	assert.False(t, ok, "warning has not fired by day 12")
+	e, ok := res.Fired(2)
+	require.True(t, ok)
+	assert.Equal(t, 11, e.Day)
+}
+
+func TestSimulateFlatSpend(t *testing.T) {
+	cost, _ := loadBudgets(t)
+	cost.Notifications = append(cost.Notifications,
+		Notification{ComparisonOperator: LessThan, Threshold: 200, ThresholdType: AbsoluteValue, NotificationType: Forecasted, Emails: []string{"a@b.co"}},
+		Notification{ComparisonOperator: EqualTo, Threshold: 60, ThresholdType: AbsoluteValue, NotificationType: Actual, Emails: []string{"a@b.co"}},
+	)
+	// $5 a day forecasts $155 from day 3; nothing else fires, and spend
+	// lands on exactly $60 on day 12.
+	var values []float64
+	for d := 0; d < 31; d++ {
+		values = append(values, 5)
+	}
+	res, err := Simulate(cost, alarm.Every(may, 24*time.Hour, values...), may)
+	require.NoError(t, err)
+	require.Len(t, res.Events, 2)
+	assert.Equal(t, []int{3, 12}, []int{res.Events[0].Day, res.Events[1].Day})
+	assert.Equal(t, []int{3, 4}, []int{res.Events[0].Notification, res.Events[1].Notification})
+}
+
+func TestSimulateErrors(t *testing.T) {
+	cost, _ := loadBudgets(t)
+	cost.TimeUnit = "WEEKLY"
+	_, err := Simulate(cost, spend(3), may)
+	assert.ErrorContains(t, err, `time_unit "WEEKLY"`)
+
+	cost.TimeUnit, cost.Limit = "MONTHLY", math.NaN()
+	_, err = Simulate(cost, spend(3), may)
+	assert.ErrorContains(t, err, "limit_amount is not known")
+}
+
+func TestCheck(t *testing.T) {
+	cost, _ := loadBudgets(t)
+	n := func(op string, threshold float64, tt, nt string) Notification {
+		return Notification{ComparisonOperator: op, Threshold: threshold, ThresholdType: tt, NotificationType: nt, Emails: []string{"finops@company.com"}}
+	}
+	tests := []struct {
+		name   string
+		mutate func(b *Budget)
+		rules  []string
+		sev    finding.Severity
+	}{
+		{"duplicate", func(b *Budget) { b.Notifications[1].Threshold = 50 }, []string{RuleDuplicate}, finding.High},
+		{"no subscribers", func(b *Budget) { b.Notifications[0].Emails, b.Notifications[0].Topics = nil, nil }, []string{RuleNoSubscribers}, finding.High},
+		{"negative", func(b *Budget) { b.Notifications[0].Threshold = -5 }, []string{RuleUnreachable}, finding.High},
+		{"zero limit", func(b *Budget) { b.Limit = 0 }, []string{RuleLimit}, finding.High},
+		{"less than zero", func(b *Budget) { b.Notifications = append(b.Notifications, n(LessThan, 0, AbsoluteValue, Forecasted)) }, []string{RuleUnreachable}, finding.High},
+		{"utilization above 100", func(b *Budget) {
+			b.BudgetType = "RI_UTILIZATION"
+			b.Notifications = []Notification{n(GreaterThan, 100, Percentage, Actual)}
+		}, []string{RuleUnreachable}, finding.High},
+		{"equal to", func(b *Budget) { b.Notifications = append(b.Notifications, n(EqualTo, 500, AbsoluteValue, Actual)) }, []string{RuleUnreachable}, finding.Medium},
+		{"actual above limit", func(b *Budget) {
+			b.Notifications = append(b.Notifications, n(GreaterThan, 1500, AbsoluteValue, Actual))
+		}, []string{RuleUnreachable}, finding.Medium},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := cost
+			b.Notifications = append([]Notification(nil), b.Notifications...)
+			tt.mutate(&b)
+			findings := Check(b)
+			var rules []string
+			for _, f := range findings {
+				assert.Equal(t, tt.sev, f.Severity, f.String())
+				rules = append(rules, f.Rule)
+			}
+			assert.Equal(t, tt.rules, rules, findings.String())
+		})
+	}
+
+	// Forecasts above the limit are how overruns are caught early.
+	b := cost
+	b.Notifications = []Notification{n(GreaterThan, 150, Percentage, Forecasted)}
+	assert.Empty(t, Check(b))
+}
+
+func TestCheckPlanThresholdOrder(t *testing.T) {
+	f := plantest.Load(t, "testdata/plan.json")
+	f["variables"].(map[string]interface{})["budget_warning_threshold"] = map[string]interface{}{"value": 80}
+
+	findings := CheckPlan(f.Plan(t))
+	require.Len(t, findings, 1, findings.String())
+	assert.Equal(t, RuleOrder, findings[0].Rule)
+	assert.Equal(t, "var.budget_warning_threshold", findings[0].Path)
+	assert.Contains(t, findings[0].Message, "budget_warning_threshold (80) must be below budget_critical_threshold (80)")
+}
@@ -0,0 +1,196 @@
+package budgetsim
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/alarm"
+)
+
+// ForecastFromDay is the first day of the period on which the simulator
+// forecasts. Forecasts project the spend to date over the whole period at
+// the average daily rate, so a single expensive first day does not fire
+// every FORECASTED notification.
+const ForecastFromDay = 3
+
+// Day is the state of the budget at the end of a day of the period.
+type Day struct {
+	// Day counts from 1, the first day of the period.
+	Day    int
+	Date   time.Time
+	Actual float64
+	// Forecast is NaN before ForecastFromDay.
+	Forecast float64
+}
+
+// Event is a notification that fired.
+type Event struct {
+	Day  int
+	Date time.Time
+	// Notification is the index of the notification in the budget.
+	Notification int
+	Type         string
+	// Amount is the spend the notification compared against, and Value
+	// the actual or forecasted spend that crossed it.
+	Amount      float64
+	Value       float64
+	Subscribers []string
+}
+
+// Result is the outcome of Simulate.
+type Result struct {
+	Budget Budget
+	Days   []Day
+	Events []Event
+}
+
+// Fired returns the event of notification i, if it fired.
+func (r *Result) Fired(i int) (Event, bool) {
+	for _, e := range r.Events {
+		if e.Notification == i {
+			return e, true
+		}
+	}
+
+	return Event{}, false
+}
+
+// Recipients returns who was notified on day, in notification order.
+func (r *Result) Recipients(day int) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, e := range r.Events {
+		if e.Day != day {
+			continue
+		}
+		for _, s := range e.Subscribers {
+			if !seen[s] {
+				seen[s] = true
+				out = append(out, s)
+			}
+		}
+	}
+
+	return out
+}
+
+// Table renders the events as day, notification, spend and subscriber
+// columns.
+func (r *Result) Table() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tDATE\tNOTIFICATION\tAMOUNT\tVALUE\tSUBSCRIBERS")
+	for _, e := range r.Events {
+		subscribers := "-"
+		if len(e.Subscribers) > 0 {
+			subscribers = strings.Join(e.Subscribers, ", ")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%.2f\t%.2f\t%s\n", e.Day, e.Date.Format("2006-01-02"),
+			r.Budget.Notifications[e.Notification], e.Amount, e.Value, subscribers)
+	}
+	w.Flush()
+
+	return b.String()
+}
+
+// Simulate replays daily spend against the notifications of b for the
+// budget period that starts at start. Samples are summed per UTC day;
+// samples outside the period are ignored. The simulation runs to the last
+// sample or the end of the period, whichever is first. Each notification
+// fires at most once, on the first day its condition holds at the end of
+// the day, as AWS sends one alert per period.
+func Simulate(b Budget, spend alarm.Series, start time.Time) (*Result, error) {
+	if math.IsNaN(b.Limit) && needsLimit(b) {
+		return nil, fmt.Errorf("budget %s: limit_amount is not known", b.Name)
+	}
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	end, err := periodEnd(b.TimeUnit, start)
+	if err != nil {
+		return nil, fmt.Errorf("budget %s: %w", b.Name, err)
+	}
+	length := int(end.Sub(start).Hours() / 24)
+
+	daily := make([]float64, length)
+	last := -1
+	for _, s := range spend {
+		d := int(s.Time.UTC().Sub(start).Hours() / 24)
+		if s.Time.Before(start) || d >= length {
+			continue
+		}
+		daily[d] += s.Value
+		if d > last {
+			last = d
+		}
+	}
+
+	res := &Result{Budget: b}
+	fired := make([]bool, len(b.Notifications))
+	actual := 0.0
+	for d := 0; d <= last; d++ {
+		actual += daily[d]
+		day := Day{Day: d + 1, Date: start.AddDate(0, 0, d), Actual: actual, Forecast: math.NaN()}
+		if day.Day >= ForecastFromDay {
+			day.Forecast = actual / float64(day.Day) * float64(length)
+		}
+		res.Days = append(res.Days, day)
+
+		for i, n := range b.Notifications {
+			value := day.Actual
+			if n.NotificationType == Forecasted {
+				value = day.Forecast
+			}
+			amount := n.Amount(b.Limit)
+			if fired[i] || math.IsNaN(value) || !compare(n.ComparisonOperator, value, amount) {
+				continue
+			}
+			fired[i] = true
+			res.Events = append(res.Events, Event{
+				Day: day.Day, Date: day.Date, Notification: i, Type: n.NotificationType,
+				Amount: amount, Value: value, Subscribers: n.Subscribers(),
+			})
+		}
+	}
+
+	return res, nil
+}
+
+func needsLimit(b Budget) bool {
+	for _, n := range b.Notifications {
+		if n.ThresholdType == Percentage {
+			return true
+		}
+	}
+
+	return false
+}
+
+func periodEnd(timeUnit string, start time.Time) (time.Time, error) {
+	switch timeUnit {
+	case "", "MONTHLY":
+		return start.AddDate(0, 1, 0), nil
+	case "QUARTERLY":
+		return start.AddDate(0, 3, 0), nil
+	case "ANNUALLY":
+		return start.AddDate(1, 0, 0), nil
+	}
+
+	return time.Time{}, fmt.Errorf("time_unit %q cannot be simulated", timeUnit)
+}
+
+// compare applies a comparison operator. Amounts are money or usage, so
+// EQUAL_TO matches to the cent.
+func compare(op string, value, amount float64) bool {
+	switch op {
+	case GreaterThan:
+		return value > amount
+	case LessThan:
+		return value < amount
+	case EqualTo:
+		return math.Abs(value-amount) < 0.005
+	}
+
+	return false
+}
@@ -0,0 +1,110 @@
+package ceexpr
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Uses of an expression, which limit the dimensions and match options it
+// may use.
+const (
+	UseCostExplorer     = "cost-explorer"
+	UseAnomalyMonitor   = "anomaly-monitor"
+	UseAnomalyThreshold = "anomaly-threshold"
+)
+
+// Dimension is one catalog entry.
+type Dimension struct {
+	// Name is how descriptions refer to the dimension.
+	Name string `json:"name"`
+	// Unit prefixes ($) or suffixes (%) the values of numeric dimensions.
+	Unit    string `json:"unit"`
+	Numeric bool   `json:"numeric"`
+}
+
+// Use lists what an expression may contain where it is used. Empty
+// Dimensions and MatchOptions allow everything in the catalog.
+type Use struct {
+	Description    string   `json:"description"`
+	Dimensions     []string `json:"dimensions"`
+	Tags           bool     `json:"tags"`
+	CostCategories bool     `json:"cost_categories"`
+	MatchOptions   []string `json:"match_options"`
+}
+
+// Catalog lists the Cost Explorer dimensions and match options.
+type Catalog struct {
+	MatchOptions []string             `json:"match_options"`
+	Dimensions   map[string]Dimension `json:"dimensions"`
+	Uses         map[string]Use       `json:"uses"`
+	// MonitorDimensions are the values of monitor_dimension a DIMENSIONAL
+	// anomaly monitor accepts.
+	MonitorDimensions []string `json:"monitor_dimensions"`
+	// BudgetFilters maps the cost_filter names of a budget to the
+	// dimension they filter on. TagKeyValue maps to "".
+	BudgetFilters map[string]string `json:"budget_filters"`
+}
+
+//go:embed catalog.json
+var catalogJSON []byte
+
+// DefaultCatalog returns the checked-in catalog. Update catalog.json when
+// Cost Explorer adds dimensions.
+func DefaultCatalog() *Catalog {
+	c, err := ParseCatalog(catalogJSON)
+	if err != nil {
+		panic(err)
+	}
+
+	return c
+}
+
+// ParseCatalog parses a catalog in the catalog.json format.
+func ParseCatalog(data []byte) (*Catalog, error) {
+	var c Catalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parsing dimension catalog: %w", err)
+	}
+	for name, u := range c.Uses {
+		for _, d := range u.Dimensions {
+			if _, ok := c.Dimensions[d]; !ok {
+				return nil, fmt.Errorf("dimension catalog: use %s lists unknown dimension %q", name, d)
+			}
+		}
+		for _, o := range u.MatchOptions {
+			if !contains(c.MatchOptions, o) {
+				return nil, fmt.Errorf("dimension catalog: use %s lists unknown match option %q", name, o)
+			}
+		}
+	}
+	for name, d := range c.BudgetFilters {
+		if _, ok := c.Dimensions[d]; d != "" && !ok {
+			return nil, fmt.Errorf("dimension catalog: budget filter %s maps to unknown dimension %q", name, d)
+		}
+	}
+
+	return &c, nil
+}
+
+// DimensionKeys returns every dimension key, sorted.
+func (c *Catalog) DimensionKeys() []string {
+	keys := make([]string, 0, len(c.Dimensions))
+	for k := range c.Dimensions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,285 @@
+package ceexpr
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan/plantest"
+)
+
+func TestParse(t *testing.T) {
+	e, err := Parse(`{"And": [{"Dimensions": {"Key": "LINKED_ACCOUNT", "Values": ["123456789012"]}}, {"Tags": {"Key": "Project", "Values": ["bedrock"], "MatchOptions": ["EQUALS"]}}]}`)
+	require.NoError(t, err)
+	require.Len(t, e.And, 2)
+	assert.Equal(t, "LINKED_ACCOUNT", e.And[0].Dimensions.Key)
+	assert.Equal(t, `{"And":[{"Dimensions":{"Key":"LINKED_ACCOUNT","Values":["123456789012"]}},{"Tags":{"Key":"Project","Values":["bedrock"],"MatchOptions":["EQUALS"]}}]}`, e.String())
+
+	// The specification the module used to send.
+	_, err = Parse(`{"Dimension": {"Key": "SERVICE", "Values": ["Amazon Bedrock"]}, "Tags": {}}`)
+	assert.ErrorContains(t, err, `unknown field "Dimension"`)
+}
+
+func TestValidate(t *testing.T) {
+	c := DefaultCatalog()
+	tests := []struct {
+		expr  string
+		use   string
+		rules []string
+		path  string
+	}{
+		{`{"Dimensions": {"Key": "SERVICE", "Values": ["Amazon Bedrock"], "MatchOptions": ["EQUALS", "CASE_INSENSITIVE"]}}`, UseCostExplorer, nil, ""},
+		{`{"Not": {"Tags": {"Key": "Team", "MatchOptions": ["ABSENT"]}}}`, UseCostExplorer, nil, ""},
+		{`{"Dimensions": {"Key": "LINKED_ACCOUNT", "Values": ["123456789012"]}}`, UseAnomalyMonitor, nil, ""},
+		{`{"Dimensions": {"Key": "ANOMALY_TOTAL_IMPACT_PERCENTAGE", "Values": ["20"], "MatchOptions": ["GREATER_THAN_OR_EQUAL"]}}`, UseAnomalyThreshold, nil, ""},
+		{`{}`, UseCostExplorer, []string{RuleSyntax}, ""},
+		{`{"Dimensions": {"Key": "SERVICE", "Values": ["x"]}, "Tags": {"Key": "Team", "Values": ["y"]}}`, UseCostExplorer, []string{RuleSyntax}, ""},
+		{`{"And": [{"Dimensions": {"Key": "SERVICE", "Values": ["x"]}}]}`, UseCostExplorer, []string{RuleSyntax}, "And"},
+		{`{"Dimensions": {"Values": ["x"]}}`, UseCostExplorer, []string{RuleSyntax}, "Dimensions.Key"},
+		{`{"Dimensions": {"Key": "SERVICES", "Values": ["x"]}}`, UseCostExplorer, []string{RuleDimension}, "Dimensions.Key"},
+		{`{"Dimensions": {"Key": "SERVICE", "Values": ["Amazon Bedrock"]}}`, UseAnomalyMonitor, []string{RuleDimension}, "Dimensions.Key"},
+		{`{"Tags": {"Key": "Project", "Values": ["bedrock"], "MatchOptions": ["STARTS_WITH"]}}`, UseAnomalyMonitor, []string{RuleMatchOption}, "Tags.MatchOptions"},
+		{`{"Tags": {"Key": "Project", "Values": ["bedrock"], "MatchOptions": ["CASE_SENSITIVE", "CASE_INSENSITIVE"]}}`, UseCostExplorer, []string{RuleMatchOption}, "Tags.MatchOptions"},
+		{`{"Tags": {"Key": "Project", "Values": ["bedrock"], "MatchOptions": ["ABSENT"]}}`, UseCostExplorer, []string{RuleSyntax}, "Tags.Values"},
+		{`{"Tags": {"Key": "Project"}}`, UseCostExplorer, []string{RuleSyntax}, "Tags.Values"},
+		{`{"Tags": {"Key": "Project", "Values": ["x"]}}`, UseAnomalyThreshold, []string{RuleDimension}, "Tags"},
+		{`{"Dimensions": {"Key": "ANOMALY_TOTAL_IMPACT_ABSOLUTE", "Values": ["100"], "MatchOptions": ["LESS_THAN_OR_EQUAL"]}}`, UseAnomalyThreshold, []string{RuleMatchOption}, "Dimensions.MatchOptions"},
+		{`{"Dimensions": {"Key": "ANOMALY_TOTAL_IMPACT_ABSOLUTE", "Values": ["-5"], "MatchOptions": ["GREATER_THAN_OR_EQUAL"]}}`, UseAnomalyThreshold, []string{RuleSyntax}, "Dimensions.Values"},
+		{`{"Dimensions": {"Key": "ANOMALY_TOTAL_IMPACT_ABSOLUTE", "Values": ["10", "20"], "MatchOptions": ["GREATER_THAN_OR_EQUAL"]}}`, UseAnomalyThreshold, []string{RuleSyntax}, "Dimensions.Values"},
+	}
+	for _, tt := range tests {
+		e, err := Parse(tt.expr)
+		require.NoError(t, err, tt.expr)
+		problems := c.Validate(e, tt.use)
+		var rules []string
+		for _, p := range problems {
+			rules = append(rules, p.Rule)
+		}
+		assert.Equal(t, tt.rules, rules, "%s as %s: %v", tt.expr, tt.use, problems)
+		if len(problems) > 0 {
+			assert.Equal(t, tt.path, problems[0].Path, tt.expr)
+		}
+	}
+
+	e, _ := Parse(`{"Dimensions": {"Key": "LINKEDACCOUNT", "Values": ["1"]}}`)
+	assert.Contains(t, c.Validate(e, UseCostExplorer)[0].Message, "did you mean LINKED_ACCOUNT?")
+	assert.Equal(t, RuleSyntax, c.Validate(e, "billing")[0].Rule)
+}
+
+func TestDescribeExpression(t *testing.T) {
+	c := DefaultCatalog()
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`{"Dimensions": {"Key": "SERVICE", "Values": ["Amazon Bedrock"]}}`, `service is "Amazon Bedrock"`},
+		{`{"Tags": {"Key": "Team", "Values": ["ai", "ml"], "MatchOptions": ["CASE_INSENSITIVE"]}}`, `tag Team is one of "ai", "ml" (ignoring case)`},
+		{`{"Not": {"Tags": {"Key": "Team", "MatchOptions": ["ABSENT"]}}}`, `not (tag Team is not set)`},
+		{`{"CostCategories": {"Key": "Unit", "Values": ["r"], "MatchOptions": ["STARTS_WITH"]}}`, `cost category Unit starts with "r"`},
+		{`{"Dimensions": {"Key": "ANOMALY_TOTAL_IMPACT_ABSOLUTE", "Values": ["50"], "MatchOptions": ["GREATER_THAN_OR_EQUAL"]}}`, `total anomaly impact is at least $50`},
+		{`{"Or": [{"Dimensions": {"Key": "ANOMALY_TOTAL_IMPACT_PERCENTAGE", "Values": ["20"], "MatchOptions": ["GREATER_THAN_OR_EQUAL"]}}, {"And": [{"Dimensions": {"Key": "REGION", "Values": ["us-east-1"]}}, {"Tags": {"Key": "Env", "Values": ["prod"]}}]}]}`,
+			`total anomaly impact is at least 20% or (region is "us-east-1" and tag Env is "prod")`},
+	}
+	for _, tt := range tests {
+		e, err := Parse(tt.expr)
+		require.NoError(t, err, tt.expr)
+		assert.Equal(t, tt.want, c.Describe(e))
+	}
+}
+
+func TestFromBlock(t *testing.T) {
+	var block map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+  "and": [
+    {"dimension": [{"key": "ANOMALY_TOTAL_IMPACT_ABSOLUTE", "values": ["100"], "match_options": ["GREATER_THAN_OR_EQUAL"]}]},
+    {"dimension": [{"key": "ANOMALY_TOTAL_IMPACT_PERCENTAGE", "values": ["25"], "match_options": ["GREATER_THAN_OR_EQUAL"]}]}
+  ],
+  "or": [], "not": [], "dimension": [], "tags": [], "cost_category": []
+}`), &block))
+	e := FromBlock(block)
+	assert.Empty(t, DefaultCatalog().Validate(e, UseAnomalyThreshold))
+	assert.Equal(t, "total anomaly impact is at least $100 and total anomaly impact is at least 25%", DefaultCatalog().Describe(e))
+}
+
+func TestParseCatalog(t *testing.T) {
+	_, err := ParseCatalog([]byte(`{"dimensions": {}, "uses": {"x": {"dimensions": ["SERVICE"]}}}`))
+	assert.ErrorContains(t, err, `use x lists unknown dimension "SERVICE"`)
+	_, err = ParseCatalog([]byte(`{"dimensions": {}, "budget_filters": {"Service": "SERVICE"}}`))
+	assert.ErrorContains(t, err, `budget filter Service maps to unknown dimension "SERVICE"`)
+}
+
+const (
+	accountMonitor = "module.account_budget.aws_ce_anomaly_monitor.this[0]"
+	accountEmail   = "module.account_budget.aws_ce_anomaly_subscription.this[0]"
+	accountSNS     = "module.account_budget.aws_ce_anomaly_subscription.sns[0]"
+	computeBudget  = "module.compute_budget.aws_budgets_budget.this[0]"
+)
+
+// The fixtures are plans of the aws-budget module's simple and complete
+// examples.
+var examples = []string{"testdata/simple.json", "testdata/complete.json"}
+
+func TestCheckPlan(t *testing.T) {
+	for _, path := range examples {
+		findings := CheckPlan(plantest.Load(t, path).Plan(t))
+		assert.Empty(t, findings, "%s: %s", path, findings.String())
+	}
+
+	tests := []struct {
+		name   string
+		breaks func(t *testing.T, f plantest.Fixture)
+		want   []plantest.Expected
+	}{
+		{
+			name: "legacy specification",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				v := f.Values(t, accountMonitor)
+				v["monitor_type"], v["monitor_dimension"] = "CUSTOM", nil
+				v["monitor_specification"] = `{"Dimension":{"Key":"SERVICE","Values":["Amazon Bedrock"],"MatchOptions":["EQUALS"]},"Tags":{}}`
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleSyntax, accountMonitor)},
+		},
+		{
+			name: "custom monitor on a service",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				v := f.Values(t, accountMonitor)
+				v["monitor_type"], v["monitor_dimension"] = "CUSTOM", nil
+				v["monitor_specification"] = `{"Dimensions":{"Key":"SERVICE","Values":["Amazon Bedrock"],"MatchOptions":["EQUALS"]}}`
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleDimension, accountMonitor)},
+		},
+		{
+			name: "custom monitor without specification",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				v := f.Values(t, accountMonitor)
+				v["monitor_type"], v["monitor_dimension"] = "CUSTOM", nil
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleMonitor, accountMonitor)},
+		},
+		{
+			name: "dimensional monitor with specification",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				v := f.Values(t, accountMonitor)
+				v["monitor_dimension"] = "LINKED_ACCOUNT"
+				v["monitor_specification"] = `{"Tags":{"Key":"Project","Values":["bedrock"]}}`
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleMonitor, accountMonitor), plantest.Want(finding.High, RuleMonitor, accountMonitor)},
+		},
+		{
+			name: "immediate email",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, accountEmail)["frequency"] = "IMMEDIATE"
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleSubscription, accountEmail)},
+		},
+		{
+			name: "daily SNS",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, accountSNS)["frequency"] = "DAILY"
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleSubscription, accountSNS)},
+		},
+		{
+			name: "no subscribers or threshold",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				v := f.Values(t, accountEmail)
+				v["subscriber"], v["threshold_expression"] = []interface{}{}, []interface{}{}
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleSubscription, accountEmail), plantest.Want(finding.High, RuleSubscription, accountEmail)},
+		},
+		{
+			name: "threshold below",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				te := f.Values(t, accountEmail)["threshold_expression"].([]interface{})[0].(map[string]interface{})
+				te["dimension"].([]interface{})[0].(map[string]interface{})["match_options"] = []interface{}{"LESS_THAN_OR_EQUAL"}
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleMatchOption, accountEmail)},
+		},
+		{
+			name: "old cost filter names",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				filters := f.Values(t, computeBudget)["cost_filter"].([]interface{})
+				filters[0].(map[string]interface{})["name"] = "REGION"
+				filters[2].(map[string]interface{})["name"] = "TAG"
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleCostFilter, computeBudget), plantest.Want(finding.High, RuleCostFilter, computeBudget)},
+		},
+		{
+			name: "raw tag value",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				filters := f.Values(t, computeBudget)["cost_filter"].([]interface{})
+				filters[2].(map[string]interface{})["values"] = []interface{}{"prod"}
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleCostFilter, computeBudget)},
+		},
+		{
+			name: "escaped tag interpolation",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				filters := f.Values(t, computeBudget)["cost_filter"].([]interface{})
+				filters[2].(map[string]interface{})["values"] = []interface{}{"user:Environment${value}"}
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleCostFilter, computeBudget)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := plantest.Load(t, "testdata/complete.json")
+			tt.breaks(t, f)
+			findings := CheckPlan(f.Plan(t))
+			plantest.AssertFindings(t, tt.want, findings)
+		})
+	}
+
+	f := plantest.Load(t, "testdata/complete.json")
+	f.Values(t, computeBudget)["cost_filter"].([]interface{})[0].(map[string]interface{})["name"] = "REGION"
+	findings := CheckPlan(f.Plan(t))
+	require.Len(t, findings, 1)
+	assert.Equal(t, "cost_filter[0].name", findings[0].Path)
+	assert.Contains(t, findings[0].Message, "did you mean Region?")
+}
+
+func TestDescribe(t *testing.T) {
+	want := map[string][]string{
+		"testdata/simple.json": {
+			"monitor bedrock-ai-budget-anomaly-detector: each AWS service separately",
+			"subscription bedrock-ai-budget-anomaly-subscription: daily alerts to email:admin@company.com when total anomaly impact is at least $50 on bedrock-ai-budget-anomaly-detector",
+			`budget bedrock-ai-budget: costs where service is "Amazon Bedrock"`,
+			"budget monthly-spending-budget: all costs",
+		},
+		"testdata/complete.json": {
+			"monitor total-account-budget-prod-anomaly-detector: each AWS service separately",
+			"monitor ai-ml-services-budget-prod-anomaly-detector: each AWS service separately",
+			"monitor production-environment-budget-anomaly-detector: each AWS service separately",
+			"subscription total-account-budget-prod-anomaly-sns-subscription: immediate alerts to sns:(known after apply) when total anomaly impact is at least $200 on total-account-budget-prod-anomaly-detector",
+			"subscription total-account-budget-prod-anomaly-subscription: daily alerts to email:ops-team@company.com when total anomaly impact is at least $200 on total-account-budget-prod-anomaly-detector",
+			"subscription ai-ml-services-budget-prod-anomaly-subscription: daily alerts to email:ai-team@company.com when total anomaly impact is at least $100 on ai-ml-services-budget-prod-anomaly-detector",
+			"subscription production-environment-budget-anomaly-subscription: daily alerts to email:ops-team@company.com when total anomaly impact is at least $200 on production-environment-budget-anomaly-detector",
+			"budget total-account-budget-prod: all costs",
+			`budget ai-ml-services-budget-prod: costs where service is one of "Amazon Bedrock", "Amazon SageMaker", "Amazon Comprehend", "Amazon Textract", "Amazon Rekognition", "Amazon Translate", "Amazon Transcribe", "Amazon Polly", "Amazon Lex", "AWS DeepLens"`,
+			`budget compute-services-budget-prod: costs where region is one of "us-east-1", "us-west-2", "eu-west-1" and service is one of "Amazon Elastic Compute Cloud - Compute", "Amazon Elastic Container Service", "AWS Lambda", "AWS Fargate" and tag Environment is "prod"`,
+			`budget database-services-budget-prod: costs where service is one of "Amazon Relational Database Service", "Amazon DynamoDB", "Amazon ElastiCache", "Amazon DocumentDB (with MongoDB compatibility)", "Amazon Neptune"`,
+			`budget development-environment-budget: costs where tag Environment is one of "development", "dev", "sandbox"`,
+			`budget ec2-usage-hours-budget-prod: costs where service is "Amazon Elastic Compute Cloud - Compute" and usage type is one of "BoxUsage:t3.micro", "BoxUsage:t3.small", "BoxUsage:t3.medium"`,
+			`budget production-environment-budget: costs where tag Environment is one of "production", "prod"`,
+			`budget storage-services-budget-prod: costs where service is one of "Amazon Simple Storage Service", "Amazon Elastic Block Store", "Amazon Elastic File System"`,
+		},
+	}
+	for _, path := range examples {
+		var got []string
+		for _, d := range Describe(plantest.Load(t, path).Plan(t)) {
+			got = append(got, d.String())
+		}
+		assert.Equal(t, want[path], got, path)
+	}
+
+	f := plantest.Load(t, "testdata/complete.json")
+	v := f.Values(t, accountMonitor)
+	v["monitor_type"], v["monitor_dimension"] = "CUSTOM", nil
+	v["monitor_specification"] = `{"And":[{"Dimensions":{"Key":"LINKED_ACCOUNT","Values":["123456789012"],"MatchOptions":["EQUALS"]}},{"Tags":{"Key":"Project","Values":["bedrock"],"MatchOptions":["EQUALS"]}}]}`
+	d := Describe(f.Plan(t))[0]
+	assert.Equal(t, accountMonitor, d.Address)
+	assert.Equal(t, `costs where linked account is "123456789012" and tag Project is "bedrock"`, d.Text)
+}
@@ -0,0 +1,274 @@
+package ceexpr
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/internal/hint"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+// Rule identifiers reported by Validate and CheckPlan.
+const (
+	RuleSyntax       = "ce-expression-syntax"
+	RuleDimension    = "ce-expression-dimension"
+	RuleMatchOption  = "ce-expression-match-option"
+	RuleMonitor      = "ce-anomaly-monitor"
+	RuleSubscription = "ce-anomaly-subscription"
+	RuleCostFilter   = "budget-cost-filter"
+	RuleUnknown      = "ce-expression-unknown"
+)
+
+// Resource types read from a plan.
+const (
+	MonitorType      = "aws_ce_anomaly_monitor"
+	SubscriptionType = "aws_ce_anomaly_subscription"
+	BudgetType       = "aws_budgets_budget"
+)
+
+// Subscriber types and frequencies of an anomaly subscription.
+const (
+	SubscriberEmail = "EMAIL"
+	SubscriberSNS   = "SNS"
+	Immediate       = "IMMEDIATE"
+)
+
+// tagKeyValue is a TagKeyValue budget filter value, user:<key>$<value> or
+// aws:<key>$<value>.
+var tagKeyValue = regexp.MustCompile(`^((?:user|aws):[^$]+)\$(.*)$`)
+
+// Description says what a monitor, subscription or budget watches.
+type Description struct {
+	Address string
+	// Kind is "monitor", "subscription" or "budget".
+	Kind string
+	Name string
+	Text string
+}
+
+func (d Description) String() string {
+	return fmt.Sprintf("%s %s: %s", d.Kind, d.Name, d.Text)
+}
+
+// CheckPlan validates the anomaly monitors, anomaly subscriptions and
+// budget cost filters in p against the default catalog.
+func CheckPlan(p *tfjson.Plan) finding.List {
+	findings, _ := DefaultCatalog().Plan(p)
+
+	return findings
+}
+
+// Describe returns what every monitor, subscription and budget in p
+// watches, using the default catalog.
+func Describe(p *tfjson.Plan) []Description {
+	_, descriptions := DefaultCatalog().Plan(p)
+
+	return descriptions
+}
+
+// Plan validates and describes the anomaly monitors, anomaly
+// subscriptions and budget cost filters in p.
+func (c *Catalog) Plan(p *tfjson.Plan) (finding.List, []Description) {
+	a := &planner{c: c, p: p}
+	monitors := map[string]string{}
+	for _, r := range plan.ResourcesOfType(p, MonitorType) {
+		a.monitor(r)
+		monitors[r.Address] = r.String("name")
+	}
+	for _, r := range plan.ResourcesOfType(p, SubscriptionType) {
+		a.subscription(r, monitors)
+	}
+	for _, r := range plan.ResourcesOfType(p, BudgetType) {
+		a.budget(r)
+	}
+	a.findings.Sort()
+
+	return a.findings, a.descriptions
+}
+
+type planner struct {
+	c            *Catalog
+	p            *tfjson.Plan
+	findings     finding.List
+	descriptions []Description
+}
+
+func (a *planner) add(s finding.Severity, rule, address, path, format string, args ...interface{}) {
+	a.findings = append(a.findings, finding.Finding{Severity: s, Rule: rule, Address: address, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (a *planner) describe(r plan.Resource, kind, text string) {
+	name := r.String("name")
+	if name == "" {
+		name = r.Address
+	}
+	a.descriptions = append(a.descriptions, Description{Address: r.Address, Kind: kind, Name: name, Text: text})
+}
+
+// problems reports expression problems under attribute path attr.
+func (a *planner) problems(r plan.Resource, attr string, problems []Problem) {
+	for _, pr := range problems {
+		path := attr
+		if pr.Path != "" {
+			path += "." + pr.Path
+		}
+		a.add(finding.High, pr.Rule, r.Address, path, "%s", pr.Message)
+	}
+}
+
+func (a *planner) monitor(r plan.Resource) {
+	spec := r.String("monitor_specification")
+	switch r.String("monitor_type") {
+	case "DIMENSIONAL":
+		dim := r.String("monitor_dimension")
+		if !contains(a.c.MonitorDimensions, dim) {
+			a.add(finding.High, RuleMonitor, r.Address, "monitor_dimension", "a DIMENSIONAL monitor needs monitor_dimension %s, not %q", strings.Join(a.c.MonitorDimensions, " or "), dim)
+		}
+		if spec != "" {
+			a.add(finding.High, RuleMonitor, r.Address, "monitor_specification", "a DIMENSIONAL monitor takes no monitor_specification")
+		}
+		a.describe(r, "monitor", "each AWS "+strings.ToLower(dim)+" separately")
+	case "CUSTOM":
+		if spec == "" {
+			if r.IsUnknown("monitor_specification") {
+				a.add(finding.Low, RuleUnknown, r.Address, "monitor_specification", "monitor_specification is known after apply and was not checked")
+				return
+			}
+			a.add(finding.High, RuleMonitor, r.Address, "monitor_specification", "a CUSTOM monitor needs a monitor_specification")
+			return
+		}
+		e, err := Parse(spec)
+		if err != nil {
+			a.add(finding.High, RuleSyntax, r.Address, "monitor_specification", "%v", err)
+			return
+		}
+		problems := a.c.Validate(e, UseAnomalyMonitor)
+		a.problems(r, "monitor_specification", problems)
+		if len(problems) == 0 {
+			a.describe(r, "monitor", "costs where "+a.c.Describe(e))
+		}
+	default:
+		a.add(finding.High, RuleMonitor, r.Address, "monitor_type", "monitor_type must be DIMENSIONAL or CUSTOM, not %q", r.String("monitor_type"))
+	}
+}
+
+func (a *planner) subscription(r plan.Resource, monitors map[string]string) {
+	frequency := r.String("frequency")
+	var subscribers []string
+	for i, s := range r.Blocks("subscriber") {
+		sr := plan.Resource{Values: s}
+		typ, address := sr.String("type"), sr.String("address")
+		path := fmt.Sprintf("subscriber[%d]", i)
+		switch {
+		case typ == SubscriberEmail && frequency == Immediate:
+			a.add(finding.High, RuleSubscription, r.Address, path, "IMMEDIATE alerts can only go to SNS topics, not email %s", address)
+		case typ == SubscriberSNS && frequency != Immediate:
+			a.add(finding.High, RuleSubscription, r.Address, path, "SNS topics only receive IMMEDIATE alerts, but frequency is %s", frequency)
+		case typ != SubscriberEmail && typ != SubscriberSNS:
+			a.add(finding.High, RuleSubscription, r.Address, path+".type", "subscriber type must be EMAIL or SNS, not %q", typ)
+		}
+		if address == "" {
+			address = "(known after apply)"
+		}
+		subscribers = append(subscribers, strings.ToLower(typ)+":"+address)
+	}
+	if len(subscribers) == 0 {
+		a.add(finding.High, RuleSubscription, r.Address, "subscriber", "subscription has no subscribers")
+	}
+
+	text := ""
+	blocks := r.Blocks("threshold_expression")
+	switch {
+	case len(blocks) > 0:
+		e := FromBlock(blocks[0])
+		problems := a.c.Validate(e, UseAnomalyThreshold)
+		a.problems(r, "threshold_expression", problems)
+		if len(problems) > 0 {
+			return
+		}
+		text = a.c.Describe(e)
+	case r.Number("threshold") > 0:
+		text = fmt.Sprintf("total anomaly impact is at least $%g", r.Number("threshold"))
+	default:
+		a.add(finding.High, RuleSubscription, r.Address, "threshold_expression", "subscription has no threshold_expression")
+		return
+	}
+
+	var names []string
+	for _, ref := range plan.References(a.p, r, "monitor_arn_list") {
+		for address, name := range monitors {
+			if ref == address && !contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	from := "monitors known after apply"
+	if len(names) > 0 {
+		from = strings.Join(names, ", ")
+	}
+	a.describe(r, "subscription", fmt.Sprintf("%s alerts to %s when %s on %s", strings.ToLower(frequency), strings.Join(subscribers, ", "), text, from))
+}
+
+func (a *planner) budget(r plan.Resource) {
+	var filters []Expression
+	tags := map[string][]string{}
+	var tagKeys []string
+	for i, f := range r.Blocks("cost_filter") {
+		fr := plan.Resource{Values: f}
+		name, values := fr.String("name"), fr.Strings("values")
+		path := fmt.Sprintf("cost_filter[%d]", i)
+		dim, ok := a.c.BudgetFilters[name]
+		if !ok {
+			names := make([]string, 0, len(a.c.BudgetFilters))
+			for n := range a.c.BudgetFilters {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			a.add(finding.High, RuleCostFilter, r.Address, path+".name", "%q is not a budget cost filter%s", name, hint.DidYouMean(name, names))
+			continue
+		}
+		if len(values) == 0 {
+			a.add(finding.High, RuleCostFilter, r.Address, path+".values", "cost filter %s has no values", name)
+			continue
+		}
+		if dim != "" {
+			filters = append(filters, Expression{Dimensions: &Values{Key: dim, Values: values}})
+			continue
+		}
+		for _, v := range values {
+			if strings.Contains(v, "${") {
+				// $${ escapes an interpolation, so the template is sent as is.
+				a.add(finding.High, RuleCostFilter, r.Address, path+".values", "TagKeyValue %q holds an uninterpolated ${...}", v)
+				continue
+			}
+			m := tagKeyValue.FindStringSubmatch(v)
+			if m == nil {
+				a.add(finding.High, RuleCostFilter, r.Address, path+".values", "TagKeyValue %q must look like user:<key>$<value>", v)
+				continue
+			}
+			key := strings.TrimPrefix(m[1], "user:")
+			if _, seen := tags[key]; !seen {
+				tagKeys = append(tagKeys, key)
+			}
+			tags[key] = append(tags[key], m[2])
+		}
+	}
+	for _, key := range tagKeys {
+		filters = append(filters, Expression{Tags: &Values{Key: key, Values: tags[key]}})
+	}
+
+	switch len(filters) {
+	case 0:
+		a.describe(r, "budget", "all costs")
+	case 1:
+		a.describe(r, "budget", "costs where "+a.c.Describe(filters[0]))
+	default:
+		a.describe(r, "budget", "costs where "+a.c.Describe(Expression{And: filters}))
+	}
+}
@@ -0,0 +1,379 @@
+// Package ceexpr models the Cost Explorer Expression grammar (And, Or,
+// Not, Dimensions, Tags and CostCategories with MatchOptions) used by the
+// anomaly monitors, anomaly subscriptions and cost filters of aws-budget.
+// Expressions are validated offline against a checked-in catalog of
+// dimensions, and Describe renders what an expression, monitor or
+// subscription watches in plain words.
+package ceexpr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/internal/hint"
+)
+
+// Expression is a Cost Explorer Expression. Exactly one field is set.
+type Expression struct {
+	And            []Expression `json:"And,omitempty"`
+	Or             []Expression `json:"Or,omitempty"`
+	Not            *Expression  `json:"Not,omitempty"`
+	Dimensions     *Values      `json:"Dimensions,omitempty"`
+	Tags           *Values      `json:"Tags,omitempty"`
+	CostCategories *Values      `json:"CostCategories,omitempty"`
+}
+
+// Values is the operand of Dimensions, Tags and CostCategories.
+type Values struct {
+	Key          string   `json:"Key,omitempty"`
+	Values       []string `json:"Values,omitempty"`
+	MatchOptions []string `json:"MatchOptions,omitempty"`
+}
+
+// Match options.
+const (
+	Equals             = "EQUALS"
+	Absent             = "ABSENT"
+	StartsWith         = "STARTS_WITH"
+	EndsWith           = "ENDS_WITH"
+	Contains           = "CONTAINS"
+	CaseSensitive      = "CASE_SENSITIVE"
+	CaseInsensitive    = "CASE_INSENSITIVE"
+	GreaterThanOrEqual = "GREATER_THAN_OR_EQUAL"
+)
+
+// Parse parses an expression in the JSON form of the Cost Explorer API,
+// as in monitor_specification. Unknown fields are an error, so a
+// misspelt "Dimension" does not pass as an empty expression.
+func Parse(data string) (Expression, error) {
+	var e Expression
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&e); err != nil {
+		return Expression{}, fmt.Errorf("expression is not valid: %w", err)
+	}
+
+	return e, nil
+}
+
+// String returns the expression as API JSON.
+func (e Expression) String() string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(e)
+
+	return strings.TrimSpace(b.String())
+}
+
+// FromBlock converts the Terraform block form of an expression, as in the
+// threshold_expression of aws_ce_anomaly_subscription, with and, or, not,
+// dimension, tags and cost_category blocks.
+func FromBlock(block map[string]interface{}) Expression {
+	var e Expression
+	for _, sub := range objects(block["and"]) {
+		e.And = append(e.And, FromBlock(sub))
+	}
+	for _, sub := range objects(block["or"]) {
+		e.Or = append(e.Or, FromBlock(sub))
+	}
+	if not := objects(block["not"]); len(not) > 0 {
+		n := FromBlock(not[0])
+		e.Not = &n
+	}
+	e.Dimensions = valuesBlock(block["dimension"])
+	e.Tags = valuesBlock(block["tags"])
+	e.CostCategories = valuesBlock(block["cost_category"])
+
+	return e
+}
+
+func valuesBlock(v interface{}) *Values {
+	blocks := objects(v)
+	if len(blocks) == 0 {
+		return nil
+	}
+	key, _ := blocks[0]["key"].(string)
+
+	return &Values{Key: key, Values: stringList(blocks[0]["values"]), MatchOptions: stringList(blocks[0]["match_options"])}
+}
+
+func objects(v interface{}) []map[string]interface{} {
+	list, _ := v.([]interface{})
+	var out []map[string]interface{}
+	for _, e := range list {
+		if m, ok := e.(map[string]interface{}); ok {
+			out = append(out, m)
+		}
+	}
+
+	return out
+}
+
+func stringList(v interface{}) []string {
+	list, _ := v.([]interface{})
+	var out []string
+	for _, e := range list {
+		if s, ok := e.(string); ok {
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
+
+// operators returns the names of the fields e sets.
+func (e Expression) operators() []string {
+	var out []string
+	if e.And != nil {
+		out = append(out, "And")
+	}
+	if e.Or != nil {
+		out = append(out, "Or")
+	}
+	if e.Not != nil {
+		out = append(out, "Not")
+	}
+	if e.Dimensions != nil {
+		out = append(out, "Dimensions")
+	}
+	if e.Tags != nil {
+		out = append(out, "Tags")
+	}
+	if e.CostCategories != nil {
+		out = append(out, "CostCategories")
+	}
+
+	return out
+}
+
+// Problem is something wrong with an expression.
+type Problem struct {
+	Rule string
+	// Path locates the offending part, such as And[1].Dimensions.Key.
+	Path    string
+	Message string
+}
+
+func (p Problem) Error() string {
+	if p.Path == "" {
+		return p.Message
+	}
+
+	return p.Path + ": " + p.Message
+}
+
+// Validate checks e for the given use against the catalog.
+func (c *Catalog) Validate(e Expression, use string) []Problem {
+	u, ok := c.Uses[use]
+	if !ok {
+		return []Problem{{Rule: RuleSyntax, Message: fmt.Sprintf("unknown use %q", use)}}
+	}
+	v := &validator{c: c, use: u}
+	v.expr(e, "")
+
+	return v.problems
+}
+
+type validator struct {
+	c        *Catalog
+	use      Use
+	problems []Problem
+}
+
+func (v *validator) add(rule, path, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Rule: rule, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func join(path, field string) string {
+	if path == "" {
+		return field
+	}
+
+	return path + "." + field
+}
+
+func (v *validator) expr(e Expression, path string) {
+	ops := e.operators()
+	switch len(ops) {
+	case 0:
+		v.add(RuleSyntax, path, "expression is empty; set one of And, Or, Not, Dimensions, Tags or CostCategories")
+		return
+	case 1:
+	default:
+		v.add(RuleSyntax, path, "expression sets %s; combine them with And", strings.Join(ops, " and "))
+		return
+	}
+
+	switch {
+	case e.And != nil || e.Or != nil:
+		op, subs := "And", e.And
+		if e.Or != nil {
+			op, subs = "Or", e.Or
+		}
+		if len(subs) < 2 {
+			v.add(RuleSyntax, join(path, op), "%s needs at least two expressions", op)
+		}
+		for i, sub := range subs {
+			v.expr(sub, fmt.Sprintf("%s[%d]", join(path, op), i))
+		}
+	case e.Not != nil:
+		v.expr(*e.Not, join(path, "Not"))
+	case e.Dimensions != nil:
+		v.dimension(*e.Dimensions, join(path, "Dimensions"))
+	case e.Tags != nil:
+		if !v.use.Tags {
+			v.add(RuleDimension, join(path, "Tags"), "a %s cannot filter on tags", v.use.Description)
+		}
+		v.values(*e.Tags, join(path, "Tags"), false)
+	case e.CostCategories != nil:
+		if !v.use.CostCategories {
+			v.add(RuleDimension, join(path, "CostCategories"), "a %s cannot filter on cost categories", v.use.Description)
+		}
+		v.values(*e.CostCategories, join(path, "CostCategories"), false)
+	}
+}
+
+func (v *validator) dimension(d Values, path string) {
+	dim, ok := v.c.Dimensions[d.Key]
+	switch {
+	case d.Key == "":
+		// values reports the missing key.
+	case !ok:
+		v.add(RuleDimension, join(path, "Key"), "%q is not a Cost Explorer dimension%s", d.Key, hint.DidYouMean(d.Key, v.c.DimensionKeys()))
+	case len(v.use.Dimensions) > 0 && !contains(v.use.Dimensions, d.Key):
+		v.add(RuleDimension, join(path, "Key"), "a %s can only use %s, not %s", v.use.Description, strings.Join(v.use.Dimensions, " or "), d.Key)
+	}
+	v.values(d, path, dim.Numeric)
+}
+
+func (v *validator) values(val Values, path string, numeric bool) {
+	if val.Key == "" {
+		v.add(RuleSyntax, join(path, "Key"), "a Key is required")
+	}
+
+	allowed := v.c.MatchOptions
+	if len(v.use.MatchOptions) > 0 {
+		allowed = v.use.MatchOptions
+	}
+	cases := 0
+	for _, o := range val.MatchOptions {
+		switch {
+		case !contains(v.c.MatchOptions, o):
+			v.add(RuleMatchOption, join(path, "MatchOptions"), "%q is not a match option%s", o, hint.DidYouMean(o, v.c.MatchOptions))
+		case !contains(allowed, o):
+			v.add(RuleMatchOption, join(path, "MatchOptions"), "a %s only supports %s, not %s", v.use.Description, strings.Join(allowed, " or "), o)
+		}
+		if o == CaseSensitive || o == CaseInsensitive {
+			cases++
+		}
+	}
+	if cases > 1 {
+		v.add(RuleMatchOption, join(path, "MatchOptions"), "CASE_SENSITIVE and CASE_INSENSITIVE cannot be combined")
+	}
+
+	absent := contains(val.MatchOptions, Absent)
+	switch {
+	case absent && len(val.MatchOptions) > 1:
+		v.add(RuleMatchOption, join(path, "MatchOptions"), "ABSENT cannot be combined with other match options")
+	case absent && len(val.Values) > 0:
+		v.add(RuleSyntax, join(path, "Values"), "ABSENT matches a missing %s and takes no Values", val.Key)
+	case !absent && len(val.Values) == 0:
+		v.add(RuleSyntax, join(path, "Values"), "Values is empty")
+	}
+	if numeric {
+		if len(val.Values) != 1 {
+			v.add(RuleSyntax, join(path, "Values"), "%s takes exactly one value", val.Key)
+		}
+		for _, s := range val.Values {
+			if f, err := strconv.ParseFloat(s, 64); err != nil || f < 0 {
+				v.add(RuleSyntax, join(path, "Values"), "%q is not a non-negative number", s)
+			}
+		}
+	}
+}
+
+// Describe renders e in plain words, for example
+//
+//	service is "Amazon Bedrock" and tag Environment is "prod"
+func (c *Catalog) Describe(e Expression) string {
+	switch {
+	case e.And != nil:
+		return c.describeList(e.And, " and ")
+	case e.Or != nil:
+		return c.describeList(e.Or, " or ")
+	case e.Not != nil:
+		return "not (" + c.Describe(*e.Not) + ")"
+	case e.Dimensions != nil:
+		name, d := strings.ToLower(e.Dimensions.Key), c.Dimensions[e.Dimensions.Key]
+		if d.Name != "" {
+			name = d.Name
+		}
+		return name + " " + describeValues(*e.Dimensions, d)
+	case e.Tags != nil:
+		return "tag " + e.Tags.Key + " " + describeValues(*e.Tags, Dimension{})
+	case e.CostCategories != nil:
+		return "cost category " + e.CostCategories.Key + " " + describeValues(*e.CostCategories, Dimension{})
+	}
+
+	return "(empty expression)"
+}
+
+func (c *Catalog) describeList(list []Expression, sep string) string {
+	parts := make([]string, len(list))
+	for i, sub := range list {
+		parts[i] = c.Describe(sub)
+		if len(sub.And) > 0 || len(sub.Or) > 0 {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+
+	return strings.Join(parts, sep)
+}
+
+func describeValues(v Values, d Dimension) string {
+	if contains(v.MatchOptions, Absent) {
+		return "is not set"
+	}
+
+	verb := "is"
+	switch {
+	case contains(v.MatchOptions, StartsWith):
+		verb = "starts with"
+	case contains(v.MatchOptions, EndsWith):
+		verb = "ends with"
+	case contains(v.MatchOptions, Contains):
+		verb = "contains"
+	case contains(v.MatchOptions, GreaterThanOrEqual):
+		verb = "is at least"
+	}
+
+	values := make([]string, len(v.Values))
+	for i, s := range v.Values {
+		switch {
+		case d.Unit == "$":
+			values[i] = "$" + s
+		case d.Unit != "":
+			values[i] = s + d.Unit
+		default:
+			values[i] = strconv.Quote(s)
+		}
+	}
+	out := verb + " "
+	if len(values) > 1 {
+		if verb == "is" {
+			out = "is one of "
+		} else {
+			out += "one of "
+		}
+	}
+	out += strings.Join(values, ", ")
+	if contains(v.MatchOptions, CaseInsensitive) {
+		out += " (ignoring case)"
+	}
+
+	return out
+}
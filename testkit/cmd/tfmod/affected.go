@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/affected"
+)
+
+// runAffected prints the CI matrix of the modules a branch affects.
+func runAffected(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("affected", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	base := fs.String("base", "", "git `ref` the branch is compared with, e.g. origin/main")
+	repo := fs.String("repo", "..", "repository root `dir`")
+	explain := fs.Bool("explain", false, "print why each module is affected to stderr")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: tfmod affected [-repo DIR] [-explain] -base REF | FILE...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*base == "") == (fs.NArg() == 0) {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	r, err := affected.Load(*repo)
+	if err != nil {
+		return err
+	}
+	files := fs.Args()
+	if *base != "" {
+		if files, err = affected.ChangedFiles(*repo, *base); err != nil {
+			return err
+		}
+	}
+	res := r.Affected(files)
+	if *explain {
+		for _, t := range res.Targets {
+			fmt.Fprintf(stderr, "%s: %s\n", t.Module, strings.Join(t.Reasons, ", "))
+		}
+		for _, file := range res.Ignored {
+			fmt.Fprintf(stderr, "ignored %s\n", file)
+		}
+	}
+	matrix, err := res.Matrix()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, string(matrix))
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/alarm"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+func runAlarm(args []string, stdout, stderr io.Writer) error {
+	return subcommand("alarm", map[string]func([]string, io.Writer, io.Writer) error{
+		"simulate": alarmSimulate,
+	}, args, stdout, stderr)
+}
+
+// alarmSimulate replays a metric series against a planned alarm and prints
+// its state transitions.
+func alarmSimulate(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("alarm simulate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	planPath := fs.String("plan", "", "JSON plan `file` holding the alarm")
+	name := fs.String("alarm", "", "alarm name or resource address")
+	from := fs.String("from", "", "first period to evaluate (RFC 3339; default first sample)")
+	to := fs.String("to", "", "last period to evaluate (RFC 3339; default last sample)")
+	expect := fs.String("expect", "", "exit 1 unless the final state is `STATE`")
+	steps := fs.Bool("steps", false, "print every evaluation, not just transitions")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: tfmod alarm simulate -plan FILE -alarm NAME [-from T] [-to T] [-expect STATE] [-steps] SERIES")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *planPath == "" || *name == "" || fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	p, err := plan.Load(*planPath)
+	if err != nil {
+		return err
+	}
+	a, err := alarm.Find(alarm.FromPlan(p), *name)
+	if err != nil {
+		return err
+	}
+	series, err := alarm.LoadSeries(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var start, end time.Time
+	if *from != "" {
+		if start, err = time.Parse(time.RFC3339, *from); err != nil {
+			return err
+		}
+	}
+	if *to != "" {
+		if end, err = time.Parse(time.RFC3339, *to); err != nil {
+			return err
+		}
+	}
+
+	res, err := alarm.Simulate(a, series, start, end)
+	if err != nil {
+		return err
+	}
+	if *steps {
+		fmt.Fprint(stdout, res)
+	} else {
+		for _, t := range res.Transitions {
+			fmt.Fprintln(stdout, t)
+		}
+	}
+	fmt.Fprintf(stdout, "final state: %s\n", res.Final())
+	if *expect != "" && string(res.Final()) != *expect {
+		return errFailed
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/modgraph"
+)
+
+func runGraph(args []string, stdout, stderr io.Writer) error {
+	return subcommand("graph", map[string]func([]string, io.Writer, io.Writer) error{
+		"render":     graphRender,
+		"dependents": graphDependents,
+		"check":      graphCheck,
+	}, args, stdout, stderr)
+}
+
+// graphRender prints the module dependency graph as DOT, Mermaid or JSON.
+func graphRender(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("graph render", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	format := fs.String("format", "dot", "output `format`: dot, mermaid or json")
+	focus := fs.String("focus", "", "draw only `MODULE` and what it calls")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: tfmod graph render [-format dot|mermaid|json] [-focus MODULE] MODULES_DIR")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	g, err := modgraph.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *focus != "" {
+		if _, ok := g.Modules[*focus]; !ok {
+			return fmt.Errorf("no module %q in %s", *focus, fs.Arg(0))
+		}
+		g = g.Subgraph(*focus)
+	}
+	switch *format {
+	case "dot":
+		fmt.Fprint(stdout, g.DOT())
+	case "mermaid":
+		fmt.Fprint(stdout, g.Mermaid())
+	case "json":
+		data, err := g.JSON()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, string(data))
+	default:
+		return fmt.Errorf("unknown format %q; use dot, mermaid or json", *format)
+	}
+
+	return nil
+}
+
+// graphDependents prints the modules that call a module, one per line.
+func graphDependents(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("graph dependents", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	direct := fs.Bool("direct", false, "list only modules that call MODULE themselves")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: tfmod graph dependents [-direct] MODULES_DIR MODULE")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	g, err := modgraph.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	name := fs.Arg(1)
+	if _, ok := g.Modules[name]; !ok {
+		return fmt.Errorf("no module %q in %s", name, fs.Arg(0))
+	}
+	dependents := g.AllDependents(name)
+	if *direct {
+		dependents = g.Dependents(name)
+	}
+	if len(dependents) == 0 {
+		fmt.Fprintf(stdout, "no module depends on %s\n", name)
+		return nil
+	}
+	fmt.Fprintln(stdout, strings.Join(dependents, "\n"))
+
+	return nil
+}
+
+// graphCheck reports cycles, broken module calls and version constraint
+// conflicts.
+func graphCheck(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("graph check", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: tfmod graph check MODULES_DIR")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	g, err := modgraph.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	findings := modgraph.Check(g)
+	if len(findings) == 0 {
+		fmt.Fprintf(stdout, "%d modules, no problems\n", len(g.Modules))
+		return nil
+	}
+	fmt.Fprintln(stdout, findings)
+	if len(findings.AtLeast(finding.High)) > 0 {
+		return errFailed
+	}
+
+	return nil
+}
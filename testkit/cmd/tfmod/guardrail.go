@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/guardrail"
+)
+
+func runGuardrail(args []string, stdout, stderr io.Writer) error {
+	return subcommand("guardrail", map[string]func([]string, io.Writer, io.Writer) error{
+		"diff":    guardrailDiff,
+		"promote": guardrailPromote,
+	}, args, stdout, stderr)
+}
+
+// guardrailDiff prints the semantic diff between two guardrail definitions.
+func guardrailDiff(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("guardrail diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	failOnWeakening := fs.Bool("fail-on-weakening", false, "exit 1 when a change loosens the guardrail")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: tfmod guardrail diff [-fail-on-weakening] FROM[#ADDRESS] TO[#ADDRESS]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	from, err := loadGuardrail(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	to, err := loadGuardrail(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	changes := guardrail.Diff(from.Config, to.Config)
+	if len(changes) == 0 {
+		fmt.Fprintln(stdout, "no changes")
+		return nil
+	}
+	fmt.Fprintln(stdout, changes)
+	if weakening := changes.Weakening(); *failOnWeakening && len(weakening) > 0 {
+		fmt.Fprintf(stdout, "%d change(s) weaken the guardrail\n", len(weakening))
+		return errFailed
+	}
+
+	return nil
+}
+
+// guardrailPromote checks a deployment against the promotion policy and
+// optionally records it in the ledger.
+func guardrailPromote(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("guardrail promote", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	ledgerPath := fs.String("ledger", "", "deployment ledger `file` (created when missing)")
+	id := fs.String("guardrail", "", "guardrail ID or ARN")
+	env := fs.String("env", "", "target environment")
+	version := fs.String("version", "", "guardrail version to deploy")
+	requires := fs.String("requires", "prod=staging", "comma-separated `target=source` promotion rules")
+	record := fs.Bool("record", false, "record the deployment in the ledger when the check passes")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *ledgerPath == "" || *id == "" || *env == "" || *version == "" {
+		fmt.Fprintln(fs.Output(), "tfmod guardrail promote: -ledger, -guardrail, -env and -version are required")
+		fs.PrintDefaults()
+		return flag.ErrHelp
+	}
+
+	policy := guardrail.PromotionPolicy{Requires: map[string]string{}}
+	for _, rule := range strings.Split(*requires, ",") {
+		if rule = strings.TrimSpace(rule); rule == "" {
+			continue
+		}
+		target, source, ok := strings.Cut(rule, "=")
+		if !ok {
+			return fmt.Errorf("promotion rule %q is not target=source", rule)
+		}
+		policy.Requires[target] = source
+	}
+
+	ledger, err := guardrail.LoadLedger(*ledgerPath)
+	if err != nil {
+		return err
+	}
+	if err := policy.Check(ledger, nil, *id, *env, *version); err != nil {
+		var perr *guardrail.PromotionError
+		if errors.As(err, &perr) {
+			fmt.Fprintln(stdout, err)
+			return errFailed
+		}
+		return err
+	}
+	fmt.Fprintf(stdout, "guardrail %s version %s may be deployed to %s\n", *id, *version, *env)
+
+	if !*record {
+		return nil
+	}
+	ledger.Record(*id, *env, *version)
+	f, err := os.Create(*ledgerPath)
+	if err != nil {
+		return err
+	}
+	if err := ledger.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// loadGuardrail loads FILE or FILE#ADDRESS.
+func loadGuardrail(spec string) (guardrail.Guardrail, error) {
+	path, address, _ := strings.Cut(spec, "#")
+	guardrails, err := guardrail.LoadFile(path)
+	if err != nil {
+		return guardrail.Guardrail{}, err
+	}
+	g, err := guardrail.Select(guardrails, address)
+	if err != nil {
+		return guardrail.Guardrail{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return g, nil
+}
@@ -0,0 +1,112 @@
+// Command tfmod runs the testkit checks from the command line, for CI jobs
+// and for use outside Go tests.
+//
+// Usage:
+//
+//	tfmod guardrail diff [-fail-on-weakening] FROM TO
+//	tfmod guardrail promote -ledger FILE -guardrail ID -env ENV -version N [-record]
+//	tfmod alarm simulate -plan FILE -alarm NAME [-expect STATE] SERIES
+//	tfmod graph render [-format dot|mermaid|json] [-focus MODULE] MODULES_DIR
+//	tfmod graph dependents [-direct] MODULES_DIR MODULE
+//	tfmod graph check MODULES_DIR
+//	tfmod affected [-repo DIR] [-explain] -base REF | FILE...
+//	tfmod new [-repo DIR] [-providers LIST] [-examples LIST] [-plan-tests=false] [-integration-tests=false] [-testkit=false] [-branch] [-apply] NAME
+//	tfmod test [-repo DIR] [-parallel N] [-tags LIST] [-timeout D] [-run REGEXP] [-junit DIR] [-json FILE] [-slowest N] [-v] [MODULE...]
+//
+// FROM and TO are JSON plan or state files (terraform show -json),
+// optionally followed by #ADDRESS to pick one guardrail. SERIES is a CSV
+// or JSON metric series fixture. MODULES_DIR is the repository's modules
+// directory. affected prints a GitHub Actions matrix of the modules a
+// branch, or the changed FILEs, affect. test runs the test suites of the
+// named modules, or of every module, and exits 1 when a test fails. new
+// scaffolds a module from the kit's template and applies nothing unless
+// given -apply.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// errFailed reports that a check ran and failed; its details have already
+// been printed.
+var errFailed = errors.New("check failed")
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdout, stderr io.Writer) error
+}
+
+func commands() []command {
+	return []command{
+		{"guardrail", "diff guardrail definitions and check version promotions", runGuardrail},
+		{"alarm", "simulate CloudWatch alarms against metric series", runAlarm},
+		{"graph", "draw and check the module dependency graph", runGraph},
+		{"affected", "list the modules a change affects, for CI", runAffected},
+		{"new", "scaffold a new module from the module template", runNew},
+		{"test", "run the modules' test suites with JUnit and summary reports", runTest},
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "help" {
+		usage(stderr)
+		return 2
+	}
+	for _, c := range commands() {
+		if c.name != args[0] {
+			continue
+		}
+		err := c.run(args[1:], stdout, stderr)
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, errFailed):
+			return 1
+		case errors.Is(err, flag.ErrHelp):
+			return 2
+		default:
+			fmt.Fprintf(stderr, "tfmod %s: %v\n", c.name, err)
+			return 2
+		}
+	}
+	fmt.Fprintf(stderr, "tfmod: unknown command %q\n", args[0])
+	usage(stderr)
+
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: tfmod <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, c := range commands() {
+		fmt.Fprintf(w, "  %-12s %s\n", c.name, c.summary)
+	}
+}
+
+// subcommand dispatches args to one of subs, printing usage for name when
+// no known subcommand is given.
+func subcommand(name string, subs map[string]func(args []string, stdout, stderr io.Writer) error, args []string, stdout, stderr io.Writer) error {
+	if len(args) > 0 {
+		if f, ok := subs[args[0]]; ok {
+			return f(args[1:], stdout, stderr)
+		}
+	}
+	names := make([]string, 0, len(subs))
+	for n := range subs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	return fmt.Errorf("expected one of %v, e.g. tfmod %s %s -h", names, name, names[0])
+}
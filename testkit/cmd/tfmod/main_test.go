@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	guardrailPlan  = "../../guardrail/testdata/plan.json"
+	guardrailState = "../../guardrail/testdata/state.json"
+)
+
+func tfmod(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func TestUsage(t *testing.T) {
+	code, _, stderr := tfmod()
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "guardrail")
+
+	code, _, stderr = tfmod("nope")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, `unknown command "nope"`)
+
+	code, _, stderr = tfmod("guardrail", "nope")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "expected one of [diff promote]")
+}
+
+func TestGuardrailDiff(t *testing.T) {
+	code, stdout, _ := tfmod("guardrail", "diff", guardrailState, guardrailState)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "no changes\n", stdout)
+
+	to := guardrailPlan + "#module.comprehensive_guardrail.aws_bedrock_guardrail.this"
+	code, stdout, _ = tfmod("guardrail", "diff", guardrailState, to)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "+ topic_policy_config.topics_config[investment_advice] = DENY")
+
+	code, stdout, _ = tfmod("guardrail", "diff", "-fail-on-weakening", to, guardrailState)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, "(weakens)")
+	assert.True(t, strings.HasSuffix(stdout, "weaken the guardrail\n"))
+
+	code, _, stderr := tfmod("guardrail", "diff", guardrailPlan, guardrailState)
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "several guardrails found")
+}
+
+func TestGuardrailPromote(t *testing.T) {
+	ledger := filepath.Join(t.TempDir(), "ledger.json")
+	promote := func(env, version string, extra ...string) (int, string) {
+		code, stdout, _ := tfmod(append([]string{"guardrail", "promote", "-ledger", ledger, "-guardrail", "abc123", "-env", env, "-version", version}, extra...)...)
+		return code, stdout
+	}
+
+	code, stdout := promote("prod", "2")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, "has not been deployed to staging (deployed there: none)")
+
+	code, _ = promote("staging", "2", "-record")
+	assert.Equal(t, 0, code)
+
+	code, stdout = promote("prod", "2", "-record")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "guardrail abc123 version 2 may be deployed to prod\n", stdout)
+
+	code, _ = promote("prod", "3")
+	assert.Equal(t, 1, code)
+
+	code, _ = promote("prod", "3", "-requires", "")
+	assert.Equal(t, 0, code, "an empty rule set allows everything")
+
+	code, _, stderr := tfmod("guardrail", "promote", "-ledger", ledger)
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "are required")
+}
+
+func TestAlarmSimulate(t *testing.T) {
+	const (
+		plan   = "../../alarm/testdata/plan.json"
+		series = "../../alarm/testdata/throttles.csv"
+	)
+	code, stdout, _ := tfmod("alarm", "simulate", "-plan", plan, "-alarm", "bedrock-throttles-test", "-to", "2024-05-01T12:59:00Z", series)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "2024-05-01T12:25:00Z OK -> ALARM: 2 of 2 datapoints breaching")
+	assert.True(t, strings.HasSuffix(stdout, "final state: INSUFFICIENT_DATA\n"), stdout)
+
+	code, _, _ = tfmod("alarm", "simulate", "-plan", plan, "-alarm", "bedrock-throttles-test", "-expect", "ALARM", series)
+	assert.Equal(t, 1, code)
+
+	code, _, stderr := tfmod("alarm", "simulate", "-plan", plan, "-alarm", "nope", series)
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, `no metric alarm "nope" in plan`)
+}
+
+func TestGraph(t *testing.T) {
+	const modules = "../../../modules"
+
+	code, stdout, _ := tfmod("graph", "render", "-format", "mermaid", "-focus", "aws-tgw", modules)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "flowchart LR\n    aws_tgw[\"aws-tgw\"]\n    aws_vpc[\"aws-vpc\"]\n    aws_tgw -->|vpc| aws_vpc\n", stdout)
+
+	code, stdout, _ = tfmod("graph", "render", modules)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, `"bananalab-platform" -> "aws-ec2-asg" [label="asg"];`)
+
+	code, stdout, _ = tfmod("graph", "dependents", modules, "aws-vpc")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "aws-tgw\nbananalab-platform\n", stdout)
+
+	code, stdout, _ = tfmod("graph", "dependents", modules, "bananalab-platform")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "no module depends on bananalab-platform\n", stdout)
+
+	code, stdout, _ = tfmod("graph", "check", modules)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "no problems")
+
+	code, stdout, _ = tfmod("graph", "check", "../../modgraph/testdata/broken")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, "HIGH modgraph-cycle a: modules call each other in a cycle: a -> b -> a")
+
+	code, _, stderr := tfmod("graph", "render", "-format", "svg", modules)
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, `unknown format "svg"`)
+}
+
+func TestAffected(t *testing.T) {
+	code, stdout, stderr := tfmod("affected", "-repo", "../../..", "-explain", "modules/aws-tgw/main.tf", "README.md")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, `{"include":[{"module":"aws-tgw","path":"modules/aws-tgw","test":"modules/aws-tgw/test","reasons":["changed"]}]}`+"\n", stdout)
+	assert.Equal(t, "aws-tgw: changed\nignored README.md\n", stderr)
+
+	code, _, _ = tfmod("affected", "-repo", "../../..")
+	assert.Equal(t, 2, code)
+}
+
+func TestTest(t *testing.T) {
+	const repo = "../../testrun/testdata"
+	dir := t.TempDir()
+	summary := filepath.Join(dir, "summary.json")
+	code, stdout, _ := tfmod("test", "-repo", repo, "-parallel", "1", "-junit", dir, "-json", summary, "alpha", "beta")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, "alpha: PASS TestPass (0.00s)\n")
+	assert.Contains(t, stdout, "beta: --- FAIL: TestApply (0.00s)\n")
+	assert.Contains(t, stdout, "beta: fail in ")
+	assert.Contains(t, stdout, "5 passed, 1 failed, 1 skipped in ")
+	for _, name := range []string{"alpha.xml", "beta.xml", "summary.json"} {
+		assert.FileExists(t, filepath.Join(dir, name))
+	}
+
+	// Without the integration tag beta has nothing to run.
+	code, stdout, _ = tfmod("test", "-repo", repo, "-tags", "", "beta")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "beta: skip in ")
+
+	code, stdout, _ = tfmod("test", "-repo", repo, "delta")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "delta: modules/delta/test has no go.mod\n")
+	assert.Contains(t, stdout, "delta: skipped, modules/delta/test has no go.mod\n")
+
+	code, _, stderr := tfmod("test", "-repo", repo, "zeta")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "no test suite for zeta")
+}
+
+func TestNew(t *testing.T) {
+	repo := t.TempDir()
+	code, stdout, stderr := tfmod("new", "-repo", repo, "-providers", "aws", "-examples", "simple,complete", "-integration-tests=false", "aws-widget")
+	assert.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "created modules/aws-widget\n  .envrc\n")
+	assert.Contains(t, stdout, "  examples/complete/main.tf\n")
+	assert.Contains(t, stdout, "  test/go.sum\n")
+	assert.NotContains(t, stdout, "integration_test.go")
+	assert.True(t, strings.HasSuffix(stdout, "plan the examples with: make -C modules/aws-widget test\n"))
+	assert.FileExists(t, filepath.Join(repo, "modules", "aws-widget", "test", "plan_test.go"))
+
+	code, _, stderr = tfmod("new", "-repo", repo, "aws-widget")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "already exists")
+
+	code, _, stderr = tfmod("new", "-repo", repo, "AWS_Widget")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, `module name "AWS_Widget" must match ^[0-9a-z-]*$`)
+
+	// Applying needs the live tests.
+	code, _, stderr = tfmod("new", "-repo", repo, "-apply", "-integration-tests=false", "aws-gadget")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "-apply runs the integration tests")
+	assert.NoDirExists(t, filepath.Join(repo, "modules", "aws-gadget"))
+
+	code, _, _ = tfmod("new", "-repo", repo)
+	assert.Equal(t, 2, code)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/scaffold"
+	"github.com/JQUINONES82/terraform_modules/testkit/testrun"
+)
+
+// runNew scaffolds a module from the embedded template. Nothing is
+// applied unless -apply is given.
+func runNew(args []string, stdout, stderr io.Writer) error {
+	defaults := scaffold.Defaults("")
+	fs := flag.NewFlagSet("new", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	repo := fs.String("repo", "..", "repository root `dir`")
+	providers := fs.String("providers", strings.Join(defaults.Providers, ","), "comma-separated `providers` the module requires")
+	examples := fs.String("examples", strings.Join(defaults.Examples, ","), "comma-separated `names` of the examples to generate")
+	planTests := fs.Bool("plan-tests", defaults.PlanTests, "generate tests that plan each example")
+	integrationTests := fs.Bool("integration-tests", defaults.IntegrationTests, "generate tests, behind the integration tag, that apply each example")
+	testkit := fs.Bool("testkit", defaults.Testkit, "require the testkit from the tests")
+	branch := fs.Bool("branch", false, "create and switch to a git branch named after the module")
+	apply := fs.Bool("apply", false, "run the integration tests, which apply the examples to a real account")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: tfmod new [-repo DIR] [-providers LIST] [-examples LIST] [-plan-tests=false] [-integration-tests=false] [-testkit=false] [-branch] [-apply] NAME")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	o := scaffold.Options{
+		Name:             fs.Arg(0),
+		Providers:        list(*providers),
+		Examples:         list(*examples),
+		PlanTests:        *planTests,
+		IntegrationTests: *integrationTests,
+		Testkit:          *testkit,
+	}
+	if *apply && !o.IntegrationTests {
+		return fmt.Errorf("-apply runs the integration tests, which -integration-tests=false leaves out")
+	}
+
+	dir, files, err := scaffold.Generate(filepath.Join(*repo, testrun.ModulesDir), o)
+	if err != nil {
+		return err
+	}
+	rel := filepath.ToSlash(filepath.Join(testrun.ModulesDir, o.Name))
+	fmt.Fprintf(stdout, "created %s\n", rel)
+	for _, f := range files {
+		fmt.Fprintf(stdout, "  %s\n", f.Path)
+	}
+	if *branch {
+		cmd := exec.Command("git", "checkout", "-b", o.Name)
+		cmd.Dir = *repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git checkout -b %s: %v: %s", o.Name, err, bytes.TrimSpace(out))
+		}
+		fmt.Fprintf(stdout, "switched to branch %s\n", o.Name)
+	}
+
+	if !*apply {
+		if o.PlanTests {
+			fmt.Fprintf(stdout, "plan the examples with: make -C %s test\n", rel)
+		}
+		if o.IntegrationTests {
+			fmt.Fprintf(stdout, "apply them with: make -C %s test-integration\n", rel)
+		}
+		return nil
+	}
+	suite := testrun.Suite{Module: o.Name, Dir: filepath.Join(dir, "test"), Path: rel + "/test", GoMod: true}
+	r := &testrun.Runner{
+		Policy: testrun.DefaultPolicy,
+		Events: func(s testrun.Suite, e testrun.Event) {
+			if e.Action == "output" {
+				fmt.Fprint(stdout, e.Output)
+			}
+		},
+	}
+	s := testrun.Summarize(r.Run(context.Background(), []testrun.Suite{suite}), 0)
+	fmt.Fprintf(stdout, "\n%s", s)
+	if !s.OK() {
+		return errFailed
+	}
+
+	return nil
+}
+
+// list splits a comma-separated flag value, dropping empty entries.
+func list(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+
+	return out
+}
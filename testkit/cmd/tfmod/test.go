@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/testrun"
+)
+
+// runTest runs the modules' test suites under one tag and timeout policy
+// and reports JUnit XML and a summary.
+func runTest(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	repo := fs.String("repo", "..", "repository root `dir`")
+	parallel := fs.Int("parallel", 4, "run at most `N` modules at once")
+	tags := fs.String("tags", strings.Join(testrun.DefaultPolicy.Tags, ","), "comma-separated build `tags`")
+	timeout := fs.Duration("timeout", testrun.DefaultPolicy.Timeout, "go test -timeout for each module")
+	runPattern := fs.String("run", "", "run only tests matching `regexp`")
+	junit := fs.String("junit", "", "write MODULE.xml JUnit reports to `dir`")
+	summary := fs.String("json", "", "write the JSON summary to `file`")
+	slowest := fs.Int("slowest", 10, "list the `N` slowest tests")
+	verbose := fs.Bool("v", false, "print every line of test output")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: tfmod test [-repo DIR] [-parallel N] [-tags LIST] [-timeout D] [-run REGEXP] [-junit DIR] [-json FILE] [-slowest N] [-v] [MODULE...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	suites, err := testrun.Discover(*repo)
+	if err != nil {
+		return err
+	}
+	if suites, err = testrun.Select(suites, fs.Args()); err != nil {
+		return err
+	}
+	policy := testrun.Policy{Timeout: *timeout, Run: *runPattern}
+	if *tags != "" {
+		policy.Tags = strings.Split(*tags, ",")
+	}
+	r := &testrun.Runner{
+		Policy:   policy,
+		Parallel: *parallel,
+		Events: func(s testrun.Suite, e testrun.Event) {
+			switch {
+			case *verbose && e.Action == "output":
+				fmt.Fprintf(stdout, "%s: %s", s.Module, e.Output)
+			case !*verbose && e.Test != "" && !strings.Contains(e.Test, "/") && (e.Action == "pass" || e.Action == "fail" || e.Action == "skip"):
+				fmt.Fprintf(stdout, "%s: %s %s (%.2fs)\n", s.Module, strings.ToUpper(e.Action), e.Test, e.Elapsed)
+			}
+		},
+		Done: func(res *testrun.SuiteResult) {
+			if !*verbose {
+				for _, t := range res.Tests {
+					if t.Status == testrun.StatusFail {
+						fmt.Fprint(stdout, prefixLines(res.Module+": ", t.Output))
+					}
+				}
+				if res.Status == testrun.StatusError || !res.GoMod {
+					fmt.Fprint(stdout, prefixLines(res.Module+": ", res.Output))
+				}
+			}
+			fmt.Fprintf(stdout, "%s: %s in %s\n", res.Module, res.Status, res.Elapsed.Round(100*time.Millisecond))
+		},
+	}
+	results := r.Run(context.Background(), suites)
+
+	if *junit != "" {
+		if err := testrun.WriteJUnitDir(*junit, results); err != nil {
+			return err
+		}
+	}
+	s := testrun.Summarize(results, *slowest)
+	if *summary != "" {
+		data, err := s.JSON()
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*summary, append(data, '\n'), 0o644); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(stdout, "\n%s", s)
+	if !s.OK() {
+		return errFailed
+	}
+
+	return nil
+}
+
+func prefixLines(prefix, s string) string {
+	if s == "" {
+		return ""
+	}
+	lines := strings.SplitAfter(strings.TrimSuffix(s, "\n"), "\n")
+
+	return prefix + strings.Join(lines, prefix) + "\n"
+}
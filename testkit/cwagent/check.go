@@ -0,0 +1,299 @@
+package cwagent
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/internal/hint"
+)
+
+// Rule identifiers reported by Check, besides RuleSchema.
+const (
+	RuleRetention   = "cwagent-retention"
+	RulePlaceholder = "cwagent-placeholder"
+	RuleDimensions  = "cwagent-dimensions"
+	RuleLogs        = "cwagent-logs"
+	RuleCollectors  = "cwagent-collectors"
+)
+
+// retentionDays are the retention_in_days values CloudWatch Logs accepts.
+// The agent also takes -1, its default, for logs that never expire.
+var retentionDays = []int{-1, 1, 3, 5, 7, 14, 30, 60, 90, 120, 150, 180, 365, 400, 545, 731, 1096, 1827, 2192, 2557, 2922, 3288, 3653}
+
+// instanceDimensions are the only keys of metrics.append_dimensions, each
+// taking the ${aws:...} placeholder of the same name.
+var instanceDimensions = []string{"AutoScalingGroupName", "ImageId", "InstanceId", "InstanceType"}
+
+// logPlaceholders are what the agent expands in log group and stream
+// names.
+var logPlaceholders = []string{"hostname", "instance_id", "ip_address", "local_hostname"}
+
+// pluginDimensions are the dimensions the agent's plugins add to their
+// metrics, besides host.
+var pluginDimensions = map[string][]string{
+	"cpu":        {"cpu"},
+	"disk":       {"device", "fstype", "path"},
+	"diskio":     {"name"},
+	"net":        {"interface"},
+	"nvidia_gpu": {"arch", "index", "name"},
+	"procstat":   {"exe", "pattern", "pid_file", "pidfile", "process_name"},
+}
+
+var (
+	placeholder  = regexp.MustCompile(`\{([^{}]*)\}`)
+	logGroupName = regexp.MustCompile(`^[A-Za-z0-9_/.#-]{1,512}$`)
+)
+
+// CheckPlan checks the agent configuration of every parameter FromPlan
+// finds in p. When template holds the source of aws-ec2-asg's
+// cloudwatch-config.tftpl, configurations that drop collectors of the
+// default it renders are reported too.
+func CheckPlan(p *tfjson.Plan, template []byte) finding.List {
+	var findings finding.List
+	for _, prm := range FromPlan(p) {
+		var defaults *Config
+		if template != nil {
+			c, ok, err := prm.Defaults(template)
+			if err != nil {
+				findings = append(findings, finding.Finding{Severity: finding.High, Rule: RuleCollectors, Address: prm.Address, Path: "value", Message: fmt.Sprintf("rendering the default configuration: %v", err)})
+			} else if ok {
+				defaults = c
+			}
+		}
+		findings = append(findings, Check(prm, defaults)...)
+	}
+	findings.Sort()
+
+	return findings
+}
+
+// Check parses the configuration of prm and checks it against the model
+// and the agent's rules. When defaults is not nil, collectors it has and
+// the configuration has not are reported.
+func Check(prm *Parameter, defaults *Config) finding.List {
+	var findings finding.List
+	add := func(s finding.Severity, rule, path, format string, args ...interface{}) {
+		findings = append(findings, finding.Finding{Severity: s, Rule: rule, Address: prm.Address, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if prm.Value == "" {
+		add(finding.Low, RuleSchema, "value", "agent configuration is known only after apply and was not checked")
+		return findings
+	}
+	c, parsed := Parse([]byte(prm.Value))
+	for _, f := range parsed {
+		f.Address = prm.Address
+		findings = append(findings, f)
+	}
+	if c == nil {
+		return findings
+	}
+
+	checkPlaceholders(c, add)
+	checkDimensions(c, add)
+	checkLogs(c, add)
+	if defaults != nil {
+		dropped := Diff(defaults, c).Dropped()
+		for _, ch := range dropped {
+			if plugin, _, ok := strings.Cut(ch.Collector, " "); ok && droppedPlugin(dropped, plugin) {
+				// Reported with its plugin.
+				continue
+			}
+			add(finding.Medium, RuleCollectors, ch.Path, "the configuration drops the %s collector of the module's default configuration", ch.Collector)
+		}
+	}
+
+	return findings
+}
+
+func droppedPlugin(dropped Changes, plugin string) bool {
+	for _, ch := range dropped {
+		if ch.Collector == plugin {
+			return true
+		}
+	}
+
+	return false
+}
+
+type addFunc func(s finding.Severity, rule, path, format string, args ...interface{})
+
+// checkPlaceholders reports ${...} the agent does not expand, such as
+// template interpolations Terraform never rendered, and instance
+// dimensions other than the four the agent knows.
+func checkPlaceholders(c *Config, add addFunc) {
+	var walk func(path string, v interface{})
+	walk = func(path string, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for _, k := range sortedKeys(v) {
+				walk(path+"."+k, v[k])
+			}
+		case []interface{}:
+			for i, item := range v {
+				walk(fmt.Sprintf("%s[%d]", path, i), item)
+			}
+		case string:
+			switch {
+			case strings.Contains(v, "$${"):
+				add(finding.High, RulePlaceholder, path, "%q still holds the template escape $${; render the configuration with templatefile rather than file", v)
+			case strings.Contains(v, "${aws:") && !strings.HasPrefix(path, "$.metrics.append_dimensions."):
+				add(finding.High, RulePlaceholder, path, "the agent expands ${aws:...} only in metrics.append_dimensions, so %q is used as is", v)
+			case strings.Contains(v, "${") && !strings.Contains(v, "${aws:"), strings.Contains(v, "%{"):
+				add(finding.High, RulePlaceholder, path, "%q holds a template expression that was not rendered", v)
+			}
+		}
+	}
+	walk("$", c.doc)
+
+	if c.Metrics == nil {
+		return
+	}
+	for _, k := range sortedNames(c.Metrics.AppendDimensions) {
+		path := "$.metrics.append_dimensions." + k
+		v := c.Metrics.AppendDimensions[k]
+		switch {
+		case !contains(instanceDimensions, k):
+			add(finding.High, RulePlaceholder, path, "the agent appends only %s; set other dimensions under a plugin's append_dimensions%s", strings.Join(instanceDimensions, ", "), hint.DidYouMean(k, instanceDimensions))
+		case v != "${aws:"+k+"}" && !strings.Contains(v, "$${"):
+			add(finding.High, RulePlaceholder, path, "must be ${aws:%s}, not %q", k, v)
+		}
+	}
+}
+
+// checkDimensions reports aggregation dimensions no metric carries.
+func checkDimensions(c *Config, add addFunc) {
+	if c.Metrics == nil {
+		return
+	}
+	available := map[string]bool{}
+	if !c.Agent.OmitHostname {
+		available["host"] = true
+	}
+	for k := range c.Metrics.AppendDimensions {
+		available[k] = true
+	}
+	tagged := []string{}
+	for name, v := range c.Metrics.MetricsCollected {
+		for _, d := range pluginDimensions[name] {
+			available[d] = true
+		}
+		if name == "statsd" || name == "collectd" {
+			tagged = append(tagged, name)
+		}
+		sections := []interface{}{v}
+		if entries, ok := v.([]interface{}); ok {
+			sections = entries
+		}
+		for _, s := range sections {
+			m, _ := s.(map[string]interface{})
+			dims, _ := m["append_dimensions"].(map[string]interface{})
+			for d := range dims {
+				available[d] = true
+			}
+		}
+	}
+	sort.Strings(tagged)
+	names := make([]string, 0, len(available))
+	for d := range available {
+		names = append(names, d)
+	}
+	sort.Strings(names)
+
+	for i, set := range c.Metrics.AggregationDimensions {
+		for j, d := range set {
+			if available[d] {
+				continue
+			}
+			path := fmt.Sprintf("$.metrics.aggregation_dimensions[%d][%d]", i, j)
+			if len(tagged) > 0 {
+				add(finding.Low, RuleDimensions, path, "only %s metrics tagged %s are aggregated by it%s", strings.Join(tagged, " and "), d, hint.DidYouMean(d, names))
+				continue
+			}
+			add(finding.Medium, RuleDimensions, path, "no collected metric has the dimension %s, so the agent aggregates nothing by it%s", d, hint.DidYouMean(d, names))
+		}
+	}
+}
+
+// checkLogs reports retention values CloudWatch Logs rejects, log groups
+// given conflicting retention, invalid log group names, unknown
+// {placeholders} and files collected twice.
+func checkLogs(c *Config, add addFunc) {
+	if c.Logs != nil {
+		checkLogName(c.Logs.LogStreamName, "$.logs.log_stream_name", false, add)
+	}
+	files, paths := c.Files()
+	retention := map[string]int{}
+	retentionAt := map[string]string{}
+	collected := map[string]string{}
+	for i, f := range files {
+		group := f.LogGroupName
+		if group == "" {
+			// The agent names the group after the file.
+			group = f.FilePath
+		}
+		checkLogName(f.LogGroupName, paths[i]+".log_group_name", true, add)
+		checkLogName(f.LogStreamName, paths[i]+".log_stream_name", false, add)
+
+		if f.RetentionInDays != nil {
+			days := *f.RetentionInDays
+			switch prev, seen := retention[group]; {
+			case !containsInt(retentionDays, days):
+				add(finding.High, RuleRetention, paths[i]+".retention_in_days", "CloudWatch Logs does not accept a retention of %d days; use one of %s", days, joinInts(retentionDays[1:]))
+			case seen && prev != days:
+				add(finding.High, RuleRetention, paths[i]+".retention_in_days", "log group %s is given a retention of %d days here and %d days at %s; the agent refuses conflicting values", group, days, prev, retentionAt[group])
+			case !seen:
+				retention[group], retentionAt[group] = days, paths[i]
+			}
+		}
+
+		if f.FilePath == "" {
+			continue
+		}
+		key := f.FilePath + "\x00" + group
+		if prev, ok := collected[key]; ok {
+			add(finding.Medium, RuleLogs, paths[i]+".file_path", "%s is already collected into %s at %s, so its events are published twice", f.FilePath, group, prev)
+			continue
+		}
+		collected[key] = paths[i]
+	}
+}
+
+func checkLogName(name, path string, group bool, add addFunc) {
+	if name == "" || strings.Contains(name, "${") || strings.Contains(name, "%{") {
+		// checkPlaceholders reports these.
+		return
+	}
+	for _, m := range placeholder.FindAllStringSubmatch(name, -1) {
+		if !contains(logPlaceholders, m[1]) {
+			add(finding.Medium, RulePlaceholder, path, "the agent does not expand {%s}; it expands {%s}%s", m[1], strings.Join(logPlaceholders, "}, {"), hint.DidYouMean(m[1], logPlaceholders))
+		}
+	}
+	if group && !logGroupName.MatchString(placeholder.ReplaceAllString(name, "x")) {
+		add(finding.High, RuleLogs, path, "log group name %q must be 1 to 512 letters, digits and _ / . # -", name)
+	}
+}
+
+func containsInt(list []int, n int) bool {
+	for _, item := range list {
+		if item == n {
+			return true
+		}
+	}
+
+	return false
+}
+
+func joinInts(ns []int) string {
+	parts := make([]string, len(ns))
+	for i, n := range ns {
+		parts[i] = fmt.Sprint(n)
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,294 @@
+package cwagent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+// Resource types read from a plan.
+const (
+	ParameterType        = "aws_ssm_parameter"
+	AssociationType      = "aws_ssm_association"
+	AutoScalingGroupType = "aws_autoscaling_group"
+)
+
+// ManageAgentDocument is the SSM document that configures the agent from
+// the parameter named by its optionalConfigurationLocation.
+const ManageAgentDocument = "AmazonCloudWatch-ManageAgent"
+
+// Config is the part of an agent configuration the checks look at.
+type Config struct {
+	Agent   Agent    `json:"agent"`
+	Metrics *Metrics `json:"metrics"`
+	Logs    *Logs    `json:"logs"`
+
+	// doc is the whole document, for the checks that walk it.
+	doc map[string]interface{}
+}
+
+// Agent is the agent section.
+type Agent struct {
+	MetricsCollectionInterval int    `json:"metrics_collection_interval"`
+	OmitHostname              bool   `json:"omit_hostname"`
+	Region                    string `json:"region"`
+	RunAsUser                 string `json:"run_as_user"`
+}
+
+// Metrics is the metrics section. MetricsCollected is kept as decoded,
+// since its plugins differ in shape.
+type Metrics struct {
+	Namespace             string                 `json:"namespace"`
+	AppendDimensions      map[string]string      `json:"append_dimensions"`
+	AggregationDimensions [][]string             `json:"aggregation_dimensions"`
+	MetricsCollected      map[string]interface{} `json:"metrics_collected"`
+}
+
+// Logs is the logs section.
+type Logs struct {
+	LogStreamName string `json:"log_stream_name"`
+	LogsCollected struct {
+		Files struct {
+			CollectList []LogFile `json:"collect_list"`
+		} `json:"files"`
+		WindowsEvents struct {
+			CollectList []LogFile `json:"collect_list"`
+		} `json:"windows_events"`
+	} `json:"logs_collected"`
+}
+
+// LogFile is an entry of a collect_list: a file, or a Windows event log
+// named by EventName.
+type LogFile struct {
+	FilePath        string `json:"file_path"`
+	EventName       string `json:"event_name"`
+	LogGroupName    string `json:"log_group_name"`
+	LogStreamName   string `json:"log_stream_name"`
+	LogGroupClass   string `json:"log_group_class"`
+	RetentionInDays *int   `json:"retention_in_days"`
+}
+
+// Files returns the collect_list entries of c with their JSON paths.
+func (c *Config) Files() ([]LogFile, []string) {
+	if c.Logs == nil {
+		return nil, nil
+	}
+	var files []LogFile
+	var paths []string
+	for i, f := range c.Logs.LogsCollected.Files.CollectList {
+		files = append(files, f)
+		paths = append(paths, fmt.Sprintf("$.logs.logs_collected.files.collect_list[%d]", i))
+	}
+	for i, f := range c.Logs.LogsCollected.WindowsEvents.CollectList {
+		files = append(files, f)
+		paths = append(paths, fmt.Sprintf("$.logs.logs_collected.windows_events.collect_list[%d]", i))
+	}
+
+	return files, paths
+}
+
+// Parameter is an SSM parameter holding an agent configuration.
+type Parameter struct {
+	Address string
+	Name    string
+	// Value is the configuration, empty when it is known only after
+	// apply.
+	Value string
+	// AutoScalingGroupName is the name of the aws-ec2-asg group in the
+	// same module, the input of cloudwatch-config.tftpl, or empty.
+	AutoScalingGroupName string
+}
+
+// FromPlan returns the SSM parameters in p that an
+// AmazonCloudWatch-ManageAgent association configures the agent from.
+func FromPlan(p *tfjson.Plan) []*Parameter {
+	associations := plan.ResourcesOfType(p, AssociationType)
+	var out []*Parameter
+	for _, r := range plan.ResourcesOfType(p, ParameterType) {
+		used := false
+		for _, a := range associations {
+			if a.String("name") != ManageAgentDocument {
+				continue
+			}
+			location, _ := a.Values["parameters"].(map[string]interface{})["optionalConfigurationLocation"].(string)
+			used = used || location != "" && location == r.String("name") || refersTo(plan.References(p, a, "parameters"), r)
+		}
+		if !used {
+			continue
+		}
+		prm := &Parameter{Address: r.Address, Name: r.String("name"), Value: r.String("value")}
+		for _, asg := range plan.ResourcesOfType(p, AutoScalingGroupType) {
+			if asg.ModuleAddress == r.ModuleAddress {
+				prm.AutoScalingGroupName = asg.String("name")
+			}
+		}
+		out = append(out, prm)
+	}
+
+	return out
+}
+
+func refersTo(refs []string, r plan.Resource) bool {
+	base := r.Address
+	if i := strings.LastIndex(base, "["); i > strings.LastIndex(base, ".") {
+		base = base[:i]
+	}
+	for _, ref := range refs {
+		if ref == r.Address || ref == base {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Defaults renders the aws-ec2-asg template src for the parameter, or
+// returns false when the group name the template needs is not known.
+func (prm *Parameter) Defaults(src []byte) (*Config, bool, error) {
+	if prm.AutoScalingGroupName == "" {
+		return nil, false, nil
+	}
+	out, err := Render(src, "cloudwatch-config.tftpl", map[string]string{"autoscaling_group_name": prm.AutoScalingGroupName})
+	if err != nil {
+		return nil, false, err
+	}
+	c, _ := Parse([]byte(out))
+
+	return c, c != nil, nil
+}
+
+// Change is a collector one configuration has and another has not.
+type Change struct {
+	// Collector names a metrics plugin ("mem"), one of its measurements
+	// ("mem used_percent") or a log source ("file /var/log/messages").
+	Collector string
+	// Path is the JSON path of the collector in the configuration that
+	// has it.
+	Path  string
+	Added bool
+}
+
+// Changes is the result of Diff.
+type Changes []Change
+
+// String renders the changes one per line, as "- mem" or "+ cpu".
+func (cs Changes) String() string {
+	var b strings.Builder
+	for _, c := range cs {
+		sign := "-"
+		if c.Added {
+			sign = "+"
+		}
+		fmt.Fprintf(&b, "%s %s\n", sign, c.Collector)
+	}
+
+	return b.String()
+}
+
+// Dropped returns the changes that remove a collector.
+func (cs Changes) Dropped() Changes {
+	var out Changes
+	for _, c := range cs {
+		if !c.Added {
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
+
+// Diff returns the collectors from has and to has not, then those to
+// has and from has not, each sorted by name.
+func Diff(from, to *Config) Changes {
+	before, after := Collectors(from), Collectors(to)
+	var out Changes
+	for _, name := range sortedNames(before) {
+		if _, ok := after[name]; !ok {
+			out = append(out, Change{Collector: name, Path: before[name]})
+		}
+	}
+	for _, name := range sortedNames(after) {
+		if _, ok := before[name]; !ok {
+			out = append(out, Change{Collector: name, Path: after[name], Added: true})
+		}
+	}
+
+	return out
+}
+
+// Collectors returns the collectors of c by name, with their JSON paths.
+// Measurements are named without their plugin prefix, so mem_used_percent
+// and used_percent under mem are the same collector.
+func Collectors(c *Config) map[string]string {
+	out := map[string]string{}
+	if c == nil {
+		return out
+	}
+	if c.Metrics != nil {
+		for _, name := range sortedKeys(c.Metrics.MetricsCollected) {
+			path := "$.metrics.metrics_collected." + name
+			if entries, ok := c.Metrics.MetricsCollected[name].([]interface{}); ok {
+				// procstat lists one entry per process.
+				for i, e := range entries {
+					m, _ := e.(map[string]interface{})
+					collectPlugin(out, name+" "+process(m), fmt.Sprintf("%s[%d]", path, i), name, m)
+				}
+				continue
+			}
+			m, _ := c.Metrics.MetricsCollected[name].(map[string]interface{})
+			collectPlugin(out, name, path, name, m)
+		}
+	}
+	files, paths := c.Files()
+	for i, f := range files {
+		if f.EventName != "" {
+			out["event "+f.EventName] = paths[i]
+		} else {
+			out["file "+f.FilePath] = paths[i]
+		}
+	}
+
+	return out
+}
+
+func collectPlugin(out map[string]string, name, path, plugin string, m map[string]interface{}) {
+	out[name] = path
+	entries, _ := m["measurement"].([]interface{})
+	for i, e := range entries {
+		metric, ok := e.(string)
+		if !ok {
+			m, _ := e.(map[string]interface{})
+			metric, _ = m["name"].(string)
+		}
+		if metric == "" {
+			continue
+		}
+		metric = strings.TrimPrefix(metric, plugin+"_")
+		out[name+" "+metric] = fmt.Sprintf("%s.measurement[%d]", path, i)
+	}
+}
+
+// process names a procstat entry by what selects its process.
+func process(m map[string]interface{}) string {
+	for _, key := range []string{"exe", "pattern", "pid_file"} {
+		if v, ok := m[key].(string); ok {
+			return key + "=" + v
+		}
+	}
+
+	return "?"
+}
+
+func sortedNames(m map[string]string) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
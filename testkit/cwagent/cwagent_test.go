@@ -0,0 +1,271 @@
+package cwagent
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan/plantest"
+)
+
+const (
+	templatePath = "../../modules/aws-ec2-asg/cloudwatch-config.tftpl"
+	asgParameter = "module.asg.aws_ssm_parameter.cloudwatch_config"
+	// workersParameter holds a consumer's cloudwatch_config override.
+	workersParameter = "module.workers.aws_ssm_parameter.cloudwatch_config"
+)
+
+// config lets edit change the agent configuration of a parameter.
+func config(t *testing.T, f plantest.Fixture, address string, edit func(c map[string]interface{})) {
+	t.Helper()
+	values := f.Values(t, address)
+	var c map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(values["value"].(string)), &c))
+	edit(c)
+	data, err := json.Marshal(c)
+	require.NoError(t, err)
+	values["value"] = string(data)
+}
+
+func section(c map[string]interface{}, path ...string) map[string]interface{} {
+	for _, p := range path {
+		c = c[p].(map[string]interface{})
+	}
+
+	return c
+}
+
+func collectList(c map[string]interface{}) []interface{} {
+	return section(c, "logs", "logs_collected", "files")["collect_list"].([]interface{})
+}
+
+func entry(c map[string]interface{}, i int) map[string]interface{} {
+	return collectList(c)[i].(map[string]interface{})
+}
+
+func template(t *testing.T) []byte {
+	t.Helper()
+	src, err := os.ReadFile(templatePath)
+	require.NoError(t, err)
+
+	return src
+}
+
+func TestRender(t *testing.T) {
+	out, err := RenderFile(templatePath, map[string]string{"autoscaling_group_name": "asg-module-example"})
+	require.NoError(t, err)
+	assert.JSONEq(t, plantest.Load(t, "testdata/plan.json").Values(t, asgParameter)["value"].(string), out)
+
+	_, err = RenderFile(templatePath, nil)
+	assert.ErrorContains(t, err, `vars map does not contain key "autoscaling_group_name"`)
+	_, err = Render([]byte(`${jsonencode({"a": 1}`), "broken.tftpl", nil)
+	assert.ErrorContains(t, err, "parsing template")
+}
+
+func TestFromPlan(t *testing.T) {
+	params := FromPlan(plantest.Load(t, "testdata/plan.json").Plan(t))
+	require.Len(t, params, 2)
+	assert.Equal(t, asgParameter, params[0].Address)
+	assert.Equal(t, "/asg-module-example/cloudwatch-config", params[0].Name)
+	assert.Equal(t, "asg-module-example", params[0].AutoScalingGroupName)
+	assert.Equal(t, workersParameter, params[1].Address)
+	assert.Equal(t, "workers", params[1].AutoScalingGroupName)
+}
+
+func TestDiff(t *testing.T) {
+	params := FromPlan(plantest.Load(t, "testdata/plan.json").Plan(t))
+	defaults, ok, err := params[1].Defaults(template(t))
+	require.NoError(t, err)
+	require.True(t, ok)
+	workers, findings := Parse([]byte(params[1].Value))
+	require.Empty(t, findings, findings.String())
+
+	// The override keeps every default collector, measurements named with
+	// or without their plugin prefix alike.
+	assert.Empty(t, Diff(defaults, workers).Dropped())
+	assert.Equal(t, strings.Join([]string{
+		"+ cpu",
+		"+ cpu usage_idle",
+		"+ cpu usage_iowait",
+		"+ disk inodes_free",
+		"+ file /opt/app/logs/*.log",
+		"+ file /var/log/ecs/ecs-agent.log",
+		"+ procstat exe=java",
+		"+ procstat exe=java cpu_usage",
+		"+ procstat exe=java memory_rss",
+		"",
+	}, "\n"), Diff(defaults, workers).String())
+
+	assert.Equal(t, Changes{
+		{Collector: "cpu", Path: "$.metrics.metrics_collected.cpu"},
+		{Collector: "cpu usage_idle", Path: "$.metrics.metrics_collected.cpu.measurement[0]"},
+		{Collector: "cpu usage_iowait", Path: "$.metrics.metrics_collected.cpu.measurement[1]"},
+	}, Diff(workers, defaults).Dropped()[:3])
+}
+
+func TestCheckPlan(t *testing.T) {
+	findings := CheckPlan(plantest.Load(t, "testdata/plan.json").Plan(t), template(t))
+	assert.Empty(t, findings, findings.String())
+
+	tests := []struct {
+		name   string
+		breaks func(t *testing.T, f plantest.Fixture)
+		want   []plantest.Expected
+	}{
+		{
+			name: "not JSON",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, asgParameter)["value"] = `{"agent": {`
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleSchema, asgParameter).At("$")},
+		},
+		{
+			name: "known after apply",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				delete(f.Values(t, asgParameter), "value")
+			},
+			want: []plantest.Expected{plantest.Want(finding.Low, RuleSchema, asgParameter).At("value")},
+		},
+		{
+			name: "schema",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				config(t, f, workersParameter, func(c map[string]interface{}) {
+					section(c, "agent")["metrics_collection_interval"] = "60"
+					mc := section(c, "metrics", "metrics_collected")
+					mc["memory"] = mc["mem"]
+					section(c, "metrics", "metrics_collected", "cpu")["measurement"] = []interface{}{"cpu_usage_idle", 5, map[string]interface{}{"rename": "IDLE"}}
+					entry(c, 1)["timezone"] = "utc"
+					delete(entry(c, 2), "file_path")
+				})
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.High, RuleSchema, workersParameter).At("$.agent.metrics_collection_interval"),
+				plantest.Want(finding.High, RuleSchema, workersParameter).At("$.metrics.metrics_collected.memory"),
+				plantest.Want(finding.High, RuleSchema, workersParameter).At("$.metrics.metrics_collected.cpu.measurement[1]"),
+				plantest.Want(finding.High, RuleSchema, workersParameter).At("$.metrics.metrics_collected.cpu.measurement[2]"),
+				plantest.Want(finding.High, RuleSchema, workersParameter).At("$.logs.logs_collected.files.collect_list[1].timezone"),
+				plantest.Want(finding.High, RuleSchema, workersParameter).At("$.logs.logs_collected.files.collect_list[2]"),
+			},
+		},
+		{
+			name: "override drops default collectors",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				config(t, f, workersParameter, func(c map[string]interface{}) {
+					delete(section(c, "metrics", "metrics_collected"), "mem")
+					section(c, "metrics", "metrics_collected", "disk")["measurement"] = []interface{}{"inodes_free"}
+					section(c, "logs", "logs_collected", "files")["collect_list"] = collectList(c)[1:]
+				})
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.Medium, RuleCollectors, workersParameter).At("$.metrics.metrics_collected.mem"),
+				plantest.Want(finding.Medium, RuleCollectors, workersParameter).At("$.metrics.metrics_collected.disk.measurement[0]"),
+				plantest.Want(finding.Medium, RuleCollectors, workersParameter).At("$.logs.logs_collected.files.collect_list[0]"),
+			},
+		},
+		{
+			name: "retention",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				config(t, f, workersParameter, func(c map[string]interface{}) {
+					entry(c, 1)["retention_in_days"] = 10
+					entry(c, 2)["log_group_name"] = "workers/messages"
+					entry(c, 2)["retention_in_days"] = 30
+				})
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.High, RuleRetention, workersParameter).At("$.logs.logs_collected.files.collect_list[1].retention_in_days"),
+				plantest.Want(finding.High, RuleRetention, workersParameter).At("$.logs.logs_collected.files.collect_list[2].retention_in_days"),
+			},
+		},
+		{
+			name: "template escape left in",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				// What file() instead of templatefile() hands the agent.
+				config(t, f, asgParameter, func(c map[string]interface{}) {
+					section(c, "metrics", "append_dimensions")["InstanceId"] = "$${aws:InstanceId}"
+				})
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RulePlaceholder, asgParameter).At("$.metrics.append_dimensions.InstanceId")},
+		},
+		{
+			name: "unrendered interpolation",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				config(t, f, asgParameter, func(c map[string]interface{}) {
+					entry(c, 0)["log_group_name"] = "${autoscaling_group_name}/messages"
+				})
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RulePlaceholder, asgParameter).At("$.logs.logs_collected.files.collect_list[0].log_group_name")},
+		},
+		{
+			name: "append_dimensions",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				config(t, f, workersParameter, func(c map[string]interface{}) {
+					dims := section(c, "metrics", "append_dimensions")
+					dims["Environment"] = "prod"
+					dims["ImageId"] = "${aws:InstanceId}"
+					entry(c, 1)["log_stream_name"] = "${aws:InstanceId}"
+				})
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.High, RulePlaceholder, workersParameter).At("$.metrics.append_dimensions.Environment"),
+				plantest.Want(finding.High, RulePlaceholder, workersParameter).At("$.metrics.append_dimensions.ImageId"),
+				plantest.Want(finding.High, RulePlaceholder, workersParameter).At("$.logs.logs_collected.files.collect_list[1].log_stream_name"),
+			},
+		},
+		{
+			name: "log names",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				config(t, f, workersParameter, func(c map[string]interface{}) {
+					entry(c, 0)["log_stream_name"] = "{instance-id}"
+					entry(c, 1)["log_group_name"] = "workers ecs agent"
+				})
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.Medium, RulePlaceholder, workersParameter).At("$.logs.logs_collected.files.collect_list[0].log_stream_name"),
+				plantest.Want(finding.High, RuleLogs, workersParameter).At("$.logs.logs_collected.files.collect_list[1].log_group_name"),
+			},
+		},
+		{
+			name: "file collected twice",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				config(t, f, workersParameter, func(c map[string]interface{}) {
+					section(c, "logs", "logs_collected", "files")["collect_list"] = append(collectList(c), map[string]interface{}{
+						"file_path":      "/var/log/messages",
+						"log_group_name": "workers/messages",
+					})
+				})
+			},
+			want: []plantest.Expected{plantest.Want(finding.Medium, RuleLogs, workersParameter).At("$.logs.logs_collected.files.collect_list[3].file_path")},
+		},
+		{
+			name: "aggregation dimensions",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				config(t, f, asgParameter, func(c map[string]interface{}) {
+					section(c, "metrics")["aggregation_dimensions"] = []interface{}{[]interface{}{"InstanceID"}}
+				})
+				config(t, f, workersParameter, func(c map[string]interface{}) {
+					delete(section(c, "metrics", "metrics_collected"), "statsd")
+					section(c, "metrics")["aggregation_dimensions"] = []interface{}{[]interface{}{"AutoScalingGroupName", "Cluster"}, []interface{}{"path"}}
+				})
+			},
+			want: []plantest.Expected{
+				// statsd metrics may carry any tag.
+				plantest.Want(finding.Low, RuleDimensions, asgParameter).At("$.metrics.aggregation_dimensions[0][0]"),
+				plantest.Want(finding.Medium, RuleDimensions, workersParameter).At("$.metrics.aggregation_dimensions[0][1]"),
+				plantest.Want(finding.Medium, RuleCollectors, workersParameter).At("$.metrics.metrics_collected.statsd"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := plantest.Load(t, "testdata/plan.json")
+			tt.breaks(t, f)
+			findings := CheckPlan(f.Plan(t), template(t))
+			plantest.AssertFindings(t, tt.want, findings)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// Package cwagent validates CloudWatch agent configurations, as
+// aws-ec2-asg renders them from cloudwatch-config.tftpl (or takes them
+// from its cloudwatch_config input) into the SSM parameter the
+// AmazonCloudWatch-ManageAgent association hands the agent. The agent
+// only reads the parameter on the instance, so a configuration it cannot
+// use shows up as metrics and logs that never arrive.
+//
+// Render evaluates the template the way Terraform's templatefile does.
+// Parse checks a configuration against a model of the agent's schema,
+// and Check adds the rules the schema cannot express: retention values,
+// ${aws:...} and {instance_id} placeholders, aggregation dimensions and,
+// when given the module's defaults, the collectors an override drops.
+// Findings about the document carry JSON paths such as
+// $.metrics.append_dimensions.InstanceId.
+package cwagent
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+// functions are the Terraform functions templates may call.
+var functions = map[string]function.Function{
+	"jsonencode": stdlib.JSONEncodeFunc,
+	"jsondecode": stdlib.JSONDecodeFunc,
+	"format":     stdlib.FormatFunc,
+	"join":       stdlib.JoinFunc,
+	"lower":      stdlib.LowerFunc,
+	"upper":      stdlib.UpperFunc,
+	"replace":    stdlib.ReplaceFunc,
+	"tostring":   stdlib.MakeToFunc(cty.String),
+	"tonumber":   stdlib.MakeToFunc(cty.Number),
+}
+
+// Render evaluates the template src, named filename in errors, with the
+// string variables vars, as templatefile(filename, vars) would.
+func Render(src []byte, filename string, vars map[string]string) (string, error) {
+	expr, diags := hclsyntax.ParseTemplate(src, filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return "", fmt.Errorf("parsing template: %s", diags.Error())
+	}
+	values := make(map[string]cty.Value, len(vars))
+	for k, v := range vars {
+		values[k] = cty.StringVal(v)
+	}
+	for _, traversal := range expr.Variables() {
+		if name := traversal.RootName(); values[name] == cty.NilVal {
+			return "", fmt.Errorf("%s: vars map does not contain key %q, referenced at %s", filename, name, traversal.SourceRange())
+		}
+	}
+	out, diags := expr.Value(&hcl.EvalContext{Variables: values, Functions: functions})
+	if diags.HasErrors() {
+		return "", fmt.Errorf("rendering template: %s", diags.Error())
+	}
+	if out.IsNull() || !out.Type().Equals(cty.String) {
+		return "", fmt.Errorf("%s: template result is %s, not a string", filename, out.Type().FriendlyName())
+	}
+
+	return out.AsString(), nil
+}
+
+// RenderFile reads and renders the template at path.
+func RenderFile(path string, vars map[string]string) (string, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return Render(src, path, vars)
+}
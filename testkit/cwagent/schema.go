@@ -0,0 +1,365 @@
+package cwagent
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/internal/hint"
+)
+
+// RuleSchema is reported for configurations that do not match the agent
+// schema model: invalid JSON, unknown fields, wrong types, missing
+// required fields and values outside an enumeration.
+const RuleSchema = "cwagent-schema"
+
+type kind int
+
+const (
+	stringKind kind = iota
+	integerKind
+	boolKind
+	objectKind
+	arrayKind
+	// mapKind is an object of arbitrary keys, such as append_dimensions.
+	mapKind
+	// anyKind accepts any value; the model does not describe it.
+	anyKind
+)
+
+var kindNames = map[kind]string{
+	stringKind:  "a string",
+	integerKind: "an integer",
+	boolKind:    "a boolean",
+	objectKind:  "an object",
+	arrayKind:   "an array",
+	mapKind:     "an object",
+	anyKind:     "any value",
+}
+
+// schema models a value of the agent configuration.
+type schema struct {
+	kind     kind
+	fields   map[string]*schema
+	required []string
+	elem     *schema
+	enum     []string
+	// or is an alternative form of the value, as for measurement entries,
+	// which are a metric name or an object that renames it.
+	or *schema
+}
+
+var (
+	str     = &schema{kind: stringKind}
+	integer = &schema{kind: integerKind}
+	boolean = &schema{kind: boolKind}
+	strs    = array(str)
+	strMap  = &schema{kind: mapKind, elem: str}
+	anyJSON = &schema{kind: anyKind}
+)
+
+func object(fields map[string]*schema, required ...string) *schema {
+	return &schema{kind: objectKind, fields: fields, required: required}
+}
+
+func array(elem *schema) *schema { return &schema{kind: arrayKind, elem: elem} }
+
+func enum(values ...string) *schema { return &schema{kind: stringKind, enum: values} }
+
+var credentials = object(map[string]*schema{"role_arn": str})
+
+// measurement is a metric to collect, by name or renamed.
+var measurement = array(&schema{kind: stringKind, or: object(map[string]*schema{
+	"name":   str,
+	"rename": str,
+	"unit":   str,
+}, "name")})
+
+// plugin returns the model of a metrics_collected section with the
+// fields every plugin takes and extra.
+func plugin(extra map[string]*schema) *schema {
+	fields := map[string]*schema{
+		"measurement":                 measurement,
+		"metrics_collection_interval": integer,
+		"append_dimensions":           strMap,
+		"drop_original_metrics":       strs,
+	}
+	for k, v := range extra {
+		fields[k] = v
+	}
+
+	return object(fields)
+}
+
+// logFile is an entry of logs.logs_collected.files.collect_list.
+var logFile = object(map[string]*schema{
+	"file_path":                str,
+	"auto_removal":             boolean,
+	"backpressure_mode":        enum("fd_release"),
+	"encoding":                 str,
+	"filters":                  array(object(map[string]*schema{"type": enum("include", "exclude"), "expression": str}, "type", "expression")),
+	"log_group_class":          enum("STANDARD", "INFREQUENT_ACCESS"),
+	"log_group_name":           str,
+	"log_stream_name":          str,
+	"multi_line_start_pattern": str,
+	"publish_multi_logs":       boolean,
+	"retention_in_days":        integer,
+	"timestamp_format":         str,
+	"timezone":                 enum("Local", "UTC"),
+	"trim_timestamp":           boolean,
+}, "file_path")
+
+// configuration is the model of an agent configuration file, after
+// https://docs.aws.amazon.com/AmazonCloudWatch/latest/monitoring/CloudWatch-Agent-Configuration-File-Details.html.
+var configuration = object(map[string]*schema{
+	"agent": object(map[string]*schema{
+		"aws_sdk_log_level":           str,
+		"credentials":                 credentials,
+		"debug":                       boolean,
+		"logfile":                     str,
+		"metrics_collection_interval": integer,
+		"omit_hostname":               boolean,
+		"region":                      str,
+		"run_as_user":                 str,
+		"usage_data":                  boolean,
+		"user_agent":                  str,
+	}),
+	"metrics": object(map[string]*schema{
+		"aggregation_dimensions": array(strs),
+		"append_dimensions":      strMap,
+		"credentials":            credentials,
+		"endpoint_override":      str,
+		"force_flush_interval":   integer,
+		"metrics_destinations":   anyJSON,
+		"namespace":              str,
+		"metrics_collected": object(map[string]*schema{
+			"collectd": object(map[string]*schema{
+				"collectd_auth_file":           str,
+				"collectd_security_level":      enum("encrypt", "sign", "none"),
+				"collectd_typesdb":             strs,
+				"metrics_aggregation_interval": integer,
+				"name_prefix":                  str,
+				"service_address":              str,
+			}),
+			"cpu": plugin(map[string]*schema{
+				"resources": strs,
+				"totalcpu":  boolean,
+			}),
+			"disk": plugin(map[string]*schema{
+				"drop_device":              boolean,
+				"ignore_file_system_types": strs,
+				"resources":                strs,
+			}),
+			"diskio": plugin(map[string]*schema{"resources": strs}),
+			"ethtool": object(map[string]*schema{
+				"interface_exclude": strs,
+				"interface_include": strs,
+				"metrics_include":   strs,
+			}),
+			"mem":        plugin(nil),
+			"net":        plugin(map[string]*schema{"resources": strs}),
+			"netstat":    plugin(nil),
+			"nvidia_gpu": plugin(nil),
+			"processes":  plugin(nil),
+			"procstat": array(plugin(map[string]*schema{
+				"exe":      str,
+				"pattern":  str,
+				"pid_file": str,
+			})),
+			"statsd": object(map[string]*schema{
+				"allowed_pending_messages":     integer,
+				"metrics_aggregation_interval": integer,
+				"metrics_collection_interval":  integer,
+				"service_address":              str,
+			}),
+			"swap": plugin(nil),
+		}),
+	}, "metrics_collected"),
+	"logs": object(map[string]*schema{
+		"credentials":          credentials,
+		"endpoint_override":    str,
+		"force_flush_interval": integer,
+		"log_stream_name":      str,
+		"logs_collected": object(map[string]*schema{
+			"files": object(map[string]*schema{"collect_list": array(logFile)}, "collect_list"),
+			"windows_events": object(map[string]*schema{"collect_list": array(object(map[string]*schema{
+				"event_format":      enum("xml", "text"),
+				"event_levels":      array(enum("VERBOSE", "INFORMATION", "WARNING", "ERROR", "CRITICAL")),
+				"event_name":        str,
+				"log_group_class":   enum("STANDARD", "INFREQUENT_ACCESS"),
+				"log_group_name":    str,
+				"log_stream_name":   str,
+				"retention_in_days": integer,
+			}, "event_name", "event_levels", "log_group_name"))}, "collect_list"),
+		}),
+		"metrics_collected": anyJSON,
+	}),
+	"traces": anyJSON,
+})
+
+// validate reports where v does not match s. path is the JSON path of v.
+func (s *schema) validate(path string, v interface{}, add func(path, format string, args ...interface{})) {
+	if s.or != nil && !s.fits(v) {
+		if !s.or.fits(v) {
+			add(path, "must be %s or %s, not %s", kindNames[s.kind], kindNames[s.or.kind], describe(v))
+			return
+		}
+		s.or.validate(path, v, add)
+		return
+	}
+	switch s.kind {
+	case stringKind:
+		str, ok := v.(string)
+		switch {
+		case !ok:
+			add(path, "must be a string, not %s", describe(v))
+		case len(s.enum) > 0 && !contains(s.enum, str):
+			add(path, "must be one of %s, not %q%s", strings.Join(s.enum, ", "), str, hint.DidYouMean(str, s.enum))
+		}
+	case integerKind:
+		n, ok := v.(float64)
+		switch {
+		case !ok:
+			add(path, "must be an integer, not %s", describe(v))
+		case n != float64(int64(n)):
+			add(path, "must be an integer, not %v", n)
+		}
+	case boolKind:
+		if _, ok := v.(bool); !ok {
+			add(path, "must be a boolean, not %s", describe(v))
+		}
+	case arrayKind:
+		items, ok := v.([]interface{})
+		if !ok {
+			add(path, "must be an array, not %s", describe(v))
+			return
+		}
+		for i, item := range items {
+			s.elem.validate(fmt.Sprintf("%s[%d]", path, i), item, add)
+		}
+	case mapKind:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			add(path, "must be an object, not %s", describe(v))
+			return
+		}
+		for _, k := range sortedKeys(m) {
+			s.elem.validate(path+"."+k, m[k], add)
+		}
+	case objectKind:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			add(path, "must be an object, not %s", describe(v))
+			return
+		}
+		for _, k := range sortedKeys(m) {
+			field, known := s.fields[k]
+			if !known {
+				add(path+"."+k, "unknown field %q%s", k, hint.DidYouMean(k, s.fieldNames()))
+				continue
+			}
+			field.validate(path+"."+k, m[k], add)
+		}
+		for _, k := range s.required {
+			if _, ok := m[k]; !ok {
+				add(path, "missing required field %q", k)
+			}
+		}
+	}
+}
+
+// fits reports whether v has the JSON type of s, regardless of its
+// content.
+func (s *schema) fits(v interface{}) bool {
+	switch v.(type) {
+	case string:
+		return s.kind == stringKind
+	case float64:
+		return s.kind == integerKind
+	case bool:
+		return s.kind == boolKind
+	case []interface{}:
+		return s.kind == arrayKind
+	case map[string]interface{}:
+		return s.kind == objectKind || s.kind == mapKind
+	}
+
+	return s.kind == anyKind
+}
+
+func describe(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("string %q", v)
+	case float64:
+		return fmt.Sprintf("number %v", v)
+	case bool:
+		return fmt.Sprintf("boolean %v", v)
+	case []interface{}:
+		return "an array"
+	}
+
+	return "an object"
+}
+
+// Parse parses an agent configuration, reporting where it does not match
+// the schema model. Findings carry the JSON path of the offending value,
+// such as $.logs.logs_collected.files.collect_list[0].file_path, and no
+// address. The configuration is returned as far as it could be decoded,
+// or nil when it is not JSON.
+func Parse(data []byte) (*Config, finding.List) {
+	var findings finding.List
+	add := func(path, format string, args ...interface{}) {
+		findings = append(findings, finding.Finding{Severity: finding.High, Rule: RuleSchema, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		add("$", "agent configuration is not valid JSON: %v", err)
+		return nil, findings
+	}
+	configuration.validate("$", doc, add)
+
+	c := &Config{}
+	// Type errors were reported above; decode what does fit.
+	_ = json.Unmarshal(data, c)
+	if m, ok := doc.(map[string]interface{}); ok {
+		c.doc = m
+	}
+
+	return c, findings
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (s *schema) fieldNames() []string {
+	names := make([]string, 0, len(s.fields))
+	for name := range s.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,414 @@
+package ecstaskdef
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/internal/hint"
+)
+
+// Rule identifiers reported by Check, besides RuleSchema.
+const (
+	RuleResources = "ecs-task-resources"
+	RulePorts     = "ecs-port-mapping"
+	RuleMounts    = "ecs-mount-point"
+	RuleFargate   = "ecs-fargate"
+	RuleNetwork   = "ecs-network-mode"
+	RuleLogging   = "ecs-log-configuration"
+	RuleSecrets   = "ecs-secret"
+)
+
+// fargateMemory lists the memory sizes in MiB Fargate allows for each
+// task CPU value, as a first size, last size and step.
+var fargateMemory = map[int][3]int{
+	256:   {512, 2048, 512},
+	512:   {1024, 4096, 1024},
+	1024:  {2048, 8192, 1024},
+	2048:  {4096, 16384, 1024},
+	4096:  {8192, 30720, 1024},
+	8192:  {16384, 61440, 4096},
+	16384: {32768, 122880, 8192},
+}
+
+// fargateLogDrivers are the log drivers Fargate supports.
+var fargateLogDrivers = []string{"awslogs", "splunk", "awsfirelens"}
+
+// awslogsOptions are the options of the awslogs log driver.
+var awslogsOptions = []string{
+	"awslogs-create-group", "awslogs-datetime-format", "awslogs-endpoint", "awslogs-group",
+	"awslogs-multiline-pattern", "awslogs-region", "awslogs-stream-prefix", "max-buffer-size", "mode",
+}
+
+var (
+	secretsManagerARN = regexp.MustCompile(`^arn:aws[a-z-]*:secretsmanager:[a-z0-9-]+:\d{12}:secret:[A-Za-z0-9/_+=.@-]+(:[^:]*:[^:]*:[^:]*)?$`)
+	parameterARN      = regexp.MustCompile(`^arn:aws[a-z-]*:ssm:[a-z0-9-]+:\d{12}:parameter/[A-Za-z0-9_./-]+$`)
+	parameterName     = regexp.MustCompile(`^/?[A-Za-z0-9_.-]+(/[A-Za-z0-9_.-]+)*$`)
+	secretLike        = regexp.MustCompile(`(?i)(password|passwd|secret|token|api_?key|private_?key)`)
+)
+
+// CheckPlan checks every task definition in p.
+func CheckPlan(p *tfjson.Plan) finding.List {
+	var findings finding.List
+	for _, td := range FromPlan(p) {
+		findings = append(findings, Check(td)...)
+	}
+	findings.Sort()
+
+	return findings
+}
+
+// Check parses the container definitions of td and checks them against
+// the model and against the task.
+func Check(td *TaskDefinition) finding.List {
+	var findings finding.List
+	add := func(s finding.Severity, rule, address, path, format string, args ...interface{}) {
+		findings = append(findings, finding.Finding{Severity: s, Rule: rule, Address: address, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if td.ContainerDefinitions == "" {
+		add(finding.Low, RuleSchema, td.Address, "container_definitions", "container definitions are known only after apply and were not checked")
+		return findings
+	}
+	containers, parsed := ParseContainers([]byte(td.ContainerDefinitions))
+	for _, f := range parsed {
+		f.Address = td.Address
+		findings = append(findings, f)
+	}
+
+	byName := map[string]Container{}
+	var names []string
+	for _, c := range containers {
+		if _, dup := byName[c.Name]; dup {
+			add(finding.High, RuleSchema, td.Address, cpath(c, "name"), "container name %q is used twice", c.Name)
+			continue
+		}
+		byName[c.Name] = c
+		names = append(names, c.Name)
+	}
+	essential := false
+	for _, c := range containers {
+		essential = essential || c.IsEssential()
+		for i, d := range c.DependsOn {
+			if _, ok := byName[d.ContainerName]; !ok {
+				add(finding.High, RuleSchema, td.Address, cpath(c, "dependsOn[%d].containerName", i), "dependsOn names unknown container %q%s", d.ContainerName, hint.DidYouMean(d.ContainerName, names))
+			}
+		}
+	}
+	if len(containers) > 0 && !essential {
+		add(finding.High, RuleSchema, td.Address, "$", "no container is essential")
+	}
+
+	checkResources(td, containers, add)
+	checkPorts(td, containers, byName, names, add)
+	checkMounts(td, containers, byName, names, add)
+	checkNetwork(td, containers, add)
+	checkLogging(td, containers, add)
+	checkSecrets(td, containers, add)
+
+	return findings
+}
+
+type addFunc func(s finding.Severity, rule, address, path, format string, args ...interface{})
+
+// cpath returns the JSON path of a field of container c.
+func cpath(c Container, format string, args ...interface{}) string {
+	return fmt.Sprintf("$[%d].", c.Index) + fmt.Sprintf(format, args...)
+}
+
+func checkResources(td *TaskDefinition, containers []Container, add addFunc) {
+	if td.Requires(Fargate) {
+		switch {
+		case td.CPU == 0 || td.Memory == 0:
+			add(finding.High, RuleResources, td.Address, "cpu", "Fargate tasks must set task cpu and memory")
+		default:
+			sizes, ok := fargateMemory[td.CPU]
+			switch {
+			case !ok:
+				add(finding.High, RuleResources, td.Address, "cpu", "Fargate does not offer %d CPU units; use 256, 512, 1024, 2048, 4096, 8192 or 16384", td.CPU)
+			case td.Memory < sizes[0] || td.Memory > sizes[1] || (td.Memory-sizes[0])%sizes[2] != 0:
+				add(finding.High, RuleResources, td.Address, "memory", "Fargate does not offer %d MiB with %d CPU units; use %d to %d MiB in steps of %d", td.Memory, td.CPU, sizes[0], sizes[1], sizes[2])
+			}
+		}
+	}
+
+	cpu, memory := 0, 0
+	for _, c := range containers {
+		cpu += c.CPU
+		switch {
+		case c.Memory > 0:
+			memory += c.Memory
+		case c.MemoryReservation > 0:
+			memory += c.MemoryReservation
+		case td.Memory == 0:
+			add(finding.High, RuleResources, td.Address, cpath(c, "memory"), "container %s needs memory or memoryReservation when the task sets no memory", c.Name)
+		}
+		if c.Memory > 0 && c.MemoryReservation > c.Memory {
+			add(finding.High, RuleResources, td.Address, cpath(c, "memoryReservation"), "memoryReservation %d exceeds memory %d", c.MemoryReservation, c.Memory)
+		}
+	}
+	if td.CPU > 0 && cpu > td.CPU {
+		add(finding.High, RuleResources, td.Address, "cpu", "containers reserve %d CPU units, more than the task's %d", cpu, td.CPU)
+	}
+	if td.Memory > 0 && memory > td.Memory {
+		add(finding.High, RuleResources, td.Address, "memory", "containers need %d MiB, more than the task's %d", memory, td.Memory)
+	}
+}
+
+func checkPorts(td *TaskDefinition, containers []Container, byName map[string]Container, names []string, add addFunc) {
+	// In awsvpc mode the containers of a task share one network namespace.
+	owner := map[string]string{}
+	for _, c := range containers {
+		for i, pm := range c.PortMappings {
+			path := cpath(c, "portMappings[%d]", i)
+			protocol := pm.Protocol
+			if protocol == "" {
+				protocol = "tcp"
+			}
+			if protocol != "tcp" && protocol != "udp" {
+				add(finding.High, RulePorts, td.Address, path+".protocol", "protocol must be tcp or udp, not %q", pm.Protocol)
+			}
+			if td.NetworkMode == AWSVPC && pm.HostPort != 0 && pm.HostPort != pm.ContainerPort {
+				add(finding.High, RulePorts, td.Address, path+".hostPort", "hostPort %d must equal containerPort %d or be omitted in awsvpc mode", pm.HostPort, pm.ContainerPort)
+			}
+			if pm.ContainerPort == 0 {
+				continue
+			}
+			key := fmt.Sprintf("%d/%s", pm.ContainerPort, protocol)
+			if other, taken := owner[key]; taken && (td.NetworkMode == AWSVPC || other == c.Name) {
+				add(finding.High, RulePorts, td.Address, path+".containerPort", "port %s is already mapped by container %s", key, other)
+			} else if !taken {
+				owner[key] = c.Name
+			}
+		}
+	}
+
+	for _, t := range td.Targets {
+		path := fmt.Sprintf("load_balancer[%s]", t.ContainerName)
+		c, ok := byName[t.ContainerName]
+		if !ok {
+			add(finding.High, RulePorts, t.Service, path+".container_name", "load balancer target names unknown container %q%s", t.ContainerName, hint.DidYouMean(t.ContainerName, names))
+			continue
+		}
+		var ports []string
+		found := false
+		for _, pm := range c.PortMappings {
+			found = found || pm.ContainerPort == t.ContainerPort && pm.Protocol != "udp"
+			ports = append(ports, fmt.Sprint(pm.ContainerPort))
+		}
+		if !found {
+			mapped := "no ports"
+			if len(ports) > 0 {
+				mapped = "only " + strings.Join(ports, ", ")
+			}
+			add(finding.High, RulePorts, t.Service, path+".container_port", "container %s does not map TCP port %d; its portMappings have %s", c.Name, t.ContainerPort, mapped)
+		}
+	}
+}
+
+func checkMounts(td *TaskDefinition, containers []Container, byName map[string]Container, names []string, add addFunc) {
+	declared := map[string]bool{}
+	var volumes []string
+	for _, v := range td.Volumes {
+		declared[v.Name] = true
+		volumes = append(volumes, v.Name)
+	}
+	used := map[string]bool{}
+	for _, c := range containers {
+		paths := map[string]bool{}
+		for i, m := range c.MountPoints {
+			path := cpath(c, "mountPoints[%d]", i)
+			used[m.SourceVolume] = true
+			if m.SourceVolume != "" && !declared[m.SourceVolume] {
+				why := hint.DidYouMean(m.SourceVolume, volumes)
+				if len(volumes) == 0 {
+					why = "; the task declares no volumes"
+				}
+				add(finding.High, RuleMounts, td.Address, path+".sourceVolume", "mount point uses undeclared volume %q%s", m.SourceVolume, why)
+			}
+			if paths[m.ContainerPath] {
+				add(finding.High, RuleMounts, td.Address, path+".containerPath", "%s is mounted twice", m.ContainerPath)
+			}
+			paths[m.ContainerPath] = true
+		}
+		for i, v := range c.VolumesFrom {
+			if _, ok := byName[v.SourceContainer]; !ok || v.SourceContainer == c.Name {
+				add(finding.High, RuleMounts, td.Address, cpath(c, "volumesFrom[%d].sourceContainer", i), "volumesFrom names %q, which is not another container of the task%s", v.SourceContainer, hint.DidYouMean(v.SourceContainer, names))
+			}
+		}
+	}
+	for _, v := range td.Volumes {
+		if !used[v.Name] {
+			add(finding.Low, RuleMounts, td.Address, fmt.Sprintf("volume[%s]", v.Name), "volume %s is not mounted by any container", v.Name)
+		}
+	}
+}
+
+// setting is a container field and whether it is set.
+type setting struct {
+	field string
+	set   bool
+}
+
+func checkNetwork(td *TaskDefinition, containers []Container, add addFunc) {
+	fargate := td.Requires(Fargate)
+	if fargate {
+		if td.NetworkMode != AWSVPC {
+			add(finding.High, RuleFargate, td.Address, "network_mode", "Fargate requires network_mode awsvpc, not %q", td.NetworkMode)
+		}
+		if td.PlacementConstraints > 0 {
+			add(finding.High, RuleFargate, td.Address, "placement_constraints", "Fargate does not support placement constraints")
+		}
+		for _, v := range td.Volumes {
+			if v.Docker {
+				add(finding.High, RuleFargate, td.Address, fmt.Sprintf("volume[%s].docker_volume_configuration", v.Name), "Fargate does not support Docker volumes; leave out docker_volume_configuration for a bind mount")
+			}
+		}
+	}
+
+	for _, c := range containers {
+		if td.NetworkMode == AWSVPC {
+			for _, f := range []setting{
+				{"links", len(c.Links) > 0},
+				{"hostname", c.Hostname != ""},
+				{"extraHosts", len(c.ExtraHosts) > 0},
+				{"dnsServers", len(c.DNSServers) > 0},
+				{"dnsSearchDomains", len(c.DNSSearchDomains) > 0},
+			} {
+				if f.set {
+					add(finding.High, RuleNetwork, td.Address, cpath(c, f.field), "%s is not supported in awsvpc network mode", f.field)
+				}
+			}
+		}
+		if !fargate {
+			continue
+		}
+		lp := c.LinuxParameters
+		if lp == nil {
+			lp = &LinuxParameters{}
+		}
+		for _, f := range []setting{
+			{"privileged", c.Privileged},
+			{"dockerSecurityOptions", len(c.DockerSecurity) > 0},
+			{"linuxParameters.devices", len(lp.Devices) > 0},
+			{"linuxParameters.sharedMemorySize", lp.SharedMemorySize > 0},
+			{"linuxParameters.tmpfs", len(lp.Tmpfs) > 0},
+			{"linuxParameters.maxSwap", lp.MaxSwap != nil},
+			{"linuxParameters.swappiness", lp.Swappiness != nil},
+		} {
+			if f.set {
+				add(finding.High, RuleFargate, td.Address, cpath(c, f.field), "Fargate does not support %s", f.field)
+			}
+		}
+		if lp.Capabilities != nil {
+			for i, capability := range lp.Capabilities.Add {
+				if capability != "SYS_PTRACE" {
+					add(finding.High, RuleFargate, td.Address, cpath(c, "linuxParameters.capabilities.add[%d]", i), "Fargate can only add the SYS_PTRACE capability, not %s", capability)
+				}
+			}
+		}
+	}
+}
+
+func checkLogging(td *TaskDefinition, containers []Container, add addFunc) {
+	firelens := false
+	for _, c := range containers {
+		firelens = firelens || c.Firelens != nil
+	}
+	for _, c := range containers {
+		lc := c.LogConfiguration
+		if lc == nil {
+			if c.IsEssential() {
+				add(finding.Medium, RuleLogging, td.Address, cpath(c, "logConfiguration"), "essential container %s has no log configuration, so its output is lost", c.Name)
+			}
+			continue
+		}
+		path := cpath(c, "logConfiguration")
+		if td.Requires(Fargate) && !contains(fargateLogDrivers, lc.LogDriver) {
+			add(finding.High, RuleLogging, td.Address, path+".logDriver", "Fargate supports the %s log drivers, not %q", strings.Join(fargateLogDrivers, ", "), lc.LogDriver)
+		}
+		switch lc.LogDriver {
+		case "awsfirelens":
+			if !firelens {
+				add(finding.High, RuleLogging, td.Address, path+".logDriver", "awsfirelens needs a container with a firelensConfiguration")
+			}
+		case "awslogs":
+			required := []string{"awslogs-group", "awslogs-region"}
+			if td.Requires(Fargate) {
+				required = append(required, "awslogs-stream-prefix")
+			}
+			for _, o := range required {
+				if lc.Options[o] == "" {
+					add(finding.High, RuleLogging, td.Address, path+".options", "awslogs needs the %s option", o)
+				}
+			}
+			keys := make([]string, 0, len(lc.Options))
+			for k := range lc.Options {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if !contains(awslogsOptions, k) {
+					add(finding.High, RuleLogging, td.Address, path+".options."+k, "awslogs has no option %q%s", k, hint.DidYouMean(k, awslogsOptions))
+				}
+			}
+			if v, ok := lc.Options["awslogs-create-group"]; ok && v != "true" && v != "false" {
+				add(finding.High, RuleLogging, td.Address, path+".options.awslogs-create-group", "awslogs-create-group must be \"true\" or \"false\", not %q", v)
+			}
+		}
+	}
+}
+
+func checkSecrets(td *TaskDefinition, containers []Container, add addFunc) {
+	for _, c := range containers {
+		names := map[string]bool{}
+		for i, s := range c.Secrets {
+			names[s.Name] = true
+			checkValueFrom(td, cpath(c, "secrets[%d].valueFrom", i), s.ValueFrom, add)
+		}
+		if lc := c.LogConfiguration; lc != nil {
+			for i, s := range lc.SecretOptions {
+				checkValueFrom(td, cpath(c, "logConfiguration.secretOptions[%d].valueFrom", i), s.ValueFrom, add)
+			}
+		}
+		if rc := c.Credentials; rc != nil && !secretsManagerARN.MatchString(rc.Parameter) {
+			add(finding.High, RuleSecrets, td.Address, cpath(c, "repositoryCredentials.credentialsParameter"), "credentialsParameter must be a Secrets Manager secret ARN, not %q", rc.Parameter)
+		}
+		for i, e := range c.Environment {
+			path := cpath(c, "environment[%d]", i)
+			switch {
+			case names[e.Name]:
+				add(finding.High, RuleSecrets, td.Address, path+".name", "%s is set by both environment and secrets", e.Name)
+			case e.Value != "" && secretLike.MatchString(e.Name):
+				add(finding.Medium, RuleSecrets, td.Address, path+".value", "%s looks like a secret in plain text; reference it from secrets instead", e.Name)
+			}
+		}
+	}
+}
+
+// checkValueFrom reports a secret reference that is neither a Secrets
+// Manager secret ARN, optionally with a JSON key, version stage and
+// version ID, nor an SSM parameter ARN or name.
+func checkValueFrom(td *TaskDefinition, path, valueFrom string, add addFunc) {
+	switch {
+	case secretsManagerARN.MatchString(valueFrom), parameterARN.MatchString(valueFrom):
+	case strings.HasPrefix(valueFrom, "arn:"):
+		add(finding.High, RuleSecrets, td.Address, path, "%q is not a Secrets Manager secret or SSM parameter ARN", valueFrom)
+	case !parameterName.MatchString(valueFrom):
+		add(finding.High, RuleSecrets, td.Address, path, "%q is neither an ARN nor an SSM parameter name", valueFrom)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,259 @@
+package ecstaskdef
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan/plantest"
+)
+
+const (
+	taskDef = "module.api.aws_ecs_task_definition.this"
+	service = "module.api.aws_ecs_service.this"
+)
+
+// containers rewrites the container definitions of the task with edit,
+// which gets the app and nginx containers.
+func containers(t *testing.T, f plantest.Fixture, edit func(app, nginx map[string]interface{})) {
+	t.Helper()
+	v := f.Values(t, taskDef)
+	var cs []map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(v["container_definitions"].(string)), &cs))
+	edit(cs[0], cs[1])
+	data, err := json.Marshal(cs)
+	require.NoError(t, err)
+	v["container_definitions"] = string(data)
+}
+
+func logOptions(c map[string]interface{}) map[string]interface{} {
+	return c["logConfiguration"].(map[string]interface{})["options"].(map[string]interface{})
+}
+
+func TestFromPlan(t *testing.T) {
+	tds := FromPlan(plantest.Load(t, "testdata/plan.json").Plan(t))
+	require.Len(t, tds, 1)
+	td := tds[0]
+	assert.Equal(t, taskDef, td.Address)
+	assert.Equal(t, 512, td.CPU)
+	assert.Equal(t, 1024, td.Memory)
+	assert.True(t, td.Requires(Fargate))
+	assert.Equal(t, []Volume{{Name: "cache"}}, td.Volumes)
+	assert.Equal(t, []Target{{Service: service, ContainerName: "nginx", ContainerPort: 80}}, td.Targets)
+
+	assert.Equal(t, 2048, units("2 GB", "gb", 1024))
+	assert.Equal(t, 512, units("0.5 vCPU", "vcpu", 1024))
+	assert.Equal(t, 0, units("", "gb", 1024))
+}
+
+func TestParseContainers(t *testing.T) {
+	containers, findings := ParseContainers([]byte(`[
+		{"name": "app", "image": "app", "cpu": "256", "portMapping": [], "essential": "true",
+		 "portMappings": [{"containerPort": 80.5}], "dockerLabels": {"team": 7},
+		 "logConfiguration": {"options": {}}},
+		{"image": "sidecar"}
+	]`))
+	require.Len(t, containers, 2)
+	assert.Equal(t, 1, containers[1].Index)
+
+	var got []string
+	for _, f := range findings {
+		assert.Equal(t, RuleSchema, f.Rule)
+		got = append(got, f.Path+": "+f.Message)
+	}
+	assert.ElementsMatch(t, []string{
+		`$[0].cpu: must be an integer, not string "256"`,
+		`$[0].dockerLabels.team: must be a string, not number 7`,
+		`$[0].essential: must be a boolean, not string "true"`,
+		`$[0].logConfiguration: missing required field "logDriver"`,
+		`$[0].portMapping: unknown field "portMapping"; did you mean portMappings?`,
+		`$[0].portMappings[0].containerPort: must be an integer, not 80.5`,
+		`$[1]: missing required field "name"`,
+	}, got)
+
+	_, findings = ParseContainers([]byte(`{"name": "app"`))
+	require.Len(t, findings, 1)
+	assert.Equal(t, "$", findings[0].Path)
+}
+
+// The example's container definitions pass with the module's defaults:
+// awsvpc, no task cpu or memory, and the example's load balancer target.
+func TestExample(t *testing.T) {
+	data, err := os.ReadFile("../../modules/bananalab-ecs-service/examples/simple/container-definitions.json")
+	require.NoError(t, err)
+	td := &TaskDefinition{
+		Address:              "module.this.aws_ecs_task_definition.this",
+		ContainerDefinitions: string(data),
+		NetworkMode:          AWSVPC,
+		Targets:              []Target{{Service: "module.this.aws_ecs_service.this", ContainerName: "nginx", ContainerPort: 80}},
+	}
+	findings := Check(td)
+	assert.Empty(t, findings, findings.String())
+
+	td.Compatibilities = []string{Fargate}
+	var rules []string
+	for _, f := range Check(td) {
+		rules = append(rules, f.Rule)
+	}
+	assert.Equal(t, []string{RuleResources}, rules, "Fargate needs task cpu and memory")
+}
+
+func TestCheckPlan(t *testing.T) {
+	findings := CheckPlan(plantest.Load(t, "testdata/plan.json").Plan(t))
+	assert.Empty(t, findings, findings.String())
+
+	tests := []struct {
+		name   string
+		breaks func(t *testing.T, f plantest.Fixture)
+		want   []plantest.Expected
+	}{
+		{
+			name: "memory over the task's",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				containers(t, f, func(app, nginx map[string]interface{}) { nginx["memory"] = 512 })
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleResources, taskDef).At("memory")},
+		},
+		{
+			name: "cpu over the task's",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				containers(t, f, func(app, nginx map[string]interface{}) { app["cpu"] = 512 })
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleResources, taskDef).At("cpu")},
+		},
+		{
+			name: "invalid Fargate size",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, taskDef)["memory"] = "3000"
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleResources, taskDef).At("memory")},
+		},
+		{
+			name: "target port not mapped",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				lb := f.Values(t, service)["load_balancer"].([]interface{})[0].(map[string]interface{})
+				lb["container_port"] = 8080
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RulePorts, service).At("load_balancer[nginx].container_port")},
+		},
+		{
+			name: "target container misspelt",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				lb := f.Values(t, service)["load_balancer"].([]interface{})[0].(map[string]interface{})
+				lb["container_name"] = "ngnix"
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RulePorts, service).At("load_balancer[ngnix].container_name")},
+		},
+		{
+			name: "host port differs and port taken",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				containers(t, f, func(app, nginx map[string]interface{}) {
+					nginx["portMappings"] = []interface{}{
+						map[string]interface{}{"containerPort": 80, "hostPort": 8081},
+						map[string]interface{}{"containerPort": 8080},
+					}
+				})
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.High, RulePorts, taskDef).At("$[1].portMappings[0].hostPort"),
+				plantest.Want(finding.High, RulePorts, taskDef).At("$[1].portMappings[1].containerPort"),
+			},
+		},
+		{
+			name: "undeclared volume",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				containers(t, f, func(app, nginx map[string]interface{}) {
+					nginx["mountPoints"].([]interface{})[0].(map[string]interface{})["sourceVolume"] = "cahce"
+				})
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleMounts, taskDef).At("$[1].mountPoints[0].sourceVolume")},
+		},
+		{
+			name: "Fargate incompatible settings",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				containers(t, f, func(app, nginx map[string]interface{}) {
+					app["privileged"] = true
+					app["linuxParameters"] = map[string]interface{}{"capabilities": map[string]interface{}{"add": []interface{}{"NET_ADMIN"}}}
+					nginx["links"] = []interface{}{"app"}
+				})
+				volume := f.Values(t, taskDef)["volume"].([]interface{})[0].(map[string]interface{})
+				volume["docker_volume_configuration"] = []interface{}{map[string]interface{}{"scope": "task"}}
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.High, RuleFargate, taskDef).At("$[0].privileged"),
+				plantest.Want(finding.High, RuleFargate, taskDef).At("$[0].linuxParameters.capabilities.add[0]"),
+				plantest.Want(finding.High, RuleFargate, taskDef).At("volume[cache].docker_volume_configuration"),
+				plantest.Want(finding.High, RuleNetwork, taskDef).At("$[1].links"),
+			},
+		},
+		{
+			name: "log configuration",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				containers(t, f, func(app, nginx map[string]interface{}) {
+					delete(logOptions(app), "awslogs-stream-prefix")
+					logOptions(app)["awslogs-regoin"] = "us-west-1"
+					delete(nginx, "logConfiguration")
+				})
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.High, RuleLogging, taskDef).At("$[0].logConfiguration.options"),
+				plantest.Want(finding.High, RuleLogging, taskDef).At("$[0].logConfiguration.options.awslogs-regoin"),
+				plantest.Want(finding.Medium, RuleLogging, taskDef).At("$[1].logConfiguration"),
+			},
+		},
+		{
+			name: "Fargate log driver",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				containers(t, f, func(app, nginx map[string]interface{}) {
+					nginx["logConfiguration"] = map[string]interface{}{"logDriver": "json-file"}
+				})
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleLogging, taskDef).At("$[1].logConfiguration.logDriver")},
+		},
+		{
+			name: "secret references",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				containers(t, f, func(app, nginx map[string]interface{}) {
+					secrets := app["secrets"].([]interface{})
+					secrets[0].(map[string]interface{})["valueFrom"] = "arn:aws:secretsmanager:us-west-1:1234:secret:api/db"
+					secrets[2].(map[string]interface{})["valueFrom"] = "api sentry dsn"
+					app["environment"] = append(app["environment"].([]interface{}),
+						map[string]interface{}{"name": "API_TOKEN", "value": "x"},
+						map[string]interface{}{"name": "STRIPE_SECRET_KEY", "value": "sk_live_123"},
+					)
+				})
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.High, RuleSecrets, taskDef).At("$[0].secrets[0].valueFrom"),
+				plantest.Want(finding.High, RuleSecrets, taskDef).At("$[0].secrets[2].valueFrom"),
+				plantest.Want(finding.High, RuleSecrets, taskDef).At("$[0].environment[2].name"),
+				plantest.Want(finding.Medium, RuleSecrets, taskDef).At("$[0].environment[3].value"),
+			},
+		},
+		{
+			name: "schema and references",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				containers(t, f, func(app, nginx map[string]interface{}) {
+					app["memory"] = "768"
+					nginx["dependsOn"].([]interface{})[0].(map[string]interface{})["containerName"] = "api"
+				})
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.High, RuleSchema, taskDef).At("$[0].memory"),
+				plantest.Want(finding.High, RuleSchema, taskDef).At("$[1].dependsOn[0].containerName"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := plantest.Load(t, "testdata/plan.json")
+			tt.breaks(t, f)
+			findings := CheckPlan(f.Plan(t))
+			plantest.AssertFindings(t, tt.want, findings)
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package ecstaskdef
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/internal/hint"
+)
+
+// RuleSchema is reported for container definitions that do not match the
+// ContainerDefinition model: invalid JSON, unknown fields, wrong types and
+// missing required fields.
+const RuleSchema = "ecs-container-schema"
+
+type kind int
+
+const (
+	stringKind kind = iota
+	integerKind
+	boolKind
+	objectKind
+	arrayKind
+	// stringMapKind is an object of arbitrary string keys and values, such
+	// as dockerLabels.
+	stringMapKind
+)
+
+// schema models a value of the ECS ContainerDefinition API.
+type schema struct {
+	kind     kind
+	fields   map[string]*schema
+	required []string
+	elem     *schema
+}
+
+var (
+	str     = &schema{kind: stringKind}
+	integer = &schema{kind: integerKind}
+	boolean = &schema{kind: boolKind}
+	strMap  = &schema{kind: stringMapKind}
+	strs    = array(str)
+)
+
+func object(fields map[string]*schema, required ...string) *schema {
+	return &schema{kind: objectKind, fields: fields, required: required}
+}
+
+func array(elem *schema) *schema { return &schema{kind: arrayKind, elem: elem} }
+
+var (
+	nameValue = array(object(map[string]*schema{"name": str, "value": str}))
+	secrets   = array(object(map[string]*schema{"name": str, "valueFrom": str}, "name", "valueFrom"))
+)
+
+// containerDefinitions is the model of a container_definitions document,
+// after https://docs.aws.amazon.com/AmazonECS/latest/APIReference/API_ContainerDefinition.html.
+var containerDefinitions = array(object(map[string]*schema{
+	"name":  str,
+	"image": str,
+	"repositoryCredentials": object(map[string]*schema{
+		"credentialsParameter": str,
+	}, "credentialsParameter"),
+	"cpu":               integer,
+	"memory":            integer,
+	"memoryReservation": integer,
+	"links":             strs,
+	"portMappings": array(object(map[string]*schema{
+		"containerPort":      integer,
+		"hostPort":           integer,
+		"protocol":           str,
+		"name":               str,
+		"appProtocol":        str,
+		"containerPortRange": str,
+	})),
+	"essential": boolean,
+	"restartPolicy": object(map[string]*schema{
+		"enabled":              boolean,
+		"ignoredExitCodes":     array(integer),
+		"restartAttemptPeriod": integer,
+	}, "enabled"),
+	"entryPoint":  strs,
+	"command":     strs,
+	"environment": nameValue,
+	"environmentFiles": array(object(map[string]*schema{
+		"value": str,
+		"type":  str,
+	}, "value", "type")),
+	"mountPoints": array(object(map[string]*schema{
+		"sourceVolume":  str,
+		"containerPath": str,
+		"readOnly":      boolean,
+	}, "sourceVolume", "containerPath")),
+	"volumesFrom": array(object(map[string]*schema{
+		"sourceContainer": str,
+		"readOnly":        boolean,
+	}, "sourceContainer")),
+	"linuxParameters": object(map[string]*schema{
+		"capabilities": object(map[string]*schema{"add": strs, "drop": strs}),
+		"devices": array(object(map[string]*schema{
+			"hostPath":      str,
+			"containerPath": str,
+			"permissions":   strs,
+		}, "hostPath")),
+		"initProcessEnabled": boolean,
+		"sharedMemorySize":   integer,
+		"tmpfs": array(object(map[string]*schema{
+			"containerPath": str,
+			"size":          integer,
+			"mountOptions":  strs,
+		}, "containerPath", "size")),
+		"maxSwap":    integer,
+		"swappiness": integer,
+	}),
+	"secrets": secrets,
+	"dependsOn": array(object(map[string]*schema{
+		"containerName": str,
+		"condition":     str,
+	}, "containerName", "condition")),
+	"startTimeout":           integer,
+	"stopTimeout":            integer,
+	"versionConsistency":     str,
+	"hostname":               str,
+	"user":                   str,
+	"workingDirectory":       str,
+	"disableNetworking":      boolean,
+	"privileged":             boolean,
+	"readonlyRootFilesystem": boolean,
+	"dnsServers":             strs,
+	"dnsSearchDomains":       strs,
+	"extraHosts": array(object(map[string]*schema{
+		"hostname":  str,
+		"ipAddress": str,
+	}, "hostname", "ipAddress")),
+	"dockerSecurityOptions": strs,
+	"interactive":           boolean,
+	"pseudoTerminal":        boolean,
+	"dockerLabels":          strMap,
+	"ulimits": array(object(map[string]*schema{
+		"name":      str,
+		"softLimit": integer,
+		"hardLimit": integer,
+	}, "name", "softLimit", "hardLimit")),
+	"logConfiguration": object(map[string]*schema{
+		"logDriver":     str,
+		"options":       strMap,
+		"secretOptions": secrets,
+	}, "logDriver"),
+	"healthCheck": object(map[string]*schema{
+		"command":     strs,
+		"interval":    integer,
+		"timeout":     integer,
+		"retries":     integer,
+		"startPeriod": integer,
+	}, "command"),
+	"systemControls": array(object(map[string]*schema{
+		"namespace": str,
+		"value":     str,
+	})),
+	"resourceRequirements": array(object(map[string]*schema{
+		"value": str,
+		"type":  str,
+	}, "value", "type")),
+	"firelensConfiguration": object(map[string]*schema{
+		"type":    str,
+		"options": strMap,
+	}, "type"),
+	"credentialSpecs": strs,
+}, "name", "image"))
+
+// validate reports where v does not match s. path is the JSON path of v.
+func (s *schema) validate(path string, v interface{}, add func(path, format string, args ...interface{})) {
+	if v == nil {
+		// The provider drops nulls when it normalizes the document.
+		return
+	}
+	switch s.kind {
+	case stringKind:
+		if _, ok := v.(string); !ok {
+			add(path, "must be a string, not %s", describe(v))
+		}
+	case integerKind:
+		n, ok := v.(float64)
+		switch {
+		case !ok:
+			add(path, "must be an integer, not %s", describe(v))
+		case n != float64(int64(n)):
+			add(path, "must be an integer, not %v", n)
+		}
+	case boolKind:
+		if _, ok := v.(bool); !ok {
+			add(path, "must be a boolean, not %s", describe(v))
+		}
+	case arrayKind:
+		items, ok := v.([]interface{})
+		if !ok {
+			add(path, "must be an array, not %s", describe(v))
+			return
+		}
+		for i, item := range items {
+			s.elem.validate(fmt.Sprintf("%s[%d]", path, i), item, add)
+		}
+	case stringMapKind:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			add(path, "must be an object of strings, not %s", describe(v))
+			return
+		}
+		for _, k := range sortedKeys(m) {
+			str.validate(path+"."+k, m[k], add)
+		}
+	case objectKind:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			add(path, "must be an object, not %s", describe(v))
+			return
+		}
+		for _, k := range sortedKeys(m) {
+			field, known := s.fields[k]
+			if !known {
+				add(path+"."+k, "unknown field %q%s", k, hint.DidYouMean(k, s.fieldNames()))
+				continue
+			}
+			field.validate(path+"."+k, m[k], add)
+		}
+		for _, k := range s.required {
+			if _, ok := m[k]; !ok {
+				add(path, "missing required field %q", k)
+			}
+		}
+	}
+}
+
+func describe(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return fmt.Sprintf("string %q", v)
+	case float64:
+		return fmt.Sprintf("number %v", v)
+	case bool:
+		return fmt.Sprintf("boolean %v", v)
+	case []interface{}:
+		return "an array"
+	}
+
+	return "an object"
+}
+
+// ParseContainers parses a container_definitions document, reporting
+// where it does not match the ContainerDefinition model. Findings carry
+// the JSON path of the offending value, such as
+// $[0].portMappings[1].containerPort, and no address. Containers are
+// returned as far as they could be decoded.
+func ParseContainers(data []byte) ([]Container, finding.List) {
+	var findings finding.List
+	add := func(path, format string, args ...interface{}) {
+		findings = append(findings, finding.Finding{Severity: finding.High, Rule: RuleSchema, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		add("$", "container definitions are not valid JSON: %v", err)
+		return nil, findings
+	}
+	containerDefinitions.validate("$", doc, add)
+
+	var containers []Container
+	// Type errors were reported above; decode what does fit.
+	_ = json.Unmarshal(data, &containers)
+	for i := range containers {
+		containers[i].Index = i
+	}
+
+	return containers, findings
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (s *schema) fieldNames() []string {
+	names := make([]string, 0, len(s.fields))
+	for name := range s.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
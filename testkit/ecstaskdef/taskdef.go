@@ -0,0 +1,234 @@
+// Package ecstaskdef validates the container definitions of an
+// aws_ecs_task_definition, as built by bananalab-ecs-service from its
+// container_definitions JSON, against a model of the ECS
+// ContainerDefinition API and against the rest of the task: container
+// CPU and memory against the task's, the ports load_balancer_targets
+// register, the volumes mountPoints use, settings Fargate or the awsvpc
+// network mode reject, the log configuration and secret references.
+// Findings about the document carry JSON paths such as
+// $[0].portMappings[0].hostPort.
+package ecstaskdef
+
+import (
+	"strconv"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+// Resource types read from a plan.
+const (
+	TaskDefinitionType = "aws_ecs_task_definition"
+	ServiceType        = "aws_ecs_service"
+)
+
+// Launch types and network modes.
+const (
+	Fargate = "FARGATE"
+	EC2     = "EC2"
+	AWSVPC  = "awsvpc"
+)
+
+// Container is the part of a container definition the checks look at.
+type Container struct {
+	// Index is the position of the container in the document.
+	Index             int                    `json:"-"`
+	Name              string                 `json:"name"`
+	Image             string                 `json:"image"`
+	CPU               int                    `json:"cpu"`
+	Memory            int                    `json:"memory"`
+	MemoryReservation int                    `json:"memoryReservation"`
+	Essential         *bool                  `json:"essential"`
+	Links             []string               `json:"links"`
+	Hostname          string                 `json:"hostname"`
+	ExtraHosts        []interface{}          `json:"extraHosts"`
+	DNSServers        []string               `json:"dnsServers"`
+	DNSSearchDomains  []string               `json:"dnsSearchDomains"`
+	Privileged        bool                   `json:"privileged"`
+	DockerSecurity    []string               `json:"dockerSecurityOptions"`
+	PortMappings      []PortMapping          `json:"portMappings"`
+	MountPoints       []MountPoint           `json:"mountPoints"`
+	VolumesFrom       []VolumeFrom           `json:"volumesFrom"`
+	DependsOn         []Dependency           `json:"dependsOn"`
+	Environment       []NameValue            `json:"environment"`
+	Secrets           []Secret               `json:"secrets"`
+	LinuxParameters   *LinuxParameters       `json:"linuxParameters"`
+	LogConfiguration  *LogConfiguration      `json:"logConfiguration"`
+	Firelens          map[string]interface{} `json:"firelensConfiguration"`
+	Credentials       *struct {
+		Parameter string `json:"credentialsParameter"`
+	} `json:"repositoryCredentials"`
+}
+
+// IsEssential reports whether the task stops when the container does,
+// which is the default.
+func (c Container) IsEssential() bool { return c.Essential == nil || *c.Essential }
+
+// PortMapping is an entry of portMappings.
+type PortMapping struct {
+	ContainerPort int    `json:"containerPort"`
+	HostPort      int    `json:"hostPort"`
+	Protocol      string `json:"protocol"`
+	Name          string `json:"name"`
+}
+
+// MountPoint is an entry of mountPoints.
+type MountPoint struct {
+	SourceVolume  string `json:"sourceVolume"`
+	ContainerPath string `json:"containerPath"`
+	ReadOnly      bool   `json:"readOnly"`
+}
+
+// VolumeFrom is an entry of volumesFrom.
+type VolumeFrom struct {
+	SourceContainer string `json:"sourceContainer"`
+}
+
+// Dependency is an entry of dependsOn.
+type Dependency struct {
+	ContainerName string `json:"containerName"`
+	Condition     string `json:"condition"`
+}
+
+// NameValue is an entry of environment.
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Secret is an entry of secrets or of a log configuration's
+// secretOptions.
+type Secret struct {
+	Name      string `json:"name"`
+	ValueFrom string `json:"valueFrom"`
+}
+
+// LinuxParameters are the settings of linuxParameters checked for
+// Fargate.
+type LinuxParameters struct {
+	Capabilities *struct {
+		Add []string `json:"add"`
+	} `json:"capabilities"`
+	Devices          []interface{} `json:"devices"`
+	SharedMemorySize int           `json:"sharedMemorySize"`
+	Tmpfs            []interface{} `json:"tmpfs"`
+	MaxSwap          *int          `json:"maxSwap"`
+	Swappiness       *int          `json:"swappiness"`
+}
+
+// LogConfiguration is a container's logConfiguration.
+type LogConfiguration struct {
+	LogDriver     string            `json:"logDriver"`
+	Options       map[string]string `json:"options"`
+	SecretOptions []Secret          `json:"secretOptions"`
+}
+
+// Volume is a volume of the task.
+type Volume struct {
+	Name string
+	// Docker is set when the volume has a docker_volume_configuration.
+	Docker bool
+}
+
+// Target is a load_balancer block of a service running the task.
+type Target struct {
+	Service       string
+	ContainerName string
+	ContainerPort int
+}
+
+// TaskDefinition is a task definition and the load balancer targets of
+// the services that run it.
+type TaskDefinition struct {
+	Address string
+	// ContainerDefinitions is the container_definitions document, empty
+	// when it is known only after apply.
+	ContainerDefinitions string
+	NetworkMode          string
+	Compatibilities      []string
+	// CPU is in CPU units and Memory in MiB; zero when not set.
+	CPU                  int
+	Memory               int
+	Volumes              []Volume
+	PlacementConstraints int
+	Targets              []Target
+}
+
+// Requires reports whether the task requires launch type t.
+func (td *TaskDefinition) Requires(t string) bool {
+	for _, c := range td.Compatibilities {
+		if strings.EqualFold(c, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FromPlan returns the task definitions in p with the load balancer
+// targets of the services whose task_definition refers to them.
+func FromPlan(p *tfjson.Plan) []*TaskDefinition {
+	var out []*TaskDefinition
+	for _, r := range plan.ResourcesOfType(p, TaskDefinitionType) {
+		td := &TaskDefinition{
+			Address:              r.Address,
+			ContainerDefinitions: r.String("container_definitions"),
+			NetworkMode:          r.String("network_mode"),
+			Compatibilities:      r.Strings("requires_compatibilities"),
+			CPU:                  units(r.String("cpu"), "vcpu", 1024),
+			Memory:               units(r.String("memory"), "gb", 1024),
+			PlacementConstraints: len(r.Blocks("placement_constraints")),
+		}
+		for _, v := range r.Blocks("volume") {
+			vr := plan.Resource{Values: v}
+			td.Volumes = append(td.Volumes, Volume{Name: vr.String("name"), Docker: len(vr.Blocks("docker_volume_configuration")) > 0})
+		}
+		for _, s := range plan.ResourcesOfType(p, ServiceType) {
+			if !refersTo(plan.References(p, s, "task_definition"), r) {
+				continue
+			}
+			for _, lb := range s.Blocks("load_balancer") {
+				lr := plan.Resource{Values: lb}
+				td.Targets = append(td.Targets, Target{Service: s.Address, ContainerName: lr.String("container_name"), ContainerPort: int(lr.Number("container_port"))})
+			}
+		}
+		out = append(out, td)
+	}
+
+	return out
+}
+
+func refersTo(refs []string, r plan.Resource) bool {
+	base := r.Address
+	if i := strings.LastIndex(base, "["); i > strings.LastIndex(base, ".") {
+		base = base[:i]
+	}
+	for _, ref := range refs {
+		if ref == r.Address || ref == base {
+			return true
+		}
+	}
+
+	return false
+}
+
+// units parses a task cpu or memory value, which may be given in units
+// ("1024") or with a unit ("1 vCPU", "2 GB").
+func units(s, unit string, per int) int {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	fields := strings.Fields(s)
+	if len(fields) != 2 || !strings.EqualFold(fields[1], unit) {
+		return 0
+	}
+	f, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+
+	return int(f * float64(per))
+}
@@ -0,0 +1,117 @@
+// Package finding is the common result type of the checkers in this kit.
+// Each checker reports a List, and tests decide which severities fail the
+// build.
+package finding
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity ranks how serious a finding is.
+type Severity int
+
+const (
+	// Low findings are informational, for example a check that was skipped
+	// because a value is only known after apply.
+	Low Severity = iota + 1
+	// Medium findings are weaknesses that deserve review.
+	Medium
+	// High findings will fail at apply time, lose access or data, or
+	// silently break the feature the configuration is meant to provide.
+	High
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Low:
+		return "LOW"
+	case Medium:
+		return "MEDIUM"
+	case High:
+		return "HIGH"
+	}
+
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Finding is a single problem reported by a checker.
+type Finding struct {
+	Severity Severity
+	// Rule is a short, stable identifier for the check that fired.
+	Rule string
+	// Address is the Terraform address of the offending resource.
+	Address string
+	// Path locates the offending value inside the resource or input, for
+	// example content_policy_config.filters_config[2].input_strength.
+	Path    string
+	Message string
+}
+
+func (f Finding) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s", f.Severity, f.Rule)
+	if f.Address != "" {
+		fmt.Fprintf(&b, " %s", f.Address)
+	}
+	if f.Path != "" {
+		fmt.Fprintf(&b, " %s", f.Path)
+	}
+	fmt.Fprintf(&b, ": %s", f.Message)
+
+	return b.String()
+}
+
+// List is a set of findings.
+type List []Finding
+
+// AtLeast returns the findings whose severity is s or higher.
+func (l List) AtLeast(s Severity) List {
+	var out List
+	for _, f := range l {
+		if f.Severity >= s {
+			out = append(out, f)
+		}
+	}
+
+	return out
+}
+
+// ByRule returns the findings reported by rule.
+func (l List) ByRule(rule string) List {
+	var out List
+	for _, f := range l {
+		if f.Rule == rule {
+			out = append(out, f)
+		}
+	}
+
+	return out
+}
+
+// Sort orders the list by descending severity, then address, path and rule.
+func (l List) Sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		a, b := l[i], l[j]
+		if a.Severity != b.Severity {
+			return a.Severity > b.Severity
+		}
+		if a.Address != b.Address {
+			return a.Address < b.Address
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Rule < b.Rule
+	})
+}
+
+func (l List) String() string {
+	lines := make([]string, len(l))
+	for i, f := range l {
+		lines[i] = f.String()
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,23 @@
+module github.com/JQUINONES82/terraform_modules/testkit
+
+go 1.21
+
+require (
+	github.com/hashicorp/go-version v1.6.0
+	github.com/hashicorp/hcl/v2 v2.18.0
+	github.com/hashicorp/terraform-json v0.17.1
+	github.com/stretchr/testify v1.8.4
+	github.com/zclconf/go-cty v1.13.2
+	gopkg.in/yaml.v3 v3.0.1
+	mvdan.cc/sh/v3 v3.8.0
+)
+
+require (
+	github.com/agext/levenshtein v1.2.1 // indirect
+	github.com/apparentlymart/go-textseg/v13 v13.0.0 // indirect
+	github.com/apparentlymart/go-textseg/v15 v15.0.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/mitchellh/go-wordwrap v0.0.0-20150314170334-ad45545899c7 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/text v0.11.0 // indirect
+)
@@ -0,0 +1,105 @@
+package guardrail
+
+import "context"
+
+// Source says whether content is a prompt or a model response, as in the
+// ApplyGuardrail API.
+type Source string
+
+const (
+	SourceInput  Source = "INPUT"
+	SourceOutput Source = "OUTPUT"
+)
+
+// Actions reported by ApplyGuardrail.
+const (
+	ActionIntervened = "GUARDRAIL_INTERVENED"
+	ActionNone       = "NONE"
+
+	MatchBlocked    = "BLOCKED"
+	MatchAnonymized = "ANONYMIZED"
+)
+
+// Outcome summarizes what a guardrail did to a piece of content.
+type Outcome string
+
+const (
+	OutcomeBlocked    Outcome = "BLOCKED"
+	OutcomeAnonymized Outcome = "ANONYMIZED"
+	OutcomeNone       Outcome = "NONE"
+)
+
+// Request is the content passed to ApplyGuardrail.
+type Request struct {
+	Source Source
+	Text   string
+}
+
+// Response mirrors the parts of the ApplyGuardrail response the harness
+// uses.
+type Response struct {
+	// Action is ActionIntervened or ActionNone.
+	Action string
+	// Output is the text returned in place of the content when the
+	// guardrail intervened: the blocked message, or the anonymized text.
+	Output     string
+	Assessment Assessment
+}
+
+// Assessment lists what each policy matched.
+type Assessment struct {
+	Topics         []PolicyMatch
+	ContentFilters []PolicyMatch
+	Words          []PolicyMatch
+	ManagedWords   []PolicyMatch
+	PIIEntities    []PolicyMatch
+	Regexes        []PolicyMatch
+}
+
+// PolicyMatch is a single policy hit.
+type PolicyMatch struct {
+	// Name is the topic name, filter type, PII entity type, regex name or
+	// managed word list type.
+	Name string
+	// Match is the text that triggered the policy, when known.
+	Match string
+	// Action is MatchBlocked or MatchAnonymized.
+	Action string
+}
+
+func (a Assessment) all() []PolicyMatch {
+	var out []PolicyMatch
+	for _, l := range [][]PolicyMatch{a.Topics, a.ContentFilters, a.Words, a.ManagedWords, a.PIIEntities, a.Regexes} {
+		out = append(out, l...)
+	}
+
+	return out
+}
+
+// Outcome reduces the response to BLOCKED, ANONYMIZED or NONE.
+func (r Response) Outcome() Outcome {
+	if r.Action != ActionIntervened {
+		return OutcomeNone
+	}
+	anonymized := false
+	for _, m := range r.Assessment.all() {
+		switch m.Action {
+		case MatchBlocked:
+			return OutcomeBlocked
+		case MatchAnonymized:
+			anonymized = true
+		}
+	}
+	if anonymized {
+		return OutcomeAnonymized
+	}
+
+	return OutcomeNone
+}
+
+// Applier applies a guardrail version to content. LocalEvaluator is an
+// offline implementation; a thin adapter around the bedrock-runtime
+// ApplyGuardrail API is the live one.
+type Applier interface {
+	ApplyGuardrail(ctx context.Context, version string, req Request) (Response, error)
+}
@@ -0,0 +1,127 @@
+package guardrail
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// Length is an inclusive length range, with an optional regular expression
+// the value must match.
+type Length struct {
+	Min     int    `json:"min"`
+	Max     int    `json:"max"`
+	Pattern string `json:"pattern,omitempty"`
+
+	// re is Pattern compiled by ParseCatalog.
+	re *regexp.Regexp
+}
+
+func (l *Length) compile(field string) error {
+	if l.Pattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile(l.Pattern)
+	if err != nil {
+		return fmt.Errorf("guardrail catalog %s pattern: %w", field, err)
+	}
+	l.re = re
+
+	return nil
+}
+
+// Range is an inclusive numeric range.
+type Range struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// Catalog lists the values and limits the Bedrock CreateGuardrail API
+// accepts.
+type Catalog struct {
+	Name             Length `json:"name"`
+	Description      Length `json:"description"`
+	BlockedMessaging Length `json:"blocked_messaging"`
+
+	ContentFilterTypes []string `json:"content_filter_types"`
+	FilterStrengths    []string `json:"filter_strengths"`
+	// OutputStrengthNoneOnly lists filter types whose output strength must
+	// be NONE because they only apply to prompts.
+	OutputStrengthNoneOnly []string `json:"output_strength_none_only"`
+	TierNames              []string `json:"tier_names"`
+
+	GroundingFilterTypes []string `json:"grounding_filter_types"`
+	GroundingThreshold   Range    `json:"grounding_threshold"`
+
+	PIIEntityTypes []string `json:"pii_entity_types"`
+	// PIIEntityAliases maps common but invalid PII entity names to the
+	// entity Bedrock expects, for suggestions.
+	PIIEntityAliases            map[string]string `json:"pii_entity_aliases"`
+	SensitiveInformationActions []string          `json:"sensitive_information_actions"`
+	Regexes                     struct {
+		MaxCount    int    `json:"max_count"`
+		Name        Length `json:"name"`
+		Description Length `json:"description"`
+		Pattern     Length `json:"pattern"`
+	} `json:"regexes"`
+
+	Topics struct {
+		MaxCount    int      `json:"max_count"`
+		Types       []string `json:"types"`
+		Name        Length   `json:"name"`
+		Definition  Length   `json:"definition"`
+		MaxExamples int      `json:"max_examples"`
+		Example     Length   `json:"example"`
+	} `json:"topics"`
+
+	ManagedWordListTypes []string `json:"managed_word_list_types"`
+	Words                struct {
+		MaxCount int    `json:"max_count"`
+		Text     Length `json:"text"`
+	} `json:"words"`
+}
+
+//go:embed catalog.json
+var catalogJSON []byte
+
+// DefaultCatalog returns the checked-in catalog. Update catalog.json when
+// Bedrock adds filter types, PII entities or changes limits.
+func DefaultCatalog() *Catalog {
+	c, err := ParseCatalog(catalogJSON)
+	if err != nil {
+		panic(err)
+	}
+
+	return c
+}
+
+// ParseCatalog parses a catalog in the catalog.json format and compiles
+// its patterns.
+func ParseCatalog(data []byte) (*Catalog, error) {
+	var c Catalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parsing guardrail catalog: %w", err)
+	}
+	for _, l := range []struct {
+		field  string
+		length *Length
+	}{
+		{"name", &c.Name},
+		{"description", &c.Description},
+		{"blocked_messaging", &c.BlockedMessaging},
+		{"regexes.name", &c.Regexes.Name},
+		{"regexes.description", &c.Regexes.Description},
+		{"regexes.pattern", &c.Regexes.Pattern},
+		{"topics.name", &c.Topics.Name},
+		{"topics.definition", &c.Topics.Definition},
+		{"topics.example", &c.Topics.Example},
+		{"words.text", &c.Words.Text},
+	} {
+		if err := l.length.compile(l.field); err != nil {
+			return nil, err
+		}
+	}
+
+	return &c, nil
+}
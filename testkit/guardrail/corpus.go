@@ -0,0 +1,247 @@
+package guardrail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Corpus is a set of prompts and the outcome a guardrail example should
+// produce for each, loaded from YAML:
+//
+//	guardrail: comprehensive
+//	topic_keywords:
+//	  investment_advice: [invest, stocks, portfolio]
+//	cases:
+//	  - name: denied investment topic
+//	    prompt: Which stocks should I buy this year?
+//	    expect: BLOCKED
+//	  - name: email is masked
+//	    prompt: Contact me at jane@example.com
+//	    expect: ANONYMIZED
+//	    output_contains: ["{EMAIL}"]
+//	  - name: name is blocked
+//	    prompt: My name is Jane Doe
+//	    expect: BLOCKED
+//	    live_only: true
+type Corpus struct {
+	// Guardrail names the example the corpus was written for.
+	Guardrail string `yaml:"guardrail"`
+	// TopicKeywords overrides the keywords LocalEvaluator derives for
+	// denied topics.
+	TopicKeywords map[string][]string `yaml:"topic_keywords"`
+	Cases         []Case              `yaml:"cases"`
+}
+
+// Case is one corpus entry.
+type Case struct {
+	Name string `yaml:"name"`
+	// Source defaults to INPUT.
+	Source Source  `yaml:"source"`
+	Prompt string  `yaml:"prompt"`
+	Expect Outcome `yaml:"expect"`
+	// OutputContains lists substrings the guardrail output must contain.
+	OutputContains []string `yaml:"output_contains"`
+	// LiveOnly marks cases that depend on policies LocalEvaluator does not
+	// implement; they are skipped in offline runs.
+	LiveOnly bool `yaml:"live_only"`
+}
+
+// LoadCorpus reads and checks a corpus file.
+func LoadCorpus(path string) (*Corpus, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseCorpus(data)
+}
+
+// ParseCorpus parses and checks a YAML corpus.
+func ParseCorpus(data []byte) (*Corpus, error) {
+	var c Corpus
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parsing guardrail corpus: %w", err)
+	}
+	names := map[string]bool{}
+	for i := range c.Cases {
+		cs := &c.Cases[i]
+		if cs.Name == "" {
+			return nil, fmt.Errorf("corpus case %d has no name", i)
+		}
+		if names[cs.Name] {
+			return nil, fmt.Errorf("corpus case %q is defined twice", cs.Name)
+		}
+		names[cs.Name] = true
+		if cs.Source == "" {
+			cs.Source = SourceInput
+		}
+		if cs.Source != SourceInput && cs.Source != SourceOutput {
+			return nil, fmt.Errorf("corpus case %q: source %q is not INPUT or OUTPUT", cs.Name, cs.Source)
+		}
+		switch cs.Expect {
+		case OutcomeBlocked, OutcomeAnonymized, OutcomeNone:
+		default:
+			return nil, fmt.Errorf("corpus case %q: expect %q is not BLOCKED, ANONYMIZED or NONE", cs.Name, cs.Expect)
+		}
+	}
+
+	return &c, nil
+}
+
+// CaseResult is the outcome of one case against one guardrail version.
+type CaseResult struct {
+	Case    Case
+	Got     Outcome
+	Output  string
+	Err     error
+	Skipped bool
+}
+
+// Passed reports whether the case ran and produced the expected outcome
+// and output.
+func (r CaseResult) Passed() bool {
+	if r.Skipped || r.Err != nil || r.Got != r.Case.Expect {
+		return false
+	}
+	for _, s := range r.Case.OutputContains {
+		if !strings.Contains(r.Output, s) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r CaseResult) status() string {
+	switch {
+	case r.Skipped:
+		return "skip"
+	case r.Passed():
+		return "pass"
+	case r.Err != nil:
+		return "error"
+	default:
+		return "FAIL"
+	}
+}
+
+// Result is the outcome of a corpus against one guardrail version.
+type Result struct {
+	// Version labels the column in the matrix, e.g. "local/DRAFT" or "1".
+	Version string
+	Cases   []CaseResult
+}
+
+// Failed returns the cases that ran and did not pass.
+func (r Result) Failed() []CaseResult {
+	var out []CaseResult
+	for _, c := range r.Cases {
+		if !c.Skipped && !c.Passed() {
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
+
+// Run applies every case to version through a. Unless live is set,
+// live_only cases are skipped.
+func (c *Corpus) Run(ctx context.Context, a Applier, version string, live bool) Result {
+	res := Result{Version: version}
+	for _, cs := range c.Cases {
+		cr := CaseResult{Case: cs}
+		if cs.LiveOnly && !live {
+			cr.Skipped = true
+			res.Cases = append(res.Cases, cr)
+			continue
+		}
+		resp, err := a.ApplyGuardrail(ctx, version, Request{Source: cs.Source, Text: cs.Prompt})
+		if err != nil {
+			cr.Err = err
+		} else {
+			cr.Got = resp.Outcome()
+			cr.Output = resp.Output
+		}
+		res.Cases = append(res.Cases, cr)
+	}
+
+	return res
+}
+
+// Matrix formats results as a table with one row per case and one column
+// per version. Failing cells show the outcome that was produced.
+func Matrix(results ...Result) string {
+	var (
+		order []string
+		cases = map[string]Case{}
+		cells = map[string]map[string]string{}
+	)
+	for _, r := range results {
+		for _, c := range r.Cases {
+			if _, ok := cases[c.Case.Name]; !ok {
+				order = append(order, c.Case.Name)
+				cases[c.Case.Name] = c.Case
+				cells[c.Case.Name] = map[string]string{}
+			}
+			cell := c.status()
+			switch {
+			case c.Err != nil:
+				cell += " (" + c.Err.Error() + ")"
+			case cell == "FAIL" && c.Got != c.Case.Expect:
+				cell += " (got " + string(c.Got) + ")"
+			case cell == "FAIL":
+				cell += " (output)"
+			}
+			cells[c.Case.Name][r.Version] = cell
+		}
+	}
+
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	header := []string{"CASE", "EXPECT"}
+	for _, r := range results {
+		header = append(header, r.Version)
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, name := range order {
+		row := []string{name, string(cases[name].Expect)}
+		for _, r := range results {
+			cell := cells[name][r.Version]
+			if cell == "" {
+				cell = "-"
+			}
+			row = append(row, cell)
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+
+	return b.String()
+}
+
+// Summary counts passed, failed and skipped cases per version, e.g.
+// "local/DRAFT: 12 passed, 0 failed, 3 skipped".
+func Summary(results ...Result) string {
+	lines := make([]string, 0, len(results))
+	for _, r := range results {
+		var pass, fail, skip int
+		for _, c := range r.Cases {
+			switch {
+			case c.Skipped:
+				skip++
+			case c.Passed():
+				pass++
+			default:
+				fail++
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%s: %d passed, %d failed, %d skipped", r.Version, pass, fail, skip))
+	}
+
+	return strings.Join(lines, "\n")
+}
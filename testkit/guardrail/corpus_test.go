@@ -0,0 +1,104 @@
+package guardrail
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() Config {
+	return Config{
+		Name:                    "test",
+		BlockedInputMessaging:   "Your input was blocked.",
+		BlockedOutputsMessaging: "The response was filtered.",
+		ContentPolicy:           &ContentPolicy{Filters: []ContentFilter{{Type: "HATE", InputStrength: "HIGH", OutputStrength: "HIGH"}}},
+		SensitiveInformation: &SensitiveInformationPolicy{
+			PIIEntities: []PIIEntity{{Type: "NAME", Action: "BLOCK"}, {Type: "EMAIL", Action: "ANONYMIZE"}},
+			Regexes:     []Regex{{Name: "ssn_pattern", Pattern: `^\d{3}-\d{2}-\d{4}$`, Action: "BLOCK"}},
+		},
+		TopicPolicy: &TopicPolicy{Topics: []Topic{{
+			Name:     "investment_advice",
+			Type:     "DENY",
+			Examples: []string{"Where should I invest my money?"},
+		}}},
+		WordPolicy: &WordPolicy{ManagedWordLists: []string{"PROFANITY"}, Words: []string{"inappropriate"}},
+	}
+}
+
+func TestLocalEvaluator(t *testing.T) {
+	e, err := NewLocalEvaluator(testConfig(), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"content filter HATE", "PII entity NAME"}, e.Unsupported())
+
+	tests := []struct {
+		text   string
+		want   Outcome
+		output string
+	}{
+		{"Should I invest in bonds?", OutcomeBlocked, "Your input was blocked."},
+		{"Is investing risky?", OutcomeBlocked, "Your input was blocked."},
+		{"What a load of crap", OutcomeBlocked, "Your input was blocked."},
+		{"mail me at a.b@example.com", OutcomeAnonymized, "mail me at {EMAIL}"},
+		{"scrappy little app", OutcomeNone, ""},
+		{"my ssn is 123-45-6789", OutcomeNone, ""},
+	}
+	for _, tt := range tests {
+		resp, err := e.ApplyGuardrail(context.Background(), "DRAFT", Request{Source: SourceInput, Text: tt.text})
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, resp.Outcome(), tt.text)
+		assert.Equal(t, tt.output, resp.Output, tt.text)
+	}
+}
+
+func TestLocalEvaluatorBadRegex(t *testing.T) {
+	cfg := testConfig()
+	cfg.SensitiveInformation.Regexes[0].Pattern = `(?<=x)y`
+	_, err := NewLocalEvaluator(cfg, nil)
+	assert.ErrorContains(t, err, "ssn_pattern")
+}
+
+func TestCorpusRun(t *testing.T) {
+	c, err := LoadCorpus("testdata/corpus.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, SourceInput, c.Cases[0].Source)
+
+	e, err := NewLocalEvaluator(testConfig(), c.TopicKeywords)
+	require.NoError(t, err)
+
+	res := c.Run(context.Background(), e, "local/DRAFT", false)
+	assert.Empty(t, res.Failed())
+	assert.True(t, res.Cases[5].Skipped)
+	assert.Equal(t, "local/DRAFT: 5 passed, 0 failed, 1 skipped", Summary(res))
+
+	// A version without the word policy lets the custom word through.
+	cfg := testConfig()
+	cfg.WordPolicy = nil
+	e1, err := NewLocalEvaluator(cfg, c.TopicKeywords)
+	require.NoError(t, err)
+	res1 := c.Run(context.Background(), e1, "local/1", false)
+	require.Len(t, res1.Failed(), 1)
+	assert.Equal(t, "custom word", res1.Failed()[0].Case.Name)
+
+	m := Matrix(res, res1)
+	lines := strings.Split(strings.TrimSpace(m), "\n")
+	require.Len(t, lines, 7)
+	assert.Regexp(t, `^CASE\s+EXPECT\s+local/DRAFT\s+local/1$`, lines[0])
+	assert.Regexp(t, `^custom word\s+BLOCKED\s+pass\s+FAIL \(got NONE\)$`, lines[2])
+	assert.Regexp(t, `^name entity\s+BLOCKED\s+skip\s+skip$`, lines[6])
+}
+
+func TestParseCorpusErrors(t *testing.T) {
+	for _, tt := range []struct{ yaml, err string }{
+		{"cases: [{prompt: hi, expect: NONE}]", "has no name"},
+		{"cases: [{name: a, expect: NONE}, {name: a, expect: NONE}]", "defined twice"},
+		{"cases: [{name: a, source: BOTH, expect: NONE}]", "not INPUT or OUTPUT"},
+		{"cases: [{name: a, expect: MASKED}]", "not BLOCKED, ANONYMIZED or NONE"},
+	} {
+		_, err := ParseCorpus([]byte(tt.yaml))
+		assert.ErrorContains(t, err, tt.err, tt.yaml)
+	}
+}
@@ -0,0 +1,354 @@
+package guardrail
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ChangeKind says whether a diff entry was added, removed or modified.
+type ChangeKind string
+
+const (
+	Added    ChangeKind = "+"
+	Removed  ChangeKind = "-"
+	Modified ChangeKind = "~"
+)
+
+// Change is one semantic difference between two guardrail definitions.
+// Path names list entries by their identity rather than their index, for
+// example sensitive_information_policy_config.pii_entities_config[EMAIL].action,
+// so reordering a list is not a change.
+type Change struct {
+	Kind ChangeKind
+	Path string
+	Old  string
+	New  string
+	// Weakens is set when the change lets through content the old
+	// definition stopped: a removed entity, topic or word, a lower filter
+	// strength or grounding threshold, or a softer PII action.
+	Weakens bool
+}
+
+func (c Change) String() string {
+	var s string
+	switch c.Kind {
+	case Added:
+		s = fmt.Sprintf("+ %s = %s", c.Path, c.New)
+	case Removed:
+		s = fmt.Sprintf("- %s = %s", c.Path, c.Old)
+	default:
+		s = fmt.Sprintf("~ %s: %s -> %s", c.Path, c.Old, c.New)
+	}
+	if c.Weakens {
+		s += " (weakens)"
+	}
+
+	return s
+}
+
+// Changes is the result of Diff, ordered by path.
+type Changes []Change
+
+// Weakening returns the changes that loosen the guardrail.
+func (cs Changes) Weakening() Changes {
+	var out Changes
+	for _, c := range cs {
+		if c.Weakens {
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
+
+func (cs Changes) String() string {
+	lines := make([]string, len(cs))
+	for i, c := range cs {
+		lines[i] = c.String()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+var strengthRank = map[string]int{"NONE": 0, "LOW": 1, "MEDIUM": 2, "HIGH": 3}
+
+var actionRank = map[string]int{"NONE": 0, "ANONYMIZE": 1, "BLOCK": 2}
+
+// Diff compares two guardrail definitions.
+func Diff(from, to Config) Changes {
+	d := &differ{}
+
+	d.scalar("name", from.Name, to.Name, false)
+	d.scalar("description", from.Description, to.Description, false)
+	d.scalar("blocked_input_messaging", from.BlockedInputMessaging, to.BlockedInputMessaging, false)
+	d.scalar("blocked_outputs_messaging", from.BlockedOutputsMessaging, to.BlockedOutputsMessaging, false)
+	d.scalar("kms_key_arn", from.KMSKeyARN, to.KMSKeyARN, false)
+
+	const content = "content_policy_config"
+	d.presence(content, from.ContentPolicy != nil, to.ContentPolicy != nil)
+	{
+		var a, b ContentPolicy
+		if from.ContentPolicy != nil {
+			a = *from.ContentPolicy
+		}
+		if to.ContentPolicy != nil {
+			b = *to.ContentPolicy
+		}
+		af, bf := map[string]ContentFilter{}, map[string]ContentFilter{}
+		for _, f := range a.Filters {
+			af[f.Type] = f
+		}
+		for _, f := range b.Filters {
+			bf[f.Type] = f
+		}
+		for _, k := range keys(af, bf) {
+			path := fmt.Sprintf("%s.filters_config[%s]", content, k)
+			x, inA := af[k]
+			y, inB := bf[k]
+			switch {
+			case !inB:
+				d.add(Change{Kind: Removed, Path: path, Old: x.strengths(), Weakens: true})
+			case !inA:
+				d.add(Change{Kind: Added, Path: path, New: y.strengths()})
+			default:
+				d.ranked(path+".input_strength", x.InputStrength, y.InputStrength, strengthRank)
+				d.ranked(path+".output_strength", x.OutputStrength, y.OutputStrength, strengthRank)
+			}
+		}
+		d.scalar(content+".tier_config.tier_name", a.TierName, b.TierName, false)
+	}
+
+	const grounding = "contextual_grounding_policy_config"
+	d.presence(grounding, from.ContextualGrounding != nil, to.ContextualGrounding != nil)
+	{
+		af, bf := map[string]float64{}, map[string]float64{}
+		if from.ContextualGrounding != nil {
+			for _, f := range from.ContextualGrounding.Filters {
+				af[f.Type] = f.Threshold
+			}
+		}
+		if to.ContextualGrounding != nil {
+			for _, f := range to.ContextualGrounding.Filters {
+				bf[f.Type] = f.Threshold
+			}
+		}
+		for _, k := range keys(af, bf) {
+			path := fmt.Sprintf("%s.filters_config[%s].threshold", grounding, k)
+			x, inA := af[k]
+			y, inB := bf[k]
+			switch {
+			case !inB:
+				d.add(Change{Kind: Removed, Path: path, Old: num(x), Weakens: true})
+			case !inA:
+				d.add(Change{Kind: Added, Path: path, New: num(y)})
+			case x != y:
+				d.add(Change{Kind: Modified, Path: path, Old: num(x), New: num(y), Weakens: y < x})
+			}
+		}
+	}
+
+	const sensitive = "sensitive_information_policy_config"
+	d.presence(sensitive, from.SensitiveInformation != nil, to.SensitiveInformation != nil)
+	{
+		var a, b SensitiveInformationPolicy
+		if from.SensitiveInformation != nil {
+			a = *from.SensitiveInformation
+		}
+		if to.SensitiveInformation != nil {
+			b = *to.SensitiveInformation
+		}
+		ae, be := map[string]string{}, map[string]string{}
+		for _, e := range a.PIIEntities {
+			ae[e.Type] = e.Action
+		}
+		for _, e := range b.PIIEntities {
+			be[e.Type] = e.Action
+		}
+		for _, k := range keys(ae, be) {
+			path := fmt.Sprintf("%s.pii_entities_config[%s]", sensitive, k)
+			x, inA := ae[k]
+			y, inB := be[k]
+			switch {
+			case !inB:
+				d.add(Change{Kind: Removed, Path: path, Old: x, Weakens: true})
+			case !inA:
+				d.add(Change{Kind: Added, Path: path, New: y})
+			default:
+				d.ranked(path+".action", x, y, actionRank)
+			}
+		}
+
+		ar, br := map[string]Regex{}, map[string]Regex{}
+		for _, r := range a.Regexes {
+			ar[r.Name] = r
+		}
+		for _, r := range b.Regexes {
+			br[r.Name] = r
+		}
+		for _, k := range keys(ar, br) {
+			path := fmt.Sprintf("%s.regexes_config[%s]", sensitive, k)
+			x, inA := ar[k]
+			y, inB := br[k]
+			switch {
+			case !inB:
+				d.add(Change{Kind: Removed, Path: path, Old: x.Pattern, Weakens: true})
+			case !inA:
+				d.add(Change{Kind: Added, Path: path, New: y.Pattern})
+			default:
+				// A different pattern may match more or less; it is
+				// reported without a judgement.
+				d.scalar(path+".pattern", x.Pattern, y.Pattern, false)
+				d.ranked(path+".action", x.Action, y.Action, actionRank)
+				d.scalar(path+".description", x.Description, y.Description, false)
+			}
+		}
+	}
+
+	const topics = "topic_policy_config"
+	d.presence(topics, from.TopicPolicy != nil, to.TopicPolicy != nil)
+	{
+		var a, b TopicPolicy
+		if from.TopicPolicy != nil {
+			a = *from.TopicPolicy
+		}
+		if to.TopicPolicy != nil {
+			b = *to.TopicPolicy
+		}
+		at, bt := map[string]Topic{}, map[string]Topic{}
+		for _, t := range a.Topics {
+			at[t.Name] = t
+		}
+		for _, t := range b.Topics {
+			bt[t.Name] = t
+		}
+		for _, k := range keys(at, bt) {
+			path := fmt.Sprintf("%s.topics_config[%s]", topics, k)
+			x, inA := at[k]
+			y, inB := bt[k]
+			switch {
+			case !inB:
+				d.add(Change{Kind: Removed, Path: path, Old: x.Type, Weakens: x.Type == "DENY"})
+			case !inA:
+				d.add(Change{Kind: Added, Path: path, New: y.Type})
+			default:
+				d.scalar(path+".type", x.Type, y.Type, x.Type == "DENY")
+				d.scalar(path+".definition", x.Definition, y.Definition, false)
+				d.set(path+".examples", x.Examples, y.Examples, false)
+			}
+		}
+		d.scalar(topics+".tier_config.tier_name", a.TierName, b.TierName, false)
+	}
+
+	const words = "word_policy_config"
+	d.presence(words, from.WordPolicy != nil, to.WordPolicy != nil)
+	{
+		var a, b WordPolicy
+		if from.WordPolicy != nil {
+			a = *from.WordPolicy
+		}
+		if to.WordPolicy != nil {
+			b = *to.WordPolicy
+		}
+		d.set(words+".managed_word_lists_config", a.ManagedWordLists, b.ManagedWordLists, true)
+		d.set(words+".words_config", lower(a.Words), lower(b.Words), true)
+	}
+
+	sort.SliceStable(d.out, func(i, j int) bool { return d.out[i].Path < d.out[j].Path })
+
+	return d.out
+}
+
+type differ struct {
+	out Changes
+}
+
+func (d *differ) add(c Change) {
+	d.out = append(d.out, c)
+}
+
+// presence reports a policy that was configured on one side only. Removing
+// a policy always weakens the guardrail.
+func (d *differ) presence(path string, a, b bool) {
+	switch {
+	case a && !b:
+		d.add(Change{Kind: Removed, Path: path, Old: "configured", Weakens: true})
+	case !a && b:
+		d.add(Change{Kind: Added, Path: path, New: "configured"})
+	}
+}
+
+func (d *differ) scalar(path, a, b string, weakens bool) {
+	if a == b {
+		return
+	}
+	d.add(Change{Kind: Modified, Path: path, Old: quote(a), New: quote(b), Weakens: weakens})
+}
+
+// ranked compares two values of an ordered enum; moving down the ranking
+// weakens the guardrail.
+func (d *differ) ranked(path, a, b string, rank map[string]int) {
+	if a == b {
+		return
+	}
+	d.add(Change{Kind: Modified, Path: path, Old: a, New: b, Weakens: rank[b] < rank[a]})
+}
+
+// set reports entries added to or removed from an unordered list. Removals
+// weaken the guardrail when removalWeakens is set.
+func (d *differ) set(path string, a, b []string, removalWeakens bool) {
+	inA, inB := map[string]bool{}, map[string]bool{}
+	for _, s := range a {
+		inA[s] = true
+	}
+	for _, s := range b {
+		inB[s] = true
+	}
+	for _, k := range keys(inA, inB) {
+		switch {
+		case !inB[k]:
+			d.add(Change{Kind: Removed, Path: fmt.Sprintf("%s[%s]", path, k), Old: quote(k), Weakens: removalWeakens})
+		case !inA[k]:
+			d.add(Change{Kind: Added, Path: fmt.Sprintf("%s[%s]", path, k), New: quote(k)})
+		}
+	}
+}
+
+func (f ContentFilter) strengths() string {
+	return fmt.Sprintf("input %s, output %s", f.InputStrength, f.OutputStrength)
+}
+
+// keys returns the sorted union of the keys of a and b.
+func keys[V any](a, b map[string]V) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, m := range []map[string]V{a, b} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				out = append(out, k)
+			}
+		}
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+func lower(list []string) []string {
+	out := make([]string, len(list))
+	for i, s := range list {
+		out[i] = strings.ToLower(s)
+	}
+
+	return out
+}
+
+func quote(s string) string {
+	return strconv.Quote(s)
+}
+
+func num(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,270 @@
+// Package guardrail models the configuration of an aws_bedrock_guardrail,
+// as planned by the aws-bedrock-guardrail module or by the solution
+// module's bedrock_guardrail call, and validates it offline against a
+// checked-in catalog of the values the Bedrock API accepts. It also runs
+// prompt corpora through an ApplyGuardrail-compatible Applier, either the
+// offline LocalEvaluator or the real API, and reports a pass/fail matrix.
+package guardrail
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+// ResourceType is the Terraform resource type of a guardrail.
+const ResourceType = "aws_bedrock_guardrail"
+
+// Config is a guardrail definition. Field names follow the module's
+// variables; a nil policy means the policy is not configured.
+type Config struct {
+	Name                    string
+	Description             string
+	BlockedInputMessaging   string
+	BlockedOutputsMessaging string
+	KMSKeyARN               string
+
+	ContentPolicy        *ContentPolicy
+	ContextualGrounding  *GroundingPolicy
+	SensitiveInformation *SensitiveInformationPolicy
+	TopicPolicy          *TopicPolicy
+	WordPolicy           *WordPolicy
+}
+
+// ContentPolicy is content_policy_config.
+type ContentPolicy struct {
+	Filters  []ContentFilter
+	TierName string
+}
+
+// ContentFilter is one content_policy_config.filters_config entry.
+type ContentFilter struct {
+	Type           string
+	InputStrength  string
+	OutputStrength string
+}
+
+// GroundingPolicy is contextual_grounding_policy_config.
+type GroundingPolicy struct {
+	Filters []GroundingFilter
+}
+
+// GroundingFilter is one contextual_grounding_policy_config.filters_config
+// entry.
+type GroundingFilter struct {
+	Type      string
+	Threshold float64
+}
+
+// SensitiveInformationPolicy is sensitive_information_policy_config.
+type SensitiveInformationPolicy struct {
+	PIIEntities []PIIEntity
+	Regexes     []Regex
+}
+
+// PIIEntity is one pii_entities_config entry.
+type PIIEntity struct {
+	Type   string
+	Action string
+}
+
+// Regex is one regexes_config entry.
+type Regex struct {
+	Name        string
+	Description string
+	Pattern     string
+	Action      string
+}
+
+// TopicPolicy is topic_policy_config.
+type TopicPolicy struct {
+	Topics   []Topic
+	TierName string
+}
+
+// Topic is one topics_config entry.
+type Topic struct {
+	Name       string
+	Definition string
+	Examples   []string
+	Type       string
+}
+
+// WordPolicy is word_policy_config.
+type WordPolicy struct {
+	ManagedWordLists []string
+	Words            []string
+}
+
+// Guardrail is a guardrail found in a plan.
+type Guardrail struct {
+	Address string
+	Config  Config
+}
+
+// FromPlan returns every guardrail planned in p, in address order.
+func FromPlan(p *tfjson.Plan) []Guardrail {
+	var out []Guardrail
+	for _, r := range plan.ResourcesOfType(p, ResourceType) {
+		out = append(out, Guardrail{Address: r.Address, Config: FromValues(r.Values)})
+	}
+
+	return out
+}
+
+// FromState returns every guardrail in a JSON state, in address order.
+func FromState(s *tfjson.State) []Guardrail {
+	var out []Guardrail
+	for _, r := range plan.StateResources(s) {
+		if r.Type == ResourceType {
+			out = append(out, Guardrail{Address: r.Address, Config: FromValues(r.Values)})
+		}
+	}
+
+	return out
+}
+
+// LoadFile reads the guardrails from a JSON plan or state file.
+func LoadFile(path string) ([]Guardrail, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if plan.IsPlan(data) {
+		p, err := plan.Parse(data)
+		if err != nil {
+			return nil, err
+		}
+		return FromPlan(p), nil
+	}
+	s, err := plan.ParseState(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return FromState(s), nil
+}
+
+// Select picks the guardrail at address, or the only guardrail when address
+// is empty.
+func Select(guardrails []Guardrail, address string) (Guardrail, error) {
+	addresses := make([]string, len(guardrails))
+	for i, g := range guardrails {
+		if g.Address == address || (address == "" && len(guardrails) == 1) {
+			return g, nil
+		}
+		addresses[i] = g.Address
+	}
+	sort.Strings(addresses)
+	if len(addresses) == 0 {
+		return Guardrail{}, errors.New("no guardrails found")
+	}
+	if address == "" {
+		return Guardrail{}, fmt.Errorf("several guardrails found, pick one of: %s", strings.Join(addresses, ", "))
+	}
+
+	return Guardrail{}, fmt.Errorf("guardrail %s not found, have: %s", address, strings.Join(addresses, ", "))
+}
+
+// FromValues decodes the attribute values of an aws_bedrock_guardrail, as
+// found in plan or state JSON.
+func FromValues(v map[string]interface{}) Config {
+	c := Config{
+		Name:                    str(v, "name"),
+		Description:             str(v, "description"),
+		BlockedInputMessaging:   str(v, "blocked_input_messaging"),
+		BlockedOutputsMessaging: str(v, "blocked_outputs_messaging"),
+		KMSKeyARN:               str(v, "kms_key_arn"),
+	}
+
+	if b := first(v, "content_policy_config"); b != nil {
+		c.ContentPolicy = &ContentPolicy{}
+		for _, f := range plan.Objects(b["filters_config"]) {
+			c.ContentPolicy.Filters = append(c.ContentPolicy.Filters, ContentFilter{
+				Type:           str(f, "type"),
+				InputStrength:  str(f, "input_strength"),
+				OutputStrength: str(f, "output_strength"),
+			})
+		}
+		if t := first(b, "tier_config"); t != nil {
+			c.ContentPolicy.TierName = str(t, "tier_name")
+		}
+	}
+
+	if b := first(v, "contextual_grounding_policy_config"); b != nil {
+		c.ContextualGrounding = &GroundingPolicy{}
+		for _, f := range plan.Objects(b["filters_config"]) {
+			threshold, _ := f["threshold"].(float64)
+			c.ContextualGrounding.Filters = append(c.ContextualGrounding.Filters, GroundingFilter{
+				Type:      str(f, "type"),
+				Threshold: threshold,
+			})
+		}
+	}
+
+	if b := first(v, "sensitive_information_policy_config"); b != nil {
+		c.SensitiveInformation = &SensitiveInformationPolicy{}
+		for _, e := range plan.Objects(b["pii_entities_config"]) {
+			c.SensitiveInformation.PIIEntities = append(c.SensitiveInformation.PIIEntities, PIIEntity{
+				Type:   str(e, "type"),
+				Action: str(e, "action"),
+			})
+		}
+		for _, r := range plan.Objects(b["regexes_config"]) {
+			c.SensitiveInformation.Regexes = append(c.SensitiveInformation.Regexes, Regex{
+				Name:        str(r, "name"),
+				Description: str(r, "description"),
+				Pattern:     str(r, "pattern"),
+				Action:      str(r, "action"),
+			})
+		}
+	}
+
+	if b := first(v, "topic_policy_config"); b != nil {
+		c.TopicPolicy = &TopicPolicy{}
+		for _, t := range plan.Objects(b["topics_config"]) {
+			c.TopicPolicy.Topics = append(c.TopicPolicy.Topics, Topic{
+				Name:       str(t, "name"),
+				Definition: str(t, "definition"),
+				Examples:   plan.StringList(t["examples"]),
+				Type:       str(t, "type"),
+			})
+		}
+		if t := first(b, "tier_config"); t != nil {
+			c.TopicPolicy.TierName = str(t, "tier_name")
+		}
+	}
+
+	if b := first(v, "word_policy_config"); b != nil {
+		c.WordPolicy = &WordPolicy{}
+		for _, l := range plan.Objects(b["managed_word_lists_config"]) {
+			c.WordPolicy.ManagedWordLists = append(c.WordPolicy.ManagedWordLists, str(l, "type"))
+		}
+		for _, w := range plan.Objects(b["words_config"]) {
+			c.WordPolicy.Words = append(c.WordPolicy.Words, str(w, "text"))
+		}
+	}
+
+	return c
+}
+
+func str(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+// first returns the single nested block key, or nil when it is absent.
+func first(m map[string]interface{}, key string) map[string]interface{} {
+	blocks := plan.Objects(m[key])
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	return blocks[0]
+}
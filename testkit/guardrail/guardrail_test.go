@@ -0,0 +1,112 @@
+package guardrail
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan/plantest"
+)
+
+const (
+	comprehensive = "module.comprehensive_guardrail.aws_bedrock_guardrail.this"
+	solution      = "module.bedrock_solution.module.bedrock_guardrail[0].aws_bedrock_guardrail.this"
+)
+
+func loadPlan(t *testing.T) []Guardrail {
+	t.Helper()
+	p, err := plan.Load("testdata/plan.json")
+	require.NoError(t, err)
+
+	return FromPlan(p)
+}
+
+func TestFromPlan(t *testing.T) {
+	guardrails := loadPlan(t)
+	require.Len(t, guardrails, 2)
+
+	g := guardrails[0].Config
+	assert.Equal(t, solution, guardrails[0].Address)
+	assert.Equal(t, "guardrails-bedrock-dev", g.Name)
+	require.NotNil(t, g.ContentPolicy)
+	assert.Equal(t, ContentFilter{Type: "PROMPT_ATTACK", InputStrength: "HIGH", OutputStrength: "HIGH"}, g.ContentPolicy.Filters[1])
+	assert.Nil(t, g.TopicPolicy)
+	assert.Equal(t, []string{"PROFANITY"}, g.WordPolicy.ManagedWordLists)
+
+	c := guardrails[1].Config
+	require.NotNil(t, c.TopicPolicy)
+	assert.Equal(t, []string{"Where should I invest my money?", "What stocks should I buy?"}, c.TopicPolicy.Topics[0].Examples)
+	assert.Equal(t, 0.8, c.ContextualGrounding.Filters[0].Threshold)
+}
+
+func TestValidatePlan(t *testing.T) {
+	p, err := plan.Load("testdata/plan.json")
+	require.NoError(t, err)
+
+	findings := ValidatePlan(p, DefaultCatalog())
+
+	got := map[string]string{}
+	for _, f := range findings {
+		got[f.Address+" "+f.Path] = f.Rule
+	}
+	assert.Equal(t, map[string]string{
+		comprehensive + " content_policy_config.filters_config[2].input_strength":          RuleInvalidValue,
+		comprehensive + " content_policy_config.filters_config[3].type":                    RuleDuplicate,
+		comprehensive + " contextual_grounding_policy_config.filters_config[1].threshold":  RuleRange,
+		comprehensive + " sensitive_information_policy_config.pii_entities_config[2].type": RuleInvalidValue,
+		comprehensive + " sensitive_information_policy_config.regexes_config[1].action":    RuleInvalidValue,
+		comprehensive + " sensitive_information_policy_config.regexes_config[1].pattern":   RuleRegex,
+		comprehensive + " topic_policy_config.topics_config[1].name":                       RuleInvalidValue,
+		comprehensive + " topic_policy_config.topics_config[1].examples":                   RuleLimit,
+		comprehensive + " word_policy_config.words_config[1].text":                         RuleDuplicate,
+		solution + " content_policy_config.filters_config[1].output_strength":              RuleInvalidValue,
+		solution + " sensitive_information_policy_config.pii_entities_config[0].type":      RuleInvalidValue,
+	}, got, findings.String())
+
+	assert.Len(t, findings.AtLeast(finding.High), len(findings)-1, "only the RE2 pattern is a medium finding")
+	for _, f := range findings.ByRule(RuleInvalidValue) {
+		if f.Path == "sensitive_information_policy_config.pii_entities_config[2].type" {
+			assert.Contains(t, f.Message, `did you mean "US_SOCIAL_SECURITY_NUMBER"?`)
+		}
+	}
+}
+
+func TestValidatePlanNestedUnknowns(t *testing.T) {
+	f := plantest.Load(t, "testdata/plan.json")
+	pii := f.Values(t, solution)["sensitive_information_policy_config"].([]interface{})[0].(map[string]interface{})["pii_entities_config"].([]interface{})[0].(map[string]interface{})
+	pii["type"] = nil
+	f.Unknown(t, solution)["sensitive_information_policy_config"] = []interface{}{
+		map[string]interface{}{"pii_entities_config": []interface{}{map[string]interface{}{"type": true}}},
+	}
+	f.Unknown(t, solution)["content_policy_config"] = []interface{}{true}
+
+	for _, fd := range ValidatePlan(f.Plan(t), DefaultCatalog()) {
+		assert.NotEqual(t, solution, fd.Address, "%s is known after apply", fd.Path)
+	}
+}
+
+func TestValidateEmptyGuardrail(t *testing.T) {
+	findings := DefaultCatalog().Validate("aws_bedrock_guardrail.this", Config{
+		Name:                    "bad name",
+		BlockedInputMessaging:   "blocked",
+		BlockedOutputsMessaging: "",
+	})
+
+	assert.Len(t, findings.ByRule(RuleEmptyPolicy), 1)
+	assert.Len(t, findings.ByRule(RuleLength), 1, "blocked_outputs_messaging is required")
+	assert.Len(t, findings.ByRule(RuleInvalidValue), 1, "names may not contain spaces")
+}
+
+func TestParseCatalog(t *testing.T) {
+	_, err := ParseCatalog([]byte(`{"name": {"min": 1, "max": 50, "pattern": "^[a-z"}}`))
+	assert.ErrorContains(t, err, "guardrail catalog name pattern")
+
+	c, err := ParseCatalog([]byte(`{"name": {"min": 1, "max": 50, "pattern": "^[a-z]+$"}}`))
+	require.NoError(t, err)
+	findings := c.Validate("aws_bedrock_guardrail.this", Config{Name: "Upper"})
+	require.NotEmpty(t, findings.ByRule(RuleInvalidValue))
+	assert.Equal(t, "name", findings.ByRule(RuleInvalidValue)[0].Path)
+}
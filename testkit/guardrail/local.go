@@ -0,0 +1,276 @@
+package guardrail
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//go:embed profanity.txt
+var profanityTxt []byte
+
+// piiDetectors are the PII entity types LocalEvaluator can recognise. They
+// are deliberately simple; entity types without a detector, such as NAME or
+// ADDRESS, are reported by Unsupported and need a live run.
+var piiDetectors = map[string]*regexp.Regexp{
+	"AWS_ACCESS_KEY":            regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	"CREDIT_DEBIT_CARD_NUMBER":  regexp.MustCompile(`\b\d{4}[ -]?\d{4}[ -]?\d{4}[ -]?\d{4}\b`),
+	"EMAIL":                     regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`),
+	"IP_ADDRESS":                regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`),
+	"MAC_ADDRESS":               regexp.MustCompile(`\b(?:[0-9A-Fa-f]{2}:){5}[0-9A-Fa-f]{2}\b`),
+	"PHONE":                     regexp.MustCompile(`(?:\+?1[ .-]?)?(?:\(\d{3}\)|\b\d{3})[ .-]?\d{3}[ .-]?\d{4}\b`),
+	"URL":                       regexp.MustCompile(`\bhttps?://[^\s]+`),
+	"US_SOCIAL_SECURITY_NUMBER": regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+}
+
+// stopWords are skipped when topic keywords are derived from examples.
+var stopWords = map[string]bool{
+	"about": true, "after": true, "could": true, "there": true, "these": true,
+	"their": true, "thing": true, "which": true, "where": true, "while": true,
+	"would": true, "should": true, "other": true, "what's": true, "please": true,
+	"tell": true, "this": true, "that": true, "with": true, "your": true,
+}
+
+// LocalEvaluator applies a guardrail Config offline. It implements word
+// lists, the PROFANITY managed list, PII detection for the entity types in
+// piiDetectors, custom regexes and denied topics. Topics are matched on
+// keywords, which are taken from the caller or derived from the topic's
+// examples, so it approximates Bedrock's classifier rather than
+// reproducing it. Content filters and contextual grounding are not
+// evaluated.
+type LocalEvaluator struct {
+	cfg     Config
+	matches []matcher
+}
+
+type matcher struct {
+	kind   string // topic, word, managed_word, pii or regex
+	name   string
+	action string // MatchBlocked or MatchAnonymized
+	re     *regexp.Regexp
+}
+
+// NewLocalEvaluator compiles cfg. topicKeywords overrides the keywords
+// derived for the named topics.
+func NewLocalEvaluator(cfg Config, topicKeywords map[string][]string) (*LocalEvaluator, error) {
+	e := &LocalEvaluator{cfg: cfg}
+
+	if p := cfg.TopicPolicy; p != nil {
+		for _, t := range p.Topics {
+			if t.Type != "DENY" {
+				continue
+			}
+			keywords, ok := topicKeywords[t.Name]
+			if !ok {
+				keywords = deriveKeywords(t.Examples)
+			}
+			if len(keywords) == 0 {
+				continue
+			}
+			e.matches = append(e.matches, matcher{kind: "topic", name: t.Name, action: MatchBlocked, re: wordsRegexp(keywords, true)})
+		}
+	}
+
+	if p := cfg.WordPolicy; p != nil {
+		for _, w := range p.Words {
+			e.matches = append(e.matches, matcher{kind: "word", name: w, action: MatchBlocked, re: wordsRegexp([]string{w}, false)})
+		}
+		for _, l := range p.ManagedWordLists {
+			if l != "PROFANITY" {
+				continue
+			}
+			e.matches = append(e.matches, matcher{kind: "managed_word", name: l, action: MatchBlocked, re: wordsRegexp(profanity(), false)})
+		}
+	}
+
+	if p := cfg.SensitiveInformation; p != nil {
+		for _, ent := range p.PIIEntities {
+			re, ok := piiDetectors[ent.Type]
+			if !ok || ent.Action == "NONE" {
+				continue
+			}
+			e.matches = append(e.matches, matcher{kind: "pii", name: ent.Type, action: matchAction(ent.Action), re: re})
+		}
+		for _, r := range p.Regexes {
+			if r.Action == "NONE" {
+				continue
+			}
+			re, err := regexp.Compile(r.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("compiling regex %q: %w", r.Name, err)
+			}
+			e.matches = append(e.matches, matcher{kind: "regex", name: r.Name, action: matchAction(r.Action), re: re})
+		}
+	}
+
+	return e, nil
+}
+
+// Unsupported describes the configured policies the evaluator ignores.
+// Corpus cases that depend on them should be marked live_only.
+func (e *LocalEvaluator) Unsupported() []string {
+	var out []string
+	if p := e.cfg.ContentPolicy; p != nil {
+		for _, f := range p.Filters {
+			out = append(out, "content filter "+f.Type)
+		}
+	}
+	if p := e.cfg.ContextualGrounding; p != nil {
+		for _, f := range p.Filters {
+			out = append(out, "contextual grounding "+f.Type)
+		}
+	}
+	if p := e.cfg.SensitiveInformation; p != nil {
+		for _, ent := range p.PIIEntities {
+			if _, ok := piiDetectors[ent.Type]; !ok {
+				out = append(out, "PII entity "+ent.Type)
+			}
+		}
+	}
+	if p := e.cfg.WordPolicy; p != nil {
+		for _, l := range p.ManagedWordLists {
+			if l != "PROFANITY" {
+				out = append(out, "managed word list "+l)
+			}
+		}
+	}
+
+	return out
+}
+
+// ApplyGuardrail evaluates req. The evaluator holds a single
+// configuration, so version is ignored; build one evaluator per version to
+// compare versions.
+func (e *LocalEvaluator) ApplyGuardrail(_ context.Context, _ string, req Request) (Response, error) {
+	type span struct {
+		start, end int
+		label      string
+	}
+
+	var (
+		a         Assessment
+		blocked   bool
+		anonymize []span
+	)
+	for _, m := range e.matches {
+		locs := m.re.FindAllStringIndex(req.Text, -1)
+		if len(locs) == 0 {
+			continue
+		}
+		if m.kind == "topic" {
+			locs = locs[:1]
+		}
+		for _, loc := range locs {
+			pm := PolicyMatch{Name: m.name, Match: req.Text[loc[0]:loc[1]], Action: m.action}
+			switch m.kind {
+			case "topic":
+				a.Topics = append(a.Topics, pm)
+			case "word":
+				a.Words = append(a.Words, pm)
+			case "managed_word":
+				a.ManagedWords = append(a.ManagedWords, pm)
+			case "pii":
+				a.PIIEntities = append(a.PIIEntities, pm)
+			case "regex":
+				a.Regexes = append(a.Regexes, pm)
+			}
+			if m.action == MatchBlocked {
+				blocked = true
+			} else {
+				anonymize = append(anonymize, span{loc[0], loc[1], "{" + m.name + "}"})
+			}
+		}
+	}
+
+	resp := Response{Action: ActionNone, Assessment: a}
+	switch {
+	case blocked:
+		resp.Action = ActionIntervened
+		resp.Output = e.cfg.BlockedInputMessaging
+		if req.Source == SourceOutput {
+			resp.Output = e.cfg.BlockedOutputsMessaging
+		}
+	case len(anonymize) > 0:
+		resp.Action = ActionIntervened
+		// Mask left to right, skipping spans that overlap one already
+		// masked.
+		sort.Slice(anonymize, func(i, j int) bool { return anonymize[i].start < anonymize[j].start })
+		var b strings.Builder
+		pos := 0
+		for _, s := range anonymize {
+			if s.start < pos {
+				continue
+			}
+			b.WriteString(req.Text[pos:s.start])
+			b.WriteString(s.label)
+			pos = s.end
+		}
+		b.WriteString(req.Text[pos:])
+		resp.Output = b.String()
+	}
+
+	return resp, nil
+}
+
+func matchAction(action string) string {
+	if action == "ANONYMIZE" {
+		return MatchAnonymized
+	}
+
+	return MatchBlocked
+}
+
+// wordsRegexp matches any of words as whole words, case-insensitively.
+// With prefix set, a word also matches when followed by more letters, so
+// "invest" matches "investing".
+func wordsRegexp(words []string, prefix bool) *regexp.Regexp {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = regexp.QuoteMeta(w)
+	}
+	suffix := `\b`
+	if prefix {
+		suffix = `\w*\b`
+	}
+
+	return regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)` + suffix)
+}
+
+// deriveKeywords picks the distinctive words of a topic's examples: words
+// of five letters or more that are not stop words.
+func deriveKeywords(examples []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, ex := range examples {
+		for _, w := range strings.FieldsFunc(strings.ToLower(ex), func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r == '\'')
+		}) {
+			if len(w) < 5 || stopWords[w] || seen[w] {
+				continue
+			}
+			seen[w] = true
+			out = append(out, w)
+		}
+	}
+
+	return out
+}
+
+func profanity() []string {
+	var out []string
+	s := bufio.NewScanner(bytes.NewReader(profanityTxt))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		out = append(out, line)
+	}
+
+	return out
+}
@@ -0,0 +1,243 @@
+package guardrail
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Ledger records which guardrail versions have been deployed to which
+// environment. It is stored as JSON:
+//
+//	{"deployments": [{"guardrail": "arn:...:guardrail/abc", "environment": "staging", "version": "2"}]}
+type Ledger struct {
+	Deployments []Deployment `json:"deployments"`
+}
+
+// Deployment is one ledger entry.
+type Deployment struct {
+	Guardrail   string `json:"guardrail"`
+	Environment string `json:"environment"`
+	Version     string `json:"version"`
+}
+
+// LoadLedger reads a ledger file. A missing file is an empty ledger.
+func LoadLedger(path string) (*Ledger, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Ledger{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var l Ledger
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("parsing ledger %s: %w", path, err)
+	}
+
+	return &l, nil
+}
+
+// Write writes the ledger as indented JSON.
+func (l *Ledger) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(l)
+}
+
+// Record adds a deployment unless it is already recorded.
+func (l *Ledger) Record(guardrail, env, version string) {
+	for _, d := range l.Deployments {
+		if d.Guardrail == guardrail && d.Environment == env && d.Version == version {
+			return
+		}
+	}
+	l.Deployments = append(l.Deployments, Deployment{Guardrail: guardrail, Environment: env, Version: version})
+}
+
+// Deployed returns the versions of guardrail recorded for env, in the order
+// they were deployed.
+func (l *Ledger) Deployed(guardrail, env string) []string {
+	var out []string
+	for _, d := range l.Deployments {
+		if d.Guardrail == guardrail && d.Environment == env {
+			out = append(out, d.Version)
+		}
+	}
+
+	return out
+}
+
+// VersionSource returns the definition of a guardrail version. LocalBedrock
+// implements it, as can an adapter around the GetGuardrail API.
+type VersionSource interface {
+	GuardrailVersion(guardrail, version string) (Config, error)
+}
+
+// PromotionPolicy says which environment a version must have reached before
+// it may be deployed to another.
+type PromotionPolicy struct {
+	// Requires maps a target environment to the environment a version must
+	// already be deployed to.
+	Requires map[string]string
+	// Equivalent also accepts a version whose definition has no semantic
+	// difference from one deployed to the required environment, so a
+	// version cut from the same draft counts as promoted. It needs a
+	// VersionSource.
+	Equivalent bool
+}
+
+// DefaultPromotionPolicy only lets prod receive versions already deployed
+// to staging.
+func DefaultPromotionPolicy() PromotionPolicy {
+	return PromotionPolicy{Requires: map[string]string{"prod": "staging"}}
+}
+
+// PromotionError is returned by Check when a promotion breaks the policy.
+type PromotionError struct {
+	Guardrail string
+	Env       string
+	Version   string
+	Required  string
+	// Deployed lists the versions found in the required environment.
+	Deployed []string
+	// Changes holds the diff against the latest version deployed to the
+	// required environment, when a VersionSource was available.
+	Changes Changes
+}
+
+func (e *PromotionError) Error() string {
+	deployed := "none"
+	if len(e.Deployed) > 0 {
+		deployed = strings.Join(e.Deployed, ", ")
+	}
+	msg := fmt.Sprintf("guardrail %s version %s cannot be deployed to %s: it has not been deployed to %s (deployed there: %s)",
+		e.Guardrail, e.Version, e.Env, e.Required, deployed)
+	if len(e.Changes) > 0 {
+		msg += "\n" + e.Changes.String()
+	}
+
+	return msg
+}
+
+// Check returns a *PromotionError when deploying version of guardrail to
+// env breaks the policy. src may be nil unless p.Equivalent is set.
+func (p PromotionPolicy) Check(l *Ledger, src VersionSource, guardrail, env, version string) error {
+	required, ok := p.Requires[env]
+	if !ok {
+		return nil
+	}
+	deployed := l.Deployed(guardrail, required)
+	for _, v := range deployed {
+		if v == version {
+			return nil
+		}
+	}
+
+	if p.Equivalent && src == nil {
+		return errors.New("promotion policy: equivalence checks need a version source")
+	}
+
+	perr := &PromotionError{Guardrail: guardrail, Env: env, Version: version, Required: required, Deployed: deployed}
+	if src == nil || len(deployed) == 0 {
+		return perr
+	}
+	want, err := src.GuardrailVersion(guardrail, version)
+	if err != nil {
+		return err
+	}
+	for i := len(deployed) - 1; i >= 0; i-- {
+		have, err := src.GuardrailVersion(guardrail, deployed[i])
+		if err != nil {
+			return err
+		}
+		changes := Diff(have, want)
+		if i == len(deployed)-1 {
+			perr.Changes = changes
+		}
+		if p.Equivalent && len(changes) == 0 {
+			return nil
+		}
+		if !p.Equivalent {
+			break
+		}
+	}
+
+	return perr
+}
+
+// LocalBedrock is an in-memory stand-in for the Bedrock guardrail API: a
+// guardrail has a mutable DRAFT and immutable numbered versions, as created
+// by aws_bedrock_guardrail and aws_bedrock_guardrail_version.
+type LocalBedrock struct {
+	guardrails map[string]*localGuardrail
+}
+
+type localGuardrail struct {
+	draft    Config
+	versions []Config
+}
+
+// NewLocalBedrock returns an empty stand-in.
+func NewLocalBedrock() *LocalBedrock {
+	return &LocalBedrock{guardrails: map[string]*localGuardrail{}}
+}
+
+// PutGuardrail creates or replaces the DRAFT of guardrail id.
+func (b *LocalBedrock) PutGuardrail(id string, cfg Config) {
+	g, ok := b.guardrails[id]
+	if !ok {
+		g = &localGuardrail{}
+		b.guardrails[id] = g
+	}
+	g.draft = clone(cfg)
+}
+
+// CreateGuardrailVersion snapshots the DRAFT of guardrail id and returns
+// the new version number.
+func (b *LocalBedrock) CreateGuardrailVersion(id string) (string, error) {
+	g, ok := b.guardrails[id]
+	if !ok {
+		return "", fmt.Errorf("guardrail %s not found", id)
+	}
+	g.versions = append(g.versions, clone(g.draft))
+
+	return fmt.Sprint(len(g.versions)), nil
+}
+
+// GuardrailVersion returns a numbered version, or the draft for "DRAFT".
+func (b *LocalBedrock) GuardrailVersion(id, version string) (Config, error) {
+	g, ok := b.guardrails[id]
+	if !ok {
+		return Config{}, fmt.Errorf("guardrail %s not found", id)
+	}
+	if version == "DRAFT" {
+		return clone(g.draft), nil
+	}
+	for i, c := range g.versions {
+		if fmt.Sprint(i+1) == version {
+			return clone(c), nil
+		}
+	}
+
+	return Config{}, fmt.Errorf("guardrail %s has no version %s", id, version)
+}
+
+// clone deep-copies cfg so versions cannot change through shared policy
+// pointers.
+func clone(cfg Config) Config {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		panic(err)
+	}
+	var out Config
+	if err := json.Unmarshal(data, &out); err != nil {
+		panic(err)
+	}
+
+	return out
+}
@@ -0,0 +1,125 @@
+package guardrail
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const stagedGuardrail = "module.bedrock_guardrail.aws_bedrock_guardrail.this"
+
+func stateConfig(t *testing.T) Config {
+	t.Helper()
+	guardrails, err := LoadFile("testdata/state.json")
+	require.NoError(t, err)
+	g, err := Select(guardrails, "")
+	require.NoError(t, err)
+	assert.Equal(t, stagedGuardrail, g.Address)
+
+	return g.Config
+}
+
+func TestLoadFile(t *testing.T) {
+	cfg := stateConfig(t)
+	assert.Equal(t, "test-advanced-guardrail-advanced", cfg.Name)
+	assert.Equal(t, []PIIEntity{{Type: "EMAIL", Action: "BLOCK"}}, cfg.SensitiveInformation.PIIEntities)
+	assert.Nil(t, cfg.TopicPolicy, "empty blocks in state are unconfigured policies")
+
+	guardrails, err := LoadFile("testdata/plan.json")
+	require.NoError(t, err)
+	_, err = Select(guardrails, "")
+	assert.ErrorContains(t, err, "several guardrails found")
+	_, err = Select(guardrails, "module.missing")
+	assert.ErrorContains(t, err, "not found")
+	g, err := Select(guardrails, comprehensive)
+	require.NoError(t, err)
+	assert.Equal(t, comprehensive, g.Address)
+}
+
+func TestDiff(t *testing.T) {
+	from := stateConfig(t)
+	assert.Empty(t, Diff(from, from))
+
+	to := clone(from)
+	to.BlockedInputMessaging = "Blocked."
+	to.ContentPolicy.Filters = []ContentFilter{
+		{Type: "VIOLENCE", InputStrength: "HIGH", OutputStrength: "LOW"},
+		{Type: "HATE", InputStrength: "HIGH", OutputStrength: "HIGH"},
+		{Type: "SEXUAL", InputStrength: "HIGH", OutputStrength: "HIGH"},
+	}
+	to.SensitiveInformation.PIIEntities = []PIIEntity{{Type: "EMAIL", Action: "ANONYMIZE"}, {Type: "PHONE", Action: "BLOCK"}}
+	to.TopicPolicy = &TopicPolicy{Topics: []Topic{{Name: "investment_advice", Type: "DENY"}}}
+
+	changes := Diff(from, to)
+	assert.Equal(t, `~ blocked_input_messaging: "Your input has been blocked due to policy violations." -> "Blocked."
++ content_policy_config.filters_config[SEXUAL] = input HIGH, output HIGH
+~ content_policy_config.filters_config[VIOLENCE].input_strength: MEDIUM -> HIGH
+~ content_policy_config.filters_config[VIOLENCE].output_strength: MEDIUM -> LOW (weakens)
+~ sensitive_information_policy_config.pii_entities_config[EMAIL].action: BLOCK -> ANONYMIZE (weakens)
++ sensitive_information_policy_config.pii_entities_config[PHONE] = BLOCK
++ topic_policy_config = configured
++ topic_policy_config.topics_config[investment_advice] = DENY`, changes.String())
+
+	back := Diff(to, from)
+	assert.Len(t, back.Weakening(), 5)
+	assert.Contains(t, back.String(), "- topic_policy_config.topics_config[investment_advice] = DENY (weakens)")
+	assert.Contains(t, back.String(), "- sensitive_information_policy_config.pii_entities_config[PHONE] = BLOCK (weakens)")
+}
+
+func TestPromotionPolicy(t *testing.T) {
+	cfg := stateConfig(t)
+	b := NewLocalBedrock()
+	b.PutGuardrail("abc123", cfg)
+	dev, err := b.CreateGuardrailVersion("abc123")
+	require.NoError(t, err)
+	staging, err := b.CreateGuardrailVersion("abc123")
+	require.NoError(t, err)
+
+	cfg.SensitiveInformation.PIIEntities = nil
+	b.PutGuardrail("abc123", cfg)
+	next, err := b.CreateGuardrailVersion("abc123")
+	require.NoError(t, err)
+
+	old, err := b.GuardrailVersion("abc123", staging)
+	require.NoError(t, err)
+	assert.Len(t, old.SensitiveInformation.PIIEntities, 1, "versions are snapshots")
+
+	l := &Ledger{}
+	l.Record("abc123", "dev", dev)
+	l.Record("abc123", "staging", staging)
+	l.Record("abc123", "staging", staging)
+	assert.Equal(t, []string{staging}, l.Deployed("abc123", "staging"))
+
+	p := DefaultPromotionPolicy()
+	assert.NoError(t, p.Check(l, nil, "abc123", "prod", staging))
+	assert.NoError(t, p.Check(l, nil, "abc123", "staging", next), "staging has no prerequisite")
+
+	err = p.Check(l, b, "abc123", "prod", next)
+	var perr *PromotionError
+	require.True(t, errors.As(err, &perr))
+	assert.Equal(t, []string{staging}, perr.Deployed)
+	assert.Contains(t, err.Error(), "version 3 cannot be deployed to prod: it has not been deployed to staging (deployed there: 2)")
+	assert.Contains(t, err.Error(), "pii_entities_config[EMAIL] = BLOCK (weakens)")
+
+	// dev was cut from the same draft as staging.
+	p.Equivalent = true
+	assert.NoError(t, p.Check(l, b, "abc123", "prod", dev))
+	assert.Error(t, p.Check(l, b, "abc123", "prod", next))
+	assert.ErrorContains(t, p.Check(l, nil, "abc123", "prod", dev), "need a version source")
+}
+
+func TestLedgerRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.json")
+	l, err := LoadLedger(path)
+	require.NoError(t, err)
+	assert.Empty(t, l.Deployments)
+
+	l.Record("abc123", "staging", "2")
+	var buf bytes.Buffer
+	require.NoError(t, l.Write(&buf))
+	assert.JSONEq(t, `{"deployments":[{"guardrail":"abc123","environment":"staging","version":"2"}]}`, buf.String())
+}
@@ -0,0 +1,281 @@
+package guardrail
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/internal/hint"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+// Rule identifiers reported by Validate.
+const (
+	RuleInvalidValue = "guardrail-invalid-value"
+	RuleLength       = "guardrail-length"
+	RuleRange        = "guardrail-range"
+	RuleDuplicate    = "guardrail-duplicate"
+	RuleLimit        = "guardrail-limit"
+	RuleRegex        = "guardrail-regex"
+	RuleEmptyPolicy  = "guardrail-empty-policy"
+)
+
+// ValidatePlan validates every guardrail in the plan against the catalog.
+// Checks on attributes that are only known after apply are dropped.
+func ValidatePlan(p *tfjson.Plan, c *Catalog) finding.List {
+	var out finding.List
+	for _, r := range plan.ResourcesOfType(p, ResourceType) {
+		for _, f := range c.Validate(r.Address, FromValues(r.Values)) {
+			if unknownAt(r.Unknown, f.Path) {
+				continue
+			}
+			out = append(out, f)
+		}
+	}
+	out.Sort()
+
+	return out
+}
+
+// unknownAt reports whether the value at path, such as
+// topic_policy_config.topics_config[1].name, or any block containing it is
+// known only after apply. unknown is the resource's after_unknown; a step
+// without an index is the first instance of its block.
+func unknownAt(unknown map[string]interface{}, path string) bool {
+	var v interface{} = unknown
+	for _, step := range strings.Split(path, ".") {
+		i := 0
+		if open := strings.Index(step, "["); open >= 0 {
+			i, _ = strconv.Atoi(strings.TrimSuffix(step[open+1:], "]"))
+			step = step[:open]
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		switch e := m[step].(type) {
+		case bool:
+			return e
+		case []interface{}:
+			if i >= len(e) {
+				return false
+			}
+			v = e[i]
+		default:
+			v = e
+		}
+		if b, ok := v.(bool); ok {
+			return b
+		}
+	}
+
+	return false
+}
+
+// Validate checks cfg against the catalog. address labels the findings.
+func (c *Catalog) Validate(address string, cfg Config) finding.List {
+	v := &validator{address: address}
+
+	v.length("name", cfg.Name, c.Name)
+	if cfg.Description != "" {
+		v.length("description", cfg.Description, c.Description)
+	}
+	v.length("blocked_input_messaging", cfg.BlockedInputMessaging, c.BlockedMessaging)
+	v.length("blocked_outputs_messaging", cfg.BlockedOutputsMessaging, c.BlockedMessaging)
+
+	if cfg.ContentPolicy == nil && cfg.ContextualGrounding == nil && cfg.SensitiveInformation == nil &&
+		cfg.TopicPolicy == nil && cfg.WordPolicy == nil {
+		v.add(finding.High, RuleEmptyPolicy, "", "a guardrail needs at least one policy configured")
+	}
+
+	if p := cfg.ContentPolicy; p != nil {
+		seen := map[string]int{}
+		for i, f := range p.Filters {
+			path := fmt.Sprintf("content_policy_config.filters_config[%d]", i)
+			v.oneOf(path+".type", f.Type, c.ContentFilterTypes)
+			v.oneOf(path+".input_strength", f.InputStrength, c.FilterStrengths)
+			v.oneOf(path+".output_strength", f.OutputStrength, c.FilterStrengths)
+			if contains(c.OutputStrengthNoneOnly, f.Type) && f.OutputStrength != "" && f.OutputStrength != "NONE" {
+				v.add(finding.High, RuleInvalidValue, path+".output_strength",
+					fmt.Sprintf("%s filters only apply to prompts; output_strength must be NONE, not %q", f.Type, f.OutputStrength))
+			}
+			v.unique(seen, path+".type", f.Type, i)
+		}
+		if len(p.Filters) == 0 {
+			v.add(finding.High, RuleEmptyPolicy, "content_policy_config.filters_config", "content policy has no filters")
+		}
+		if p.TierName != "" {
+			v.oneOf("content_policy_config.tier_config.tier_name", p.TierName, c.TierNames)
+		}
+	}
+
+	if p := cfg.ContextualGrounding; p != nil {
+		seen := map[string]int{}
+		for i, f := range p.Filters {
+			path := fmt.Sprintf("contextual_grounding_policy_config.filters_config[%d]", i)
+			v.oneOf(path+".type", f.Type, c.GroundingFilterTypes)
+			if f.Threshold < c.GroundingThreshold.Min || f.Threshold > c.GroundingThreshold.Max {
+				v.add(finding.High, RuleRange, path+".threshold",
+					fmt.Sprintf("threshold %g is outside [%g, %g]", f.Threshold, c.GroundingThreshold.Min, c.GroundingThreshold.Max))
+			}
+			v.unique(seen, path+".type", f.Type, i)
+		}
+		if len(p.Filters) == 0 {
+			v.add(finding.High, RuleEmptyPolicy, "contextual_grounding_policy_config.filters_config", "contextual grounding policy has no filters")
+		}
+	}
+
+	if p := cfg.SensitiveInformation; p != nil {
+		seen := map[string]int{}
+		for i, e := range p.PIIEntities {
+			path := fmt.Sprintf("sensitive_information_policy_config.pii_entities_config[%d]", i)
+			if alias, ok := c.PIIEntityAliases[strings.ToUpper(e.Type)]; ok {
+				v.add(finding.High, RuleInvalidValue, path+".type", fmt.Sprintf("%q is not a recognised value; did you mean %q?", e.Type, alias))
+			} else {
+				v.oneOf(path+".type", e.Type, c.PIIEntityTypes)
+			}
+			v.oneOf(path+".action", e.Action, c.SensitiveInformationActions)
+			v.unique(seen, path+".type", e.Type, i)
+		}
+		if len(p.Regexes) > c.Regexes.MaxCount {
+			v.add(finding.High, RuleLimit, "sensitive_information_policy_config.regexes_config",
+				fmt.Sprintf("%d regexes configured, the limit is %d", len(p.Regexes), c.Regexes.MaxCount))
+		}
+		names := map[string]int{}
+		for i, r := range p.Regexes {
+			path := fmt.Sprintf("sensitive_information_policy_config.regexes_config[%d]", i)
+			v.length(path+".name", r.Name, c.Regexes.Name)
+			if r.Description != "" {
+				v.length(path+".description", r.Description, c.Regexes.Description)
+			}
+			v.length(path+".pattern", r.Pattern, c.Regexes.Pattern)
+			v.oneOf(path+".action", r.Action, c.SensitiveInformationActions)
+			v.unique(names, path+".name", r.Name, i)
+			if r.Pattern != "" {
+				if _, err := regexp.Compile(r.Pattern); err != nil {
+					// Bedrock's regex dialect is broader than RE2, so this
+					// may be a false positive, but the local evaluator
+					// cannot run the pattern either.
+					v.add(finding.Medium, RuleRegex, path+".pattern", fmt.Sprintf("pattern does not compile: %v", err))
+				}
+			}
+		}
+		if len(p.PIIEntities) == 0 && len(p.Regexes) == 0 {
+			v.add(finding.High, RuleEmptyPolicy, "sensitive_information_policy_config", "sensitive information policy has no PII entities or regexes")
+		}
+	}
+
+	if p := cfg.TopicPolicy; p != nil {
+		if len(p.Topics) > c.Topics.MaxCount {
+			v.add(finding.High, RuleLimit, "topic_policy_config.topics_config",
+				fmt.Sprintf("%d topics configured, the limit is %d", len(p.Topics), c.Topics.MaxCount))
+		}
+		if len(p.Topics) == 0 {
+			v.add(finding.High, RuleEmptyPolicy, "topic_policy_config.topics_config", "topic policy has no topics")
+		}
+		names := map[string]int{}
+		for i, t := range p.Topics {
+			path := fmt.Sprintf("topic_policy_config.topics_config[%d]", i)
+			v.length(path+".name", t.Name, c.Topics.Name)
+			v.length(path+".definition", t.Definition, c.Topics.Definition)
+			v.oneOf(path+".type", t.Type, c.Topics.Types)
+			v.unique(names, path+".name", t.Name, i)
+			if len(t.Examples) > c.Topics.MaxExamples {
+				v.add(finding.High, RuleLimit, path+".examples",
+					fmt.Sprintf("%d examples configured, the limit is %d", len(t.Examples), c.Topics.MaxExamples))
+			}
+			for j, e := range t.Examples {
+				v.length(fmt.Sprintf("%s.examples[%d]", path, j), e, c.Topics.Example)
+			}
+		}
+		if p.TierName != "" {
+			v.oneOf("topic_policy_config.tier_config.tier_name", p.TierName, c.TierNames)
+		}
+	}
+
+	if p := cfg.WordPolicy; p != nil {
+		seen := map[string]int{}
+		for i, l := range p.ManagedWordLists {
+			path := fmt.Sprintf("word_policy_config.managed_word_lists_config[%d].type", i)
+			v.oneOf(path, l, c.ManagedWordListTypes)
+			v.unique(seen, path, l, i)
+		}
+		if len(p.Words) > c.Words.MaxCount {
+			v.add(finding.High, RuleLimit, "word_policy_config.words_config",
+				fmt.Sprintf("%d words configured, the limit is %d", len(p.Words), c.Words.MaxCount))
+		}
+		words := map[string]int{}
+		for i, w := range p.Words {
+			path := fmt.Sprintf("word_policy_config.words_config[%d].text", i)
+			v.length(path, w, c.Words.Text)
+			v.unique(words, path, strings.ToLower(w), i)
+		}
+		if len(p.ManagedWordLists) == 0 && len(p.Words) == 0 {
+			v.add(finding.High, RuleEmptyPolicy, "word_policy_config", "word policy has no managed lists or words")
+		}
+	}
+
+	v.out.Sort()
+
+	return v.out
+}
+
+type validator struct {
+	address string
+	out     finding.List
+}
+
+func (v *validator) add(s finding.Severity, rule, path, msg string) {
+	v.out = append(v.out, finding.Finding{Severity: s, Rule: rule, Address: v.address, Path: path, Message: msg})
+}
+
+func (v *validator) oneOf(path, value string, allowed []string) {
+	if contains(allowed, value) {
+		return
+	}
+	msg := fmt.Sprintf("%q is not one of %s", value, strings.Join(allowed, ", "))
+	if len(allowed) > 8 {
+		msg = fmt.Sprintf("%q is not a recognised value", value)
+		if s := hint.Closest(value, allowed); s != "" {
+			msg += fmt.Sprintf("; did you mean %q?", s)
+		}
+	}
+	v.add(finding.High, RuleInvalidValue, path, msg)
+}
+
+func (v *validator) length(path, value string, l Length) {
+	n := utf8.RuneCountInString(value)
+	if n < l.Min || n > l.Max {
+		v.add(finding.High, RuleLength, path, fmt.Sprintf("length %d is outside [%d, %d]", n, l.Min, l.Max))
+		return
+	}
+	if l.re != nil && !l.re.MatchString(value) {
+		v.add(finding.High, RuleInvalidValue, path, fmt.Sprintf("%q does not match %s", value, l.Pattern))
+	}
+}
+
+func (v *validator) unique(seen map[string]int, path, value string, i int) {
+	if value == "" {
+		return
+	}
+	if j, ok := seen[value]; ok {
+		v.add(finding.High, RuleDuplicate, path, fmt.Sprintf("%q is already configured at index %d", value, j))
+		return
+	}
+	seen[value] = i
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,297 @@
+// Package iampolicy parses IAM policy documents (identity, resource and key
+// policies) into a normalized form. IAM accepts either a string or a list in
+// most positions; after parsing every such field is a list.
+package iampolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Document is a parsed policy document.
+type Document struct {
+	Version    string
+	ID         string
+	Statements []Statement
+}
+
+// Statement is a single normalized policy statement.
+type Statement struct {
+	Sid    string
+	Effect string
+
+	Actions    []string
+	NotActions []string
+
+	Resources    []string
+	NotResources []string
+
+	// Principals maps a principal type (AWS, Service, Federated,
+	// CanonicalUser) to its identifiers. A bare "*" principal is stored
+	// under the "*" type.
+	Principals    map[string][]string
+	NotPrincipals map[string][]string
+
+	// Conditions maps an operator (StringEquals, ArnLike, ...) to the
+	// condition keys it tests and their values.
+	Conditions map[string]map[string][]string
+}
+
+type rawDocument struct {
+	Version   string          `json:"Version"`
+	ID        string          `json:"Id"`
+	Statement json.RawMessage `json:"Statement"`
+}
+
+type rawStatement struct {
+	Sid          string                             `json:"Sid"`
+	Effect       string                             `json:"Effect"`
+	Action       stringOrList                       `json:"Action"`
+	NotAction    stringOrList                       `json:"NotAction"`
+	Resource     stringOrList                       `json:"Resource"`
+	NotResource  stringOrList                       `json:"NotResource"`
+	Principal    principal                          `json:"Principal"`
+	NotPrincipal principal                          `json:"NotPrincipal"`
+	Condition    map[string]map[string]stringOrList `json:"Condition"`
+}
+
+type stringOrList []string
+
+func (s *stringOrList) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*s = []string{one}
+		return nil
+	}
+	var many []interface{}
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	for _, v := range many {
+		// Condition values may be booleans or numbers.
+		*s = append(*s, fmt.Sprint(v))
+	}
+
+	return nil
+}
+
+type principal map[string][]string
+
+func (p *principal) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*p = principal{"*": {one}}
+		return nil
+	}
+	var m map[string]stringOrList
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	*p = principal{}
+	for k, v := range m {
+		(*p)[k] = v
+	}
+
+	return nil
+}
+
+// Parse parses a JSON policy document.
+func Parse(s string) (*Document, error) {
+	var raw rawDocument
+	if err := json.Unmarshal([]byte(s), &raw); err != nil {
+		return nil, fmt.Errorf("parsing policy: %w", err)
+	}
+
+	var statements []rawStatement
+	if len(raw.Statement) > 0 && raw.Statement[0] == '{' {
+		var one rawStatement
+		if err := json.Unmarshal(raw.Statement, &one); err != nil {
+			return nil, fmt.Errorf("parsing policy statement: %w", err)
+		}
+		statements = []rawStatement{one}
+	} else if len(raw.Statement) > 0 {
+		if err := json.Unmarshal(raw.Statement, &statements); err != nil {
+			return nil, fmt.Errorf("parsing policy statements: %w", err)
+		}
+	}
+
+	doc := &Document{Version: raw.Version, ID: raw.ID}
+	for _, rs := range statements {
+		st := Statement{
+			Sid:           rs.Sid,
+			Effect:        rs.Effect,
+			Actions:       rs.Action,
+			NotActions:    rs.NotAction,
+			Resources:     rs.Resource,
+			NotResources:  rs.NotResource,
+			Principals:    rs.Principal,
+			NotPrincipals: rs.NotPrincipal,
+		}
+		if len(rs.Condition) > 0 {
+			st.Conditions = map[string]map[string][]string{}
+			for op, keys := range rs.Condition {
+				st.Conditions[op] = map[string][]string{}
+				for k, v := range keys {
+					st.Conditions[op][k] = v
+				}
+			}
+		}
+		doc.Statements = append(doc.Statements, st)
+	}
+
+	return doc, nil
+}
+
+// Allows reports whether the statement is an Allow statement.
+func (s Statement) Allows() bool {
+	return s.Effect == "Allow"
+}
+
+// MatchesAction reports whether the statement's Action (or NotAction) covers
+// action. Matching is case-insensitive and honours * and ? wildcards.
+func (s Statement) MatchesAction(action string) bool {
+	if len(s.NotActions) > 0 {
+		return !anyMatch(s.NotActions, action)
+	}
+
+	return anyMatch(s.Actions, action)
+}
+
+// MatchesResource reports whether the statement's Resource (or
+// NotResource) covers resource.
+func (s Statement) MatchesResource(resource string) bool {
+	if len(s.NotResources) > 0 {
+		return !anyMatch(s.NotResources, resource)
+	}
+
+	return anyMatch(s.Resources, resource)
+}
+
+// PrincipalIDs returns the identifiers of the given principal type. The
+// wildcard principal "*" is returned for every type.
+func (s Statement) PrincipalIDs(kind string) []string {
+	ids := append([]string{}, s.Principals[kind]...)
+	ids = append(ids, s.Principals["*"]...)
+
+	return ids
+}
+
+// HasPrincipal reports whether the statement names the principal id of the
+// given type, either literally or through a wildcard.
+func (s Statement) HasPrincipal(kind, id string) bool {
+	return anyMatch(s.PrincipalIDs(kind), id)
+}
+
+// ConditionKeys returns the condition keys tested by the statement, in
+// lower case and sorted.
+func (s Statement) ConditionKeys() []string {
+	var keys []string
+	for _, kv := range s.Conditions {
+		for k := range kv {
+			keys = append(keys, strings.ToLower(k))
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// ConditionValues returns the values every operator tests for key, compared
+// case-insensitively.
+func (s Statement) ConditionValues(key string) []string {
+	var out []string
+	for _, kv := range s.Conditions {
+		for k, v := range kv {
+			if strings.EqualFold(k, key) {
+				out = append(out, v...)
+			}
+		}
+	}
+
+	return out
+}
+
+// Match reports whether value matches the IAM wildcard pattern, where *
+// matches any run of characters and ? any single character. Matching is
+// case-insensitive, as it is for actions.
+func Match(pattern, value string) bool {
+	var b strings.Builder
+	b.WriteString("(?i)^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+
+	return regexp.MustCompile(b.String()).MatchString(value)
+}
+
+func anyMatch(patterns []string, value string) bool {
+	for _, p := range patterns {
+		if Match(p, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Equal reports whether two documents grant the same permissions, ignoring
+// statement order, list order and formatting.
+func Equal(a, b *Document) bool {
+	return a.canonical() == b.canonical()
+}
+
+func (d *Document) canonical() string {
+	var parts []string
+	for _, s := range d.Statements {
+		c := s
+		c.Actions = sorted(c.Actions)
+		c.NotActions = sorted(c.NotActions)
+		c.Resources = sorted(c.Resources)
+		c.NotResources = sorted(c.NotResources)
+		c.Principals = sortedMap(c.Principals)
+		c.NotPrincipals = sortedMap(c.NotPrincipals)
+		if s.Conditions != nil {
+			c.Conditions = make(map[string]map[string][]string, len(s.Conditions))
+			for op, kv := range s.Conditions {
+				c.Conditions[op] = sortedMap(kv)
+			}
+		}
+		// Sids are labels and do not change what a statement allows.
+		c.Sid = ""
+		b, _ := json.Marshal(c)
+		parts = append(parts, string(b))
+	}
+	sort.Strings(parts)
+
+	return strings.Join(parts, "\n")
+}
+
+func sorted(in []string) []string {
+	out := append([]string{}, in...)
+	sort.Strings(out)
+
+	return out
+}
+
+func sortedMap(in map[string][]string) map[string][]string {
+	if in == nil {
+		return nil
+	}
+	out := make(map[string][]string, len(in))
+	for k, v := range in {
+		out[k] = sorted(v)
+	}
+
+	return out
+}
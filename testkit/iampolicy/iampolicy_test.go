@@ -0,0 +1,60 @@
+package iampolicy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNormalizesStringsAndLists(t *testing.T) {
+	doc, err := Parse(`{
+		"Version": "2012-10-17",
+		"Statement": {
+			"Effect": "Allow",
+			"Principal": "*",
+			"Action": "s3:PutObject",
+			"Resource": "arn:aws:s3:::logs/*",
+			"Condition": {"StringEquals": {"aws:SourceAccount": "111122223333"}, "Bool": {"aws:SecureTransport": [true]}}
+		}
+	}`)
+	require.NoError(t, err)
+	require.Len(t, doc.Statements, 1)
+
+	s := doc.Statements[0]
+	assert.True(t, s.Allows())
+	assert.Equal(t, []string{"s3:PutObject"}, s.Actions)
+	assert.True(t, s.HasPrincipal("Service", "bedrock.amazonaws.com"))
+	assert.True(t, s.MatchesResource("arn:aws:s3:::logs/bedrock/1.json"))
+	assert.False(t, s.MatchesResource("arn:aws:s3:::other/1.json"))
+	assert.Equal(t, []string{"111122223333"}, s.ConditionValues("AWS:SourceAccount"))
+	assert.Equal(t, []string{"true"}, s.ConditionValues("aws:SecureTransport"))
+	assert.Equal(t, []string{"aws:securetransport", "aws:sourceaccount"}, s.ConditionKeys())
+}
+
+func TestMatchesAction(t *testing.T) {
+	allow := Statement{Actions: []string{"logs:Put*", "kms:Decrypt"}}
+	assert.True(t, allow.MatchesAction("logs:PutLogEvents"))
+	assert.True(t, allow.MatchesAction("KMS:decrypt"))
+	assert.False(t, allow.MatchesAction("logs:CreateLogStream"))
+
+	notAction := Statement{NotActions: []string{"kms:ScheduleKeyDeletion"}}
+	assert.True(t, notAction.MatchesAction("kms:Encrypt"))
+	assert.False(t, notAction.MatchesAction("kms:ScheduleKeyDeletion"))
+}
+
+func TestEqualIgnoresOrderAndSids(t *testing.T) {
+	a, err := Parse(`{"Statement":[
+		{"Sid":"A","Effect":"Allow","Principal":{"AWS":["r1","r2"]},"Action":["kms:Encrypt","kms:Decrypt"],"Resource":"*"},
+		{"Effect":"Deny","Principal":"*","Action":"kms:*","Resource":"*"}]}`)
+	require.NoError(t, err)
+	b, err := Parse(`{"Statement":[
+		{"Effect":"Deny","Principal":"*","Action":["kms:*"],"Resource":["*"]},
+		{"Sid":"B","Effect":"Allow","Principal":{"AWS":["r2","r1"]},"Action":["kms:Decrypt","kms:Encrypt"],"Resource":"*"}]}`)
+	require.NoError(t, err)
+	c, err := Parse(`{"Statement":[{"Effect":"Deny","Principal":"*","Action":"kms:*","Resource":"*"}]}`)
+	require.NoError(t, err)
+
+	assert.True(t, Equal(a, b))
+	assert.False(t, Equal(a, c))
+}
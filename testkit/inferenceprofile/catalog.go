@@ -0,0 +1,111 @@
+// Package inferenceprofile validates the model source of planned
+// aws_bedrock_inference_profile resources against a checked-in catalog of
+// Bedrock models, the regions that serve them on demand and the
+// geographies that have cross-region system inference profiles for them.
+package inferenceprofile
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Model is one catalog entry.
+type Model struct {
+	ID string `json:"id"`
+	// Regions serve the model on demand, so an application profile can
+	// copy from its foundation-model ARN there.
+	Regions []string `json:"regions"`
+	// Geographies have a system inference profile "<geo>.<id>" routing
+	// requests across the geography's regions.
+	Geographies []string `json:"geographies"`
+}
+
+// Catalog lists the models Bedrock offers.
+type Catalog struct {
+	// Geographies maps a system profile prefix such as "us" to the regions
+	// its profiles route to.
+	Geographies map[string][]string `json:"geographies"`
+	Models      []Model             `json:"models"`
+}
+
+//go:embed catalog.json
+var catalogJSON []byte
+
+// DefaultCatalog returns the checked-in catalog. Update catalog.json when
+// Bedrock adds models or regions.
+func DefaultCatalog() *Catalog {
+	c, err := ParseCatalog(catalogJSON)
+	if err != nil {
+		panic(err)
+	}
+
+	return c
+}
+
+// ParseCatalog parses a catalog in the catalog.json format.
+func ParseCatalog(data []byte) (*Catalog, error) {
+	var c Catalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parsing model catalog: %w", err)
+	}
+	for _, m := range c.Models {
+		for _, g := range m.Geographies {
+			if _, ok := c.Geographies[g]; !ok {
+				return nil, fmt.Errorf("model catalog: %s lists unknown geography %q", m.ID, g)
+			}
+		}
+	}
+
+	return &c, nil
+}
+
+// Model returns the catalog entry for id.
+func (c *Catalog) Model(id string) (Model, bool) {
+	for _, m := range c.Models {
+		if m.ID == id {
+			return m, true
+		}
+	}
+
+	return Model{}, false
+}
+
+// ModelIDs returns every model ID, sorted.
+func (c *Catalog) ModelIDs() []string {
+	ids := make([]string, len(c.Models))
+	for i, m := range c.Models {
+		ids[i] = m.ID
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// OnDemand reports whether m is served on demand in region.
+func (m Model) OnDemand(region string) bool {
+	return contains(m.Regions, region)
+}
+
+// ProfileGeography returns the geography whose system profile for m can be
+// called from region, if there is one.
+func (c *Catalog) ProfileGeography(m Model, region string) (string, bool) {
+	for _, g := range m.Geographies {
+		if contains(c.Geographies[g], region) {
+			return g, true
+		}
+	}
+
+	return "", false
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,105 @@
+package inferenceprofile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+func TestDefaultCatalog(t *testing.T) {
+	c := DefaultCatalog()
+	m, ok := c.Model("anthropic.claude-3-haiku-20240307-v1:0")
+	require.True(t, ok)
+	assert.True(t, m.OnDemand("us-east-1"))
+
+	m, ok = c.Model("anthropic.claude-3-7-sonnet-20250219-v1:0")
+	require.True(t, ok)
+	assert.False(t, m.OnDemand("us-east-1"))
+	g, ok := c.ProfileGeography(m, "eu-west-1")
+	assert.True(t, ok)
+	assert.Equal(t, "eu", g)
+}
+
+func TestParseARN(t *testing.T) {
+	a, err := ParseARN("arn:aws:bedrock:eu-central-1:123456789012:inference-profile/eu.anthropic.claude-3-5-sonnet-20240620-v1:0")
+	require.NoError(t, err)
+	assert.Equal(t, ARN{Partition: "aws", Region: "eu-central-1", Account: "123456789012", Kind: KindInferenceProfile, ID: "eu.anthropic.claude-3-5-sonnet-20240620-v1:0"}, a)
+
+	for _, bad := range []string{
+		"anthropic.claude-3-haiku-20240307-v1:0",
+		"arn:aws:bedrock:us-west-2:123456789012:foundation-model/anthropic.claude-3-haiku-20240307-v1:0",
+		"arn:aws:bedrock:us-west-2::inference-profile/us.anthropic.claude-3-haiku-20240307-v1:0",
+		"arn:aws:bedrock:uswest2::foundation-model/anthropic.claude-3-haiku-20240307-v1:0",
+		"arn:aws:s3:::bucket",
+	} {
+		_, err := ParseARN(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	solution := Options{Region: "us-east-1", AllowedRegions: []string{"us-east-1", "us-east-2", "us-west-2"}}
+
+	tests := []struct {
+		name     string
+		copyFrom string
+		opts     Options
+		want     []string
+	}{
+		{"on demand", "arn:aws:bedrock:us-east-1::foundation-model/anthropic.claude-3-haiku-20240307-v1:0", solution, nil},
+		{"us system profile", "arn:aws:bedrock:us-east-1:111122223333:inference-profile/us.anthropic.claude-3-7-sonnet-20250219-v1:0", solution, nil},
+		{"needs system profile", "arn:aws:bedrock:us-east-1::foundation-model/anthropic.claude-3-opus-20240229-v1:0", solution,
+			[]string{RuleCrossRegionRequired}},
+		{"not offered in region", "arn:aws:bedrock:eu-west-1::foundation-model/anthropic.claude-3-opus-20240229-v1:0", Options{},
+			[]string{RuleRegion}},
+		{"unknown model", "arn:aws:bedrock:us-east-1::foundation-model/anthropic.claude-3-haiku-20240307-v2:0", solution,
+			[]string{RuleUnknownModel}},
+		{"malformed", "arn:aws:bedrock:us-east-1:111122223333:foundation-model/anthropic.claude-3-haiku-20240307-v1:0", solution,
+			[]string{RuleARN}},
+		{"other region", "arn:aws:bedrock:us-west-2::foundation-model/anthropic.claude-3-haiku-20240307-v1:0", solution,
+			[]string{RuleRegion}},
+		{"eu profile outside allowed regions", "arn:aws:bedrock:eu-central-1:111122223333:inference-profile/eu.anthropic.claude-3-haiku-20240307-v1:0",
+			Options{AllowedRegions: solution.AllowedRegions}, []string{RuleAllowedRegions, RuleAllowedRegions}},
+		{"no such geography for model", "arn:aws:bedrock:eu-central-1:111122223333:inference-profile/eu.anthropic.claude-3-opus-20240229-v1:0", Options{},
+			[]string{RuleUnknownModel}},
+		{"not in foundation_models", "arn:aws:bedrock:us-east-1::foundation-model/anthropic.claude-3-haiku-20240307-v1:0",
+			Options{FoundationModels: []string{"arn:aws:bedrock:*::foundation-model/amazon.*"}}, []string{RuleFoundationModels}},
+		{"in foundation_models", "arn:aws:bedrock:us-east-1::foundation-model/anthropic.claude-3-haiku-20240307-v1:0",
+			Options{FoundationModels: []string{"arn:aws:bedrock:*::foundation-model/anthropic.*"}}, nil},
+		{"application profile", "arn:aws:bedrock:us-east-1:111122223333:application-inference-profile/a1b2c3d4e5f6", solution,
+			[]string{RuleNotChecked}},
+	}
+
+	c := DefaultCatalog()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := c.Validate("aws_bedrock_inference_profile.this", tt.copyFrom, tt.opts)
+			var got []string
+			for _, f := range findings {
+				got = append(got, f.Rule)
+			}
+			assert.ElementsMatch(t, tt.want, got, findings.String())
+		})
+	}
+
+	f := c.Validate("x", "arn:aws:bedrock:us-east-1::foundation-model/anthropic.claude-3-haiku-20240307-v2:0", Options{})
+	require.Len(t, f, 1)
+	assert.Contains(t, f[0].Message, `did you mean "anthropic.claude-3-haiku-20240307-v1:0"`)
+}
+
+func TestValidatePlan(t *testing.T) {
+	p, err := plan.Load("testdata/plan.json")
+	require.NoError(t, err)
+
+	findings := ValidatePlan(p, DefaultCatalog(), Options{AllowedRegions: []string{"us-east-1", "us-east-2", "us-west-2"}})
+	for _, f := range findings {
+		assert.Equal(t, "module.cross_account_inference_profile[0].aws_bedrock_inference_profile.this", f.Address, f.String())
+	}
+	assert.Len(t, findings.AtLeast(finding.High), 1, findings.String())
+	assert.Len(t, findings.ByRule(RuleRegion), 1, findings.String())
+	assert.Len(t, findings.ByRule(RuleAllowedRegions), 2, findings.String())
+}
@@ -0,0 +1,222 @@
+package inferenceprofile
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/iampolicy"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+// ResourceType is the Terraform resource type the validator reads.
+const ResourceType = "aws_bedrock_inference_profile"
+
+// Rule identifiers reported by Validate.
+const (
+	RuleARN                 = "inference-profile-arn"
+	RuleUnknownModel        = "inference-profile-unknown-model"
+	RuleRegion              = "inference-profile-region"
+	RuleCrossRegionRequired = "inference-profile-cross-region-required"
+	RuleAllowedRegions      = "inference-profile-allowed-regions"
+	RuleFoundationModels    = "inference-profile-foundation-models"
+	RuleNotChecked          = "inference-profile-not-checked"
+)
+
+// Kinds of Bedrock ARN a profile can copy from.
+const (
+	KindFoundationModel    = "foundation-model"
+	KindInferenceProfile   = "inference-profile"
+	KindApplicationProfile = "application-inference-profile"
+)
+
+var arnPattern = regexp.MustCompile(`^arn:(aws|aws-cn|aws-us-gov):bedrock:([a-z]{2}(?:-gov)?-[a-z]+-\d):(\d{12})?:(` +
+	KindFoundationModel + `|` + KindInferenceProfile + `|` + KindApplicationProfile + `)/([A-Za-z0-9.:_-]+)$`)
+
+// ARN is a parsed model_source.copy_from ARN.
+type ARN struct {
+	Partition string
+	Region    string
+	Account   string
+	Kind      string
+	ID        string
+}
+
+// ParseARN parses a foundation-model, inference-profile or
+// application-inference-profile ARN.
+func ParseARN(s string) (ARN, error) {
+	m := arnPattern.FindStringSubmatch(s)
+	if m == nil {
+		return ARN{}, fmt.Errorf("%q is not a Bedrock foundation-model or inference-profile ARN", s)
+	}
+	a := ARN{Partition: m[1], Region: m[2], Account: m[3], Kind: m[4], ID: m[5]}
+	switch {
+	case a.Kind == KindFoundationModel && a.Account != "":
+		return ARN{}, fmt.Errorf("%q: foundation-model ARNs have no account ID", s)
+	case a.Kind != KindFoundationModel && a.Account == "":
+		return ARN{}, fmt.Errorf("%q: %s ARNs need an account ID", s, a.Kind)
+	}
+
+	return a, nil
+}
+
+func (a ARN) String() string {
+	return fmt.Sprintf("arn:%s:bedrock:%s:%s:%s/%s", a.Partition, a.Region, a.Account, a.Kind, a.ID)
+}
+
+// Options describe the deployment the profiles must fit.
+type Options struct {
+	// Region is the provider region the profiles are created in. ValidatePlan
+	// defaults it to the plan's aws_region variable.
+	Region string
+	// AllowedRegions and FoundationModels mirror the solution module's
+	// allowed_model_regions and foundation_models variables. Empty lists
+	// are not checked.
+	AllowedRegions   []string
+	FoundationModels []string
+}
+
+// ValidatePlan validates the model source of every inference profile in
+// the plan. Sources only known after apply are skipped.
+func ValidatePlan(p *tfjson.Plan, c *Catalog, opts Options) finding.List {
+	if opts.Region == "" {
+		if v, ok := plan.Variable(p, "aws_region"); ok {
+			opts.Region, _ = v.(string)
+		}
+	}
+
+	var out finding.List
+	for _, r := range plan.ResourcesOfType(p, ResourceType) {
+		sources := r.Blocks("model_source")
+		if len(sources) == 0 || r.IsUnknown("model_source") {
+			continue
+		}
+		copyFrom, _ := sources[0]["copy_from"].(string)
+		out = append(out, c.Validate(r.Address, copyFrom, opts)...)
+	}
+	out.Sort()
+
+	return out
+}
+
+// Validate checks one copy_from ARN. address labels the findings.
+func (c *Catalog) Validate(address, copyFrom string, opts Options) finding.List {
+	const path = "model_source.copy_from"
+	var out finding.List
+	add := func(s finding.Severity, rule, format string, args ...interface{}) {
+		out = append(out, finding.Finding{Severity: s, Rule: rule, Address: address, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	a, err := ParseARN(copyFrom)
+	if err != nil {
+		add(finding.High, RuleARN, "%v", err)
+		return out
+	}
+	if opts.Region != "" && a.Region != opts.Region {
+		add(finding.High, RuleRegion, "source is in %s but the profile is created in %s; copy from a source in the provider region", a.Region, opts.Region)
+	}
+	if len(opts.AllowedRegions) > 0 && !contains(opts.AllowedRegions, a.Region) {
+		add(finding.Medium, RuleAllowedRegions, "%s is not in allowed_model_regions (%s)", a.Region, strings.Join(opts.AllowedRegions, ", "))
+	}
+
+	// regions collects where requests through the profile are served.
+	var (
+		model   Model
+		regions []string
+	)
+	switch a.Kind {
+	case KindFoundationModel:
+		m, ok := c.Model(a.ID)
+		if !ok {
+			add(finding.High, RuleUnknownModel, "model %q is not in the catalog%s", a.ID, c.suggest(a.ID))
+			return out
+		}
+		model, regions = m, []string{a.Region}
+		if !m.OnDemand(a.Region) {
+			if g, ok := c.ProfileGeography(m, a.Region); ok {
+				profile := ARN{Partition: a.Partition, Region: a.Region, Account: "<account>", Kind: KindInferenceProfile, ID: g + "." + m.ID}
+				add(finding.High, RuleCrossRegionRequired, "%s is not served on demand in %s; copy from the system profile %s", m.ID, a.Region, profile)
+			} else {
+				add(finding.High, RuleRegion, "%s is not available in %s", m.ID, a.Region)
+			}
+		}
+
+	case KindInferenceProfile:
+		geo, id, _ := strings.Cut(a.ID, ".")
+		if _, ok := c.Geographies[geo]; !ok {
+			add(finding.High, RuleUnknownModel, "%q is not a system profile: %q is not a known geography", a.ID, geo)
+			return out
+		}
+		m, ok := c.Model(id)
+		if !ok {
+			add(finding.High, RuleUnknownModel, "model %q is not in the catalog%s", id, c.suggest(id))
+			return out
+		}
+		model, regions = m, c.Geographies[geo]
+		switch {
+		case !contains(m.Geographies, geo):
+			add(finding.High, RuleUnknownModel, "%s has no %s system profile", m.ID, geo)
+		case !contains(regions, a.Region):
+			add(finding.High, RuleRegion, "the %s system profile cannot be called from %s", geo, a.Region)
+		}
+
+	default:
+		add(finding.Low, RuleNotChecked, "source is another application inference profile; its model cannot be checked from the ARN")
+		return out
+	}
+
+	if len(opts.AllowedRegions) > 0 && a.Kind == KindInferenceProfile {
+		var outside []string
+		for _, r := range regions {
+			if !contains(opts.AllowedRegions, r) {
+				outside = append(outside, r)
+			}
+		}
+		if len(outside) > 0 {
+			add(finding.Medium, RuleAllowedRegions, "the system profile routes requests to %s, outside allowed_model_regions", strings.Join(outside, ", "))
+		}
+	}
+	if len(opts.FoundationModels) > 0 {
+		for _, r := range regions {
+			arn := fmt.Sprintf("arn:%s:bedrock:%s::%s/%s", a.Partition, r, KindFoundationModel, model.ID)
+			if !matchesAny(opts.FoundationModels, arn) {
+				add(finding.Medium, RuleFoundationModels, "%s is not listed in foundation_models", arn)
+			}
+		}
+	}
+
+	return out
+}
+
+func matchesAny(patterns []string, value string) bool {
+	for _, p := range patterns {
+		if iampolicy.Match(p, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// suggest returns a hint naming the catalog model that shares the longest
+// prefix with id, such as a newer version of the same model.
+func (c *Catalog) suggest(id string) string {
+	best, bestScore := "", 0
+	for _, m := range c.ModelIDs() {
+		score := 0
+		for score < len(m) && score < len(id) && m[score] == id[score] {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = m, score
+		}
+	}
+	if bestScore < strings.Index(id, ".")+2 {
+		return ""
+	}
+
+	return fmt.Sprintf("; did you mean %q?", best)
+}
@@ -0,0 +1,56 @@
+// Package graph finds cycles among named nodes, such as composite alarms
+// referencing each other or metric math queries using each other's
+// results.
+package graph
+
+import "sort"
+
+// Cycles returns each cycle of two or more nodes once, starting at the
+// member reached first when walking the nodes of edges in sorted order.
+// edges maps a node to the nodes it references; references to nodes that
+// are not keys of edges lead nowhere. Self-references are left to the
+// caller.
+func Cycles(edges map[string][]string) [][]string {
+	var out [][]string
+	reported := map[string]bool{}
+	var path []string
+	onPath := map[string]int{}
+	var visit func(n string)
+	visit = func(n string) {
+		if i, ok := onPath[n]; ok {
+			cycle := append([]string(nil), path[i:]...)
+			if len(cycle) > 1 && !reported[cycle[0]] {
+				for _, c := range cycle {
+					reported[c] = true
+				}
+				out = append(out, cycle)
+			}
+			return
+		}
+		if _, ok := edges[n]; !ok || reported[n] {
+			return
+		}
+		onPath[n] = len(path)
+		path = append(path, n)
+		for _, m := range edges[n] {
+			visit(m)
+		}
+		path = path[:len(path)-1]
+		delete(onPath, n)
+	}
+	for _, n := range sortedKeys(edges) {
+		visit(n)
+	}
+
+	return out
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,20 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCycles(t *testing.T) {
+	assert.Empty(t, Cycles(map[string][]string{"a": {"b"}, "b": {"c"}, "c": nil}))
+	assert.Empty(t, Cycles(map[string][]string{"a": {"a"}}), "self-references are the caller's")
+	assert.Empty(t, Cycles(map[string][]string{"a": {"missing"}}))
+	assert.Equal(t, [][]string{{"a", "b", "c"}, {"x", "y"}}, Cycles(map[string][]string{
+		"a": {"b"},
+		"b": {"c"},
+		"c": {"a", "x"},
+		"x": {"y"},
+		"y": {"x"},
+	}))
+}
@@ -0,0 +1,64 @@
+// Package hint suggests the name a user probably meant when a checker
+// meets one it does not know, so every checker words and ranks its "did
+// you mean" hints the same way.
+package hint
+
+import (
+	"fmt"
+	"strings"
+)
+
+// separators are ignored when comparing names, so LINKEDACCOUNT matches
+// LINKED_ACCOUNT and portmappings matches portMappings.
+var separators = strings.NewReplacer("_", "", "-", "", " ", "")
+
+// DidYouMean returns "; did you mean <candidate>?" for the candidate
+// closest to s, or "" when none is close.
+func DidYouMean(s string, candidates []string) string {
+	best := Closest(s, candidates)
+	if best == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("; did you mean %s?", best)
+}
+
+// Closest returns the candidate closest to s by edit distance, ignoring
+// case and separators, or "" when the closest is more than two edits and
+// more than a third of s away.
+func Closest(s string, candidates []string) string {
+	norm := func(x string) string { return strings.ToLower(separators.Replace(x)) }
+	best, bestDist := "", -1
+	for _, c := range candidates {
+		if d := Distance(norm(s), norm(c)); bestDist < 0 || d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	if bestDist < 0 || bestDist > 2 && bestDist > len(norm(s))/3 {
+		return ""
+	}
+
+	return best
+}
+
+// Distance is the Levenshtein distance between a and b.
+func Distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+
+	return prev[len(b)]
+}
@@ -0,0 +1,31 @@
+package hint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistance(t *testing.T) {
+	assert.Equal(t, 0, Distance("", ""))
+	assert.Equal(t, 3, Distance("kitten", "sitting"))
+	assert.Equal(t, 4, Distance("", "abcd"))
+}
+
+func TestDidYouMean(t *testing.T) {
+	tests := []struct {
+		s          string
+		candidates []string
+		want       string
+	}{
+		{"portMapping", []string{"portMappings", "essential"}, "; did you mean portMappings?"},
+		{"LINKEDACCOUNT", []string{"LINKED_ACCOUNT", "REGION"}, "; did you mean LINKED_ACCOUNT?"},
+		{"REGION", []string{"Region", "Service"}, "; did you mean Region?"},
+		{"ANOMALY_DETECTION_FUNCTION", []string{"ANOMALY_DETECTION_BAND", "METRICS"}, "; did you mean ANOMALY_DETECTION_BAND?"},
+		{"banana", []string{"Region", "Service"}, ""},
+		{"x", nil, ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, DidYouMean(tt.s, tt.candidates), tt.s)
+	}
+}
@@ -0,0 +1,159 @@
+package invocationlog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+)
+
+// Rule identifiers reported by Check.
+const (
+	RuleUnparseable      = "invocation-log-unparseable"
+	RuleSchema           = "invocation-log-schema"
+	RuleDestination      = "invocation-log-destination"
+	RuleDisabledModality = "invocation-log-disabled-modality"
+	RuleLargeData        = "invocation-log-large-data"
+)
+
+// permissionCheck is the object Bedrock writes when the configuration is
+// saved, to prove it can write to the bucket.
+const permissionCheck = "amazon-bedrock-logs-permission-check"
+
+// Validate returns the schema problems of a single record.
+func Validate(r Record) []string {
+	var out []string
+	if r.SchemaType != SchemaType {
+		out = append(out, fmt.Sprintf("schemaType is %q, want %q", r.SchemaType, SchemaType))
+	}
+	known := false
+	for _, v := range SchemaVersions {
+		known = known || r.SchemaVersion == v
+	}
+	if !known {
+		out = append(out, fmt.Sprintf("schemaVersion %q is not one of %s", r.SchemaVersion, strings.Join(SchemaVersions, ", ")))
+	}
+	for field, v := range map[string]string{"accountId": r.AccountID, "region": r.Region, "requestId": r.RequestID, "operation": r.Operation, "modelId": r.ModelID} {
+		if v == "" {
+			out = append(out, field+" is empty")
+		}
+	}
+	if r.Timestamp.IsZero() {
+		out = append(out, "timestamp is missing")
+	}
+	for _, b := range r.Bodies() {
+		if len(b.JSON) > 0 && b.S3Path != "" {
+			out = append(out, fmt.Sprintf("%s has both %sBodyJson and %sBodyS3Path", b.Side, b.Side, b.Side))
+		}
+		if b.S3Path != "" {
+			if _, _, err := ParseS3Path(b.S3Path); err != nil {
+				out = append(out, fmt.Sprintf("%sBodyS3Path: %v", b.Side, err))
+			}
+		}
+	}
+	if r.Output == nil && r.ErrorCode == "" {
+		out = append(out, "output is missing and no errorCode is set")
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+// Check verifies what was delivered into s against the configuration:
+// every record parses and is valid, S3 records sit under the configured
+// prefix for their account and region, events go to the configured log
+// group, large-data pointers resolve to objects under the large-data
+// prefix, and no record of a disabled modality was delivered.
+func (c Config) Check(s *Sink) finding.List {
+	var out finding.List
+	add := func(sev finding.Severity, rule, address, path, msg string) {
+		out = append(out, finding.Finding{Severity: sev, Rule: rule, Address: address, Path: path, Message: msg})
+	}
+	checkRecord := func(address string, r Record) {
+		where := "requestId " + r.RequestID
+		for _, p := range Validate(r) {
+			add(finding.High, RuleSchema, address, where, p)
+		}
+		if m := DetectModality(r); !c.Enabled(m) {
+			add(finding.High, RuleDisabledModality, address, where, fmt.Sprintf("%s record delivered but %s_data_delivery_enabled is false", m, m))
+		}
+	}
+
+	for _, o := range s.Objects {
+		if strings.HasSuffix(o.Key, permissionCheck) || isLargeData(o) {
+			continue
+		}
+		if c.S3 == nil {
+			add(finding.High, RuleDestination, o.Path(), "", "log object written but s3_config is not set")
+			continue
+		}
+		inside := c.S3.Contains(o.Bucket, o.Key)
+		if !inside {
+			add(finding.High, RuleDestination, o.Path(), "", fmt.Sprintf("object is outside bucket %q prefix %q", c.S3.Bucket, c.S3.Prefix))
+		}
+		records, err := ParseObject(o.Body)
+		if err != nil {
+			add(finding.High, RuleUnparseable, o.Path(), "", err.Error())
+			continue
+		}
+		for _, r := range records {
+			if want := hourKey(*c.S3, r); inside && !strings.HasPrefix(o.Key, want) {
+				add(finding.High, RuleDestination, o.Path(), "requestId "+r.RequestID, fmt.Sprintf("record belongs under %s", want))
+			}
+			checkRecord(o.Path(), r)
+		}
+	}
+
+	for group, events := range s.Events {
+		if c.CloudWatch == nil || group != c.CloudWatch.LogGroup {
+			add(finding.High, RuleDestination, "log-group:"+group, "", "events delivered to a log group that is not configured")
+			continue
+		}
+		for _, e := range events {
+			address := fmt.Sprintf("log-group:%s:%s#%s", group, LogStream, e.ID)
+			r, err := ParseRecord([]byte(e.Message))
+			if err != nil {
+				add(finding.High, RuleUnparseable, address, "", err.Error())
+				continue
+			}
+			checkRecord(address, r)
+			for _, b := range r.Bodies() {
+				if b.S3Path == "" {
+					continue
+				}
+				c.checkPointer(s, address, b, add)
+			}
+		}
+	}
+	out.Sort()
+
+	return out
+}
+
+func (c Config) checkPointer(s *Sink, address string, b Body, add func(finding.Severity, string, string, string, string)) {
+	path := b.Side + "." + b.Side + "BodyS3Path"
+	bucket, key, err := ParseS3Path(b.S3Path)
+	if err != nil {
+		return // reported by Validate
+	}
+	ld := c.CloudWatch.LargeData
+	if ld == nil {
+		add(finding.High, RuleLargeData, address, path, "record points at large data but large_data_delivery_s3_config is not set")
+		return
+	}
+	if !ld.Contains(bucket, key) {
+		add(finding.High, RuleLargeData, address, path, fmt.Sprintf("%s is outside bucket %q prefix %q", b.S3Path, ld.Bucket, ld.Prefix))
+	}
+	if _, ok := s.Object(bucket, key); !ok {
+		add(finding.High, RuleLargeData, address, path, fmt.Sprintf("%s does not exist", b.S3Path))
+	}
+}
+
+// isLargeData reports whether o is a body written to a large-data
+// location rather than a log object. Bodies are checked through the
+// pointers to them.
+func isLargeData(o Object) bool {
+	return strings.Contains(o.Key, "/data/") && !strings.HasSuffix(o.Key, ".json.gz")
+}
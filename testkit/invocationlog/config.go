@@ -0,0 +1,135 @@
+package invocationlog
+
+import (
+	"path"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+// ResourceType is the Terraform resource type of the logging configuration.
+const ResourceType = "aws_bedrock_model_invocation_logging_configuration"
+
+// LogStream is the CloudWatch Logs stream Bedrock writes records to.
+const LogStream = "aws/bedrock/modelinvocations"
+
+// Modality is a kind of data whose delivery can be switched off.
+type Modality string
+
+const (
+	Text      Modality = "text"
+	Image     Modality = "image"
+	Embedding Modality = "embedding"
+	Video     Modality = "video"
+)
+
+// Modalities lists every modality.
+var Modalities = []Modality{Text, Image, Embedding, Video}
+
+// Location is an S3 bucket and key prefix. An empty Bucket means the name is
+// not known until apply and matches any bucket.
+type Location struct {
+	Bucket string
+	Prefix string
+}
+
+// CloudWatch is cloudwatch_config.
+type CloudWatch struct {
+	LogGroup  string
+	RoleARN   string
+	LargeData *Location
+}
+
+// Config is a logging configuration.
+type Config struct {
+	Address    string
+	S3         *Location
+	CloudWatch *CloudWatch
+	// Delivery says whether each modality is delivered.
+	Delivery map[Modality]bool
+}
+
+// Enabled reports whether records of m are delivered. Modalities missing
+// from Delivery are enabled, matching the module's defaults.
+func (c Config) Enabled(m Modality) bool {
+	enabled, ok := c.Delivery[m]
+	return !ok || enabled
+}
+
+// FromPlan returns every logging configuration planned in p.
+func FromPlan(p *tfjson.Plan) []Config {
+	var out []Config
+	for _, r := range plan.ResourcesOfType(p, ResourceType) {
+		c := FromValues(r.Values)
+		c.Address = r.Address
+		out = append(out, c)
+	}
+
+	return out
+}
+
+// FromValues decodes the attribute values of the logging configuration.
+func FromValues(v map[string]interface{}) Config {
+	c := Config{Delivery: map[Modality]bool{}}
+	lc := first(v, "logging_config")
+	if lc == nil {
+		return c
+	}
+	for _, m := range Modalities {
+		if b, ok := lc[string(m)+"_data_delivery_enabled"].(bool); ok {
+			c.Delivery[m] = b
+		}
+	}
+	if s3 := first(lc, "s3_config"); s3 != nil {
+		c.S3 = location(s3)
+	}
+	if cw := first(lc, "cloudwatch_config"); cw != nil {
+		c.CloudWatch = &CloudWatch{LogGroup: str(cw, "log_group_name"), RoleARN: str(cw, "role_arn")}
+		if ld := first(cw, "large_data_delivery_s3_config"); ld != nil {
+			c.CloudWatch.LargeData = location(ld)
+		}
+	}
+
+	return c
+}
+
+// KeyPrefix returns the key prefix under which records for account and
+// region are written:
+// <prefix>/AWSLogs/<account>/BedrockModelInvocationLogs/<region>/.
+func (l Location) KeyPrefix(account, region string) string {
+	return path.Join(l.Prefix, "AWSLogs", account, "BedrockModelInvocationLogs", region) + "/"
+}
+
+// Contains reports whether bucket and key fall under the location. An empty
+// Bucket matches any bucket.
+func (l Location) Contains(bucket, key string) bool {
+	if l.Bucket != "" && bucket != l.Bucket {
+		return false
+	}
+	prefix := strings.Trim(l.Prefix, "/")
+	if prefix == "" {
+		return true
+	}
+
+	return strings.HasPrefix(key, prefix+"/")
+}
+
+func location(m map[string]interface{}) *Location {
+	return &Location{Bucket: str(m, "bucket_name"), Prefix: str(m, "key_prefix")}
+}
+
+func str(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+func first(m map[string]interface{}, key string) map[string]interface{} {
+	blocks := plan.Objects(m[key])
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	return blocks[0]
+}
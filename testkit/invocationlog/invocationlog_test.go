@@ -0,0 +1,183 @@
+package invocationlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+const (
+	account = "111122223333"
+	region  = "us-east-1"
+)
+
+var at = time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+func hybridConfig(t *testing.T) Config {
+	t.Helper()
+	p, err := plan.Load("testdata/plan.json")
+	require.NoError(t, err)
+	configs := FromPlan(p)
+	require.Len(t, configs, 1)
+
+	return configs[0]
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	return buf.Bytes()
+}
+
+func TestFromPlan(t *testing.T) {
+	c := hybridConfig(t)
+	assert.Equal(t, &Location{Prefix: "standard-logs"}, c.S3)
+	assert.Equal(t, "/aws/bedrock/test-hybrid-invocations", c.CloudWatch.LogGroup)
+	assert.Equal(t, &Location{Prefix: "large-data-logs"}, c.CloudWatch.LargeData)
+	assert.False(t, c.Enabled(Video))
+	assert.True(t, c.Enabled(Text))
+	assert.Equal(t, "standard-logs/AWSLogs/1/BedrockModelInvocationLogs/eu-west-1/", c.S3.KeyPrefix("1", "eu-west-1"))
+}
+
+func TestParseObject(t *testing.T) {
+	data, err := os.ReadFile("testdata/records.jsonl")
+	require.NoError(t, err)
+
+	for _, body := range [][]byte{data, gzipped(t, data)} {
+		records, err := ParseObject(body)
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+		assert.Equal(t, "anthropic.claude-v2", records[0].ModelID)
+		assert.Equal(t, 9, records[0].Input.TokenCount)
+		assert.Empty(t, Validate(records[0]))
+		assert.Equal(t, Text, DetectModality(records[0]))
+		assert.Equal(t, Embedding, DetectModality(records[1]))
+
+		bucket, key, err := ParseS3Path(records[1].Input.BodyS3Path)
+		require.NoError(t, err)
+		assert.Equal(t, "large-data", bucket)
+		assert.True(t, strings.HasSuffix(key, "/data/6c9a9d1e_input.json"))
+	}
+
+	_, err = ParseObject([]byte("{\"schemaType\":\n"))
+	assert.ErrorContains(t, err, "line 1")
+}
+
+func TestParseSubscription(t *testing.T) {
+	rec := Synthetic(Text, account, region, at, 1)
+	msg, err := json.Marshal(rec)
+	require.NoError(t, err)
+	payload, err := json.Marshal(Subscription{
+		MessageType: "DATA_MESSAGE",
+		LogGroup:    "/aws/bedrock/invocations",
+		LogStream:   LogStream,
+		LogEvents:   []Event{{ID: "1", Timestamp: at.UnixMilli(), Message: string(msg)}},
+	})
+	require.NoError(t, err)
+
+	sub, err := ParseSubscription([]byte(base64.StdEncoding.EncodeToString(gzipped(t, payload))))
+	require.NoError(t, err)
+	assert.Equal(t, LogStream, sub.LogStream)
+	records, err := ParseEvents(sub.LogEvents)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, rec.RequestID, records[0].RequestID)
+}
+
+func TestValidate(t *testing.T) {
+	r := Synthetic(Text, account, region, at, 1)
+	assert.Empty(t, Validate(r))
+
+	r.SchemaVersion = "2.0"
+	r.ModelID = ""
+	r.Input.BodyS3Path = "bucket/key"
+	r.Output = nil
+	assert.Equal(t, []string{
+		"input has both inputBodyJson and inputBodyS3Path",
+		`inputBodyS3Path: "bucket/key" is not an s3:// path`,
+		"modelId is empty",
+		"output is missing and no errorCode is set",
+		`schemaVersion "2.0" is not one of 1.0`,
+	}, Validate(r))
+}
+
+func TestWriterAndCheck(t *testing.T) {
+	c := hybridConfig(t)
+	sink := &Sink{}
+	w := NewWriter(c, sink)
+
+	var records []Record
+	for i, m := range Modalities {
+		records = append(records, Synthetic(m, account, region, at, i))
+	}
+	large := Synthetic(Text, account, region, at.Add(time.Hour), 10)
+	large.Input.BodyJSON = json.RawMessage(`{"inputText":"` + strings.Repeat("x", DefaultLargeDataThreshold) + `"}`)
+	records = append(records, large)
+	require.NoError(t, w.Write(records...))
+
+	assert.Empty(t, c.Check(sink), "the writer follows the configuration")
+
+	// Two hourly log objects and one large-data body.
+	require.Len(t, sink.Objects, 3)
+	keys := make([]string, len(sink.Objects))
+	for i, o := range sink.Objects {
+		keys[i] = o.Key
+	}
+	sort.Strings(keys)
+	assert.Equal(t, "large-data-logs/AWSLogs/111122223333/BedrockModelInvocationLogs/us-east-1/2024/05/01/13/data/00000000-0000-4000-8000-000000000010_input.json", keys[0])
+	assert.Contains(t, keys[1], "standard-logs/AWSLogs/111122223333/BedrockModelInvocationLogs/us-east-1/2024/05/01/12/")
+	assert.Contains(t, keys[2], "standard-logs/AWSLogs/111122223333/BedrockModelInvocationLogs/us-east-1/2024/05/01/13/")
+
+	events := sink.Events[c.CloudWatch.LogGroup]
+	require.Len(t, events, 4, "the video record is not delivered")
+	cwRecords, err := ParseEvents(events)
+	require.NoError(t, err)
+	for _, r := range cwRecords {
+		assert.NotEqual(t, Video, DetectModality(r))
+	}
+	assert.Equal(t, "s3://"+unknownBucket+"/"+keys[0], cwRecords[3].Input.BodyS3Path)
+	assert.Empty(t, cwRecords[3].Input.BodyJSON)
+
+	// The same delivery checked against a configuration that disables text
+	// and moves the prefix is reported.
+	strict := c
+	strict.Delivery = map[Modality]bool{Text: false, Video: false}
+	strict.S3 = &Location{Prefix: "other"}
+	strict.CloudWatch = &CloudWatch{LogGroup: c.CloudWatch.LogGroup, LargeData: &Location{Prefix: "elsewhere"}}
+	findings := strict.Check(sink)
+	assert.Len(t, findings.ByRule(RuleDisabledModality), 4, "two text records, each in S3 and CloudWatch")
+	assert.Len(t, findings.ByRule(RuleDestination), 2)
+	assert.Len(t, findings.ByRule(RuleLargeData), 1)
+	assert.Equal(t, findings, findings.AtLeast(finding.High))
+
+	// Without a large-data location the large body is dropped from the
+	// CloudWatch record.
+	noLarge := c
+	noLarge.S3 = nil
+	noLarge.CloudWatch = &CloudWatch{LogGroup: "g"}
+	sink2 := &Sink{}
+	require.NoError(t, NewWriter(noLarge, sink2).Write(large))
+	assert.Empty(t, sink2.Objects)
+	dropped, err := ParseEvents(sink2.Events["g"])
+	require.NoError(t, err)
+	assert.Empty(t, dropped[0].Input.BodyJSON)
+	assert.Empty(t, dropped[0].Input.BodyS3Path)
+	assert.Empty(t, noLarge.Check(sink2))
+}
@@ -0,0 +1,198 @@
+// Package invocationlog reads the model invocation logs Bedrock delivers
+// for an aws_bedrock_model_invocation_logging_configuration: gzipped JSON
+// Lines objects in S3, CloudWatch Logs events and subscription payloads,
+// and the large-data S3 objects that CloudWatch records point at.
+//
+// A local Writer produces the same layout from synthetic records, so module
+// tests can check that records land under the configured prefixes and that
+// modalities whose delivery is disabled never appear, without invoking a
+// model.
+package invocationlog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// SchemaType is the schemaType of every invocation log record.
+const SchemaType = "ModelInvocationLog"
+
+// SchemaVersions lists the record schema versions this package understands.
+var SchemaVersions = []string{"1.0"}
+
+// Record is one model invocation log record.
+type Record struct {
+	SchemaType    string    `json:"schemaType"`
+	SchemaVersion string    `json:"schemaVersion"`
+	Timestamp     time.Time `json:"timestamp"`
+	AccountID     string    `json:"accountId"`
+	Identity      *Identity `json:"identity,omitempty"`
+	Region        string    `json:"region"`
+	RequestID     string    `json:"requestId"`
+	Operation     string    `json:"operation"`
+	ModelID       string    `json:"modelId"`
+	ErrorCode     string    `json:"errorCode,omitempty"`
+	Input         Input     `json:"input"`
+	Output        *Output   `json:"output,omitempty"`
+}
+
+// Identity is the caller that invoked the model.
+type Identity struct {
+	ARN string `json:"arn"`
+}
+
+// Input is the request side of a record. A body is carried inline as
+// BodyJSON or, when it was too large for the destination, as a pointer to
+// an object in the large-data bucket.
+type Input struct {
+	ContentType string          `json:"inputContentType,omitempty"`
+	BodyJSON    json.RawMessage `json:"inputBodyJson,omitempty"`
+	BodyS3Path  string          `json:"inputBodyS3Path,omitempty"`
+	TokenCount  int             `json:"inputTokenCount,omitempty"`
+}
+
+// Output is the response side of a record.
+type Output struct {
+	ContentType string          `json:"outputContentType,omitempty"`
+	BodyJSON    json.RawMessage `json:"outputBodyJson,omitempty"`
+	BodyS3Path  string          `json:"outputBodyS3Path,omitempty"`
+	TokenCount  int             `json:"outputTokenCount,omitempty"`
+}
+
+// Body is a uniform view of the input or output body.
+type Body struct {
+	// Side is "input" or "output".
+	Side        string
+	ContentType string
+	JSON        json.RawMessage
+	S3Path      string
+}
+
+// Bodies returns the input body and, when present, the output body.
+func (r Record) Bodies() []Body {
+	out := []Body{{Side: "input", ContentType: r.Input.ContentType, JSON: r.Input.BodyJSON, S3Path: r.Input.BodyS3Path}}
+	if r.Output != nil {
+		out = append(out, Body{Side: "output", ContentType: r.Output.ContentType, JSON: r.Output.BodyJSON, S3Path: r.Output.BodyS3Path})
+	}
+
+	return out
+}
+
+// ParseObject parses an S3 log object: JSON Lines, gzipped or not.
+func ParseObject(data []byte) ([]Record, error) {
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("reading gzipped log object: %w", err)
+		}
+		data, err = io.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("reading gzipped log object: %w", err)
+		}
+	}
+
+	var out []Record
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; s.Scan(); line++ {
+		text := bytes.TrimSpace(s.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		r, err := ParseRecord(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		out = append(out, r)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// ParseRecord parses a single JSON record.
+func ParseRecord(data []byte) (Record, error) {
+	var r Record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return Record{}, fmt.Errorf("parsing invocation log record: %w", err)
+	}
+
+	return r, nil
+}
+
+// Event is a CloudWatch Logs event, as returned by GetLogEvents or carried
+// in a subscription payload.
+type Event struct {
+	ID        string `json:"id,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+}
+
+// ParseEvents parses the record carried by each event.
+func ParseEvents(events []Event) ([]Record, error) {
+	out := make([]Record, 0, len(events))
+	for i, e := range events {
+		r, err := ParseRecord([]byte(e.Message))
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", i, err)
+		}
+		out = append(out, r)
+	}
+
+	return out, nil
+}
+
+// Subscription is a CloudWatch Logs subscription filter payload, as
+// delivered to Lambda or Firehose.
+type Subscription struct {
+	MessageType string  `json:"messageType"`
+	LogGroup    string  `json:"logGroup"`
+	LogStream   string  `json:"logStream"`
+	LogEvents   []Event `json:"logEvents"`
+}
+
+// ParseSubscription decodes a subscription payload. data may be the raw
+// gzipped bytes or their base64 encoding, as found in a Lambda event's
+// awslogs.data field.
+func ParseSubscription(data []byte) (*Subscription, error) {
+	if dec, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data))); err == nil {
+		data = dec
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("reading subscription payload: %w", err)
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("reading subscription payload: %w", err)
+	}
+	var sub Subscription
+	if err := json.Unmarshal(raw, &sub); err != nil {
+		return nil, fmt.Errorf("parsing subscription payload: %w", err)
+	}
+
+	return &sub, nil
+}
+
+// ParseS3Path splits an s3://bucket/key path.
+func ParseS3Path(path string) (bucket, key string, err error) {
+	rest, ok := strings.CutPrefix(path, "s3://")
+	if !ok {
+		return "", "", fmt.Errorf("%q is not an s3:// path", path)
+	}
+	bucket, key, ok = strings.Cut(rest, "/")
+	if !ok || bucket == "" || key == "" {
+		return "", "", fmt.Errorf("%q has no bucket or key", path)
+	}
+
+	return bucket, key, nil
+}
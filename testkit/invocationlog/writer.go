@@ -0,0 +1,254 @@
+package invocationlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultLargeDataThreshold is the body size above which CloudWatch records
+// carry an S3 pointer instead of the body.
+const DefaultLargeDataThreshold = 100 * 1024
+
+// unknownBucket stands in for bucket names that are only known after
+// apply.
+const unknownBucket = "bucket-known-after-apply"
+
+// Object is an S3 object.
+type Object struct {
+	Bucket string
+	Key    string
+	Body   []byte
+}
+
+// Path returns the object's s3:// path.
+func (o Object) Path() string {
+	return "s3://" + o.Bucket + "/" + o.Key
+}
+
+// Sink collects what a Writer delivers. Its fields can equally be filled
+// from a real bucket listing and GetLogEvents.
+type Sink struct {
+	Objects []Object
+	// Events maps a log group to the events in LogStream.
+	Events map[string][]Event
+}
+
+// Object returns the object at bucket and key.
+func (s *Sink) Object(bucket, key string) (Object, bool) {
+	for _, o := range s.Objects {
+		if o.Bucket == bucket && o.Key == key {
+			return o, true
+		}
+	}
+
+	return Object{}, false
+}
+
+// Writer delivers records the way Bedrock does for a Config: one gzipped
+// JSON Lines object per hour under the S3 prefix, one event per record in
+// the CloudWatch log group, and bodies over the large-data threshold moved
+// to the large-data bucket. Records whose modality is disabled are not
+// delivered.
+type Writer struct {
+	cfg  Config
+	sink *Sink
+	// LargeDataThreshold defaults to DefaultLargeDataThreshold.
+	LargeDataThreshold int
+}
+
+// NewWriter returns a Writer for cfg that delivers into sink.
+func NewWriter(cfg Config, sink *Sink) *Writer {
+	if sink.Events == nil {
+		sink.Events = map[string][]Event{}
+	}
+
+	return &Writer{cfg: cfg, sink: sink, LargeDataThreshold: DefaultLargeDataThreshold}
+}
+
+// Write delivers records.
+func (w *Writer) Write(records ...Record) error {
+	hours := map[string][]Record{}
+	for _, r := range records {
+		if !w.cfg.Enabled(DetectModality(r)) {
+			continue
+		}
+		if w.cfg.S3 != nil {
+			key := hourKey(*w.cfg.S3, r)
+			hours[key] = append(hours[key], r)
+		}
+		if w.cfg.CloudWatch != nil {
+			if err := w.writeEvent(r); err != nil {
+				return err
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(hours))
+	for k := range hours {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		enc := json.NewEncoder(zw)
+		for _, r := range hours[k] {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		w.sink.Objects = append(w.sink.Objects, Object{
+			Bucket: bucketName(w.cfg.S3.Bucket),
+			Key:    fmt.Sprintf("%s%s_%d.json.gz", k, hours[k][0].Timestamp.UTC().Format("20060102T1504Z"), len(w.sink.Objects)),
+			Body:   buf.Bytes(),
+		})
+	}
+
+	return nil
+}
+
+func (w *Writer) writeEvent(r Record) error {
+	cw := w.cfg.CloudWatch
+	if len(r.Input.BodyJSON) > w.LargeDataThreshold {
+		p, err := w.writeLargeData(r, "input", r.Input.BodyJSON)
+		if err != nil {
+			return err
+		}
+		r.Input.BodyJSON, r.Input.BodyS3Path = nil, p
+	}
+	if r.Output != nil && len(r.Output.BodyJSON) > w.LargeDataThreshold {
+		out := *r.Output
+		p, err := w.writeLargeData(r, "output", out.BodyJSON)
+		if err != nil {
+			return err
+		}
+		out.BodyJSON, out.BodyS3Path = nil, p
+		r.Output = &out
+	}
+	msg, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	w.sink.Events[cw.LogGroup] = append(w.sink.Events[cw.LogGroup], Event{
+		ID:        fmt.Sprint(len(w.sink.Events[cw.LogGroup])),
+		Timestamp: r.Timestamp.UnixMilli(),
+		Message:   string(msg),
+	})
+
+	return nil
+}
+
+// writeLargeData stores body in the large-data bucket and returns its path,
+// or "" when no large-data location is configured and the body is dropped.
+func (w *Writer) writeLargeData(r Record, side string, body []byte) (string, error) {
+	ld := w.cfg.CloudWatch.LargeData
+	if ld == nil {
+		return "", nil
+	}
+	o := Object{
+		Bucket: bucketName(ld.Bucket),
+		Key:    hourKey(*ld, r) + "data/" + r.RequestID + "_" + side + ".json",
+		Body:   body,
+	}
+	w.sink.Objects = append(w.sink.Objects, o)
+
+	return o.Path(), nil
+}
+
+// hourKey is the key prefix of the hour r was logged in.
+func hourKey(l Location, r Record) string {
+	return l.KeyPrefix(r.AccountID, r.Region) + r.Timestamp.UTC().Format("2006/01/02/15") + "/"
+}
+
+func bucketName(b string) string {
+	if b == "" {
+		return unknownBucket
+	}
+
+	return b
+}
+
+// DetectModality classifies a record by its model and bodies: embedding
+// and image models, video content or outputs, and text for everything
+// else.
+func DetectModality(r Record) Modality {
+	model := strings.ToLower(r.ModelID)
+	var bodies []string
+	for _, b := range r.Bodies() {
+		if strings.HasPrefix(b.ContentType, "video/") {
+			return Video
+		}
+		if strings.HasPrefix(b.ContentType, "image/") {
+			return Image
+		}
+		bodies = append(bodies, string(b.JSON))
+	}
+	all := strings.Join(bodies, " ")
+	switch {
+	case strings.Contains(model, "embed") || strings.Contains(all, `"embedding"`) || strings.Contains(all, `"embeddings"`):
+		return Embedding
+	case strings.Contains(model, "reel") || strings.Contains(all, `"video"`):
+		return Video
+	case strings.Contains(model, "image") || strings.Contains(model, "canvas") || strings.Contains(model, "stable-diffusion") ||
+		strings.Contains(all, `"images"`) || strings.Contains(all, `"image"`):
+		return Image
+	}
+
+	return Text
+}
+
+// syntheticModels are the model IDs Synthetic uses per modality.
+var syntheticModels = map[Modality]string{
+	Text:      "anthropic.claude-3-haiku-20240307-v1:0",
+	Image:     "amazon.titan-image-generator-v2:0",
+	Embedding: "amazon.titan-embed-text-v2:0",
+	Video:     "amazon.nova-reel-v1:0",
+}
+
+// Synthetic returns a plausible record of modality m for account and
+// region, logged at at. seq makes the request ID unique.
+func Synthetic(m Modality, account, region string, at time.Time, seq int) Record {
+	r := Record{
+		SchemaType:    SchemaType,
+		SchemaVersion: SchemaVersions[len(SchemaVersions)-1],
+		Timestamp:     at.UTC().Truncate(time.Second),
+		AccountID:     account,
+		Identity:      &Identity{ARN: "arn:aws:sts::" + account + ":assumed-role/test/session"},
+		Region:        region,
+		RequestID:     fmt.Sprintf("00000000-0000-4000-8000-%012d", seq),
+		Operation:     "InvokeModel",
+		ModelID:       syntheticModels[m],
+	}
+	in := func(body string, tokens int) Input {
+		return Input{ContentType: "application/json", BodyJSON: json.RawMessage(body), TokenCount: tokens}
+	}
+	out := func(body string, tokens int) *Output {
+		return &Output{ContentType: "application/json", BodyJSON: json.RawMessage(body), TokenCount: tokens}
+	}
+	switch m {
+	case Text:
+		r.Operation = "Converse"
+		r.Input = in(`{"messages":[{"role":"user","content":[{"text":"Summarise the release notes."}]}]}`, 12)
+		r.Output = out(`{"output":{"message":{"role":"assistant","content":[{"text":"The release adds logging."}]}},"stopReason":"end_turn"}`, 8)
+	case Image:
+		r.Input = in(`{"taskType":"TEXT_IMAGE","textToImageParams":{"text":"a lighthouse at dusk"}}`, 0)
+		r.Output = out(`{"images":["iVBORw0KGgo="]}`, 0)
+	case Embedding:
+		r.Input = in(`{"inputText":"invocation logging"}`, 3)
+		r.Output = out(`{"embedding":[0.12,-0.03,0.44],"inputTextTokenCount":3}`, 0)
+	case Video:
+		r.Operation = "StartAsyncInvoke"
+		r.Input = in(`{"taskType":"TEXT_VIDEO","textToVideoParams":{"text":"waves on a beach"},"videoGenerationConfig":{"durationSeconds":6}}`, 0)
+		r.Output = out(`{"invocationArn":"arn:aws:bedrock:`+region+`:`+account+`:async-invoke/abc","video":{"s3Uri":"s3://videos/output.mp4"}}`, 0)
+	}
+
+	return r
+}
@@ -0,0 +1,262 @@
+package ipamsim
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+// Rule identifiers reported by CheckPlan.
+const (
+	RuleExhausted  = "ipam-pool-exhausted"
+	RuleFragmented = "ipam-pool-fragmented"
+	RuleNetmask    = "ipam-allocation-netmask"
+	RuleLocale     = "ipam-locale"
+	RuleOverlap    = "ipam-cidr-overlap"
+	RuleSubPool    = "ipam-sub-pool"
+	RuleHeadroom   = "ipam-pool-headroom"
+)
+
+// Resource types read from a plan.
+const (
+	PoolType     = "aws_vpc_ipam_pool"
+	PoolCIDRType = "aws_vpc_ipam_pool_cidr"
+	VPCType      = "aws_vpc"
+)
+
+var rules = map[string]string{
+	Exhausted:  RuleExhausted,
+	Fragmented: RuleFragmented,
+	Netmask:    RuleNetmask,
+	Locale:     RuleLocale,
+	Overlap:    RuleOverlap,
+}
+
+// Layout is the IPAM pools of a plan and the VPCs that allocate from
+// them.
+type Layout struct {
+	// Pools are the top-level pools; sub-pools hang off them. Pools are
+	// named by address.
+	Pools []*Pool
+	// Requests are the VPCs that allocate from a pool in the plan, in
+	// address order, since the plan does not fix the order of apply.
+	Requests []Request
+	// Findings are the problems building the pools: sub-pools whose locale
+	// differs from their parent's and pool CIDRs that do not fit.
+	Findings finding.List
+}
+
+// FromPlan builds the pools in p, provisions their CIDRs, top-level pools
+// first, and lists the VPCs whose ipv4_ipam_pool_id refers to one of
+// them. Pools whose source pool is not in the plan, and VPCs of such
+// pools, are left out, as are CIDRs known only after apply.
+func FromPlan(p *tfjson.Plan) *Layout {
+	l := &Layout{}
+	add := func(s finding.Severity, rule, address, path, format string, args ...interface{}) {
+		l.Findings = append(l.Findings, finding.Finding{Severity: s, Rule: rule, Address: address, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	resources := plan.ResourcesOfType(p, PoolType)
+	byAddress := map[string]*Pool{}
+	parents := map[string]string{}
+	for _, r := range resources {
+		for _, other := range resources {
+			if other.Address != r.Address && refersTo(plan.References(p, r, "source_ipam_pool_id"), other) {
+				parents[r.Address] = other.Address
+			}
+		}
+	}
+	var build func(r plan.Resource) *Pool
+	build = func(r plan.Resource) *Pool {
+		if pool, ok := byAddress[r.Address]; ok {
+			return pool
+		}
+		var pool *Pool
+		locale := r.String("locale")
+		if locale == "None" {
+			locale = ""
+		}
+		switch parent, ok := parents[r.Address]; {
+		case ok:
+			for _, pr := range resources {
+				if pr.Address != parent {
+					continue
+				}
+				pp := build(pr)
+				if pp == nil {
+					break
+				}
+				sub, err := pp.SubPool(r.Address, locale)
+				if err != nil {
+					add(finding.High, RuleLocale, r.Address, "locale", "%v", err)
+					break
+				}
+				pool = sub
+			}
+		case r.String("source_ipam_pool_id") != "" || r.IsUnknown("source_ipam_pool_id"):
+			// The source pool is outside the plan.
+		default:
+			pool = &Pool{Name: r.Address, Locale: locale}
+			l.Pools = append(l.Pools, pool)
+		}
+		byAddress[r.Address] = pool
+		if pool != nil {
+			pool.MinNetmaskLength = int(r.Number("allocation_min_netmask_length"))
+			pool.MaxNetmaskLength = int(r.Number("allocation_max_netmask_length"))
+			pool.DefaultNetmaskLength = int(r.Number("allocation_default_netmask_length"))
+		}
+		return pool
+	}
+	for _, r := range resources {
+		build(r)
+	}
+
+	// Provision top-level pools before the sub-pools that take from them.
+	cidrs := plan.ResourcesOfType(p, PoolCIDRType)
+	type provision struct {
+		r    plan.Resource
+		pool *Pool
+	}
+	var order []provision
+	for _, c := range cidrs {
+		for _, r := range resources {
+			if pool := byAddress[r.Address]; pool != nil && refersTo(plan.References(p, c, "ipam_pool_id"), r) {
+				order = append(order, provision{c, pool})
+			}
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool { return depth(order[i].pool) < depth(order[j].pool) })
+	for _, pr := range order {
+		switch cidr, n := pr.r.String("cidr"), int(pr.r.Number("netmask_length")); {
+		case cidr != "":
+			if err := pr.pool.Provision(cidr); err != nil {
+				reportError(add, RuleOverlap, pr.r.Address, "cidr", err)
+			}
+		case n != 0 && pr.pool.parent != nil:
+			if _, err := pr.pool.ProvisionNetmask(n); err != nil {
+				reportError(add, RuleSubPool, pr.r.Address, "netmask_length", err)
+			}
+		}
+	}
+
+	for _, v := range plan.ResourcesOfType(p, VPCType) {
+		refs := plan.References(p, v, "ipv4_ipam_pool_id")
+		for _, r := range resources {
+			pool := byAddress[r.Address]
+			if pool == nil || !refersTo(refs, r) {
+				continue
+			}
+			if v.IsUnknown("ipv4_netmask_length") {
+				break
+			}
+			req := Request{Name: v.Address, Pool: pool.Name, NetmaskLength: int(v.Number("ipv4_netmask_length"))}
+			if req.NetmaskLength == 0 {
+				// A cidr_block given with ipv4_ipam_pool_id is allocated as is.
+				req.CIDR = v.String("cidr_block")
+			}
+			l.Requests = append(l.Requests, req)
+			break
+		}
+	}
+
+	return l
+}
+
+// reportError adds err as a finding, under the rule of its reason when it
+// is an AllocationError.
+func reportError(add func(finding.Severity, string, string, string, string, ...interface{}), rule, address, path string, err error) {
+	var e *AllocationError
+	if errors.As(err, &e) {
+		rule = rules[e.Reason]
+	}
+	add(finding.High, rule, address, path, "%v", err)
+}
+
+func depth(p *Pool) int {
+	n := 0
+	for p.parent != nil {
+		p, n = p.parent, n+1
+	}
+
+	return n
+}
+
+func refersTo(refs []string, r plan.Resource) bool {
+	base := r.Address
+	if i := strings.LastIndex(base, "["); i > strings.LastIndex(base, ".") {
+		base = base[:i]
+	}
+	for _, ref := range refs {
+		if ref == r.Address || ref == base {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckPlan replays the VPCs of p against the pools of p and reports the
+// allocations that would fail, sub-pools that cannot allocate their
+// default netmask length, and pools the plan leaves without room for
+// another VPC of the largest size it allocated.
+func CheckPlan(p *tfjson.Plan) finding.List {
+	l := FromPlan(p)
+	findings := append(finding.List(nil), l.Findings...)
+	add := func(s finding.Severity, rule, address, path, format string, args ...interface{}) {
+		findings = append(findings, finding.Finding{Severity: s, Rule: rule, Address: address, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// largest is the netmask length of the largest block each pool
+	// allocated to a VPC.
+	largest := map[*Pool]int{}
+	for _, pool := range l.Pools {
+		var walk func(p *Pool)
+		walk = func(p *Pool) {
+			switch {
+			case len(p.cidrs) == 0 && p.parent != nil:
+				add(finding.Medium, RuleSubPool, p.Name, "", "the sub-pool has no CIDR provisioned, so nothing can allocate from it")
+			case len(p.cidrs) > 0 && p.DefaultNetmaskLength != 0 && p.largest(p.cidrs) > p.DefaultNetmaskLength:
+				add(finding.Medium, RuleSubPool, p.Name, "allocation_default_netmask_length", "the pool's largest CIDR is a /%d, so it can never allocate the /%d of its allocation_default_netmask_length", p.largest(p.cidrs), p.DefaultNetmaskLength)
+			}
+			for _, c := range p.children {
+				walk(c)
+			}
+		}
+		walk(pool)
+
+		var requests []Request
+		for _, req := range l.Requests {
+			if target := pool.Find(req.Pool); target != nil {
+				requests = append(requests, req)
+			}
+		}
+		for _, s := range Simulate(pool, requests).Steps {
+			path := "ipv4_netmask_length"
+			if s.Request.CIDR != "" {
+				path = "cidr_block"
+			}
+			if s.Err != nil {
+				reportError(add, RuleExhausted, s.Request.Name, path, s.Err)
+				continue
+			}
+			target := pool.Find(s.Pool)
+			if bits, ok := largest[target]; !ok || s.CIDR.Bits() < bits {
+				largest[target] = s.CIDR.Bits()
+			}
+		}
+	}
+	for pool, bits := range largest {
+		if pool.Capacity(bits) == 0 {
+			add(finding.Low, RuleHeadroom, pool.Name, "", "after this plan the pool has no room for another /%d, the largest allocation it makes; %.0f%% of it is allocated", bits, 100*pool.Utilization())
+		}
+	}
+	findings.Sort()
+
+	return findings
+}
@@ -0,0 +1,301 @@
+package ipamsim
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan/plantest"
+)
+
+const (
+	rootPool     = "module.ipam.aws_vpc_ipam_pool.this"
+	rootPoolCIDR = "module.ipam.aws_vpc_ipam_pool_cidr.this"
+	// workloads is a regional sub-pool of the aws-ipam pool.
+	workloads     = "aws_vpc_ipam_pool.workloads"
+	workloadsCIDR = "aws_vpc_ipam_pool_cidr.workloads"
+	sharedVPC     = "module.shared.aws_vpc.this"
+	appVPC        = "module.app[1].aws_vpc.this"
+)
+
+func newPool(t *testing.T, cidrs ...string) *Pool {
+	t.Helper()
+	p, err := NewPool("root", "us-west-2", cidrs...)
+	require.NoError(t, err)
+
+	return p
+}
+
+func TestCapacity(t *testing.T) {
+	p := newPool(t, "10.0.0.0/8")
+	assert.Equal(t, 256, p.Capacity(16))
+	assert.Equal(t, 4096, p.Capacity(20))
+	assert.Equal(t, 0, p.Capacity(7))
+
+	for i := 0; i < 256; i++ {
+		_, err := p.Allocate("vpc", 16, "us-west-2")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 0, p.Capacity(16))
+	assert.Equal(t, 1.0, p.Utilization())
+
+	_, err := p.Allocate("one-too-many", 16, "us-west-2")
+	assert.True(t, IsAllocationError(err, Exhausted))
+	assert.EqualError(t, err, "pool root cannot allocate /16 for one-too-many: the pool is full")
+}
+
+func TestAllocate(t *testing.T) {
+	p := newPool(t, "10.0.0.0/14")
+	for _, want := range []string{"10.0.0.0/16", "10.1.0.0/16", "10.2.0.0/20", "10.3.0.0/16"} {
+		bits := netip.MustParsePrefix(want).Bits()
+		got, err := p.Allocate(want, bits, "")
+		require.NoError(t, err)
+		assert.Equal(t, want, got.String())
+	}
+	assert.Equal(t, []string{"10.2.16.0/20", "10.2.32.0/19", "10.2.64.0/18", "10.2.128.0/17"}, prefixes(p.Free()))
+}
+
+func TestFragmentation(t *testing.T) {
+	p := newPool(t, "10.0.0.0/14")
+	for _, name := range []string{"a", "b", "c", "d"} {
+		_, err := p.Allocate(name, 16, "")
+		require.NoError(t, err)
+	}
+	require.True(t, p.Release("a"))
+	require.True(t, p.Release("c"))
+	assert.False(t, p.Release("c"))
+	assert.InDelta(t, 0.5, p.Fragmentation(), 1e-9)
+
+	// Two /16s are free, but not next to each other.
+	_, err := p.Allocate("wide", 15, "")
+	assert.True(t, IsAllocationError(err, Fragmented))
+	assert.EqualError(t, err, "pool root cannot allocate /15 for wide: the pool is fragmented, 131072 addresses are free but the largest free block is a /16")
+
+	_, err = p.Allocate("wider", 14, "")
+	assert.True(t, IsAllocationError(err, Exhausted))
+	assert.EqualError(t, err, "pool root cannot allocate /14 for wider: the pool is exhausted, 131072 addresses are left")
+}
+
+func TestAllocationRules(t *testing.T) {
+	p := newPool(t, "10.0.0.0/8")
+	p.MinNetmaskLength, p.MaxNetmaskLength = 16, 24
+
+	_, err := p.Allocate("big", 12, "us-west-2")
+	assert.True(t, IsAllocationError(err, Netmask))
+	assert.EqualError(t, err, "pool root cannot allocate /12 for big: the pool's allocation_min_netmask_length is 16")
+
+	_, err = p.Allocate("default", 0, "us-west-2")
+	assert.True(t, IsAllocationError(err, Netmask))
+
+	p.DefaultNetmaskLength = 20
+	got, err := p.Allocate("default", 0, "us-west-2")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/20", got.String())
+
+	_, err = p.Allocate("elsewhere", 20, "eu-west-1")
+	assert.True(t, IsAllocationError(err, Locale))
+	assert.EqualError(t, err, "pool root cannot allocate /20 for elsewhere: the pool's locale is us-west-2, so only resources in us-west-2 can allocate from it, not resources in eu-west-1")
+}
+
+func TestReserve(t *testing.T) {
+	p := newPool(t, "10.0.0.0/16")
+	_, err := p.Reserve("a", "10.0.1.0/24", "")
+	require.NoError(t, err)
+
+	_, err = p.Reserve("b", "10.0.0.0/23", "")
+	assert.True(t, IsAllocationError(err, Overlap))
+	assert.EqualError(t, err, "pool root cannot allocate /23 for b: 10.0.0.0/23 overlaps 10.0.1.0/24, allocated to a")
+
+	_, err = p.Reserve("c", "10.1.0.0/24", "")
+	assert.EqualError(t, err, "pool root cannot allocate /24 for c: 10.1.0.0/24 is outside the pool's CIDRs 10.0.0.0/16")
+
+	got, err := p.Allocate("d", 24, "")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/24", got.String())
+}
+
+func TestSubPool(t *testing.T) {
+	p := newPool(t, "10.0.0.0/8")
+	_, err := p.SubPool("eu", "eu-west-1")
+	assert.EqualError(t, err, `pool root: sub-pool eu has locale "eu-west-1", but sub-pools of a pool with a locale must have the same locale "us-west-2"`)
+
+	sub, err := p.SubPool("workloads", "us-west-2")
+	require.NoError(t, err)
+	got, err := sub.ProvisionNetmask(12)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/12", got.String())
+	assert.Same(t, sub, p.Find("workloads"))
+	assert.Same(t, p, sub.Parent())
+
+	// The sub-pool's CIDR is no longer free in its parent.
+	assert.Equal(t, 240, p.Capacity(16))
+	assert.Equal(t, 16, sub.Capacity(16))
+
+	assert.Error(t, sub.Provision("10.0.0.0/16"))
+	require.NoError(t, sub.Provision("10.16.0.0/16"))
+	assert.Equal(t, 17, sub.Capacity(16))
+}
+
+func TestSimulate(t *testing.T) {
+	p := newPool(t, "10.0.0.0/15")
+	west, err := p.SubPool("west", "us-west-2")
+	require.NoError(t, err)
+	require.NoError(t, west.Provision("10.1.0.0/16"))
+
+	result := Simulate(p, []Request{
+		{Name: "a", Region: "us-west-2", NetmaskLength: 17},
+		{Name: "b", Region: "us-west-2", NetmaskLength: 17},
+		{Name: "c", Region: "us-west-2", NetmaskLength: 17},
+		{Name: "a", Release: true},
+		{Name: "c", Region: "us-west-2", NetmaskLength: 17},
+		{Name: "d", Pool: "root", NetmaskLength: 16},
+		{Name: "e", Pool: "east", NetmaskLength: 16},
+		{Name: "x", Release: true},
+	})
+	assert.Equal(t, 4, result.Allocated())
+	assert.Len(t, result.Failures(), 3)
+	assert.Equal(t, `REQUEST  POOL  CIDR           RESULT
+a        west  10.1.0.0/17    ok
+b        west  10.1.128.0/17  ok
+c        west  -              pool west cannot allocate /17 for c: the pool is full
+a        west  -              released
+c        west  10.1.0.0/17    ok
+d        root  10.0.0.0/16    ok
+e              -              no pool east
+x              -              x holds no allocation to release
+`, result.Table())
+}
+
+func TestFromPlan(t *testing.T) {
+	l := FromPlan(plantest.Load(t, "testdata/plan.json").Plan(t))
+	require.Empty(t, l.Findings)
+	require.Len(t, l.Pools, 1)
+	root := l.Pools[0]
+	assert.Equal(t, rootPool, root.Name)
+	assert.Equal(t, "us-west-2", root.Locale)
+	assert.Equal(t, []string{"10.0.0.0/8"}, prefixes(root.CIDRs()))
+
+	sub := root.Find(workloads)
+	require.NotNil(t, sub)
+	assert.Equal(t, []string{"10.0.0.0/12"}, prefixes(sub.CIDRs()))
+	assert.Equal(t, 20, sub.DefaultNetmaskLength)
+	assert.Equal(t, 16, sub.MinNetmaskLength)
+	assert.Equal(t, 24, sub.MaxNetmaskLength)
+
+	assert.Equal(t, []Request{
+		{Name: "module.app[0].aws_vpc.this", Pool: workloads, NetmaskLength: 20},
+		{Name: appVPC, Pool: workloads, NetmaskLength: 20},
+		{Name: sharedVPC, Pool: rootPool, NetmaskLength: 16},
+	}, l.Requests)
+
+	result := Simulate(root, l.Requests)
+	assert.Empty(t, result.Failures())
+	assert.Equal(t, []string{"10.0.0.0/20", "10.0.16.0/20", "10.16.0.0/16"}, stepCIDRs(result))
+}
+
+func TestCheckPlan(t *testing.T) {
+	tests := []struct {
+		name   string
+		breaks func(t *testing.T, f plantest.Fixture)
+		want   []plantest.Expected
+	}{
+		{
+			name:   "clean",
+			breaks: func(t *testing.T, f plantest.Fixture) {},
+		},
+		{
+			name: "vpc larger than the pool has left",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, sharedVPC)["ipv4_netmask_length"] = 8
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleExhausted, sharedVPC).At("ipv4_netmask_length")},
+		},
+		{
+			name: "vpc outside the sub-pool allocation rules",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, appVPC)["ipv4_netmask_length"] = 26
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleNetmask, appVPC).At("ipv4_netmask_length")},
+		},
+		{
+			name: "sub-pool in another region",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, workloads)["locale"] = "eu-west-1"
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleLocale, workloads).At("locale")},
+		},
+		{
+			name: "sub-pool cidr outside its parent",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				values := f.Values(t, workloadsCIDR)
+				values["cidr"], values["netmask_length"] = "192.168.0.0/16", nil
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.High, RuleOverlap, workloadsCIDR).At("cidr"),
+				plantest.Want(finding.Medium, RuleSubPool, workloads).At(""),
+				plantest.Want(finding.High, RuleExhausted, "module.app[0].aws_vpc.this").At("ipv4_netmask_length"),
+				plantest.Want(finding.High, RuleExhausted, appVPC).At("ipv4_netmask_length"),
+			},
+		},
+		{
+			name: "sub-pool smaller than its default allocation",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, workloadsCIDR)["netmask_length"] = 22
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.Medium, RuleSubPool, workloads).At("allocation_default_netmask_length"),
+				plantest.Want(finding.High, RuleExhausted, "module.app[0].aws_vpc.this").At("ipv4_netmask_length"),
+				plantest.Want(finding.High, RuleExhausted, appVPC).At("ipv4_netmask_length"),
+			},
+		},
+		{
+			name: "sub-pool filled by the plan",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, workloadsCIDR)["netmask_length"] = 19
+			},
+			want: []plantest.Expected{plantest.Want(finding.Low, RuleHeadroom, workloads).At("")},
+		},
+		{
+			name: "root cidr known only after apply",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				delete(f.Values(t, rootPoolCIDR), "cidr")
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.High, RuleExhausted, workloadsCIDR).At("netmask_length"),
+				plantest.Want(finding.Medium, RuleSubPool, workloads).At(""),
+				plantest.Want(finding.High, RuleExhausted, "module.app[0].aws_vpc.this").At("ipv4_netmask_length"),
+				plantest.Want(finding.High, RuleExhausted, appVPC).At("ipv4_netmask_length"),
+				plantest.Want(finding.High, RuleExhausted, sharedVPC).At("ipv4_netmask_length"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := plantest.Load(t, "testdata/plan.json")
+			tt.breaks(t, f)
+
+			plantest.AssertFindings(t, tt.want, CheckPlan(f.Plan(t)))
+		})
+	}
+}
+
+func prefixes(ps []netip.Prefix) []string {
+	var out []string
+	for _, p := range ps {
+		out = append(out, p.String())
+	}
+
+	return out
+}
+
+func stepCIDRs(r *Result) []string {
+	var out []string
+	for _, s := range r.Steps {
+		out = append(out, s.CIDR.String())
+	}
+
+	return out
+}
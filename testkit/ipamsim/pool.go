@@ -0,0 +1,424 @@
+// Package ipamsim models how an IPAM pool, such as the one aws-ipam
+// creates from root_cidr, hands out CIDRs to the VPCs aws-vpc creates with
+// ipam_pool_id and vpc_netmask_length. A Pool allocates the lowest free
+// block of the requested size, enforces the pool's locale and allocation
+// netmask rules, and tells exhaustion from fragmentation when a request
+// fails, which AWS reports only as a failed CreateVpc. Sub-pools take
+// their CIDRs from their parent, so regional pool sizing can be replayed
+// too.
+//
+// Simulate replays a sequence of requests; CheckPlan replays the pools
+// and VPCs of a plan.
+package ipamsim
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// Reasons an allocation fails.
+const (
+	// Exhausted means the pool has fewer free addresses than requested.
+	Exhausted = "exhausted"
+	// Fragmented means the pool has the addresses, but no aligned free
+	// block of the requested size.
+	Fragmented = "fragmented"
+	// Netmask means the netmask length is outside the pool's allocation
+	// rules, or missing with no default.
+	Netmask = "netmask"
+	// Locale means the request comes from a region other than the pool's
+	// locale.
+	Locale = "locale"
+	// Overlap means a requested CIDR is outside the pool or overlaps an
+	// allocation.
+	Overlap = "overlap"
+)
+
+// AllocationError is why a pool could not allocate.
+type AllocationError struct {
+	Pool   string
+	Name   string
+	Reason string
+	// NetmaskLength is the size requested.
+	NetmaskLength int
+	// Free is the number of free addresses in the pool and Largest the
+	// netmask length of its largest free block, 0 when nothing is free.
+	Free    uint64
+	Largest int
+	Detail  string
+}
+
+func (e *AllocationError) Error() string {
+	prefix := fmt.Sprintf("pool %s cannot allocate /%d for %s", e.Pool, e.NetmaskLength, e.Name)
+	switch e.Reason {
+	case Exhausted:
+		if e.Free == 0 {
+			return prefix + ": the pool is full"
+		}
+		return fmt.Sprintf("%s: the pool is exhausted, %d addresses are left", prefix, e.Free)
+	case Fragmented:
+		return fmt.Sprintf("%s: the pool is fragmented, %d addresses are free but the largest free block is a /%d", prefix, e.Free, e.Largest)
+	}
+
+	return prefix + ": " + e.Detail
+}
+
+// Allocation is a CIDR a pool handed out, to a VPC or to a sub-pool.
+type Allocation struct {
+	Name string
+	CIDR netip.Prefix
+}
+
+// Pool is an IPAM pool.
+type Pool struct {
+	Name string
+	// Locale is the region whose resources may allocate from the pool,
+	// empty for any.
+	Locale string
+	// MinNetmaskLength, MaxNetmaskLength and DefaultNetmaskLength are the
+	// pool's allocation rules, 0 when not set.
+	MinNetmaskLength     int
+	MaxNetmaskLength     int
+	DefaultNetmaskLength int
+
+	parent      *Pool
+	children    []*Pool
+	cidrs       []netip.Prefix
+	allocations []Allocation
+}
+
+// NewPool returns a top-level pool with the CIDRs cidrs.
+func NewPool(name, locale string, cidrs ...string) (*Pool, error) {
+	p := &Pool{Name: name, Locale: locale}
+	for _, c := range cidrs {
+		if err := p.Provision(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// SubPool returns a new pool whose CIDRs come from p. A sub-pool of a
+// pool with a locale must have the same locale.
+func (p *Pool) SubPool(name, locale string) (*Pool, error) {
+	if p.Locale != "" && locale != p.Locale {
+		return nil, fmt.Errorf("pool %s: sub-pool %s has locale %q, but sub-pools of a pool with a locale must have the same locale %q", p.Name, name, locale, p.Locale)
+	}
+	child := &Pool{Name: name, Locale: locale, parent: p}
+	p.children = append(p.children, child)
+
+	return child, nil
+}
+
+// Parent returns the pool p takes its CIDRs from, or nil for a top-level
+// pool.
+func (p *Pool) Parent() *Pool { return p.parent }
+
+// Children returns the sub-pools of p.
+func (p *Pool) Children() []*Pool { return p.children }
+
+// Find returns the pool named name in the tree under p.
+func (p *Pool) Find(name string) *Pool {
+	if p.Name == name {
+		return p
+	}
+	for _, c := range p.children {
+		if found := c.Find(name); found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+// Provision adds cidr to p. A sub-pool takes it from its parent.
+func (p *Pool) Provision(cidr string) error {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return fmt.Errorf("pool %s: %w", p.Name, err)
+	}
+	if prefix != prefix.Masked() {
+		return fmt.Errorf("pool %s: %s is not a network address; use %s", p.Name, cidr, prefix.Masked())
+	}
+	if p.parent != nil {
+		if _, err := p.parent.Reserve(p.Name, cidr, p.Locale); err != nil {
+			return err
+		}
+	} else {
+		for _, c := range p.cidrs {
+			if c.Overlaps(prefix) {
+				return fmt.Errorf("pool %s: %s overlaps %s, which the pool already has", p.Name, prefix, c)
+			}
+		}
+	}
+	p.cidrs = append(p.cidrs, prefix)
+
+	return nil
+}
+
+// ProvisionNetmask gives the sub-pool p a CIDR of netmaskLength from its
+// parent, as an aws_vpc_ipam_pool_cidr with netmask_length does.
+func (p *Pool) ProvisionNetmask(netmaskLength int) (netip.Prefix, error) {
+	if p.parent == nil {
+		return netip.Prefix{}, fmt.Errorf("pool %s: only a sub-pool can be provisioned by netmask length", p.Name)
+	}
+	prefix, err := p.parent.Allocate(p.Name, netmaskLength, p.Locale)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	p.cidrs = append(p.cidrs, prefix)
+
+	return prefix, nil
+}
+
+// CIDRs returns the CIDRs provisioned to p.
+func (p *Pool) CIDRs() []netip.Prefix { return p.cidrs }
+
+// Allocations returns what p handed out, in allocation order.
+func (p *Pool) Allocations() []Allocation { return p.allocations }
+
+// Allocate hands name the lowest free block of netmaskLength, or of the
+// pool's default netmask length when netmaskLength is 0. region is where
+// the request comes from, empty when not known.
+func (p *Pool) Allocate(name string, netmaskLength int, region string) (netip.Prefix, error) {
+	if netmaskLength == 0 {
+		netmaskLength = p.DefaultNetmaskLength
+	}
+	fail := func(reason, format string, args ...interface{}) (netip.Prefix, error) {
+		return netip.Prefix{}, &AllocationError{Pool: p.Name, Name: name, Reason: reason, NetmaskLength: netmaskLength, Detail: fmt.Sprintf(format, args...)}
+	}
+	if err := p.admit(netmaskLength, region, fail); err != nil {
+		return netip.Prefix{}, err
+	}
+
+	for _, b := range p.Free() {
+		if b.Bits() <= netmaskLength {
+			prefix := netip.PrefixFrom(b.Addr(), netmaskLength)
+			p.allocations = append(p.allocations, Allocation{Name: name, CIDR: prefix})
+			return prefix, nil
+		}
+	}
+	e := &AllocationError{Pool: p.Name, Name: name, Reason: Exhausted, NetmaskLength: netmaskLength, Free: p.FreeAddresses()}
+	if free := p.Free(); len(free) > 0 {
+		e.Largest = p.largest(free)
+		if e.Free >= size(p.bits(), netmaskLength) {
+			e.Reason = Fragmented
+		}
+	}
+
+	return netip.Prefix{}, e
+}
+
+// Reserve hands name the CIDR cidr, as a VPC with an explicit cidr_block
+// and ipv4_ipam_pool_id, or a sub-pool CIDR, asks for.
+func (p *Pool) Reserve(name, cidr, region string) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("pool %s: %w", p.Name, err)
+	}
+	fail := func(reason, format string, args ...interface{}) (netip.Prefix, error) {
+		return netip.Prefix{}, &AllocationError{Pool: p.Name, Name: name, Reason: reason, NetmaskLength: prefix.Bits(), Detail: fmt.Sprintf(format, args...)}
+	}
+	if err := p.admit(prefix.Bits(), region, fail); err != nil {
+		return netip.Prefix{}, err
+	}
+	if prefix != prefix.Masked() {
+		return fail(Overlap, "%s is not a network address", cidr)
+	}
+	within := false
+	for _, c := range p.cidrs {
+		within = within || c.Contains(prefix.Addr()) && c.Bits() <= prefix.Bits()
+	}
+	if !within {
+		return fail(Overlap, "%s is outside the pool's CIDRs %s", prefix, joinPrefixes(p.cidrs))
+	}
+	for _, a := range p.allocations {
+		if a.CIDR.Overlaps(prefix) {
+			return fail(Overlap, "%s overlaps %s, allocated to %s", prefix, a.CIDR, a.Name)
+		}
+	}
+	p.allocations = append(p.allocations, Allocation{Name: name, CIDR: prefix})
+
+	return prefix, nil
+}
+
+// admit checks a request against the locale and allocation rules of p.
+func (p *Pool) admit(netmaskLength int, region string, fail func(reason, format string, args ...interface{}) (netip.Prefix, error)) error {
+	var err error
+	switch {
+	case p.Locale != "" && region != "" && region != p.Locale:
+		_, err = fail(Locale, "the pool's locale is %s, so only resources in %s can allocate from it, not resources in %s", p.Locale, p.Locale, region)
+	case netmaskLength == 0:
+		_, err = fail(Netmask, "no netmask length was given and the pool has no allocation_default_netmask_length")
+	case netmaskLength < 0 || netmaskLength > p.bits():
+		_, err = fail(Netmask, "/%d is not a valid netmask length", netmaskLength)
+	case p.MinNetmaskLength != 0 && netmaskLength < p.MinNetmaskLength:
+		_, err = fail(Netmask, "the pool's allocation_min_netmask_length is %d", p.MinNetmaskLength)
+	case p.MaxNetmaskLength != 0 && netmaskLength > p.MaxNetmaskLength:
+		_, err = fail(Netmask, "the pool's allocation_max_netmask_length is %d", p.MaxNetmaskLength)
+	}
+
+	return err
+}
+
+// Release returns the CIDR allocated to name to the pool, and reports
+// whether there was one.
+func (p *Pool) Release(name string) bool {
+	for i, a := range p.allocations {
+		if a.Name == name {
+			p.allocations = append(p.allocations[:i], p.allocations[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Free returns the free space of p as the largest aligned blocks that
+// cover it, in address order.
+func (p *Pool) Free() []netip.Prefix {
+	var out []netip.Prefix
+	var walk func(b netip.Prefix)
+	walk = func(b netip.Prefix) {
+		for _, a := range p.allocations {
+			if a.CIDR.Bits() <= b.Bits() && a.CIDR.Contains(b.Addr()) {
+				return
+			}
+		}
+		for _, a := range p.allocations {
+			if b.Overlaps(a.CIDR) {
+				lo, hi := split(b)
+				walk(lo)
+				walk(hi)
+				return
+			}
+		}
+		out = append(out, b)
+	}
+	cidrs := append([]netip.Prefix(nil), p.cidrs...)
+	sort.Slice(cidrs, func(i, j int) bool { return cidrs[i].Addr().Less(cidrs[j].Addr()) })
+	for _, c := range cidrs {
+		walk(c)
+	}
+
+	return out
+}
+
+// FreeAddresses returns the number of free addresses in p.
+func (p *Pool) FreeAddresses() uint64 {
+	var n uint64
+	for _, b := range p.Free() {
+		n = add(n, size(p.bits(), b.Bits()))
+	}
+
+	return n
+}
+
+// Capacity returns how many more blocks of netmaskLength p can allocate,
+// ignoring its allocation rules.
+func (p *Pool) Capacity(netmaskLength int) int {
+	n := 0
+	for _, b := range p.Free() {
+		if b.Bits() <= netmaskLength {
+			n += int(min(size(netmaskLength, b.Bits()), math.MaxInt32))
+		}
+	}
+
+	return n
+}
+
+// Fragmentation is the share of the free addresses of p outside its
+// largest free block: 0 when the free space is one block, close to 1
+// when it is scattered in small blocks.
+func (p *Pool) Fragmentation() float64 {
+	free := p.Free()
+	total := p.FreeAddresses()
+	if total == 0 {
+		return 0
+	}
+
+	return 1 - float64(size(p.bits(), p.largest(free)))/float64(total)
+}
+
+// Utilization is the share of the addresses of p that are allocated.
+func (p *Pool) Utilization() float64 {
+	var total uint64
+	for _, c := range p.cidrs {
+		total = add(total, size(p.bits(), c.Bits()))
+	}
+	if total == 0 {
+		return 0
+	}
+
+	return 1 - float64(p.FreeAddresses())/float64(total)
+}
+
+// largest returns the netmask length of the largest block in free.
+func (p *Pool) largest(free []netip.Prefix) int {
+	best := p.bits()
+	for _, b := range free {
+		best = min(best, b.Bits())
+	}
+
+	return best
+}
+
+// bits is the address length of the pool's family.
+func (p *Pool) bits() int {
+	for _, c := range p.cidrs {
+		return c.Addr().BitLen()
+	}
+
+	return 32
+}
+
+// split returns the two halves of b.
+func split(b netip.Prefix) (netip.Prefix, netip.Prefix) {
+	lo := netip.PrefixFrom(b.Addr(), b.Bits()+1)
+	raw := b.Addr().AsSlice()
+	raw[b.Bits()/8] |= 0x80 >> (b.Bits() % 8)
+	addr, _ := netip.AddrFromSlice(raw)
+
+	return lo, netip.PrefixFrom(addr, b.Bits()+1)
+}
+
+// size is the number of addresses in a block of netmaskLength in an
+// address space of bits, saturated at the largest uint64.
+func size(bits, netmaskLength int) uint64 {
+	if bits-netmaskLength >= 64 {
+		return math.MaxUint64
+	}
+
+	return 1 << uint(bits-netmaskLength)
+}
+
+func add(a, b uint64) uint64 {
+	if a > math.MaxUint64-b {
+		return math.MaxUint64
+	}
+
+	return a + b
+}
+
+func joinPrefixes(ps []netip.Prefix) string {
+	if len(ps) == 0 {
+		return "(none)"
+	}
+	parts := make([]string, len(ps))
+	for i, p := range ps {
+		parts[i] = p.String()
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// IsAllocationError reports whether err is an AllocationError for reason.
+func IsAllocationError(err error, reason string) bool {
+	var e *AllocationError
+	return errors.As(err, &e) && e.Reason == reason
+}
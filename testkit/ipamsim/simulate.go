@@ -0,0 +1,146 @@
+package ipamsim
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"text/tabwriter"
+)
+
+// Request is a step of a simulation: a VPC asking a pool for a CIDR, or
+// giving its CIDR back.
+type Request struct {
+	Name string
+	// Pool names the pool to allocate from. When empty, the request goes
+	// to the first pool in the tree, depth first, with no sub-pools whose
+	// locale is Region, or else to the top-level pool.
+	Pool   string
+	Region string
+	// NetmaskLength is the size to allocate, 0 for the pool's default.
+	NetmaskLength int
+	// CIDR asks for a specific block instead of a size.
+	CIDR string
+	// Release gives back the CIDR allocated to Name.
+	Release bool
+}
+
+// Step is the outcome of a request.
+type Step struct {
+	Request Request
+	Pool    string
+	CIDR    netip.Prefix
+	Err     error
+}
+
+// Result is the outcome of Simulate.
+type Result struct {
+	Steps []Step
+}
+
+// Failures returns the steps whose allocation failed.
+func (r *Result) Failures() []Step {
+	var out []Step
+	for _, s := range r.Steps {
+		if s.Err != nil {
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
+
+// Allocated returns how many requests got a CIDR.
+func (r *Result) Allocated() int {
+	n := 0
+	for _, s := range r.Steps {
+		if s.Err == nil && !s.Request.Release {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Table renders the steps as request, pool, CIDR and error columns.
+func (r *Result) Table() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "REQUEST\tPOOL\tCIDR\tRESULT")
+	for _, s := range r.Steps {
+		cidr, result := "-", "ok"
+		if s.CIDR.IsValid() {
+			cidr = s.CIDR.String()
+		}
+		if s.Request.Release {
+			result = "released"
+		}
+		if s.Err != nil {
+			result = s.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Request.Name, s.Pool, cidr, result)
+	}
+	w.Flush()
+
+	return b.String()
+}
+
+// Simulate replays requests, in order, against the pool tree under root.
+func Simulate(root *Pool, requests []Request) *Result {
+	r := &Result{}
+	allocatedFrom := map[string]*Pool{}
+	for _, req := range requests {
+		step := Step{Request: req}
+		if req.Release {
+			if p := allocatedFrom[req.Name]; p != nil && p.Release(req.Name) {
+				step.Pool = p.Name
+				delete(allocatedFrom, req.Name)
+			} else {
+				step.Err = fmt.Errorf("%s holds no allocation to release", req.Name)
+			}
+			r.Steps = append(r.Steps, step)
+			continue
+		}
+		p := route(root, req)
+		if p == nil {
+			step.Err = fmt.Errorf("no pool %s", req.Pool)
+			r.Steps = append(r.Steps, step)
+			continue
+		}
+		step.Pool = p.Name
+		if req.CIDR != "" {
+			step.CIDR, step.Err = p.Reserve(req.Name, req.CIDR, req.Region)
+		} else {
+			step.CIDR, step.Err = p.Allocate(req.Name, req.NetmaskLength, req.Region)
+		}
+		if step.Err == nil {
+			allocatedFrom[req.Name] = p
+		}
+		r.Steps = append(r.Steps, step)
+	}
+
+	return r
+}
+
+// route returns the pool a request allocates from.
+func route(root *Pool, req Request) *Pool {
+	if req.Pool != "" {
+		return root.Find(req.Pool)
+	}
+	var leaf func(p *Pool) *Pool
+	leaf = func(p *Pool) *Pool {
+		if len(p.children) == 0 && p.Locale != "" && p.Locale == req.Region {
+			return p
+		}
+		for _, c := range p.children {
+			if found := leaf(c); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	if p := leaf(root); p != nil {
+		return p
+	}
+
+	return root
+}
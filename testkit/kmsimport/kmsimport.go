@@ -0,0 +1,133 @@
+// Package kmsimport produces key material for aws_kms_external_key tests
+// and wraps it the way KMS ImportKeyMaterial expects, with
+// RSAES_OAEP_SHA_256 under the wrapping public key returned by
+// GetParametersForImport.
+//
+// Material never prints itself: its String and GoString methods are
+// redacted, so a stray t.Log or %v cannot leak it. Call Base64 explicitly
+// when the value has to be handed to Terraform, and hand it over through a
+// TF_VAR_ environment variable rather than a -var argument.
+package kmsimport
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// WrappingAlgorithm is the only wrapping algorithm this package produces.
+const WrappingAlgorithm = "RSAES_OAEP_SHA_256"
+
+// MaterialSize is the size in bytes of symmetric key material for a
+// SYMMETRIC_DEFAULT key.
+const MaterialSize = 32
+
+// Material is 256 bits of symmetric key material.
+type Material struct {
+	b []byte
+}
+
+// GenerateMaterial reads MaterialSize bytes from r, or from crypto/rand
+// when r is nil.
+func GenerateMaterial(r io.Reader) (Material, error) {
+	if r == nil {
+		r = rand.Reader
+	}
+	b := make([]byte, MaterialSize)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return Material{}, fmt.Errorf("generating key material: %w", err)
+	}
+
+	return Material{b: b}, nil
+}
+
+// Base64 returns the material encoded for the key_material_base64 argument.
+func (m Material) Base64() string {
+	return base64.StdEncoding.EncodeToString(m.b)
+}
+
+// Fingerprint returns a SHA-256 digest of the material, safe to log and to
+// compare against what an importer received.
+func (m Material) Fingerprint() string {
+	return fingerprint(m.b)
+}
+
+func (m Material) String() string {
+	return fmt.Sprintf("[REDACTED %d-bit key material]", len(m.b)*8)
+}
+
+// GoString keeps %#v from printing the material.
+func (m Material) GoString() string {
+	return m.String()
+}
+
+// ParseWrappingKey parses the DER encoded (X.509 SubjectPublicKeyInfo)
+// public key returned by GetParametersForImport.
+func ParseWrappingKey(der []byte) (*rsa.PublicKey, error) {
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing wrapping key: %w", err)
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("wrapping key is %T, not RSA", pub)
+	}
+
+	return rsaPub, nil
+}
+
+// Wrap encrypts the material under the wrapping key with
+// RSAES_OAEP_SHA_256.
+func Wrap(m Material, pub *rsa.PublicKey) ([]byte, error) {
+	if len(m.b) != MaterialSize {
+		return nil, fmt.Errorf("key material is %d bytes, want %d", len(m.b), MaterialSize)
+	}
+
+	return rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, m.b, nil)
+}
+
+// ImportParameters is the result of GetParametersForImport.
+type ImportParameters struct {
+	// PublicKey is the DER encoded wrapping key.
+	PublicKey   []byte
+	ImportToken []byte
+	// ParametersValidTo is when the token and wrapping key expire.
+	ParametersValidTo time.Time
+}
+
+// Importer is the subset of the KMS API needed to import key material. It
+// is satisfied by LocalKMS and by a thin adapter around a real KMS client.
+type Importer interface {
+	GetParametersForImport(keyID, wrappingAlgorithm string) (ImportParameters, error)
+	// ImportKeyMaterial imports wrapped material. A nil validTo means the
+	// material does not expire.
+	ImportKeyMaterial(keyID string, importToken, encryptedMaterial []byte, validTo *time.Time) error
+}
+
+// Import fetches import parameters for keyID, wraps m and imports it.
+func Import(imp Importer, keyID string, m Material, validTo *time.Time) error {
+	params, err := imp.GetParametersForImport(keyID, WrappingAlgorithm)
+	if err != nil {
+		return err
+	}
+	pub, err := ParseWrappingKey(params.PublicKey)
+	if err != nil {
+		return err
+	}
+	wrapped, err := Wrap(m, pub)
+	if err != nil {
+		return err
+	}
+
+	return imp.ImportKeyMaterial(keyID, params.ImportToken, wrapped, validTo)
+}
+
+// ErrInvalidImportToken is returned by LocalKMS for tokens it did not issue
+// or that have expired.
+var ErrInvalidImportToken = errors.New("invalid import token")
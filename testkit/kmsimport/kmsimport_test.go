@@ -0,0 +1,86 @@
+package kmsimport
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaterialIsRedacted(t *testing.T) {
+	m, err := GenerateMaterial(nil)
+	require.NoError(t, err)
+
+	for _, s := range []string{m.String(), fmt.Sprint(m), fmt.Sprintf("%v %+v %#v", m, m, m)} {
+		assert.NotContains(t, s, m.Base64())
+		assert.Contains(t, s, "REDACTED 256-bit")
+	}
+	assert.Len(t, m.Fingerprint(), 64)
+}
+
+func TestWrapUsesOAEPSHA256(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	m, err := GenerateMaterial(bytes.NewReader(bytes.Repeat([]byte{7}, MaterialSize)))
+	require.NoError(t, err)
+
+	wrapped, err := Wrap(m, &private.PublicKey)
+	require.NoError(t, err)
+
+	plain, err := rsa.DecryptOAEP(sha256.New(), nil, private, wrapped, nil)
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte{7}, MaterialSize), plain)
+}
+
+func TestImportIntoLocalKMS(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	kms := NewLocalKMS()
+	kms.Now = func() time.Time { return now }
+
+	m, err := GenerateMaterial(nil)
+	require.NoError(t, err)
+	validTo := now.Add(48 * time.Hour)
+
+	assert.Equal(t, KeyStatePendingImport, kms.KeyState("key-1"))
+	require.NoError(t, Import(kms, "key-1", m, &validTo))
+	assert.Equal(t, KeyStateEnabled, kms.KeyState("key-1"))
+	assert.True(t, kms.Holds("key-1", m))
+
+	// Re-importing the same material is allowed, different material is not
+	require.NoError(t, Import(kms, "key-1", m, &validTo))
+	other, err := GenerateMaterial(nil)
+	require.NoError(t, err)
+	assert.Error(t, Import(kms, "key-1", other, &validTo))
+
+	// Material is deleted once valid_to passes
+	now = validTo
+	assert.Equal(t, KeyStatePendingImport, kms.KeyState("key-1"))
+	assert.False(t, kms.Holds("key-1", m))
+}
+
+func TestLocalKMSRejectsBadImports(t *testing.T) {
+	kms := NewLocalKMS()
+	m, err := GenerateMaterial(nil)
+	require.NoError(t, err)
+
+	past := time.Now().Add(-time.Minute)
+	assert.ErrorContains(t, Import(kms, "key-1", m, &past), "not in the future")
+
+	params, err := kms.GetParametersForImport("key-1", WrappingAlgorithm)
+	require.NoError(t, err)
+	pub, err := ParseWrappingKey(params.PublicKey)
+	require.NoError(t, err)
+	wrapped, err := Wrap(m, pub)
+	require.NoError(t, err)
+	assert.ErrorIs(t, kms.ImportKeyMaterial("key-2", params.ImportToken, wrapped, nil), ErrInvalidImportToken)
+
+	_, err = kms.GetParametersForImport("key-1", "RSAES_PKCS1_V1_5")
+	assert.True(t, err != nil && strings.Contains(err.Error(), "unsupported"))
+}
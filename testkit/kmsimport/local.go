@@ -0,0 +1,143 @@
+package kmsimport
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Key states reported by LocalKMS, matching the KMS KeyState values.
+const (
+	KeyStateEnabled       = "Enabled"
+	KeyStatePendingImport = "PendingImport"
+)
+
+// importValidity is how long KMS honours an import token.
+const importValidity = 24 * time.Hour
+
+// LocalKMS is an in-memory stand-in for the import half of KMS. It issues
+// RSA-2048 wrapping keys, unwraps imported material with RSAES_OAEP_SHA_256
+// and applies KMS's expiry rule: once valid_to passes the material is
+// deleted and the key returns to PendingImport.
+type LocalKMS struct {
+	// Now returns the current time. It defaults to time.Now and can be
+	// replaced to exercise expiry.
+	Now func() time.Time
+
+	mu     sync.Mutex
+	tokens map[string]*localToken
+	keys   map[string]*localKey
+}
+
+type localToken struct {
+	keyID   string
+	private *rsa.PrivateKey
+	expires time.Time
+}
+
+type localKey struct {
+	fingerprint string
+	validTo     *time.Time
+}
+
+// NewLocalKMS returns an empty stand-in.
+func NewLocalKMS() *LocalKMS {
+	return &LocalKMS{
+		Now:    time.Now,
+		tokens: map[string]*localToken{},
+		keys:   map[string]*localKey{},
+	}
+}
+
+// GetParametersForImport issues a fresh wrapping key and import token for
+// keyID.
+func (l *LocalKMS) GetParametersForImport(keyID, wrappingAlgorithm string) (ImportParameters, error) {
+	if wrappingAlgorithm != WrappingAlgorithm {
+		return ImportParameters{}, fmt.Errorf("unsupported wrapping algorithm %q", wrappingAlgorithm)
+	}
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return ImportParameters{}, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		return ImportParameters{}, err
+	}
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return ImportParameters{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	expires := l.Now().Add(importValidity)
+	l.tokens[string(token)] = &localToken{keyID: keyID, private: private, expires: expires}
+
+	return ImportParameters{PublicKey: der, ImportToken: token, ParametersValidTo: expires}, nil
+}
+
+// ImportKeyMaterial unwraps and records the material for keyID.
+func (l *LocalKMS) ImportKeyMaterial(keyID string, importToken, encryptedMaterial []byte, validTo *time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.Now()
+	tok, ok := l.tokens[string(importToken)]
+	if !ok || tok.keyID != keyID || now.After(tok.expires) {
+		return ErrInvalidImportToken
+	}
+	if validTo != nil && !validTo.After(now) {
+		return fmt.Errorf("valid_to %s is not in the future", validTo.Format(time.RFC3339))
+	}
+	plain, err := rsa.DecryptOAEP(sha256.New(), nil, tok.private, encryptedMaterial, nil)
+	if err != nil {
+		return fmt.Errorf("unwrapping key material: %w", err)
+	}
+	if len(plain) != MaterialSize {
+		return fmt.Errorf("key material is %d bytes, want %d", len(plain), MaterialSize)
+	}
+	if existing, ok := l.keys[keyID]; ok && existing.fingerprint != fingerprint(plain) {
+		// KMS only accepts the same material when re-importing.
+		return fmt.Errorf("key %s already holds different key material", keyID)
+	}
+
+	delete(l.tokens, string(importToken))
+	l.keys[keyID] = &localKey{fingerprint: fingerprint(plain), validTo: validTo}
+
+	return nil
+}
+
+// KeyState returns Enabled while imported material is present and
+// unexpired, and PendingImport otherwise.
+func (l *LocalKMS) KeyState(keyID string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	k, ok := l.keys[keyID]
+	if !ok || k.validTo != nil && !l.Now().Before(*k.validTo) {
+		return KeyStatePendingImport
+	}
+
+	return KeyStateEnabled
+}
+
+// Holds reports whether keyID currently holds exactly the material m.
+func (l *LocalKMS) Holds(keyID string, m Material) bool {
+	if l.KeyState(keyID) != KeyStateEnabled {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.keys[keyID].fingerprint == m.Fingerprint()
+}
+
+func fingerprint(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
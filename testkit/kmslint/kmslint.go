@@ -0,0 +1,432 @@
+// Package kmslint checks the key policies and grants planned by the
+// aws-kms-key module for mistakes that are expensive or impossible to undo
+// once applied: policies that lock every administrator out of the key,
+// kms:* handed to ordinary principals, grants whose operations the key
+// cannot perform, grants without encryption-context constraints, and
+// replica keys whose policy drifts from their primary.
+package kmslint
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/iampolicy"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+// Rule identifiers reported in findings.
+const (
+	RuleLockout               = "kms-lockout"
+	RuleLockoutCheckBypassed  = "kms-lockout-check-bypassed"
+	RuleWildcardAction        = "kms-wildcard-action"
+	RulePolicyUnknown         = "kms-policy-unknown"
+	RulePolicyInvalid         = "kms-policy-invalid"
+	RuleGrantInvalidOperation = "kms-grant-invalid-operation"
+	RuleGrantKeyUsage         = "kms-grant-key-usage"
+	RuleGrantNoConstraints    = "kms-grant-missing-encryption-context"
+	RuleReplicaDivergence     = "kms-replica-policy-divergence"
+	RuleReplicaUnresolved     = "kms-replica-primary-unresolved"
+)
+
+// Options tunes the linter.
+type Options struct {
+	// AdminPrincipals are IAM wildcard patterns for principals that may
+	// hold kms:* and count as key administrators, in addition to the
+	// account root. For example "arn:aws:iam::*:role/KeyAdmin".
+	AdminPrincipals []string
+}
+
+var rootPrincipal = regexp.MustCompile(`^(arn:aws[a-z-]*:iam::\d{12}:root|\d{12})$`)
+
+// validGrantOperations are the operations CreateGrant accepts.
+var validGrantOperations = map[string]bool{
+	"Decrypt":                             true,
+	"Encrypt":                             true,
+	"GenerateDataKey":                     true,
+	"GenerateDataKeyWithoutPlaintext":     true,
+	"GenerateDataKeyPair":                 true,
+	"GenerateDataKeyPairWithoutPlaintext": true,
+	"ReEncryptFrom":                       true,
+	"ReEncryptTo":                         true,
+	"Sign":                                true,
+	"Verify":                              true,
+	"GetPublicKey":                        true,
+	"GenerateMac":                         true,
+	"VerifyMac":                           true,
+	"DescribeKey":                         true,
+	"CreateGrant":                         true,
+	"RetireGrant":                         true,
+}
+
+// keyAgnosticOperations may be granted on any key.
+var keyAgnosticOperations = map[string]bool{
+	"DescribeKey": true,
+	"CreateGrant": true,
+	"RetireGrant": true,
+}
+
+// contextOperations are the symmetric cryptographic operations that accept
+// an encryption context and therefore benefit from grant constraints.
+var contextOperations = map[string]bool{
+	"Decrypt":                             true,
+	"Encrypt":                             true,
+	"GenerateDataKey":                     true,
+	"GenerateDataKeyWithoutPlaintext":     true,
+	"GenerateDataKeyPair":                 true,
+	"GenerateDataKeyPairWithoutPlaintext": true,
+	"ReEncryptFrom":                       true,
+	"ReEncryptTo":                         true,
+}
+
+// usageOperations lists the key-specific operations each key usage
+// supports, split by whether the key is symmetric.
+func usageOperations(usage string, symmetric bool) map[string]bool {
+	switch usage {
+	case "SIGN_VERIFY":
+		return map[string]bool{"Sign": true, "Verify": true, "GetPublicKey": true}
+	case "GENERATE_VERIFY_MAC":
+		return map[string]bool{"GenerateMac": true, "VerifyMac": true}
+	}
+	if symmetric {
+		return contextOperations
+	}
+
+	return map[string]bool{
+		"Encrypt":       true,
+		"Decrypt":       true,
+		"ReEncryptFrom": true,
+		"ReEncryptTo":   true,
+		"GetPublicKey":  true,
+	}
+}
+
+type key struct {
+	plan.Resource
+	usage     string
+	symmetric bool
+}
+
+// Lint checks every KMS key, external key, replica key and grant in the
+// plan.
+func Lint(p *tfjson.Plan, opts Options) finding.List {
+	resources := plan.Resources(p)
+
+	var keys []key
+	for _, r := range resources {
+		switch r.Type {
+		case "aws_kms_key":
+			usage := r.String("key_usage")
+			if usage == "" {
+				usage = "ENCRYPT_DECRYPT"
+			}
+			spec := r.String("customer_master_key_spec")
+			keys = append(keys, key{r, usage, spec == "" || spec == "SYMMETRIC_DEFAULT"})
+		case "aws_kms_external_key":
+			keys = append(keys, key{r, "ENCRYPT_DECRYPT", true})
+		}
+	}
+
+	var out finding.List
+	for _, k := range keys {
+		out = append(out, lintPolicy(k.Resource, opts)...)
+	}
+	for _, r := range resources {
+		switch r.Type {
+		case "aws_kms_replica_key":
+			out = append(out, lintPolicy(r, opts)...)
+			out = append(out, lintReplica(r, keys)...)
+		case "aws_kms_grant":
+			out = append(out, lintGrant(r, keys)...)
+		}
+	}
+	out.Sort()
+
+	return out
+}
+
+func lintPolicy(r plan.Resource, opts Options) finding.List {
+	var out finding.List
+
+	if r.Bool("bypass_policy_lockout_safety_check") {
+		out = append(out, finding.Finding{
+			Severity: finding.Medium,
+			Rule:     RuleLockoutCheckBypassed,
+			Address:  r.Address,
+			Path:     "bypass_policy_lockout_safety_check",
+			Message:  "the KMS lockout safety check is bypassed; AWS will accept a policy that nobody can change",
+		})
+	}
+
+	if r.IsUnknown("policy") {
+		return append(out, finding.Finding{
+			Severity: finding.Low,
+			Rule:     RulePolicyUnknown,
+			Address:  r.Address,
+			Path:     "policy",
+			Message:  "key policy is only known after apply and was not checked",
+		})
+	}
+	raw := r.String("policy")
+	if raw == "" {
+		// AWS applies its default key policy, which grants the account
+		// root kms:*.
+		return out
+	}
+	doc, err := iampolicy.Parse(raw)
+	if err != nil {
+		return append(out, finding.Finding{
+			Severity: finding.High,
+			Rule:     RulePolicyInvalid,
+			Address:  r.Address,
+			Path:     "policy",
+			Message:  err.Error(),
+		})
+	}
+
+	isAdmin := func(id string) bool {
+		if rootPrincipal.MatchString(id) {
+			return true
+		}
+		for _, p := range opts.AdminPrincipals {
+			if iampolicy.Match(p, id) {
+				return true
+			}
+		}
+		return false
+	}
+
+	admin := false
+	for _, s := range doc.Statements {
+		if !s.MatchesAction("kms:PutKeyPolicy") {
+			continue
+		}
+		ids := s.PrincipalIDs("AWS")
+		if s.Allows() {
+			for _, id := range ids {
+				if id != "*" && isAdmin(id) {
+					admin = true
+				}
+			}
+			continue
+		}
+		// An explicit deny on the root or on everyone overrides any allow.
+		// A conditional deny, such as one refusing requests without TLS,
+		// only applies to some requests and is reported for review.
+		for _, id := range ids {
+			if id != "*" && !rootPrincipal.MatchString(id) {
+				continue
+			}
+			f := finding.Finding{
+				Severity: finding.High,
+				Rule:     RuleLockout,
+				Address:  r.Address,
+				Path:     "policy",
+				Message:  fmt.Sprintf("statement %s denies kms:PutKeyPolicy to %s", sid(s), id),
+			}
+			if keys := s.ConditionKeys(); len(keys) > 0 {
+				f.Severity = finding.Low
+				f.Message += fmt.Sprintf(" under conditions on %s; check that an admin can still meet them", strings.Join(keys, ", "))
+			}
+			out = append(out, f)
+		}
+	}
+	if !admin {
+		out = append(out, finding.Finding{
+			Severity: finding.High,
+			Rule:     RuleLockout,
+			Address:  r.Address,
+			Path:     "policy",
+			Message:  "no statement allows kms:PutKeyPolicy to the account root or an admin principal; the key could become unmanageable",
+		})
+	}
+
+	for _, s := range doc.Statements {
+		if !s.Allows() || !wildcardKMS(s) {
+			continue
+		}
+		var offenders []string
+		for kind, ids := range s.Principals {
+			for _, id := range ids {
+				if kind == "AWS" && id != "*" && isAdmin(id) {
+					continue
+				}
+				offenders = append(offenders, id)
+			}
+		}
+		sort.Strings(offenders)
+		for _, id := range offenders {
+			out = append(out, finding.Finding{
+				Severity: finding.High,
+				Rule:     RuleWildcardAction,
+				Address:  r.Address,
+				Path:     "policy",
+				Message:  fmt.Sprintf("statement %s grants kms:* to non-admin principal %s", sid(s), id),
+			})
+		}
+	}
+
+	return out
+}
+
+// wildcardKMS reports whether the statement allows every KMS action.
+func wildcardKMS(s iampolicy.Statement) bool {
+	if len(s.NotActions) > 0 {
+		// NotAction allows everything it does not list; it is as broad as
+		// kms:* unless it carves out the administrative actions.
+		return s.MatchesAction("kms:PutKeyPolicy") && s.MatchesAction("kms:ScheduleKeyDeletion")
+	}
+	for _, a := range s.Actions {
+		if a == "*" || strings.EqualFold(a, "kms:*") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sid(s iampolicy.Statement) string {
+	if s.Sid == "" {
+		return "(no Sid)"
+	}
+
+	return fmt.Sprintf("%q", s.Sid)
+}
+
+// keyFor finds the key a grant or replica refers to: the key whose id or
+// ARN is known and equal to ref, or failing that the only key in the same
+// module.
+func keyFor(r plan.Resource, ref string, keys []key) (key, bool) {
+	if ref != "" {
+		for _, k := range keys {
+			if ref == k.String("key_id") || ref == k.String("arn") || ref == k.String("id") {
+				return k, true
+			}
+		}
+	}
+
+	var same []key
+	for _, k := range keys {
+		if k.ModuleAddress == r.ModuleAddress {
+			same = append(same, k)
+		}
+	}
+	if len(same) == 1 {
+		return same[0], true
+	}
+
+	return key{}, false
+}
+
+func lintGrant(r plan.Resource, keys []key) finding.List {
+	var out finding.List
+
+	ops := r.Strings("operations")
+	k, resolved := keyFor(r, r.String("key_id"), keys)
+
+	usageOps := map[string]bool{}
+	if resolved {
+		usageOps = usageOperations(k.usage, k.symmetric)
+	}
+
+	for _, op := range ops {
+		if !validGrantOperations[op] {
+			out = append(out, finding.Finding{
+				Severity: finding.High,
+				Rule:     RuleGrantInvalidOperation,
+				Address:  r.Address,
+				Path:     "operations",
+				Message:  fmt.Sprintf("%q is not a grant operation", op),
+			})
+			continue
+		}
+		if resolved && !keyAgnosticOperations[op] && !usageOps[op] {
+			kind := "asymmetric"
+			if k.symmetric {
+				kind = "symmetric"
+			}
+			out = append(out, finding.Finding{
+				Severity: finding.High,
+				Rule:     RuleGrantKeyUsage,
+				Address:  r.Address,
+				Path:     "operations",
+				Message:  fmt.Sprintf("%s is not supported by %s %s key %s", op, kind, k.usage, k.Address),
+			})
+		}
+	}
+
+	// Encryption context only applies to symmetric encryption keys.
+	needsContext := false
+	for _, op := range ops {
+		if contextOperations[op] && (!resolved || k.symmetric && k.usage == "ENCRYPT_DECRYPT") {
+			needsContext = true
+		}
+	}
+	if needsContext && !hasContextConstraint(r) {
+		out = append(out, finding.Finding{
+			Severity: finding.Medium,
+			Rule:     RuleGrantNoConstraints,
+			Address:  r.Address,
+			Path:     "constraints",
+			Message:  "grant allows cryptographic operations without an encryption_context_equals or encryption_context_subset constraint",
+		})
+	}
+
+	return out
+}
+
+func hasContextConstraint(r plan.Resource) bool {
+	for _, c := range r.Blocks("constraints") {
+		for _, attr := range []string{"encryption_context_equals", "encryption_context_subset"} {
+			if m, ok := c[attr].(map[string]interface{}); ok && len(m) > 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func lintReplica(r plan.Resource, keys []key) finding.List {
+	primary, ok := keyFor(r, r.String("primary_key_arn"), keys)
+	if !ok {
+		return finding.List{{
+			Severity: finding.Low,
+			Rule:     RuleReplicaUnresolved,
+			Address:  r.Address,
+			Path:     "primary_key_arn",
+			Message:  "primary key is not part of this plan; replica policy was not compared",
+		}}
+	}
+	if r.IsUnknown("policy") || primary.IsUnknown("policy") {
+		return nil
+	}
+
+	replicaPolicy, primaryPolicy := r.String("policy"), primary.String("policy")
+	diverged := false
+	switch {
+	case replicaPolicy == "" && primaryPolicy == "":
+	case replicaPolicy == "" || primaryPolicy == "":
+		diverged = true
+	default:
+		a, errA := iampolicy.Parse(replicaPolicy)
+		b, errB := iampolicy.Parse(primaryPolicy)
+		// Unparseable policies are reported by lintPolicy.
+		diverged = errA == nil && errB == nil && !iampolicy.Equal(a, b)
+	}
+	if !diverged {
+		return nil
+	}
+
+	return finding.List{{
+		Severity: finding.Medium,
+		Rule:     RuleReplicaDivergence,
+		Address:  r.Address,
+		Path:     "policy",
+		Message:  fmt.Sprintf("replica key policy differs from primary %s", primary.Address),
+	}}
+}
@@ -0,0 +1,60 @@
+package kmslint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan/plantest"
+)
+
+func TestLint(t *testing.T) {
+	p, err := plan.Load("testdata/plan.json")
+	require.NoError(t, err)
+
+	findings := Lint(p, Options{})
+
+	plantest.AssertFindings(t, []plantest.Expected{
+		plantest.Want(finding.High, RuleGrantInvalidOperation, `module.good.aws_kms_grant.this["open"]`),
+		plantest.Want(finding.Medium, RuleGrantNoConstraints, `module.good.aws_kms_grant.this["open"]`),
+		plantest.Want(finding.Medium, RuleReplicaDivergence, `module.good.aws_kms_replica_key.this["west"]`),
+		plantest.Want(finding.Medium, RuleLockoutCheckBypassed, "module.locked.aws_kms_key.this[0]"),
+		plantest.Want(finding.High, RuleLockout, "module.locked.aws_kms_key.this[0]"),
+		plantest.Want(finding.High, RuleWildcardAction, "module.locked.aws_kms_key.this[0]"),
+		plantest.Want(finding.High, RuleGrantKeyUsage, `module.locked.aws_kms_grant.this["sign"]`),
+		plantest.Want(finding.Low, RulePolicyUnknown, "module.pending.aws_kms_key.this[0]"),
+	}, findings)
+
+	assert.Equal(t, finding.High, findings[0].Severity, "findings are sorted by severity")
+}
+
+func TestLintAdminPrincipals(t *testing.T) {
+	p, err := plan.Load("testdata/plan.json")
+	require.NoError(t, err)
+
+	findings := Lint(p, Options{AdminPrincipals: []string{"arn:aws:iam::*:role/app"}})
+
+	assert.Empty(t, findings.ByRule(RuleLockout))
+	assert.Empty(t, findings.ByRule(RuleWildcardAction))
+}
+
+func TestLintConditionalDeny(t *testing.T) {
+	const key = "module.good.aws_kms_key.this[0]"
+	f := plantest.Load(t, "testdata/plan.json")
+	f.Values(t, key)["policy"] = `{"Version":"2012-10-17","Statement":[` +
+		`{"Sid":"Root","Effect":"Allow","Principal":{"AWS":"arn:aws:iam::111122223333:root"},"Action":"kms:*","Resource":"*"},` +
+		`{"Sid":"DenyInsecureTransport","Effect":"Deny","Principal":{"AWS":"*"},"Action":"kms:*","Resource":"*","Condition":{"Bool":{"aws:SecureTransport":"false"}}}]}`
+
+	var lockouts finding.List
+	for _, fd := range Lint(f.Plan(t), Options{}).ByRule(RuleLockout) {
+		if fd.Address == key {
+			lockouts = append(lockouts, fd)
+		}
+	}
+	if plantest.AssertFindings(t, []plantest.Expected{plantest.Want(finding.Low, RuleLockout, key)}, lockouts) {
+		assert.Contains(t, lockouts[0].Message, "aws:securetransport")
+	}
+}
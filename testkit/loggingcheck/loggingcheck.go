@@ -0,0 +1,511 @@
+// Package loggingcheck follows the links between a planned
+// aws_bedrock_model_invocation_logging_configuration and the resources it
+// writes through: the CloudWatch log group and the role Bedrock assumes to
+// write to it, the log and large-data buckets and their bucket policies,
+// and the KMS keys that encrypt them. A broken link only shows up as
+// silently missing logs, so each one is reported against the address of
+// the resource that needs fixing.
+//
+// Policies built from attributes that are only known after apply cannot
+// be checked in a first plan; they are reported at LOW severity. Running
+// the check on a plan taken after apply covers every link.
+package loggingcheck
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/iampolicy"
+	"github.com/JQUINONES82/terraform_modules/testkit/invocationlog"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+// Rule identifiers reported in findings.
+const (
+	RuleTrust           = "logging-role-trust"
+	RuleTrustConditions = "logging-role-trust-conditions"
+	RuleRolePermissions = "logging-role-permissions"
+	RuleBucketPolicy    = "logging-bucket-policy"
+	RuleBucketDeny      = "logging-bucket-deny"
+	RuleKeyPolicy       = "logging-kms-key-policy"
+	RuleUnresolved      = "logging-unresolved"
+)
+
+// BedrockService is the service principal that writes invocation logs.
+const BedrockService = "bedrock.amazonaws.com"
+
+// Check verifies every logging configuration in p.
+func Check(p *tfjson.Plan) finding.List {
+	c := &checker{resources: plan.Resources(p)}
+	c.partition, c.account, c.region = c.arnScope()
+	for _, cfg := range invocationlog.FromPlan(p) {
+		c.check(cfg)
+	}
+	c.out.Sort()
+
+	return c.out
+}
+
+type checker struct {
+	resources []plan.Resource
+	out       finding.List
+
+	// partition, account and region are taken from the ARNs in the plan,
+	// to build the log object keys and ARNs Bedrock writes.
+	partition, account, region string
+}
+
+func (c *checker) add(s finding.Severity, rule, address, path, format string, args ...interface{}) {
+	c.out = append(c.out, finding.Finding{Severity: s, Rule: rule, Address: address, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) check(cfg invocationlog.Config) {
+	if cw := cfg.CloudWatch; cw != nil {
+		group, ok := c.find("aws_cloudwatch_log_group", "name", cw.LogGroup)
+		if !ok {
+			c.add(finding.Low, RuleUnresolved, cfg.Address, "logging_config.cloudwatch_config.log_group_name",
+				"log group %q is not managed in this plan; its permissions were not checked", cw.LogGroup)
+		}
+		if role, found := c.loggingRole(cfg); found {
+			c.checkTrust(role)
+			if ok {
+				c.checkRolePermissions(role, group)
+			}
+		}
+		if ok {
+			c.checkKey(group.String("kms_key_id"), group.Address, "kms_key_id", "logs."+c.region+".amazonaws.com",
+				[]string{"kms:Encrypt", "kms:Decrypt", "kms:GenerateDataKey"})
+		}
+		if cw.LargeData != nil {
+			c.checkBucket(cfg, "logging_config.cloudwatch_config.large_data_delivery_s3_config", *cw.LargeData)
+		}
+	}
+	if cfg.S3 != nil {
+		c.checkBucket(cfg, "logging_config.s3_config", *cfg.S3)
+	}
+}
+
+// loggingRole resolves the role named by cloudwatch_config.role_arn. When
+// the ARN is only known after apply, the single role in the plan that
+// trusts Bedrock is used.
+func (c *checker) loggingRole(cfg invocationlog.Config) (plan.Resource, bool) {
+	const attr = "logging_config.cloudwatch_config.role_arn"
+	if arn := cfg.CloudWatch.RoleARN; arn != "" {
+		if r, ok := c.find("aws_iam_role", "arn", arn); ok {
+			return r, true
+		}
+		c.add(finding.Low, RuleUnresolved, cfg.Address, attr, "role %s is not managed in this plan; its trust and permissions were not checked", arn)
+		return plan.Resource{}, false
+	}
+
+	var candidates []plan.Resource
+	for _, r := range c.ofType("aws_iam_role") {
+		if doc, err := iampolicy.Parse(r.String("assume_role_policy")); err == nil && trustsBedrock(doc) != nil {
+			candidates = append(candidates, r)
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0], true
+	}
+	c.add(finding.Low, RuleUnresolved, cfg.Address, attr, "role ARN is known after apply and %d roles trust %s; the logging role was not checked", len(candidates), BedrockService)
+
+	return plan.Resource{}, false
+}
+
+func (c *checker) checkTrust(role plan.Resource) {
+	doc, ok := c.policy(role, "assume_role_policy")
+	if !ok {
+		return
+	}
+	st := trustsBedrock(doc)
+	if st == nil {
+		c.add(finding.High, RuleTrust, role.Address, "assume_role_policy", "role does not trust %s with sts:AssumeRole, so Bedrock cannot write logs with it", BedrockService)
+		return
+	}
+	var missing []string
+	keys := st.ConditionKeys()
+	for _, k := range []string{"aws:SourceAccount", "aws:SourceArn"} {
+		if !contains(keys, k) {
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) > 0 {
+		c.add(finding.Medium, RuleTrustConditions, role.Address, "assume_role_policy",
+			"trust for %s has no %s condition; any account's Bedrock could assume the role", BedrockService, strings.Join(missing, " or "))
+	}
+}
+
+func trustsBedrock(doc *iampolicy.Document) *iampolicy.Statement {
+	for i, st := range doc.Statements {
+		if st.Allows() && st.HasPrincipal("Service", BedrockService) && st.MatchesAction("sts:AssumeRole") {
+			return &doc.Statements[i]
+		}
+	}
+
+	return nil
+}
+
+// checkRolePermissions checks that the role's policies allow writing to
+// the invocation log stream of the exact log group.
+func (c *checker) checkRolePermissions(role, group plan.Resource) {
+	arn := group.String("arn")
+	if arn == "" {
+		c.add(finding.Low, RuleUnresolved, group.Address, "arn", "log group ARN is known after apply; role permissions were not checked")
+		return
+	}
+	stream := arn + ":log-stream:" + invocationlog.LogStream
+
+	docs, complete := c.rolePolicies(role)
+	for _, action := range []string{"logs:CreateLogStream", "logs:PutLogEvents"} {
+		allowed, denied := evaluate(docs, action, stream)
+		switch {
+		case denied:
+			c.add(finding.High, RuleRolePermissions, role.Address, action, "role policies deny %s on %s", action, stream)
+		case !allowed && complete:
+			c.add(finding.High, RuleRolePermissions, role.Address, action, "role policies do not allow %s on %s", action, stream)
+		case !allowed:
+			c.add(finding.Low, RuleUnresolved, role.Address, action, "%s on %s is not allowed by the policies that could be read", action, stream)
+		}
+	}
+}
+
+// rolePolicies returns the inline and attached policies of role that can
+// be read from the plan, and whether every policy could be read.
+func (c *checker) rolePolicies(role plan.Resource) ([]*iampolicy.Document, bool) {
+	var docs []*iampolicy.Document
+	complete := true
+	name := role.String("name")
+	attached := func(r plan.Resource) bool {
+		ref := r.String("role")
+		return ref != "" && (ref == name || ref == role.String("id"))
+	}
+
+	for _, b := range role.Blocks("inline_policy") {
+		if doc, err := iampolicy.Parse(fmt.Sprint(b["policy"])); err == nil {
+			docs = append(docs, doc)
+		}
+	}
+	for _, r := range c.ofType("aws_iam_role_policy") {
+		if !attached(r) {
+			continue
+		}
+		if doc, ok := c.policy(r, "policy"); ok {
+			docs = append(docs, doc)
+		} else {
+			complete = false
+		}
+	}
+	for _, r := range c.ofType("aws_iam_role_policy_attachment") {
+		if !attached(r) {
+			continue
+		}
+		policyARN := r.String("policy_arn")
+		p, ok := c.find("aws_iam_policy", "arn", policyARN)
+		if !ok || policyARN == "" {
+			c.add(finding.Low, RuleUnresolved, r.Address, "policy_arn", "attached policy is not known in this plan")
+			complete = false
+			continue
+		}
+		if doc, ok := c.policy(p, "policy"); ok {
+			docs = append(docs, doc)
+		} else {
+			complete = false
+		}
+	}
+
+	return docs, complete
+}
+
+// checkBucket checks that Bedrock can put objects under loc.
+func (c *checker) checkBucket(cfg invocationlog.Config, attr string, loc invocationlog.Location) {
+	if loc.Bucket == "" {
+		c.add(finding.Low, RuleUnresolved, cfg.Address, attr+".bucket_name", "bucket name is known after apply; bucket policy and encryption were not checked")
+		return
+	}
+	bucket, ok := c.find("aws_s3_bucket", "bucket", loc.Bucket)
+	if !ok {
+		c.add(finding.Low, RuleUnresolved, cfg.Address, attr+".bucket_name", "bucket %q is not managed in this plan; its policy was not checked", loc.Bucket)
+		return
+	}
+
+	policy, ok := c.find("aws_s3_bucket_policy", "bucket", loc.Bucket)
+	switch {
+	case !ok:
+		c.add(finding.High, RuleBucketPolicy, bucket.Address, "policy", "bucket has no policy allowing %s to put objects under %q", BedrockService, loc.Prefix)
+	case c.account == "":
+		// Object keys carry the account ID, which no ARN in the plan names.
+		c.add(finding.Low, RuleUnresolved, policy.Address, "policy", "account ID is not known in this plan, so the object keys Bedrock writes under %q were not checked", loc.Prefix)
+	default:
+		if doc, ok := c.policy(policy, "policy"); ok {
+			c.checkBucketPolicy(policy.Address, doc, c.objectARN(bucket, loc))
+		}
+	}
+
+	for _, enc := range c.ofType("aws_s3_bucket_server_side_encryption_configuration") {
+		if enc.String("bucket") != loc.Bucket {
+			continue
+		}
+		for _, rule := range enc.Blocks("rule") {
+			for _, def := range plan.Objects(rule["apply_server_side_encryption_by_default"]) {
+				keyID, _ := def["kms_master_key_id"].(string)
+				if def["sse_algorithm"] == "aws:kms" || def["sse_algorithm"] == "aws:kms:dsse" {
+					c.checkKey(keyID, enc.Address, "rule.apply_server_side_encryption_by_default.kms_master_key_id", BedrockService,
+						[]string{"kms:GenerateDataKey"})
+				}
+			}
+		}
+	}
+}
+
+// objectARN is the ARN of an object Bedrock writes under loc.
+func (c *checker) objectARN(bucket plan.Resource, loc invocationlog.Location) string {
+	bucketARN := bucket.String("arn")
+	if bucketARN == "" {
+		bucketARN = "arn:" + c.partition + ":s3:::" + loc.Bucket
+	}
+
+	return bucketARN + "/" + path.Join(loc.KeyPrefix(c.account, c.region), "2024/01/01/00/invocations.json.gz")
+}
+
+func (c *checker) checkBucketPolicy(address string, doc *iampolicy.Document, object string) {
+	allowed := false
+	for _, st := range doc.Statements {
+		if !st.MatchesAction("s3:PutObject") || !st.MatchesResource(object) {
+			continue
+		}
+		if st.Allows() {
+			allowed = allowed || st.HasPrincipal("Service", BedrockService)
+			continue
+		}
+		if !st.HasPrincipal("Service", BedrockService) {
+			continue
+		}
+		switch result, why := denyApplies(st); result {
+		case denyAlways:
+			c.add(finding.High, RuleBucketDeny, address, "policy", "statement %q denies %s s3:PutObject on %s", st.Sid, BedrockService, object)
+		case denyLikely:
+			c.add(finding.Medium, RuleBucketDeny, address, "policy", "statement %q denies %s s3:PutObject on %s %s", st.Sid, BedrockService, object, why)
+		case denyUnknown:
+			c.add(finding.Low, RuleBucketDeny, address, "policy", "statement %q may deny %s s3:PutObject on %s: %s", st.Sid, BedrockService, object, why)
+		}
+	}
+	if !allowed {
+		c.add(finding.High, RuleBucketPolicy, address, "policy", "no statement allows %s s3:PutObject on %s", BedrockService, object)
+	}
+}
+
+type denyResult int
+
+const (
+	denyNever denyResult = iota
+	denyUnknown
+	denyLikely
+	denyAlways
+)
+
+// denyApplies estimates whether a Deny statement applies to Bedrock's log
+// delivery, which uses TLS and relies on the bucket's default encryption
+// rather than sending an encryption header. Conditions in a statement must
+// all match, so one that cannot match rules the statement out, and the
+// result is the weakest of the others.
+func denyApplies(st iampolicy.Statement) (denyResult, string) {
+	result, why := denyAlways, ""
+	weaken := func(r denyResult, reason string) {
+		if r < result {
+			result, why = r, reason
+		}
+	}
+	ops := make([]string, 0, len(st.Conditions))
+	for op := range st.Conditions {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		for key, values := range st.Conditions[op] {
+			switch k := strings.ToLower(key); {
+			case k == "aws:securetransport" && op == "Bool":
+				if contains(values, "false") {
+					return denyNever, ""
+				}
+			case k == "s3:x-amz-server-side-encryption":
+				switch {
+				case strings.HasSuffix(op, "IfExists"), op == "Null" && contains(values, "false"):
+					return denyNever, ""
+				case op == "StringNotEquals", op == "Null":
+					weaken(denyLikely, "when no s3:x-amz-server-side-encryption header is sent; use StringNotEqualsIfExists so default bucket encryption is accepted")
+				default:
+					weaken(denyUnknown, fmt.Sprintf("condition %s %s cannot be evaluated", op, key))
+				}
+			default:
+				weaken(denyUnknown, fmt.Sprintf("condition %s %s cannot be evaluated", op, key))
+			}
+		}
+	}
+
+	return result, why
+}
+
+// checkKey checks that keyRef's key policy lets service perform actions.
+func (c *checker) checkKey(keyRef, address, attr, service string, actions []string) {
+	if keyRef == "" {
+		return
+	}
+	key, ok := c.findKey(keyRef)
+	if !ok {
+		c.add(finding.Low, RuleUnresolved, address, attr, "KMS key %s is not managed in this plan; its key policy was not checked", keyRef)
+		return
+	}
+	doc, ok := c.policy(key, "policy")
+	if !ok {
+		return
+	}
+	keyARN := key.String("arn")
+	if keyARN == "" {
+		keyARN = "*"
+	}
+	for _, action := range actions {
+		allowed, denied := evaluateFor(doc, service, action, keyARN)
+		if denied || !allowed {
+			c.add(finding.High, RuleKeyPolicy, key.Address, "policy", "key policy does not let %s perform %s, which %s needs to write logs", service, action, address)
+		}
+	}
+}
+
+func (c *checker) findKey(ref string) (plan.Resource, bool) {
+	if r, ok := c.find("aws_kms_key", "arn", ref); ok {
+		return r, true
+	}
+	if r, ok := c.find("aws_kms_key", "key_id", ref); ok {
+		return r, true
+	}
+	for _, attr := range []string{"arn", "name"} {
+		if alias, ok := c.find("aws_kms_alias", attr, ref); ok {
+			return c.findKey(alias.String("target_key_id"))
+		}
+	}
+
+	return plan.Resource{}, false
+}
+
+// policy parses the policy attribute of r, reporting why it cannot.
+func (c *checker) policy(r plan.Resource, attr string) (*iampolicy.Document, bool) {
+	raw := r.String(attr)
+	if raw == "" {
+		if r.IsUnknown(attr) {
+			c.add(finding.Low, RuleUnresolved, r.Address, attr, "policy is known after apply; run the check on a plan taken after apply")
+		}
+		return nil, false
+	}
+	doc, err := iampolicy.Parse(raw)
+	if err != nil {
+		c.add(finding.Medium, RuleUnresolved, r.Address, attr, "policy does not parse: %v", err)
+		return nil, false
+	}
+
+	return doc, true
+}
+
+func (c *checker) ofType(t string) []plan.Resource {
+	var out []plan.Resource
+	for _, r := range c.resources {
+		if r.Type == t {
+			out = append(out, r)
+		}
+	}
+
+	return out
+}
+
+// find returns the resource of type t whose attr equals value.
+func (c *checker) find(t, attr, value string) (plan.Resource, bool) {
+	if value == "" {
+		return plan.Resource{}, false
+	}
+	for _, r := range c.ofType(t) {
+		if r.String(attr) == value {
+			return r, true
+		}
+	}
+
+	return plan.Resource{}, false
+}
+
+// arnScope takes the partition, account and region from the first ARNs in
+// the plan that carry them. The account is left empty when no ARN names
+// one, since a made-up account would put the checked keys where Bedrock
+// never writes.
+func (c *checker) arnScope() (partition, account, region string) {
+	for _, r := range c.resources {
+		parts := strings.SplitN(r.String("arn"), ":", 6)
+		if len(parts) < 6 {
+			continue
+		}
+		if partition == "" && parts[1] != "" {
+			partition = parts[1]
+		}
+		if account == "" && parts[4] != "" {
+			account = parts[4]
+		}
+		if region == "" && parts[3] != "" {
+			region = parts[3]
+		}
+	}
+	if partition == "" {
+		partition = "aws"
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return partition, account, region
+}
+
+// evaluate reports whether any of docs allows and whether any denies
+// action on resource for an identity policy.
+func evaluate(docs []*iampolicy.Document, action, resource string) (allowed, denied bool) {
+	for _, doc := range docs {
+		for _, st := range doc.Statements {
+			if !st.MatchesAction(action) || !st.MatchesResource(resource) {
+				continue
+			}
+			if st.Allows() {
+				allowed = true
+			} else {
+				denied = true
+			}
+		}
+	}
+
+	return allowed, denied
+}
+
+// evaluateFor is evaluate for a resource policy and a service principal.
+func evaluateFor(doc *iampolicy.Document, service, action, resource string) (allowed, denied bool) {
+	for _, st := range doc.Statements {
+		if !st.HasPrincipal("Service", service) || !st.MatchesAction(action) || !st.MatchesResource(resource) {
+			continue
+		}
+		if st.Allows() {
+			allowed = true
+		} else if len(st.Conditions) == 0 {
+			denied = true
+		}
+	}
+
+	return allowed, denied
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if strings.EqualFold(e, s) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,192 @@
+package loggingcheck
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/iampolicy"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan/plantest"
+)
+
+const (
+	trustWithoutConditions = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"bedrock.amazonaws.com"},"Action":"sts:AssumeRole"}]}`
+
+	otherLogGroup = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["logs:CreateLogStream","logs:PutLogEvents"],"Resource":"arn:aws:logs:us-east-1:111122223333:log-group:/aws/other:*"}]}`
+
+	// bucketWithEncryptionDeny is the solution's original bucket policy: no
+	// Allow for Bedrock, and a Deny that catches uploads relying on default
+	// encryption.
+	bucketWithEncryptionDeny = `{"Version":"2012-10-17","Statement":[
+		{"Sid":"DenyInsecureTransport","Effect":"Deny","Principal":"*","Action":"s3:*","Resource":["arn:aws:s3:::test-hybrid-bedrock-logs-1a2b3c4d","arn:aws:s3:::test-hybrid-bedrock-logs-1a2b3c4d/*"],"Condition":{"Bool":{"aws:SecureTransport":"false"}}},
+		{"Sid":"DenyUnEncryptedObjectUploads","Effect":"Deny","Principal":"*","Action":"s3:PutObject","Resource":"arn:aws:s3:::test-hybrid-bedrock-logs-1a2b3c4d/*","Condition":{"StringNotEquals":{"s3:x-amz-server-side-encryption":"aws:kms"}}}]}`
+
+	wrongPrefix = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"bedrock.amazonaws.com"},"Action":"s3:PutObject","Resource":"arn:aws:s3:::test-hybrid-bedrock-large-data-1a2b3c4d/other/*"}]}`
+
+	rootOnlyKey = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::111122223333:root"},"Action":"kms:*","Resource":"*"}]}`
+)
+
+func load(t *testing.T) *tfjson.Plan {
+	t.Helper()
+	p, err := plan.Load("testdata/plan.json")
+	require.NoError(t, err)
+
+	return p
+}
+
+// set replaces an attribute of a root module resource.
+func set(t *testing.T, p *tfjson.Plan, address, key string, value interface{}) {
+	t.Helper()
+	for _, r := range p.PlannedValues.RootModule.Resources {
+		if r.Address == address {
+			r.AttributeValues[key] = value
+			return
+		}
+	}
+	t.Fatalf("no resource %s in plan", address)
+}
+
+func TestCheckAllLinksIntact(t *testing.T) {
+	findings := Check(load(t))
+	assert.Empty(t, findings, findings.String())
+}
+
+// Bucket policies in other partitions grant object ARNs of that partition.
+func TestCheckGovCloud(t *testing.T) {
+	data, err := os.ReadFile("testdata/plan.json")
+	require.NoError(t, err)
+	p, err := plan.Parse(bytes.ReplaceAll(data, []byte("arn:aws:"), []byte("arn:aws-us-gov:")))
+	require.NoError(t, err)
+	findings := Check(p)
+	assert.Empty(t, findings, findings.String())
+}
+
+// Without an account ID the object keys cannot be built, so the bucket
+// policies are reported as unresolved rather than checked against a
+// made-up account.
+func TestCheckUnknownAccount(t *testing.T) {
+	data, err := os.ReadFile("testdata/plan.json")
+	require.NoError(t, err)
+	p, err := plan.Parse(bytes.ReplaceAll(data, []byte("111122223333"), nil))
+	require.NoError(t, err)
+
+	plantest.AssertFindings(t, []plantest.Expected{
+		plantest.Want(finding.Low, RuleUnresolved, "aws_s3_bucket_policy.bedrock_large_data"),
+		plantest.Want(finding.Low, RuleUnresolved, "aws_s3_bucket_policy.bedrock_logs"),
+	}, Check(p))
+}
+
+func TestCheckBrokenLinks(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(t *testing.T, p *tfjson.Plan)
+		want   []plantest.Expected
+	}{
+		{
+			name: "trust without source conditions",
+			mutate: func(t *testing.T, p *tfjson.Plan) {
+				set(t, p, "aws_iam_role.bedrock_cloudwatch", "assume_role_policy", trustWithoutConditions)
+			},
+			want: []plantest.Expected{plantest.Want(finding.Medium, RuleTrustConditions, "aws_iam_role.bedrock_cloudwatch")},
+		},
+		{
+			name: "role trusts another service",
+			mutate: func(t *testing.T, p *tfjson.Plan) {
+				set(t, p, "aws_iam_role.bedrock_cloudwatch", "assume_role_policy",
+					`{"Statement":[{"Effect":"Allow","Principal":{"Service":"lambda.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleTrust, "aws_iam_role.bedrock_cloudwatch")},
+		},
+		{
+			name: "role writes to another log group",
+			mutate: func(t *testing.T, p *tfjson.Plan) {
+				set(t, p, "aws_iam_role_policy.bedrock_cloudwatch", "policy", otherLogGroup)
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.High, RuleRolePermissions, "aws_iam_role.bedrock_cloudwatch"),
+				plantest.Want(finding.High, RuleRolePermissions, "aws_iam_role.bedrock_cloudwatch"),
+			},
+		},
+		{
+			name: "bucket policy denies default encryption",
+			mutate: func(t *testing.T, p *tfjson.Plan) {
+				set(t, p, "aws_s3_bucket_policy.bedrock_logs", "policy", bucketWithEncryptionDeny)
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.High, RuleBucketPolicy, "aws_s3_bucket_policy.bedrock_logs"),
+				plantest.Want(finding.Medium, RuleBucketDeny, "aws_s3_bucket_policy.bedrock_logs"),
+			},
+		},
+		{
+			name: "large data policy covers another prefix",
+			mutate: func(t *testing.T, p *tfjson.Plan) {
+				set(t, p, "aws_s3_bucket_policy.bedrock_large_data", "policy", wrongPrefix)
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleBucketPolicy, "aws_s3_bucket_policy.bedrock_large_data")},
+		},
+		{
+			name: "key policy omits the writers",
+			mutate: func(t *testing.T, p *tfjson.Plan) {
+				set(t, p, "aws_kms_key.logs", "policy", rootOnlyKey)
+			},
+			want: []plantest.Expected{
+				// kms:Encrypt, kms:Decrypt and kms:GenerateDataKey for the
+				// log group, kms:GenerateDataKey for the bucket.
+				plantest.Want(finding.High, RuleKeyPolicy, "aws_kms_key.logs"),
+				plantest.Want(finding.High, RuleKeyPolicy, "aws_kms_key.logs"),
+				plantest.Want(finding.High, RuleKeyPolicy, "aws_kms_key.logs"),
+				plantest.Want(finding.High, RuleKeyPolicy, "aws_kms_key.logs"),
+			},
+		},
+		{
+			name: "policy known after apply",
+			mutate: func(t *testing.T, p *tfjson.Plan) {
+				set(t, p, "aws_iam_role_policy.bedrock_cloudwatch", "policy", nil)
+				p.ResourceChanges = append(p.ResourceChanges, &tfjson.ResourceChange{
+					Address: "aws_iam_role_policy.bedrock_cloudwatch",
+					Type:    "aws_iam_role_policy",
+					Change:  &tfjson.Change{AfterUnknown: map[string]interface{}{"policy": true}},
+				})
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.Low, RuleUnresolved, "aws_iam_role.bedrock_cloudwatch"),
+				plantest.Want(finding.Low, RuleUnresolved, "aws_iam_role.bedrock_cloudwatch"),
+				plantest.Want(finding.Low, RuleUnresolved, "aws_iam_role_policy.bedrock_cloudwatch"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := load(t)
+			tt.mutate(t, p)
+
+			findings := Check(p)
+			plantest.AssertFindings(t, tt.want, findings)
+		})
+	}
+}
+
+func TestDenyApplies(t *testing.T) {
+	tests := []struct {
+		condition map[string]map[string][]string
+		want      denyResult
+	}{
+		{nil, denyAlways},
+		{map[string]map[string][]string{"Bool": {"aws:SecureTransport": {"false"}}}, denyNever},
+		{map[string]map[string][]string{"StringNotEquals": {"s3:x-amz-server-side-encryption": {"aws:kms"}}}, denyLikely},
+		{map[string]map[string][]string{"StringNotEqualsIfExists": {"s3:x-amz-server-side-encryption": {"aws:kms"}}}, denyNever},
+		{map[string]map[string][]string{"Null": {"s3:x-amz-server-side-encryption": {"true"}}}, denyLikely},
+		{map[string]map[string][]string{"StringNotEquals": {"aws:SourceVpce": {"vpce-1"}}}, denyUnknown},
+	}
+	for _, tt := range tests {
+		got, _ := denyApplies(iampolicy.Statement{Effect: "Deny", Conditions: tt.condition})
+		assert.Equal(t, tt.want, got, "%v", tt.condition)
+	}
+}
@@ -0,0 +1,312 @@
+package metricmath
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/alarm"
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/internal/graph"
+	"github.com/JQUINONES82/terraform_modules/testkit/internal/hint"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+// Rule identifiers reported by Check.
+const (
+	RuleID              = "metric-math-id"
+	RuleQuery           = "metric-math-query"
+	RuleSyntax          = "metric-math-syntax"
+	RuleFunction        = "metric-math-function"
+	RuleReference       = "metric-math-reference"
+	RuleReturnData      = "metric-math-return-data"
+	RuleThresholdMetric = "metric-math-threshold-metric"
+	RuleUnknown         = "metric-math-unknown"
+)
+
+// BandOperators are the comparison operators of alarms on an anomaly
+// detection band.
+var BandOperators = []string{
+	"LessThanLowerOrGreaterThanUpperThreshold",
+	"LessThanLowerThreshold",
+	"GreaterThanUpperThreshold",
+}
+
+// BandFunction is the function that produces an anomaly detection band.
+const BandFunction = "ANOMALY_DETECTION_BAND"
+
+var idPattern = regexp.MustCompile(`^[a-z][a-zA-Z0-9_]*$`)
+
+// Metric is the metric block of a query.
+type Metric struct {
+	Namespace  string
+	MetricName string
+	Stat       string
+	Period     int
+}
+
+// Query is a metric_query block: either a Metric or an Expression.
+type Query struct {
+	ID         string
+	Label      string
+	Expression string
+	ReturnData bool
+	Metric     *Metric
+}
+
+func (q Query) label() string {
+	if q.Label != "" {
+		return q.Label
+	}
+
+	return q.ID
+}
+
+// Alarm is a metric alarm built on metric_query blocks.
+type Alarm struct {
+	Address            string
+	Name               string
+	ComparisonOperator string
+	ThresholdMetricID  string
+	Queries            []Query
+}
+
+// Query returns the query with the given id.
+func (a Alarm) Query(id string) (Query, bool) {
+	for _, q := range a.Queries {
+		if q.ID == id {
+			return q, true
+		}
+	}
+
+	return Query{}, false
+}
+
+// FromPlan returns the metric alarms in p that use metric_query blocks.
+func FromPlan(p *tfjson.Plan) []Alarm {
+	var out []Alarm
+	for _, r := range plan.ResourcesOfType(p, alarm.ResourceType) {
+		if blocks := r.Blocks("metric_query"); len(blocks) > 0 {
+			out = append(out, fromResource(r, blocks))
+		}
+	}
+
+	return out
+}
+
+func fromResource(r plan.Resource, blocks []map[string]interface{}) Alarm {
+	a := Alarm{
+		Address:            r.Address,
+		Name:               r.String("alarm_name"),
+		ComparisonOperator: r.String("comparison_operator"),
+		ThresholdMetricID:  r.String("threshold_metric_id"),
+	}
+	for _, b := range blocks {
+		qr := plan.Resource{Values: b}
+		q := Query{
+			ID:         qr.String("id"),
+			Label:      qr.String("label"),
+			Expression: qr.String("expression"),
+			ReturnData: qr.Bool("return_data"),
+		}
+		if m := qr.Blocks("metric"); len(m) > 0 {
+			mr := plan.Resource{Values: m[0]}
+			q.Metric = &Metric{
+				Namespace:  mr.String("namespace"),
+				MetricName: mr.String("metric_name"),
+				Stat:       mr.String("stat"),
+				Period:     int(mr.Number("period")),
+			}
+		}
+		a.Queries = append(a.Queries, q)
+	}
+
+	return a
+}
+
+// CheckPlan checks every metric alarm in p that uses metric_query blocks.
+func CheckPlan(p *tfjson.Plan) finding.List {
+	var out finding.List
+	for _, r := range plan.ResourcesOfType(p, alarm.ResourceType) {
+		blocks := r.Blocks("metric_query")
+		if r.IsUnknown("metric_query") {
+			out = append(out, finding.Finding{Severity: finding.Low, Rule: RuleUnknown, Address: r.Address, Path: "metric_query",
+				Message: "queries are known after apply and were not checked"})
+			continue
+		}
+		if len(blocks) > 0 {
+			out = append(out, Check(fromResource(r, blocks))...)
+		}
+	}
+	out.Sort()
+
+	return out
+}
+
+// Check validates the queries of an alarm as PutMetricAlarm would: ids
+// are unique and start with a lower-case letter, each query has either a
+// metric or an expression, expressions parse, call known functions with
+// the right number of arguments and reference existing queries without
+// cycles, and exactly one query returns data. An alarm on an anomaly
+// detection band names the band in threshold_metric_id, and the band and
+// the query it is computed from both return data.
+func Check(a Alarm) finding.List {
+	var out finding.List
+	add := func(s finding.Severity, rule, path, format string, args ...interface{}) {
+		out = append(out, finding.Finding{Severity: s, Rule: rule, Address: a.Address, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	ids := map[string]int{}
+	for i, q := range a.Queries {
+		path := fmt.Sprintf("metric_query[%d].id", i)
+		if !idPattern.MatchString(q.ID) {
+			add(finding.High, RuleID, path, "id %q must start with a lower-case letter and contain only letters, digits and underscores", q.ID)
+		}
+		if j, ok := ids[q.ID]; ok {
+			add(finding.High, RuleID, path, "id %q is also used by metric_query[%d]", q.ID, j)
+			continue
+		}
+		ids[q.ID] = i
+	}
+
+	// edges records which queries each expression references, to find
+	// cycles once every expression has been parsed.
+	edges := map[string][]string{}
+	roots := map[string]Node{}
+	for i, q := range a.Queries {
+		path := fmt.Sprintf("metric_query[%d]", i)
+		if (q.Metric == nil) == (q.Expression == "") {
+			add(finding.High, RuleQuery, path, "query %s must set exactly one of metric and expression", q.ID)
+			continue
+		}
+		if q.Metric != nil {
+			continue
+		}
+		path += ".expression"
+		root, err := Parse(q.Expression)
+		if err != nil {
+			add(finding.High, RuleSyntax, path, "%v", err)
+			continue
+		}
+		roots[q.ID] = root
+		Walk(root, func(n Node) {
+			c, ok := n.(Call)
+			if !ok {
+				return
+			}
+			fn, ok := functions[c.Func]
+			switch {
+			case !ok:
+				add(finding.High, RuleFunction, path, "unknown function %s%s", c.Func, hint.DidYouMean(c.Func, functionNames()))
+			case len(c.Args) < fn.min || fn.max >= 0 && len(c.Args) > fn.max:
+				add(finding.High, RuleFunction, path, "%s takes %s, not %d", c.Func, arity(fn), len(c.Args))
+			}
+		})
+		for _, ref := range Refs(root) {
+			switch _, ok := ids[ref]; {
+			case ref == q.ID:
+				add(finding.High, RuleReference, path, "query %s references itself", q.ID)
+			case !ok:
+				add(finding.High, RuleReference, path, "no query with id %q", ref)
+			default:
+				edges[q.ID] = append(edges[q.ID], ref)
+			}
+		}
+	}
+	for _, cycle := range graph.Cycles(edges) {
+		add(finding.High, RuleReference, fmt.Sprintf("metric_query[%d].expression", ids[cycle[0]]),
+			"queries reference each other: %s", strings.Join(append(cycle, cycle[0]), " -> "))
+	}
+
+	out = append(out, a.checkReturnData(roots)...)
+	out.Sort()
+
+	return out
+}
+
+// checkReturnData checks return_data and threshold_metric_id together,
+// since an anomaly detection alarm returns two series.
+func (a Alarm) checkReturnData(roots map[string]Node) finding.List {
+	var out finding.List
+	add := func(s finding.Severity, rule, path, format string, args ...interface{}) {
+		out = append(out, finding.Finding{Severity: s, Rule: rule, Address: a.Address, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var returning []string
+	for _, q := range a.Queries {
+		if q.ReturnData && q.ID != a.ThresholdMetricID {
+			returning = append(returning, q.ID)
+		}
+	}
+	if len(returning) != 1 {
+		what := "none does"
+		if len(returning) > 1 {
+			what = strings.Join(returning, ", ") + " do"
+		}
+		add(finding.High, RuleReturnData, "metric_query", "exactly one query must set return_data besides the threshold; %s", what)
+	}
+
+	band := contains(BandOperators, a.ComparisonOperator)
+	if a.ThresholdMetricID == "" {
+		if band {
+			add(finding.High, RuleThresholdMetric, "threshold_metric_id", "%s needs threshold_metric_id to name an %s query", a.ComparisonOperator, BandFunction)
+		}
+		return out
+	}
+	if !band {
+		add(finding.High, RuleThresholdMetric, "comparison_operator", "threshold_metric_id is set but %s does not compare against a band; use one of %s",
+			a.ComparisonOperator, strings.Join(BandOperators, ", "))
+	}
+	q, ok := a.Query(a.ThresholdMetricID)
+	if !ok {
+		add(finding.High, RuleThresholdMetric, "threshold_metric_id", "no query with id %q", a.ThresholdMetricID)
+		return out
+	}
+	root, ok := roots[q.ID]
+	if !ok {
+		if q.Metric != nil {
+			add(finding.High, RuleThresholdMetric, "threshold_metric_id", "query %s is a metric, not an %s expression", q.ID, BandFunction)
+		}
+		return out
+	}
+	c, ok := root.(Call)
+	if !ok || c.Func != BandFunction {
+		add(finding.High, RuleThresholdMetric, "threshold_metric_id", "query %s is %s, not an %s expression", q.ID, root, BandFunction)
+		return out
+	}
+	if !q.ReturnData {
+		add(finding.High, RuleReturnData, "threshold_metric_id", "band query %s must set return_data", q.ID)
+	}
+	if len(c.Args) > 0 {
+		if ref, ok := c.Args[0].(Ref); ok && len(returning) == 1 && returning[0] != string(ref) {
+			add(finding.High, RuleReturnData, "metric_query", "%s returns data but the band is computed from %s", returning[0], ref)
+		}
+	}
+
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func arity(fn function) string {
+	switch {
+	case fn.max < 0:
+		return fmt.Sprintf("at least %d arguments", fn.min)
+	case fn.min == fn.max && fn.min == 1:
+		return "1 argument"
+	case fn.min == fn.max:
+		return fmt.Sprintf("%d arguments", fn.min)
+	}
+
+	return fmt.Sprintf("%d to %d arguments", fn.min, fn.max)
+}
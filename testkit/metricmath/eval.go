@@ -0,0 +1,326 @@
+package metricmath
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/alarm"
+)
+
+// TimeSeries is one series of an evaluated query, one value per period;
+// NaN is a missing datapoint.
+type TimeSeries struct {
+	Label  string
+	Values []float64
+}
+
+func (ts TimeSeries) with(fn func(i int, x float64) float64) TimeSeries {
+	out := TimeSeries{Label: ts.Label, Values: make([]float64, len(ts.Values))}
+	for i, x := range ts.Values {
+		out.Values[i] = fn(i, x)
+	}
+
+	return out
+}
+
+type kind int
+
+const (
+	kindScalar kind = iota
+	kindSeries
+	kindString
+	kindKeyword
+)
+
+func (k kind) String() string {
+	return [...]string{"number", "time series", "string", "keyword"}[k]
+}
+
+// value is an intermediate result. Arrays come from METRICS, brackets and
+// ANOMALY_DETECTION_BAND; aggregate functions combine their series rather
+// than reducing each to a scalar.
+type value struct {
+	kind   kind
+	num    float64
+	str    string
+	array  bool
+	series []TimeSeries
+}
+
+func scalar(x float64) value { return value{kind: kindScalar, num: x} }
+
+func series(ts TimeSeries) value { return value{kind: kindSeries, series: []TimeSeries{ts}} }
+
+func (v value) String() string {
+	switch v.kind {
+	case kindScalar:
+		return fmt.Sprint(v.num)
+	case kindString:
+		return fmt.Sprintf("%q", v.str)
+	case kindKeyword:
+		return v.str
+	}
+
+	return v.kind.String()
+}
+
+// at returns datapoint i of series s, or the scalar.
+func (v value) at(s, i int) float64 {
+	if v.kind == kindScalar {
+		return v.num
+	}
+
+	return v.series[s].Values[i]
+}
+
+// mapSeries applies fn to each series, or onScalar to a scalar.
+func (v value) mapSeries(fn func(TimeSeries) TimeSeries, onScalar func(float64) float64) (value, error) {
+	switch {
+	case v.kind == kindScalar && onScalar != nil:
+		return scalar(onScalar(v.num)), nil
+	case v.kind != kindSeries:
+		return value{}, fmt.Errorf("expected a time series, found %s", v.kind)
+	}
+	out := value{kind: kindSeries, array: v.array}
+	for _, ts := range v.series {
+		out.series = append(out.series, fn(ts))
+	}
+
+	return out, nil
+}
+
+// Evaluate computes every query of the alarm over n periods starting at
+// from. data holds the raw samples of each metric query, keyed by query id;
+// they are aggregated with the query's stat and period. Expressions are
+// evaluated datapoint by datapoint, a missing operand giving a missing
+// result, and a scalar result is repeated across the n periods.
+func (a Alarm) Evaluate(data map[string]alarm.Series, from time.Time, n int) (map[string][]TimeSeries, error) {
+	e := &evaluator{alarm: a, data: data, from: from, n: n, done: map[string]value{}, busy: map[string]bool{}}
+	for _, q := range a.Queries {
+		if q.Metric != nil {
+			e.period = time.Duration(q.Metric.Period) * time.Second
+			break
+		}
+	}
+	if e.period == 0 {
+		return nil, fmt.Errorf("alarm %s has no metric query to take the period from", a.Name)
+	}
+
+	out := map[string][]TimeSeries{}
+	for _, q := range a.Queries {
+		v, err := e.query(q.ID)
+		if err != nil {
+			return nil, err
+		}
+		if v.kind == kindScalar {
+			ts := TimeSeries{Values: make([]float64, n)}
+			for i := range ts.Values {
+				ts.Values[i] = v.num
+			}
+			v = series(ts)
+		}
+		out[q.ID] = v.series
+	}
+
+	return out, nil
+}
+
+type evaluator struct {
+	alarm  Alarm
+	data   map[string]alarm.Series
+	from   time.Time
+	n      int
+	period time.Duration
+	done   map[string]value
+	busy   map[string]bool
+}
+
+func (e *evaluator) query(id string) (value, error) {
+	if v, ok := e.done[id]; ok {
+		return v, nil
+	}
+	if e.busy[id] {
+		return value{}, fmt.Errorf("query %s references itself", id)
+	}
+	q, ok := e.alarm.Query(id)
+	if !ok {
+		return value{}, fmt.Errorf("no query with id %q", id)
+	}
+	e.busy[id] = true
+	defer delete(e.busy, id)
+
+	var v value
+	if q.Metric != nil {
+		s, ok := e.data[id]
+		if !ok {
+			return value{}, fmt.Errorf("no series for metric query %s", id)
+		}
+		values, err := alarm.Datapoints(s, e.from, time.Duration(q.Metric.Period)*time.Second, e.n, q.Metric.Stat)
+		if err != nil {
+			return value{}, fmt.Errorf("query %s: %w", id, err)
+		}
+		v = series(TimeSeries{Label: q.label(), Values: values})
+	} else {
+		root, err := Parse(q.Expression)
+		if err != nil {
+			return value{}, fmt.Errorf("query %s: %w", id, err)
+		}
+		if v, err = e.eval(root); err != nil {
+			return value{}, fmt.Errorf("query %s: %w", id, err)
+		}
+		if v.kind == kindSeries && len(v.series) == 1 {
+			v.series[0].Label = q.label()
+		}
+	}
+	e.done[id] = v
+
+	return v, nil
+}
+
+func (e *evaluator) eval(n Node) (value, error) {
+	switch n := n.(type) {
+	case Number:
+		return scalar(float64(n)), nil
+	case String:
+		return value{kind: kindString, str: string(n)}, nil
+	case Keyword:
+		return value{kind: kindKeyword, str: string(n)}, nil
+	case Ref:
+		return e.query(string(n))
+	case Array:
+		out := value{kind: kindSeries, array: true}
+		for _, x := range n {
+			v, err := e.eval(x)
+			if err != nil {
+				return value{}, err
+			}
+			if v.kind != kindSeries {
+				return value{}, fmt.Errorf("array elements must be time series, found %s", v.kind)
+			}
+			out.series = append(out.series, v.series...)
+		}
+		return out, nil
+	case Call:
+		fn, ok := functions[n.Func]
+		switch {
+		case !ok:
+			return value{}, fmt.Errorf("unknown function %s", n.Func)
+		case fn.eval == nil:
+			return value{}, fmt.Errorf("%s cannot be evaluated locally", n.Func)
+		case len(n.Args) < fn.min || fn.max >= 0 && len(n.Args) > fn.max:
+			return value{}, fmt.Errorf("%s: wrong number of arguments", n.Func)
+		}
+		args := make([]value, len(n.Args))
+		for i, x := range n.Args {
+			v, err := e.eval(x)
+			if err != nil {
+				return value{}, err
+			}
+			args[i] = v
+		}
+		return fn.eval(e, args)
+	case Unary:
+		x, err := e.eval(n.X)
+		if err != nil {
+			return value{}, err
+		}
+		return x.mapSeries(func(ts TimeSeries) TimeSeries {
+			return ts.with(func(i int, v float64) float64 { return -v })
+		}, func(v float64) float64 { return -v })
+	case Binary:
+		x, err := e.eval(n.X)
+		if err != nil {
+			return value{}, err
+		}
+		y, err := e.eval(n.Y)
+		if err != nil {
+			return value{}, err
+		}
+		return e.binary(n.Op, x, y)
+	}
+
+	return value{}, fmt.Errorf("cannot evaluate %s", n)
+}
+
+// binary applies op datapoint by datapoint. A scalar or single series
+// combines with each series of an array; two arrays cannot be combined.
+func (e *evaluator) binary(op string, x, y value) (value, error) {
+	for _, v := range []value{x, y} {
+		if v.kind != kindScalar && v.kind != kindSeries {
+			return value{}, fmt.Errorf("operator %s needs numbers or time series, found %s", op, v.kind)
+		}
+	}
+	fn := operatorFuncs[op]
+	if x.kind == kindScalar && y.kind == kindScalar {
+		return scalar(fn(x.num, y.num)), nil
+	}
+	if x.array && y.array {
+		return value{}, fmt.Errorf("operator %s cannot combine two arrays", op)
+	}
+
+	width := 1
+	out := value{kind: kindSeries}
+	for _, v := range []value{x, y} {
+		if v.array {
+			width, out.array = len(v.series), true
+		}
+	}
+	index := func(v value, s int) int {
+		if v.array {
+			return s
+		}
+		return 0
+	}
+	for s := 0; s < width; s++ {
+		ts := TimeSeries{Values: make([]float64, e.n)}
+		if x.kind == kindSeries {
+			ts.Label = x.series[index(x, s)].Label
+		} else {
+			ts.Label = y.series[index(y, s)].Label
+		}
+		for i := range ts.Values {
+			ts.Values[i] = fn(x.at(index(x, s), i), y.at(index(y, s), i))
+		}
+		out.series = append(out.series, ts)
+	}
+
+	return out, nil
+}
+
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// operatorFuncs implements the operators; NaN, a missing datapoint,
+// propagates through each of them, and dividing by zero gives one.
+var operatorFuncs = map[string]func(a, b float64) float64{
+	"+": func(a, b float64) float64 { return a + b },
+	"-": func(a, b float64) float64 { return a - b },
+	"*": func(a, b float64) float64 { return a * b },
+	"/": func(a, b float64) float64 {
+		if b == 0 {
+			return math.NaN()
+		}
+		return a / b
+	},
+	"^":  math.Pow,
+	"==": func(a, b float64) float64 { return cmp(a, b, a == b) },
+	"!=": func(a, b float64) float64 { return cmp(a, b, a != b) },
+	"<":  func(a, b float64) float64 { return cmp(a, b, a < b) },
+	"<=": func(a, b float64) float64 { return cmp(a, b, a <= b) },
+	">":  func(a, b float64) float64 { return cmp(a, b, a > b) },
+	">=": func(a, b float64) float64 { return cmp(a, b, a >= b) },
+	"&&": func(a, b float64) float64 { return cmp(a, b, a != 0 && b != 0) },
+	"||": func(a, b float64) float64 { return cmp(a, b, a != 0 || b != 0) },
+}
+
+func cmp(a, b float64, result bool) float64 {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.NaN()
+	}
+	return truth(result)
+}
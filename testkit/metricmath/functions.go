@@ -0,0 +1,358 @@
+package metricmath
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// function describes a metric math function: how many arguments it takes
+// (max -1 is unbounded) and, when it can be computed locally, how.
+type function struct {
+	min, max int
+	eval     func(e *evaluator, args []value) (value, error)
+}
+
+// functions is every function CloudWatch metric math documents. Those
+// without eval parse and check but cannot be evaluated. It is filled in by
+// init because METRICS evaluates queries, which look functions up.
+var functions map[string]function
+
+func init() {
+	functions = map[string]function{
+		"ABS":                    {1, 1, elementwise(math.Abs)},
+		"ANOMALY_DETECTION_BAND": {1, 2, band},
+		"AVG":                    {1, 1, aggregate(mean)},
+		"CEIL":                   {1, 1, elementwise(math.Ceil)},
+		"DATAPOINT_COUNT":        {1, 1, aggregate(func(v []float64) float64 { return float64(len(v)) })},
+		"DB_PERF_INSIGHTS":       {3, 3, nil},
+		"DIFF":                   {1, 1, diff(1)},
+		"DIFF_TIME":              {1, 1, nil},
+		"FILL":                   {2, 2, fill},
+		"FIRST":                  {1, 1, pick(false)},
+		"FLOOR":                  {1, 1, elementwise(math.Floor)},
+		"IF":                     {2, 3, ifFunc},
+		"INSIGHT_RULE_METRIC":    {2, 2, nil},
+		"LAMBDA":                 {1, -1, nil},
+		"LAST":                   {1, 1, pick(true)},
+		"LOG":                    {1, 1, elementwise(math.Log)},
+		"LOG10":                  {1, 1, elementwise(math.Log10)},
+		"MAX":                    {1, 1, aggregate(func(v []float64) float64 { sort.Float64s(v); return v[len(v)-1] })},
+		"METRIC_COUNT":           {1, 1, nil},
+		"METRICS":                {0, 1, metrics},
+		"MIN":                    {1, 1, aggregate(func(v []float64) float64 { sort.Float64s(v); return v[0] })},
+		"MINUTE":                 {1, 1, nil},
+		"HOUR":                   {1, 1, nil},
+		"DAY":                    {1, 1, nil},
+		"DATE":                   {1, 1, nil},
+		"MONTH":                  {1, 1, nil},
+		"YEAR":                   {1, 1, nil},
+		"EPOCH":                  {1, 1, nil},
+		"PERIOD":                 {1, 1, period},
+		"RATE":                   {1, 1, rate},
+		"REMOVE_EMPTY":           {1, 1, removeEmpty},
+		"RUNNING_SUM":            {1, 1, runningSum},
+		"SEARCH":                 {3, 3, nil},
+		"SERVICE_QUOTA":          {1, 1, nil},
+		"SLICE":                  {3, 3, nil},
+		"SORT":                   {3, 4, nil},
+		"STDDEV":                 {1, 1, aggregate(stddev)},
+		"SUM":                    {1, 1, aggregate(sum)},
+		"TIME_SERIES":            {1, 1, nil},
+	}
+}
+
+// functionNames returns the known function names, sorted.
+func functionNames() []string {
+	names := make([]string, 0, len(functions))
+	for n := range functions {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func sum(v []float64) float64 {
+	var s float64
+	for _, x := range v {
+		s += x
+	}
+	return s
+}
+
+func mean(v []float64) float64 { return sum(v) / float64(len(v)) }
+
+// stddev is the population standard deviation.
+func stddev(v []float64) float64 {
+	m := mean(v)
+	var s float64
+	for _, x := range v {
+		s += (x - m) * (x - m)
+	}
+	return math.Sqrt(s / float64(len(v)))
+}
+
+// present returns the values that are not missing.
+func present(v []float64) []float64 {
+	var out []float64
+	for _, x := range v {
+		if !math.IsNaN(x) {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+func elementwise(fn func(float64) float64) func(*evaluator, []value) (value, error) {
+	return func(e *evaluator, args []value) (value, error) {
+		return args[0].mapSeries(func(ts TimeSeries) TimeSeries {
+			return ts.with(func(i int, x float64) float64 { return fn(x) })
+		}, fn)
+	}
+}
+
+// aggregate builds SUM, AVG, MIN, MAX and the like. Given an array they
+// combine its series datapoint by datapoint; given a single series they
+// reduce it to a scalar. Missing datapoints are skipped.
+func aggregate(fn func([]float64) float64) func(*evaluator, []value) (value, error) {
+	return func(e *evaluator, args []value) (value, error) {
+		x := args[0]
+		switch {
+		case x.kind == kindScalar:
+			return x, nil
+		case x.kind != kindSeries:
+			return value{}, fmt.Errorf("expected a time series, found %s", x.kind)
+		case !x.array:
+			v := present(x.series[0].Values)
+			if len(v) == 0 {
+				return scalar(math.NaN()), nil
+			}
+			return scalar(fn(v)), nil
+		}
+		out := TimeSeries{Values: make([]float64, e.n)}
+		for i := range out.Values {
+			var v []float64
+			for _, ts := range x.series {
+				if !math.IsNaN(ts.Values[i]) {
+					v = append(v, ts.Values[i])
+				}
+			}
+			out.Values[i] = math.NaN()
+			if len(v) > 0 {
+				out.Values[i] = fn(v)
+			}
+		}
+		return series(out), nil
+	}
+}
+
+// band approximates the anomaly detection model with the mean plus or
+// minus k (default 2) standard deviations of the series. CloudWatch trains
+// a seasonal model instead, so only use it to exercise an alarm's wiring,
+// not to predict where the real band will be.
+func band(e *evaluator, args []value) (value, error) {
+	x := args[0]
+	if x.kind != kindSeries || x.array {
+		return value{}, fmt.Errorf("ANOMALY_DETECTION_BAND needs a single time series")
+	}
+	k := 2.0
+	if len(args) == 2 {
+		if args[1].kind != kindScalar {
+			return value{}, fmt.Errorf("ANOMALY_DETECTION_BAND width must be a number")
+		}
+		k = args[1].num
+	}
+	m, sd := math.NaN(), math.NaN()
+	if v := present(x.series[0].Values); len(v) > 0 {
+		m, sd = mean(v), stddev(v)
+	}
+	lower, upper := TimeSeries{Label: "lower"}, TimeSeries{Label: "upper"}
+	for range x.series[0].Values {
+		lower.Values = append(lower.Values, m-k*sd)
+		upper.Values = append(upper.Values, m+k*sd)
+	}
+
+	return value{kind: kindSeries, array: true, series: []TimeSeries{lower, upper}}, nil
+}
+
+// diff returns the change from the previous datapoint, divided by div.
+func diff(div float64) func(*evaluator, []value) (value, error) {
+	return func(e *evaluator, args []value) (value, error) {
+		if args[0].kind != kindSeries {
+			return value{}, fmt.Errorf("expected a time series, found %s", args[0].kind)
+		}
+		return args[0].mapSeries(func(ts TimeSeries) TimeSeries {
+			return ts.with(func(i int, x float64) float64 {
+				if i == 0 {
+					return math.NaN()
+				}
+				return (x - ts.Values[i-1]) / div
+			})
+		}, nil)
+	}
+}
+
+func rate(e *evaluator, args []value) (value, error) {
+	return diff(e.period.Seconds())(e, args)
+}
+
+func period(e *evaluator, args []value) (value, error) {
+	return scalar(e.period.Seconds()), nil
+}
+
+func runningSum(e *evaluator, args []value) (value, error) {
+	if args[0].kind != kindSeries {
+		return value{}, fmt.Errorf("expected a time series, found %s", args[0].kind)
+	}
+	return args[0].mapSeries(func(ts TimeSeries) TimeSeries {
+		var total float64
+		return ts.with(func(i int, x float64) float64 {
+			if !math.IsNaN(x) {
+				total += x
+			}
+			return total
+		})
+	}, nil)
+}
+
+// fill replaces missing datapoints with a number, the previous value
+// (REPEAT) or a straight line between the neighbouring values (LINEAR).
+// Leading and trailing gaps take the nearest value.
+func fill(e *evaluator, args []value) (value, error) {
+	x, mode := args[0], args[1]
+	if x.kind != kindSeries {
+		return x, nil
+	}
+	var fn func(ts TimeSeries) TimeSeries
+	switch {
+	case mode.kind == kindScalar || mode.kind == kindSeries && !mode.array:
+		fn = func(ts TimeSeries) TimeSeries {
+			return ts.with(func(i int, v float64) float64 {
+				if math.IsNaN(v) {
+					return mode.at(0, i)
+				}
+				return v
+			})
+		}
+	case mode.kind == kindKeyword && (mode.str == "REPEAT" || mode.str == "LINEAR"):
+		fn = func(ts TimeSeries) TimeSeries { return fillGaps(ts, mode.str == "LINEAR") }
+	default:
+		return value{}, fmt.Errorf("FILL needs a number, REPEAT or LINEAR, found %s", mode)
+	}
+
+	return x.mapSeries(fn, nil)
+}
+
+func fillGaps(ts TimeSeries, linear bool) TimeSeries {
+	prev := -1
+	return ts.with(func(i int, v float64) float64 {
+		if !math.IsNaN(v) {
+			prev = i
+			return v
+		}
+		next := -1
+		for j := i + 1; j < len(ts.Values); j++ {
+			if !math.IsNaN(ts.Values[j]) {
+				next = j
+				break
+			}
+		}
+		switch {
+		case prev < 0 && next < 0:
+			return v
+		case prev < 0:
+			return ts.Values[next]
+		case next < 0 || !linear:
+			return ts.Values[prev]
+		}
+		a, b := ts.Values[prev], ts.Values[next]
+		return a + (b-a)*float64(i-prev)/float64(next-prev)
+	})
+}
+
+// ifFunc is IF(condition, then[, else]). Where the condition is missing,
+// or false without an else, the datapoint is missing.
+func ifFunc(e *evaluator, args []value) (value, error) {
+	cond := args[0]
+	if cond.kind != kindScalar && (cond.kind != kindSeries || cond.array) {
+		return value{}, fmt.Errorf("IF condition must be a number or a single time series")
+	}
+	alt := scalar(math.NaN())
+	if len(args) == 3 {
+		alt = args[2]
+	}
+	for _, v := range []value{args[1], alt} {
+		if v.kind != kindScalar && (v.kind != kindSeries || v.array) {
+			return value{}, fmt.Errorf("IF branches must be numbers or single time series")
+		}
+	}
+	out := TimeSeries{Values: make([]float64, e.n)}
+	for i := range out.Values {
+		c := cond.at(0, i)
+		switch {
+		case math.IsNaN(c):
+			out.Values[i] = math.NaN()
+		case c != 0:
+			out.Values[i] = args[1].at(0, i)
+		default:
+			out.Values[i] = alt.at(0, i)
+		}
+	}
+
+	return series(out), nil
+}
+
+// metrics returns every query that fetches a metric, in query order,
+// optionally only those whose id contains the filter string.
+func metrics(e *evaluator, args []value) (value, error) {
+	filter := ""
+	if len(args) == 1 {
+		if args[0].kind != kindString {
+			return value{}, fmt.Errorf("METRICS filter must be a string")
+		}
+		filter = args[0].str
+	}
+	out := value{kind: kindSeries, array: true}
+	for _, q := range e.alarm.Queries {
+		if q.Metric == nil || !strings.Contains(q.ID, filter) {
+			continue
+		}
+		v, err := e.query(q.ID)
+		if err != nil {
+			return value{}, err
+		}
+		out.series = append(out.series, v.series...)
+	}
+
+	return out, nil
+}
+
+func pick(last bool) func(*evaluator, []value) (value, error) {
+	return func(e *evaluator, args []value) (value, error) {
+		x := args[0]
+		if x.kind != kindSeries || len(x.series) == 0 {
+			return value{}, fmt.Errorf("expected an array of time series, found %s", x.kind)
+		}
+		if last {
+			return series(x.series[len(x.series)-1]), nil
+		}
+		return series(x.series[0]), nil
+	}
+}
+
+func removeEmpty(e *evaluator, args []value) (value, error) {
+	x := args[0]
+	if x.kind != kindSeries {
+		return x, nil
+	}
+	out := value{kind: kindSeries, array: x.array}
+	for _, ts := range x.series {
+		if len(present(ts.Values)) > 0 {
+			out.series = append(out.series, ts)
+		}
+	}
+
+	return out, nil
+}
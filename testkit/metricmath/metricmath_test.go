@@ -0,0 +1,255 @@
+package metricmath
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/alarm"
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+var t0 = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"m2/m1*100", "((m2 / m1) * 100)"},
+		{"m1 + m2 * 2 ^ 3 ^ 2", "(m1 + (m2 * (2 ^ (3 ^ 2))))"},
+		{"-m1 > 0 AND m2 < 1 || e1 == 0", "(((-m1 > 0) && (m2 < 1)) || (e1 == 0))"},
+		{`SUM(METRICS("errors"))`, `SUM(METRICS("errors"))`},
+		{"FILL(m1, REPEAT)", "FILL(m1, REPEAT)"},
+		{"MAX([m1, m2, 1.5e3])", "MAX([m1, m2, 1500])"},
+		{"IF(m1 >= .5, m1, 0)", "IF((m1 >= 0.5), m1, 0)"},
+		{"METRICS()", "METRICS()"},
+	}
+	for _, tt := range tests {
+		n, err := Parse(tt.expr)
+		require.NoError(t, err, tt.expr)
+		assert.Equal(t, tt.want, n.String(), tt.expr)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		pos  int
+	}{
+		{"", 0},
+		{"m1 +", 4},
+		{"SUM(m1", 6},
+		{"SUM(m1 m2)", 7},
+		{"[m1, m2", 7},
+		{"m1 % 2", 3},
+		{`METRICS("x)`, 8},
+		{"m1 AND", 6},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.expr)
+		var serr *SyntaxError
+		require.True(t, errors.As(err, &serr), "%q: %v", tt.expr, err)
+		assert.Equal(t, tt.pos, serr.Pos, "%q: %v", tt.expr, err)
+	}
+}
+
+func TestRefs(t *testing.T) {
+	n, err := Parse("IF(m1 > 0, m2 / m1, FILL(e1, LINEAR))")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"m1", "m2", "e1"}, Refs(n))
+}
+
+// loadAlarms returns the error rate and anomaly alarms of the plan, which
+// check clean.
+func loadAlarms(t *testing.T) (errorRate, anomaly Alarm) {
+	t.Helper()
+	p, err := plan.Load("testdata/plan.json")
+	require.NoError(t, err)
+	require.Empty(t, CheckPlan(p), CheckPlan(p).String())
+	for _, a := range FromPlan(p) {
+		switch a.Name {
+		case "high-error-rate":
+			errorRate = a
+		case "request-anomaly":
+			anomaly = a
+		}
+	}
+	require.NotEmpty(t, errorRate.Queries)
+	require.NotEmpty(t, anomaly.Queries)
+
+	return errorRate, anomaly
+}
+
+func TestCheck(t *testing.T) {
+	errorRate, anomaly := loadAlarms(t)
+
+	tests := []struct {
+		name   string
+		alarm  Alarm
+		mutate func(a *Alarm)
+		rules  []string
+	}{
+		{"bad id", errorRate, func(a *Alarm) { a.Queries[1].ID = "M1"; a.Queries[0].Expression = "m2/M1*100" }, []string{RuleID}},
+		{"duplicate id", errorRate, func(a *Alarm) { a.Queries[2].ID = "m1"; a.Queries[0].Expression = "m1*100" }, []string{RuleID}},
+		{"both metric and expression", errorRate, func(a *Alarm) { a.Queries[1].Expression = "m2" }, []string{RuleQuery}},
+		{"syntax", errorRate, func(a *Alarm) { a.Queries[0].Expression = "m2/m1*" }, []string{RuleSyntax}},
+		{"unknown function", errorRate, func(a *Alarm) { a.Queries[0].Expression = "AVERAGE(m1)" }, []string{RuleFunction}},
+		{"arity", errorRate, func(a *Alarm) { a.Queries[0].Expression = "FILL(m1)" }, []string{RuleFunction}},
+		{"dangling reference", errorRate, func(a *Alarm) { a.Queries[0].Expression = "m3/m1*100" }, []string{RuleReference}},
+		{"cycle", errorRate, func(a *Alarm) {
+			a.Queries[0].Expression = "e2 + m1"
+			a.Queries = append(a.Queries, Query{ID: "e2", Expression: "e1 * 2"})
+		}, []string{RuleReference}},
+		{"no query returns data", errorRate, func(a *Alarm) { a.Queries[0].ReturnData = false }, []string{RuleReturnData}},
+		{"two queries return data", errorRate, func(a *Alarm) { a.Queries[1].ReturnData = true }, []string{RuleReturnData}},
+		{"band operator without threshold metric", errorRate, func(a *Alarm) {
+			a.ComparisonOperator = BandOperators[0]
+		}, []string{RuleThresholdMetric}},
+		{"threshold metric is not a band", anomaly, func(a *Alarm) { a.Queries[1].Expression = "m1 * 2" }, []string{RuleThresholdMetric}},
+		{"threshold metric missing", anomaly, func(a *Alarm) { a.ThresholdMetricID = "ad2" }, []string{RuleReturnData, RuleThresholdMetric}},
+		{"static operator with band", anomaly, func(a *Alarm) { a.ComparisonOperator = alarm.GreaterThanThreshold }, []string{RuleThresholdMetric}},
+		{"band does not return data", anomaly, func(a *Alarm) { a.Queries[1].ReturnData = false }, []string{RuleReturnData}},
+		{"module before the fix", anomaly, func(a *Alarm) {
+			a.Queries[0].ReturnData = false
+			a.Queries[1].Expression = "ANOMALY_DETECTION_FUNCTION(m1, 2)"
+		}, []string{RuleFunction, RuleReturnData, RuleThresholdMetric}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := tt.alarm
+			a.Queries = append([]Query(nil), a.Queries...)
+			tt.mutate(&a)
+			findings := Check(a)
+			var rules []string
+			for _, f := range findings {
+				assert.Equal(t, finding.High, f.Severity, f.String())
+				rules = append(rules, f.Rule)
+			}
+			assert.ElementsMatch(t, tt.rules, dedupe(rules), findings.String())
+		})
+	}
+}
+
+func dedupe(s []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, x := range s {
+		if !seen[x] {
+			seen[x] = true
+			out = append(out, x)
+		}
+	}
+
+	return out
+}
+
+func TestSuggest(t *testing.T) {
+	findings := Check(Alarm{Queries: []Query{
+		{ID: "m1", Metric: &Metric{Stat: "Sum", Period: 60}},
+		{ID: "ad1", Expression: "ANOMALY_DETECTION_FUNCTION(m1, 2)", ReturnData: true},
+	}})
+	require.NotEmpty(t, findings.ByRule(RuleFunction))
+	assert.Contains(t, findings.ByRule(RuleFunction)[0].Message, "did you mean ANOMALY_DETECTION_BAND?")
+}
+
+func loadSeries(t *testing.T) map[string]alarm.Series {
+	t.Helper()
+	requests, err := alarm.LoadSeries("testdata/requests.csv")
+	require.NoError(t, err)
+	errs, err := alarm.LoadSeries("testdata/errors.csv")
+	require.NoError(t, err)
+
+	return map[string]alarm.Series{"m1": requests, "m2": errs}
+}
+
+func assertValues(t *testing.T, want, got []float64, msg string) {
+	t.Helper()
+	require.Len(t, got, len(want), msg)
+	for i := range want {
+		if math.IsNaN(want[i]) {
+			assert.True(t, math.IsNaN(got[i]), "%s[%d] = %v, want missing", msg, i, got[i])
+			continue
+		}
+		assert.InDelta(t, want[i], got[i], 1e-9, "%s[%d]", msg, i)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	errorRate, _ := loadAlarms(t)
+	nan := math.NaN()
+
+	res, err := errorRate.Evaluate(loadSeries(t), t0, 4)
+	require.NoError(t, err)
+	assertValues(t, []float64{1000, 1000, 800, 1000}, res["m1"][0].Values, "m1")
+	assertValues(t, []float64{10, 80, nan, 40}, res["m2"][0].Values, "m2")
+	require.Len(t, res["e1"], 1)
+	assert.Equal(t, "Error Rate", res["e1"][0].Label)
+	assertValues(t, []float64{1, 8, nan, 4}, res["e1"][0].Values, "e1")
+
+	tests := []struct {
+		expr string
+		want []float64
+	}{
+		{"FILL(m2, 0)", []float64{10, 80, 0, 40}},
+		{"FILL(m2, REPEAT)", []float64{10, 80, 80, 40}},
+		{"FILL(m2, LINEAR)", []float64{10, 80, 60, 40}},
+		{"SUM(METRICS())", []float64{1010, 1080, 800, 1040}},
+		{"MAX([m1, m2 * 20])", []float64{1000, 1600, 800, 1000}},
+		{"SUM(m2)", []float64{130, 130, 130, 130}},
+		{"AVG(m1)", []float64{950, 950, 950, 950}},
+		{"IF(m2 > 20, 1, 0)", []float64{0, 1, nan, 1}},
+		{"IF(m2 > 20, m2)", []float64{nan, 80, nan, 40}},
+		{"DIFF(m1)", []float64{nan, 0, -200, 200}},
+		{"RATE(m1)", []float64{nan, 0, -200.0 / 300, 200.0 / 300}},
+		{"RUNNING_SUM(m2)", []float64{10, 90, 90, 130}},
+		{"PERIOD(m1)", []float64{300, 300, 300, 300}},
+		{"m1 / 0", []float64{nan, nan, nan, nan}},
+		{"-ABS(m2 - 50) + 2^2", []float64{-36, -26, nan, -6}},
+	}
+	for _, tt := range tests {
+		a := errorRate
+		a.Queries = append([]Query(nil), a.Queries...)
+		a.Queries[0].Expression = tt.expr
+		res, err := a.Evaluate(loadSeries(t), t0, 4)
+		require.NoError(t, err, tt.expr)
+		require.Len(t, res["e1"], 1, tt.expr)
+		assertValues(t, tt.want, res["e1"][0].Values, tt.expr)
+	}
+}
+
+func TestEvaluateBand(t *testing.T) {
+	_, anomaly := loadAlarms(t)
+	res, err := anomaly.Evaluate(loadSeries(t), t0, 4)
+	require.NoError(t, err)
+	require.Len(t, res["ad1"], 2)
+
+	// m1 is 1000, 1000, 800, 1000: mean 950, standard deviation 86.6.
+	sd := math.Sqrt(7500)
+	assertValues(t, []float64{950 - 2*sd, 950 - 2*sd, 950 - 2*sd, 950 - 2*sd}, res["ad1"][0].Values, "lower")
+	assertValues(t, []float64{950 + 2*sd, 950 + 2*sd, 950 + 2*sd, 950 + 2*sd}, res["ad1"][1].Values, "upper")
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	errorRate, _ := loadAlarms(t)
+	for _, expr := range []string{
+		`SEARCH("{AWS/ApplicationELB} RequestCount", "Sum", 300)`,
+		"[m1, m2] + [m1, m2]",
+		"FILL(m2, NEAREST)",
+		"e1 + 1",
+	} {
+		a := errorRate
+		a.Queries = append([]Query(nil), a.Queries...)
+		a.Queries[0].Expression = expr
+		_, err := a.Evaluate(loadSeries(t), t0, 4)
+		assert.Error(t, err, expr)
+	}
+
+	_, err := errorRate.Evaluate(map[string]alarm.Series{"m1": nil}, t0, 4)
+	assert.ErrorContains(t, err, "no series for metric query m2")
+}
@@ -0,0 +1,304 @@
+// Package metricmath parses, checks and evaluates the CloudWatch metric math
+// used by the metric_query blocks of a metric alarm:
+//
+//	IF(m1 > 0, 100 * FILL(m2, 0) / m1, 0)
+//
+// Expressions combine query ids, numbers, strings, arrays and function
+// calls with the arithmetic (+ - * / ^), comparison (== != < <= > >=) and
+// logical (AND, &&, OR, ||) operators. Check validates the queries of an
+// alarm the way PutMetricAlarm would, and Alarm.Evaluate computes every
+// query from fixture series.
+package metricmath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SyntaxError reports where an expression fails to parse.
+type SyntaxError struct {
+	// Pos is the byte offset of the offending token.
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("metric math: %s at offset %d", e.Msg, e.Pos)
+}
+
+// Node is a node of a parsed expression.
+type Node interface {
+	String() string
+}
+
+// Number is a numeric literal.
+type Number float64
+
+// String is a double-quoted string literal, used by METRICS and SEARCH.
+type String string
+
+// Ref references another query by id.
+type Ref string
+
+// Keyword is a bare upper-case word passed to a function, such as the
+// REPEAT and LINEAR modes of FILL.
+type Keyword string
+
+// Array is a bracketed list such as [m1, m2].
+type Array []Node
+
+// Call is a function call.
+type Call struct {
+	Func string
+	Args []Node
+}
+
+// Unary is a negation.
+type Unary struct {
+	Op string
+	X  Node
+}
+
+// Binary is an arithmetic, comparison or logical operation. AND and OR are
+// normalized to && and ||.
+type Binary struct {
+	Op   string
+	X, Y Node
+}
+
+func (n Number) String() string { return strconv.FormatFloat(float64(n), 'g', -1, 64) }
+
+func (s String) String() string { return strconv.Quote(string(s)) }
+
+func (r Ref) String() string { return string(r) }
+
+func (k Keyword) String() string { return string(k) }
+
+func (a Array) String() string { return "[" + join(a) + "]" }
+
+func (c Call) String() string { return c.Func + "(" + join(c.Args) + ")" }
+
+func (u Unary) String() string { return u.Op + u.X.String() }
+
+func (b Binary) String() string { return "(" + b.X.String() + " " + b.Op + " " + b.Y.String() + ")" }
+
+func join(nodes []Node) string {
+	s := make([]string, len(nodes))
+	for i, n := range nodes {
+		s[i] = n.String()
+	}
+
+	return strings.Join(s, ", ")
+}
+
+// Parse parses an expression. Errors are *SyntaxError; function names are
+// not checked here, see Check.
+func Parse(src string) (Node, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s", t)}
+	}
+
+	return root, nil
+}
+
+// Refs returns the query ids n references, in order of first use.
+func Refs(n Node) []string {
+	var out []string
+	seen := map[string]bool{}
+	Walk(n, func(n Node) {
+		if r, ok := n.(Ref); ok && !seen[string(r)] {
+			seen[string(r)] = true
+			out = append(out, string(r))
+		}
+	})
+
+	return out
+}
+
+// Walk calls fn for n and each of its descendants, parents first.
+func Walk(n Node, fn func(Node)) {
+	fn(n)
+	switch n := n.(type) {
+	case Array:
+		for _, x := range n {
+			Walk(x, fn)
+		}
+	case Call:
+		for _, x := range n.Args {
+			Walk(x, fn)
+		}
+	case Unary:
+		Walk(n.X, fn)
+	case Binary:
+		Walk(n.X, fn)
+		Walk(n.Y, fn)
+	}
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// binary parses a left-associative chain of the operators in ops, with
+// operands parsed by operand.
+func (p *parser) binary(operand func() (Node, error), ops map[string]string) (Node, error) {
+	x, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := ops[p.peek().text]
+		if !ok || p.peek().kind == tokString {
+			return x, nil
+		}
+		p.next()
+		y, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		x = Binary{Op: op, X: x, Y: y}
+	}
+}
+
+func (p *parser) or() (Node, error) {
+	return p.binary(p.and, map[string]string{"OR": "||", "||": "||"})
+}
+
+func (p *parser) and() (Node, error) {
+	return p.binary(p.comparison, map[string]string{"AND": "&&", "&&": "&&"})
+}
+
+func (p *parser) comparison() (Node, error) {
+	return p.binary(p.sum, map[string]string{"==": "==", "!=": "!=", "<": "<", "<=": "<=", ">": ">", ">=": ">="})
+}
+
+func (p *parser) sum() (Node, error) {
+	return p.binary(p.product, map[string]string{"+": "+", "-": "-"})
+}
+
+func (p *parser) product() (Node, error) {
+	return p.binary(p.power, map[string]string{"*": "*", "/": "/"})
+}
+
+// power is right-associative: 2^3^2 is 2^(3^2).
+func (p *parser) power() (Node, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind == tokOp && t.text == "^" {
+		p.next()
+		y, err := p.power()
+		if err != nil {
+			return nil, err
+		}
+		return Binary{Op: "^", X: x, Y: y}, nil
+	}
+
+	return x, nil
+}
+
+func (p *parser) unary() (Node, error) {
+	if t := p.peek(); t.kind == tokOp && t.text == "-" {
+		p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return Unary{Op: "-", X: x}, nil
+	}
+
+	return p.primary()
+}
+
+func (p *parser) primary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("bad number %s", t.text)}
+		}
+		return Number(v), nil
+	case tokString:
+		return String(t.text), nil
+	case tokLParen:
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != tokRParen {
+			return nil, &SyntaxError{Pos: c.pos, Msg: fmt.Sprintf("expected ) but found %s", c)}
+		}
+		return x, nil
+	case tokLBracket:
+		items, err := p.list(tokRBracket)
+		if err != nil {
+			return nil, err
+		}
+		return Array(items), nil
+	case tokWord:
+		if p.peek().kind == tokLParen {
+			p.next()
+			args, err := p.list(tokRParen)
+			if err != nil {
+				return nil, err
+			}
+			return Call{Func: t.text, Args: args}, nil
+		}
+		if c := t.text[0]; c >= 'a' && c <= 'z' {
+			return Ref(t.text), nil
+		}
+		if t.text == "AND" || t.text == "OR" {
+			break
+		}
+		return Keyword(t.text), nil
+	}
+
+	return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s", t)}
+}
+
+// list parses comma-separated expressions up to the closing token, which
+// has already been opened.
+func (p *parser) list(closing tokenKind) ([]Node, error) {
+	var out []Node
+	if p.peek().kind == closing {
+		p.next()
+		return out, nil
+	}
+	for {
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, x)
+		switch t := p.next(); t.kind {
+		case tokComma:
+		case closing:
+			return out, nil
+		default:
+			return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("expected , or %s but found %s", token{kind: closing}, t)}
+		}
+	}
+}
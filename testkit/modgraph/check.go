@@ -0,0 +1,263 @@
+package modgraph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	version "github.com/hashicorp/go-version"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+)
+
+// Rule identifiers reported by Check.
+const (
+	RuleCycle = "modgraph-cycle"
+	// RuleMissing is a relative source naming no module of the repository.
+	RuleMissing = "modgraph-missing-module"
+	// RuleLocalVersion is a version argument on a relative source, which
+	// Terraform rejects.
+	RuleLocalVersion = "modgraph-local-version"
+	// RuleConflict is a module whose composition no Terraform or provider
+	// release satisfies.
+	RuleConflict = "modgraph-version-conflict"
+	// RuleRequiredVersion is a required_version that admits Terraform
+	// releases a called module rejects.
+	RuleRequiredVersion = "modgraph-required-version"
+	RuleConstraint      = "modgraph-constraint"
+)
+
+// Check reports cycles, broken module calls and version constraints that
+// cannot hold together in a composition. Findings are addressed by module
+// name; Path is the module block or constraint.
+func Check(g *Graph) finding.List {
+	var findings finding.List
+	add := func(s finding.Severity, rule, address, path, format string, args ...interface{}) {
+		findings = append(findings, finding.Finding{Severity: s, Rule: rule, Address: address, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, cycle := range g.Cycles() {
+		add(finding.High, RuleCycle, cycle[0], "", "modules call each other in a cycle: %s", strings.Join(append(cycle, cycle[0]), " -> "))
+	}
+
+	for _, name := range g.Names() {
+		m := g.Modules[name]
+		for _, c := range m.Calls {
+			path := "module." + c.Name
+			if !c.Local() {
+				continue
+			}
+			if c.Version != "" {
+				add(finding.High, RuleLocalVersion, name, path+".version", "%s: version %q cannot be used with the relative source %q; local modules have no versions", c.Pos, c.Version, c.Source)
+			}
+			if _, ok := g.Modules[c.Module]; c.Module != "" && !ok {
+				add(finding.High, RuleMissing, name, path+".source", "%s: source %q names no module under the modules directory", c.Pos, c.Source)
+			}
+		}
+	}
+
+	constraints := map[string]constraintSet{}
+	for _, name := range g.Names() {
+		constraints[name] = g.constraints(name, add)
+	}
+	for _, name := range g.Names() {
+		set := constraints[name]
+		for _, key := range set.keys() {
+			if satisfiable(set[key]) {
+				continue
+			}
+			// Report the conflict where it first appears, not in every
+			// module above.
+			inherited := false
+			for _, dep := range g.Dependencies(name) {
+				if deps := constraints[dep][key]; len(deps) > 0 && !satisfiable(deps) {
+					inherited = true
+				}
+			}
+			if !inherited {
+				add(finding.High, RuleConflict, name, constraintPath(key), "no %s release satisfies %s", subject(key), set[key])
+			}
+		}
+
+		own := set.own(name, "terraform")
+		if own == nil || !satisfiable(set["terraform"]) {
+			continue
+		}
+		if v, by := firstRejected(own, set["terraform"]); v != nil {
+			add(finding.Medium, RuleRequiredVersion, name, "required_version", "required_version %q allows Terraform %s, but %s", own.raw, v, by)
+		}
+	}
+	findings.Sort()
+
+	return findings
+}
+
+// constraint is a version constraint and the module that declares it.
+type constraint struct {
+	module string
+	raw    string
+	parsed version.Constraints
+}
+
+func (c constraint) String() string {
+	return fmt.Sprintf("%q (%s)", c.raw, c.module)
+}
+
+// constraints lists the constraints of one kind across a composition.
+type constraints []constraint
+
+func (cs constraints) String() string {
+	parts := make([]string, len(cs))
+	for i, c := range cs {
+		parts[i] = c.String()
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// constraintSet holds the constraints of a module and everything it
+// calls, by "terraform" or provider source address.
+type constraintSet map[string]constraints
+
+func (s constraintSet) keys() []string {
+	keys := make([]string, 0, len(s))
+	for k := range s {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// own returns the constraint module declares itself for key.
+func (s constraintSet) own(module, key string) *constraint {
+	for _, c := range s[key] {
+		if c.module == module {
+			return &c
+		}
+	}
+
+	return nil
+}
+
+// constraints collects the version constraints of name and its
+// dependencies. Constraints that do not parse are reported with add and
+// skipped.
+func (g *Graph) constraints(name string, add func(finding.Severity, string, string, string, string, ...interface{})) constraintSet {
+	set := constraintSet{}
+	collect := func(module, key, raw string, report bool) {
+		if raw == "" {
+			return
+		}
+		parsed, err := version.NewConstraint(raw)
+		if err != nil {
+			if report {
+				add(finding.High, RuleConstraint, module, constraintPath(key), "%v", err)
+			}
+			return
+		}
+		set[key] = append(set[key], constraint{module, raw, parsed})
+	}
+	for _, module := range append([]string{name}, g.AllDependencies(name)...) {
+		m := g.Modules[module]
+		report := module == name
+		collect(module, "terraform", m.RequiredVersion, report)
+		sources := make([]string, 0, len(m.Providers))
+		for source := range m.Providers {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+		for _, source := range sources {
+			collect(module, source, m.Providers[source], report)
+		}
+	}
+
+	return set
+}
+
+func constraintPath(key string) string {
+	if key == "terraform" {
+		return "required_version"
+	}
+
+	return "required_providers." + key
+}
+
+func subject(key string) string {
+	if key == "terraform" {
+		return "Terraform"
+	}
+
+	return key
+}
+
+// satisfiable reports whether some release meets every constraint in cs.
+func satisfiable(cs constraints) bool {
+	for _, v := range candidates(cs) {
+		if meets(v, cs) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// firstRejected returns the lowest release own allows that a constraint
+// in all rejects, and names the first such constraint.
+func firstRejected(own *constraint, all constraints) (*version.Version, string) {
+	for _, v := range candidates(all) {
+		if !own.parsed.Check(v) {
+			continue
+		}
+		for _, c := range all {
+			if !c.parsed.Check(v) {
+				return v, fmt.Sprintf("%s requires %q", c.module, c.raw)
+			}
+		}
+	}
+
+	return nil, ""
+}
+
+func meets(v *version.Version, cs constraints) bool {
+	for _, c := range cs {
+		if !c.parsed.Check(v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// candidates returns, in ascending order, the releases at and just past
+// each version the constraints name: 0.0.0, then each version, its next
+// patch, minor and major release. Any range the constraints leave open
+// contains one of them.
+func candidates(cs constraints) []*version.Version {
+	seen := map[string]bool{}
+	var out []*version.Version
+	addVersion := func(major, minor, patch int64) {
+		v := version.Must(version.NewVersion(fmt.Sprintf("%d.%d.%d", major, minor, patch)))
+		if !seen[v.String()] {
+			seen[v.String()] = true
+			out = append(out, v)
+		}
+	}
+	addVersion(0, 0, 0)
+	for _, c := range cs {
+		for _, part := range c.parsed {
+			v, err := version.NewVersion(strings.TrimLeft(part.String(), "<>=!~ "))
+			if err != nil {
+				continue
+			}
+			s := v.Segments64()
+			addVersion(s[0], s[1], s[2])
+			addVersion(s[0], s[1], s[2]+1)
+			addVersion(s[0], s[1]+1, 0)
+			addVersion(s[0]+1, 0, 0)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LessThan(out[j]) })
+
+	return out
+}
@@ -0,0 +1,178 @@
+package modgraph
+
+import (
+	"sort"
+)
+
+// Graph is the modules of a repository and the calls between them.
+type Graph struct {
+	Modules map[string]*Module
+}
+
+// Edge is a module calling another repository module, through one or
+// more module blocks.
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Calls are the labels of the module blocks, sorted.
+	Calls []string `json:"calls"`
+}
+
+// Names returns the module names, sorted.
+func (g *Graph) Names() []string {
+	names := make([]string, 0, len(g.Modules))
+	for name := range g.Modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Edges returns the calls between repository modules, one edge per
+// caller and callee, sorted by caller then callee. Calls to a directory
+// that is not a module are left out; Check reports them.
+func (g *Graph) Edges() []Edge {
+	var out []Edge
+	for _, name := range g.Names() {
+		byTarget := map[string]*Edge{}
+		var targets []string
+		for _, c := range g.Modules[name].Calls {
+			if _, ok := g.Modules[c.Module]; !ok {
+				continue
+			}
+			e := byTarget[c.Module]
+			if e == nil {
+				e = &Edge{From: name, To: c.Module}
+				byTarget[c.Module] = e
+				targets = append(targets, c.Module)
+			}
+			e.Calls = append(e.Calls, c.Name)
+		}
+		sort.Strings(targets)
+		for _, t := range targets {
+			out = append(out, *byTarget[t])
+		}
+	}
+
+	return out
+}
+
+// Dependencies returns the repository modules name calls directly,
+// sorted.
+func (g *Graph) Dependencies(name string) []string {
+	var out []string
+	for _, e := range g.Edges() {
+		if e.From == name {
+			out = append(out, e.To)
+		}
+	}
+
+	return out
+}
+
+// Dependents returns the modules that call name directly, sorted.
+func (g *Graph) Dependents(name string) []string {
+	var out []string
+	for _, e := range g.Edges() {
+		if e.To == name {
+			out = append(out, e.From)
+		}
+	}
+
+	return out
+}
+
+// AllDependencies returns every module name calls, directly or through
+// other modules, sorted.
+func (g *Graph) AllDependencies(name string) []string {
+	return g.closure(name, g.Dependencies)
+}
+
+// AllDependents returns every module that calls name, directly or
+// through other modules, sorted: what a change to name can break.
+func (g *Graph) AllDependents(name string) []string {
+	return g.closure(name, g.Dependents)
+}
+
+func (g *Graph) closure(name string, next func(string) []string) []string {
+	seen := map[string]bool{name: true}
+	var out []string
+	queue := []string{name}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, m := range next(n) {
+			if !seen[m] {
+				seen[m] = true
+				out = append(out, m)
+				queue = append(queue, m)
+			}
+		}
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// Cycles returns the groups of modules that call each other, each sorted
+// and rotated to start at its first module, and the groups sorted. A
+// module calling itself is a cycle of one.
+func (g *Graph) Cycles() [][]string {
+	// Tarjan's strongly connected components.
+	index := map[string]int{}
+	low := map[string]int{}
+	onStack := map[string]bool{}
+	var stack []string
+	var out [][]string
+	var connect func(n string)
+	connect = func(n string) {
+		index[n] = len(index)
+		low[n] = index[n]
+		stack = append(stack, n)
+		onStack[n] = true
+		for _, m := range g.Dependencies(n) {
+			if _, ok := index[m]; !ok {
+				connect(m)
+				low[n] = min(low[n], low[m])
+			} else if onStack[m] {
+				low[n] = min(low[n], index[m])
+			}
+		}
+		if low[n] != index[n] {
+			return
+		}
+		var component []string
+		for {
+			m := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[m] = false
+			component = append(component, m)
+			if m == n {
+				break
+			}
+		}
+		if len(component) > 1 || g.calls(n, n) {
+			sort.Strings(component)
+			out = append(out, component)
+		}
+	}
+	for _, n := range g.Names() {
+		if _, ok := index[n]; !ok {
+			connect(n)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i][0] < out[j][0] })
+
+	return out
+}
+
+func (g *Graph) calls(from, to string) bool {
+	for _, m := range g.Dependencies(from) {
+		if m == to {
+			return true
+		}
+	}
+
+	return false
+}
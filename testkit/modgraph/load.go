@@ -0,0 +1,226 @@
+// Package modgraph builds the dependency graph of the modules in this
+// repository from their module blocks: bananalab-platform composes
+// aws-vpc, aws-ec2-asg and others, aws-tgw embeds aws-vpc, and the
+// solution module calls a dozen modules through relative source paths.
+// Graph answers who depends on a module, renders the graph as DOT,
+// Mermaid or JSON, and Check reports cycles, calls to missing modules and
+// Terraform or provider version constraints that no release satisfies
+// across a composition.
+package modgraph
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Module is a directory of Terraform files directly under the modules
+// root.
+type Module struct {
+	Name string `json:"name"`
+	// RequiredVersion is the terraform required_version constraint, empty
+	// when the module sets none.
+	RequiredVersion string `json:"required_version,omitempty"`
+	// Providers maps provider source addresses, such as hashicorp/aws, to
+	// their version constraints.
+	Providers map[string]string `json:"providers,omitempty"`
+	Calls     []Call            `json:"calls,omitempty"`
+}
+
+// Call is a module block.
+type Call struct {
+	// Name is the block label, as in module "vpc".
+	Name    string `json:"name"`
+	Source  string `json:"source"`
+	Version string `json:"version,omitempty"`
+	// Module is the repository module a relative Source points to, empty
+	// for registry and remote sources.
+	Module string `json:"module,omitempty"`
+	// Pos is where the block starts, as file:line relative to the
+	// modules root.
+	Pos string `json:"pos"`
+}
+
+// Local reports whether the call's source is a relative path.
+func (c Call) Local() bool {
+	return strings.HasPrefix(c.Source, "./") || strings.HasPrefix(c.Source, "../")
+}
+
+var fileSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "module", LabelNames: []string{"name"}},
+		{Type: "terraform"},
+	},
+}
+
+var moduleSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "source", Required: true},
+		{Name: "version"},
+	},
+}
+
+var terraformSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{{Name: "required_version"}},
+	Blocks:     []hcl.BlockHeaderSchema{{Type: "required_providers"}},
+}
+
+// Load parses the .tf files of every directory directly under root,
+// such as the repository's modules directory. Examples and test
+// configurations below a module are not modules of their own.
+func Load(root string) (*Graph, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	parser := hclparse.NewParser()
+	g := &Graph{Modules: map[string]*Module{}}
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		files, err := filepath.Glob(filepath.Join(root, e.Name(), "*.tf"))
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			continue
+		}
+		m := &Module{Name: e.Name()}
+		for _, file := range files {
+			if err := m.parse(parser, root, file); err != nil {
+				return nil, err
+			}
+		}
+		sort.SliceStable(m.Calls, func(i, j int) bool { return m.Calls[i].Name < m.Calls[j].Name })
+		g.Modules[m.Name] = m
+	}
+
+	return g, nil
+}
+
+// parse adds the module blocks and version constraints of file to m.
+func (m *Module) parse(parser *hclparse.Parser, root, file string) error {
+	f, diags := parser.ParseHCLFile(file)
+	if diags.HasErrors() {
+		return diags
+	}
+	content, _, diags := f.Body.PartialContent(fileSchema)
+	if diags.HasErrors() {
+		return diags
+	}
+	rel, _ := filepath.Rel(root, file)
+	for _, block := range content.Blocks {
+		switch block.Type {
+		case "module":
+			attrs, _, diags := block.Body.PartialContent(moduleSchema)
+			if diags.HasErrors() {
+				return diags
+			}
+			c := Call{Name: block.Labels[0], Pos: fmt.Sprintf("%s:%d", filepath.ToSlash(rel), block.DefRange.Start.Line)}
+			if c.Source, diags = stringAttr(attrs.Attributes["source"]); diags.HasErrors() {
+				return diags
+			}
+			if c.Version, diags = stringAttr(attrs.Attributes["version"]); diags.HasErrors() {
+				return diags
+			}
+			if c.Local() {
+				// A source below the module is one of its own directories,
+				// not a repository module.
+				if target := path.Join(m.Name, c.Source); !strings.Contains(target, "/") && target != "." && target != ".." {
+					c.Module = target
+				}
+			}
+			m.Calls = append(m.Calls, c)
+		case "terraform":
+			attrs, _, diags := block.Body.PartialContent(terraformSchema)
+			if diags.HasErrors() {
+				return diags
+			}
+			if v, diags := stringAttr(attrs.Attributes["required_version"]); diags.HasErrors() {
+				return diags
+			} else if v != "" {
+				m.RequiredVersion = v
+			}
+			for _, rp := range attrs.Blocks {
+				providers, diags := rp.Body.JustAttributes()
+				if diags.HasErrors() {
+					return diags
+				}
+				for name, attr := range providers {
+					source, version, diags := provider(name, attr)
+					if diags.HasErrors() {
+						return diags
+					}
+					if m.Providers == nil {
+						m.Providers = map[string]string{}
+					}
+					m.Providers[source] = version
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// stringAttr evaluates a literal string attribute, returning "" when attr
+// is nil.
+func stringAttr(attr *hcl.Attribute) (string, hcl.Diagnostics) {
+	if attr == nil {
+		return "", nil
+	}
+	v, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() {
+		return "", diags
+	}
+	if v.IsNull() || v.Type() != cty.String {
+		return "", hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("%s must be a string", attr.Name),
+			Subject:  attr.Range.Ptr(),
+		}}
+	}
+
+	return v.AsString(), nil
+}
+
+// provider returns the source and version constraint of a
+// required_providers entry. An entry that is a bare string is the
+// legacy version-only form, whose source is hashicorp/NAME.
+func provider(name string, attr *hcl.Attribute) (string, string, hcl.Diagnostics) {
+	source := "hashicorp/" + name
+	v, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() {
+		return "", "", diags
+	}
+	switch {
+	case v.Type() == cty.String:
+		return source, v.AsString(), nil
+	case v.Type().IsObjectType():
+		if v.Type().HasAttribute("source") {
+			if s := v.GetAttr("source"); s.Type() == cty.String && !s.IsNull() {
+				source = strings.TrimPrefix(strings.ToLower(s.AsString()), "registry.terraform.io/")
+			}
+		}
+		if v.Type().HasAttribute("version") {
+			if s := v.GetAttr("version"); s.Type() == cty.String && !s.IsNull() {
+				return source, s.AsString(), nil
+			}
+		}
+		return source, "", nil
+	}
+
+	return "", "", hcl.Diagnostics{{
+		Severity: hcl.DiagError,
+		Summary:  fmt.Sprintf("required_providers entry %s must be an object", name),
+		Subject:  attr.Range.Ptr(),
+	}}
+}
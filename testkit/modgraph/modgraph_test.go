@@ -0,0 +1,128 @@
+package modgraph
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan/plantest"
+)
+
+// modulesDir is the repository's modules, whose graph the tests pin.
+const modulesDir = "../../modules"
+
+func load(t *testing.T, root string) *Graph {
+	t.Helper()
+	g, err := Load(root)
+	require.NoError(t, err)
+
+	return g
+}
+
+func TestLoad(t *testing.T) {
+	g := load(t, modulesDir)
+
+	platform := g.Modules["bananalab-platform"]
+	require.NotNil(t, platform)
+	assert.Equal(t, "~>1.5.0", platform.RequiredVersion)
+	assert.Equal(t, map[string]string{"hashicorp/aws": "~>5.0"}, platform.Providers)
+	assert.Equal(t, []string{"aws-ec2-asg", "aws-ecs-cluster", "aws-https-alb", "aws-s3-bucket", "aws-vpc"}, g.Dependencies("bananalab-platform"))
+
+	// aws-vpc calls a registry module, which is not a graph edge.
+	vpc := g.Modules["aws-vpc"]
+	require.Len(t, vpc.Calls, 1)
+	assert.Equal(t, Call{Name: "subnet_addrs", Source: "hashicorp/subnets/cidr", Version: "~> 1.0", Pos: "aws-vpc/main.tf:18"}, vpc.Calls[0])
+	assert.False(t, vpc.Calls[0].Local())
+	assert.Empty(t, g.Dependencies("aws-vpc"))
+
+	// The log bucket module block of aws-https-alb is commented out.
+	assert.Empty(t, g.Dependencies("aws-https-alb"))
+
+	assert.Equal(t, []string{"aws-bedrock-guardrail", "aws-bedrock-model-invocation-logging", "aws-budget", "aws-cloudwatch-alarm", "aws-iam-policy", "aws-iam-role", "aws-kms-key", "aws-s3-bucket", "aws-security-group", "aws-sns-topic", "aws-vpc-endpoint"}, g.Dependencies("solution-aws-bedrock-mgmt-runtime"))
+}
+
+func TestDependents(t *testing.T) {
+	g := load(t, modulesDir)
+	assert.Equal(t, []string{"aws-tgw", "bananalab-platform"}, g.Dependents("aws-vpc"))
+	assert.Equal(t, []string{"bananalab-platform", "solution-aws-bedrock-mgmt-runtime"}, g.AllDependents("aws-s3-bucket"))
+	assert.Empty(t, g.Dependents("bananalab-platform"))
+
+	broken := load(t, "testdata/broken")
+	assert.Equal(t, []string{"c", "e", "f"}, broken.Dependents("d"))
+	assert.Equal(t, []string{"b", "c", "f"}, broken.AllDependents("a"))
+	assert.Equal(t, []string{"a", "b", "d"}, broken.AllDependencies("c"))
+}
+
+func TestCycles(t *testing.T) {
+	assert.Empty(t, load(t, modulesDir).Cycles())
+	assert.Equal(t, [][]string{{"a", "b"}}, load(t, "testdata/broken").Cycles())
+}
+
+func TestRender(t *testing.T) {
+	g := load(t, modulesDir).Subgraph("aws-tgw")
+	assert.Equal(t, []string{"aws-tgw", "aws-vpc"}, g.Names())
+
+	assert.Equal(t, `digraph modules {
+	rankdir=LR;
+	node [shape=box];
+	"aws-tgw";
+	"aws-vpc";
+	"aws-tgw" -> "aws-vpc" [label="vpc"];
+}
+`, g.DOT())
+
+	assert.Equal(t, `flowchart LR
+    aws_tgw["aws-tgw"]
+    aws_vpc["aws-vpc"]
+    aws_tgw -->|vpc| aws_vpc
+`, g.Mermaid())
+
+	data, err := g.JSON()
+	require.NoError(t, err)
+	var doc struct {
+		Modules []Module   `json:"modules"`
+		Edges   []Edge     `json:"edges"`
+		Cycles  [][]string `json:"cycles"`
+	}
+	require.NoError(t, json.Unmarshal(data, &doc))
+	require.Len(t, doc.Modules, 2)
+	assert.Equal(t, "aws-tgw", doc.Modules[0].Name)
+	assert.Equal(t, []Call{{Name: "vpc", Source: "../aws-vpc", Module: "aws-vpc", Pos: "aws-tgw/main.tf:12"}}, doc.Modules[0].Calls)
+	assert.Equal(t, []Edge{{From: "aws-tgw", To: "aws-vpc", Calls: []string{"vpc"}}}, doc.Edges)
+	assert.Empty(t, doc.Cycles)
+
+	// Long edge labels are counted.
+	solution := load(t, modulesDir).Subgraph("solution-aws-bedrock-mgmt-runtime")
+	assert.Contains(t, solution.DOT(), `"solution-aws-bedrock-mgmt-runtime" -> "aws-cloudwatch-alarm" [label="23 calls"];`)
+}
+
+func TestCheck(t *testing.T) {
+	assert.Empty(t, Check(load(t, modulesDir)))
+
+	plantest.AssertFindings(t, []plantest.Expected{
+		plantest.Want(finding.High, RuleCycle, "a").At(""),
+		plantest.Want(finding.High, RuleMissing, "c").At("module.missing.source"),
+		plantest.Want(finding.High, RuleLocalVersion, "c").At("module.pinned.version"),
+		plantest.Want(finding.High, RuleConflict, "c").At("required_version"),
+		plantest.Want(finding.High, RuleConflict, "f").At("required_providers.hashicorp/aws"),
+		plantest.Want(finding.Medium, RuleRequiredVersion, "e").At("required_version"),
+	}, Check(load(t, "testdata/broken")))
+}
+
+func TestMessages(t *testing.T) {
+	var got []string
+	for _, f := range Check(load(t, "testdata/broken")) {
+		got = append(got, f.Message)
+	}
+	assert.Equal(t, []string{
+		"modules call each other in a cycle: a -> b -> a",
+		`c/main.tf:5: source "../missing" names no module under the modules directory`,
+		`c/main.tf:9: version "1.0.0" cannot be used with the relative source "../a"; local modules have no versions`,
+		`no Terraform release satisfies "~>1.5.0" (c), ">= 1.6" (d)`,
+		`no hashicorp/aws release satisfies "~> 4.0" (f), "~> 5.0" (d)`,
+		`required_version ">= 1.0" allows Terraform 1.0.0, but d requires ">= 1.6"`,
+	}, got)
+}
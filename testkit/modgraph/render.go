@@ -0,0 +1,89 @@
+package modgraph
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Subgraph returns the graph of the modules names and everything they
+// call, directly or not, as when drawing one composition.
+func (g *Graph) Subgraph(names ...string) *Graph {
+	sub := &Graph{Modules: map[string]*Module{}}
+	for _, name := range names {
+		if m, ok := g.Modules[name]; ok {
+			sub.Modules[name] = m
+		}
+		for _, dep := range g.AllDependencies(name) {
+			sub.Modules[dep] = g.Modules[dep]
+		}
+	}
+
+	return sub
+}
+
+// edgeLabel names the module blocks of an edge, or counts them when
+// there are too many to read on an arrow.
+func edgeLabel(e Edge) string {
+	if len(e.Calls) > 3 {
+		return fmt.Sprintf("%d calls", len(e.Calls))
+	}
+
+	return strings.Join(e.Calls, ", ")
+}
+
+// DOT renders the graph in Graphviz's language, callers to the left.
+func (g *Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph modules {\n\trankdir=LR;\n\tnode [shape=box];\n")
+	for _, name := range g.Names() {
+		fmt.Fprintf(&b, "\t%q;\n", name)
+	}
+	for _, e := range g.Edges() {
+		fmt.Fprintf(&b, "\t%q -> %q [label=%q];\n", e.From, e.To, edgeLabel(e))
+	}
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+// Mermaid renders the graph as a Mermaid flowchart, for Markdown that
+// GitHub draws.
+func (g *Graph) Mermaid() string {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for _, name := range g.Names() {
+		fmt.Fprintf(&b, "    %s[\"%s\"]\n", mermaidID(name), name)
+	}
+	for _, e := range g.Edges() {
+		fmt.Fprintf(&b, "    %s -->|%s| %s\n", mermaidID(e.From), edgeLabel(e), mermaidID(e.To))
+	}
+
+	return b.String()
+}
+
+// mermaidID makes a module name a Mermaid node ID, which may not contain
+// hyphens.
+func mermaidID(name string) string {
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+// JSON renders the modules, the edges between them and any cycles.
+func (g *Graph) JSON() ([]byte, error) {
+	doc := struct {
+		Modules []*Module  `json:"modules"`
+		Edges   []Edge     `json:"edges"`
+		Cycles  [][]string `json:"cycles"`
+	}{Edges: g.Edges(), Cycles: g.Cycles()}
+	for _, name := range g.Names() {
+		doc.Modules = append(doc.Modules, g.Modules[name])
+	}
+	if doc.Edges == nil {
+		doc.Edges = []Edge{}
+	}
+	if doc.Cycles == nil {
+		doc.Cycles = [][]string{}
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
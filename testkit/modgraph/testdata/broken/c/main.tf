@@ -0,0 +1,21 @@
+terraform {
+  required_version = "~>1.5.0"
+}
+
+module "missing" {
+  source = "../missing"
+}
+
+module "pinned" {
+  source  = "../a"
+  version = "1.0.0"
+}
+
+module "d" {
+  source = "../d"
+}
+
+module "subnets" {
+  source  = "hashicorp/subnets/cidr"
+  version = "1.0.0"
+}
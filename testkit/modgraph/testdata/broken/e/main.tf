@@ -0,0 +1,10 @@
+terraform {
+  required_version = ">= 1.0"
+  required_providers {
+    aws = ">= 4.0"
+  }
+}
+
+module "d" {
+  source = "../d"
+}
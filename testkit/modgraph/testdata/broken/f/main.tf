@@ -0,0 +1,16 @@
+terraform {
+  required_providers {
+    aws = {
+      source  = "hashicorp/aws"
+      version = "~> 4.0"
+    }
+  }
+}
+
+module "d" {
+  source = "../d"
+}
+
+module "c" {
+  source = "../c"
+}
@@ -0,0 +1,217 @@
+package plan
+
+import (
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// References returns what the configuration expression of attribute attr
+// of r refers to, as absolute addresses such as
+// module.alerts[0].aws_sns_topic.this[0].arn. Input variables are followed
+// up through the module calls that set them, so an alarm whose
+// alarm_actions is var.alarm_actions yields what its caller passed in.
+// each.value and each.key stand for whatever the for_each expression of
+// the resource or module call refers to.
+//
+// Use it when a value is known only after apply: the planned value is
+// missing, but the configuration still says where it comes from. Like
+// Terraform, the result lists each reference together with its shorter
+// prefixes (module.alerts[0].arn, module.alerts[0], module.alerts).
+//
+// A reference to a module output, such as module.ipam.result.pool.id,
+// is followed into the module too: what the output's expression refers
+// to is listed as well, as in module.ipam.aws_vpc_ipam_pool.this.
+//
+// attr may name an attribute of a nested block, as in
+// action.target_group_arn, in which case every instance of the block is
+// searched.
+func References(p *tfjson.Plan, r Resource, attr string) []string {
+	calls, mods, cr := configResource(p, r)
+	if cr == nil {
+		return nil
+	}
+	forEach := cr.ForEachExpression
+
+	var out []string
+	seen := map[string]bool{}
+	add := func(ref string) {
+		if !seen[ref] {
+			seen[ref] = true
+			out = append(out, ref)
+		}
+	}
+	var resolve func(depth int, expr, forEach *tfjson.Expression)
+	resolve = func(depth int, expr, forEach *tfjson.Expression) {
+		if expr == nil || expr.ExpressionData == nil {
+			return
+		}
+		for _, ref := range expr.References {
+			if name := strings.TrimPrefix(ref, "var."); name != ref {
+				if depth > 0 {
+					call := mods[depth-1].ModuleCalls[calls[depth-1].name]
+					resolve(depth-1, call.Expressions[strings.FieldsFunc(name, isSeparator)[0]], call.ForEachExpression)
+				}
+				continue
+			}
+			if strings.HasPrefix(ref, "each.") {
+				resolve(depth, forEach, nil)
+				continue
+			}
+			prefix := ""
+			if depth > 0 {
+				prefix = calls[depth-1].address + "."
+			}
+			add(prefix + ref)
+			outputs(mods[depth], prefix, ref, add)
+		}
+	}
+	for _, expr := range attribute(cr.Expressions, attr) {
+		resolve(len(calls), expr, forEach)
+	}
+
+	return out
+}
+
+// outputs adds what the module output ref, made in mod, refers to inside
+// its module. prefix is the address of mod followed by a dot, empty for
+// the root module. References the output makes to input variables are
+// not followed back out.
+func outputs(mod *tfjson.ConfigModule, prefix, ref string, add func(string)) {
+	rest := strings.TrimPrefix(ref, "module.")
+	if rest == ref {
+		return
+	}
+	end := strings.IndexAny(rest, ".[")
+	if end < 0 {
+		return
+	}
+	name := rest[:end]
+	call := mod.ModuleCalls[name]
+	if call == nil || call.Module == nil {
+		return
+	}
+	instance := "module." + name
+	if rest[end] == '[' {
+		close := strings.Index(rest, "]")
+		if close < 0 {
+			return
+		}
+		instance += rest[end : close+1]
+		end = close + 1
+	}
+	output, _, _ := strings.Cut(strings.TrimPrefix(rest[end:], "."), ".")
+	o := call.Module.Outputs[output]
+	if o == nil || o.Expression == nil || o.Expression.ExpressionData == nil {
+		return
+	}
+	for _, r := range o.Expression.References {
+		if strings.HasPrefix(r, "var.") || strings.HasPrefix(r, "each.") || strings.HasPrefix(r, "count.") {
+			continue
+		}
+		add(prefix + instance + "." + r)
+		outputs(call.Module, prefix+instance+".", r, add)
+	}
+}
+
+// Constant returns the configuration value of attribute attr of r when
+// it is a literal, such as the port of a data "aws_lb_listener" lookup,
+// which has no planned value of its own.
+func Constant(p *tfjson.Plan, r Resource, attr string) (interface{}, bool) {
+	_, _, cr := configResource(p, r)
+	if cr == nil {
+		return nil, false
+	}
+	for _, expr := range attribute(cr.Expressions, attr) {
+		if expr.ConstantValue != nil && expr.ConstantValue != tfjson.UnknownConstantValue {
+			return expr.ConstantValue, true
+		}
+	}
+
+	return nil, false
+}
+
+// attribute returns the expressions of attr, following nested blocks for
+// each dot-separated step.
+func attribute(exprs map[string]*tfjson.Expression, attr string) []*tfjson.Expression {
+	name, rest, nested := strings.Cut(attr, ".")
+	expr := exprs[name]
+	if expr == nil || expr.ExpressionData == nil {
+		return nil
+	}
+	if !nested {
+		return []*tfjson.Expression{expr}
+	}
+	var out []*tfjson.Expression
+	for _, block := range expr.NestedBlocks {
+		out = append(out, attribute(block, rest)...)
+	}
+
+	return out
+}
+
+// configResource returns the configuration of r together with the module
+// calls leading to it and their modules, outermost first.
+func configResource(p *tfjson.Plan, r Resource) ([]moduleCall, []*tfjson.ConfigModule, *tfjson.ConfigResource) {
+	if p == nil || p.Config == nil || p.Config.RootModule == nil {
+		return nil, nil, nil
+	}
+
+	calls := moduleCalls(r.ModuleAddress)
+	mods := []*tfjson.ConfigModule{p.Config.RootModule}
+	for _, c := range calls {
+		call := mods[len(mods)-1].ModuleCalls[c.name]
+		if call == nil || call.Module == nil {
+			return nil, nil, nil
+		}
+		mods = append(mods, call.Module)
+	}
+	for _, cr := range mods[len(mods)-1].Resources {
+		if cr.Mode == r.Mode && cr.Type == r.Type && cr.Name == r.Name {
+			return calls, mods, cr
+		}
+	}
+
+	return nil, nil, nil
+}
+
+func isSeparator(r rune) bool { return r == '.' || r == '[' }
+
+type moduleCall struct {
+	// name is the module call name and address the absolute address of the
+	// module instance, for example "kms" and "module.solution.module.kms[0]".
+	name, address string
+}
+
+// moduleCalls splits a module address into its module calls, outermost
+// first.
+func moduleCalls(address string) []moduleCall {
+	var out []moduleCall
+	for rest := address; rest != ""; {
+		rest = strings.TrimPrefix(rest, "module.")
+		end := strings.Index(rest, ".module.")
+		if end < 0 {
+			end = len(rest)
+		}
+		// Instance keys may contain dots, as in module.x["a.b"].
+		if i := strings.Index(rest, "["); i >= 0 && i < end {
+			if j := strings.Index(rest[i:], "]"); j >= 0 {
+				if k := strings.Index(rest[i+j:], ".module."); k >= 0 {
+					end = i + j + k
+				} else {
+					end = len(rest)
+				}
+			}
+		}
+		seg := rest[:end]
+		name := seg
+		if i := strings.Index(seg, "["); i >= 0 {
+			name = seg[:i]
+		}
+		prefix := strings.TrimSuffix(address, rest)
+		out = append(out, moduleCall{name: name, address: prefix + seg})
+		rest = strings.TrimPrefix(rest[end:], ".")
+	}
+
+	return out
+}
@@ -0,0 +1,281 @@
+// Package plan loads Terraform JSON plans (the output of
+// `terraform show -json <planfile>`) and flattens the planned resources of
+// every module into a single list that the checkers in this kit can walk.
+// JSON states (`terraform show -json` without a plan file) are flattened the
+// same way by StateResources.
+//
+// Terratest callers already hold a parsed plan in
+// terraform.PlanStruct.RawPlan and can pass its address straight to
+// Resources.
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Resource is a single planned resource instance.
+type Resource struct {
+	// Address is the absolute resource address, for example
+	// module.kms.aws_kms_key.this[0].
+	Address string
+
+	// ModuleAddress is the address of the module that contains the
+	// resource. It is empty for the root module.
+	ModuleAddress string
+
+	Mode  tfjson.ResourceMode
+	Type  string
+	Name  string
+	Index interface{}
+
+	// Values holds the planned attribute values. Values that are not known
+	// until apply are absent or null.
+	Values map[string]interface{}
+
+	// Unknown mirrors the after_unknown structure of the resource change.
+	// Use IsUnknown to query it.
+	Unknown map[string]interface{}
+}
+
+// Load reads and parses a JSON plan from path.
+func Load(path string) (*tfjson.Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+// Parse parses a JSON plan.
+func Parse(data []byte) (*tfjson.Plan, error) {
+	var p tfjson.Plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parsing plan: %w", err)
+	}
+
+	return &p, nil
+}
+
+// LoadState reads and parses a JSON state, as printed by
+// `terraform show -json`.
+func LoadState(path string) (*tfjson.State, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseState(data)
+}
+
+// ParseState parses a JSON state.
+func ParseState(data []byte) (*tfjson.State, error) {
+	var s tfjson.State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parsing state: %w", err)
+	}
+
+	return &s, nil
+}
+
+// IsPlan reports whether data looks like a JSON plan rather than a JSON
+// state: plans carry planned_values, states carry values.
+func IsPlan(data []byte) bool {
+	var probe struct {
+		PlannedValues json.RawMessage `json:"planned_values"`
+	}
+
+	return json.Unmarshal(data, &probe) == nil && probe.PlannedValues != nil
+}
+
+// Resources returns every managed resource in the planned values of p,
+// including those in child modules, ordered by address.
+func Resources(p *tfjson.Plan) []Resource {
+	if p == nil || p.PlannedValues == nil || p.PlannedValues.RootModule == nil {
+		return nil
+	}
+
+	unknown := map[string]map[string]interface{}{}
+	for _, rc := range p.ResourceChanges {
+		if rc.Change == nil {
+			continue
+		}
+		if u, ok := rc.Change.AfterUnknown.(map[string]interface{}); ok {
+			unknown[rc.Address] = u
+		}
+	}
+
+	return walk(p.PlannedValues.RootModule, unknown)
+}
+
+// StateResources returns every managed resource in the state s, including
+// those in child modules, ordered by address. Use it with the output of
+// `terraform show -json` without a plan file.
+func StateResources(s *tfjson.State) []Resource {
+	if s == nil || s.Values == nil || s.Values.RootModule == nil {
+		return nil
+	}
+
+	return walk(s.Values.RootModule, nil)
+}
+
+func walk(root *tfjson.StateModule, unknown map[string]map[string]interface{}) []Resource {
+	var out []Resource
+	var visit func(m *tfjson.StateModule)
+	visit = func(m *tfjson.StateModule) {
+		for _, r := range m.Resources {
+			if r.Mode != tfjson.ManagedResourceMode {
+				continue
+			}
+			values := r.AttributeValues
+			if values == nil {
+				values = map[string]interface{}{}
+			}
+			out = append(out, Resource{
+				Address:       r.Address,
+				ModuleAddress: m.Address,
+				Mode:          r.Mode,
+				Type:          r.Type,
+				Name:          r.Name,
+				Index:         r.Index,
+				Values:        values,
+				Unknown:       unknown[r.Address],
+			})
+		}
+		for _, c := range m.ChildModules {
+			visit(c)
+		}
+	}
+	visit(root)
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Address < out[j].Address })
+
+	return out
+}
+
+// ResourcesOfType returns the planned resources whose type is one of types.
+func ResourcesOfType(p *tfjson.Plan, types ...string) []Resource {
+	var out []Resource
+	for _, r := range Resources(p) {
+		for _, t := range types {
+			if r.Type == t {
+				out = append(out, r)
+				break
+			}
+		}
+	}
+
+	return out
+}
+
+// Variable returns the value of the root module variable name, and whether
+// it was set in the plan.
+func Variable(p *tfjson.Plan, name string) (interface{}, bool) {
+	if p == nil || p.Variables == nil {
+		return nil, false
+	}
+	v, ok := p.Variables[name]
+	if !ok || v == nil {
+		return nil, false
+	}
+
+	return v.Value, true
+}
+
+// String returns the string attribute key, or "" when it is absent, null or
+// not a string.
+func (r Resource) String(key string) string {
+	s, _ := r.Values[key].(string)
+	return s
+}
+
+// Bool returns the boolean attribute key, or false when it is absent.
+func (r Resource) Bool(key string) bool {
+	b, _ := r.Values[key].(bool)
+	return b
+}
+
+// Number returns the numeric attribute key, or 0 when it is absent.
+func (r Resource) Number(key string) float64 {
+	n, _ := r.Values[key].(float64)
+	return n
+}
+
+// Strings returns the list-of-strings attribute key. Non-string elements
+// are skipped.
+func (r Resource) Strings(key string) []string {
+	return StringList(r.Values[key])
+}
+
+// Blocks returns the nested block (or list of objects) attribute key.
+func (r Resource) Blocks(key string) []map[string]interface{} {
+	return Objects(r.Values[key])
+}
+
+// IsUnknown reports whether the attribute key will only be known after
+// apply.
+func (r Resource) IsUnknown(key string) bool {
+	b, _ := r.Unknown[key].(bool)
+	return b
+}
+
+// InModule reports whether the resource belongs to the module call named
+// name, at any depth. For example module.solution.module.kms contains the
+// module call "kms".
+func (r Resource) InModule(name string) bool {
+	for _, part := range strings.Split(r.ModuleAddress, ".") {
+		if i := strings.Index(part, "["); i >= 0 {
+			part = part[:i]
+		}
+		if part == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StringList converts a decoded JSON list into a list of strings, skipping
+// elements that are not strings. A bare string becomes a one element list.
+func StringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+
+	return nil
+}
+
+// Objects converts a decoded JSON list of objects (how Terraform renders
+// nested blocks) into a list of maps. A bare object becomes a one element
+// list.
+func Objects(v interface{}) []map[string]interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{v}
+	case []interface{}:
+		out := make([]map[string]interface{}, 0, len(v))
+		for _, e := range v {
+			if m, ok := e.(map[string]interface{}); ok {
+				out = append(out, m)
+			}
+		}
+		return out
+	}
+
+	return nil
+}
@@ -0,0 +1,221 @@
+package plan
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResources(t *testing.T) {
+	p, err := Load("testdata/plan.json")
+	require.NoError(t, err)
+
+	var addresses []string
+	for _, r := range Resources(p) {
+		addresses = append(addresses, r.Address)
+	}
+	assert.Equal(t, []string{
+		"aws_iam_role.app",
+		`module.kms.aws_kms_grant.this["app"]`,
+		"module.kms.aws_kms_key.this[0]",
+	}, addresses, "data sources are skipped and resources are sorted")
+
+	keys := ResourcesOfType(p, "aws_kms_key")
+	require.Len(t, keys, 1)
+	key := keys[0]
+	assert.Equal(t, "module.kms", key.ModuleAddress)
+	assert.True(t, key.InModule("kms"))
+	assert.True(t, key.Bool("enable_key_rotation"))
+	assert.Equal(t, float64(30), key.Number("deletion_window_in_days"))
+	assert.Equal(t, "", key.String("policy"))
+	assert.True(t, key.IsUnknown("policy"))
+	assert.False(t, key.IsUnknown("enable_key_rotation"))
+
+	grant := ResourcesOfType(p, "aws_kms_grant")[0]
+	assert.Equal(t, []string{"Encrypt", "Decrypt"}, grant.Strings("operations"))
+	require.Len(t, grant.Blocks("constraints"), 1)
+}
+
+func TestVariable(t *testing.T) {
+	p, err := Load("testdata/plan.json")
+	require.NoError(t, err)
+
+	v, ok := Variable(p, "aws_region")
+	assert.True(t, ok)
+	assert.Equal(t, "us-east-1", v)
+
+	_, ok = Variable(p, "missing")
+	assert.False(t, ok)
+}
+
+func TestParseRejectsNonPlans(t *testing.T) {
+	_, err := Parse([]byte(`{"resources": []}`))
+	assert.Error(t, err)
+}
+
+func TestStateResources(t *testing.T) {
+	data, err := os.ReadFile("testdata/state.json")
+	require.NoError(t, err)
+	assert.False(t, IsPlan(data))
+
+	s, err := ParseState(data)
+	require.NoError(t, err)
+
+	resources := StateResources(s)
+	require.Len(t, resources, 1)
+	assert.Equal(t, "module.kms.aws_kms_key.this[0]", resources[0].Address)
+	assert.Equal(t, "module.kms", resources[0].ModuleAddress)
+	assert.True(t, resources[0].Bool("enable_key_rotation"))
+	assert.False(t, resources[0].IsUnknown("arn"))
+
+	planData, err := os.ReadFile("testdata/plan.json")
+	require.NoError(t, err)
+	assert.True(t, IsPlan(planData))
+}
+
+func TestReferences(t *testing.T) {
+	p, err := Parse([]byte(`{
+  "format_version": "1.2",
+  "planned_values": {"root_module": {"child_modules": [{
+    "address": "module.solution",
+    "child_modules": [{
+      "address": "module.solution.module.alarm[\"errors\"]",
+      "resources": [{
+        "address": "module.solution.module.alarm[\"errors\"].aws_cloudwatch_metric_alarm.this[0]",
+        "mode": "managed", "type": "aws_cloudwatch_metric_alarm", "name": "this", "index": 0, "values": {}
+      }]
+    }]
+  }]}},
+  "configuration": {"root_module": {"module_calls": {"solution": {
+    "expressions": {"topic_arn": {"references": ["aws_sns_topic.ops.arn", "aws_sns_topic.ops"]}},
+    "module": {"module_calls": {"alarm": {
+      "expressions": {"alarm_actions": {"references": ["var.topic_arn", "local.extra_actions"]}},
+      "module": {"resources": [{
+        "address": "aws_cloudwatch_metric_alarm.this", "mode": "managed", "type": "aws_cloudwatch_metric_alarm", "name": "this",
+        "expressions": {"alarm_actions": {"references": ["var.alarm_actions[0]", "var.alarm_actions"]}}
+      }]}
+    }}}
+  }}}}
+}`))
+	require.NoError(t, err)
+
+	alarm := ResourcesOfType(p, "aws_cloudwatch_metric_alarm")[0]
+	assert.Equal(t, []string{
+		"aws_sns_topic.ops.arn",
+		"aws_sns_topic.ops",
+		"module.solution.local.extra_actions",
+	}, References(p, alarm, "alarm_actions"))
+	assert.Empty(t, References(p, alarm, "ok_actions"))
+}
+
+func TestReferencesForEach(t *testing.T) {
+	p, err := Parse([]byte(`{
+  "format_version": "1.2",
+  "planned_values": {"root_module": {"child_modules": [{
+    "address": "module.orders",
+    "resources": [{
+      "address": "module.orders.aws_sns_topic_subscription.this[\"ledger\"]",
+      "mode": "managed", "type": "aws_sns_topic_subscription", "name": "this", "index": "ledger", "values": {}
+    }]
+  }]}},
+  "configuration": {"root_module": {"module_calls": {"orders": {
+    "expressions": {"subscriptions": {"references": ["aws_sqs_queue.ledger.arn", "aws_sqs_queue.ledger"]}},
+    "module": {"resources": [{
+      "address": "aws_sns_topic_subscription.this", "mode": "managed", "type": "aws_sns_topic_subscription", "name": "this",
+      "expressions": {"endpoint": {"references": ["each.value.endpoint", "each.value"]}},
+      "for_each_expression": {"references": ["var.create_topic", "var.subscriptions"]}
+    }]}
+  }}}}
+}`))
+	require.NoError(t, err)
+
+	sub := ResourcesOfType(p, "aws_sns_topic_subscription")[0]
+	assert.Equal(t, []string{"aws_sqs_queue.ledger.arn", "aws_sqs_queue.ledger"}, References(p, sub, "endpoint"))
+}
+
+func TestReferencesModuleOutputs(t *testing.T) {
+	p, err := Parse([]byte(`{
+  "format_version": "1.2",
+  "planned_values": {"root_module": {"child_modules": [{
+    "address": "module.vpc",
+    "resources": [{
+      "address": "module.vpc.aws_vpc.this",
+      "mode": "managed", "type": "aws_vpc", "name": "this", "values": {}
+    }]
+  }]}},
+  "configuration": {"root_module": {"module_calls": {
+    "vpc": {
+      "expressions": {"ipam_pool_id": {"references": ["module.network[0].pool_id", "module.network[0]", "module.network"]}},
+      "module": {"resources": [{
+        "address": "aws_vpc.this", "mode": "managed", "type": "aws_vpc", "name": "this",
+        "expressions": {"ipv4_ipam_pool_id": {"references": ["var.ipam_pool_id"]}}
+      }]}
+    },
+    "network": {
+      "module": {
+        "outputs": {"pool_id": {"expression": {"references": ["module.ipam.result.pool.id", "module.ipam.result", "module.ipam"]}}},
+        "module_calls": {"ipam": {"module": {
+          "outputs": {"result": {"expression": {"references": ["aws_vpc_ipam_pool.this", "var.root_cidr"]}}}
+        }}}
+      }
+    }
+  }}}
+}`))
+	require.NoError(t, err)
+
+	vpc := ResourcesOfType(p, "aws_vpc")[0]
+	assert.Equal(t, []string{
+		"module.network[0].pool_id",
+		"module.network[0].module.ipam.result.pool.id",
+		"module.network[0].module.ipam.aws_vpc_ipam_pool.this",
+		"module.network[0].module.ipam.result",
+		"module.network[0].module.ipam",
+		"module.network[0]",
+		"module.network",
+	}, References(p, vpc, "ipv4_ipam_pool_id"))
+}
+
+func TestConstantAndNestedReferences(t *testing.T) {
+	p, err := Parse([]byte(`{
+  "format_version": "1.2",
+  "planned_values": {"root_module": {"child_modules": [{
+    "address": "module.api",
+    "resources": [{
+      "address": "module.api.aws_lb_listener_rule.this[\"api\"]",
+      "mode": "managed", "type": "aws_lb_listener_rule", "name": "this", "index": "api", "values": {}
+    }]
+  }]}},
+  "configuration": {"root_module": {"module_calls": {"api": {
+    "module": {"resources": [
+      {
+        "address": "aws_lb_listener_rule.this", "mode": "managed", "type": "aws_lb_listener_rule", "name": "this",
+        "expressions": {
+          "listener_arn": {"references": ["data.aws_lb_listener.selected443.arn", "data.aws_lb_listener.selected443"]},
+          "action": [{"type": {"constant_value": "forward"}, "target_group_arn": {"references": ["each.value.arn", "each.value"]}}]
+        },
+        "for_each_expression": {"references": ["aws_lb_target_group.this"]}
+      },
+      {
+        "address": "data.aws_lb_listener.selected443", "mode": "data", "type": "aws_lb_listener", "name": "selected443",
+        "expressions": {"port": {"constant_value": 443}, "load_balancer_arn": {"references": ["var.load_balancer_arn"]}}
+      }
+    ]}
+  }}}}
+}`))
+	require.NoError(t, err)
+
+	rule := ResourcesOfType(p, "aws_lb_listener_rule")[0]
+	assert.Equal(t, []string{"module.api.aws_lb_target_group.this"}, References(p, rule, "action.target_group_arn"))
+	typ, ok := Constant(p, rule, "action.type")
+	assert.True(t, ok)
+	assert.Equal(t, "forward", typ)
+	_, ok = Constant(p, rule, "listener_arn")
+	assert.False(t, ok, "references are not constant")
+
+	listener := Resource{ModuleAddress: "module.api", Mode: "data", Type: "aws_lb_listener", Name: "selected443"}
+	port, ok := Constant(p, listener, "port")
+	assert.True(t, ok)
+	assert.Equal(t, 443.0, port)
+}
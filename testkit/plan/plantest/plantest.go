@@ -0,0 +1,160 @@
+// Package plantest loads JSON plan fixtures for the checkers' tests. A
+// Fixture is the plan decoded into plain maps, so a test can break one
+// resource before parsing it with Plan and handing it to the checker,
+// and AssertFindings compares what the checker reports with what the
+// test expects.
+package plantest
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+// Fixture is a JSON plan decoded into maps.
+type Fixture map[string]interface{}
+
+// Load reads the JSON plan at path.
+func Load(t testing.TB, path string) Fixture {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var f Fixture
+	require.NoError(t, json.Unmarshal(data, &f))
+
+	return f
+}
+
+// Plan parses the fixture as it stands.
+func (f Fixture) Plan(t testing.TB) *tfjson.Plan {
+	t.Helper()
+	data, err := json.Marshal(f)
+	require.NoError(t, err)
+	p, err := plan.Parse(data)
+	require.NoError(t, err)
+
+	return p
+}
+
+// Values returns the planned values of the resource at addr, in whichever
+// module it is. It fails the test if there is no such resource.
+func (f Fixture) Values(t testing.TB, addr string) map[string]interface{} {
+	t.Helper()
+	var values map[string]interface{}
+	f.walk(func(m map[string]interface{}) {
+		for _, r := range resources(m) {
+			if r["address"] == addr {
+				values = r["values"].(map[string]interface{})
+			}
+		}
+	})
+	require.NotNil(t, values, "no resource %s", addr)
+
+	return values
+}
+
+// Unknown returns the after_unknown of the resource change at addr, or nil
+// if nothing about it is unknown.
+func (f Fixture) Unknown(t testing.TB, addr string) map[string]interface{} {
+	t.Helper()
+	changes, _ := f["resource_changes"].([]interface{})
+	for _, rc := range changes {
+		if rc := rc.(map[string]interface{}); rc["address"] == addr {
+			unknown, _ := rc["change"].(map[string]interface{})["after_unknown"].(map[string]interface{})
+			return unknown
+		}
+	}
+
+	return nil
+}
+
+// Remove drops the resource at addr from the planned values.
+func (f Fixture) Remove(addr string) {
+	f.walk(func(m map[string]interface{}) {
+		if _, ok := m["resources"]; !ok {
+			return
+		}
+		var kept []interface{}
+		for _, r := range resources(m) {
+			if r["address"] != addr {
+				kept = append(kept, r)
+			}
+		}
+		m["resources"] = kept
+	})
+}
+
+// walk calls fn for the root module and every child module of the planned
+// values.
+func (f Fixture) walk(fn func(m map[string]interface{})) {
+	var visit func(m map[string]interface{})
+	visit = func(m map[string]interface{}) {
+		fn(m)
+		children, _ := m["child_modules"].([]interface{})
+		for _, c := range children {
+			visit(c.(map[string]interface{}))
+		}
+	}
+	if root, ok := f["planned_values"].(map[string]interface{})["root_module"].(map[string]interface{}); ok {
+		visit(root)
+	}
+}
+
+func resources(m map[string]interface{}) []map[string]interface{} {
+	list, _ := m["resources"].([]interface{})
+	out := make([]map[string]interface{}, 0, len(list))
+	for _, r := range list {
+		out = append(out, r.(map[string]interface{}))
+	}
+
+	return out
+}
+
+// Expected is a finding a test expects, made with Want.
+type Expected struct {
+	Severity finding.Severity
+	Rule     string
+	Address  string
+	// Path is compared only when it was set with At.
+	Path     string
+	withPath bool
+}
+
+// Want expects a finding of severity and rule about address, whatever
+// its path and message.
+func Want(severity finding.Severity, rule, address string) Expected {
+	return Expected{Severity: severity, Rule: rule, Address: address}
+}
+
+// At also expects the finding at path.
+func (e Expected) At(path string) Expected {
+	e.Path, e.withPath = path, true
+	return e
+}
+
+// AssertFindings asserts that findings are want, in any order. Paths are
+// compared when any wanted finding has one.
+func AssertFindings(t testing.TB, want []Expected, findings finding.List) bool {
+	t.Helper()
+	withPath := false
+	for _, w := range want {
+		withPath = withPath || w.withPath
+	}
+	var got []Expected
+	for _, f := range findings {
+		e := Want(f.Severity, f.Rule, f.Address)
+		if withPath {
+			e = e.At(f.Path)
+		}
+		got = append(got, e)
+	}
+
+	return assert.ElementsMatch(t, want, got, findings.String())
+}
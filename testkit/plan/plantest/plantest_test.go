@@ -0,0 +1,41 @@
+package plantest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+const key = "module.kms.aws_kms_key.this[0]"
+
+func TestFixture(t *testing.T) {
+	f := Load(t, "../testdata/plan.json")
+	assert.Equal(t, "app", f.Values(t, "aws_iam_role.app")["name"], "root module resource")
+
+	f.Values(t, key)["deletion_window_in_days"] = 7
+	delete(f.Unknown(t, key), "policy")
+	f.Remove("aws_iam_role.app")
+	assert.Nil(t, f.Unknown(t, "aws_iam_role.app"))
+
+	var addresses []string
+	for _, r := range plan.Resources(f.Plan(t)) {
+		addresses = append(addresses, r.Address)
+	}
+	assert.Equal(t, []string{`module.kms.aws_kms_grant.this["app"]`, key}, addresses)
+	k := plan.ResourcesOfType(f.Plan(t), "aws_kms_key")[0]
+	assert.Equal(t, float64(7), k.Number("deletion_window_in_days"))
+	assert.False(t, k.IsUnknown("policy"))
+}
+
+func TestAssertFindings(t *testing.T) {
+	findings := finding.List{
+		{Severity: finding.High, Rule: "r1", Address: "a", Path: "x", Message: "one"},
+		{Severity: finding.Low, Rule: "r2", Address: "b", Path: "y", Message: "two"},
+	}
+	AssertFindings(t, []Expected{Want(finding.Low, "r2", "b"), Want(finding.High, "r1", "a")}, findings)
+	AssertFindings(t, []Expected{Want(finding.High, "r1", "a").At("x"), Want(finding.Low, "r2", "b").At("y")}, findings)
+	assert.False(t, AssertFindings(&testing.T{}, []Expected{Want(finding.High, "r1", "a")}, findings), "a missing finding fails")
+}
@@ -0,0 +1,283 @@
+// Package scaffold generates new modules from the module template
+// embedded under template/. Every template file ends in .tmpl and is
+// rendered with text/template; files under template/examples/example are
+// rendered once per example. The test directory gets a go.mod and go.sum
+// pinned to the versions the template carries, so a new module's tests
+// build the same way on every machine instead of resolving whatever is
+// newest through go mod init and go mod tidy.
+package scaffold
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+//go:embed all:template
+var templates embed.FS
+
+// TemplateDir is the directory of the template inside the kit.
+const TemplateDir = "template"
+
+// exampleDir is the template directory rendered once per example.
+const exampleDir = "examples/example"
+
+// NamePattern is what a module name must match. It is the rule the make
+// module target has always applied.
+var NamePattern = regexp.MustCompile(`^[0-9a-z-]*$`)
+
+// Provider is a provider a module can require.
+type Provider struct {
+	Name    string
+	Source  string
+	Version string
+}
+
+// Providers are the providers a new module can start with.
+var Providers = map[string]Provider{
+	"archive": {"archive", "hashicorp/archive", "~> 2.0"},
+	"aws":     {"aws", "hashicorp/aws", "~> 5.0"},
+	"null":    {"null", "hashicorp/null", "~> 3.0"},
+	"random":  {"random", "hashicorp/random", "~>3"},
+	"time":    {"time", "hashicorp/time", "~> 0.9"},
+	"tls":     {"tls", "hashicorp/tls", "~> 4.0"},
+}
+
+// Options say what to generate.
+type Options struct {
+	Name string
+	// Providers name entries of Providers. The placeholder resource is a
+	// random_pet when random is among them and a terraform_data
+	// otherwise.
+	Providers []string
+	// Examples are the directories to generate under examples/.
+	Examples []string
+	// PlanTests generates tests that plan each example without applying
+	// it.
+	PlanTests bool
+	// IntegrationTests generates tests, behind the integration build
+	// tag, that apply each example and destroy it.
+	IntegrationTests bool
+	// Testkit requires the kit from the test module, through a replace
+	// directive to the checkout, and checks the plans with it. It does
+	// nothing when no tests are generated.
+	Testkit bool
+}
+
+// Defaults returns the options make module uses: the random provider, a
+// simple example, both kinds of tests and the kit.
+func Defaults(name string) Options {
+	return Options{
+		Name:             name,
+		Providers:        []string{"random"},
+		Examples:         []string{"simple"},
+		PlanTests:        true,
+		IntegrationTests: true,
+		Testkit:          true,
+	}
+}
+
+// Validate checks the options.
+func (o Options) Validate() error {
+	switch {
+	case o.Name == "":
+		return fmt.Errorf("no module name given")
+	case !NamePattern.MatchString(o.Name):
+		return fmt.Errorf("module name %q must match %s", o.Name, NamePattern)
+	}
+	for _, p := range o.Providers {
+		if _, ok := Providers[p]; !ok {
+			return fmt.Errorf("unknown provider %q; use one of %s", p, strings.Join(providerNames(), ", "))
+		}
+	}
+	if len(o.Examples) == 0 {
+		return fmt.Errorf("no examples given; the tests run the examples")
+	}
+	examples := map[string]bool{}
+	for _, e := range o.Examples {
+		if !NamePattern.MatchString(e) || e == "" {
+			return fmt.Errorf("example name %q must match %s", e, NamePattern)
+		}
+		if examples[e] {
+			return fmt.Errorf("example %q given twice", e)
+		}
+		examples[e] = true
+	}
+
+	return nil
+}
+
+func providerNames() []string {
+	names := make([]string, 0, len(Providers))
+	for name := range Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// data is what the templates see.
+type data struct {
+	Options
+	Providers []Provider
+}
+
+// Uses reports whether the module requires the named provider.
+func (d data) Uses(name string) bool {
+	for _, p := range d.Providers {
+		if p.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// File is a generated file.
+type File struct {
+	// Path is relative to the module directory.
+	Path string
+	// Template is the template file it was rendered from, relative to
+	// TemplateDir.
+	Template string
+	Data     []byte
+}
+
+// Render renders the template for o, returning the files sorted by path.
+func Render(o Options) ([]File, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	d := data{Options: o}
+	seen := map[string]bool{}
+	for _, name := range o.Providers {
+		if !seen[name] {
+			seen[name] = true
+			d.Providers = append(d.Providers, Providers[name])
+		}
+	}
+
+	var files []File
+	err := fs.WalkDir(templates, TemplateDir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel := strings.TrimPrefix(name, TemplateDir+"/")
+		out := strings.TrimSuffix(rel, ".tmpl")
+		if !o.wants(out) {
+			return nil
+		}
+		src, err := templates.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		dirs := []string{""}
+		if strings.HasPrefix(out, exampleDir+"/") {
+			dirs = o.Examples
+		}
+		for _, example := range dirs {
+			data, err := execute(rel, src, d)
+			if err != nil {
+				return err
+			}
+			p := out
+			if example != "" {
+				p = path.Join("examples", example, strings.TrimPrefix(out, exampleDir+"/"))
+			}
+			files = append(files, File{Path: p, Template: rel, Data: data})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	return files, nil
+}
+
+// wants reports whether o generates the file at out, relative to the
+// module.
+func (o Options) wants(out string) bool {
+	switch out {
+	case "test/plan_test.go":
+		return o.PlanTests
+	case "test/integration_test.go":
+		return o.IntegrationTests
+	}
+	if out == "Makefile" || strings.HasPrefix(out, "test/") {
+		return o.PlanTests || o.IntegrationTests
+	}
+
+	return true
+}
+
+func execute(name string, src []byte, d data) ([]byte, error) {
+	t, err := template.New(name).Funcs(template.FuncMap{"camel": camel}).Option("missingkey=error").Parse(string(src))
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, d); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// camel turns an example name into part of a Go identifier: with-ipam
+// becomes WithIpam.
+func camel(s string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range s {
+		if r == '-' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// Generate renders the template for o into a new directory named after
+// the module under modulesDir, and returns the module directory and the
+// files it wrote.
+func Generate(modulesDir string, o Options) (string, []File, error) {
+	files, err := Render(o)
+	if err != nil {
+		return "", nil, err
+	}
+	dir := filepath.Join(modulesDir, o.Name)
+	if _, err := os.Stat(dir); err == nil {
+		return "", nil, fmt.Errorf("module %s already exists", dir)
+	} else if !os.IsNotExist(err) {
+		return "", nil, err
+	}
+	for _, f := range files {
+		p := filepath.Join(dir, filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return "", nil, err
+		}
+		if err := os.WriteFile(p, f.Data, 0o644); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return dir, files, nil
+}
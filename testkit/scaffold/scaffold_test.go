@@ -0,0 +1,224 @@
+package scaffold
+
+import (
+	"bufio"
+	"bytes"
+	"go/format"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/modgraph"
+)
+
+func render(t *testing.T, o Options) map[string]string {
+	t.Helper()
+	files, err := Render(o)
+	require.NoError(t, err)
+	out := map[string]string{}
+	for _, f := range files {
+		out[f.Path] = string(f.Data)
+	}
+
+	return out
+}
+
+func paths(files map[string]string) []string {
+	var out []string
+	for p := range files {
+		out = append(out, p)
+	}
+
+	return out
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(*Options)
+		wantErr string
+	}{
+		{"defaults", func(*Options) {}, ""},
+		{"no name", func(o *Options) { o.Name = "" }, "no module name given"},
+		{"upper case", func(o *Options) { o.Name = "AWS-VPC" }, `module name "AWS-VPC" must match ^[0-9a-z-]*$`},
+		{"underscore", func(o *Options) { o.Name = "aws_vpc" }, `module name "aws_vpc" must match ^[0-9a-z-]*$`},
+		{"unknown provider", func(o *Options) { o.Providers = []string{"google"} }, `unknown provider "google"; use one of archive, aws, null, random, time, tls`},
+		{"no examples", func(o *Options) { o.Examples = nil }, "no examples given; the tests run the examples"},
+		{"example name", func(o *Options) { o.Examples = []string{"../simple"} }, `example name "../simple" must match ^[0-9a-z-]*$`},
+		{"example twice", func(o *Options) { o.Examples = []string{"simple", "simple"} }, `example "simple" given twice`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := Defaults("aws-widget")
+			tt.change(&o)
+			err := o.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestRenderDefaults(t *testing.T) {
+	files := render(t, Defaults("aws-widget"))
+	assert.ElementsMatch(t, []string{
+		".envrc", "Makefile", "main.tf", "outputs.tf", "variables.tf", "versions.tf",
+		"examples/simple/.envrc", "examples/simple/main.tf",
+		"test/go.mod", "test/go.sum", "test/plan_test.go", "test/integration_test.go",
+	}, paths(files))
+
+	assert.Equal(t, "source_up\n\nexport MODULE_NAME=\"aws-widget\"\n", files[".envrc"])
+	assert.Contains(t, files["versions.tf"], `    random = {
+      source  = "hashicorp/random"
+      version = "~>3"
+    }`)
+	assert.Contains(t, files["main.tf"], `resource "random_pet" "this"`)
+	assert.Contains(t, files["examples/simple/main.tf"], "provider \"random\" {}\n")
+
+	// Plan tests apply nothing; the live tests need an explicit target.
+	assert.Contains(t, files["Makefile"], "test:\n\tcd ../../testkit && go run ./cmd/tfmod test -repo .. -tags \"\" aws-widget\n")
+	assert.Contains(t, files["Makefile"], "test-integration:\n\tcd ../../testkit && go run ./cmd/tfmod test -repo .. aws-widget\n")
+	assert.Contains(t, files["test/integration_test.go"], "//go:build integration\n")
+	assert.NotContains(t, files["test/plan_test.go"], "//go:build")
+	assert.Contains(t, files["test/plan_test.go"], "func TestPlanSimpleExample(t *testing.T) {")
+	assert.Contains(t, files["test/plan_test.go"], `"github.com/JQUINONES82/terraform_modules/testkit/plan"`)
+
+	mod := files["test/go.mod"]
+	assert.True(t, strings.HasPrefix(mod, "module github.com/aws-widget/test\n\ngo 1.21\n"))
+	assert.Contains(t, mod, "\tgithub.com/JQUINONES82/terraform_modules/testkit v0.0.0\n")
+	assert.Contains(t, mod, "\tgithub.com/gruntwork-io/terratest v0.47.0\n")
+	assert.True(t, strings.HasSuffix(mod, ")\n\nreplace github.com/JQUINONES82/terraform_modules/testkit => ../../../testkit\n"))
+}
+
+func TestRenderOptions(t *testing.T) {
+	files := render(t, Options{
+		Name:      "aws-widget",
+		Providers: []string{"aws", "tls", "aws"},
+		Examples:  []string{"simple", "with-ipam"},
+		PlanTests: true,
+	})
+	assert.ElementsMatch(t, []string{
+		".envrc", "Makefile", "main.tf", "outputs.tf", "variables.tf", "versions.tf",
+		"examples/simple/.envrc", "examples/simple/main.tf",
+		"examples/with-ipam/.envrc", "examples/with-ipam/main.tf",
+		"test/go.mod", "test/go.sum", "test/plan_test.go",
+	}, paths(files))
+
+	assert.Equal(t, `/**
+  * <!-- Include all providers and version constraints for this module here.
+  *      Don't be too restrictive with the versions unless you have a good
+  *      reason... Consumers of the module can set more restrictive
+  *      constraints. -->
+*/
+
+terraform {
+  required_providers {
+    aws = {
+      source  = "hashicorp/aws"
+      version = "~> 5.0"
+    }
+    tls = {
+      source  = "hashicorp/tls"
+      version = "~> 4.0"
+    }
+  }
+}
+`, files["versions.tf"])
+	// Without random the placeholder needs no provider.
+	assert.Contains(t, files["main.tf"], `resource "terraform_data" "this"`)
+	assert.Contains(t, files["outputs.tf"], "value       = terraform_data.this.output\n")
+	assert.Contains(t, files["examples/with-ipam/main.tf"], "provider \"aws\" {}\n\nprovider \"tls\" {}\n")
+
+	assert.Contains(t, files["test/plan_test.go"], "func TestPlanWithIpamExample(t *testing.T) {")
+	assert.Contains(t, files["test/plan_test.go"], `TerraformDir: "../examples/with-ipam",`)
+	assert.NotContains(t, files["test/plan_test.go"], "testkit")
+	assert.NotContains(t, files["test/go.mod"], "testkit")
+	assert.NotContains(t, files["Makefile"], "test-integration")
+
+	files = render(t, Options{Name: "aws-widget", Examples: []string{"simple"}, Testkit: true})
+	assert.ElementsMatch(t, []string{
+		".envrc", "main.tf", "outputs.tf", "variables.tf", "versions.tf",
+		"examples/simple/.envrc", "examples/simple/main.tf",
+	}, paths(files))
+	assert.Contains(t, files["versions.tf"], "terraform {\n}\n")
+	assert.NotContains(t, files["examples/simple/main.tf"], "provider")
+}
+
+func TestRenderedFiles(t *testing.T) {
+	all := Defaults("aws-widget")
+	all.Providers = []string{"aws", "random"}
+	all.Examples = []string{"simple", "complete"}
+	for _, o := range []Options{all, {Name: "bare", Examples: []string{"simple"}, PlanTests: true}} {
+		files, err := Render(o)
+		require.NoError(t, err)
+		for _, f := range files {
+			switch {
+			case strings.HasSuffix(f.Path, ".go"):
+				formatted, err := format.Source(f.Data)
+				require.NoError(t, err, f.Path)
+				assert.Equal(t, string(formatted), string(f.Data), "%s is not gofmt-ed", f.Path)
+			case strings.HasSuffix(f.Path, ".tf"):
+				_, diags := hclparse.NewParser().ParseHCL(f.Data, f.Path)
+				assert.False(t, diags.HasErrors(), "%s: %s", f.Path, diags)
+			}
+		}
+	}
+}
+
+// TestGoSum checks that the pinned go.sum has a checksum for every
+// requirement of the pinned go.mod, and for the kit's own requirements.
+func TestGoSum(t *testing.T) {
+	files := render(t, Defaults("aws-widget"))
+	sums := map[string]bool{}
+	sc := bufio.NewScanner(strings.NewReader(files["test/go.sum"]))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		require.Len(t, fields, 3, sc.Text())
+		sums[fields[0]+" "+fields[1]] = true
+	}
+
+	kit, err := os.ReadFile("../go.mod")
+	require.NoError(t, err)
+	for _, mod := range [][]byte{[]byte(files["test/go.mod"]), kit} {
+		for _, line := range bytes.Split(mod, []byte("\n")) {
+			fields := strings.Fields(string(line))
+			if len(fields) < 2 || !strings.HasPrefix(fields[1], "v") || strings.Contains(fields[0], "JQUINONES82") || fields[0] == "go" {
+				continue
+			}
+			assert.True(t, sums[fields[0]+" "+fields[1]+"/go.mod"], "go.sum lacks %s %s/go.mod", fields[0], fields[1])
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	modules := t.TempDir()
+	dir, files, err := Generate(modules, Defaults("aws-widget"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(modules, "aws-widget"), dir)
+	for _, f := range files {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(f.Path)))
+		require.NoError(t, err)
+		assert.Equal(t, f.Data, data)
+	}
+
+	// The new module is a node of the module graph.
+	g, err := modgraph.Load(modules)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"hashicorp/random": "~>3"}, g.Modules["aws-widget"].Providers)
+	assert.Empty(t, modgraph.Check(g))
+
+	_, _, err = Generate(modules, Defaults("aws-widget"))
+	assert.EqualError(t, err, "module "+dir+" already exists")
+
+	_, _, err = Generate(modules, Defaults("AWS"))
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(modules, "AWS"))
+	assert.True(t, os.IsNotExist(err))
+}
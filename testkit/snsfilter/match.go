@@ -0,0 +1,232 @@
+package snsfilter
+
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Message attribute data types.
+const (
+	TypeString      = "String"
+	TypeStringArray = "String.Array"
+	TypeNumber      = "Number"
+	TypeBinary      = "Binary"
+)
+
+// Attribute is a message attribute as sent to Publish.
+type Attribute struct {
+	Type  string
+	Value string
+}
+
+// Message is what a publisher sends to the topic.
+type Message struct {
+	Attributes map[string]Attribute
+	// Body is the message; policies scoped to MessageBody match it only
+	// when it is a JSON object.
+	Body string
+}
+
+// Matches reports whether m passes the policy.
+func (p *Policy) Matches(m Message) bool {
+	if p.Scope == ScopeBody {
+		var body map[string]interface{}
+		dec := json.NewDecoder(strings.NewReader(m.Body))
+		dec.UseNumber()
+		if dec.Decode(&body) != nil {
+			return false
+		}
+		return p.root.matchBody(body)
+	}
+
+	return p.root.matchAttributes(m.Attributes)
+}
+
+func (o object) matchAttributes(attrs map[string]Attribute) bool {
+	for key, conds := range o.leaves {
+		attr, ok := attrs[key]
+		var values []interface{}
+		if ok {
+			values = attributeValues(attr)
+		}
+		if !matchAny(conds, ok, values) {
+			return false
+		}
+	}
+
+	return o.matchAlternatives(func(alt object) bool { return alt.matchAttributes(attrs) })
+}
+
+func (o object) matchBody(body map[string]interface{}) bool {
+	for key, conds := range o.leaves {
+		v, ok := body[key]
+		if !matchAny(conds, ok, bodyValues(v)) {
+			return false
+		}
+	}
+	for key, sub := range o.nested {
+		nested, ok := body[key].(map[string]interface{})
+		if !ok || !sub.matchBody(nested) {
+			return false
+		}
+	}
+
+	return o.matchAlternatives(func(alt object) bool { return alt.matchBody(body) })
+}
+
+func (o object) matchAlternatives(match func(object) bool) bool {
+	if len(o.alternatives) == 0 {
+		return true
+	}
+	for _, alt := range o.alternatives {
+		if match(alt) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// attributeValues returns the values an attribute offers to a policy:
+// strings and json.Numbers, or the elements of a String.Array. Binary
+// attributes are never matched.
+func attributeValues(a Attribute) []interface{} {
+	switch a.Type {
+	case TypeNumber:
+		return []interface{}{json.Number(a.Value)}
+	case TypeStringArray:
+		var elems []interface{}
+		dec := json.NewDecoder(strings.NewReader(a.Value))
+		dec.UseNumber()
+		if dec.Decode(&elems) != nil {
+			return nil
+		}
+		return elems
+	case TypeBinary:
+		return nil
+	}
+
+	return []interface{}{a.Value}
+}
+
+// bodyValues returns the values at a key of the body; an array offers
+// each of its elements.
+func bodyValues(v interface{}) []interface{} {
+	if list, ok := v.([]interface{}); ok {
+		return list
+	}
+
+	return []interface{}{v}
+}
+
+// matchAny reports whether a key passes any of its conditions. present
+// says whether the key was in the message at all.
+func matchAny(conds []condition, present bool, values []interface{}) bool {
+	for _, c := range conds {
+		if c.kind == kindExists {
+			if c.exists == present {
+				return true
+			}
+			continue
+		}
+		for _, v := range values {
+			if present && c.match(v) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (c condition) match(v interface{}) bool {
+	s, isStr := v.(string)
+	n, isNum := toNumber(v)
+	switch c.kind {
+	case kindExact:
+		switch {
+		case c.isNum:
+			return isNum && n == c.num
+		case c.bool != nil:
+			b, ok := v.(bool)
+			return ok && b == *c.bool
+		}
+		return isStr && s == c.str
+	case kindNull:
+		return v == nil
+	case kindPrefix:
+		return isStr && strings.HasPrefix(s, c.str)
+	case kindSuffix:
+		return isStr && strings.HasSuffix(s, c.str)
+	case kindIgnoreCase:
+		return isStr && strings.EqualFold(s, c.str)
+	case kindCIDR:
+		ip := net.ParseIP(s)
+		return isStr && ip != nil && c.ipnet.Contains(ip)
+	case kindNumeric:
+		if !isNum {
+			return false
+		}
+		for _, b := range c.ranges {
+			if !compare(n, b) {
+				return false
+			}
+		}
+		return true
+	case kindAnythingBut:
+		switch {
+		case c.negated != nil:
+			return isStr && !c.negated.match(s)
+		case len(c.nums) > 0:
+			if !isNum {
+				return true
+			}
+			for _, x := range c.nums {
+				if n == x {
+					return false
+				}
+			}
+			return true
+		}
+		if !isStr {
+			return true
+		}
+		for _, x := range c.strs {
+			if s == x {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(string(n), 64)
+
+	return f, err == nil
+}
+
+func compare(n float64, b bound) bool {
+	switch b.op {
+	case "=":
+		return n == b.num
+	case "<":
+		return n < b.num
+	case "<=":
+		return n <= b.num
+	case ">":
+		return n > b.num
+	case ">=":
+		return n >= b.num
+	}
+
+	return false
+}
@@ -0,0 +1,368 @@
+// Package snsfilter evaluates SNS subscription filter policies and
+// validates the subscriptions of a topic. Policy implements the filter
+// policy language (exact values, prefix, suffix, equals-ignore-case,
+// anything-but, numeric ranges, cidr, exists and $or) for both the
+// MessageAttributes and MessageBody scopes, so a test can assert which
+// subscribers of a planned topic receive a sample message.
+package snsfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Filter policy scopes.
+const (
+	ScopeAttributes = "MessageAttributes"
+	ScopeBody       = "MessageBody"
+)
+
+// Limits SNS places on a filter policy.
+const (
+	// MaxKeys is how many keys a policy may filter on.
+	MaxKeys = 5
+	// MaxCombinations caps the product of the number of values of each
+	// key, summed over the branches of $or.
+	MaxCombinations = 150
+	// MaxNumber bounds the numbers a policy may compare against.
+	MaxNumber = 1e9
+)
+
+// Policy is a parsed filter policy.
+type Policy struct {
+	Scope string
+	root  object
+}
+
+// object is a level of the policy: each key holds either conditions or,
+// in the MessageBody scope, a nested object. alternatives holds the
+// branches of $or.
+type object struct {
+	leaves       map[string][]condition
+	nested       map[string]object
+	alternatives []object
+}
+
+// condition is one element of a key's list. A value matches the key when
+// it matches any of the conditions.
+type condition struct {
+	kind string
+	// str, num and bool are the literal compared against; strs and nums
+	// hold the values of anything-but.
+	str    string
+	num    float64
+	isNum  bool
+	bool   *bool
+	strs   []string
+	nums   []float64
+	ranges []bound
+	exists bool
+	ipnet  *net.IPNet
+	// negated holds the prefix or suffix an anything-but excludes.
+	negated *condition
+}
+
+type bound struct {
+	op  string
+	num float64
+}
+
+// Condition kinds.
+const (
+	kindExact       = "exact"
+	kindNull        = "null"
+	kindPrefix      = "prefix"
+	kindSuffix      = "suffix"
+	kindIgnoreCase  = "equals-ignore-case"
+	kindAnythingBut = "anything-but"
+	kindNumeric     = "numeric"
+	kindExists      = "exists"
+	kindCIDR        = "cidr"
+)
+
+// Parse parses a filter policy for scope, which defaults to
+// MessageAttributes, and checks it against the limits SNS enforces.
+func Parse(policy, scope string) (*Policy, error) {
+	if scope == "" {
+		scope = ScopeAttributes
+	}
+	if scope != ScopeAttributes && scope != ScopeBody {
+		return nil, fmt.Errorf("filter policy scope %q must be %s or %s", scope, ScopeAttributes, ScopeBody)
+	}
+	var raw map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(policy))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("filter policy is not a JSON object: %w", err)
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("filter policy is empty")
+	}
+
+	p := &Policy{Scope: scope}
+	root, err := p.parseObject(raw, "")
+	if err != nil {
+		return nil, err
+	}
+	p.root = root
+	if n := len(root.paths("")); n > MaxKeys {
+		return nil, fmt.Errorf("filter policy uses %d keys; SNS allows %d", n, MaxKeys)
+	}
+	if n := root.combinations(); n > MaxCombinations {
+		return nil, fmt.Errorf("filter policy has %d combinations; SNS allows %d", n, MaxCombinations)
+	}
+
+	return p, nil
+}
+
+func (p *Policy) parseObject(raw map[string]interface{}, path string) (object, error) {
+	o := object{leaves: map[string][]condition{}, nested: map[string]object{}}
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		at := join(path, key)
+		switch v := raw[key].(type) {
+		case []interface{}:
+			if key == "$or" {
+				if len(v) < 2 {
+					return object{}, fmt.Errorf("%s: $or needs at least two alternatives", at)
+				}
+				for i, alt := range v {
+					m, ok := alt.(map[string]interface{})
+					if !ok || len(m) == 0 {
+						return object{}, fmt.Errorf("%s[%d]: $or alternatives must be objects", at, i)
+					}
+					sub, err := p.parseObject(m, path)
+					if err != nil {
+						return object{}, err
+					}
+					o.alternatives = append(o.alternatives, sub)
+				}
+				continue
+			}
+			if len(v) == 0 {
+				return object{}, fmt.Errorf("%s: list of conditions is empty", at)
+			}
+			for _, c := range v {
+				cond, err := p.parseCondition(c, at)
+				if err != nil {
+					return object{}, err
+				}
+				o.leaves[key] = append(o.leaves[key], cond)
+			}
+		case map[string]interface{}:
+			if p.Scope != ScopeBody {
+				return object{}, fmt.Errorf("%s: nested keys are only allowed with the %s scope", at, ScopeBody)
+			}
+			sub, err := p.parseObject(v, at)
+			if err != nil {
+				return object{}, err
+			}
+			o.nested[key] = sub
+		default:
+			return object{}, fmt.Errorf("%s: conditions must be a list", at)
+		}
+	}
+	return o, nil
+}
+
+func (p *Policy) parseCondition(c interface{}, at string) (condition, error) {
+	switch v := c.(type) {
+	case string:
+		return condition{kind: kindExact, str: v}, nil
+	case json.Number:
+		n, err := number(v, at)
+		return condition{kind: kindExact, num: n, isNum: true}, err
+	case bool:
+		if p.Scope != ScopeBody {
+			return condition{}, fmt.Errorf("%s: booleans can only be matched in the %s scope", at, ScopeBody)
+		}
+		return condition{kind: kindExact, bool: &v}, nil
+	case nil:
+		if p.Scope != ScopeBody {
+			return condition{}, fmt.Errorf("%s: null can only be matched in the %s scope", at, ScopeBody)
+		}
+		return condition{kind: kindNull}, nil
+	case map[string]interface{}:
+		if len(v) != 1 {
+			return condition{}, fmt.Errorf("%s: a condition object must have exactly one operator", at)
+		}
+		for op, arg := range v {
+			return p.parseOperator(op, arg, at)
+		}
+	}
+
+	return condition{}, fmt.Errorf("%s: unsupported condition %v", at, c)
+}
+
+func (p *Policy) parseOperator(op string, arg interface{}, at string) (condition, error) {
+	str, isStr := arg.(string)
+	switch op {
+	case kindPrefix, kindSuffix, kindIgnoreCase:
+		if !isStr || str == "" {
+			return condition{}, fmt.Errorf("%s: %s needs a non-empty string", at, op)
+		}
+		return condition{kind: op, str: str}, nil
+	case kindExists:
+		b, ok := arg.(bool)
+		if !ok {
+			return condition{}, fmt.Errorf("%s: exists needs true or false", at)
+		}
+		return condition{kind: kindExists, exists: b}, nil
+	case kindCIDR:
+		_, ipnet, err := net.ParseCIDR(str)
+		if !isStr || err != nil {
+			return condition{}, fmt.Errorf("%s: cidr needs an address block such as 10.0.0.0/24", at)
+		}
+		return condition{kind: kindCIDR, ipnet: ipnet}, nil
+	case kindNumeric:
+		list, ok := arg.([]interface{})
+		if !ok || len(list) != 2 && len(list) != 4 {
+			return condition{}, fmt.Errorf("%s: numeric needs one or two operator and value pairs", at)
+		}
+		c := condition{kind: kindNumeric}
+		for i := 0; i < len(list); i += 2 {
+			o, _ := list[i].(string)
+			n, ok := list[i+1].(json.Number)
+			switch {
+			case !ok:
+				return condition{}, fmt.Errorf("%s: numeric compares against numbers", at)
+			case o == "=" && len(list) == 2:
+			case o == "<" || o == "<=" || o == ">" || o == ">=":
+			default:
+				return condition{}, fmt.Errorf("%s: numeric operator %q is not valid here", at, o)
+			}
+			num, err := number(n, at)
+			if err != nil {
+				return condition{}, err
+			}
+			c.ranges = append(c.ranges, bound{o, num})
+		}
+		if len(c.ranges) == 2 {
+			lo, hi := c.ranges[0], c.ranges[1]
+			if !strings.HasPrefix(lo.op, ">") || !strings.HasPrefix(hi.op, "<") || lo.num > hi.num {
+				return condition{}, fmt.Errorf("%s: a numeric range is a lower bound (> or >=) then a higher upper bound (< or <=)", at)
+			}
+		}
+		return c, nil
+	case kindAnythingBut:
+		c := condition{kind: kindAnythingBut}
+		switch v := arg.(type) {
+		case string:
+			c.strs = []string{v}
+		case json.Number:
+			n, err := number(v, at)
+			if err != nil {
+				return condition{}, err
+			}
+			c.nums = []float64{n}
+		case []interface{}:
+			if len(v) == 0 {
+				return condition{}, fmt.Errorf("%s: anything-but list is empty", at)
+			}
+			for _, e := range v {
+				switch e := e.(type) {
+				case string:
+					c.strs = append(c.strs, e)
+				case json.Number:
+					n, err := number(e, at)
+					if err != nil {
+						return condition{}, err
+					}
+					c.nums = append(c.nums, n)
+				default:
+					return condition{}, fmt.Errorf("%s: anything-but lists strings or numbers", at)
+				}
+			}
+			if len(c.strs) > 0 && len(c.nums) > 0 {
+				return condition{}, fmt.Errorf("%s: anything-but cannot mix strings and numbers", at)
+			}
+		case map[string]interface{}:
+			neg, err := p.parseCondition(v, at)
+			if err != nil {
+				return condition{}, err
+			}
+			if neg.kind != kindPrefix && neg.kind != kindSuffix {
+				return condition{}, fmt.Errorf("%s: anything-but only nests prefix or suffix", at)
+			}
+			c.negated = &neg
+		default:
+			return condition{}, fmt.Errorf("%s: anything-but needs a value, a list or a prefix", at)
+		}
+		return c, nil
+	}
+
+	return condition{}, fmt.Errorf("%s: unknown operator %q", at, op)
+}
+
+func number(n json.Number, at string) (float64, error) {
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil || math.Abs(f) > MaxNumber {
+		return 0, fmt.Errorf("%s: %s is not a number between -%g and %g", at, n, MaxNumber, MaxNumber)
+	}
+
+	return f, nil
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// paths returns the distinct keys the object filters on, $or branches
+// included.
+func (o object) paths(prefix string) []string {
+	seen := map[string]bool{}
+	var add func(o object, prefix string)
+	add = func(o object, prefix string) {
+		for k := range o.leaves {
+			seen[join(prefix, k)] = true
+		}
+		for k, sub := range o.nested {
+			add(sub, join(prefix, k))
+		}
+		for _, alt := range o.alternatives {
+			add(alt, prefix)
+		}
+	}
+	add(o, prefix)
+
+	out := make([]string, 0, len(seen))
+	for k := range seen {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+func (o object) combinations() int {
+	n := 1
+	for _, conds := range o.leaves {
+		n *= len(conds)
+	}
+	for _, sub := range o.nested {
+		n *= sub.combinations()
+	}
+	if len(o.alternatives) > 0 {
+		sum := 0
+		for _, alt := range o.alternatives {
+			sum += alt.combinations()
+		}
+		n *= sum
+	}
+
+	return n
+}
@@ -0,0 +1,318 @@
+package snsfilter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan/plantest"
+)
+
+func str(v string) Attribute { return Attribute{Type: TypeString, Value: v} }
+func num(v string) Attribute { return Attribute{Type: TypeNumber, Value: v} }
+
+func TestMatchesAttributes(t *testing.T) {
+	tests := []struct {
+		policy string
+		attrs  map[string]Attribute
+		want   bool
+	}{
+		{`{"a": ["x", "y"]}`, map[string]Attribute{"a": str("y")}, true},
+		{`{"a": ["x"]}`, map[string]Attribute{"a": str("X")}, false},
+		{`{"a": ["x"]}`, nil, false},
+		{`{"a": ["x"], "b": ["y"]}`, map[string]Attribute{"a": str("x")}, false},
+		{`{"a": [{"prefix": "eu-"}]}`, map[string]Attribute{"a": str("eu-west-1")}, true},
+		{`{"a": [{"suffix": ".png"}]}`, map[string]Attribute{"a": str("cat.jpg")}, false},
+		{`{"a": [{"equals-ignore-case": "GOLD"}]}`, map[string]Attribute{"a": str("Gold")}, true},
+		{`{"a": [{"anything-but": ["x", "y"]}]}`, map[string]Attribute{"a": str("z")}, true},
+		{`{"a": [{"anything-but": ["x", "y"]}]}`, map[string]Attribute{"a": str("x")}, false},
+		{`{"a": [{"anything-but": "x"}]}`, nil, false},
+		{`{"a": [{"anything-but": {"prefix": "info"}}]}`, map[string]Attribute{"a": str("information")}, false},
+		{`{"a": [{"anything-but": 5}]}`, map[string]Attribute{"a": num("5.0")}, false},
+		{`{"a": [{"numeric": [">", 0, "<=", 10]}]}`, map[string]Attribute{"a": num("10")}, true},
+		{`{"a": [{"numeric": [">", 0, "<=", 10]}]}`, map[string]Attribute{"a": num("0")}, false},
+		{`{"a": [{"numeric": ["=", 3.5]}]}`, map[string]Attribute{"a": num("3.50")}, true},
+		{`{"a": [{"numeric": [">", 1]}]}`, map[string]Attribute{"a": str("2")}, false},
+		{`{"a": [5]}`, map[string]Attribute{"a": num("5")}, true},
+		{`{"a": [5]}`, map[string]Attribute{"a": str("5")}, false},
+		{`{"a": [{"exists": true}]}`, map[string]Attribute{"a": str("")}, true},
+		{`{"a": [{"exists": false}]}`, map[string]Attribute{"a": str("")}, false},
+		{`{"a": [{"exists": false}]}`, nil, true},
+		{`{"a": ["x", {"exists": false}]}`, nil, true},
+		{`{"ip": [{"cidr": "10.0.0.0/24"}]}`, map[string]Attribute{"ip": str("10.0.0.7")}, true},
+		{`{"ip": [{"cidr": "10.0.0.0/24"}]}`, map[string]Attribute{"ip": str("10.0.1.7")}, false},
+		{`{"a": ["x"]}`, map[string]Attribute{"a": {Type: TypeStringArray, Value: `["w", "x"]`}}, true},
+		{`{"a": [1]}`, map[string]Attribute{"a": {Type: TypeStringArray, Value: `["w", 1]`}}, true},
+		{`{"a": ["x"]}`, map[string]Attribute{"a": {Type: TypeBinary, Value: "eA=="}}, false},
+		{`{"$or": [{"a": ["x"]}, {"b": ["y"]}]}`, map[string]Attribute{"b": str("y")}, true},
+		{`{"c": ["z"], "$or": [{"a": ["x"]}, {"b": ["y"]}]}`, map[string]Attribute{"b": str("y")}, false},
+	}
+	for _, tt := range tests {
+		p, err := Parse(tt.policy, "")
+		require.NoError(t, err, tt.policy)
+		assert.Equal(t, tt.want, p.Matches(Message{Attributes: tt.attrs}), "%s with %v", tt.policy, tt.attrs)
+	}
+}
+
+func TestMatchesBody(t *testing.T) {
+	policy := `{
+  "order": {"total": [{"numeric": [">=", 1000]}], "gift": [false, null]},
+  "$or": [
+    {"customer": {"tier": ["new"]}},
+    {"tags": ["rush"]}
+  ]
+}`
+	p, err := Parse(policy, ScopeBody)
+	require.NoError(t, err)
+
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{`{"order": {"total": 1200, "gift": false}, "customer": {"tier": "new"}}`, true},
+		{`{"order": {"total": 1200, "gift": null}, "tags": ["rush", "fragile"]}`, true},
+		{`{"order": {"total": 1200, "gift": true}, "customer": {"tier": "new"}}`, false},
+		{`{"order": {"total": 999, "gift": false}, "customer": {"tier": "new"}}`, false},
+		{`{"order": {"total": 1200, "gift": false}, "customer": {"tier": "gold"}}`, false},
+		{`{"order": {"total": 1200, "gift": false}, "customer": "new"}`, false},
+		{`{"order": {"total": "1200", "gift": false}, "customer": {"tier": "new"}}`, false},
+		{`not json`, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, p.Matches(Message{Body: tt.body}), tt.body)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		policy, scope, err string
+	}{
+		{`[]`, "", "not a JSON object"},
+		{`{}`, "", "empty"},
+		{`{"a": ["x"]}`, "Body", "must be MessageAttributes or MessageBody"},
+		{`{"a": "x"}`, "", "a: conditions must be a list"},
+		{`{"a": []}`, "", "a: list of conditions is empty"},
+		{`{"a": {"b": ["x"]}}`, "", "nested keys are only allowed with the MessageBody scope"},
+		{`{"a": [true]}`, "", "booleans can only be matched in the MessageBody scope"},
+		{`{"a": [{"prefix": ""}]}`, "", "prefix needs a non-empty string"},
+		{`{"a": [{"wildcard": "x*"}]}`, "", `unknown operator "wildcard"`},
+		{`{"a": [{"prefix": "x", "suffix": "y"}]}`, "", "exactly one operator"},
+		{`{"a": [{"numeric": [">", 10, "<", 5]}]}`, "", "numeric range"},
+		{`{"a": [{"numeric": ["<", 10, ">", 5]}]}`, "", "numeric range"},
+		{`{"a": [{"numeric": ["!=", 10]}]}`, "", `numeric operator "!="`},
+		{`{"a": [{"numeric": [">", 2e9]}]}`, "", "is not a number between"},
+		{`{"a": [{"anything-but": ["x", 1]}]}`, "", "cannot mix"},
+		{`{"a": [{"anything-but": {"exists": true}}]}`, "", "only nests prefix or suffix"},
+		{`{"a": [{"exists": "yes"}]}`, "", "exists needs true or false"},
+		{`{"a": [{"cidr": "10.0.0.0"}]}`, "", "cidr needs an address block"},
+		{`{"$or": [{"a": ["x"]}]}`, "", "at least two alternatives"},
+		{`{"a": ["1"], "b": ["2"], "c": ["3"], "d": ["4"], "e": ["5"], "f": ["6"]}`, "", "uses 6 keys"},
+		{`{"a": ["1", "2", "3", "4", "5", "6"], "b": ["1", "2", "3", "4", "5"], "c": ["1", "2", "3", "4", "5", "6"]}`, "", "has 180 combinations"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.policy, tt.scope)
+		assert.ErrorContains(t, err, tt.err, tt.policy)
+	}
+}
+
+func loadTopics(t *testing.T) (events, stream *Topic) {
+	t.Helper()
+	for _, tp := range FromPlan(plantest.Load(t, "testdata/plan.json").Plan(t)) {
+		switch tp.Name {
+		case "order-events":
+			events = tp
+		case "orders.fifo":
+			stream = tp
+		}
+	}
+	require.NotNil(t, events)
+	require.NotNil(t, stream)
+
+	return events, stream
+}
+
+func TestDeliver(t *testing.T) {
+	events, stream := loadTopics(t)
+	require.Len(t, events.Subscriptions, 6)
+	require.Len(t, stream.Subscriptions, 1)
+
+	placed := Message{
+		Attributes: map[string]Attribute{
+			"event_type":    str("order_placed"),
+			"store":         str("eu-west-2"),
+			"customer_tier": str("Platinum"),
+			"amount":        num("750"),
+			"source_ip":     str("10.1.2.3"),
+		},
+		Body: `{"order": {"total": 750, "shipping": {"country": "DE"}}, "customer": {"tier": "gold"}}`,
+	}
+	assert.Equal(t, []string{"analytics", "fulfillment", "vip-desk", "webhook"}, events.Deliver(placed))
+
+	cancelled := Message{
+		Attributes: map[string]Attribute{
+			"event_type":    str("order_cancelled"),
+			"store":         str("us-east"),
+			"customer_tier": str("gold"),
+			"amount":        num("2500"),
+			"retry":         num("1"),
+			"severity":      str("critical"),
+		},
+		Body: `{"order": {"total": 2500, "shipping": {"country": "US"}}, "customer": {"tier": "new"}}`,
+	}
+	assert.Equal(t, []string{"analytics", "fraud", "oncall"}, events.Deliver(cancelled))
+
+	abroad := cancelled
+	abroad.Body = `{"order": {"total": 2500, "shipping": {"country": "MX"}}, "customer": {"tier": "gold"}}`
+	assert.Contains(t, events.Deliver(abroad), "fraud")
+
+	assert.Equal(t, []string{"ledger"}, stream.Deliver(Message{Body: "anything"}))
+	assert.Equal(t, ScopeBody, events.Subscription("fraud").Policy.Scope)
+	assert.Nil(t, events.Subscription("missing"))
+}
+
+const (
+	eventsTopic  = "module.order_events.aws_sns_topic.this[0]"
+	streamTopic  = "module.order_stream.aws_sns_topic.this[0]"
+	ledger       = `module.order_stream.aws_sns_topic_subscription.this["ledger"]`
+	fulfillment  = `module.order_events.aws_sns_topic_subscription.this["fulfillment"]`
+	vipDesk      = `module.order_events.aws_sns_topic_subscription.this["vip-desk"]`
+	webhook      = `module.order_events.aws_sns_topic_subscription.this["webhook"]`
+	analytics    = `module.order_events.aws_sns_topic_subscription.this["analytics"]`
+	eventsPrefix = `module.order_events.aws_sns_topic_subscription.this`
+)
+
+func TestCheckPlan(t *testing.T) {
+	findings := CheckPlan(plantest.Load(t, "testdata/plan.json").Plan(t))
+	assert.Empty(t, findings, findings.String())
+
+	tests := []struct {
+		name   string
+		breaks func(t *testing.T, f plantest.Fixture)
+		want   []plantest.Expected
+	}{
+		{
+			name: "fifo_topic not passed to the topic",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, streamTopic)["fifo_topic"] = false
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.High, RuleFIFO, streamTopic),
+				plantest.Want(finding.High, RuleFIFO, streamTopic),
+				plantest.Want(finding.High, RuleFIFO, ledger),
+				plantest.Want(finding.High, RuleRedrive, ledger),
+			},
+		},
+		{
+			name: "fifo name without suffix",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, streamTopic)["name"] = "orders"
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleFIFO, streamTopic)},
+		},
+		{
+			name: "fifo topic to email",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				v := f.Values(t, ledger)
+				v["protocol"], v["endpoint"], v["raw_message_delivery"], v["redrive_policy"] = "email", "ledger@company.com", false, nil
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleFIFO, ledger)},
+		},
+		{
+			name: "fifo topic to standard queue",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, "aws_sqs_queue.ledger")["fifo_queue"] = false
+				f.Values(t, "aws_sqs_queue.ledger")["name"] = "ledger"
+			},
+			want: []plantest.Expected{plantest.Want(finding.Medium, RuleFIFO, ledger)},
+		},
+		{
+			name: "standard topic to fifo queue",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, fulfillment)["endpoint"] = "arn:aws:sqs:us-east-1:111122223333:fulfillment.fifo"
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleFIFO, fulfillment)},
+		},
+		{
+			name: "bad endpoints",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, vipDesk)["endpoint"] = "vip-desk"
+				f.Values(t, webhook)["endpoint"] = "http://hooks.company.com/orders"
+				f.Values(t, eventsPrefix+`["oncall"]`)["endpoint"] = "555-0123"
+				f.Values(t, eventsPrefix+`["fraud"]`)["endpoint"] = "arn:aws:lambda:us-east-1:111122223333:fraud-check"
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.High, RuleEndpoint, vipDesk),
+				plantest.Want(finding.High, RuleEndpoint, webhook),
+				plantest.Want(finding.High, RuleEndpoint, eventsPrefix+`["oncall"]`),
+				plantest.Want(finding.High, RuleEndpoint, eventsPrefix+`["fraud"]`),
+			},
+		},
+		{
+			name: "firehose without role",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, analytics)["subscription_role_arn"] = nil
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleEndpoint, analytics)},
+		},
+		{
+			name: "firehose role known after apply",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, analytics)["subscription_role_arn"] = nil
+				f.Unknown(t, analytics)["subscription_role_arn"] = true
+			},
+			want: []plantest.Expected{plantest.Want(finding.Low, RuleUnknown, analytics)},
+		},
+		{
+			name: "unknown protocol",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, vipDesk)["protocol"] = "slack"
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleProtocol, vipDesk)},
+		},
+		{
+			name: "raw delivery to email",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, vipDesk)["raw_message_delivery"] = true
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleRawDelivery, vipDesk)},
+		},
+		{
+			name: "nested policy in attribute scope",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, eventsPrefix+`["fraud"]`)["filter_policy_scope"] = nil
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleFilterPolicy, eventsPrefix+`["fraud"]`)},
+		},
+		{
+			name: "redrive to a lambda",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, webhook)["redrive_policy"] = `{"deadLetterTargetArn": "arn:aws:lambda:us-east-1:111122223333:function:dlq"}`
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleRedrive, webhook)},
+		},
+		{
+			name: "content based deduplication on a standard topic",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, eventsTopic)["content_based_deduplication"] = true
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleFIFO, eventsTopic)},
+		},
+		{
+			name: "endpoint known after apply",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, vipDesk)["endpoint"] = nil
+			},
+			want: []plantest.Expected{plantest.Want(finding.Low, RuleUnknown, vipDesk)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := plantest.Load(t, "testdata/plan.json")
+			tt.breaks(t, f)
+			findings := CheckPlan(f.Plan(t))
+			plantest.AssertFindings(t, tt.want, findings)
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package snsfilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+// Rule identifiers reported by CheckPlan.
+const (
+	RuleProtocol     = "sns-subscription-protocol"
+	RuleEndpoint     = "sns-subscription-endpoint"
+	RuleFilterPolicy = "sns-subscription-filter-policy"
+	RuleRawDelivery  = "sns-subscription-raw-delivery"
+	RuleRedrive      = "sns-subscription-redrive-policy"
+	RuleFIFO         = "sns-topic-fifo"
+	RuleUnknown      = "sns-subscription-unknown"
+)
+
+// endpoints holds the endpoint format of each subscription protocol.
+var endpoints = map[string]*regexp.Regexp{
+	"email":       regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`),
+	"email-json":  regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`),
+	"sms":         regexp.MustCompile(`^\+?[1-9][0-9]{6,14}$`),
+	"http":        regexp.MustCompile(`^http://`),
+	"https":       regexp.MustCompile(`^https://`),
+	"sqs":         regexp.MustCompile(`^arn:aws[a-z-]*:sqs:[a-z0-9-]+:[0-9]{12}:[A-Za-z0-9_-]{1,80}(\.fifo)?$`),
+	"lambda":      regexp.MustCompile(`^arn:aws[a-z-]*:lambda:[a-z0-9-]+:[0-9]{12}:function:[A-Za-z0-9_-]{1,64}(:[A-Za-z0-9$_-]+)?$`),
+	"firehose":    regexp.MustCompile(`^arn:aws[a-z-]*:firehose:[a-z0-9-]+:[0-9]{12}:deliverystream/[A-Za-z0-9_.-]{1,64}$`),
+	"application": regexp.MustCompile(`^arn:aws[a-z-]*:sns:[a-z0-9-]+:[0-9]{12}:endpoint/[A-Z_]+/[^/]+/[0-9a-f-]+$`),
+}
+
+// rawDelivery lists the protocols that accept raw_message_delivery.
+var rawDelivery = map[string]bool{"sqs": true, "http": true, "https": true, "firehose": true}
+
+// Subscription is a planned aws_sns_topic_subscription.
+type Subscription struct {
+	// Key is the for_each key of the subscription, or its address when it
+	// has none.
+	Key     string
+	Address string
+
+	Protocol string
+	// Endpoint is empty when it is known only after apply.
+	Endpoint string
+
+	RawMessageDelivery bool
+	FilterPolicy       string
+	FilterPolicyScope  string
+	RedrivePolicy      string
+	// SubscriptionRoleARN is the role SNS assumes to write to Firehose.
+	SubscriptionRoleARN string
+	// roleUnknown is set when SubscriptionRoleARN is known only after
+	// apply.
+	roleUnknown bool
+
+	// Policy is the parsed filter policy; nil when there is none or it does
+	// not parse.
+	Policy *Policy
+
+	// queue is the SQS queue the subscription delivers to, when the plan
+	// manages it.
+	queue *plan.Resource
+}
+
+// Receives reports whether the subscription is sent m.
+func (s Subscription) Receives(m Message) bool {
+	if s.FilterPolicy == "" {
+		return true
+	}
+
+	return s.Policy != nil && s.Policy.Matches(m)
+}
+
+// Topic is a planned aws_sns_topic and its subscriptions.
+type Topic struct {
+	Address string
+	Name    string
+
+	FIFO                      bool
+	ContentBasedDeduplication bool
+
+	Subscriptions []Subscription
+}
+
+// Deliver returns the keys of the subscriptions that receive m, sorted.
+func (t *Topic) Deliver(m Message) []string {
+	var out []string
+	for _, s := range t.Subscriptions {
+		if s.Receives(m) {
+			out = append(out, s.Key)
+		}
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// Subscription returns the subscription with the given key, or nil.
+func (t *Topic) Subscription(key string) *Subscription {
+	for i := range t.Subscriptions {
+		if t.Subscriptions[i].Key == key {
+			return &t.Subscriptions[i]
+		}
+	}
+
+	return nil
+}
+
+// FromPlan returns every topic in p with its subscriptions. Subscriptions
+// whose topic_arn is known only after apply are matched to their topic
+// through the configuration.
+func FromPlan(p *tfjson.Plan) []*Topic {
+	topics, _ := fromPlan(p)
+
+	return topics
+}
+
+// CheckPlan validates the topics and subscriptions in p: the endpoint of
+// each protocol, filter policies, raw message delivery, redrive policies
+// and what FIFO topics may deliver to.
+func CheckPlan(p *tfjson.Plan) finding.List {
+	topics, findings := fromPlan(p)
+	add := func(s finding.Severity, rule, address, path, format string, args ...interface{}) {
+		findings = append(findings, finding.Finding{Severity: s, Rule: rule, Address: address, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, t := range topics {
+		switch {
+		case t.FIFO && t.Name != "" && !strings.HasSuffix(t.Name, ".fifo"):
+			add(finding.High, RuleFIFO, t.Address, "name", "FIFO topic %s must have a name ending in .fifo", t.Name)
+		case !t.FIFO && strings.HasSuffix(t.Name, ".fifo"):
+			add(finding.High, RuleFIFO, t.Address, "fifo_topic", "topic %s is named like a FIFO topic but fifo_topic is false", t.Name)
+		}
+		if !t.FIFO && t.ContentBasedDeduplication {
+			add(finding.High, RuleFIFO, t.Address, "content_based_deduplication", "content-based deduplication needs a FIFO topic")
+		}
+
+		for _, s := range t.Subscriptions {
+			checkSubscription(t, s, add)
+		}
+	}
+	findings.Sort()
+
+	return findings
+}
+
+type addFunc func(s finding.Severity, rule, address, path, format string, args ...interface{})
+
+func checkSubscription(t *Topic, s Subscription, add addFunc) {
+	format, ok := endpoints[s.Protocol]
+	switch {
+	case !ok:
+		add(finding.High, RuleProtocol, s.Address, "protocol", "protocol %q is not one SNS delivers to", s.Protocol)
+	case s.Endpoint == "" && s.queue == nil:
+		add(finding.Low, RuleUnknown, s.Address, "endpoint", "%s endpoint is known after apply and was not checked", s.Protocol)
+	case s.Endpoint != "" && !validEndpoint(s.Protocol, s.Endpoint, format):
+		add(finding.High, RuleEndpoint, s.Address, "endpoint", "%q is not a valid %s endpoint", s.Endpoint, s.Protocol)
+	}
+	if s.Protocol == "firehose" && s.SubscriptionRoleARN == "" {
+		if s.roleUnknown {
+			add(finding.Low, RuleUnknown, s.Address, "subscription_role_arn", "firehose subscription_role_arn is known after apply and was not checked")
+		} else {
+			add(finding.High, RuleEndpoint, s.Address, "subscription_role_arn", "firehose subscriptions need a subscription_role_arn that may write to the delivery stream")
+		}
+	}
+
+	if s.RawMessageDelivery && ok && !rawDelivery[s.Protocol] {
+		add(finding.High, RuleRawDelivery, s.Address, "raw_message_delivery", "raw message delivery is not supported for %s subscriptions", s.Protocol)
+	}
+
+	if s.FilterPolicy != "" {
+		if _, err := Parse(s.FilterPolicy, s.FilterPolicyScope); err != nil {
+			add(finding.High, RuleFilterPolicy, s.Address, "filter_policy", "%v", err)
+		}
+	} else if s.FilterPolicyScope != "" && s.FilterPolicyScope != ScopeAttributes {
+		add(finding.Low, RuleFilterPolicy, s.Address, "filter_policy_scope", "filter_policy_scope is %s but there is no filter policy", s.FilterPolicyScope)
+	}
+
+	if ok {
+		if fifo, known := s.fifoQueue(); s.Protocol == "sqs" && known {
+			switch {
+			case t.FIFO && !fifo:
+				add(finding.Medium, RuleFIFO, s.Address, "endpoint", "FIFO topic %s delivers to a standard queue, which loses ordering and deduplication", t.Name)
+			case !t.FIFO && fifo:
+				add(finding.High, RuleFIFO, s.Address, "endpoint", "standard topic %s cannot deliver to a FIFO queue", t.Name)
+			}
+		} else if t.FIFO && s.Protocol != "sqs" {
+			add(finding.High, RuleFIFO, s.Address, "protocol", "FIFO topic %s can only deliver to SQS queues, not %s", t.Name, s.Protocol)
+		}
+	}
+
+	if s.RedrivePolicy != "" {
+		checkRedrive(t, s, add)
+	}
+}
+
+func validEndpoint(protocol, endpoint string, format *regexp.Regexp) bool {
+	if !format.MatchString(endpoint) {
+		return false
+	}
+	if protocol == "http" || protocol == "https" {
+		u, err := url.Parse(endpoint)
+		return err == nil && u.Host != ""
+	}
+
+	return true
+}
+
+// fifoQueue reports whether the subscription's queue is a FIFO queue, and
+// whether that is known.
+func (s Subscription) fifoQueue() (fifo, known bool) {
+	if s.Endpoint != "" {
+		return strings.HasSuffix(s.Endpoint, ".fifo"), true
+	}
+	if s.queue != nil {
+		return s.queue.Bool("fifo_queue") || strings.HasSuffix(s.queue.String("name"), ".fifo"), true
+	}
+
+	return false, false
+}
+
+// checkRedrive checks the dead-letter queue of a subscription, which must
+// be an SQS queue of the same kind as the topic.
+func checkRedrive(t *Topic, s Subscription, add addFunc) {
+	var redrive struct {
+		DeadLetterTargetArn string `json:"deadLetterTargetArn"`
+	}
+	if err := json.Unmarshal([]byte(s.RedrivePolicy), &redrive); err != nil {
+		add(finding.High, RuleRedrive, s.Address, "redrive_policy", "redrive policy is not valid JSON: %v", err)
+		return
+	}
+	dlq := redrive.DeadLetterTargetArn
+	switch {
+	case !endpoints["sqs"].MatchString(dlq):
+		add(finding.High, RuleRedrive, s.Address, "redrive_policy", "deadLetterTargetArn %q is not an SQS queue ARN", dlq)
+	case t.FIFO && !strings.HasSuffix(dlq, ".fifo"):
+		add(finding.High, RuleRedrive, s.Address, "redrive_policy", "the dead-letter queue of a FIFO topic subscription must be a FIFO queue")
+	case !t.FIFO && strings.HasSuffix(dlq, ".fifo"):
+		add(finding.High, RuleRedrive, s.Address, "redrive_policy", "the dead-letter queue of a standard topic subscription cannot be a FIFO queue")
+	}
+}
+
+// fromPlan reads the topics of p. Subscriptions that match no topic are
+// reported as findings.
+func fromPlan(p *tfjson.Plan) ([]*Topic, finding.List) {
+	var findings finding.List
+	resources := plan.Resources(p)
+	ofType := func(typ string) []plan.Resource {
+		var out []plan.Resource
+		for _, r := range resources {
+			if r.Type == typ {
+				out = append(out, r)
+			}
+		}
+		return out
+	}
+
+	var topics []*Topic
+	byAddress := map[string]*Topic{}
+	for _, r := range ofType("aws_sns_topic") {
+		t := &Topic{
+			Address:                   r.Address,
+			Name:                      r.String("name"),
+			FIFO:                      r.Bool("fifo_topic"),
+			ContentBasedDeduplication: r.Bool("content_based_deduplication"),
+		}
+		topics = append(topics, t)
+		byAddress[r.Address] = t
+	}
+	topicOf := func(s plan.Resource) *Topic {
+		if arn := s.String("topic_arn"); arn != "" {
+			for _, r := range ofType("aws_sns_topic") {
+				if r.String("arn") == arn {
+					return byAddress[r.Address]
+				}
+			}
+			return nil
+		}
+		for _, ref := range plan.References(p, s, "topic_arn") {
+			for _, r := range ofType("aws_sns_topic") {
+				if ref == r.Address || ref == r.ModuleAddress {
+					return byAddress[r.Address]
+				}
+			}
+		}
+		return nil
+	}
+	queueOf := func(s plan.Resource) *plan.Resource {
+		for _, ref := range plan.References(p, s, "endpoint") {
+			for _, r := range ofType("aws_sqs_queue") {
+				if ref == r.Address || ref == r.ModuleAddress {
+					r := r
+					return &r
+				}
+			}
+		}
+		return nil
+	}
+
+	for _, r := range ofType("aws_sns_topic_subscription") {
+		s := Subscription{
+			Key:                 r.Address,
+			Address:             r.Address,
+			Protocol:            r.String("protocol"),
+			Endpoint:            r.String("endpoint"),
+			RawMessageDelivery:  r.Bool("raw_message_delivery"),
+			FilterPolicy:        r.String("filter_policy"),
+			FilterPolicyScope:   r.String("filter_policy_scope"),
+			RedrivePolicy:       r.String("redrive_policy"),
+			SubscriptionRoleARN: r.String("subscription_role_arn"),
+			roleUnknown:         r.IsUnknown("subscription_role_arn"),
+		}
+		if key, ok := r.Index.(string); ok {
+			s.Key = key
+		}
+		if s.FilterPolicy != "" {
+			s.Policy, _ = Parse(s.FilterPolicy, s.FilterPolicyScope)
+		}
+		if s.Endpoint == "" {
+			s.queue = queueOf(r)
+		}
+		t := topicOf(r)
+		if t == nil {
+			findings = append(findings, finding.Finding{Severity: finding.Low, Rule: RuleUnknown, Address: r.Address, Path: "topic_arn",
+				Message: "topic is not managed in this plan; the subscription was not checked against it"})
+			continue
+		}
+		t.Subscriptions = append(t.Subscriptions, s)
+	}
+
+	return topics, findings
+}
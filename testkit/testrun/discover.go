@@ -0,0 +1,95 @@
+// Package testrun runs the Terratest suites of every module in one pass.
+// Each module keeps its tests in a separate Go module under
+// modules/NAME/test; Discover finds them and a Runner runs them with
+// bounded concurrency under one Policy of build tags and timeout, in
+// place of each module's Makefile. The go test -json events are parsed
+// into per-test results as they stream, written as JUnit XML per module
+// and aggregated into a Summary.
+package testrun
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ModulesDir is the directory of the repository that holds the modules.
+const ModulesDir = "modules"
+
+// Suite is the test directory of one module.
+type Suite struct {
+	Module string
+	// Dir is the test directory on disk.
+	Dir string
+	// Path is the test directory relative to the repository.
+	Path string
+	// GoMod reports whether the directory is a Go module. Suites without
+	// a go.mod cannot be run as they are and are skipped.
+	GoMod bool
+}
+
+// Discover returns the suites of the modules under root's modules
+// directory, sorted by module: every test directory that holds a
+// _test.go file.
+func Discover(root string) ([]Suite, error) {
+	entries, err := os.ReadDir(filepath.Join(root, ModulesDir))
+	if err != nil {
+		return nil, err
+	}
+	var suites []Suite
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, ModulesDir, e.Name(), "test")
+		tests, err := filepath.Glob(filepath.Join(dir, "*_test.go"))
+		if err != nil {
+			return nil, err
+		}
+		if len(tests) == 0 {
+			continue
+		}
+		_, err = os.Stat(filepath.Join(dir, "go.mod"))
+		suites = append(suites, Suite{
+			Module: e.Name(),
+			Dir:    dir,
+			Path:   path.Join(ModulesDir, e.Name(), "test"),
+			GoMod:  err == nil,
+		})
+	}
+	sort.Slice(suites, func(i, j int) bool { return suites[i].Module < suites[j].Module })
+
+	return suites, nil
+}
+
+// Select returns the suites of the named modules, in suites order, or
+// every suite when no module is named.
+func Select(suites []Suite, modules []string) ([]Suite, error) {
+	if len(modules) == 0 {
+		return suites, nil
+	}
+	want := map[string]bool{}
+	for _, m := range modules {
+		want[m] = true
+	}
+	var out []Suite
+	for _, s := range suites {
+		if want[s.Module] {
+			out = append(out, s)
+			delete(want, s.Module)
+		}
+	}
+	if len(want) > 0 {
+		var missing []string
+		for m := range want {
+			missing = append(missing, m)
+		}
+		sort.Strings(missing)
+		return nil, fmt.Errorf("no test suite for %s", strings.Join(missing, ", "))
+	}
+
+	return out, nil
+}
@@ -0,0 +1,196 @@
+package testrun
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+)
+
+// Event is one line of go test -json output, as cmd/test2json documents it.
+type Event struct {
+	Time    time.Time `json:",omitempty"`
+	Action  string
+	Package string  `json:",omitempty"`
+	Test    string  `json:",omitempty"`
+	Elapsed float64 `json:",omitempty"`
+	Output  string  `json:",omitempty"`
+}
+
+// Status is the outcome of a test or a suite.
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusFail Status = "fail"
+	StatusSkip Status = "skip"
+	// StatusError is a suite that could not run its tests: it failed to
+	// build, or go test failed outside any test. A suite without a go.mod
+	// is skipped instead.
+	StatusError Status = "error"
+)
+
+// TestResult is the outcome of one test or subtest.
+type TestResult struct {
+	Package string
+	// Name is the test's name, with subtests as TestX/case.
+	Name    string
+	Status  Status
+	Elapsed time.Duration
+	// Output is what the test printed, including go test's own
+	// === RUN and --- FAIL lines.
+	Output string
+}
+
+// Top reports whether the result is a top-level test rather than a
+// subtest.
+func (t TestResult) Top() bool {
+	return !strings.Contains(t.Name, "/")
+}
+
+// SuiteResult is the outcome of running one suite.
+type SuiteResult struct {
+	Suite
+	Status  Status
+	Started time.Time
+	Elapsed time.Duration
+	// Tests are in the order they started.
+	Tests []TestResult
+	// Output is what the suite printed outside any test: build errors,
+	// package output and go test's standard error.
+	Output string
+}
+
+// Count returns how many tests, subtests included, ended with status.
+func (r *SuiteResult) Count(status Status) int {
+	n := 0
+	for _, t := range r.Tests {
+		if t.Status == status {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Parse reads a recorded go test -json stream for s. Lines that are not
+// JSON events, such as go: downloading messages, become suite output.
+func Parse(s Suite, r io.Reader) (*SuiteResult, error) {
+	c := newCollector(s)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		c.line(sc.Bytes())
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	res := c.finish(nil, "")
+	res.Elapsed = time.Duration(c.elapsed * float64(time.Second))
+
+	return res, nil
+}
+
+// collector builds a SuiteResult from events as they arrive.
+type collector struct {
+	res      *SuiteResult
+	index    map[[2]string]int
+	output   []*strings.Builder
+	pkgOut   strings.Builder
+	packages map[string]Status
+	// elapsed is the sum of the packages' elapsed seconds.
+	elapsed float64
+	events  int
+}
+
+func newCollector(s Suite) *collector {
+	return &collector{
+		res:      &SuiteResult{Suite: s},
+		index:    map[[2]string]int{},
+		packages: map[string]Status{},
+	}
+}
+
+// line adds one line of go test -json output, returning the event it
+// holds, if any.
+func (c *collector) line(b []byte) (Event, bool) {
+	var e Event
+	if !bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) || json.Unmarshal(b, &e) != nil || e.Action == "" {
+		c.pkgOut.Write(b)
+		c.pkgOut.WriteByte('\n')
+		return Event{}, false
+	}
+	c.events++
+	c.add(e)
+
+	return e, true
+}
+
+func (c *collector) add(e Event) {
+	if e.Test == "" {
+		switch e.Action {
+		case "output", "build-output":
+			c.pkgOut.WriteString(e.Output)
+		case "pass", "fail", "skip":
+			c.packages[e.Package] = Status(e.Action)
+			c.elapsed += e.Elapsed
+		}
+		return
+	}
+	key := [2]string{e.Package, e.Test}
+	i, ok := c.index[key]
+	if !ok {
+		i = len(c.res.Tests)
+		c.index[key] = i
+		c.res.Tests = append(c.res.Tests, TestResult{Package: e.Package, Name: e.Test})
+		c.output = append(c.output, &strings.Builder{})
+	}
+	switch e.Action {
+	case "output":
+		c.output[i].WriteString(e.Output)
+	case "pass", "fail", "skip":
+		c.res.Tests[i].Status = Status(e.Action)
+		c.res.Tests[i].Elapsed = time.Duration(e.Elapsed * float64(time.Second))
+	}
+}
+
+// finish completes the result once go test has exited with runErr,
+// having printed stderr.
+func (c *collector) finish(runErr error, stderr string) *SuiteResult {
+	res := c.res
+	failed, passed := false, false
+	for i := range res.Tests {
+		t := &res.Tests[i]
+		t.Output = c.output[i].String()
+		if t.Status == "" {
+			// go test was killed, or panicked, before the test ended.
+			t.Status = StatusFail
+		}
+		failed = failed || t.Status == StatusFail
+		passed = passed || t.Status == StatusPass
+	}
+	res.Output = c.pkgOut.String() + stderr
+
+	pkgFailed := false
+	for _, status := range c.packages {
+		pkgFailed = pkgFailed || status == StatusFail
+	}
+	switch {
+	case failed:
+		res.Status = StatusFail
+	case runErr != nil && c.events == 0 && strings.Contains(stderr, "matched no packages"):
+		// The build tags exclude every test file.
+		res.Status = StatusSkip
+	case pkgFailed, runErr != nil:
+		res.Status = StatusError
+	case !passed:
+		// No test files for the build tags, or every test skipped.
+		res.Status = StatusSkip
+	default:
+		res.Status = StatusPass
+	}
+
+	return res
+}
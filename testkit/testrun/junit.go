@@ -0,0 +1,170 @@
+package testrun
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// JUnit XML, as CI test reporters read it: a testsuites element per
+// module with a testsuite per Go package.
+type (
+	junitSuites struct {
+		XMLName  xml.Name     `xml:"testsuites"`
+		Name     string       `xml:"name,attr"`
+		Tests    int          `xml:"tests,attr"`
+		Failures int          `xml:"failures,attr"`
+		Errors   int          `xml:"errors,attr"`
+		Skipped  int          `xml:"skipped,attr"`
+		Time     string       `xml:"time,attr"`
+		Suites   []junitSuite `xml:"testsuite"`
+	}
+	junitSuite struct {
+		Name      string      `xml:"name,attr"`
+		Tests     int         `xml:"tests,attr"`
+		Failures  int         `xml:"failures,attr"`
+		Errors    int         `xml:"errors,attr"`
+		Skipped   int         `xml:"skipped,attr"`
+		Time      string      `xml:"time,attr"`
+		Timestamp string      `xml:"timestamp,attr,omitempty"`
+		Cases     []junitCase `xml:"testcase"`
+		SystemOut string      `xml:"system-out,omitempty"`
+	}
+	junitCase struct {
+		Classname string        `xml:"classname,attr"`
+		Name      string        `xml:"name,attr"`
+		Time      string        `xml:"time,attr"`
+		Failure   *junitMessage `xml:"failure"`
+		Error     *junitMessage `xml:"error"`
+		Skipped   *junitMessage `xml:"skipped"`
+		SystemOut string        `xml:"system-out,omitempty"`
+	}
+	junitMessage struct {
+		Message string `xml:"message,attr"`
+		Body    string `xml:",chardata"`
+	}
+)
+
+// WriteJUnit writes res as JUnit XML. A suite that could not run its
+// tests is reported as one errored test case holding its output, and a
+// suite skipped for want of a go.mod as one skipped test case.
+func WriteJUnit(w io.Writer, res *SuiteResult) error {
+	doc := junitSuites{Name: res.Module, Time: seconds(res.Elapsed)}
+	var timestamp string
+	if !res.Started.IsZero() {
+		timestamp = res.Started.UTC().Format(time.RFC3339)
+	}
+	packages := map[string]*junitSuite{}
+	var order []string
+	suite := func(pkg string) *junitSuite {
+		if s, ok := packages[pkg]; ok {
+			return s
+		}
+		packages[pkg] = &junitSuite{Name: pkg, Timestamp: timestamp}
+		order = append(order, pkg)
+		return packages[pkg]
+	}
+	for _, t := range res.Tests {
+		s := suite(t.Package)
+		c := junitCase{Classname: t.Package, Name: t.Name, Time: seconds(t.Elapsed)}
+		switch t.Status {
+		case StatusFail:
+			c.Failure = &junitMessage{Message: "Failed", Body: t.Output}
+			s.Failures++
+		case StatusSkip:
+			c.Skipped = &junitMessage{Message: "Skipped", Body: t.Output}
+			s.Skipped++
+		default:
+			c.SystemOut = t.Output
+		}
+		s.Tests++
+		s.Cases = append(s.Cases, c)
+	}
+	if res.Status == StatusError {
+		s := suite(res.Path)
+		s.Tests++
+		s.Errors++
+		s.Cases = append(s.Cases, junitCase{
+			Classname: res.Path,
+			Name:      res.Module,
+			Time:      seconds(0),
+			Error:     &junitMessage{Message: firstLine(res.Output), Body: res.Output},
+		})
+	} else if res.Status == StatusSkip && !res.GoMod {
+		s := suite(res.Path)
+		s.Tests++
+		s.Skipped++
+		s.Cases = append(s.Cases, junitCase{
+			Classname: res.Path,
+			Name:      res.Module,
+			Time:      seconds(0),
+			Skipped:   &junitMessage{Message: firstLine(res.Output), Body: res.Output},
+		})
+	} else if res.Output != "" {
+		s := suite(res.Path)
+		s.SystemOut = res.Output
+	}
+
+	for _, pkg := range order {
+		s := packages[pkg]
+		var elapsed time.Duration
+		for _, t := range res.Tests {
+			if t.Package == pkg && t.Top() {
+				elapsed += t.Elapsed
+			}
+		}
+		s.Time = seconds(elapsed)
+		doc.Tests += s.Tests
+		doc.Failures += s.Failures
+		doc.Errors += s.Errors
+		doc.Skipped += s.Skipped
+		doc.Suites = append(doc.Suites, *s)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
+
+// WriteJUnitDir writes each result to dir as MODULE.xml, creating dir.
+func WriteJUnitDir(dir string, results []*SuiteResult) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, res := range results {
+		f, err := os.Create(filepath.Join(dir, res.Module+".xml"))
+		if err != nil {
+			return err
+		}
+		err = WriteJUnit(f, res)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
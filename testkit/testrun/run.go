@@ -0,0 +1,159 @@
+package testrun
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy is how every suite runs, whatever its Makefile does.
+type Policy struct {
+	// Tags are the build tags, so that tests behind //go:build
+	// integration run.
+	Tags []string
+	// Timeout is go test's -timeout for each suite; zero leaves go
+	// test's default.
+	Timeout time.Duration
+	// Run, when set, selects tests as go test -run does.
+	Run string
+}
+
+// DefaultPolicy runs the integration tests with the module template's
+// one-hour timeout.
+var DefaultPolicy = Policy{Tags: []string{"integration"}, Timeout: time.Hour}
+
+// Args returns the go command arguments that run a suite under p. Test
+// results are never cached, since the tests create real infrastructure,
+// and -mod=mod fills in missing go.sum entries, as the Makefiles' go mod
+// tidy did.
+func (p Policy) Args() []string {
+	args := []string{"test", "-json", "-count=1", "-mod=mod"}
+	if len(p.Tags) > 0 {
+		args = append(args, "-tags", strings.Join(p.Tags, ","))
+	}
+	if p.Timeout > 0 {
+		args = append(args, "-timeout", p.Timeout.String())
+	}
+	if p.Run != "" {
+		args = append(args, "-run", p.Run)
+	}
+
+	return append(args, "./...")
+}
+
+// timeoutGrace is how long past the policy's timeout a suite may run
+// before it is killed. go test panics a test binary that overruns its
+// -timeout itself; the grace covers the build and a binary that hangs
+// anyway.
+const timeoutGrace = 5 * time.Minute
+
+// Runner runs suites under a Policy.
+type Runner struct {
+	Policy Policy
+	// Parallel bounds how many suites run at once; one when zero.
+	Parallel int
+	// Go is the go command, "go" when empty.
+	Go string
+	// Env is added to the environment go test runs with.
+	Env []string
+	// Events, when set, is called with each event as it streams in.
+	Events func(Suite, Event)
+	// Done, when set, is called with each suite's result as it finishes.
+	// Calls to Events and Done are never concurrent.
+	Done func(*SuiteResult)
+
+	mu sync.Mutex
+}
+
+// Run runs the suites, starting them in order, and returns their results
+// in the same order.
+func (r *Runner) Run(ctx context.Context, suites []Suite) []*SuiteResult {
+	results := make([]*SuiteResult, len(suites))
+	workers := r.Parallel
+	if workers < 1 {
+		workers = 1
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = r.run(ctx, suites[i])
+				if r.Done != nil {
+					r.mu.Lock()
+					r.Done(results[i])
+					r.mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range suites {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	return results
+}
+
+func (r *Runner) run(ctx context.Context, s Suite) *SuiteResult {
+	c := newCollector(s)
+	started := time.Now()
+	done := func(err error, stderr string) *SuiteResult {
+		res := c.finish(err, stderr)
+		res.Started = started
+		res.Elapsed = time.Since(started)
+		return res
+	}
+	if !s.GoMod {
+		return done(nil, s.Path+" has no go.mod\n")
+	}
+
+	if r.Policy.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Policy.Timeout+timeoutGrace)
+		defer cancel()
+	}
+	goCmd := r.Go
+	if goCmd == "" {
+		goCmd = "go"
+	}
+	cmd := exec.CommandContext(ctx, goCmd, r.Policy.Args()...)
+	cmd.Dir = s.Dir
+	cmd.Env = append(os.Environ(), r.Env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return done(err, err.Error()+"\n")
+	}
+	if err := cmd.Start(); err != nil {
+		return done(err, err.Error()+"\n")
+	}
+	sc := bufio.NewScanner(stdout)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		e, ok := c.line(sc.Bytes())
+		if ok && r.Events != nil {
+			r.mu.Lock()
+			r.Events(s, e)
+			r.mu.Unlock()
+		}
+	}
+	_, _ = io.Copy(io.Discard, stdout)
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		fmt.Fprintf(&stderr, "go test killed: %v\n", ctx.Err())
+	}
+
+	return done(err, stderr.String())
+}
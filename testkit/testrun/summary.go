@@ -0,0 +1,161 @@
+package testrun
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Summary aggregates the results of a run. Test counts include subtests,
+// as the JUnit reports do.
+type Summary struct {
+	Modules []ModuleSummary `json:"modules"`
+	Passed  int             `json:"passed"`
+	Failed  int             `json:"failed"`
+	Skipped int             `json:"skipped"`
+	// Errors counts the suites that could not run their tests.
+	Errors int `json:"errors"`
+	// Seconds is the wall time from the first suite's start to the last
+	// suite's end, or the sum of the suites' times when they have no
+	// start times.
+	Seconds float64 `json:"seconds"`
+	// Slowest are the slowest top-level tests that ran, slowest first.
+	Slowest []SlowTest `json:"slowest"`
+}
+
+// ModuleSummary is the outcome of one module's suite.
+type ModuleSummary struct {
+	Module  string  `json:"module"`
+	Status  Status  `json:"status"`
+	Passed  int     `json:"passed"`
+	Failed  int     `json:"failed"`
+	Skipped int     `json:"skipped"`
+	Seconds float64 `json:"seconds"`
+	// Error is the first line of the output of a suite that could not
+	// run its tests.
+	Error string `json:"error,omitempty"`
+	// Reason is why a suite without a go.mod was skipped.
+	Reason string `json:"reason,omitempty"`
+}
+
+// SlowTest is a top-level test and how long it ran.
+type SlowTest struct {
+	Module  string  `json:"module"`
+	Test    string  `json:"test"`
+	Seconds float64 `json:"seconds"`
+}
+
+// Summarize aggregates results, keeping the slowest top-level tests.
+func Summarize(results []*SuiteResult, slowest int) *Summary {
+	s := &Summary{Modules: []ModuleSummary{}, Slowest: []SlowTest{}}
+	var first, last time.Time
+	var total time.Duration
+	var slow []SlowTest
+	for _, res := range results {
+		m := ModuleSummary{
+			Module:  res.Module,
+			Status:  res.Status,
+			Passed:  res.Count(StatusPass),
+			Failed:  res.Count(StatusFail),
+			Skipped: res.Count(StatusSkip),
+			Seconds: secs(res.Elapsed),
+		}
+		switch {
+		case res.Status == StatusError:
+			m.Error = firstLine(res.Output)
+			s.Errors++
+		case res.Status == StatusSkip && !res.GoMod:
+			m.Reason = firstLine(res.Output)
+		}
+		s.Modules = append(s.Modules, m)
+		s.Passed += m.Passed
+		s.Failed += m.Failed
+		s.Skipped += m.Skipped
+		total += res.Elapsed
+
+		if !res.Started.IsZero() {
+			if first.IsZero() || res.Started.Before(first) {
+				first = res.Started
+			}
+			if end := res.Started.Add(res.Elapsed); end.After(last) {
+				last = end
+			}
+		}
+		for _, t := range res.Tests {
+			if t.Top() && t.Status != StatusSkip {
+				slow = append(slow, SlowTest{Module: res.Module, Test: t.Name, Seconds: secs(t.Elapsed)})
+			}
+		}
+	}
+	if !first.IsZero() {
+		s.Seconds = secs(last.Sub(first))
+	} else {
+		// Parsed results have no start times.
+		s.Seconds = secs(total)
+	}
+	sort.SliceStable(slow, func(i, j int) bool { return slow[i].Seconds > slow[j].Seconds })
+	if len(slow) > slowest {
+		slow = slow[:slowest]
+	}
+	s.Slowest = append(s.Slowest, slow...)
+
+	return s
+}
+
+// OK reports whether no test failed and every suite ran.
+func (s *Summary) OK() bool {
+	return s.Failed == 0 && s.Errors == 0
+}
+
+// JSON returns the summary as indented JSON.
+func (s *Summary) JSON() ([]byte, error) {
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// String renders the summary as a table of modules, the totals and the
+// slowest tests.
+func (s *Summary) String() string {
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODULE\tSTATUS\tPASS\tFAIL\tSKIP\tTIME")
+	for _, m := range s.Modules {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%s\n", m.Module, m.Status, m.Passed, m.Failed, m.Skipped, duration(m.Seconds))
+	}
+	tw.Flush()
+	fmt.Fprintf(&b, "\n%d passed, %d failed, %d skipped", s.Passed, s.Failed, s.Skipped)
+	if s.Errors > 0 {
+		fmt.Fprintf(&b, ", %d modules could not run", s.Errors)
+	}
+	fmt.Fprintf(&b, " in %s\n", duration(s.Seconds))
+	for _, m := range s.Modules {
+		if m.Error != "" {
+			fmt.Fprintf(&b, "%s: %s\n", m.Module, m.Error)
+		}
+		if m.Reason != "" {
+			fmt.Fprintf(&b, "%s: skipped, %s\n", m.Module, m.Reason)
+		}
+	}
+	if len(s.Slowest) > 0 {
+		fmt.Fprintln(&b, "\nslowest:")
+		tw = tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+		for _, t := range s.Slowest {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", duration(t.Seconds), t.Module, t.Test)
+		}
+		tw.Flush()
+	}
+
+	return b.String()
+}
+
+// secs returns d in seconds, to the millisecond.
+func secs(d time.Duration) float64 {
+	return math.Round(d.Seconds()*1000) / 1000
+}
+
+func duration(seconds float64) time.Duration {
+	return (time.Duration(seconds * float64(time.Second))).Round(100 * time.Millisecond)
+}
@@ -0,0 +1,17 @@
+package test
+
+import "testing"
+
+func TestPass(t *testing.T) {
+	t.Log("planned")
+}
+
+func TestSkip(t *testing.T) {
+	t.Skip("no credentials")
+}
+
+func TestExamples(t *testing.T) {
+	for _, name := range []string{"simple", "complete"} {
+		t.Run(name, func(t *testing.T) {})
+	}
+}
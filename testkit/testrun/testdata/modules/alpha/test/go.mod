@@ -0,0 +1,3 @@
+module alpha/test
+
+go 1.21
@@ -0,0 +1,11 @@
+//go:build integration
+
+package test
+
+import "testing"
+
+func TestApply(t *testing.T) {
+	t.Error("apply failed")
+}
+
+func TestPlan(t *testing.T) {}
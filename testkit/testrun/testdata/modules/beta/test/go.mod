@@ -0,0 +1,3 @@
+module beta/test
+
+go 1.21
@@ -0,0 +1,5 @@
+package test
+
+import "testing"
+
+func TestNoModule(t *testing.T) {}
@@ -0,0 +1 @@
+# A module without tests.
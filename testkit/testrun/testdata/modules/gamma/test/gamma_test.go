@@ -0,0 +1,7 @@
+package test
+
+import "testing"
+
+func TestBroken(t *testing.T) {
+	undefined()
+}
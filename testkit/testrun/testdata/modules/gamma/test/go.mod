@@ -0,0 +1,3 @@
+module gamma/test
+
+go 1.21
@@ -0,0 +1,255 @@
+package testrun
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixtureRoot holds small test modules: alpha passes, beta fails behind
+// the integration tag, gamma does not build and delta has no go.mod.
+const fixtureRoot = "testdata"
+
+func parse(t *testing.T, module string) *SuiteResult {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata/events", module+".jsonl"))
+	require.NoError(t, err)
+	defer f.Close()
+	res, err := Parse(Suite{Module: module, Path: "modules/" + module + "/test", GoMod: true}, f)
+	require.NoError(t, err)
+
+	return res
+}
+
+func modules(suites []Suite) []string {
+	var out []string
+	for _, s := range suites {
+		out = append(out, s.Module)
+	}
+
+	return out
+}
+
+func TestDiscover(t *testing.T) {
+	suites, err := Discover(fixtureRoot)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alpha", "beta", "delta", "gamma"}, modules(suites))
+	assert.Equal(t, Suite{Module: "alpha", Dir: filepath.Join("testdata", "modules", "alpha", "test"), Path: "modules/alpha/test", GoMod: true}, suites[0])
+	assert.False(t, suites[2].GoMod)
+
+	// The repository's modules, whose Makefiles the runner replaces.
+	suites, err = Discover("../..")
+	require.NoError(t, err)
+	byName := map[string]Suite{}
+	for _, s := range suites {
+		byName[s.Module] = s
+	}
+	assert.Len(t, suites, 18)
+	assert.True(t, byName["aws-vpc"].GoMod)
+	assert.False(t, byName["aws-iam-policy"].GoMod)
+	assert.NotContains(t, byName, "aws-sns-topic")
+}
+
+func TestSelect(t *testing.T) {
+	suites, err := Discover(fixtureRoot)
+	require.NoError(t, err)
+
+	got, err := Select(suites, []string{"gamma", "alpha"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alpha", "gamma"}, modules(got))
+
+	got, err = Select(suites, nil)
+	require.NoError(t, err)
+	assert.Equal(t, suites, got)
+
+	_, err = Select(suites, []string{"alpha", "zeta", "epsilon"})
+	assert.EqualError(t, err, "no test suite for epsilon, zeta")
+}
+
+func TestPolicyArgs(t *testing.T) {
+	assert.Equal(t, []string{"test", "-json", "-count=1", "-mod=mod", "-tags", "integration", "-timeout", "1h0m0s", "./..."}, DefaultPolicy.Args())
+	p := Policy{Tags: []string{"integration", "slow"}, Timeout: 30 * time.Minute, Run: "TestExamples"}
+	assert.Equal(t, []string{"test", "-json", "-count=1", "-mod=mod", "-tags", "integration,slow", "-timeout", "30m0s", "-run", "TestExamples", "./..."}, p.Args())
+	assert.Equal(t, []string{"test", "-json", "-count=1", "-mod=mod", "./..."}, Policy{}.Args())
+}
+
+func TestParse(t *testing.T) {
+	res := parse(t, "aws-vpc")
+	assert.Equal(t, StatusFail, res.Status)
+	assert.Equal(t, 1158100*time.Millisecond, res.Elapsed)
+
+	type want struct {
+		name    string
+		status  Status
+		elapsed time.Duration
+	}
+	var got []want
+	for _, test := range res.Tests {
+		got = append(got, want{test.Name, test.Status, test.Elapsed})
+	}
+	assert.Equal(t, []want{
+		{"TestExamplesSimple", StatusPass, 312400 * time.Millisecond},
+		{"TestExamplesComplete", StatusFail, 845 * time.Second},
+		{"TestExamplesComplete/plan", StatusPass, 40200 * time.Millisecond},
+		{"TestExamplesComplete/apply", StatusFail, 801500 * time.Millisecond},
+		{"TestIPAM", StatusSkip, 0},
+	}, got)
+	assert.Equal(t, "=== RUN   TestExamplesComplete/apply\n    integration_test.go:42: subnet count: expected 6, got 4\n--- FAIL: TestExamplesComplete/apply (801.50s)\n", res.Tests[3].Output)
+	assert.Equal(t, "go: downloading github.com/gruntwork-io/terratest v0.46.7\nFAIL\nFAIL\tgithub.com/aws-vpc/test\t1158.100s\n", res.Output)
+	assert.Equal(t, 2, res.Count(StatusPass))
+	assert.Equal(t, 2, res.Count(StatusFail))
+	assert.Equal(t, 1, res.Count(StatusSkip))
+}
+
+func TestParseTimeout(t *testing.T) {
+	// The test binary panicked before the test ended.
+	res := parse(t, "aws-tgw")
+	assert.Equal(t, StatusFail, res.Status)
+	require.Len(t, res.Tests, 1)
+	assert.Equal(t, StatusFail, res.Tests[0].Status)
+	assert.Contains(t, res.Output, "panic: test timed out after 1h0m0s")
+}
+
+func TestRun(t *testing.T) {
+	suites, err := Discover(fixtureRoot)
+	require.NoError(t, err)
+	events := map[string]int{}
+	var done []string
+	r := &Runner{
+		Policy:   DefaultPolicy,
+		Parallel: 2,
+		Events:   func(s Suite, e Event) { events[s.Module]++ },
+		Done:     func(res *SuiteResult) { done = append(done, res.Module) },
+	}
+	results := r.Run(context.Background(), suites)
+	require.Len(t, results, 4)
+
+	statuses := map[string]Status{}
+	for _, res := range results {
+		statuses[res.Module] = res.Status
+		assert.False(t, res.Started.IsZero())
+	}
+	assert.Equal(t, map[string]Status{"alpha": StatusPass, "beta": StatusFail, "delta": StatusSkip, "gamma": StatusError}, statuses)
+	assert.ElementsMatch(t, []string{"alpha", "beta", "delta", "gamma"}, done)
+	assert.Positive(t, events["alpha"])
+	assert.Zero(t, events["delta"])
+
+	alpha := results[0]
+	assert.Equal(t, 4, alpha.Count(StatusPass))
+	assert.Equal(t, 1, alpha.Count(StatusSkip))
+	assert.Equal(t, "alpha/test", alpha.Tests[0].Package)
+	assert.Equal(t, "modules/delta/test has no go.mod\n", results[2].Output)
+	assert.Contains(t, results[3].Output, "undefined: undefined")
+
+	// Without the integration tag beta has no tests to run.
+	r = &Runner{Policy: Policy{Timeout: time.Minute}}
+	beta, err := Select(suites, []string{"beta"})
+	require.NoError(t, err)
+	results = r.Run(context.Background(), beta)
+	assert.Equal(t, StatusSkip, results[0].Status)
+	assert.Empty(t, results[0].Tests)
+	assert.Contains(t, results[0].Output, "no packages to test")
+}
+
+func TestJUnit(t *testing.T) {
+	var b bytes.Buffer
+	require.NoError(t, WriteJUnit(&b, parse(t, "aws-tgw")))
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="aws-tgw" tests="1" failures="1" errors="0" skipped="0" time="3600.200">
+  <testsuite name="github.com/aws-tgw/test" tests="1" failures="1" errors="0" skipped="0" time="0.000">
+    <testcase classname="github.com/aws-tgw/test" name="TestTransitGateway" time="0.000">
+      <failure message="Failed">=== RUN   TestTransitGateway&#xA;</failure>
+    </testcase>
+  </testsuite>
+  <testsuite name="modules/aws-tgw/test" tests="0" failures="0" errors="0" skipped="0" time="0.000">
+    <system-out>panic: test timed out after 1h0m0s&#xA;FAIL&#x9;github.com/aws-tgw/test&#x9;3600.200s&#xA;</system-out>
+  </testsuite>
+</testsuites>
+`, b.String())
+
+	b.Reset()
+	require.NoError(t, WriteJUnit(&b, parse(t, "aws-vpc")))
+	var doc junitSuites
+	require.NoError(t, xml.Unmarshal(b.Bytes(), &doc))
+	assert.Equal(t, []int{5, 2, 0, 1}, []int{doc.Tests, doc.Failures, doc.Errors, doc.Skipped})
+	require.Len(t, doc.Suites, 2)
+	vpc := doc.Suites[0]
+	assert.Equal(t, "1157.400", vpc.Time)
+	assert.Equal(t, "TestExamplesComplete/apply", vpc.Cases[3].Name)
+	assert.Contains(t, vpc.Cases[3].Failure.Body, "expected 6, got 4")
+	assert.Contains(t, vpc.Cases[4].Skipped.Body, "IPAM_POOL_ID is not set")
+
+	// A suite that could not run is one errored case.
+	b.Reset()
+	require.NoError(t, WriteJUnit(&b, &SuiteResult{
+		Suite:  Suite{Module: "aws-tgw", Path: "modules/aws-tgw/test", GoMod: true},
+		Status: StatusError,
+		Output: "main_test.go:3:2: undefined: undefined\n",
+	}))
+	assert.Contains(t, b.String(), `<testcase classname="modules/aws-tgw/test" name="aws-tgw" time="0.000">
+      <error message="main_test.go:3:2: undefined: undefined">main_test.go:3:2: undefined: undefined&#xA;</error>`)
+
+	// A suite without a go.mod is one skipped case.
+	b.Reset()
+	require.NoError(t, WriteJUnit(&b, &SuiteResult{
+		Suite:  Suite{Module: "aws-iam-role", Path: "modules/aws-iam-role/test"},
+		Status: StatusSkip,
+		Output: "modules/aws-iam-role/test has no go.mod\n",
+	}))
+	assert.Contains(t, b.String(), `<testsuite name="modules/aws-iam-role/test" tests="1" failures="0" errors="0" skipped="1" time="0.000">
+    <testcase classname="modules/aws-iam-role/test" name="aws-iam-role" time="0.000">
+      <skipped message="modules/aws-iam-role/test has no go.mod">modules/aws-iam-role/test has no go.mod&#xA;</skipped>`)
+
+	dir := filepath.Join(t.TempDir(), "junit")
+	require.NoError(t, WriteJUnitDir(dir, []*SuiteResult{parse(t, "aws-tgw"), parse(t, "aws-vpc")}))
+	files, err := filepath.Glob(filepath.Join(dir, "*.xml"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "aws-tgw.xml"), filepath.Join(dir, "aws-vpc.xml")}, files)
+}
+
+func TestSummary(t *testing.T) {
+	results := []*SuiteResult{
+		parse(t, "aws-tgw"),
+		parse(t, "aws-vpc"),
+		{Suite: Suite{Module: "aws-iam-role"}, Status: StatusSkip, Output: "modules/aws-iam-role/test has no go.mod\n"},
+		{Suite: Suite{Module: "gamma", GoMod: true}, Status: StatusError, Output: "main_test.go:3:2: undefined: undefined\n"},
+	}
+	s := Summarize(results, 2)
+	assert.False(t, s.OK())
+	assert.Equal(t, `MODULE        STATUS  PASS  FAIL  SKIP  TIME
+aws-tgw       fail    0     1     0     1h0m0.2s
+aws-vpc       fail    2     2     1     19m18.1s
+aws-iam-role  skip    0     0     0     0s
+gamma         error   0     0     0     0s
+
+2 passed, 3 failed, 1 skipped, 1 modules could not run in 1h19m18.3s
+aws-iam-role: skipped, modules/aws-iam-role/test has no go.mod
+gamma: main_test.go:3:2: undefined: undefined
+
+slowest:
+  14m5s    aws-vpc  TestExamplesComplete
+  5m12.4s  aws-vpc  TestExamplesSimple
+`, s.String())
+
+	data, err := s.JSON()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"slowest": [
+    {
+      "module": "aws-vpc",
+      "test": "TestExamplesComplete",
+      "seconds": 845
+    },`)
+
+	s = Summarize(nil, 5)
+	assert.True(t, s.OK())
+	data, err = s.JSON()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"modules": [], "passed": 0, "failed": 0, "skipped": 0, "errors": 0, "seconds": 0, "slowest": []}`, string(data))
+}
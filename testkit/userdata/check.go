@@ -0,0 +1,115 @@
+package userdata
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"mvdan.cc/sh/v3/syntax"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+)
+
+// Rule identifiers reported by Check.
+const (
+	RuleDecode      = "userdata-decode"
+	RuleCloudConfig = "userdata-cloud-config"
+	RuleShell       = "userdata-shell"
+	RuleSize        = "userdata-size"
+	RuleECS         = "userdata-ecs-config"
+)
+
+// MaxSize is the EC2 limit on user data before base64 encoding.
+const MaxSize = 16384
+
+// ECSConfig is the file the ECS agent reads its configuration from.
+const ECSConfig = "/etc/ecs/ecs.config"
+
+// CheckPlan checks the user data of every resource in p.
+func CheckPlan(p *tfjson.Plan) finding.List {
+	var findings finding.List
+	for _, u := range FromPlan(p) {
+		findings = append(findings, Check(u)...)
+	}
+	findings.Sort()
+
+	return findings
+}
+
+// Check reports user data that cloud-init would reject or ignore,
+// cloud-config that does not match the schema, shell scripts that do not
+// parse, and an ECS agent configuration without ECS_CLUSTER.
+func Check(u *UserData) finding.List {
+	var findings finding.List
+	add := func(s finding.Severity, rule, path, format string, args ...interface{}) {
+		findings = append(findings, finding.Finding{Severity: s, Rule: rule, Address: u.Address, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case u.Unknown:
+		add(finding.Low, RuleDecode, "user_data", "user data is known only after apply and was not checked")
+		return findings
+	case u.Err != nil:
+		add(finding.High, RuleDecode, "user_data", "%v", u.Err)
+		return findings
+	}
+	if len(u.Raw) > MaxSize {
+		add(finding.High, RuleSize, "user_data", "user data is %d bytes, over the EC2 limit of %d; gzip it or fetch the rest at boot", len(u.Raw), MaxSize)
+	}
+
+	for _, p := range u.Parts {
+		switch p.Type {
+		case "":
+			add(finding.High, RuleDecode, p.Name, "cloud-init ignores this part: it starts with neither #cloud-config nor #!")
+		case CloudConfig:
+			checkCloudConfig(p, add)
+		}
+	}
+	for _, s := range u.Scripts() {
+		checkScript(s, add)
+	}
+
+	if env := u.Env(ECSConfig); env != nil && env["ECS_CLUSTER"] == "" {
+		add(finding.High, RuleECS, ECSConfig, "%s sets no ECS_CLUSTER, so the ECS agent registers the instance with the default cluster", ECSConfig)
+	}
+
+	return findings
+}
+
+type addFunc func(s finding.Severity, rule, path, format string, args ...interface{})
+
+func checkCloudConfig(p Part, add addFunc) {
+	doc, err := parseCloudConfig(p.Content)
+	if err != nil {
+		add(finding.High, RuleCloudConfig, p.Name, "cloud-config is not valid YAML: %v", err)
+		return
+	}
+	if doc == nil {
+		add(finding.Medium, RuleCloudConfig, p.Name, "cloud-config is empty")
+		return
+	}
+	cloudConfigSchema.validate("", doc, func(v violation) {
+		severity := finding.High
+		if v.unknown && !strings.Contains(v.path, ".") && !strings.Contains(v.path, "[") {
+			// cloud-init warns about and skips top-level keys no module
+			// handles.
+			severity = finding.Medium
+		}
+		add(severity, RuleCloudConfig, v.path, "%s", v.message)
+	})
+}
+
+func checkScript(s Script, add addFunc) {
+	if !strings.HasPrefix(s.Content, "#!") {
+		add(finding.Medium, RuleShell, s.Name, "the shebang is not on the first line, so it is ignored and the script runs under /bin/sh without its options")
+	}
+	if _, err := parseScript(s); err != nil {
+		var pe syntax.ParseError
+		if errors.As(err, &pe) {
+			add(finding.High, RuleShell, s.Name, "line %d: %s", pe.Pos.Line(), pe.Text)
+			return
+		}
+		add(finding.High, RuleShell, s.Name, "%v", err)
+	}
+}
@@ -0,0 +1,338 @@
+package userdata
+
+import (
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/internal/hint"
+)
+
+// schema is the subset of JSON Schema the cloud-init schema uses.
+type schema struct {
+	Type                 types              `json:"type"`
+	Ref                  string             `json:"$ref"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Required             []string           `json:"required"`
+	Items                *schema            `json:"items"`
+	Enum                 []interface{}      `json:"enum"`
+	Definitions          map[string]*schema `json:"definitions"`
+}
+
+// types is a JSON Schema type, a name or a list of names.
+type types []string
+
+func (t *types) UnmarshalJSON(data []byte) error {
+	var name string
+	if json.Unmarshal(data, &name) == nil {
+		*t = types{name}
+		return nil
+	}
+
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+//go:embed schema.json
+var schemaJSON []byte
+
+// cloudConfigSchema is the schema of the cloud-config modules the kit
+// knows, after cloud-init's schema-cloud-config-v1.json.
+var cloudConfigSchema = func() *schema {
+	var s schema
+	if err := json.Unmarshal(schemaJSON, &s); err != nil {
+		panic(fmt.Sprintf("parsing cloud-config schema: %v", err))
+	}
+	var resolve func(*schema) *schema
+	resolve = func(n *schema) *schema {
+		if n == nil {
+			return nil
+		}
+		if n.Ref != "" {
+			def, ok := s.Definitions[n.Ref]
+			if !ok {
+				panic(fmt.Sprintf("cloud-config schema: no definition %s", n.Ref))
+			}
+			return resolve(def)
+		}
+		for k, p := range n.Properties {
+			n.Properties[k] = resolve(p)
+		}
+		n.Items = resolve(n.Items)
+		return n
+	}
+
+	return resolve(&s)
+}()
+
+// violation is where a cloud-config document does not match the schema.
+type violation struct {
+	path    string
+	message string
+	// unknown is set for keys the schema does not know.
+	unknown bool
+}
+
+func (s *schema) validate(path string, v interface{}, report func(violation)) {
+	typ := typeOf(v)
+	if len(s.Type) > 0 && !s.accepts(typ) {
+		report(violation{path: path, message: fmt.Sprintf("must be %s, not %s", strings.Join(s.Type, " or "), describe(v))})
+		return
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			found = found || fmt.Sprint(e) == fmt.Sprint(v)
+		}
+		if !found {
+			allowed := make([]string, len(s.Enum))
+			for i, e := range s.Enum {
+				allowed[i] = fmt.Sprint(e)
+			}
+			report(violation{path: path, message: fmt.Sprintf("must be one of %s, not %v", strings.Join(allowed, ", "), v)})
+		}
+	}
+	switch v := v.(type) {
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, report)
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := join(path, k)
+			if prop, ok := s.Properties[k]; ok {
+				prop.validate(p, v[k], report)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				report(violation{path: p, message: fmt.Sprintf("unknown key %q%s", k, hint.DidYouMean(k, s.propertyNames())), unknown: true})
+			}
+		}
+		for _, k := range s.Required {
+			if _, ok := v[k]; !ok {
+				report(violation{path: path, message: fmt.Sprintf("missing required key %q", k)})
+			}
+		}
+	}
+}
+
+func (s *schema) accepts(typ string) bool {
+	for _, t := range s.Type {
+		if t == typ || t == "number" && typ == "integer" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *schema) propertyNames() []string {
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func typeOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int64, uint64:
+		return "integer"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	}
+
+	return "object"
+}
+
+func describe(v interface{}) string {
+	switch typeOf(v) {
+	case "null":
+		return "null"
+	case "string":
+		return fmt.Sprintf("string %q", v)
+	case "array", "object":
+		return "an " + typeOf(v)
+	}
+
+	return fmt.Sprintf("%s %v", typeOf(v), v)
+}
+
+// parseCloudConfig parses a #cloud-config document.
+func parseCloudConfig(content string) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// CloudConfig returns the cloud-config parts of u merged the way
+// cloud-init merges them by default: a later part's keys replace an
+// earlier part's. Parts that do not parse are left out.
+func (u *UserData) CloudConfig() map[string]interface{} {
+	var merged map[string]interface{}
+	for _, p := range u.Parts {
+		if p.Type != CloudConfig {
+			continue
+		}
+		doc, err := parseCloudConfig(p.Content)
+		if err != nil {
+			continue
+		}
+		if merged == nil {
+			merged = map[string]interface{}{}
+		}
+		for k, v := range doc {
+			merged[k] = v
+		}
+	}
+
+	return merged
+}
+
+// File is a file the user data writes.
+type File struct {
+	Path    string
+	Content string
+	Append  bool
+	// Permissions are as given, such as "0755", empty when not set.
+	Permissions string
+	// Source is where the file is written: write_files[0], or a script
+	// and line.
+	Source string
+}
+
+// Files returns the files u writes in the order cloud-init writes them:
+// write_files, then redirections of echo, printf and cat here-documents
+// in bootcmd, runcmd and shell script parts.
+func (u *UserData) Files() []File {
+	var files []File
+	if cc := u.CloudConfig(); cc != nil {
+		items, _ := cc["write_files"].([]interface{})
+		for i, item := range items {
+			m, _ := item.(map[string]interface{})
+			path, _ := m["path"].(string)
+			if path == "" {
+				continue
+			}
+			content, _ := m["content"].(string)
+			encoding, _ := m["encoding"].(string)
+			if decoded, err := decodeContent(content, encoding); err == nil {
+				content = decoded
+			}
+			appendTo, _ := m["append"].(bool)
+			perms := ""
+			if p, ok := m["permissions"]; ok {
+				perms = fmt.Sprint(p)
+			}
+			files = append(files, File{Path: path, Content: content, Append: appendTo, Permissions: perms, Source: fmt.Sprintf("write_files[%d]", i)})
+		}
+	}
+	for _, s := range u.Scripts() {
+		if f, err := parseScript(s); err == nil {
+			files = append(files, writes(s, f)...)
+		}
+	}
+
+	return files
+}
+
+// File returns the content u leaves in path, and whether it writes path
+// at all.
+func (u *UserData) File(path string) (string, bool) {
+	content, found := "", false
+	for _, f := range u.Files() {
+		if f.Path != path {
+			continue
+		}
+		if f.Append {
+			content += f.Content
+		} else {
+			content = f.Content
+		}
+		found = true
+	}
+
+	return content, found
+}
+
+// Env parses the KEY=value lines of the file u leaves in path, such as
+// /etc/ecs/ecs.config. It returns nil when u does not write path.
+func (u *UserData) Env(path string) map[string]string {
+	content, ok := u.File(path)
+	if !ok {
+		return nil
+	}
+	env := map[string]string{}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		k, v, ok := strings.Cut(line, "=")
+		if !ok || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		env[strings.TrimSpace(k)] = v
+	}
+
+	return env
+}
+
+// decodeContent decodes write_files content by its encoding.
+func decodeContent(content, encoding string) (string, error) {
+	data := []byte(content)
+	var err error
+	if strings.Contains(encoding, "b64") || strings.Contains(encoding, "base64") {
+		if data, err = base64.StdEncoding.DecodeString(strings.TrimSpace(content)); err != nil {
+			return "", err
+		}
+	}
+	if strings.HasPrefix(encoding, "gz") {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return "", err
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return "", err
+		}
+	}
+
+	return string(data), nil
+}
@@ -0,0 +1,198 @@
+package userdata
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Script is a shell script the user data runs.
+type Script struct {
+	// Name says where the script comes from: a part name, runcmd,
+	// bootcmd or a write_files entry.
+	Name    string
+	Content string
+}
+
+// Scripts returns the shell scripts of u: shell script and boothook
+// parts, the scripts cloud-init builds from bootcmd and runcmd, and
+// write_files content that starts with a shebang.
+func (u *UserData) Scripts() []Script {
+	var scripts []Script
+	for _, p := range u.Parts {
+		if p.Type == ShellScript || p.Type == Boothook {
+			scripts = append(scripts, Script{Name: p.Name, Content: p.Content})
+		}
+	}
+	cc := u.CloudConfig()
+	for _, key := range []string{"bootcmd", "runcmd"} {
+		if cmds, ok := cc[key].([]interface{}); ok && len(cmds) > 0 {
+			scripts = append(scripts, Script{Name: key, Content: shellify(cmds)})
+		}
+	}
+	items, _ := cc["write_files"].([]interface{})
+	for i, item := range items {
+		m, _ := item.(map[string]interface{})
+		content, _ := m["content"].(string)
+		encoding, _ := m["encoding"].(string)
+		if decoded, err := decodeContent(content, encoding); err == nil {
+			content = decoded
+		}
+		if strings.HasPrefix(strings.TrimLeft(content, " \t\r\n"), "#!") {
+			scripts = append(scripts, Script{Name: fmt.Sprintf("write_files[%d] (%v)", i, m["path"]), Content: content})
+		}
+	}
+
+	return scripts
+}
+
+// shellify builds the script cloud-init runs for runcmd or bootcmd: a
+// string entry is a line of the script as is, a list entry a command
+// whose words are quoted.
+func shellify(cmds []interface{}) string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	for _, cmd := range cmds {
+		switch cmd := cmd.(type) {
+		case string:
+			b.WriteString(cmd)
+		case []interface{}:
+			words := make([]string, len(cmd))
+			for i, w := range cmd {
+				words[i] = "'" + strings.ReplaceAll(fmt.Sprint(w), "'", `'\''`) + "'"
+			}
+			b.WriteString(strings.Join(words, " "))
+		default:
+			// cloud-init refuses the whole script; the schema check
+			// reports the entry.
+			continue
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// parseScript parses s as bash, the shell behind /bin/sh on Amazon Linux,
+// or as mksh when its shebang asks for it.
+func parseScript(s Script) (*syntax.File, error) {
+	lang := syntax.LangBash
+	if first, _, _ := strings.Cut(s.Content, "\n"); strings.HasPrefix(first, "#!") && strings.Contains(first, "mksh") {
+		lang = syntax.LangMirBSDKorn
+	}
+
+	return syntax.NewParser(syntax.Variant(lang)).Parse(strings.NewReader(s.Content), s.Name)
+}
+
+// writes returns the files f writes with echo, printf, cat here-documents
+// and tee, as far as their content can be read from the script.
+func writes(s Script, f *syntax.File) []File {
+	var files []File
+	syntax.Walk(f, func(node syntax.Node) bool {
+		switch n := node.(type) {
+		case *syntax.Stmt:
+			content, ok := stmtOutput(n)
+			if !ok {
+				return true
+			}
+			for _, r := range n.Redirs {
+				if r.N != nil && r.N.Value != "1" {
+					continue
+				}
+				if r.Op == syntax.RdrOut || r.Op == syntax.AppOut || r.Op == syntax.ClbOut {
+					files = append(files, File{Path: text(r.Word), Content: content, Append: r.Op == syntax.AppOut, Source: fmt.Sprintf("%s line %d", s.Name, n.Pos().Line())})
+				}
+			}
+		case *syntax.BinaryCmd:
+			if n.Op != syntax.Pipe && n.Op != syntax.PipeAll {
+				return true
+			}
+			content, ok := stmtOutput(n.X)
+			tee, isCall := n.Y.Cmd.(*syntax.CallExpr)
+			if !ok || !isCall || len(tee.Args) < 2 || tee.Args[0].Lit() != "tee" {
+				return true
+			}
+			appendTo := false
+			for _, arg := range tee.Args[1:] {
+				switch a := text(arg); {
+				case a == "-a" || a == "--append":
+					appendTo = true
+				case strings.HasPrefix(a, "-"):
+				default:
+					files = append(files, File{Path: a, Content: content, Append: appendTo, Source: fmt.Sprintf("%s line %d", s.Name, n.Pos().Line())})
+				}
+			}
+		}
+		return true
+	})
+
+	return files
+}
+
+// stmtOutput returns what an echo, printf or cat of a here-document
+// prints.
+func stmtOutput(st *syntax.Stmt) (string, bool) {
+	call, ok := st.Cmd.(*syntax.CallExpr)
+	if !ok || len(call.Args) == 0 {
+		return "", false
+	}
+	args := make([]string, len(call.Args)-1)
+	for i, a := range call.Args[1:] {
+		args[i] = text(a)
+	}
+	switch call.Args[0].Lit() {
+	case "echo":
+		newline := "\n"
+		for len(args) > 0 && (args[0] == "-n" || args[0] == "-e" || args[0] == "-ne" || args[0] == "-en") {
+			if strings.Contains(args[0], "n") {
+				newline = ""
+			}
+			args = args[1:]
+		}
+		return strings.Join(args, " ") + newline, true
+	case "printf":
+		if len(args) == 0 || strings.ContainsRune(args[0], '%') {
+			return "", false
+		}
+		return strings.NewReplacer(`\n`, "\n", `\t`, "\t").Replace(args[0]), true
+	case "cat":
+		for _, r := range st.Redirs {
+			if (r.Op == syntax.Hdoc || r.Op == syntax.DashHdoc) && r.Hdoc != nil {
+				return text(r.Hdoc), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// text returns the value of a word after quote removal, with expansions
+// left as they are written, such as ${name}.
+func text(w *syntax.Word) string {
+	if w == nil {
+		return ""
+	}
+	var b strings.Builder
+	var parts func([]syntax.WordPart)
+	parts = func(ps []syntax.WordPart) {
+		for _, p := range ps {
+			switch p := p.(type) {
+			case *syntax.Lit:
+				b.WriteString(p.Value)
+			case *syntax.SglQuoted:
+				b.WriteString(p.Value)
+			case *syntax.DblQuoted:
+				parts(p.Parts)
+			default:
+				var buf bytes.Buffer
+				_ = syntax.NewPrinter().Print(&buf, p)
+				b.Write(buf.Bytes())
+			}
+		}
+	}
+	parts(w.Parts)
+
+	return b.String()
+}
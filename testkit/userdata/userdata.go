@@ -0,0 +1,178 @@
+// Package userdata extracts the user data of launch templates and
+// instances from a plan, decodes it (base64, gzip and MIME multi-part, as
+// cloud-init does) and checks it before an instance boots with it: a
+// #cloud-config document is validated against a cloud-init schema and
+// every shell script, including runcmd and bootcmd and executable
+// write_files, is parsed with mvdan.cc/sh. Tests can then assert what an
+// instance would be given, such as the ECS_CLUSTER of /etc/ecs/ecs.config
+// through File and Env, whether a cloud-config writes it or a script
+// echoes it there.
+//
+// aws-ec2-asg passes user_data to its launch template base64-encoded;
+// bananalab-platform builds it as a #cloud-config document and the
+// aws-ecs-cluster example renders a shell script.
+package userdata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+// Part content types.
+const (
+	CloudConfig = "text/cloud-config"
+	ShellScript = "text/x-shellscript"
+	Boothook    = "text/cloud-boothook"
+)
+
+// attributes lists the base64-encoded user data attribute of each
+// resource type. aws_instance and aws_launch_configuration store a hash
+// of plain user_data, so only user_data_base64 can be read back.
+var attributes = map[string]string{
+	"aws_launch_template":      "user_data",
+	"aws_instance":             "user_data_base64",
+	"aws_launch_configuration": "user_data_base64",
+}
+
+// UserData is the decoded user data of a resource.
+type UserData struct {
+	Address string
+	// Raw is the user data after base64 and gzip decoding.
+	Raw []byte
+	// Parts are the parts of a MIME multi-part document, or the whole
+	// document as a single part.
+	Parts []Part
+	// Unknown is set when the user data is known only after apply.
+	Unknown bool
+	// Err is why the user data could not be decoded.
+	Err error
+}
+
+// Part is one part of the user data.
+type Part struct {
+	// Name is the part's filename, or "user_data" for a single-part
+	// document.
+	Name string
+	// Type is the content type cloud-init gives the part, empty when it
+	// does not recognise it and will ignore it.
+	Type    string
+	Content string
+}
+
+// FromPlan returns the user data of every launch template, instance and
+// launch configuration in p that sets any.
+func FromPlan(p *tfjson.Plan) []*UserData {
+	var out []*UserData
+	for _, r := range plan.ResourcesOfType(p, "aws_launch_template", "aws_instance", "aws_launch_configuration") {
+		attr := attributes[r.Type]
+		value := r.String(attr)
+		switch {
+		case value == "" && r.IsUnknown(attr):
+			out = append(out, &UserData{Address: r.Address, Unknown: true})
+		case value != "":
+			u, err := Decode(value)
+			if err != nil {
+				u = &UserData{Err: err}
+			}
+			u.Address = r.Address
+			out = append(out, u)
+		}
+	}
+
+	return out
+}
+
+// Decode decodes base64-encoded user data.
+func Decode(encoded string) (*UserData, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("user data is not valid base64: %w", err)
+	}
+
+	return Parse(raw)
+}
+
+// Parse splits plain user data, gzipped or not, into parts.
+func Parse(raw []byte) (*UserData, error) {
+	if bytes.HasPrefix(raw, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("user data is not valid gzip: %w", err)
+		}
+		if raw, err = io.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("user data is not valid gzip: %w", err)
+		}
+	}
+	u := &UserData{Raw: raw}
+
+	content := string(raw)
+	if !strings.HasPrefix(content, "Content-Type:") && !strings.HasPrefix(content, "MIME-Version:") {
+		u.Parts = []Part{{Name: "user_data", Type: sniff(content), Content: content}}
+		return u, nil
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("user data is not a valid MIME document: %w", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, fmt.Errorf("user data has Content-Type %q, not multipart/mixed", msg.Header.Get("Content-Type"))
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for i := 0; ; i++ {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading part %d of the user data: %w", i, err)
+		}
+		body, err := io.ReadAll(p)
+		if err != nil {
+			return nil, fmt.Errorf("reading part %d of the user data: %w", i, err)
+		}
+		name := p.FileName()
+		if name == "" {
+			name = fmt.Sprintf("part-%03d", i+1)
+		}
+		typ, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		switch typ {
+		case CloudConfig, ShellScript, Boothook:
+		case "text/plain", "":
+			// cloud-init sniffs text/plain parts like a plain document.
+			typ = sniff(string(body))
+		default:
+			typ = ""
+		}
+		u.Parts = append(u.Parts, Part{Name: name, Type: typ, Content: string(body)})
+	}
+
+	return u, nil
+}
+
+// sniff returns the content type cloud-init gives a document by its first
+// line.
+func sniff(content string) string {
+	switch {
+	case strings.HasPrefix(content, "#cloud-config"):
+		return CloudConfig
+	case strings.HasPrefix(content, "#!"):
+		return ShellScript
+	case strings.HasPrefix(content, "#cloud-boothook"):
+		return Boothook
+	}
+
+	return ""
+}
@@ -0,0 +1,253 @@
+package userdata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan/plantest"
+)
+
+const (
+	platformLT = "module.platform.module.asg.aws_launch_template.this"
+	clusterLT  = "module.asg.aws_launch_template.this"
+)
+
+// rawUserData returns the decoded user data of a launch template.
+func rawUserData(t *testing.T, f plantest.Fixture, address string) string {
+	t.Helper()
+	data, err := base64.StdEncoding.DecodeString(f.Values(t, address)["user_data"].(string))
+	require.NoError(t, err)
+
+	return string(data)
+}
+
+// edit replaces old with new in the user data of a launch template.
+func edit(t *testing.T, f plantest.Fixture, address, old, new string) {
+	t.Helper()
+	ud := rawUserData(t, f, address)
+	require.Contains(t, ud, old)
+	f.Values(t, address)["user_data"] = base64.StdEncoding.EncodeToString([]byte(strings.Replace(ud, old, new, 1)))
+}
+
+func userData(t *testing.T, p *tfjson.Plan, address string) *UserData {
+	t.Helper()
+	for _, u := range FromPlan(p) {
+		if u.Address == address {
+			require.NoError(t, u.Err)
+			return u
+		}
+	}
+	t.Fatalf("no user data for %s", address)
+
+	return nil
+}
+
+func TestFromPlan(t *testing.T) {
+	p := plantest.Load(t, "testdata/plan.json").Plan(t)
+	platform := userData(t, p, platformLT)
+	require.Len(t, platform.Parts, 1)
+	assert.Equal(t, CloudConfig, platform.Parts[0].Type)
+	cluster := userData(t, p, clusterLT)
+	require.Len(t, cluster.Parts, 1)
+	assert.Equal(t, ShellScript, cluster.Parts[0].Type)
+}
+
+// Instances only join their cluster when /etc/ecs/ecs.config names it,
+// whether a cloud-config writes the file or a script echoes into it.
+func TestECSConfig(t *testing.T) {
+	p := plantest.Load(t, "testdata/plan.json").Plan(t)
+
+	platform := userData(t, p, platformLT)
+	assert.Equal(t, map[string]string{"ECS_CLUSTER": "bananalab", "ECS_ENABLE_CONTAINER_METADATA": "true"}, platform.Env(ECSConfig))
+	var scripts []string
+	for _, s := range platform.Scripts() {
+		scripts = append(scripts, s.Name)
+	}
+	assert.Equal(t, []string{"runcmd", "write_files[1] (/usr/local/sbin/boot_script.sh)"}, scripts)
+	files := platform.Files()
+	require.Len(t, files, 2)
+	assert.Equal(t, "/usr/local/sbin/boot_script.sh", files[1].Path)
+	assert.Equal(t, "0755", files[1].Permissions)
+
+	cluster := userData(t, p, clusterLT)
+	assert.Equal(t, map[string]string{"ECS_CLUSTER": "module-ecs-example"}, cluster.Env(ECSConfig))
+	files = cluster.Files()
+	require.Len(t, files, 1)
+	assert.True(t, files[0].Append)
+	assert.Equal(t, "user_data line 3", files[0].Source)
+}
+
+func TestParseMultipart(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, err := zw.Write([]byte("ECS_LOGLEVEL=debug\n"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	doc := strings.Join([]string{
+		"Content-Type: multipart/mixed; boundary=\"//\"",
+		"MIME-Version: 1.0",
+		"",
+		"--//",
+		"Content-Type: text/cloud-config; charset=\"us-ascii\"",
+		"",
+		"#cloud-config",
+		"write_files:",
+		"- path: /etc/ecs/ecs.config",
+		"  encoding: gz+b64",
+		"  content: " + base64.StdEncoding.EncodeToString(gz.Bytes()),
+		"",
+		"--//",
+		"Content-Type: text/x-shellscript; charset=\"us-ascii\"",
+		"Content-Disposition: attachment; filename=\"ecs.sh\"",
+		"",
+		"#!/bin/bash",
+		"cat <<'EOF' >> /etc/ecs/ecs.config",
+		"ECS_CLUSTER=bananalab",
+		"ECS_ENABLE_TASK_IAM_ROLE=true",
+		"EOF",
+		"echo 'ECS_AWSVPC_BLOCK_IMDS=true' | tee -a /etc/ecs/ecs.config",
+		"--//--",
+		"",
+	}, "\n")
+	u, err := Parse([]byte(doc))
+	require.NoError(t, err)
+	require.Len(t, u.Parts, 2)
+	assert.Equal(t, CloudConfig, u.Parts[0].Type)
+	assert.Equal(t, "ecs.sh", u.Parts[1].Name)
+	assert.Equal(t, map[string]string{
+		"ECS_LOGLEVEL":             "debug",
+		"ECS_CLUSTER":              "bananalab",
+		"ECS_ENABLE_TASK_IAM_ROLE": "true",
+		"ECS_AWSVPC_BLOCK_IMDS":    "true",
+	}, u.Env(ECSConfig))
+	findings := Check(u)
+	assert.Empty(t, findings, findings.String())
+
+	var zipped bytes.Buffer
+	zw = gzip.NewWriter(&zipped)
+	_, err = zw.Write([]byte("#!/bin/bash\necho hi\n"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	u, err = Decode(base64.StdEncoding.EncodeToString(zipped.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, ShellScript, u.Parts[0].Type)
+}
+
+// The scripts the module examples render parse, and the aws-ecs-cluster
+// example names its cluster.
+func TestExampleScripts(t *testing.T) {
+	for _, path := range []string{
+		"../../modules/aws-ec2-asg/examples/simple/user_data.sh",
+		"../../modules/aws-ecs-cluster/examples/simple/user_data.sh.tftpl",
+		"../../modules/bananalab-platform/examples/simple/boot_script.sh.tftpl",
+	} {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		u, err := Parse(data)
+		require.NoError(t, err)
+		findings := Check(u)
+		assert.Empty(t, findings, "%s: %s", path, findings.String())
+		if strings.Contains(path, "aws-ecs-cluster") {
+			assert.Equal(t, "${name}", u.Env(ECSConfig)["ECS_CLUSTER"])
+		}
+	}
+}
+
+func TestCheckPlan(t *testing.T) {
+	findings := CheckPlan(plantest.Load(t, "testdata/plan.json").Plan(t))
+	assert.Empty(t, findings, findings.String())
+
+	tests := []struct {
+		name   string
+		breaks func(t *testing.T, f plantest.Fixture)
+		want   []plantest.Expected
+	}{
+		{
+			name: "null runcmd entry",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				// What bananalab-platform rendered without a boot_script.
+				edit(t, f, platformLT, `- "/usr/local/sbin/boot_script.sh"`, "- null")
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleCloudConfig, platformLT).At("runcmd[0]")},
+		},
+		{
+			name: "shebang after a blank line",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				// What the bananalab-platform example's boot script rendered.
+				edit(t, f, platformLT, "    #!/bin/bash -uex", "\n    #!/bin/bash -uex")
+			},
+			want: []plantest.Expected{plantest.Want(finding.Medium, RuleShell, platformLT).At("write_files[1] (/usr/local/sbin/boot_script.sh)")},
+		},
+		{
+			name: "shell syntax error",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				edit(t, f, clusterLT, "echo", "if [ -d /etc/ecs ]; then echo")
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleShell, clusterLT).At("user_data")},
+		},
+		{
+			name: "misspelt keys",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				edit(t, f, platformLT, `"runcmd"`, `"runcmds"`)
+				edit(t, f, platformLT, `"permissions"`, `"mode"`)
+			},
+			want: []plantest.Expected{
+				plantest.Want(finding.Medium, RuleCloudConfig, platformLT).At("runcmds"),
+				plantest.Want(finding.High, RuleCloudConfig, platformLT).At("write_files[1].mode"),
+			},
+		},
+		{
+			name: "no ECS_CLUSTER",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				edit(t, f, platformLT, "ECS_CLUSTER=bananalab", "ECS_LOGLEVEL=debug")
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleECS, platformLT).At(ECSConfig)},
+		},
+		{
+			name: "invalid YAML",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				edit(t, f, platformLT, `"runcmd":`, `"runcmd": [`)
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleCloudConfig, platformLT).At("user_data")},
+		},
+		{
+			name: "unrecognised format",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				edit(t, f, clusterLT, "#!/bin/bash\n", "")
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleDecode, clusterLT).At("user_data")},
+		},
+		{
+			name: "not base64",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				f.Values(t, clusterLT)["user_data"] = "#!/bin/bash"
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleDecode, clusterLT).At("user_data")},
+		},
+		{
+			name: "too large",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				edit(t, f, clusterLT, "# Register", "# "+strings.Repeat("x", MaxSize)+"\n# Register")
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleSize, clusterLT).At("user_data")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := plantest.Load(t, "testdata/plan.json")
+			tt.breaks(t, f)
+			findings := CheckPlan(f.Plan(t))
+			plantest.AssertFindings(t, tt.want, findings)
+		})
+	}
+}
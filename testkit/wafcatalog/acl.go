@@ -0,0 +1,378 @@
+package wafcatalog
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/internal/hint"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan"
+)
+
+// Rule identifiers reported by Check and CheckPlan.
+const (
+	RuleGroup     = "waf-managed-group"
+	RuleOverride  = "waf-rule-override"
+	RuleVersion   = "waf-managed-version"
+	RuleCapacity  = "waf-capacity"
+	RulePriority  = "waf-rule-priority"
+	RuleAllowSkip = "waf-allow-override"
+	RuleCountOnly = "waf-count-only"
+)
+
+// WebACLType is the resource type read from a plan.
+const WebACLType = "aws_wafv2_web_acl"
+
+// WebACL is a web ACL and its rules.
+type WebACL struct {
+	Address       string
+	Name          string
+	DefaultAction string
+	// Rules are in priority order.
+	Rules []ACLRule
+}
+
+// ACLRule is a rule of a web ACL.
+type ACLRule struct {
+	Name     string
+	Priority int
+	// Action is the action of a rule with its own statement.
+	Action string
+	// OverrideAction is "none" or "count" for rule group rules.
+	OverrideAction string
+	// Managed is set for managed rule group statements; Statement names
+	// the statement type otherwise.
+	Managed   *ManagedGroup
+	Statement string
+}
+
+// ManagedGroup is a managed_rule_group_statement.
+type ManagedGroup struct {
+	Vendor  string
+	Name    string
+	Version string
+	// Overrides are the rule_action_override blocks in order.
+	Overrides []Override
+}
+
+// Override replaces the action of a rule in a managed rule group.
+type Override struct {
+	Rule   string
+	Action string
+}
+
+// Override returns the action rule name is overridden to, if any.
+func (g *ManagedGroup) Override(name string) (string, bool) {
+	for _, o := range g.Overrides {
+		if o.Rule == name {
+			return o.Action, true
+		}
+	}
+
+	return "", false
+}
+
+// FromPlan returns the web ACLs in p.
+func FromPlan(p *tfjson.Plan) []WebACL {
+	var out []WebACL
+	for _, r := range plan.ResourcesOfType(p, WebACLType) {
+		acl := WebACL{Address: r.Address, Name: r.String("name"), DefaultAction: action(r.Blocks("default_action"))}
+		for _, block := range r.Blocks("rule") {
+			br := plan.Resource{Values: block}
+			rule := ACLRule{
+				Name:           br.String("name"),
+				Priority:       int(br.Number("priority")),
+				Action:         action(br.Blocks("action")),
+				OverrideAction: action(br.Blocks("override_action")),
+			}
+			if statements := br.Blocks("statement"); len(statements) > 0 {
+				sr := plan.Resource{Values: statements[0]}
+				if m := sr.Blocks("managed_rule_group_statement"); len(m) > 0 {
+					rule.Managed = managedGroup(plan.Resource{Values: m[0]})
+				} else {
+					rule.Statement = statementType(statements[0])
+				}
+			}
+			acl.Rules = append(acl.Rules, rule)
+		}
+		sort.SliceStable(acl.Rules, func(i, j int) bool { return acl.Rules[i].Priority < acl.Rules[j].Priority })
+		out = append(out, acl)
+	}
+
+	return out
+}
+
+func managedGroup(r plan.Resource) *ManagedGroup {
+	g := &ManagedGroup{Vendor: r.String("vendor_name"), Name: r.String("name"), Version: r.String("version")}
+	for _, o := range r.Blocks("rule_action_override") {
+		or := plan.Resource{Values: o}
+		g.Overrides = append(g.Overrides, Override{Rule: or.String("name"), Action: action(or.Blocks("action_to_use"))})
+	}
+
+	return g
+}
+
+// action returns which action block of an action, override_action or
+// action_to_use block is set.
+func action(blocks []map[string]interface{}) string {
+	if len(blocks) == 0 {
+		return ""
+	}
+	for _, a := range []string{Allow, Block, Count, Captcha, Challenge, "none"} {
+		if len(plan.Objects(blocks[0][a])) > 0 {
+			return a
+		}
+	}
+
+	return ""
+}
+
+func statementType(statement map[string]interface{}) string {
+	keys := make([]string, 0, len(statement))
+	for k, v := range statement {
+		if len(plan.Objects(v)) > 0 {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	return strings.Join(keys, ",")
+}
+
+// CheckPlan checks every web ACL in p against the default catalog.
+func CheckPlan(p *tfjson.Plan) finding.List {
+	c := DefaultCatalog()
+	var findings finding.List
+	for _, acl := range FromPlan(p) {
+		findings = append(findings, c.Check(acl)...)
+	}
+	findings.Sort()
+
+	return findings
+}
+
+// Check reports unknown rule groups, rules and versions, capacity over
+// the web ACL limit, duplicate priorities, and overrides that let
+// requests skip the rest of the web ACL.
+func (c *Catalog) Check(acl WebACL) finding.List {
+	var findings finding.List
+	add := func(s finding.Severity, rule, path, format string, args ...interface{}) {
+		findings = append(findings, finding.Finding{Severity: s, Rule: rule, Address: acl.Address, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	priorities := map[int]string{}
+	for _, r := range acl.Rules {
+		path := fmt.Sprintf("rule[%s]", r.Name)
+		if other, ok := priorities[r.Priority]; ok {
+			add(finding.High, RulePriority, path+".priority", "priority %d is already used by rule %s", r.Priority, other)
+		} else {
+			priorities[r.Priority] = r.Name
+		}
+
+		m := r.Managed
+		if m == nil {
+			continue
+		}
+		path += ".statement.managed_rule_group_statement"
+		if _, known := c.Vendors[m.Vendor]; !known {
+			add(finding.Low, RuleGroup, path+".vendor_name", "vendor %s is not in the catalog; rule group %s was not checked", m.Vendor, m.Name)
+			continue
+		}
+		g, ok := c.Group(m.Vendor, m.Name)
+		if !ok {
+			add(finding.High, RuleGroup, path+".name", "%s has no managed rule group %q%s", m.Vendor, m.Name, hint.DidYouMean(m.Name, c.GroupNames(m.Vendor)))
+			continue
+		}
+		switch {
+		case m.Version == "":
+		case len(g.Versions) == 0:
+			add(finding.High, RuleVersion, path+".version", "%s is not versioned; remove version %s", m.Name, m.Version)
+		case !contains(g.Versions, m.Version):
+			add(finding.High, RuleVersion, path+".version", "%s has no version %s; known versions are %s to %s", m.Name, m.Version, g.Versions[0], g.Versions[len(g.Versions)-1])
+		}
+
+		overridden := 0
+		for _, o := range m.Overrides {
+			opath := fmt.Sprintf("%s.rule_action_override[%s]", path, o.Rule)
+			own, ok := g.Rule(o.Rule)
+			switch {
+			case !ok:
+				add(finding.High, RuleOverride, opath+".name", "%s has no rule %q%s", m.Name, o.Rule, hint.DidYouMean(o.Rule, g.RuleNames()))
+				continue
+			case o.Action == "":
+				add(finding.High, RuleOverride, opath+".action_to_use", "override of %s sets no action", o.Rule)
+				continue
+			case o.Action == Allow && own.Action != Allow:
+				if later := c.laterRules(acl, r.Priority); len(later) > 0 {
+					add(finding.Medium, RuleAllowSkip, opath+".action_to_use", "allow ends evaluation, so requests matching %s skip %s; use count to only exclude the rule", o.Rule, strings.Join(later, ", "))
+				}
+			}
+			if o.Action == Count || o.Action == Allow {
+				overridden++
+			}
+		}
+		if r.OverrideAction == Count || overridden == len(g.Rules) {
+			add(finding.Low, RuleCountOnly, path, "%s no longer blocks anything: every rule is counted or allowed", m.Name)
+		}
+	}
+
+	capacity, unknown := c.Capacity(acl)
+	if capacity > c.MaxCapacity {
+		add(finding.High, RuleCapacity, "rule", "managed rule groups use %d WCUs, over the web ACL limit of %d", capacity, c.MaxCapacity)
+	}
+	if len(unknown) > 0 {
+		add(finding.Low, RuleCapacity, "rule", "capacity of %s is not in the catalog and was not counted", strings.Join(unknown, ", "))
+	}
+
+	return findings
+}
+
+// laterRules returns the names of the rules evaluated after priority.
+func (c *Catalog) laterRules(acl WebACL, priority int) []string {
+	var out []string
+	for _, r := range acl.Rules {
+		if r.Priority > priority {
+			out = append(out, r.Name)
+		}
+	}
+
+	return out
+}
+
+// Capacity sums the WCUs of the managed rule groups of acl, and returns
+// the rules whose capacity the catalog does not know.
+func (c *Catalog) Capacity(acl WebACL) (int, []string) {
+	total := 0
+	var unknown []string
+	for _, r := range acl.Rules {
+		if r.Managed == nil {
+			unknown = append(unknown, r.Name)
+			continue
+		}
+		g, ok := c.Group(r.Managed.Vendor, r.Managed.Name)
+		if !ok {
+			unknown = append(unknown, r.Name)
+			continue
+		}
+		total += g.Capacity
+	}
+
+	return total, unknown
+}
+
+// Table prints the rules of acl in evaluation order with their WCUs,
+// each followed by the rules of its group whose action is overridden.
+func (c *Catalog) Table(acl WebACL) string {
+	var b bytes.Buffer
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PRIORITY\tRULE\tVERSION\tWCU\tACTION")
+	total, _ := c.Capacity(acl)
+	for _, r := range acl.Rules {
+		if r.Managed == nil {
+			fmt.Fprintf(w, "%d\t%s\t\t?\t%s (%s)\n", r.Priority, r.Name, r.Action, r.Statement)
+			continue
+		}
+		g, ok := c.Group(r.Managed.Vendor, r.Managed.Name)
+		version := r.Managed.Version
+		if version == "" {
+			version = g.DefaultVersion
+		}
+		wcu := "?"
+		if ok {
+			wcu = fmt.Sprint(g.Capacity)
+		}
+		act := "rule actions"
+		if r.OverrideAction == Count {
+			act = "count all"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", r.Priority, r.Name, version, wcu, act)
+		for _, o := range r.Managed.Overrides {
+			if own, ok := g.Rule(o.Rule); ok {
+				fmt.Fprintf(w, "\t  %s\t\t\t%s, not %s\n", o.Rule, o.Action, own.Action)
+			}
+		}
+	}
+	fmt.Fprintf(w, "\tdefault\t\t%d/%d\t%s\n", total, c.MaxCapacity, acl.DefaultAction)
+	w.Flush()
+
+	return b.String()
+}
+
+// Decision is where a request ends up in a web ACL.
+type Decision struct {
+	Action string
+	// Rule is the web ACL rule that decided, empty for the default
+	// action, and GroupRule the rule inside its managed rule group.
+	Rule      string
+	GroupRule string
+	// Counted are the rules that matched and only counted the request,
+	// as rule or rule/group rule.
+	Counted []string
+}
+
+func (d Decision) String() string {
+	by := "default action"
+	if d.Rule != "" {
+		by = d.Rule
+		if d.GroupRule != "" {
+			by += "/" + d.GroupRule
+		}
+	}
+	out := d.Action + " by " + by
+	if len(d.Counted) > 0 {
+		out += ", counted by " + strings.Join(d.Counted, ", ")
+	}
+
+	return out
+}
+
+// Evaluate dry-runs a request through acl. matches names the rules the
+// request would trigger: managed rules by group and rule name, as
+// AWSManagedRulesSQLiRuleSet/SQLi_BODY, and other rules by their name.
+// Captcha and challenge are taken to end evaluation, as they do for a
+// client without a valid token.
+func (c *Catalog) Evaluate(acl WebACL, matches ...string) Decision {
+	matched := map[string]bool{}
+	for _, m := range matches {
+		matched[m] = true
+	}
+	var d Decision
+	for _, r := range acl.Rules {
+		if r.Managed == nil {
+			if !matched[r.Name] {
+				continue
+			}
+			if r.Action == Count {
+				d.Counted = append(d.Counted, r.Name)
+				continue
+			}
+			d.Action, d.Rule = r.Action, r.Name
+			return d
+		}
+
+		g, _ := c.Group(r.Managed.Vendor, r.Managed.Name)
+		for _, rule := range g.Rules {
+			if !matched[r.Managed.Name+"/"+rule.Name] {
+				continue
+			}
+			act := rule.Action
+			if o, ok := r.Managed.Override(rule.Name); ok {
+				act = o
+			}
+			if act == Count || r.OverrideAction == Count {
+				d.Counted = append(d.Counted, r.Name+"/"+rule.Name)
+				continue
+			}
+			d.Action, d.Rule, d.GroupRule = act, r.Name, rule.Name
+			return d
+		}
+	}
+	d.Action = acl.DefaultAction
+
+	return d
+}
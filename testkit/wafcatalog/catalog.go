@@ -0,0 +1,138 @@
+// Package wafcatalog validates the managed rule groups of an
+// aws_wafv2_web_acl, as built by aws-https-alb from waf_managed_rules,
+// against a checked-in catalog of rule groups, their rules, capacities
+// (WCUs) and versions, so a misspelt group or override fails in tests
+// rather than at apply time. Table prints the effective rule order and
+// Evaluate dry-runs which action a request that triggers given managed
+// rules ends with.
+package wafcatalog
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Rule actions.
+const (
+	Allow     = "allow"
+	Block     = "block"
+	Count     = "count"
+	Captcha   = "captcha"
+	Challenge = "challenge"
+)
+
+// Group is a managed rule group.
+type Group struct {
+	// Capacity is the group's web ACL capacity units (WCUs).
+	Capacity int    `json:"capacity"`
+	Rules    []Rule `json:"rules"`
+	// Versions are the static versions of the group, empty for groups
+	// that are not versioned.
+	Versions       []string `json:"versions"`
+	DefaultVersion string   `json:"default_version"`
+}
+
+// Rule is a rule in a managed rule group.
+type Rule struct {
+	Name string `json:"name"`
+	// Action is the rule's own action.
+	Action string `json:"action"`
+}
+
+// Rule returns the rule of g called name.
+func (g Group) Rule(name string) (Rule, bool) {
+	for _, r := range g.Rules {
+		if r.Name == name {
+			return r, true
+		}
+	}
+
+	return Rule{}, false
+}
+
+// RuleNames returns the names of the rules of g in evaluation order.
+func (g Group) RuleNames() []string {
+	names := make([]string, len(g.Rules))
+	for i, r := range g.Rules {
+		names[i] = r.Name
+	}
+
+	return names
+}
+
+// Catalog lists managed rule groups by vendor and group name.
+type Catalog struct {
+	// MaxCapacity is the WCU limit of a web ACL.
+	MaxCapacity int                         `json:"max_capacity"`
+	Actions     []string                    `json:"actions"`
+	Vendors     map[string]map[string]Group `json:"vendors"`
+}
+
+//go:embed catalog.json
+var catalogJSON []byte
+
+// DefaultCatalog returns the checked-in catalog. Update catalog.json when
+// AWS publishes new rule groups, rules or versions.
+func DefaultCatalog() *Catalog {
+	c, err := ParseCatalog(catalogJSON)
+	if err != nil {
+		panic(err)
+	}
+
+	return c
+}
+
+// ParseCatalog parses a catalog in the catalog.json format.
+func ParseCatalog(data []byte) (*Catalog, error) {
+	var c Catalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parsing rule group catalog: %w", err)
+	}
+	for vendor, groups := range c.Vendors {
+		for name, g := range groups {
+			if g.Capacity <= 0 {
+				return nil, fmt.Errorf("rule group catalog: %s/%s has no capacity", vendor, name)
+			}
+			for _, r := range g.Rules {
+				if !contains(c.Actions, r.Action) {
+					return nil, fmt.Errorf("rule group catalog: %s/%s rule %s has unknown action %q", vendor, name, r.Name, r.Action)
+				}
+			}
+			if g.DefaultVersion != "" && !contains(g.Versions, g.DefaultVersion) {
+				return nil, fmt.Errorf("rule group catalog: %s/%s default version %s is not listed", vendor, name, g.DefaultVersion)
+			}
+		}
+	}
+
+	return &c, nil
+}
+
+// Group returns the managed rule group name of vendor.
+func (c *Catalog) Group(vendor, name string) (Group, bool) {
+	g, ok := c.Vendors[vendor][name]
+
+	return g, ok
+}
+
+// GroupNames returns the group names of vendor, sorted.
+func (c *Catalog) GroupNames(vendor string) []string {
+	names := make([]string, 0, len(c.Vendors[vendor]))
+	for name := range c.Vendors[vendor] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,218 @@
+package wafcatalog
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/JQUINONES82/terraform_modules/testkit/finding"
+	"github.com/JQUINONES82/terraform_modules/testkit/plan/plantest"
+)
+
+const acl = "module.edge.aws_wafv2_web_acl.this[0]"
+
+// groupRule returns the web ACL rule for the managed rule group called group.
+func groupRule(t *testing.T, f plantest.Fixture, group string) map[string]interface{} {
+	t.Helper()
+	for _, r := range f.Values(t, acl)["rule"].([]interface{}) {
+		if r := r.(map[string]interface{}); r["name"] == "AWS-"+group {
+			return r
+		}
+	}
+	t.Fatalf("no rule for %s", group)
+
+	return nil
+}
+
+// statement returns the managed_rule_group_statement of a rule.
+func statement(rule map[string]interface{}) map[string]interface{} {
+	s := rule["statement"].([]interface{})[0].(map[string]interface{})
+
+	return s["managed_rule_group_statement"].([]interface{})[0].(map[string]interface{})
+}
+
+// override sets the action_to_use of a rule action override.
+func override(t *testing.T, f plantest.Fixture, group, rule, action string) {
+	t.Helper()
+	to := map[string]interface{}{}
+	for _, a := range []string{Allow, Block, Count, Captcha, Challenge} {
+		to[a] = []interface{}{}
+	}
+	to[action] = []interface{}{map[string]interface{}{}}
+	s := statement(groupRule(t, f, group))
+	s["rule_action_override"] = []interface{}{map[string]interface{}{"name": rule, "action_to_use": []interface{}{to}}}
+}
+
+// addGroup appends a rule for a managed rule group after the others.
+func addGroup(t *testing.T, f plantest.Fixture, group string) {
+	t.Helper()
+	v := f.Values(t, acl)
+	rules := v["rule"].([]interface{})
+	data, err := json.Marshal(rules[0])
+	require.NoError(t, err)
+	var r map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &r))
+	r["name"], r["priority"] = "AWS-"+group, len(rules)
+	statement(r)["name"] = group
+	v["rule"] = append(rules, r)
+}
+
+func TestCatalog(t *testing.T) {
+	c := DefaultCatalog()
+	assert.Equal(t, 1500, c.MaxCapacity)
+	g, ok := c.Group("AWS", "AWSManagedRulesCommonRuleSet")
+	require.True(t, ok)
+	assert.Equal(t, 700, g.Capacity)
+	assert.Contains(t, g.Versions, g.DefaultVersion)
+	r, ok := g.Rule("SizeRestrictions_BODY")
+	require.True(t, ok)
+	assert.Equal(t, Block, r.Action)
+
+	_, err := ParseCatalog([]byte(`{"actions":["block"],"vendors":{"AWS":{"G":{"capacity":10,"rules":[{"name":"R","action":"deny"}]}}}}`))
+	assert.ErrorContains(t, err, `AWS/G rule R has unknown action "deny"`)
+	_, err = ParseCatalog([]byte(`{"vendors":{"AWS":{"G":{"capacity":10,"versions":["Version_1.0"],"default_version":"Version_2.0"}}}}`))
+	assert.ErrorContains(t, err, "default version Version_2.0 is not listed")
+}
+
+func TestFromPlan(t *testing.T) {
+	acls := FromPlan(plantest.Load(t, "testdata/plan.json").Plan(t))
+	require.Len(t, acls, 1)
+	a := acls[0]
+	assert.Equal(t, acl, a.Address)
+	assert.Equal(t, Allow, a.DefaultAction)
+	require.Len(t, a.Rules, 7)
+	for i, r := range a.Rules {
+		assert.Equal(t, i, r.Priority)
+		assert.Equal(t, "none", r.OverrideAction)
+		require.NotNil(t, r.Managed)
+		assert.Equal(t, "AWS", r.Managed.Vendor)
+	}
+	common := a.Rules[2].Managed
+	assert.Equal(t, "AWSManagedRulesCommonRuleSet", common.Name)
+	assert.Equal(t, []Override{{Rule: "SizeRestrictions_BODY", Action: Count}}, common.Overrides)
+}
+
+func TestCheckPlan(t *testing.T) {
+	findings := CheckPlan(plantest.Load(t, "testdata/plan.json").Plan(t))
+	assert.Empty(t, findings, findings.String())
+
+	tests := []struct {
+		name   string
+		breaks func(t *testing.T, f plantest.Fixture)
+		want   []plantest.Expected
+	}{
+		{
+			name: "misspelt rule group",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				statement(groupRule(t, f, "AWSManagedRulesSQLiRuleSet"))["name"] = "AWSManagedRulesSQLIRuleset"
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleGroup, acl), plantest.Want(finding.Low, RuleCapacity, acl)},
+		},
+		{
+			name: "misspelt rule override",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				override(t, f, "AWSManagedRulesCommonRuleSet", "SizeRestriction_BODY", Count)
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleOverride, acl)},
+		},
+		{
+			name: "allow override skips later groups",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				// What every override used to become.
+				override(t, f, "AWSManagedRulesCommonRuleSet", "SizeRestrictions_BODY", Allow)
+			},
+			want: []plantest.Expected{plantest.Want(finding.Medium, RuleAllowSkip, acl)},
+		},
+		{
+			name: "over capacity",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				addGroup(t, f, "AWSManagedRulesAdminProtectionRuleSet")
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleCapacity, acl)},
+		},
+		{
+			name: "unknown versions",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				statement(groupRule(t, f, "AWSManagedRulesCommonRuleSet"))["version"] = "Version_2.0"
+				statement(groupRule(t, f, "AWSManagedRulesAnonymousIpList"))["version"] = "Version_1.0"
+				statement(groupRule(t, f, "AWSManagedRulesSQLiRuleSet"))["version"] = "Version_1.1"
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RuleVersion, acl), plantest.Want(finding.High, RuleVersion, acl)},
+		},
+		{
+			name: "duplicate priority",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				groupRule(t, f, "AWSManagedRulesSQLiRuleSet")["priority"] = 0
+			},
+			want: []plantest.Expected{plantest.Want(finding.High, RulePriority, acl)},
+		},
+		{
+			name: "group only counts",
+			breaks: func(t *testing.T, f plantest.Fixture) {
+				groupRule(t, f, "AWSManagedRulesPHPRuleSet")["override_action"] = []interface{}{
+					map[string]interface{}{"count": []interface{}{map[string]interface{}{}}, "none": []interface{}{}},
+				}
+			},
+			want: []plantest.Expected{plantest.Want(finding.Low, RuleCountOnly, acl)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := plantest.Load(t, "testdata/plan.json")
+			tt.breaks(t, f)
+			findings := CheckPlan(f.Plan(t))
+			plantest.AssertFindings(t, tt.want, findings)
+		})
+	}
+}
+
+func TestTable(t *testing.T) {
+	a := FromPlan(plantest.Load(t, "testdata/plan.json").Plan(t))[0]
+	want := `PRIORITY  RULE                                       VERSION       WCU        ACTION
+0         AWS-AWSManagedRulesAmazonIpReputationList                25         rule actions
+1         AWS-AWSManagedRulesAnonymousIpList                       50         rule actions
+2         AWS-AWSManagedRulesCommonRuleSet           Version_1.12  700        rule actions
+            SizeRestrictions_BODY                                             count, not block
+3         AWS-AWSManagedRulesKnownBadInputsRuleSet   Version_1.22  200        rule actions
+4         AWS-AWSManagedRulesLinuxRuleSet            Version_2.6   200        rule actions
+5         AWS-AWSManagedRulesPHPRuleSet              Version_2.1   100        rule actions
+6         AWS-AWSManagedRulesSQLiRuleSet             Version_1.2   200        rule actions
+          default                                                  1475/1500  allow
+`
+	assert.Equal(t, want, DefaultCatalog().Table(a))
+}
+
+func TestEvaluate(t *testing.T) {
+	c := DefaultCatalog()
+	a := FromPlan(plantest.Load(t, "testdata/plan.json").Plan(t))[0]
+	tests := []struct {
+		matches []string
+		want    string
+	}{
+		{nil, "allow by default action"},
+		{[]string{"AWSManagedRulesSQLiRuleSet/SQLi_BODY"}, "block by AWS-AWSManagedRulesSQLiRuleSet/SQLi_BODY"},
+		{
+			[]string{"AWSManagedRulesCommonRuleSet/SizeRestrictions_BODY"},
+			"allow by default action, counted by AWS-AWSManagedRulesCommonRuleSet/SizeRestrictions_BODY",
+		},
+		{
+			[]string{"AWSManagedRulesCommonRuleSet/SizeRestrictions_BODY", "AWSManagedRulesSQLiRuleSet/SQLi_BODY"},
+			"block by AWS-AWSManagedRulesSQLiRuleSet/SQLi_BODY, counted by AWS-AWSManagedRulesCommonRuleSet/SizeRestrictions_BODY",
+		},
+		{
+			[]string{"AWSManagedRulesSQLiRuleSet/SQLi_BODY", "AWSManagedRulesAmazonIpReputationList/AWSManagedIPReputationList"},
+			"block by AWS-AWSManagedRulesAmazonIpReputationList/AWSManagedIPReputationList",
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, c.Evaluate(a, tt.matches...).String(), "%v", tt.matches)
+	}
+
+	// With the allow override every override used to get, a large body
+	// carrying SQL injection gets through.
+	a.Rules[2].Managed.Overrides[0].Action = Allow
+	d := c.Evaluate(a, "AWSManagedRulesCommonRuleSet/SizeRestrictions_BODY", "AWSManagedRulesSQLiRuleSet/SQLi_BODY")
+	assert.Equal(t, "allow by AWS-AWSManagedRulesCommonRuleSet/SizeRestrictions_BODY", d.String())
+}